@@ -0,0 +1,68 @@
+// Command lambda runs the bot on AWS lambda using the slack Events API instead of socket mode.
+//
+// The same binary is deployed as two functions, selected with SLACKGPT_LAMBDA_ROLE:
+//
+//	ingress: behind a function URL, verifies requests with SLACK_SIGNING_SECRET and sends them to SQS_QUEUE_URL
+//	worker:  triggered by that queue, answers events as the bot configured by the environment does, e.g. with
+//	         CGPT_API_KEY and SLACK_BOT_TOKEN, sharing conversations through Redis with CONVERSATION_STORE=redis
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-lambda-go/lambda"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	configs "github.com/chikamif/slackgpt/config"
+	"github.com/chikamif/slackgpt/src/engine"
+	"github.com/chikamif/slackgpt/src/serverless"
+	"go.uber.org/zap"
+	"os"
+)
+
+func main() {
+	log, err := zap.NewProduction()
+	if err != nil {
+		fmt.Println("Error constructing logger:", err)
+		os.Exit(1)
+	}
+	defer log.Sync()
+
+	handler, err := newHandler(os.Getenv("SLACKGPT_LAMBDA_ROLE"), log)
+	if err != nil {
+		log.Sugar().Errorw("startup", "ERROR", err)
+		os.Exit(1)
+	}
+	lambda.Start(handler)
+}
+
+// newHandler builds the lambda handler for role from the environment
+func newHandler(role string, log *zap.Logger) (any, error) {
+	simpleLogger := zap.NewStdLog(log)
+	switch role {
+	case "ingress":
+		secret, queueURL := os.Getenv("SLACK_SIGNING_SECRET"), os.Getenv("SQS_QUEUE_URL")
+		if secret == "" || queueURL == "" {
+			return nil, fmt.Errorf("ingress requires SLACK_SIGNING_SECRET and SQS_QUEUE_URL")
+		}
+		awsCfg, err := awsconfig.LoadDefaultConfig(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		queue := serverless.NewSQSQueue(sqs.NewFromConfig(awsCfg), queueURL)
+		return serverless.IngressHandler(serverless.NewIngress(secret, queue, simpleLogger)), nil
+	case "worker":
+		cfg, err := configs.LoadConfigFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		// the events come in over HTTP through the ingress, edits only if the app subscribes to message events
+		bot, err := engine.New(cfg, engine.Options{Logger: simpleLogger, Mode: configs.ModeHTTP})
+		if err != nil {
+			return nil, err
+		}
+		return serverless.WorkerHandler(serverless.NewWorker(bot.Processor(), simpleLogger)), nil
+	default:
+		return nil, fmt.Errorf("SLACKGPT_LAMBDA_ROLE must be ingress or worker, got %q", role)
+	}
+}
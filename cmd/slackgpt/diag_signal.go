@@ -0,0 +1,14 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyDiagnostics relays SIGUSR1 to c as a request for a diagnostic dump
+func notifyDiagnostics(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR1)
+}
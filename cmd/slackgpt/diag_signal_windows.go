@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// notifyDiagnostics does nothing because windows has no SIGUSR1
+func notifyDiagnostics(c chan<- os.Signal) {}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/alexflint/go-arg"
+	configs "github.com/chikamif/slackgpt/config"
+	"github.com/chikamif/slackgpt/src/engine"
+	"github.com/chikamif/slackgpt/src/loadtest"
+	"github.com/chikamif/slackgpt/src/prompttest"
+	"github.com/chikamif/slackgpt/src/report"
+	slackgpt "github.com/chikamif/slackgpt/src/slack"
+	"go.uber.org/automaxprocs/maxprocs"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+const VERSION = 1.0
+
+type args struct {
+	Config   string       `arg:"-c,--config" help:"config file with slack app+bot tokens, chat-gpt API token; if not passed, ./slackgpt.yaml, $XDG_CONFIG_HOME/slackgpt/config.yaml and /etc/slackgpt/config.yaml are tried before reading the environment"`
+	Type     string       `arg:"-t, --type" default:"" help:"the config type [json, toml, yaml, hcl, ini, env, properties]; if not passed, inferred from file ext"`
+	Debug    bool         `arg:"--debug" help:"set debug mode for client logging"`
+	LogFile  string       `arg:"--log-file" help:"append logs to this file instead of stdout"`
+	Mode     string       `arg:"--mode" default:"socket" help:"how slack's events are received: socket connects with socket mode, http serves them at HTTP_ADDR"`
+	Loadtest *loadtestCmd `arg:"subcommand:loadtest" help:"drive synthetic events through the handler against fake slack and openai servers"`
+	Service  *serviceCmd  `arg:"subcommand:service" help:"install, uninstall or run as a windows service"`
+	Prompt   *promptCmd   `arg:"subcommand:prompt" help:"work on the configured prompts outside slack"`
+	Import   *importCmd   `arg:"subcommand:import" help:"import the question and answer history exported from another bot"`
+	Report   *reportCmd   `arg:"subcommand:report" help:"report active users, answers by channel, feedback and cost from the usage and feedback files"`
+}
+
+type loadtestCmd struct {
+	Events      int           `arg:"-n,--events" default:"200" help:"number of synthetic mentions sent at each concurrency level"`
+	Concurrency []int         `arg:"--concurrency" help:"concurrency levels to test [default: 1 8 32]"`
+	GPTLatency  time.Duration `arg:"--gpt-latency" default:"200ms" help:"how long the fake openai server takes to answer"`
+	Timeout     time.Duration `arg:"--timeout" default:"30s" help:"how long a single mention may wait for its answer"`
+}
+
+type promptCmd struct {
+	Test *promptTestCmd `arg:"subcommand:test" help:"render a configured prompt template with sample inputs and optionally answer them"`
+	Diff *promptDiffCmd `arg:"subcommand:diff" help:"answer test questions with two prompt templates and show the answers side by side"`
+}
+
+type promptTestCmd struct {
+	Template string `arg:"--template,required" help:"system, channel/<channel ID> or branch/<variant name>"`
+	Input    string `arg:"--input,required" help:"file of sample questions separated by lines of ---"`
+	Run      string `arg:"--run" help:"answer the samples with the mock or real provider"`
+}
+
+type promptDiffCmd struct {
+	A      string `arg:"-a,required" help:"the first template: system, channel/<channel ID> or branch/<variant name>"`
+	B      string `arg:"-b,required" help:"the second template"`
+	ModelA string `arg:"--model-a" help:"answer with this model instead of the first template's"`
+	ModelB string `arg:"--model-b" help:"answer with this model instead of the second template's"`
+	Input  string `arg:"--input,required" help:"file of test questions separated by lines of ---"`
+	Run    string `arg:"--run" default:"mock" help:"answer with the mock or real provider"`
+	Width  int    `arg:"--width" default:"60" help:"width of each column of the report"`
+}
+
+type importCmd struct {
+	Input  string   `arg:"--input,required" help:"JSONL file of {\"channel\", \"thread_ts\", \"question\", \"answer\"} objects, oldest first"`
+	Into   []string `arg:"--into" help:"conversations, faqs or both [default: conversations faqs]"`
+	DryRun bool     `arg:"--dry-run" help:"check the file and report what would be imported without changing anything"`
+}
+
+type reportCmd struct {
+	Since  string `arg:"--since" default:"30d" help:"start of the period: a number of days such as 30d, a duration or a date such as 2024-06-01"`
+	Format string `arg:"--format" default:"markdown" help:"markdown or csv"`
+	Output string `arg:"-o,--output" help:"write the report to this file instead of stdout"`
+}
+
+type serviceCmd struct {
+	Action string `arg:"positional,required" help:"install, uninstall or run"`
+	Name   string `arg:"--name" default:"slackgpt" help:"the windows service name"`
+}
+
+func (args) Version() string {
+	return fmt.Sprintf("VERSION: %v\n", VERSION)
+}
+
+func (args) Description() string {
+	return "This program is a slack bot that sends mentions to chat-gpt and responds with chat-gpt result\n"
+}
+
+func (args) Epilogue() string {
+	return "for more information, visit https://github.com/chikamif/slackgpt"
+}
+
+func main() {
+	var arguments args
+	arg.MustParse(&arguments)
+
+	// Perform the startup and shutdown sequence
+	log, err := initLogger("SLACKGPT-BOT", arguments.LogFile)
+	if err != nil {
+		fmt.Println("Error constructing logger:", err)
+		os.Exit(1)
+	}
+	defer log.Sync()
+
+	if arguments.Service != nil {
+		if err := runService(*arguments.Service, arguments, log); err != nil {
+			log.Errorw("service", "ERROR", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if arguments.Prompt != nil && arguments.Prompt.Test != nil {
+		if err := runPromptTest(*arguments.Prompt.Test, arguments, log); err != nil {
+			log.Errorw("prompt test", "ERROR", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if arguments.Prompt != nil && arguments.Prompt.Diff != nil {
+		if err := runPromptDiff(*arguments.Prompt.Diff, arguments, log); err != nil {
+			log.Errorw("prompt diff", "ERROR", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if arguments.Import != nil {
+		if err := runImport(*arguments.Import, arguments, log); err != nil {
+			log.Errorw("import", "ERROR", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if arguments.Report != nil {
+		if err := runReport(*arguments.Report, arguments, log); err != nil {
+			log.Errorw("report", "ERROR", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if arguments.Loadtest != nil {
+		if err := runLoadtest(*arguments.Loadtest, log); err != nil {
+			log.Errorw("loadtest", "ERROR", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	log.Infow("startup", "version", arguments.Version())
+	if err := run(arguments, log); err != nil {
+		log.Errorw("shutdown", "ERROR", err)
+		os.Exit(1)
+	}
+}
+
+func runLoadtest(cmd loadtestCmd, log *zap.SugaredLogger) error {
+	if len(cmd.Concurrency) == 0 {
+		cmd.Concurrency = []int{1, 8, 32}
+	}
+	log.Infow("loadtest", "events", cmd.Events, "concurrency", cmd.Concurrency, "gpt_latency", cmd.GPTLatency)
+	results, err := loadtest.Run(context.Background(), loadtest.Options{
+		Events:      cmd.Events,
+		Concurrency: cmd.Concurrency,
+		GPTLatency:  cmd.GPTLatency,
+		Timeout:     cmd.Timeout,
+	})
+	for _, result := range results {
+		fmt.Println(result)
+	}
+	return err
+}
+
+func runPromptTest(cmd promptTestCmd, arg args, log *zap.SugaredLogger) error {
+	input, err := os.ReadFile(cmd.Input)
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfig(arg, log)
+	if err != nil {
+		return err
+	}
+	opts := prompttest.Options{Template: cmd.Template, Templates: engine.PromptTemplates(cfg), Input: string(input)}
+	if cmd.Run != "" {
+		provider, stop, err := engine.PromptProvider(cmd.Run, cfg)
+		if err != nil {
+			return err
+		}
+		defer stop()
+		opts.Provider = provider
+	}
+	return prompttest.Run(context.Background(), os.Stdout, opts)
+}
+
+func runPromptDiff(cmd promptDiffCmd, arg args, log *zap.SugaredLogger) error {
+	input, err := os.ReadFile(cmd.Input)
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfig(arg, log)
+	if err != nil {
+		return err
+	}
+	templates := engine.PromptTemplates(cfg)
+	// a model override compares the template under its own name, so both sides may use the same template
+	for _, side := range []struct{ name, model *string }{{&cmd.A, &cmd.ModelA}, {&cmd.B, &cmd.ModelB}} {
+		template, ok := templates[*side.name]
+		if !ok || *side.model == "" {
+			continue
+		}
+		template.Model = *side.model
+		*side.name += "@" + *side.model
+		templates[*side.name] = template
+	}
+	provider, stop, err := engine.PromptProvider(cmd.Run, cfg)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	return prompttest.Compare(context.Background(), os.Stdout, prompttest.CompareOptions{
+		A: cmd.A, B: cmd.B, Templates: templates, Input: string(input), Provider: provider, Width: cmd.Width,
+	})
+}
+
+func runImport(cmd importCmd, arg args, log *zap.SugaredLogger) error {
+	if len(cmd.Into) == 0 {
+		cmd.Into = []string{"conversations", "faqs"}
+	}
+	file, err := os.Open(cmd.Input)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	records, err := slackgpt.ReadImport(file)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", cmd.Input, err)
+	}
+	cfg, err := loadConfig(arg, log)
+	if err != nil {
+		return err
+	}
+	result, err := engine.Import(context.Background(), cfg, records, cmd.Into, cmd.DryRun, zap.NewStdLog(log.Desugar()))
+	if cmd.DryRun && err == nil {
+		log.Infow("import", "status", "dry run", "records", len(records), "into", cmd.Into)
+		return nil
+	}
+	log.Infow("import", "records", len(records), "conversations", result.Conversations, "messages", result.Messages,
+		"faqs", result.FAQs, "duplicate_faqs", result.DuplicateFAQs)
+	return err
+}
+
+func runReport(cmd reportCmd, arg args, log *zap.SugaredLogger) error {
+	now := time.Now()
+	since, err := report.ParseSince(cmd.Since, now)
+	if err != nil {
+		return err
+	}
+	if cmd.Format != "markdown" && cmd.Format != "csv" {
+		return fmt.Errorf("--format must be markdown or csv, got %q", cmd.Format)
+	}
+	cfg, err := loadConfig(arg, log)
+	if err != nil {
+		return err
+	}
+	r, err := engine.Report(cfg, since, now)
+	if err != nil {
+		return err
+	}
+	out := os.Stdout
+	if cmd.Output != "" {
+		if out, err = os.Create(cmd.Output); err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+	if cmd.Format == "csv" {
+		return r.WriteCSV(out)
+	}
+	return r.WriteMarkdown(out)
+}
+
+// run starts the bot and stops it on an interrupt or term signal
+func run(arg args, log *zap.SugaredLogger) error {
+	// make a channel to listen for an interrupt or term signal from the os
+	// use a buffered channel because the signal package requires it
+	shutdown := make(chan os.Signal, 1)
+	// Should I capture more?
+	signal.Notify(shutdown, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(shutdown)
+	return serve(arg, log, shutdown)
+}
+
+// serve starts the bot and stops it once a signal is received on shutdown
+func serve(arg args, log *zap.SugaredLogger, shutdown <-chan os.Signal) error {
+	// ========================
+	// GOMAXPROCS
+
+	// set the correct number of threads for the service
+	// based on either machine or quotas in kub
+	if _, err := maxprocs.Set(); err != nil {
+		return fmt.Errorf("maxprocs: %w", err)
+	}
+	log.Infow("startup", "GOMAXPROCS", runtime.GOMAXPROCS(0))
+	cfg, err := loadConfig(arg, log)
+	if err != nil {
+		return err
+	}
+	bot, err := engine.New(cfg, engine.Options{Logger: zap.NewStdLog(log.Desugar()), Mode: arg.Mode, Debug: arg.Debug})
+	if err != nil {
+		return err
+	}
+	defer bot.Close()
+	log.Infow("startup", "status", "bot built", "provider", cfg.ChatProvider, "mode", arg.Mode)
+	// SIGUSR1 dumps diagnostics without interrupting the bot
+	diagnostics := make(chan os.Signal, 1)
+	notifyDiagnostics(diagnostics)
+	defer signal.Stop(diagnostics)
+
+	// cancelling ctx stops the bot, which then drains its in-flight events
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// the channel has a buffer of 1, so the goroutine returns even when the bot stops during shutdown
+	served := make(chan error, 1)
+	go func() {
+		served <- bot.Serve(ctx, diagnostics)
+	}()
+
+	// Blocking main and waiting for shutdown
+	select {
+	case err := <-served:
+		return fmt.Errorf("handler error: %w", err)
+
+	case sig := <-shutdown:
+		log.Infow("shutdown", "status", "shutdown started", "signal", sig)
+		defer log.Infow("shutdown", "status", "shutdown complete", "signal", sig)
+		cancel()
+		if err := <-served; err != nil {
+			return fmt.Errorf("handler error during shutdown: %w", err)
+		}
+		return nil
+	}
+}
+
+// loadConfig reads the config file passed with --config, or the first one found in a default location,
+// falling back to environment variables when there is none
+func loadConfig(arg args, log *zap.SugaredLogger) (configs.Config, error) {
+	path := arg.Config
+	if path == "" {
+		path = configs.FindConfig()
+	}
+	if path == "" {
+		log.Infow("startup", "config", "environment")
+		return configs.LoadConfigFromEnv()
+	}
+	log.Infow("startup", "config", path)
+	cfgParts, err := configs.ParseConfigFromPath(path, arg.Type)
+	if err != nil {
+		return configs.Config{}, err
+	}
+	return configs.LoadConfig(cfgParts)
+}
+
+// initLogger builds the service logger, writing to logFile when it is set and stdout otherwise
+func initLogger(service, logFile string) (*zap.SugaredLogger, error) {
+	config := zap.NewProductionConfig()
+	config.OutputPaths = []string{"stdout"}
+	if logFile != "" {
+		config.OutputPaths = []string{logFile}
+	}
+	config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	config.DisableStacktrace = true
+	config.InitialFields = map[string]any{
+		"service": service,
+	}
+	log, err := config.Build()
+	if err != nil {
+		return nil, err
+	}
+	return log.Sugar(), nil
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"go.uber.org/zap"
+)
+
+// runService is only supported on windows, elsewhere use the platform's service manager to run the bot directly
+func runService(cmd serviceCmd, arg args, log *zap.SugaredLogger) error {
+	return errors.New("the service command is only supported on windows")
+}
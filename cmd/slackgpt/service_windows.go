@@ -0,0 +1,135 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// runService installs, uninstalls or runs the bot as a windows service
+func runService(cmd serviceCmd, arg args, log *zap.SugaredLogger) error {
+	switch cmd.Action {
+	case "install":
+		return installService(cmd.Name, arg)
+	case "uninstall":
+		return uninstallService(cmd.Name)
+	case "run":
+		isService, err := svc.IsWindowsService()
+		if err != nil {
+			return err
+		}
+		if !isService {
+			return fmt.Errorf("service run must be started by the service control manager, use `sc start %s`", cmd.Name)
+		}
+		return svc.Run(cmd.Name, &windowsService{arg: arg, log: log})
+	default:
+		return fmt.Errorf("unknown service action %q, expected install, uninstall or run", cmd.Action)
+	}
+}
+
+// installService registers the current executable to start automatically with the same flags: config, log file,
+// config type, mode and debug. Paths are made absolute because services start in the system directory.
+func installService(name string, arg args) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	var serviceArgs []string
+	for _, flag := range []struct{ name, path string }{{"--config", arg.Config}, {"--log-file", arg.LogFile}} {
+		if flag.path == "" {
+			continue
+		}
+		abs, err := filepath.Abs(flag.path)
+		if err != nil {
+			return err
+		}
+		serviceArgs = append(serviceArgs, flag.name, abs)
+	}
+	if arg.Type != "" {
+		serviceArgs = append(serviceArgs, "--type", arg.Type)
+	}
+	if arg.Mode != "" {
+		serviceArgs = append(serviceArgs, "--mode", arg.Mode)
+	}
+	if arg.Debug {
+		serviceArgs = append(serviceArgs, "--debug")
+	}
+	serviceArgs = append(serviceArgs, "service", "run", "--name", name)
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	s, err := m.CreateService(name, exe, mgr.Config{
+		DisplayName: "slackgpt",
+		Description: "slack bot that answers mentions with chat-gpt",
+		StartType:   mgr.StartAutomatic,
+	}, serviceArgs...)
+	if err != nil {
+		return fmt.Errorf("create service %s: %w", name, err)
+	}
+	return s.Close()
+}
+
+// uninstallService removes the service, a running service is removed once it stops
+func uninstallService(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("open service %s: %w", name, err)
+	}
+	defer s.Close()
+	return s.Delete()
+}
+
+// windowsService maps service control requests onto the same shutdown path as SIGTERM
+type windowsService struct {
+	arg args
+	log *zap.SugaredLogger
+}
+
+// Execute runs the bot until the service is stopped or the bot fails
+func (w *windowsService) Execute(_ []string, requests <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	const accepted = svc.AcceptStop | svc.AcceptShutdown
+	changes <- svc.Status{State: svc.StartPending}
+
+	shutdown := make(chan os.Signal, 1)
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(w.arg, w.log, shutdown)
+	}()
+	changes <- svc.Status{State: svc.Running, Accepts: accepted}
+
+	for {
+		select {
+		case err := <-served:
+			// the bot stopped without being asked to
+			w.log.Errorw("service", "ERROR", err)
+			return false, 1
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				changes <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending}
+				shutdown <- syscall.SIGTERM
+				if err := <-served; err != nil {
+					w.log.Errorw("service", "ERROR", err)
+					return false, 1
+				}
+				return false, 0
+			}
+		}
+	}
+}
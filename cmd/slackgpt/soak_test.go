@@ -0,0 +1,139 @@
+//go:build soak && !windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/chikamif/slackgpt/src/leakcheck"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestSoak runs the full bot against fake slack and openai servers for SOAK_DURATION (default 2m),
+// sending a steady stream of mentions and asserting that every event is acked and answered and that
+// goroutine count and heap size stay stable. Run it with `make soak`.
+func TestSoak(t *testing.T) {
+	duration := 2 * time.Minute
+	if d, err := time.ParseDuration(os.Getenv("SOAK_DURATION")); err == nil {
+		duration = d
+	}
+	const (
+		interval = 50 * time.Millisecond
+		threads  = 50
+	)
+
+	before := leakcheck.Take()
+	slackServer := fake.NewSlack()
+	defer slackServer.Close()
+	gptServer := fake.NewOpenAI(20 * time.Millisecond)
+	defer gptServer.Close()
+	var answered atomic.Int64
+	slackServer.OnPost(func(fake.Message) { answered.Add(1) })
+
+	cfgPath := filepath.Join(t.TempDir(), "soak.json")
+	cfg := fmt.Sprintf(`{"CGPT_API_KEY": "sk-soak", "SLACK_APP_TOKEN": "xapp-soak", "SLACK_BOT_TOKEN": "xoxb-soak",
+		"CGPT_BASE_URL": %q, "SLACK_API_URL": %q}`, gptServer.URL(), slackServer.APIURL())
+	require.NoError(t, os.WriteFile(cfgPath, []byte(cfg), 0o600))
+
+	log, err := initLogger("SLACKGPT-SOAK", "")
+	require.NoError(t, err)
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- run(args{Config: cfgPath}, log)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, slackServer.WaitConnected(ctx))
+
+	var sent int64
+	send := func() {
+		ts := fmt.Sprintf("%d.%06d", time.Now().Unix(), sent)
+		_, err := slackServer.SendEvent(slackevents.AppMentionEvent{
+			Type:            string(slackevents.AppMention),
+			User:            "USOAK",
+			Text:            fmt.Sprintf("<@U0BOT> soak question %d", sent),
+			Channel:         "CSOAK",
+			TimeStamp:       ts,
+			ThreadTimeStamp: fmt.Sprintf("1700000000.%06d", sent%threads),
+		})
+		require.NoError(t, err)
+		sent++
+	}
+	drain := func() {
+		deadline := time.Now().Add(30 * time.Second)
+		for answered.Load() < sent && time.Now().Before(deadline) {
+			time.Sleep(interval)
+		}
+	}
+	sample := func() (int, uint64) {
+		runtime.GC()
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+		return runtime.NumGoroutine(), mem.HeapAlloc
+	}
+
+	// warm up until every thread holds a full conversation before taking the baseline
+	for i := 0; i < threads*8; i++ {
+		send()
+		time.Sleep(interval / 10)
+	}
+	drain()
+	baseGoroutines, baseHeap := sample()
+	t.Logf("baseline: goroutines=%d heap=%dKiB", baseGoroutines, baseHeap/1024)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	report := time.NewTicker(10 * time.Second)
+	defer report.Stop()
+	end := time.After(duration)
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			send()
+		case <-report.C:
+			goroutines, heap := sample()
+			t.Logf("sent=%d answered=%d acks=%d goroutines=%d heap=%dKiB",
+				sent, answered.Load(), slackServer.Acks(), goroutines, heap/1024)
+		case err := <-runErr:
+			t.Fatalf("bot exited during soak: %v", err)
+		case <-end:
+			break loop
+		}
+	}
+
+	drain()
+	goroutines, heap := sample()
+	t.Logf("final: sent=%d answered=%d acks=%d goroutines=%d heap=%dKiB",
+		sent, answered.Load(), slackServer.Acks(), goroutines, heap/1024)
+	assert.Equal(t, sent, answered.Load(), "dropped events")
+	assert.Equal(t, sent, slackServer.Acks(), "unacknowledged events")
+	assert.LessOrEqual(t, goroutines, baseGoroutines+5, "goroutine leak")
+	assert.LessOrEqual(t, heap, baseHeap*2+4<<20, "heap growth")
+
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGTERM))
+	select {
+	case err := <-runErr:
+		assert.NoError(t, err)
+	case <-time.After(15 * time.Second):
+		t.Fatal("bot did not shut down")
+	}
+
+	// after shutdown nothing the bot started may still be running
+	slackServer.Close()
+	gptServer.Close()
+	http.DefaultClient.CloseIdleConnections()
+	leakcheck.Verify(t, before)
+}
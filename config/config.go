@@ -2,19 +2,443 @@
 package configs
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 	"golang.org/x/exp/slices"
+	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"time"
 )
 
-// Config stores the configurations required for the app
+// Config stores the configurations required for the app, its struct tags are the schema
+// enforced by LoadConfig (see schema.go)
 type Config struct {
-	ChatGPTKey    string `mapstructure:"CGPT_API_KEY"`
-	SlackAppToken string `mapstructure:"SLACK_APP_TOKEN"`
-	SlackBotToken string `mapstructure:"SLACK_BOT_TOKEN"`
+	ChatGPTKey string `mapstructure:"CGPT_API_KEY" required:"true" desc:"chat-gpt API key" hint:"create one at https://platform.openai.com/api-keys"`
+	// SlackAppToken connects with socket mode, it is not needed when slack's requests are served over HTTP.
+	// Which of the two is required depends on the mode, see CheckMode.
+	SlackAppToken string `mapstructure:"SLACK_APP_TOKEN" prefix:"xapp-" desc:"slack app token" hint:"app-level token from Basic Information > App-Level Tokens"`
+	SlackBotToken string `mapstructure:"SLACK_BOT_TOKEN" required:"true" prefix:"xoxb-" desc:"slack bot token" hint:"bot user OAuth token from OAuth & Permissions"`
+	// SlackSigningSecret verifies the requests slack sends to HTTPAddr when they are served over HTTP
+	SlackSigningSecret string `mapstructure:"SLACK_SIGNING_SECRET"`
+	HTTPAddr           string `mapstructure:"HTTP_ADDR" default:":3000"`
+	// SlackClientID and SlackClientSecret let the app be installed in more workspaces through OAuth in http
+	// mode, asking for SlackOAuthScopes and coming back to SlackOAuthRedirectURL. The workspaces' bot tokens
+	// are kept in InstallationsFile, in memory when empty.
+	SlackClientID         string   `mapstructure:"SLACK_CLIENT_ID"`
+	SlackClientSecret     string   `mapstructure:"SLACK_CLIENT_SECRET"`
+	SlackOAuthScopes      []string `mapstructure:"SLACK_OAUTH_SCOPES"`
+	SlackOAuthRedirectURL string   `mapstructure:"SLACK_OAUTH_REDIRECT_URL"`
+	InstallationsFile     string   `mapstructure:"INSTALLATIONS_FILE"`
+	// Bots are more slack apps served by the same process, each answering as its own persona with the same
+	// provider and stores. In the environment they are a JSON array.
+	Bots []Bot `mapstructure:"BOTS"`
+	// ChatGPTBaseURL and SlackAPIURL override the default API endpoints, e.g. for a proxy or a fake server
+	ChatGPTBaseURL string `mapstructure:"CGPT_BASE_URL"`
+	SlackAPIURL    string `mapstructure:"SLACK_API_URL"`
+	// ChatProvider is the LLM backend answering questions with ChatGPTKey, at ChatGPTBaseURL when set.
+	// ChatModel replaces the provider's default model.
+	ChatProvider string `mapstructure:"CGPT_PROVIDER" default:"openai" oneof:"openai azure anthropic ollama" desc:"chat provider"`
+	ChatModel    string `mapstructure:"CGPT_MODEL"`
+	// ChatAPIType AZURE or AZURE_AD talks to Azure OpenAI at ChatGPTBaseURL, authenticating with an API key
+	// or an Entra ID token as ChatGPTKey, using AzureDeployment for ChatModel
+	ChatAPIType     string `mapstructure:"CGPT_API_TYPE" oneof:"OPEN_AI AZURE AZURE_AD" desc:"chat API type"`
+	ChatAPIVersion  string `mapstructure:"CGPT_API_VERSION"`
+	AzureDeployment string `mapstructure:"CGPT_AZURE_DEPLOYMENT"`
+	// ChatMaxRetries is how many times requests the provider rate limits or fails with a server error are retried,
+	// with jittered exponential backoff or as long as its rate limit headers say, but no longer than ChatMaxRetryWait
+	ChatMaxRetries   int           `mapstructure:"CGPT_MAX_RETRIES" default:"3" min:"0" desc:"chat max retries"`
+	ChatMaxRetryWait time.Duration `mapstructure:"CGPT_MAX_RETRY_WAIT" default:"30s" min:"0" desc:"chat max retry wait"`
+	// MaintenanceWindows are planned outages of the chat provider, e.g. 2024-06-01T22:00:00Z/2024-06-02T02:00:00Z,
+	// during which FallbackProvider answers with FallbackKey, at FallbackBaseURL when set, and FallbackModel. When
+	// it is unset questions are queued until the outage is over.
+	MaintenanceWindows []string `mapstructure:"MAINTENANCE_WINDOWS" desc:"maintenance windows"`
+	FallbackProvider   string   `mapstructure:"FALLBACK_PROVIDER" oneof:"openai azure anthropic ollama" desc:"fallback provider"`
+	FallbackKey        string   `mapstructure:"FALLBACK_API_KEY"`
+	FallbackBaseURL    string   `mapstructure:"FALLBACK_BASE_URL"`
+	FallbackModel      string   `mapstructure:"FALLBACK_MODEL"`
+	// CacheMaxConversations and CacheMaxBytes bound the in-memory conversation history
+	CacheMaxConversations int   `mapstructure:"CACHE_MAX_CONVERSATIONS" default:"10000" min:"0" desc:"cache max conversations" hint:"0 disables the bound"`
+	CacheMaxBytes         int64 `mapstructure:"CACHE_MAX_BYTES" default:"67108864" min:"0" desc:"cache max bytes" hint:"0 disables the bound"`
+	// ConversationStore keeps conversations in Redis at RedisURL or in the SQLite database SQLiteFile besides
+	// memory, so they survive restarts. They expire ConversationTTL after they last changed, 0 keeps them.
+	ConversationStore string        `mapstructure:"CONVERSATION_STORE" default:"memory" oneof:"memory redis sqlite" desc:"conversation store"`
+	RedisURL          string        `mapstructure:"REDIS_URL"`
+	SQLiteFile        string        `mapstructure:"SQLITE_FILE" default:"slackgpt.db"`
+	ConversationTTL   time.Duration `mapstructure:"CONVERSATION_TTL" default:"168h" min:"0" desc:"conversation ttl" hint:"0 keeps conversations until they are cleared"`
+	// DedupStore remembers the events handled for DedupTTL, in memory or in Redis at RedisURL so that instances
+	// sharing it skip the events another handled, and the events slack delivers again are skipped
+	DedupStore string        `mapstructure:"DEDUP_STORE" default:"memory" oneof:"memory redis" desc:"dedup store"`
+	DedupTTL   time.Duration `mapstructure:"DEDUP_TTL" default:"1h" min:"1m" desc:"dedup ttl"`
+	// CacheStatsInterval is how often cache size, hit rate and evictions are logged, 0 disables it
+	CacheStatsInterval time.Duration `mapstructure:"CACHE_STATS_INTERVAL" default:"5m" min:"0" desc:"cache stats interval" hint:"0 disables cache stats logging"`
+	// QuestionEditAction is what happens to the bot's answer when a question is edited
+	QuestionEditAction string `mapstructure:"QUESTION_EDIT_ACTION" default:"update" oneof:"ignore update reply" desc:"question edit action"`
+	// QuestionEditWindow is how long after a question is asked edits to it are answered again, 0 for any time
+	QuestionEditWindow time.Duration `mapstructure:"QUESTION_EDIT_WINDOW" default:"24h" min:"0" desc:"question edit window" hint:"0 answers edits however late"`
+	// DeleteRepliesWithQuestion deletes the bot's answer when the question it answers is deleted
+	DeleteRepliesWithQuestion bool `mapstructure:"DELETE_REPLIES_WITH_QUESTION" default:"true"`
+	// IgnoredUsers are never answered, e.g. integrations that post as regular users
+	IgnoredUsers []string `mapstructure:"IGNORED_USERS"`
+	// AllowedChannels are the only channels questions are answered in, besides direct messages, when set.
+	// RequiredUserGroup only answers the members of the user group.
+	AllowedChannels   []string `mapstructure:"ALLOWED_CHANNELS"`
+	RequiredUserGroup string   `mapstructure:"REQUIRED_USER_GROUP" prefix:"S" desc:"required user group" hint:"a user group ID, e.g. S0123ABCD"`
+	// NoRetentionChannels are channels nothing of the exchanges in is kept, only counted
+	NoRetentionChannels []string `mapstructure:"NO_RETENTION_CHANNELS"`
+	// SharedChannelPolicy answers questions in Slack Connect channels without SharedChannelTools and
+	// SharedChannelGrounding unless enabled, below a disclosure, the built in one when empty
+	SharedChannelPolicy     bool   `mapstructure:"SHARED_CHANNEL_POLICY" default:"false"`
+	SharedChannelTools      bool   `mapstructure:"SHARED_CHANNEL_TOOLS" default:"false"`
+	SharedChannelGrounding  bool   `mapstructure:"SHARED_CHANNEL_GROUNDING" default:"false"`
+	SharedChannelDisclosure string `mapstructure:"SHARED_CHANNEL_DISCLOSURE"`
+	// AllowBotMessages answers other bots, at most BotLoopLimit times in a row per conversation
+	AllowBotMessages bool `mapstructure:"ALLOW_BOT_MESSAGES" default:"false"`
+	BotLoopLimit     int  `mapstructure:"BOT_LOOP_LIMIT" default:"3" min:"1" desc:"bot loop limit"`
+	// MentionMode is how user mentions become prompt text, resolve needs the users:read scope
+	MentionMode string `mapstructure:"MENTION_MODE" default:"strip" oneof:"strip resolve" desc:"mention mode"`
+	// ExpandEmoji replaces emoji shortcodes such as :smile: with the emoji in prompts
+	ExpandEmoji bool `mapstructure:"EXPAND_EMOJI" default:"true"`
+	// RequireConsent asks users to agree to the onboarding message before their first question is answered.
+	// Consents are kept in ConsentFile, or in memory when it is empty.
+	RequireConsent bool   `mapstructure:"REQUIRE_CONSENT" default:"false"`
+	ConsentFile    string `mapstructure:"CONSENT_FILE"`
+	ConsentText    string `mapstructure:"CONSENT_TEXT"`
+	// UsagePolicy has to be acknowledged before questions are answered, again after PolicyAckInterval and
+	// whenever it changes. Acknowledgements are kept in PolicyAckFile, or in memory when it is empty.
+	UsagePolicy       string        `mapstructure:"USAGE_POLICY"`
+	PolicyAckInterval time.Duration `mapstructure:"POLICY_ACK_INTERVAL" default:"2160h"`
+	PolicyAckFile     string        `mapstructure:"POLICY_ACK_FILE"`
+	// HedgeAction asks the model to rate its confidence and caveats or refuses answers rated below
+	// ConfidenceThreshold in HedgeChannels, or everywhere when empty, pointing users to HumanChannel
+	HedgeAction         string   `mapstructure:"HEDGE_ACTION" default:"off" oneof:"off caveat refuse" desc:"hedge action"`
+	ConfidenceThreshold int      `mapstructure:"CONFIDENCE_THRESHOLD" default:"60" min:"0" max:"100" desc:"confidence threshold"`
+	HedgeChannels       []string `mapstructure:"HEDGE_CHANNELS"`
+	HumanChannel        string   `mapstructure:"HUMAN_CHANNEL"`
+	// EscalationGroup is the user group tagged when a user asks for a human, in EscalationChannel when set
+	EscalationGroup   string `mapstructure:"ESCALATION_GROUP"`
+	EscalationChannel string `mapstructure:"ESCALATION_CHANNEL"`
+	// DeflectionChannels are support channels where new questions are answered from the KnowledgeBase, a
+	// file or directory of .md and .txt files, before the support team is pinged
+	DeflectionChannels []string `mapstructure:"DEFLECTION_CHANNELS"`
+	KnowledgeBase      string   `mapstructure:"KNOWLEDGE_BASE"`
+	// SystemPrompt sets the bot's persona and language, ChannelSystemPrompts override it by channel ID. In the
+	// environment ChannelSystemPrompts is a JSON object.
+	SystemPrompt         string            `mapstructure:"SYSTEM_PROMPT"`
+	ChannelSystemPrompts map[string]string `mapstructure:"CHANNEL_SYSTEM_PROMPTS"`
+	// Channels override the model, temperature, answer length and system prompt by channel ID, falling back to
+	// the global defaults for what they leave unset. In the environment Channels is a JSON object.
+	Channels map[string]ChannelConfig `mapstructure:"CHANNELS"`
+	// TitleThreads generates a short title for every thread the bot answers in, costing one extra
+	// completion per thread
+	TitleThreads bool `mapstructure:"TITLE_THREADS" default:"false"`
+	// PromptHistoryFile keeps every version of the system prompts, AdminUsers may change and roll them back
+	PromptHistoryFile string   `mapstructure:"PROMPT_HISTORY_FILE"`
+	AdminUsers        []string `mapstructure:"ADMIN_USERS"`
+	// BranchVariants are offered on answers to try the question again with a different persona or model. In
+	// the environment they are a JSON array.
+	BranchVariants []BranchVariant `mapstructure:"BRANCH_VARIANTS"`
+	// FAQFile keeps the FAQs AdminUsers register, new questions at least FAQThreshold similar to one are
+	// answered with its answer, comparing embeddings made with EmbeddingModel
+	FAQFile        string  `mapstructure:"FAQ_FILE"`
+	FAQThreshold   float64 `mapstructure:"FAQ_THRESHOLD" default:"0.9"`
+	EmbeddingModel string  `mapstructure:"EMBEDDING_MODEL"`
+	// Feedback adds thumbs up and down buttons to answers, the ratings kept in FeedbackFile, in memory when empty
+	Feedback     bool   `mapstructure:"FEEDBACK" default:"false"`
+	FeedbackFile string `mapstructure:"FEEDBACK_FILE"`
+	// QualitySampleRate is the share of answers, from 0 to 1, QualityJudgeModel scores on accuracy, tone and
+	// policy compliance for the metrics, 0 scores none
+	QualitySampleRate float64 `mapstructure:"QUALITY_SAMPLE_RATE" default:"0" min:"0" max:"1" desc:"quality sample rate"`
+	QualityJudgeModel string  `mapstructure:"QUALITY_JUDGE_MODEL"`
+	// UsageFile keeps the tokens answers took and their cost at ModelPrices, in memory when empty. ModelPrices
+	// are added to the built in prices by model name; in the environment they are a JSON object.
+	UsageFile   string                `mapstructure:"USAGE_FILE"`
+	ModelPrices map[string]ModelPrice `mapstructure:"MODEL_PRICES"`
+	// MonthlyTokenBudget and MonthlyCostBudget, in US dollars, limit what answers take in a month, 0 does not
+	// limit. ChannelBudgets limit single channels; in the environment they are a JSON object. Once a budget is
+	// used up questions are declined and BudgetAlertChannel is told. TeamBudgets limit the members of user
+	// groups together, also a JSON object.
+	MonthlyTokenBudget int                   `mapstructure:"MONTHLY_TOKEN_BUDGET" default:"0" min:"0" desc:"monthly token budget"`
+	MonthlyCostBudget  float64               `mapstructure:"MONTHLY_COST_BUDGET" default:"0"`
+	ChannelBudgets     map[string]Budget     `mapstructure:"CHANNEL_BUDGETS"`
+	TeamBudgets        map[string]TeamBudget `mapstructure:"TEAM_BUDGETS"`
+	BudgetAlertChannel string                `mapstructure:"BUDGET_ALERT_CHANNEL"`
+	// AdminChannel is told about model outages, authentication failures and repeated rate limits
+	AdminChannel string `mapstructure:"ADMIN_CHANNEL"`
+	// LoadStatusChannels get a status message the bot keeps up to date with how loaded it is, every
+	// LoadStatusInterval: idle, busy handling LoadBusyThreshold events or more, or paused for maintenance or
+	// shutdown. LoadStatusPresence also sets the bot away while it is paused.
+	LoadStatusChannels []string      `mapstructure:"LOAD_STATUS_CHANNELS"`
+	LoadStatusPresence bool          `mapstructure:"LOAD_STATUS_PRESENCE" default:"false"`
+	LoadBusyThreshold  int           `mapstructure:"LOAD_BUSY_THRESHOLD" default:"5" min:"1" desc:"load busy threshold"`
+	LoadStatusInterval time.Duration `mapstructure:"LOAD_STATUS_INTERVAL" default:"30s" min:"1s" desc:"load status interval"`
+	// BookmarkChannels ground answers in the web pages they bookmark, fetched again after BookmarkRefresh
+	BookmarkChannels []string      `mapstructure:"BOOKMARK_CHANNELS"`
+	BookmarkRefresh  time.Duration `mapstructure:"BOOKMARK_REFRESH" default:"1h" min:"1m" desc:"bookmark refresh"`
+	// DirectoryLookup lets the model look people and teams up in the workspace, Owners says who owns what by
+	// topic. In the environment Owners is a JSON object.
+	DirectoryLookup bool              `mapstructure:"DIRECTORY_LOOKUP" default:"false"`
+	Owners          map[string]string `mapstructure:"OWNERS"`
+	// Tools are the built-in tools the model may call while answering: current_time, calculate and slack_user
+	Tools []string `mapstructure:"TOOLS" oneof:"current_time calculate slack_user" desc:"tools"`
+	// CommandAliases are other names for the keywords questions start with, such as help or faq list, and the
+	// subcommands of slash commands, by the name they stand for. In the environment they are a JSON object.
+	CommandAliases map[string]string `mapstructure:"COMMAND_ALIASES"`
+	// MaxContextTokens is how many tokens a conversation and its answer may take up, the oldest messages of
+	// longer conversations are left out. 0 is the context window of the model.
+	MaxContextTokens int `mapstructure:"MAX_CONTEXT_TOKENS" default:"0" min:"0" desc:"max context tokens"`
+	// Clarify asks what ambiguous questions mean before answering them
+	Clarify bool `mapstructure:"CLARIFY" default:"false"`
+	// ThinkingPlaceholder posts ThinkingMessage as soon as a question is to be answered, replaced by the answer
+	ThinkingPlaceholder bool   `mapstructure:"THINKING_PLACEHOLDER" default:"false"`
+	ThinkingMessage     string `mapstructure:"THINKING_MESSAGE" default:":hourglass_flowing_sand: thinking…"`
+	// TriggerReaction, an emoji name such as robot_face, asks about any message it is added to
+	TriggerReaction string `mapstructure:"TRIGGER_REACTION"`
+	// BlockKit renders answers with Block Kit, in mrkdwn converted from markdown, rather than in a code block
+	BlockKit bool `mapstructure:"BLOCK_KIT" default:"false"`
+	// AnswerButtons adds regenerate, continue and delete buttons to answers
+	AnswerButtons bool `mapstructure:"ANSWER_BUTTONS" default:"false"`
+	// Images lets users draw pictures with ImageModel in ImageSize, the image API's defaults when empty
+	Images     bool   `mapstructure:"IMAGES" default:"false"`
+	ImageModel string `mapstructure:"IMAGE_MODEL"`
+	ImageSize  string `mapstructure:"IMAGE_SIZE"`
+	// Vision has VisionModel look at the images attached to questions
+	Vision      bool   `mapstructure:"VISION" default:"false"`
+	VisionModel string `mapstructure:"VISION_MODEL"`
+	// Transcribe lets users transcribe clips with TranscriptionModel, the transcription API's default when empty
+	Transcribe         bool   `mapstructure:"TRANSCRIBE" default:"false"`
+	TranscriptionModel string `mapstructure:"TRANSCRIPTION_MODEL"`
+	// Forms are filled in with the model's help through modals. In the environment they are a JSON array.
+	Forms []Form `mapstructure:"FORMS"`
+	// ApprovalChannels only get answers once they are approved in ApprovalReviewChannel, or by their asker when
+	// it is empty
+	ApprovalChannels      []string `mapstructure:"APPROVAL_CHANNELS"`
+	ApprovalReviewChannel string   `mapstructure:"APPROVAL_REVIEW_CHANNEL"`
+	// Scheduling lets users draft posts and schedule them through the bot, kept in ScheduleFile or in memory when
+	// it is empty
+	Scheduling   bool   `mapstructure:"SCHEDULING" default:"false"`
+	ScheduleFile string `mapstructure:"SCHEDULE_FILE"`
+	// ActionItems tracks the action items of the summaries the bot posts by channel, kept in ActionItemsFile or in
+	// memory when it is empty
+	ActionItems     bool   `mapstructure:"ACTION_ITEMS" default:"false"`
+	ActionItemsFile string `mapstructure:"ACTION_ITEMS_FILE"`
+	// AppHome publishes an App Home tab where users change how they are answered, their settings kept in
+	// UserSettingsFile or in memory when it is empty
+	AppHome          bool   `mapstructure:"APP_HOME" default:"false"`
+	UserSettingsFile string `mapstructure:"USER_SETTINGS_FILE"`
+	// UserRateLimit and ChannelRateLimit are how many questions a user and a channel may ask per
+	// RateLimitWindow, 0 disables a limit
+	UserRateLimit    int           `mapstructure:"USER_RATE_LIMIT" default:"0" min:"0" desc:"user rate limit"`
+	ChannelRateLimit int           `mapstructure:"CHANNEL_RATE_LIMIT" default:"0" min:"0" desc:"channel rate limit"`
+	RateLimitWindow  time.Duration `mapstructure:"RATE_LIMIT_WINDOW" default:"1h" min:"1s" desc:"rate limit window"`
+	// Moderation checks questions with the moderation endpoint before answering them, refusing those flagged in
+	// ModerationBlock, every category not in ModerationWarn when unset, and warning about those in ModerationWarn
+	Moderation      bool     `mapstructure:"MODERATION" default:"false"`
+	ModerationBlock []string `mapstructure:"MODERATION_BLOCK" oneof:"hate hate/threatening self-harm sexual sexual/minors violence violence/graphic" desc:"moderation block categories"`
+	ModerationWarn  []string `mapstructure:"MODERATION_WARN" oneof:"hate hate/threatening self-harm sexual sexual/minors violence violence/graphic" desc:"moderation warn categories"`
+	// ModelRoutes pick the model questions are answered with by their task, chat, code or document, or also
+	// smalltalk or tools with TriageModel, and the size of their prompt, the first matching route wins. In the environment they are a JSON array.
+	ModelRoutes []ModelRoute `mapstructure:"MODEL_ROUTES"`
+	// TriageModel, a small and cheap model, classifies questions as smalltalk, code, document, tools or chat to
+	// pick their route and what they are answered with, they are not triaged when empty
+	TriageModel string `mapstructure:"TRIAGE_MODEL"`
+	// OverrideTiers let their users change the model, temperature and answer length of a single question with
+	// inline parameters. In the environment they are a JSON array.
+	OverrideTiers []OverrideTier `mapstructure:"OVERRIDE_TIERS"`
+	// ModelAllowlist are the models AdminUsers may switch a channel to with /gpt-model, kept in the conversation
+	// store when there is one
+	ModelAllowlist []string `mapstructure:"MODEL_ALLOWLIST"`
+	// LowPriorityChannels are channels whose questions are queued and answered in batches during the
+	// OffPeakWindows, e.g. 22:00-06:00 in the bot's time zone, or at any time when there are none. Either also
+	// lets questions be queued with /gpt --later. The queue is kept in BatchQueueFile, in memory when empty.
+	LowPriorityChannels []string `mapstructure:"LOW_PRIORITY_CHANNELS"`
+	OffPeakWindows      []string `mapstructure:"OFF_PEAK_WINDOWS" pattern:"^([01][0-9]|2[0-3]):[0-5][0-9]-([01][0-9]|2[0-3]):[0-5][0-9]$" desc:"off-peak windows" hint:"22:00-06:00"`
+	BatchQueueFile      string   `mapstructure:"BATCH_QUEUE_FILE"`
+	// DrainTimeout is how long questions being answered at shutdown may take to finish before they are cancelled
+	DrainTimeout time.Duration `mapstructure:"DRAIN_TIMEOUT" default:"30s" min:"0" desc:"drain timeout"`
+	// MaxConcurrentRequests bounds the questions answered by the model at once, 0 does not, with up to
+	// RequestQueueSize more waiting and the rest told the bot is busy
+	MaxConcurrentRequests int `mapstructure:"MAX_CONCURRENT_REQUESTS" default:"8" min:"0" desc:"max concurrent requests"`
+	RequestQueueSize      int `mapstructure:"REQUEST_QUEUE_SIZE" default:"50" min:"0" desc:"request queue size"`
+	// MetricsAddr is the address Prometheus metrics are served on at /metrics, e.g. :9090, empty disables them
+	MetricsAddr string `mapstructure:"METRICS_ADDR"`
+	// APIAddr is the address other services embed text at /api/v1/embed on, e.g. :8081, empty disables it.
+	// APIKeys are their keys by caller, each limited to UserRateLimit requests per RateLimitWindow. In the
+	// environment APIKeys is a JSON object.
+	APIAddr string            `mapstructure:"API_ADDR"`
+	APIKeys map[string]string `mapstructure:"API_KEYS"`
+	// WebhookSecret signs the payloads delivered to webhooks, the filled in forms and the results of API requests
+	// with a callback_url, so their receivers can verify them. Failed deliveries are retried WebhookRetries times,
+	// waiting WebhookRetryDelay doubled on every retry, then appended to WebhookDeadLetterFile when it is set.
+	WebhookSecret         string        `mapstructure:"WEBHOOK_SECRET"`
+	WebhookRetries        int           `mapstructure:"WEBHOOK_RETRIES" default:"5" min:"0" desc:"webhook retries"`
+	WebhookRetryDelay     time.Duration `mapstructure:"WEBHOOK_RETRY_DELAY" default:"1s" min:"1ms" desc:"webhook retry delay"`
+	WebhookDeadLetterFile string        `mapstructure:"WEBHOOK_DEAD_LETTER_FILE"`
+	// TracingEndpoint is the OTLP/HTTP collector the OpenTelemetry traces of the events, from their receipt through
+	// the model's requests to the replies posted, are exported to, e.g. http://localhost:4318, empty disables
+	// them. TracingHeaders are sent with every export, e.g. the collector's API key, in the environment they are a
+	// JSON object. TracingSampleRatio is the share of events traced, between 0 and 1.
+	TracingEndpoint    string            `mapstructure:"TRACING_ENDPOINT"`
+	TracingHeaders     map[string]string `mapstructure:"TRACING_HEADERS"`
+	TracingServiceName string            `mapstructure:"TRACING_SERVICE_NAME" default:"slackgpt"`
+	TracingSampleRatio float64           `mapstructure:"TRACING_SAMPLE_RATIO" default:"1" min:"0" max:"1" desc:"tracing sample ratio"`
+	// DiagDir is where SIGUSR1 diagnostic dumps are written, when empty they are logged instead
+	DiagDir string `mapstructure:"DIAG_DIR"`
+}
+
+// The modes the bot receives slack's events in
+const (
+	// ModeSocket connects to slack with socket mode using SlackAppToken
+	ModeSocket = "socket"
+	// ModeHTTP serves slack's requests at HTTPAddr, verifying them with SlackSigningSecret
+	ModeHTTP = "http"
+)
+
+// CheckMode reports whether config has what receiving events in mode, ModeSocket when empty, needs as a
+// ValidationError
+func (c Config) CheckMode(mode string) error {
+	var problems ValidationError
+	switch mode {
+	case ModeSocket, "":
+		if c.SlackAppToken == "" {
+			problems = append(problems, FieldError{Path: "SLACK_APP_TOKEN", Message: "missing slack app token", Suggestion: "app-level token from Basic Information > App-Level Tokens, or run with --mode=http"})
+		}
+	case ModeHTTP:
+		switch {
+		case c.SlackSigningSecret == "":
+			problems = append(problems, FieldError{Path: "SLACK_SIGNING_SECRET", Message: "missing slack signing secret", Suggestion: "signing secret from Basic Information > App Credentials"})
+		case c.SlackClientID != "" && c.SlackClientSecret == "":
+			problems = append(problems, FieldError{Path: "SLACK_CLIENT_SECRET", Message: "missing slack client secret", Suggestion: "client secret from Basic Information > App Credentials"})
+		case c.SlackClientID != "" && c.SlackOAuthRedirectURL == "":
+			problems = append(problems, FieldError{Path: "SLACK_OAUTH_REDIRECT_URL", Message: "missing slack oauth redirect url", Suggestion: "https URL of /slack/oauth/callback, as added to OAuth & Permissions > Redirect URLs"})
+		}
+	default:
+		return fmt.Errorf("mode must be %s or %s, got %q", ModeSocket, ModeHTTP, mode)
+	}
+	problems = append(problems, c.checkBots(mode)...)
+	if len(problems) == 0 {
+		return nil
+	}
+	return problems
+}
+
+// checkBots returns what the Bots are missing to receive events in mode
+func (c Config) checkBots(mode string) ValidationError {
+	var problems ValidationError
+	names := map[string]bool{}
+	addrs := map[string]bool{c.HTTPAddr: true}
+	for i, bot := range c.Bots {
+		path := fmt.Sprintf("BOTS[%d].", i)
+		switch {
+		case bot.Name == "":
+			problems = append(problems, FieldError{Path: path + "name", Message: "missing bot name", Suggestion: "a name telling the bot apart in the logs, e.g. docs"})
+		case names[bot.Name]:
+			problems = append(problems, FieldError{Path: path + "name", Message: fmt.Sprintf("bot name %q is used twice", bot.Name)})
+		}
+		names[bot.Name] = true
+		if !strings.HasPrefix(bot.SlackBotToken, "xoxb-") {
+			problems = append(problems, FieldError{Path: path + "slack_bot_token", Message: "missing slack bot token", Suggestion: "bot user OAuth token from OAuth & Permissions of the bot's app"})
+		}
+		if mode == ModeHTTP {
+			if bot.SlackSigningSecret == "" {
+				problems = append(problems, FieldError{Path: path + "slack_signing_secret", Message: "missing slack signing secret", Suggestion: "signing secret from Basic Information > App Credentials of the bot's app"})
+			}
+			if bot.HTTPAddr == "" || addrs[bot.HTTPAddr] {
+				problems = append(problems, FieldError{Path: path + "http_addr", Message: "missing an http address of its own", Suggestion: "an address no other bot serves, e.g. :3001"})
+			}
+			addrs[bot.HTTPAddr] = true
+		} else if !strings.HasPrefix(bot.SlackAppToken, "xapp-") {
+			problems = append(problems, FieldError{Path: path + "slack_app_token", Message: "missing slack app token", Suggestion: "app-level token from Basic Information > App-Level Tokens of the bot's app"})
+		}
+	}
+	return problems
+}
+
+// Bot is another slack app the process serves, answering as SystemPrompt when set. SlackAppToken connects it in
+// socket mode, SlackSigningSecret verifies its requests at HTTPAddr in http mode.
+type Bot struct {
+	Name               string `mapstructure:"name" json:"name"`
+	SlackAppToken      string `mapstructure:"slack_app_token" json:"slack_app_token"`
+	SlackBotToken      string `mapstructure:"slack_bot_token" json:"slack_bot_token"`
+	SlackSigningSecret string `mapstructure:"slack_signing_secret" json:"slack_signing_secret"`
+	HTTPAddr           string `mapstructure:"http_addr" json:"http_addr"`
+	SystemPrompt       string `mapstructure:"system_prompt" json:"system_prompt"`
+}
+
+// BranchVariant is a way of answering a question again, its SystemPrompt and Model replace the defaults when set
+type BranchVariant struct {
+	Name         string `mapstructure:"name" json:"name"`
+	SystemPrompt string `mapstructure:"system_prompt" json:"system_prompt"`
+	Model        string `mapstructure:"model" json:"model"`
+}
+
+// Form is a structured task the model helps fill in, posted to Channel and sent to Webhook when they are set
+type Form struct {
+	Name        string      `mapstructure:"name" json:"name"`
+	Description string      `mapstructure:"description" json:"description"`
+	Fields      []FormField `mapstructure:"fields" json:"fields"`
+	Channel     string      `mapstructure:"channel" json:"channel"`
+	Webhook     string      `mapstructure:"webhook" json:"webhook"`
+}
+
+// FormField is a field of a Form, Description tells the model what goes in it
+type FormField struct {
+	Name        string `mapstructure:"name" json:"name"`
+	Label       string `mapstructure:"label" json:"label"`
+	Description string `mapstructure:"description" json:"description"`
+	Multiline   bool   `mapstructure:"multiline" json:"multiline"`
+}
+
+// ModelPrice is what a model costs in US dollars per million prompt and completion tokens
+type ModelPrice struct {
+	Prompt     float64 `mapstructure:"prompt" json:"prompt"`
+	Completion float64 `mapstructure:"completion" json:"completion"`
+}
+
+// Budget is how many tokens and US dollars answers may take in a month, 0 does not limit either
+type Budget struct {
+	Tokens int     `mapstructure:"tokens" json:"tokens"`
+	Cost   float64 `mapstructure:"cost" json:"cost"`
+}
+
+// TeamBudget is what the members of a user group may spend together in a month. Leads are DMed once the team
+// used Warn of it, e.g. 0.8, and once it is used up.
+type TeamBudget struct {
+	Tokens int      `mapstructure:"tokens" json:"tokens"`
+	Cost   float64  `mapstructure:"cost" json:"cost"`
+	Warn   float64  `mapstructure:"warn" json:"warn"`
+	Leads  []string `mapstructure:"leads" json:"leads"`
+}
+
+// ChannelConfig is how questions in a channel are answered, unset fields keep the global defaults.
+// SystemPrompt takes precedence over the channel's CHANNEL_SYSTEM_PROMPTS.
+type ChannelConfig struct {
+	Model        string   `mapstructure:"model" json:"model"`
+	Temperature  *float32 `mapstructure:"temperature" json:"temperature"`
+	MaxTokens    int      `mapstructure:"max_tokens" json:"max_tokens"`
+	SystemPrompt string   `mapstructure:"system_prompt" json:"system_prompt"`
+}
+
+// ModelRoute answers the questions of Task, any task when empty, whose prompt takes up at most
+// MaxPromptTokens, any size when 0, with Model
+type ModelRoute struct {
+	Name            string `mapstructure:"name" json:"name"`
+	Task            string `mapstructure:"task" json:"task"`
+	MaxPromptTokens int    `mapstructure:"max_prompt_tokens" json:"max_prompt_tokens"`
+	Model           string `mapstructure:"model" json:"model"`
+}
+
+// OverrideTier is what Users, everyone in no other tier when empty, may change about the answer to a question
+type OverrideTier struct {
+	Name           string   `mapstructure:"name" json:"name"`
+	Users          []string `mapstructure:"users" json:"users"`
+	Models         []string `mapstructure:"models" json:"models"`
+	MaxTemperature float32  `mapstructure:"max_temperature" json:"max_temperature"`
+	MaxTokens      int      `mapstructure:"max_tokens" json:"max_tokens"`
 }
 
 // configParts provide a convenience object for parsing input config
@@ -57,36 +481,103 @@ func ParseConfigFromPath(cfg, cfgType string) (configParts, error) {
 	return cfgParts, nil
 }
 
-// LoadConfig reads configuration from config
-func LoadConfig(cfgParts configParts) (config Config, err error) {
-	viper.AddConfigPath(cfgParts.AbsPath)
-	viper.SetConfigName(cfgParts.Name)
-	viper.SetConfigType(cfgParts.Type)
-	if err = viper.ReadInConfig(); err != nil {
-		return
+// DefaultPaths returns the locations searched, in order, for a config file when none is passed
+func DefaultPaths() []string {
+	paths := []string{"slackgpt.yaml"}
+	// UserConfigDir honours $XDG_CONFIG_HOME, falling back to ~/.config
+	if dir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, "slackgpt", "config.yaml"))
 	}
-	if err = viper.Unmarshal(&config); err != nil {
-		return
+	return append(paths, filepath.Join("/etc", "slackgpt", "config.yaml"))
+}
+
+// FindConfig returns the first of DefaultPaths that exists, or "" when there is none
+func FindConfig() string {
+	return findConfig(DefaultPaths())
+}
+
+func findConfig(paths []string) string {
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
 	}
-	if config.ChatGPTKey == "" {
-		err = errors.New("missing chat-gpt API key")
+	return ""
+}
+
+// LoadConfig reads configuration from config. Every schema violation is reported at once
+// as a ValidationError, alongside the partially loaded config.
+func LoadConfig(cfgParts configParts) (config Config, err error) {
+	v := viper.New()
+	v.AddConfigPath(cfgParts.AbsPath)
+	v.SetConfigName(cfgParts.Name)
+	v.SetConfigType(cfgParts.Type)
+	if err = v.ReadInConfig(); err != nil {
 		return
 	}
-	if config.SlackAppToken == "" {
-		err = errors.New("missing slack app token")
-		return
+	return decode(v, v.AllKeys())
+}
+
+// LoadConfigFromEnv reads configuration from environment variables named after the config keys,
+// e.g. CGPT_API_KEY, so the bot can run without a config file
+func LoadConfigFromEnv() (Config, error) {
+	var names []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		names = append(names, name)
 	}
-	if config.SlackBotToken == "" {
-		err = errors.New("missing slack bot token")
-		return
+	v := viper.New()
+	for _, f := range schema() {
+		if err := v.BindEnv(f.key); err != nil {
+			return Config{}, err
+		}
 	}
-	if !strings.HasPrefix(config.SlackAppToken, "xapp-") {
-		err = errors.New("slack app token should begin with xapp-")
-		return
+	return decode(v, names)
+}
+
+// decode applies defaults, unmarshals the configuration loaded into v and validates it.
+// setKeys are the keys present in the config source.
+func decode(v *viper.Viper, setKeys []string) (config Config, err error) {
+	for key, value := range defaults() {
+		v.SetDefault(key, value)
 	}
-	if !strings.HasPrefix(config.SlackBotToken, "xoxb-") {
-		err = errors.New("slack bot token should begin with xoxb-")
+	if err = v.Unmarshal(&config, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		jsonHook,
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+	))); err != nil {
 		return
 	}
+	// viper lowercases the keys of maps in config files, slack IDs are always uppercase
+	config.ChannelSystemPrompts = upperKeys(config.ChannelSystemPrompts)
+	config.Channels = upperKeys(config.Channels)
+	config.ChannelBudgets = upperKeys(config.ChannelBudgets)
+	config.TeamBudgets = upperKeys(config.TeamBudgets)
+	err = validate(config, setKeys)
 	return
 }
+
+// jsonHook decodes maps and lists of structs given as a JSON string, which is how they are set in the environment
+func jsonHook(from, to reflect.Type, data any) (any, error) {
+	s, ok := data.(string)
+	if !ok || (to.Kind() != reflect.Map && (to.Kind() != reflect.Slice || to.Elem().Kind() != reflect.Struct)) {
+		return data, nil
+	}
+	m := reflect.New(to)
+	if err := json.Unmarshal([]byte(s), m.Interface()); err != nil {
+		return nil, fmt.Errorf("decoding %q as JSON: %w", s, err)
+	}
+	return m.Elem().Interface(), nil
+}
+
+// upperKeys returns m with its keys in upper case
+func upperKeys[V any](m map[string]V) map[string]V {
+	if m == nil {
+		return nil
+	}
+	upper := make(map[string]V, len(m))
+	for k, v := range m {
+		upper[strings.ToUpper(k)] = v
+	}
+	return upper
+}
@@ -4,7 +4,11 @@ import (
 	"errors"
 	"github.com/magiconair/properties/assert"
 	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
+	"time"
 )
 
 func TestParseConfigFromPath(t *testing.T) {
@@ -122,22 +126,6 @@ func TestLoadConfig(t *testing.T) {
 				errors.New("missing chat-gpt API key"),
 			},
 		},
-		{
-			"no app token",
-			args{
-				configParts{
-					"./test_files",
-					"no_slack_app.json",
-					"json",
-				},
-			},
-			expectedResult{
-				Config{
-					ChatGPTKey: "test",
-				},
-				errors.New("missing slack app token"),
-			},
-		},
 		{
 			"no bot token",
 			args{
@@ -223,3 +211,489 @@ func TestLoadConfig(t *testing.T) {
 	}
 
 }
+
+func TestLoadConfigDefaults(t *testing.T) {
+	cfg, err := LoadConfig(configParts{"./test_files", "good.json", "json"})
+	require.NoError(t, err)
+	assert.Equal(t, cfg.CacheMaxConversations, 10000)
+	assert.Equal(t, cfg.CacheMaxBytes, int64(64<<20))
+	assert.Equal(t, cfg.CacheStatsInterval, 5*time.Minute)
+	assert.Equal(t, cfg.QuestionEditAction, "update")
+	assert.Equal(t, cfg.QuestionEditWindow, 24*time.Hour)
+	assert.Equal(t, cfg.DeleteRepliesWithQuestion, true)
+	assert.Equal(t, cfg.AllowBotMessages, false)
+	assert.Equal(t, cfg.BotLoopLimit, 3)
+	assert.Equal(t, cfg.MentionMode, "strip")
+	assert.Equal(t, cfg.ExpandEmoji, true)
+	assert.Equal(t, cfg.RequireConsent, false)
+	assert.Equal(t, cfg.PolicyAckInterval, 90*24*time.Hour)
+	assert.Equal(t, cfg.HedgeAction, "off")
+	assert.Equal(t, cfg.ConfidenceThreshold, 60)
+	assert.Equal(t, cfg.TitleThreads, false)
+	assert.Equal(t, cfg.ThinkingPlaceholder, false)
+	assert.Equal(t, cfg.ThinkingMessage, ":hourglass_flowing_sand: thinking…")
+	assert.Equal(t, cfg.BlockKit, false)
+	assert.Equal(t, cfg.AnswerButtons, false)
+	assert.Equal(t, cfg.Images, false)
+	assert.Equal(t, cfg.Feedback, false)
+	assert.Equal(t, cfg.SharedChannelPolicy, false)
+	assert.Equal(t, cfg.Scheduling, false)
+	assert.Equal(t, cfg.ActionItems, false)
+	assert.Equal(t, cfg.AppHome, false)
+	assert.Equal(t, cfg.SharedChannelTools, false)
+	assert.Equal(t, cfg.SharedChannelGrounding, false)
+	assert.Equal(t, cfg.ChatProvider, "openai")
+	assert.Equal(t, cfg.RateLimitWindow, time.Hour)
+	assert.Equal(t, cfg.FAQThreshold, 0.9)
+	assert.Equal(t, cfg.DrainTimeout, 30*time.Second)
+	assert.Equal(t, cfg.MaxConcurrentRequests, 8)
+	assert.Equal(t, cfg.RequestQueueSize, 50)
+	assert.Equal(t, cfg.TracingServiceName, "slackgpt")
+	assert.Equal(t, cfg.TracingSampleRatio, 1.0)
+	assert.Equal(t, cfg.LoadBusyThreshold, 5)
+	assert.Equal(t, cfg.LoadStatusInterval, 30*time.Second)
+	assert.Equal(t, cfg.WebhookRetries, 5)
+	assert.Equal(t, cfg.WebhookRetryDelay, time.Second)
+	assert.Equal(t, cfg.ChatMaxRetries, 3)
+	assert.Equal(t, cfg.ChatMaxRetryWait, 30*time.Second)
+	assert.Equal(t, cfg.BookmarkRefresh, time.Hour)
+	assert.Equal(t, cfg.ConversationStore, "memory")
+	assert.Equal(t, cfg.SQLiteFile, "slackgpt.db")
+	assert.Equal(t, cfg.ConversationTTL, 168*time.Hour)
+	assert.Equal(t, cfg.DedupStore, "memory")
+	assert.Equal(t, cfg.DedupTTL, time.Hour)
+	assert.Equal(t, cfg.QualitySampleRate, 0.0)
+	assert.Equal(t, cfg.HTTPAddr, ":3000")
+}
+
+func TestCheckMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		cfg     Config
+		wantErr string
+	}{
+		{"socket", ModeSocket, Config{SlackAppToken: "xapp-1"}, ""},
+		{"socket without app token", ModeSocket, Config{SlackSigningSecret: "secret"}, "invalid config: SLACK_APP_TOKEN: missing slack app token"},
+		{"http", ModeHTTP, Config{SlackSigningSecret: "secret"}, ""},
+		{"http without signing secret", ModeHTTP, Config{SlackAppToken: "xapp-1"}, "invalid config: SLACK_SIGNING_SECRET: missing slack signing secret"},
+		{"http with oauth", ModeHTTP, Config{SlackSigningSecret: "secret", SlackClientID: "1.2", SlackClientSecret: "client secret", SlackOAuthRedirectURL: "https://bot.example.com/slack/oauth/callback"}, ""},
+		{"oauth without client secret", ModeHTTP, Config{SlackSigningSecret: "secret", SlackClientID: "1.2", SlackOAuthRedirectURL: "https://bot.example.com/slack/oauth/callback"}, "invalid config: SLACK_CLIENT_SECRET: missing slack client secret"},
+		{"oauth without redirect url", ModeHTTP, Config{SlackSigningSecret: "secret", SlackClientID: "1.2", SlackClientSecret: "client secret"}, "invalid config: SLACK_OAUTH_REDIRECT_URL: missing slack oauth redirect url"},
+		{"unknown", "websocket", Config{SlackAppToken: "xapp-1"}, `mode must be socket or http, got "websocket"`},
+		{"socket bot", ModeSocket, Config{SlackAppToken: "xapp-1", Bots: []Bot{{Name: "docs", SlackAppToken: "xapp-2", SlackBotToken: "xoxb-2"}}}, ""},
+		{"socket bot without app token", ModeSocket, Config{SlackAppToken: "xapp-1", Bots: []Bot{{Name: "docs", SlackBotToken: "xoxb-2"}}}, "BOTS[0].slack_app_token: missing slack app token"},
+		{"bot without name", ModeSocket, Config{SlackAppToken: "xapp-1", Bots: []Bot{{SlackAppToken: "xapp-2", SlackBotToken: "xoxb-2"}}}, "BOTS[0].name: missing bot name"},
+		{"bots named alike", ModeSocket, Config{SlackAppToken: "xapp-1", Bots: []Bot{{Name: "docs", SlackAppToken: "xapp-2", SlackBotToken: "xoxb-2"}, {Name: "docs", SlackAppToken: "xapp-3", SlackBotToken: "xoxb-3"}}}, `BOTS[1].name: bot name "docs" is used twice`},
+		{"http bot", ModeHTTP, Config{SlackSigningSecret: "secret", HTTPAddr: ":3000", Bots: []Bot{{Name: "docs", SlackBotToken: "xoxb-2", SlackSigningSecret: "docs secret", HTTPAddr: ":3001"}}}, ""},
+		{"http bot on the main address", ModeHTTP, Config{SlackSigningSecret: "secret", HTTPAddr: ":3000", Bots: []Bot{{Name: "docs", SlackBotToken: "xoxb-2", SlackSigningSecret: "docs secret", HTTPAddr: ":3000"}}}, "BOTS[0].http_addr: missing an http address of its own"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.CheckMode(tt.mode)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestLoadConfigReportsEveryProblem(t *testing.T) {
+	_, err := LoadConfig(configParts{"./test_files", "many_problems.json", "json"})
+	var problems ValidationError
+	require.ErrorAs(t, err, &problems)
+
+	paths := make([]string, len(problems))
+	for i, p := range problems {
+		paths[i] = p.Path
+	}
+	assert.Equal(t, paths, []string{"CGPT_API_KEY", "SLACK_APP_TOKEN", "SLACK_BOT_TOKEN", "CACHE_MAX_BYTES"})
+	assert.Equal(t, problems[0].Suggestion, "did you mean CGPT_API_KEY instead of CGPT_APIKEY?")
+	assert.Equal(t, problems[1].Message, "slack app token should begin with xapp-")
+	assert.Equal(t, problems[3].Message, "cache max bytes must be at least 0")
+	require.ErrorContains(t, err, "invalid config, 4 problems")
+	require.ErrorContains(t, err, "missing slack bot token")
+}
+
+func TestLoadConfigRanges(t *testing.T) {
+	t.Setenv("CGPT_API_KEY", "test")
+	t.Setenv("SLACK_APP_TOKEN", "xapp-1")
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-1")
+	tests := []struct {
+		key, value, want string
+	}{
+		{"QUALITY_SAMPLE_RATE", "-1", "quality sample rate must be at least 0"},
+		{"QUALITY_SAMPLE_RATE", "1.5", "quality sample rate must be at most 1"},
+		{"TRACING_SAMPLE_RATIO", "2", "tracing sample ratio must be at most 1"},
+		{"CONFIDENCE_THRESHOLD", "101", "confidence threshold must be at most 100"},
+		{"CONFIDENCE_THRESHOLD", "-5", "confidence threshold must be at least 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key+"="+tt.value, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+			_, err := LoadConfigFromEnv()
+			var problems ValidationError
+			require.ErrorAs(t, err, &problems)
+			require.Len(t, problems, 1)
+			assert.Equal(t, problems[0].Path, tt.key)
+			assert.Equal(t, problems[0].Message, tt.want)
+		})
+	}
+	t.Setenv("QUALITY_SAMPLE_RATE", "0.25")
+	t.Setenv("CONFIDENCE_THRESHOLD", "100")
+	_, err := LoadConfigFromEnv()
+	require.NoError(t, err)
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"KEY", "", 3},
+		{"CGPT_API_KEY", "CGPT_APIKEY", 1},
+		{"SLACK_BOT_TOKEN", "SLACK_APP_TOKEN", 3},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, editDistance(tt.a, tt.b), tt.want)
+	}
+}
+
+func TestFindConfig(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing.yaml")
+	found := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(found, []byte("CGPT_API_KEY: test\n"), 0o600))
+
+	assert.Equal(t, findConfig([]string{missing, dir, found}), found)
+	assert.Equal(t, findConfig([]string{missing}), "")
+}
+
+func TestDefaultPaths(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		t.Skip("XDG_CONFIG_HOME is only honoured on unix")
+	}
+	t.Setenv("XDG_CONFIG_HOME", "/xdg")
+	assert.Equal(t, DefaultPaths(), []string{
+		"slackgpt.yaml",
+		filepath.Join("/xdg", "slackgpt", "config.yaml"),
+		filepath.Join("/etc", "slackgpt", "config.yaml"),
+	})
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	t.Setenv("CGPT_API_KEY", "test")
+	t.Setenv("SLACK_APP_TOKEN", "xapp-1")
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-1")
+	t.Setenv("CACHE_STATS_INTERVAL", "1m")
+	t.Setenv("IGNORED_USERS", "U1,U2")
+	t.Setenv("NO_RETENTION_CHANNELS", "C0SECURITY")
+	cfg, err := LoadConfigFromEnv()
+	require.NoError(t, err)
+	t.Setenv("QUESTION_EDIT_ACTION", "regenerate")
+	_, err = LoadConfigFromEnv()
+	require.ErrorContains(t, err, `question edit action must be one of ignore, update, reply, got "regenerate"`)
+	assert.Equal(t, cfg.ChatGPTKey, "test")
+	assert.Equal(t, cfg.SlackAppToken, "xapp-1")
+	assert.Equal(t, cfg.SlackBotToken, "xoxb-1")
+	assert.Equal(t, cfg.CacheStatsInterval, time.Minute)
+	assert.Equal(t, cfg.CacheMaxConversations, 10000)
+	assert.Equal(t, cfg.IgnoredUsers, []string{"U1", "U2"})
+	assert.Equal(t, cfg.NoRetentionChannels, []string{"C0SECURITY"})
+
+	t.Setenv("QUESTION_EDIT_ACTION", "update")
+	t.Setenv("CHANNEL_SYSTEM_PROMPTS", `{"C1": "answer like a pirate, briefly"}`)
+	cfg, err = LoadConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, cfg.ChannelSystemPrompts, map[string]string{"C1": "answer like a pirate, briefly"})
+	t.Setenv("OWNERS", `{"billing service": "<@U1>"}`)
+	cfg, err = LoadConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, cfg.Owners, map[string]string{"billing service": "<@U1>"})
+	t.Setenv("COMMAND_ALIASES", `{"ヘルプ": "help", "一覧": "list"}`)
+	cfg, err = LoadConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, cfg.CommandAliases, map[string]string{"ヘルプ": "help", "一覧": "list"})
+	t.Setenv("CHANNEL_SYSTEM_PROMPTS", "C1=pirate")
+	_, err = LoadConfigFromEnv()
+	require.ErrorContains(t, err, "as JSON")
+}
+
+func TestLoadConfigChannelSystemPrompts(t *testing.T) {
+	cfg, err := LoadConfig(configParts{"./test_files", "channel_prompts.json", "json"})
+	require.NoError(t, err)
+	assert.Equal(t, cfg.SystemPrompt, "You are a helpful assistant. Answer in English.")
+	assert.Equal(t, cfg.ChannelSystemPrompts, map[string]string{"C0PIRATES": "Answer like a pirate."})
+}
+
+func TestLoadConfigChannels(t *testing.T) {
+	zero, light := float32(0), float32(0.9)
+	want := map[string]ChannelConfig{
+		"C0ENGINEERING": {Model: "gpt-4", Temperature: &zero, MaxTokens: 2000},
+		"C0RANDOM":      {Model: "gpt-3.5-turbo", Temperature: &light, SystemPrompt: "Keep it light."},
+	}
+	cfg, err := LoadConfig(configParts{"./test_files", "channels.yaml", "yaml"})
+	require.NoError(t, err)
+	assert.Equal(t, cfg.Channels, want)
+
+	t.Setenv("CGPT_API_KEY", "test")
+	t.Setenv("SLACK_APP_TOKEN", "xapp-1")
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-1")
+	t.Setenv("CHANNELS", `{"C0ENGINEERING": {"model": "gpt-4", "temperature": 0, "max_tokens": 2000},`+
+		` "C0RANDOM": {"model": "gpt-3.5-turbo", "temperature": 0.9, "system_prompt": "Keep it light."}}`)
+	cfg, err = LoadConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, cfg.Channels, want)
+}
+
+func TestLoadConfigAccess(t *testing.T) {
+	t.Setenv("CGPT_API_KEY", "test")
+	t.Setenv("SLACK_APP_TOKEN", "xapp-1")
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-1")
+	t.Setenv("ALLOWED_CHANNELS", "C0HELP,C0ENGINEERING")
+	t.Setenv("REQUIRED_USER_GROUP", "S0STAFF")
+	cfg, err := LoadConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, cfg.AllowedChannels, []string{"C0HELP", "C0ENGINEERING"})
+	assert.Equal(t, cfg.RequiredUserGroup, "S0STAFF")
+
+	t.Setenv("REQUIRED_USER_GROUP", "staff")
+	_, err = LoadConfigFromEnv()
+	require.ErrorContains(t, err, "required user group should begin with S")
+}
+
+func TestLoadConfigApprovals(t *testing.T) {
+	t.Setenv("CGPT_API_KEY", "test")
+	t.Setenv("SLACK_APP_TOKEN", "xapp-1")
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-1")
+	t.Setenv("APPROVAL_CHANNELS", "C0ANNOUNCE,C0GENERAL")
+	t.Setenv("APPROVAL_REVIEW_CHANNEL", "C0COMMS")
+	cfg, err := LoadConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, cfg.ApprovalChannels, []string{"C0ANNOUNCE", "C0GENERAL"})
+	assert.Equal(t, cfg.ApprovalReviewChannel, "C0COMMS")
+}
+
+func TestLoadConfigModelPrices(t *testing.T) {
+	t.Setenv("CGPT_API_KEY", "test")
+	t.Setenv("SLACK_APP_TOKEN", "xapp-1")
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-1")
+	t.Setenv("USAGE_FILE", "usage.json")
+	t.Setenv("MODEL_PRICES", `{"llama3": {"prompt": 0.2, "completion": 0.2}, "gpt-4o": {"prompt": 2, "completion": 8}}`)
+	cfg, err := LoadConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, cfg.UsageFile, "usage.json")
+	assert.Equal(t, cfg.ModelPrices, map[string]ModelPrice{
+		"llama3": {Prompt: 0.2, Completion: 0.2},
+		"gpt-4o": {Prompt: 2, Completion: 8},
+	})
+}
+
+func TestLoadConfigBudgets(t *testing.T) {
+	t.Setenv("CGPT_API_KEY", "test")
+	t.Setenv("SLACK_APP_TOKEN", "xapp-1")
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-1")
+	t.Setenv("MONTHLY_TOKEN_BUDGET", "50000000")
+	t.Setenv("MONTHLY_COST_BUDGET", "250.50")
+	t.Setenv("CHANNEL_BUDGETS", `{"c0random": {"cost": 10}}`)
+	t.Setenv("TEAM_BUDGETS", `{"s0support": {"cost": 100, "warn": 0.8, "leads": ["U0LEAD"]}}`)
+	t.Setenv("BUDGET_ALERT_CHANNEL", "C0ADMINS")
+	t.Setenv("ADMIN_CHANNEL", "C0OPS")
+	cfg, err := LoadConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, cfg.MonthlyTokenBudget, 50000000)
+	assert.Equal(t, cfg.MonthlyCostBudget, 250.50)
+	assert.Equal(t, cfg.ChannelBudgets, map[string]Budget{"C0RANDOM": {Cost: 10}})
+	assert.Equal(t, cfg.TeamBudgets, map[string]TeamBudget{"S0SUPPORT": {Cost: 100, Warn: 0.8, Leads: []string{"U0LEAD"}}})
+	assert.Equal(t, cfg.BudgetAlertChannel, "C0ADMINS")
+	assert.Equal(t, cfg.AdminChannel, "C0OPS")
+
+	t.Setenv("MONTHLY_TOKEN_BUDGET", "-1")
+	_, err = LoadConfigFromEnv()
+	require.ErrorContains(t, err, "monthly token budget must be at least 0")
+}
+
+func TestLoadConfigBranchVariants(t *testing.T) {
+	want := []BranchVariant{
+		{Name: "More detail", SystemPrompt: "Answer thoroughly, with examples."},
+		{Name: "Ask GPT-4o", Model: "gpt-4o"},
+	}
+	cfg, err := LoadConfig(configParts{"./test_files", "branch_variants.yaml", "yaml"})
+	require.NoError(t, err)
+	assert.Equal(t, cfg.BranchVariants, want)
+
+	t.Setenv("CGPT_API_KEY", "test")
+	t.Setenv("SLACK_APP_TOKEN", "xapp-1")
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-1")
+	t.Setenv("BRANCH_VARIANTS", `[{"name": "More detail", "system_prompt": "Answer thoroughly, with examples."}, {"name": "Ask GPT-4o", "model": "gpt-4o"}]`)
+	cfg, err = LoadConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, cfg.BranchVariants, want)
+}
+
+func TestLoadConfigForms(t *testing.T) {
+	want := []Form{{
+		Name:        "bug report",
+		Description: "a bug in our web app",
+		Channel:     "C0BUGS",
+		Webhook:     "https://tracker.example.com/hooks/bugs",
+		Fields: []FormField{
+			{Name: "summary", Label: "Summary"},
+			{Name: "steps", Label: "Steps to reproduce", Description: "what the user did before the bug happened", Multiline: true},
+		},
+	}}
+	cfg, err := LoadConfig(configParts{"./test_files", "forms.yaml", "yaml"})
+	require.NoError(t, err)
+	assert.Equal(t, cfg.Forms, want)
+
+	t.Setenv("CGPT_API_KEY", "test")
+	t.Setenv("SLACK_APP_TOKEN", "xapp-1")
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-1")
+	t.Setenv("FORMS", `[{"name": "bug report", "description": "a bug in our web app", "channel": "C0BUGS",`+
+		` "webhook": "https://tracker.example.com/hooks/bugs", "fields": [{"name": "summary", "label": "Summary"},`+
+		` {"name": "steps", "label": "Steps to reproduce", "description": "what the user did before the bug happened", "multiline": true}]}]`)
+	cfg, err = LoadConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, cfg.Forms, want)
+}
+
+func TestLoadConfigBots(t *testing.T) {
+	t.Setenv("CGPT_API_KEY", "test")
+	t.Setenv("SLACK_APP_TOKEN", "xapp-1")
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-1")
+	t.Setenv("BOTS", `[{"name": "docs", "slack_app_token": "xapp-2", "slack_bot_token": "xoxb-2", "system_prompt": "You are DocsBot."},`+
+		` {"name": "oncall", "slack_app_token": "xapp-3", "slack_bot_token": "xoxb-3"}]`)
+	cfg, err := LoadConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, []Bot{
+		{Name: "docs", SlackAppToken: "xapp-2", SlackBotToken: "xoxb-2", SystemPrompt: "You are DocsBot."},
+		{Name: "oncall", SlackAppToken: "xapp-3", SlackBotToken: "xoxb-3"},
+	}, cfg.Bots)
+	require.NoError(t, cfg.CheckMode(ModeSocket))
+	require.ErrorContains(t, cfg.CheckMode(ModeHTTP), "invalid config, 5 problems")
+}
+
+func TestLoadConfigOverrideTiers(t *testing.T) {
+	want := []OverrideTier{
+		{Name: "power", Users: []string{"U0POWER"}, Models: []string{"gpt-4o", "gpt-3.5-turbo"}, MaxTemperature: 2, MaxTokens: 4000},
+		{Name: "standard", Models: []string{"gpt-3.5-turbo"}, MaxTemperature: 1},
+	}
+	cfg, err := LoadConfig(configParts{"./test_files", "override_tiers.yaml", "yaml"})
+	require.NoError(t, err)
+	assert.Equal(t, cfg.OverrideTiers, want)
+
+	t.Setenv("CGPT_API_KEY", "test")
+	t.Setenv("SLACK_APP_TOKEN", "xapp-1")
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-1")
+	t.Setenv("OVERRIDE_TIERS", `[{"name": "power", "users": ["U0POWER"], "models": ["gpt-4o", "gpt-3.5-turbo"], "max_temperature": 2, "max_tokens": 4000},`+
+		` {"name": "standard", "models": ["gpt-3.5-turbo"], "max_temperature": 1}]`)
+	cfg, err = LoadConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, cfg.OverrideTiers, want)
+}
+
+func TestLoadConfigModelAllowlist(t *testing.T) {
+	t.Setenv("CGPT_API_KEY", "test")
+	t.Setenv("SLACK_APP_TOKEN", "xapp-1")
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-1")
+	t.Setenv("MODEL_ALLOWLIST", "gpt-4o,gpt-4o-mini")
+	cfg, err := LoadConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, cfg.ModelAllowlist, []string{"gpt-4o", "gpt-4o-mini"})
+}
+
+func TestLoadConfigTools(t *testing.T) {
+	t.Setenv("CGPT_API_KEY", "test")
+	t.Setenv("SLACK_APP_TOKEN", "xapp-1")
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-1")
+	t.Setenv("TOOLS", "current_time,calculate,slack_user")
+	cfg, err := LoadConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, cfg.Tools, []string{"current_time", "calculate", "slack_user"})
+
+	t.Setenv("TOOLS", "current_time,calculator")
+	_, err = LoadConfigFromEnv()
+	require.ErrorContains(t, err, `TOOLS: tools must each be one of current_time, calculate, slack_user, got "calculator"`)
+}
+
+func TestLoadConfigModelRoutes(t *testing.T) {
+	t.Setenv("CGPT_API_KEY", "test")
+	t.Setenv("SLACK_APP_TOKEN", "xapp-1")
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-1")
+	t.Setenv("MODEL_ROUTES", `[{"name": "short chat", "task": "chat", "max_prompt_tokens": 1000, "model": "gpt-3.5-turbo"},`+
+		` {"name": "long", "model": "gpt-4-turbo"}]`)
+	cfg, err := LoadConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, cfg.ModelRoutes, []ModelRoute{
+		{Name: "short chat", Task: "chat", MaxPromptTokens: 1000, Model: "gpt-3.5-turbo"},
+		{Name: "long", Model: "gpt-4-turbo"},
+	})
+}
+
+func TestLoadConfigModeration(t *testing.T) {
+	t.Setenv("CGPT_API_KEY", "test")
+	t.Setenv("SLACK_APP_TOKEN", "xapp-1")
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-1")
+	t.Setenv("MODERATION", "true")
+	t.Setenv("MODERATION_WARN", "violence,hate")
+	cfg, err := LoadConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, cfg.Moderation, true)
+	assert.Equal(t, cfg.ModerationWarn, []string{"violence", "hate"})
+	assert.Equal(t, len(cfg.ModerationBlock), 0)
+
+	t.Setenv("MODERATION_BLOCK", "violence,spam")
+	_, err = LoadConfigFromEnv()
+	require.ErrorContains(t, err, `MODERATION_BLOCK: moderation block categories must each be one of hate, hate/threatening, self-harm, sexual, sexual/minors, violence, violence/graphic, got "spam"`)
+}
+
+func TestLoadConfigLowPriority(t *testing.T) {
+	t.Setenv("CGPT_API_KEY", "test")
+	t.Setenv("SLACK_APP_TOKEN", "xapp-1")
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-1")
+	t.Setenv("LOW_PRIORITY_CHANNELS", "C0RANDOM")
+	t.Setenv("OFF_PEAK_WINDOWS", "22:00-06:00,12:00-13:30")
+	t.Setenv("BATCH_QUEUE_FILE", "queue.json")
+	cfg, err := LoadConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, cfg.LowPriorityChannels, []string{"C0RANDOM"})
+	assert.Equal(t, cfg.OffPeakWindows, []string{"22:00-06:00", "12:00-13:30"})
+	assert.Equal(t, cfg.BatchQueueFile, "queue.json")
+
+	t.Setenv("OFF_PEAK_WINDOWS", "22:00-06:00,night")
+	_, err = LoadConfigFromEnv()
+	require.ErrorContains(t, err, `OFF_PEAK_WINDOWS: off-peak windows must look like 22:00-06:00, got "night"`)
+}
+
+func TestLoadConfigAPI(t *testing.T) {
+	t.Setenv("CGPT_API_KEY", "test")
+	t.Setenv("SLACK_APP_TOKEN", "xapp-1")
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-1")
+	t.Setenv("API_ADDR", ":8081")
+	t.Setenv("API_KEYS", `{"wiki-search": "s3cret"}`)
+	cfg, err := LoadConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, cfg.APIAddr, ":8081")
+	assert.Equal(t, cfg.APIKeys, map[string]string{"wiki-search": "s3cret"})
+}
+
+func TestLoadConfigMaintenance(t *testing.T) {
+	t.Setenv("CGPT_API_KEY", "test")
+	t.Setenv("SLACK_APP_TOKEN", "xapp-1")
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-1")
+	t.Setenv("MAINTENANCE_WINDOWS", "2024-06-01T22:00:00Z/2024-06-02T02:00:00Z,2024-07-01T22:00:00Z/2024-07-02T02:00:00Z")
+	t.Setenv("FALLBACK_PROVIDER", "anthropic")
+	t.Setenv("FALLBACK_API_KEY", "sk-ant-test")
+	cfg, err := LoadConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, cfg.MaintenanceWindows, []string{"2024-06-01T22:00:00Z/2024-06-02T02:00:00Z", "2024-07-01T22:00:00Z/2024-07-02T02:00:00Z"})
+	assert.Equal(t, cfg.FallbackProvider, "anthropic")
+	assert.Equal(t, cfg.FallbackKey, "sk-ant-test")
+
+	t.Setenv("FALLBACK_PROVIDER", "bard")
+	_, err = LoadConfigFromEnv()
+	require.ErrorContains(t, err, "fallback provider must be one of")
+}
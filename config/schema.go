@@ -0,0 +1,228 @@
+package configs
+
+import (
+	"cmp"
+	"fmt"
+	"golang.org/x/exp/slices"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The Config schema is declared with struct tags next to each mapstructure key:
+//
+//	default:"..."   value used when the key is not set
+//	required:"true" the key must be set to a non-zero value
+//	prefix:"..."    a set string value must begin with prefix
+//	min:"..."       a numeric or duration value must be at least min
+//	max:"..."       a numeric or duration value must be at most max
+//	oneof:"a b"     a set string value, or every string of a list, must be one of the space separated values
+//	pattern:"..."   a set string value, or every string of a list, must match the regular expression
+//	desc:"..."      human name used in error messages
+//	hint:"..."      suggestion shown alongside any error for the key
+
+// FieldError is a problem with a single configuration key
+type FieldError struct {
+	// Path is the configuration key, e.g. SLACK_APP_TOKEN
+	Path       string
+	Message    string
+	Suggestion string
+}
+
+func (e FieldError) Error() string {
+	if e.Suggestion == "" {
+		return fmt.Sprintf("%s: %s", e.Path, e.Message)
+	}
+	return fmt.Sprintf("%s: %s (%s)", e.Path, e.Message, e.Suggestion)
+}
+
+// ValidationError lists every problem found in a configuration
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	problems := make([]string, len(e))
+	for i, fe := range e {
+		problems[i] = fe.Error()
+	}
+	if len(e) == 1 {
+		return "invalid config: " + problems[0]
+	}
+	return fmt.Sprintf("invalid config, %d problems:\n  %s", len(e), strings.Join(problems, "\n  "))
+}
+
+// schemaField is one Config field and the struct tags describing it
+type schemaField struct {
+	index int
+	key   string
+	tag   reflect.StructTag
+}
+
+// schema returns every field of Config that is read from configuration
+func schema() []schemaField {
+	t := reflect.TypeOf(Config{})
+	fields := make([]schemaField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if key := f.Tag.Get("mapstructure"); key != "" {
+			fields = append(fields, schemaField{index: i, key: key, tag: f.Tag})
+		}
+	}
+	return fields
+}
+
+// defaults returns the default value of every key that has one
+func defaults() map[string]string {
+	result := make(map[string]string)
+	for _, f := range schema() {
+		if def, ok := f.tag.Lookup("default"); ok {
+			result[f.key] = def
+		}
+	}
+	return result
+}
+
+// validate checks config against the schema and returns every problem found, or nil.
+// setKeys are the keys present in the config source, used to suggest fixes for misspelt keys.
+func validate(config Config, setKeys []string) error {
+	var problems ValidationError
+	v := reflect.ValueOf(config)
+	for _, f := range schema() {
+		if message := checkField(f, v.Field(f.index)); message != "" {
+			suggestion := f.tag.Get("hint")
+			if v.Field(f.index).IsZero() {
+				if similar := similarKey(f.key, setKeys); similar != "" {
+					suggestion = fmt.Sprintf("did you mean %s instead of %s?", f.key, similar)
+				}
+			}
+			problems = append(problems, FieldError{Path: f.key, Message: message, Suggestion: suggestion})
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return problems
+}
+
+// checkField returns a description of the first rule value breaks, or "" when it is valid
+func checkField(f schemaField, value reflect.Value) string {
+	desc := f.tag.Get("desc")
+	if desc == "" {
+		desc = f.key
+	}
+	if f.tag.Get("required") == "true" && value.IsZero() {
+		return "missing " + desc
+	}
+	if prefix := f.tag.Get("prefix"); prefix != "" && value.Kind() == reflect.String {
+		if s := value.String(); s != "" && !strings.HasPrefix(s, prefix) {
+			return fmt.Sprintf("%s should begin with %s", desc, prefix)
+		}
+	}
+	if oneof := f.tag.Get("oneof"); oneof != "" && value.Kind() == reflect.String {
+		allowed := strings.Fields(oneof)
+		if s := value.String(); s != "" && !slices.Contains(allowed, s) {
+			return fmt.Sprintf("%s must be one of %s, got %q", desc, strings.Join(allowed, ", "), s)
+		}
+	}
+	if oneof := f.tag.Get("oneof"); oneof != "" && value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.String {
+		allowed := strings.Fields(oneof)
+		for i := 0; i < value.Len(); i++ {
+			if s := value.Index(i).String(); !slices.Contains(allowed, s) {
+				return fmt.Sprintf("%s must each be one of %s, got %q", desc, strings.Join(allowed, ", "), s)
+			}
+		}
+	}
+	if pattern := f.tag.Get("pattern"); pattern != "" {
+		re := regexp.MustCompile(pattern)
+		values := []reflect.Value{value}
+		if value.Kind() == reflect.Slice {
+			values = values[:0]
+			for i := 0; i < value.Len(); i++ {
+				values = append(values, value.Index(i))
+			}
+		}
+		for _, v := range values {
+			if s := v.String(); v.Kind() == reflect.String && s != "" && !re.MatchString(s) {
+				return fmt.Sprintf("%s must look like %s, got %q", desc, f.tag.Get("hint"), s)
+			}
+		}
+	}
+	if lowest := f.tag.Get("min"); lowest != "" && compareBound(value, lowest) < 0 {
+		return fmt.Sprintf("%s must be at least %s", desc, lowest)
+	}
+	if highest := f.tag.Get("max"); highest != "" && compareBound(value, highest) > 0 {
+		return fmt.Sprintf("%s must be at most %s", desc, highest)
+	}
+	return ""
+}
+
+// compareBound compares a numeric or duration value with a min or max tag, returning -1, 0 or 1 as value is
+// below, at or above bound. Values of other kinds are within any bound.
+func compareBound(value reflect.Value, bound string) int {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cmp.Compare(value.Int(), parseIntBound(value.Type(), bound))
+	case reflect.Float32, reflect.Float64:
+		limit, err := strconv.ParseFloat(bound, 64)
+		if err != nil {
+			panic(fmt.Sprintf("config schema: invalid bound tag %q", bound))
+		}
+		return cmp.Compare(value.Float(), limit)
+	}
+	return 0
+}
+
+// parseIntBound parses a min or max tag for an integer field of type t, a time.Duration accepts duration strings
+func parseIntBound(t reflect.Type, bound string) int64 {
+	if t == reflect.TypeOf(time.Duration(0)) {
+		if d, err := time.ParseDuration(bound); err == nil {
+			return int64(d)
+		}
+	}
+	limit, err := strconv.ParseInt(bound, 10, 64)
+	if err != nil {
+		panic(fmt.Sprintf("config schema: invalid bound tag %q", bound))
+	}
+	return limit
+}
+
+// similarKey returns the key in setKeys closest to key when it is close enough to be a typo of it
+func similarKey(key string, setKeys []string) string {
+	known := make(map[string]bool)
+	for _, f := range schema() {
+		known[f.key] = true
+	}
+	best, bestDistance := "", 3
+	for _, k := range setKeys {
+		k = strings.ToUpper(k)
+		if known[k] {
+			continue
+		}
+		if d := editDistance(key, k); d <= bestDistance {
+			best, bestDistance = k, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
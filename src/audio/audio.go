@@ -0,0 +1,85 @@
+// Package audio downloads the audio and video clips posted in slack and transcribes them with OpenAI's
+// transcription API
+package audio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"path"
+	"strings"
+)
+
+// DefaultModel transcribes clips when no model is requested
+const DefaultModel = openai.Whisper1
+
+// MaxBytes is the largest clip the transcription API accepts
+const MaxBytes = 25 << 20
+
+// ErrTooLarge is returned for clips larger than MaxBytes
+var ErrTooLarge = errors.New("clip too large to transcribe")
+
+// Transcriber transcribes audio, *openai.Client is one
+type Transcriber interface {
+	CreateTranscription(ctx context.Context, request openai.AudioRequest) (openai.AudioResponse, error)
+}
+
+// TranscriberOf returns the Transcriber behind provider, false for providers that cannot transcribe audio
+func TranscriberOf(provider chatgpt.ChatProvider) (Transcriber, bool) {
+	for {
+		if transcriber, ok := provider.(Transcriber); ok {
+			return transcriber, true
+		}
+		wrapper, ok := provider.(interface{ Unwrap() chatgpt.ChatProvider })
+		if !ok {
+			return nil, false
+		}
+		provider = wrapper.Unwrap()
+	}
+}
+
+// IsClip reports whether file is an audio or video clip, such as a slack voice or video message or a huddle
+// recording
+func IsClip(file slack.File) bool {
+	return strings.HasPrefix(file.Mimetype, "audio/") || strings.HasPrefix(file.Mimetype, "video/")
+}
+
+// Download downloads file with api, which needs the files:read scope
+func Download(ctx context.Context, api *slack.Client, file slack.File) ([]byte, error) {
+	if file.Size > MaxBytes {
+		return nil, ErrTooLarge
+	}
+	url := file.URLPrivateDownload
+	if url == "" {
+		url = file.URLPrivate
+	}
+	var clip bytes.Buffer
+	if err := api.GetFileContext(ctx, url, &clip); err != nil {
+		return nil, fmt.Errorf("downloading %s: %w", file.ID, err)
+	}
+	if clip.Len() > MaxBytes {
+		return nil, ErrTooLarge
+	}
+	return clip.Bytes(), nil
+}
+
+// Transcribe transcribes clip with model, DefaultModel when it is empty. The extension of name tells the API
+// the clip's format, e.g. audio_message.webm.
+func Transcribe(ctx context.Context, transcriber Transcriber, model, name string, clip []byte) (string, error) {
+	if model == "" {
+		model = DefaultModel
+	}
+	if path.Ext(name) == "" {
+		// slack's voice messages are webm, the API refuses clips without an extension
+		name += ".webm"
+	}
+	resp, err := transcriber.CreateTranscription(ctx, openai.AudioRequest{Model: model, FilePath: name, Reader: bytes.NewReader(clip)})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(resp.Text), nil
+}
@@ -0,0 +1,68 @@
+package audio
+
+import (
+	"context"
+	"errors"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"strings"
+	"testing"
+)
+
+// transcriber answers transcription requests with text, recording the names and contents of the clips
+type transcriber struct {
+	text  string
+	err   error
+	names []string
+	clips []string
+}
+
+func (t *transcriber) CreateTranscription(_ context.Context, req openai.AudioRequest) (openai.AudioResponse, error) {
+	clip, _ := io.ReadAll(req.Reader)
+	t.names, t.clips = append(t.names, req.FilePath), append(t.clips, string(clip))
+	return openai.AudioResponse{Text: t.text}, t.err
+}
+
+func TestTranscribe(t *testing.T) {
+	ctx := context.Background()
+	tr := &transcriber{text: " hello team \n"}
+	text, err := Transcribe(ctx, tr, "", "standup.m4a", []byte("clip"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello team", text)
+	assert.Equal(t, []string{"standup.m4a"}, tr.names)
+	assert.Equal(t, []string{"clip"}, tr.clips)
+
+	_, err = Transcribe(ctx, tr, "", "audio_message", []byte("clip"))
+	require.NoError(t, err)
+	assert.Equal(t, "audio_message.webm", tr.names[1], "clips without an extension are taken to be webm")
+
+	failed := errors.New("invalid file format")
+	_, err = Transcribe(ctx, &transcriber{err: failed}, "", "clip.ogg", nil)
+	assert.ErrorIs(t, err, failed)
+}
+
+func TestDownload(t *testing.T) {
+	slackServer := fake.NewSlack()
+	t.Cleanup(slackServer.Close)
+	api := slack.New("xoxb-test", slack.OptionAPIURL(slackServer.APIURL()))
+	msg := slackServer.AddMessage(fake.Message{Channel: "C1", User: "U1", Files: []fake.File{{Filename: "clip.webm", Mimetype: "audio/webm", Content: []byte("clip")}}})
+	url := strings.TrimSuffix(slackServer.APIURL(), "/api/") + "/files/" + msg.TS + "/0"
+
+	clip, err := Download(context.Background(), api, slack.File{ID: "F1", Mimetype: "audio/webm", URLPrivateDownload: url})
+	require.NoError(t, err)
+	assert.Equal(t, "clip", string(clip))
+	_, err = Download(context.Background(), api, slack.File{ID: "F2", Size: MaxBytes + 1, URLPrivateDownload: url})
+	assert.ErrorIs(t, err, ErrTooLarge)
+	_, err = Download(context.Background(), api, slack.File{ID: "F3", URLPrivateDownload: strings.TrimSuffix(url, "/0") + "/9"})
+	assert.Error(t, err)
+}
+
+func TestIsClip(t *testing.T) {
+	assert.True(t, IsClip(slack.File{Mimetype: "audio/webm"}))
+	assert.True(t, IsClip(slack.File{Mimetype: "video/mp4"}))
+	assert.False(t, IsClip(slack.File{Mimetype: "image/png"}))
+}
@@ -0,0 +1,197 @@
+// Package cache provides bounded in-memory caches that report their size, hit rate and evictions
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Stats is a point in time snapshot of a cache's size and effectiveness
+type Stats struct {
+	Name       string
+	Entries    int
+	Bytes      int64
+	MaxEntries int
+	MaxBytes   int64
+	Hits       uint64
+	Misses     uint64
+	Evictions  uint64
+}
+
+// HitRate returns the fraction of lookups that found an entry, or 0 if there were none
+func (s Stats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// Reporter is implemented by every cache that can report Stats
+type Reporter interface {
+	Stats() Stats
+}
+
+type entry[V any] struct {
+	key   string
+	value V
+	size  int64
+}
+
+// LRU is a concurrency safe least-recently-used cache bounded by entry count and approximate bytes.
+// A bound of 0 disables that bound.
+type LRU[V any] struct {
+	mu         sync.Mutex
+	name       string
+	maxEntries int
+	maxBytes   int64
+	sizeOf     func(key string, value V) int64
+	ll         *list.List
+	items      map[string]*list.Element
+	bytes      int64
+	hits       uint64
+	misses     uint64
+	evictions  uint64
+}
+
+// NewLRU creates an LRU cache. sizeOf estimates the memory used by an entry and may be nil
+// when the cache is only bounded by entry count.
+func NewLRU[V any](name string, maxEntries int, maxBytes int64, sizeOf func(key string, value V) int64) *LRU[V] {
+	if sizeOf == nil {
+		sizeOf = func(key string, _ V) int64 { return int64(len(key)) }
+	}
+	return &LRU[V]{
+		name:       name,
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		sizeOf:     sizeOf,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// Get returns the value stored under key and marks it as recently used
+func (c *LRU[V]) Get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.hits++
+		c.ll.MoveToFront(el)
+		return el.Value.(*entry[V]).value, true
+	}
+	c.misses++
+	var zero V
+	return zero, false
+}
+
+// Peek returns the value stored under key without marking it as recently used or counting a hit or miss
+func (c *LRU[V]) Peek(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		return el.Value.(*entry[V]).value, true
+	}
+	var zero V
+	return zero, false
+}
+
+// Set stores value under key, evicting the least recently used entries if a bound is exceeded
+func (c *LRU[V]) Set(key string, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(key, value)
+}
+
+// Update atomically replaces the value under key with the result of f, which receives the
+// current value and whether it exists
+func (c *LRU[V]) Update(key string, f func(value V, ok bool) V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var current V
+	el, ok := c.items[key]
+	if ok {
+		current = el.Value.(*entry[V]).value
+	}
+	c.set(key, f(current, ok))
+}
+
+// UpdateExisting atomically replaces the value under key with the result of f, reporting whether
+// key was present. Unlike Update, nothing is stored when key is missing.
+func (c *LRU[V]) UpdateExisting(key string, f func(value V) V) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return false
+	}
+	c.set(key, f(el.Value.(*entry[V]).value))
+	return true
+}
+
+func (c *LRU[V]) set(key string, value V) {
+	size := c.sizeOf(key, value)
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry[V])
+		c.bytes += size - e.size
+		e.value, e.size = value, size
+		c.ll.MoveToFront(el)
+	} else {
+		c.items[key] = c.ll.PushFront(&entry[V]{key: key, value: value, size: size})
+		c.bytes += size
+	}
+	// never evict the entry that was just written, even if it alone exceeds maxBytes
+	for c.ll.Len() > 1 && ((c.maxEntries > 0 && c.ll.Len() > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes)) {
+		c.removeElement(c.ll.Back())
+		c.evictions++
+	}
+}
+
+// Delete removes key from the cache, reporting whether it was present
+func (c *LRU[V]) Delete(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if ok {
+		c.removeElement(el)
+	}
+	return ok
+}
+
+func (c *LRU[V]) removeElement(el *list.Element) {
+	e := c.ll.Remove(el).(*entry[V])
+	delete(c.items, e.key)
+	c.bytes -= e.size
+}
+
+// Len returns the number of entries in the cache
+func (c *LRU[V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// Range calls f for every entry from least to most recently used without affecting recency.
+// f must not call back into the cache.
+func (c *LRU[V]) Range(f func(key string, value V)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for el := c.ll.Back(); el != nil; el = el.Prev() {
+		e := el.Value.(*entry[V])
+		f(e.key, e.value)
+	}
+}
+
+// Stats returns a snapshot of the cache's size and effectiveness
+func (c *LRU[V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Stats{
+		Name:       c.name,
+		Entries:    c.ll.Len(),
+		Bytes:      c.bytes,
+		MaxEntries: c.maxEntries,
+		MaxBytes:   c.maxBytes,
+		Hits:       c.hits,
+		Misses:     c.misses,
+		Evictions:  c.evictions,
+	}
+}
@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func TestLRU_GetSet(t *testing.T) {
+	c := NewLRU[int]("test", 0, 0, nil)
+	_, ok := c.Get("missing")
+	assert.False(t, ok)
+	c.Set("a", 1)
+	v, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+	c.Set("a", 2)
+	v, _ = c.Get("a")
+	assert.Equal(t, 2, v)
+	assert.Equal(t, 1, c.Len())
+
+	stats := c.Stats()
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.InDelta(t, 2.0/3.0, stats.HitRate(), 0.001)
+}
+
+func TestLRU_Peek(t *testing.T) {
+	c := NewLRU[int]("test", 2, 0, nil)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	v, ok := c.Peek("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+	_, ok = c.Peek("missing")
+	assert.False(t, ok)
+	c.Set("c", 3)
+	_, ok = c.Peek("a")
+	assert.False(t, ok, "peeking does not keep an entry from being evicted")
+	assert.Equal(t, Stats{Name: "test", Entries: 2, Bytes: 2, MaxEntries: 2, Evictions: 1}, c.Stats())
+}
+
+func TestLRU_EvictsByEntries(t *testing.T) {
+	c := NewLRU[int]("test", 2, 0, nil)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a")
+	c.Set("c", 3)
+	_, ok := c.Get("b")
+	assert.False(t, ok)
+	_, ok = c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), c.Stats().Evictions)
+}
+
+func TestLRU_EvictsByBytes(t *testing.T) {
+	sizeOf := func(key string, value string) int64 { return int64(len(key) + len(value)) }
+	c := NewLRU[string]("test", 0, 10, sizeOf)
+	c.Set("a", "1234")
+	c.Set("b", "1234")
+	assert.Equal(t, int64(10), c.Stats().Bytes)
+	c.Set("c", "1")
+	stats := c.Stats()
+	assert.Equal(t, 2, stats.Entries)
+	assert.Equal(t, int64(7), stats.Bytes)
+	// an entry larger than the bound is kept on its own rather than dropped
+	c.Set("d", "0123456789")
+	stats = c.Stats()
+	assert.Equal(t, 1, stats.Entries)
+	assert.Equal(t, uint64(3), stats.Evictions)
+}
+
+func TestLRU_UpdateAndDelete(t *testing.T) {
+	c := NewLRU[[]string]("test", 0, 0, nil)
+	appendValue := func(value []string, _ bool) []string { return append(value, "x") }
+	c.Update("a", appendValue)
+	c.Update("a", appendValue)
+	v, _ := c.Get("a")
+	assert.Equal(t, []string{"x", "x"}, v)
+	assert.True(t, c.Delete("a"))
+	assert.False(t, c.Delete("a"))
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestLRU_UpdateExisting(t *testing.T) {
+	c := NewLRU[int]("test", 0, 0, nil)
+	double := func(value int) int { return value * 2 }
+	assert.False(t, c.UpdateExisting("a", double))
+	assert.Equal(t, 0, c.Len())
+	c.Set("a", 2)
+	assert.True(t, c.UpdateExisting("a", double))
+	v, _ := c.Get("a")
+	assert.Equal(t, 4, v)
+}
+
+func TestLRU_RangeOldestFirst(t *testing.T) {
+	c := NewLRU[int]("test", 0, 0, nil)
+	for i := 0; i < 3; i++ {
+		c.Set(fmt.Sprint(i), i)
+	}
+	c.Get("0")
+	var keys []string
+	c.Range(func(key string, _ int) { keys = append(keys, key) })
+	assert.Equal(t, []string{"1", "2", "0"}, keys)
+}
+
+func TestLRU_Concurrent(t *testing.T) {
+	c := NewLRU[int]("test", 10, 0, nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c.Set(fmt.Sprint(i), i)
+			c.Get(fmt.Sprint(i - 1))
+			c.Update("shared", func(v int, _ bool) int { return v + 1 })
+		}(i)
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, c.Len(), 10)
+}
+
+func TestRegistry(t *testing.T) {
+	var nilRegistry *Registry
+	nilRegistry.Register(NewLRU[int]("ignored", 0, 0, nil))
+	assert.Nil(t, nilRegistry.Stats())
+
+	r := NewRegistry()
+	r.Register(NewLRU[int]("a", 1, 0, nil))
+	r.Register(NewLRU[int]("b", 2, 0, nil))
+	stats := r.Stats()
+	assert.Len(t, stats, 2)
+	assert.Equal(t, "a", stats[0].Name)
+	assert.Equal(t, 2, stats[1].MaxEntries)
+}
+
+func TestRegistryWithPrefix(t *testing.T) {
+	r := NewRegistry()
+	r.Register(NewLRU[int]("replies", 1, 0, nil))
+	docs := r.WithPrefix("docs/")
+	docs.Register(NewLRU[int]("replies", 2, 0, nil))
+
+	assert.Equal(t, []string{"replies"}, names(docs.Stats()))
+	assert.Equal(t, []string{"replies", "docs/replies"}, names(r.Stats()))
+	assert.Nil(t, (*Registry)(nil).WithPrefix("docs/"))
+}
+
+func names(stats []Stats) []string {
+	names := make([]string, len(stats))
+	for i, s := range stats {
+		names[i] = s.Name
+	}
+	return names
+}
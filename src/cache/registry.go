@@ -0,0 +1,66 @@
+package cache
+
+import "sync"
+
+// Registry collects caches so their stats can be reported together
+type Registry struct {
+	mu        sync.Mutex
+	reporters []Reporter
+	// parent also gets the caches registered, their names starting with prefix
+	parent *Registry
+	prefix string
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a cache to the registry. Registering on a nil registry is a no-op so
+// components can register unconditionally.
+func (r *Registry) Register(c Reporter) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.reporters = append(r.reporters, c)
+	r.mu.Unlock()
+	if r.parent != nil {
+		r.parent.Register(prefixed{c, r.prefix})
+	}
+}
+
+// WithPrefix returns a registry whose caches are also registered in r, their names starting with prefix, so
+// several components registering the same caches can be told apart
+func (r *Registry) WithPrefix(prefix string) *Registry {
+	if r == nil {
+		return nil
+	}
+	return &Registry{parent: r, prefix: prefix}
+}
+
+// prefixed reports the stats of a cache under a prefixed name
+type prefixed struct {
+	Reporter
+	prefix string
+}
+
+func (p prefixed) Stats() Stats {
+	stats := p.Reporter.Stats()
+	stats.Name = p.prefix + stats.Name
+	return stats
+}
+
+// Stats returns a snapshot of every registered cache
+func (r *Registry) Stats() []Stats {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := make([]Stats, 0, len(r.reporters))
+	for _, c := range r.reporters {
+		stats = append(stats, c.Stats())
+	}
+	return stats
+}
@@ -0,0 +1,51 @@
+package chatgpt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ActionItem is a task agreed on in a summarized thread or meeting, with who owns it and when it is due when
+// they were said
+type ActionItem struct {
+	Task  string `json:"task"`
+	Owner string `json:"owner"`
+	Due   string `json:"due"`
+}
+
+// actionItemsPrompt asks for the action items of a summary as a JSON object
+const actionItemsPrompt = "List the action items of the following summary of a thread or meeting. Reply with a JSON" +
+	" object only, of the form {\"items\": [{\"task\": <what to do>, \"owner\": <who does it, as written, or empty>," +
+	" \"due\": <when it is due, as written, or empty>}]}. Keep each task short and in the language of the summary," +
+	" and do not make up items, owners or dates. Reply with {\"items\": []} when there are none."
+
+// GetActionItems asks the model for the action items of summary. Items without a task are left out.
+func GetActionItems(client ChatProvider, ctx context.Context, summary string) ([]ActionItem, error) {
+	if strings.TrimSpace(summary) == "" {
+		return nil, ErrorEmptyPrompt
+	}
+	reply, err := complete(client, ctx, []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: actionItemsPrompt},
+		{Role: openai.ChatMessageRoleUser, Content: summary},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var list struct {
+		Items []ActionItem `json:"items"`
+	}
+	if !decodeJSONObject(reply, &list) {
+		return nil, fmt.Errorf("the model did not reply with action items: %q", reply)
+	}
+	var items []ActionItem
+	for _, item := range list.Items {
+		item.Task, item.Owner, item.Due = strings.TrimSpace(item.Task), strings.TrimSpace(item.Owner), strings.TrimSpace(item.Due)
+		if item.Task != "" {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
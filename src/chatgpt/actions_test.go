@@ -0,0 +1,34 @@
+package chatgpt
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetActionItems(t *testing.T) {
+	tests := []struct {
+		reply   string
+		want    []ActionItem
+		wantErr bool
+	}{
+		{"```json\n{\"items\": [{\"task\": \" Send the notes \", \"owner\": \"Ana\", \"due\": \"Friday\"}, {\"task\": \"\", \"owner\": \"Bo\"}," +
+			" {\"task\": \"Book a room\"}]}\n```",
+			[]ActionItem{{Task: "Send the notes", Owner: "Ana", Due: "Friday"}, {Task: "Book a room"}}, false},
+		{`{"items": []}`, nil, false},
+		{"There are no action items.", nil, true},
+	}
+	for _, tt := range tests {
+		items, err := GetActionItems(replier(tt.reply), context.Background(), "We agreed Ana sends the notes by Friday.")
+		if tt.wantErr {
+			assert.Error(t, err, tt.reply)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, items, tt.reply)
+	}
+	_, err := GetActionItems(replier("{}"), context.Background(), " ")
+	assert.ErrorIs(t, err, ErrorEmptyPrompt)
+}
@@ -0,0 +1,156 @@
+package chatgpt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	anthropicBaseURL = "https://api.anthropic.com/v1"
+	anthropicVersion = "2023-06-01"
+)
+
+// anthropic is a ChatProvider for Anthropic's messages API
+type anthropic struct {
+	apiKey  string
+	baseURL string
+	model   string
+	client  *http.Client
+}
+
+// newAnthropic creates an anthropic provider from cfg that sends requests with client
+func newAnthropic(cfg ProviderConfig, client *http.Client) *anthropic {
+	a := &anthropic{apiKey: cfg.APIKey, baseURL: cfg.BaseURL, model: cfg.Model, client: client}
+	if a.baseURL == "" {
+		a.baseURL = anthropicBaseURL
+	}
+	if a.model == "" {
+		a.model = DefaultAnthropicModel
+	}
+	return a
+}
+
+// Model returns the model requests are answered with unless they ask for another
+func (a *anthropic) Model() string {
+	return a.model
+}
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	System      string             `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+	MaxTokens   int                `json:"max_tokens"`
+	Temperature float32            `json:"temperature"`
+}
+
+type anthropicResponse struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StopReason string `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// CreateChatCompletion answers req with the messages API. System messages become the system prompt and
+// consecutive messages from the same role are merged, since the API expects the roles to alternate. Only the
+// text of messages with several content parts is sent.
+func (a *anthropic) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	body := anthropicRequest{Model: req.Model, MaxTokens: req.MaxTokens, Temperature: req.Temperature}
+	if body.MaxTokens == 0 {
+		body.MaxTokens = 1000
+	}
+	// OpenAI temperatures go up to 2, anthropic's to 1
+	if body.Temperature > 1 {
+		body.Temperature = 1
+	}
+	var system []string
+	for _, message := range req.Messages {
+		if message.Role == openai.ChatMessageRoleSystem {
+			system = append(system, messageText(message))
+			continue
+		}
+		role := openai.ChatMessageRoleUser
+		if message.Role == openai.ChatMessageRoleAssistant {
+			role = openai.ChatMessageRoleAssistant
+		}
+		if last := len(body.Messages) - 1; last >= 0 && body.Messages[last].Role == role {
+			body.Messages[last].Content += "\n\n" + messageText(message)
+			continue
+		}
+		body.Messages = append(body.Messages, anthropicMessage{Role: role, Content: messageText(message)})
+	}
+	body.System = strings.Join(system, "\n\n")
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, a.baseURL+"/messages", bytes.NewReader(payload))
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-api-key", a.apiKey)
+	httpReq.Header.Set("anthropic-version", anthropicVersion)
+	httpResp, err := a.client.Do(httpReq)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	defer httpResp.Body.Close()
+
+	var resp anthropicResponse
+	if err = json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return openai.ChatCompletionResponse{}, fmt.Errorf("anthropic: decoding %s response: %w", httpResp.Status, err)
+	}
+	if resp.Error != nil {
+		return openai.ChatCompletionResponse{}, fmt.Errorf("anthropic: %s: %s", resp.Error.Type, resp.Error.Message)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return openai.ChatCompletionResponse{}, fmt.Errorf("anthropic: %s", httpResp.Status)
+	}
+	var text strings.Builder
+	for _, block := range resp.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	finish := openai.FinishReasonStop
+	if resp.StopReason == "max_tokens" {
+		finish = openai.FinishReasonLength
+	}
+	return openai.ChatCompletionResponse{
+		ID:     resp.ID,
+		Object: "chat.completion",
+		Model:  resp.Model,
+		Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: text.String()},
+			FinishReason: finish,
+		}},
+		Usage: openai.Usage{
+			PromptTokens:     resp.Usage.InputTokens,
+			CompletionTokens: resp.Usage.OutputTokens,
+			TotalTokens:      resp.Usage.InputTokens + resp.Usage.OutputTokens,
+		},
+	}, nil
+}
@@ -0,0 +1,56 @@
+package chatgpt
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnthropic_CreateChatCompletion(t *testing.T) {
+	var got anthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/messages", r.URL.Path)
+		assert.Equal(t, "key", r.Header.Get("x-api-key"))
+		assert.Equal(t, anthropicVersion, r.Header.Get("anthropic-version"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		_, _ = w.Write([]byte(`{"id": "msg_1", "model": "claude-test", "content": [{"type": "text", "text": "  hello there "}],
+			"stop_reason": "end_turn", "usage": {"input_tokens": 12, "output_tokens": 3}}`))
+	}))
+	defer server.Close()
+
+	provider, err := NewProvider(ProviderConfig{Provider: ProviderAnthropic, APIKey: "key", BaseURL: server.URL + "/v1", Model: "claude-test"})
+	require.NoError(t, err)
+	answer, err := GetStringResponse(provider, context.Background(), []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "Be brief."},
+		{Role: openai.ChatMessageRoleUser, Name: "U1", Content: "hi"},
+		{Role: openai.ChatMessageRoleUser, Name: "U2", Content: "hello?"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "hello there", answer)
+	assert.Equal(t, anthropicRequest{
+		Model:       "claude-test",
+		System:      "Be brief.",
+		Messages:    []anthropicMessage{{Role: "user", Content: "hi\n\nhello?"}},
+		MaxTokens:   1000,
+		Temperature: 0.5,
+	}, got)
+}
+
+func TestAnthropic_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"type": "error", "error": {"type": "authentication_error", "message": "invalid x-api-key"}}`))
+	}))
+	defer server.Close()
+
+	provider, err := NewProvider(ProviderConfig{Provider: ProviderAnthropic, APIKey: "bad", BaseURL: server.URL})
+	require.NoError(t, err)
+	_, err = GetStringResponse(provider, context.Background(), []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}})
+	assert.EqualError(t, err, "anthropic: authentication_error: invalid x-api-key")
+}
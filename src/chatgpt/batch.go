@@ -0,0 +1,249 @@
+package chatgpt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	// batchEndpoint is the endpoint batched requests are answered by
+	batchEndpoint = "/v1/chat/completions"
+	// batchWindow is how long a batch may take, the only window the Batch API offers
+	batchWindow = "24h"
+)
+
+// BatchRequest is a chat completion request answered in a batch, told apart from the others by ID
+type BatchRequest struct {
+	ID      string                       `json:"id"`
+	Request openai.ChatCompletionRequest `json:"request"`
+}
+
+// BatchAnswer is the answer to the request of ID, or why it has none
+type BatchAnswer struct {
+	ID     string
+	Answer string
+	// Usage is the model that answered and the tokens it took, at the batch's price
+	Usage Usage
+	Err   error
+}
+
+// Batcher answers chat completion requests in bulk at a lower price, within a day rather than right away
+type Batcher interface {
+	// SubmitBatch sends reqs to be answered and returns the ID of their batch
+	SubmitBatch(ctx context.Context, reqs []BatchRequest) (string, error)
+	// BatchAnswers returns the answers of the batch id once it is done, requests it did not answer have none.
+	// A batch that failed as a whole is done with an error.
+	BatchAnswers(ctx context.Context, id string) (answers []BatchAnswer, done bool, err error)
+}
+
+// BatcherOf returns the Batcher behind provider, false for providers that cannot answer in batches
+func BatcherOf(provider ChatProvider) (Batcher, bool) {
+	for {
+		if batcher, ok := provider.(Batcher); ok {
+			return batcher, true
+		}
+		wrapper, ok := provider.(interface{ Unwrap() ChatProvider })
+		if !ok {
+			return nil, false
+		}
+		provider = wrapper.Unwrap()
+	}
+}
+
+// NewBatchRequest returns the request GetStringResponse would send client to answer chat with opts, to be
+// answered in a batch of ID instead. Tools are left out, batched requests cannot call them.
+func NewBatchRequest(client ChatProvider, id string, chat []openai.ChatCompletionMessage, opts ...Option) BatchRequest {
+	req := newRequest(client, withSystemPrompt(chat, ""), opts...)
+	req.Tools, req.ToolChoice = nil, nil
+	return BatchRequest{ID: id, Request: req.ChatCompletionRequest}
+}
+
+// openAIBatches is a ChatProvider that also answers batches with OpenAI's Batch API
+type openAIBatches struct {
+	ChatProvider
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+// withBatches makes provider answer batches with the Batch API at baseURL
+func withBatches(provider ChatProvider, apiKey, baseURL string, client *http.Client) ChatProvider {
+	return openAIBatches{ChatProvider: provider, apiKey: apiKey, baseURL: strings.TrimSuffix(baseURL, "/"), client: client}
+}
+
+// Unwrap returns the provider answering single requests
+func (o openAIBatches) Unwrap() ChatProvider {
+	return o.ChatProvider
+}
+
+// openAIBatch is the state of a batch
+type openAIBatch struct {
+	ID           string `json:"id"`
+	Status       string `json:"status"`
+	OutputFileID string `json:"output_file_id"`
+	ErrorFileID  string `json:"error_file_id"`
+	Errors       *struct {
+		Data []struct {
+			Message string `json:"message"`
+		} `json:"data"`
+	} `json:"errors"`
+}
+
+// batchInput is a line of the file of requests of a batch
+type batchInput struct {
+	CustomID string                       `json:"custom_id"`
+	Method   string                       `json:"method"`
+	URL      string                       `json:"url"`
+	Body     openai.ChatCompletionRequest `json:"body"`
+}
+
+// batchOutput is a line of the file of answers or errors of a batch
+type batchOutput struct {
+	CustomID string `json:"custom_id"`
+	Response *struct {
+		StatusCode int                           `json:"status_code"`
+		Body       openai.ChatCompletionResponse `json:"body"`
+	} `json:"response"`
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// SubmitBatch uploads reqs as the input file of a new batch and creates it
+func (o openAIBatches) SubmitBatch(ctx context.Context, reqs []BatchRequest) (string, error) {
+	var input bytes.Buffer
+	encoder := json.NewEncoder(&input)
+	for _, req := range reqs {
+		if err := encoder.Encode(batchInput{CustomID: req.ID, Method: http.MethodPost, URL: batchEndpoint, Body: req.Request}); err != nil {
+			return "", err
+		}
+	}
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if err := form.WriteField("purpose", "batch"); err != nil {
+		return "", err
+	}
+	part, err := form.CreateFormFile("file", "batch.jsonl")
+	if err != nil {
+		return "", err
+	}
+	if _, err = part.Write(input.Bytes()); err != nil {
+		return "", err
+	}
+	if err = form.Close(); err != nil {
+		return "", err
+	}
+	var file struct {
+		ID string `json:"id"`
+	}
+	if err = o.do(ctx, http.MethodPost, "/files", form.FormDataContentType(), &body, &file); err != nil {
+		return "", fmt.Errorf("uploading batch: %w", err)
+	}
+
+	create, err := json.Marshal(map[string]string{"input_file_id": file.ID, "endpoint": batchEndpoint, "completion_window": batchWindow})
+	if err != nil {
+		return "", err
+	}
+	var batch openAIBatch
+	if err = o.do(ctx, http.MethodPost, "/batches", "application/json", bytes.NewReader(create), &batch); err != nil {
+		return "", fmt.Errorf("creating batch: %w", err)
+	}
+	return batch.ID, nil
+}
+
+// BatchAnswers reads the answers and errors of the batch id once it is completed, expired or cancelled
+func (o openAIBatches) BatchAnswers(ctx context.Context, id string) ([]BatchAnswer, bool, error) {
+	var batch openAIBatch
+	if err := o.do(ctx, http.MethodGet, "/batches/"+url.PathEscape(id), "", nil, &batch); err != nil {
+		return nil, false, fmt.Errorf("checking batch %s: %w", id, err)
+	}
+	switch batch.Status {
+	case "completed", "expired", "cancelled":
+	case "failed":
+		var reasons []string
+		if batch.Errors != nil {
+			for _, e := range batch.Errors.Data {
+				reasons = append(reasons, e.Message)
+			}
+		}
+		return nil, true, fmt.Errorf("batch %s failed: %s", id, strings.Join(reasons, "; "))
+	default:
+		return nil, false, nil
+	}
+	var answers []BatchAnswer
+	for _, fileID := range []string{batch.OutputFileID, batch.ErrorFileID} {
+		if fileID == "" {
+			continue
+		}
+		var content bytes.Buffer
+		if err := o.do(ctx, http.MethodGet, "/files/"+url.PathEscape(fileID)+"/content", "", nil, &content); err != nil {
+			return nil, false, fmt.Errorf("reading batch %s: %w", id, err)
+		}
+		scanner := bufio.NewScanner(&content)
+		scanner.Buffer(nil, 1<<24)
+		for scanner.Scan() {
+			var line batchOutput
+			if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+				return nil, false, fmt.Errorf("reading batch %s: %w", id, err)
+			}
+			answers = append(answers, line.answer())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, false, fmt.Errorf("reading batch %s: %w", id, err)
+		}
+	}
+	return answers, true, nil
+}
+
+// answer returns the answer of the line, or why the request was not answered
+func (l batchOutput) answer() BatchAnswer {
+	switch {
+	case l.Error != nil:
+		return BatchAnswer{ID: l.CustomID, Err: fmt.Errorf("%s: %s", l.Error.Code, l.Error.Message)}
+	case l.Response == nil || l.Response.StatusCode != http.StatusOK:
+		return BatchAnswer{ID: l.CustomID, Err: errors.New("request was not answered")}
+	case len(l.Response.Body.Choices) == 0:
+		return BatchAnswer{ID: l.CustomID, Err: errors.New("no completion choices returned")}
+	}
+	body := l.Response.Body
+	return BatchAnswer{ID: l.CustomID, Answer: strings.TrimSpace(body.Choices[0].Message.Content), Usage: Usage{Model: body.Model, Usage: body.Usage}}
+}
+
+// do sends a request with body of contentType to path of the API, decoding the response into v, or copying it
+// when v is a *bytes.Buffer
+func (o openAIBatches) do(ctx context.Context, method, path, contentType string, body io.Reader, v any) error {
+	req, err := http.NewRequestWithContext(ctx, method, o.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+o.apiKey)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	if buf, ok := v.(*bytes.Buffer); ok {
+		_, err = buf.ReadFrom(resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,80 @@
+package chatgpt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/chikamif/slackgpt/src/fake"
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatches(t *testing.T) {
+	server := fake.NewOpenAI(0)
+	defer server.Close()
+	provider, err := NewProvider(ProviderConfig{APIKey: "sk-test", BaseURL: server.URL(), Model: "gpt-4o"})
+	require.NoError(t, err)
+	batcher, ok := BatcherOf(provider)
+	require.True(t, ok)
+
+	tool := Tool{Definition: openai.FunctionDefinition{Name: "lookup"}}
+	reqs := []BatchRequest{
+		NewBatchRequest(provider, "q1", []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "what is go"}}, WithTemperature(0.2)),
+		NewBatchRequest(provider, "q2", []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "what is rust"}}, WithTools(tool)),
+	}
+	assert.Equal(t, "gpt-4o", reqs[0].Request.Model)
+	assert.Equal(t, float32(0.2), reqs[0].Request.Temperature)
+	assert.Equal(t, DefaultSystemPrompt, reqs[0].Request.Messages[0].Content)
+	assert.Empty(t, reqs[1].Request.Tools, "batched requests cannot call tools")
+
+	id, err := batcher.SubmitBatch(context.Background(), reqs)
+	require.NoError(t, err)
+	answers, done, err := batcher.BatchAnswers(context.Background(), id)
+	require.NoError(t, err)
+	assert.True(t, done)
+	require.Len(t, answers, 2)
+	assert.Equal(t, "q1", answers[0].ID)
+	assert.Equal(t, "fake answer to: what is go", answers[0].Answer)
+	assert.Equal(t, "gpt-4o", answers[0].Usage.Model)
+	assert.Positive(t, answers[0].Usage.TotalTokens)
+	assert.Equal(t, "q2", answers[1].ID)
+	assert.Equal(t, "fake answer to: what is rust", answers[1].Answer)
+
+	_, ok = BatcherOf(newAnthropic(ProviderConfig{}, http.DefaultClient))
+	assert.False(t, ok)
+}
+
+func TestBatchAnswers_Status(t *testing.T) {
+	tests := []struct {
+		name     string
+		batch    string
+		wantDone bool
+		wantErr  string
+	}{
+		{"in progress", `{"id": "batch_1", "status": "in_progress"}`, false, ""},
+		{"failed", `{"id": "batch_1", "status": "failed", "errors": {"data": [{"message": "invalid model"}]}}`, true, "batch batch_1 failed: invalid model"},
+		{"expired without answers", `{"id": "batch_1", "status": "expired"}`, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/v1/batches/batch_1", r.URL.Path)
+				assert.Equal(t, "Bearer sk-test", r.Header.Get("Authorization"))
+				_, _ = w.Write([]byte(tt.batch))
+			}))
+			defer server.Close()
+			batcher := withBatches(nil, "sk-test", server.URL+"/v1/", server.Client()).(Batcher)
+			answers, done, err := batcher.BatchAnswers(context.Background(), "batch_1")
+			assert.Empty(t, answers)
+			assert.Equal(t, tt.wantDone, done)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package chatgpt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeTool tells the model the current time as now gives it, in a time zone of its choosing. Models do not know
+// what day it is otherwise.
+func TimeTool(now func() time.Time) Tool {
+	parameters := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"timezone": map[string]any{"type": "string", "description": "an IANA time zone, e.g. \"Asia/Tokyo\"; UTC when left out"},
+		},
+	}
+	return Func("current_time", "Tells the current date and time.", parameters,
+		func(_ context.Context, args struct{ Timezone string }) (string, error) {
+			loc := time.UTC
+			if args.Timezone != "" {
+				var err error
+				if loc, err = time.LoadLocation(args.Timezone); err != nil {
+					return "", fmt.Errorf("unknown time zone %q", args.Timezone)
+				}
+			}
+			t := now().In(loc)
+			return fmt.Sprintf("%s, %s (%s)", t.Weekday(), t.Format(time.RFC3339), loc), nil
+		})
+}
+
+// MathTool evaluates arithmetic for the model, which gets sums of large numbers wrong
+func MathTool() Tool {
+	parameters := map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"expression": map[string]any{"type": "string", "description": "numbers with + - * / % ^, parentheses and sqrt(), e.g. \"(1200 * 1.08) ^ 2\""},
+		},
+		"required": []string{"expression"},
+	}
+	return Func("calculate", "Evaluates an arithmetic expression exactly.", parameters,
+		func(_ context.Context, args struct{ Expression string }) (string, error) {
+			result, err := evaluate(args.Expression)
+			if err != nil {
+				return "", err
+			}
+			return strconv.FormatFloat(result, 'f', -1, 64), nil
+		})
+}
+
+// evaluate returns the value of the arithmetic expression: numbers with + - * / % ^, parentheses and sqrt(). ^
+// binds tightest, to the right, and unary minus looser than it, so -2^2 is -4.
+func evaluate(expression string) (float64, error) {
+	p := &calculator{text: expression}
+	value, err := p.sum()
+	if err != nil {
+		return 0, err
+	}
+	if p.skipSpace(); p.pos < len(p.text) {
+		return 0, fmt.Errorf("unexpected %q at %d", p.text[p.pos:], p.pos+1)
+	}
+	if math.IsInf(value, 0) || math.IsNaN(value) {
+		return 0, errors.New("the result is not a number")
+	}
+	return value, nil
+}
+
+// calculator evaluates an arithmetic expression by recursive descent
+type calculator struct {
+	text string
+	pos  int
+}
+
+// skipSpace skips the spaces before the next operator or operand
+func (p *calculator) skipSpace() {
+	for p.pos < len(p.text) && p.text[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// next consumes the operator op, reporting whether it was next
+func (p *calculator) next(op byte) bool {
+	if p.skipSpace(); p.pos < len(p.text) && p.text[p.pos] == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// sum is terms added or subtracted
+func (p *calculator) sum() (float64, error) {
+	value, err := p.product()
+	for err == nil {
+		var right float64
+		switch {
+		case p.next('+'):
+			right, err = p.product()
+			value += right
+		case p.next('-'):
+			right, err = p.product()
+			value -= right
+		default:
+			return value, nil
+		}
+	}
+	return 0, err
+}
+
+// product is factors multiplied, divided or taken modulo
+func (p *calculator) product() (float64, error) {
+	value, err := p.unary()
+	for err == nil {
+		var right float64
+		switch {
+		case p.next('*'):
+			right, err = p.unary()
+			value *= right
+		case p.next('/'), p.next('%'):
+			op := p.text[p.pos-1]
+			if right, err = p.unary(); err == nil && right == 0 {
+				err = errors.New("division by zero")
+			}
+			if op == '/' {
+				value /= right
+			} else {
+				value = math.Mod(value, right)
+			}
+		default:
+			return value, nil
+		}
+	}
+	return 0, err
+}
+
+// unary is a power, negated or not
+func (p *calculator) unary() (float64, error) {
+	if p.next('-') {
+		value, err := p.unary()
+		return -value, err
+	}
+	p.next('+')
+	return p.power()
+}
+
+// power is an operand raised to the right, itself possibly negated
+func (p *calculator) power() (float64, error) {
+	base, err := p.operand()
+	if err != nil || !p.next('^') {
+		return base, err
+	}
+	exponent, err := p.unary()
+	return math.Pow(base, exponent), err
+}
+
+// operand is a number, an expression in parentheses or a function of one
+func (p *calculator) operand() (float64, error) {
+	if p.skipSpace(); strings.HasPrefix(p.text[p.pos:], "sqrt") {
+		p.pos += len("sqrt")
+		if !p.next('(') {
+			return 0, errors.New("sqrt needs parentheses")
+		}
+		value, err := p.parenthesized()
+		if err == nil && value < 0 {
+			err = errors.New("square root of a negative number")
+		}
+		return math.Sqrt(value), err
+	}
+	if p.next('(') {
+		return p.parenthesized()
+	}
+	start := p.pos
+	for p.pos < len(p.text) && ('0' <= p.text[p.pos] && p.text[p.pos] <= '9' || p.text[p.pos] == '.') {
+		p.pos++
+	}
+	if start == p.pos {
+		if start == len(p.text) {
+			return 0, errors.New("unexpected end of expression")
+		}
+		return 0, fmt.Errorf("unexpected %q at %d", p.text[start:], start+1)
+	}
+	return strconv.ParseFloat(p.text[start:p.pos], 64)
+}
+
+// parenthesized is an expression closed by a parenthesis, the opening one consumed already
+func (p *calculator) parenthesized() (float64, error) {
+	value, err := p.sum()
+	if err == nil && !p.next(')') {
+		err = errors.New("missing closing parenthesis")
+	}
+	return value, err
+}
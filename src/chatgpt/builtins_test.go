@@ -0,0 +1,50 @@
+package chatgpt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeTool(t *testing.T) {
+	now := func() time.Time { return time.Date(2026, 10, 16, 3, 4, 5, 0, time.UTC) }
+	tool := TimeTool(now)
+	result, err := tool.Call(context.Background(), `{}`)
+	require.NoError(t, err)
+	assert.Equal(t, "Friday, 2026-10-16T03:04:05Z (UTC)", result)
+	result, err = tool.Call(context.Background(), `{"timezone":"Asia/Tokyo"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "Friday, 2026-10-16T12:04:05+09:00 (Asia/Tokyo)", result)
+	_, err = tool.Call(context.Background(), `{"timezone":"Mars/Olympus"}`)
+	assert.ErrorContains(t, err, "unknown time zone")
+}
+
+func TestMathTool(t *testing.T) {
+	for expression, want := range map[string]string{
+		"1 + 2 * 3":          "7",
+		"(1 + 2) * 3":        "9",
+		"-2^2":               "-4",
+		"2^3^2":              "512",
+		"2^-1":               "0.5",
+		"7 % 4 - -1":         "4",
+		"sqrt(16) / 8":       "0.5",
+		"123456789 * 987654": "121932591483006",
+	} {
+		result, err := MathTool().Call(context.Background(), `{"expression":"`+expression+`"}`)
+		require.NoError(t, err, expression)
+		assert.Equal(t, want, result, expression)
+	}
+	for expression, want := range map[string]string{
+		"1 / 0":    "division by zero",
+		"(1 + 2":   "missing closing parenthesis",
+		"1 +":      "unexpected end of expression",
+		"2 x 3":    `unexpected "x 3" at 3`,
+		"sqrt(-1)": "square root of a negative number",
+	} {
+		_, err := evaluate(expression)
+		assert.ErrorContains(t, err, want, expression)
+	}
+}
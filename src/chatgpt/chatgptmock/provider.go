@@ -0,0 +1,40 @@
+// Package chatgptmock mocks chatgpt.ChatProvider, so tests can check what the bot asks the model and answer it
+// without an API key or a fake server
+package chatgptmock
+
+import (
+	"context"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/mock"
+)
+
+// Provider is a chatgpt.ChatProvider answering as set up with On("CreateChatCompletion", ctx, req), e.g.
+//
+//	provider.On("CreateChatCompletion", mock.Anything, mock.Anything).Return(chatgptmock.Answer("hi"), nil)
+type Provider struct {
+	mock.Mock
+}
+
+// CreateChatCompletion answers req as set up for it
+func (p *Provider) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	args := p.Called(ctx, req)
+	return args.Get(0).(openai.ChatCompletionResponse), args.Error(1)
+}
+
+// Answer is a response answering text, to return from CreateChatCompletion
+func Answer(text string) openai.ChatCompletionResponse {
+	return openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: text},
+			FinishReason: openai.FinishReasonStop,
+		}},
+	}
+}
+
+// Asking matches the requests whose last message is question, to set up On("CreateChatCompletion") with
+func Asking(question string) any {
+	return mock.MatchedBy(func(req openai.ChatCompletionRequest) bool {
+		return len(req.Messages) > 0 && req.Messages[len(req.Messages)-1].Content == question
+	})
+}
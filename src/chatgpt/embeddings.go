@@ -0,0 +1,71 @@
+package chatgpt
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// DefaultEmbeddingModel embeds text when no other model is asked for
+const DefaultEmbeddingModel = openai.SmallEmbedding3
+
+// Embedder embeds text as vectors whose cosine similarity measures how alike texts are. *openai.Client is an
+// Embedder.
+type Embedder interface {
+	CreateEmbeddings(ctx context.Context, conv openai.EmbeddingRequestConverter) (openai.EmbeddingResponse, error)
+}
+
+// EmbedderOf returns the Embedder behind provider, false for providers that cannot embed text
+func EmbedderOf(provider ChatProvider) (Embedder, bool) {
+	for {
+		if embedder, ok := provider.(Embedder); ok {
+			return embedder, true
+		}
+		wrapper, ok := provider.(interface{ Unwrap() ChatProvider })
+		if !ok {
+			return nil, false
+		}
+		provider = wrapper.Unwrap()
+	}
+}
+
+// Embed returns the embeddings of texts, in order, with model or DefaultEmbeddingModel when it is empty
+func Embed(ctx context.Context, client Embedder, model string, texts []string) ([][]float32, error) {
+	if model == "" {
+		model = string(DefaultEmbeddingModel)
+	}
+	resp, err := client.CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{Input: texts, Model: openai.EmbeddingModel(model)})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("got %d embeddings for %d texts", len(resp.Data), len(texts))
+	}
+	embeddings := make([][]float32, len(texts))
+	for _, data := range resp.Data {
+		if data.Index < 0 || data.Index >= len(texts) {
+			return nil, fmt.Errorf("got an embedding for text %d of %d", data.Index, len(texts))
+		}
+		embeddings[data.Index] = data.Embedding
+	}
+	return embeddings, nil
+}
+
+// Similarity returns the cosine similarity of embeddings a and b, 0 when they differ in length or either is zero
+func Similarity(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
@@ -0,0 +1,47 @@
+package chatgpt
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbed(t *testing.T) {
+	var got openai.EmbeddingRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/embeddings", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		// out of order, as the API does not promise an order
+		_ = json.NewEncoder(w).Encode(openai.EmbeddingResponse{Data: []openai.Embedding{
+			{Embedding: []float32{0, 1}, Index: 1},
+			{Embedding: []float32{1, 0}, Index: 0},
+		}})
+	}))
+	defer server.Close()
+	provider, err := NewProvider(ProviderConfig{APIKey: "sk-test", BaseURL: server.URL + "/v1", Model: "gpt-4o"})
+	require.NoError(t, err)
+	embedder, ok := EmbedderOf(provider)
+	require.True(t, ok, "providers with a default model still embed")
+
+	embeddings, err := Embed(context.Background(), embedder, "", []string{"a", "b"})
+	require.NoError(t, err)
+	assert.Equal(t, [][]float32{{1, 0}, {0, 1}}, embeddings)
+	assert.Equal(t, DefaultEmbeddingModel, got.Model)
+
+	_, ok = EmbedderOf(newAnthropic(ProviderConfig{}, http.DefaultClient))
+	assert.False(t, ok)
+}
+
+func TestSimilarity(t *testing.T) {
+	assert.InDelta(t, 1, Similarity([]float32{1, 2}, []float32{2, 4}), 1e-9)
+	assert.InDelta(t, 0, Similarity([]float32{1, 0}, []float32{0, 1}), 1e-9)
+	assert.InDelta(t, -1, Similarity([]float32{1, 0}, []float32{-1, 0}), 1e-9)
+	assert.Equal(t, 0.0, Similarity([]float32{1}, []float32{1, 0}))
+	assert.Equal(t, 0.0, Similarity([]float32{0, 0}, []float32{1, 0}))
+}
@@ -0,0 +1,72 @@
+package chatgpt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// FormField is a field of a form the model fills in, Description tells it what goes in the field
+type FormField struct {
+	Name        string
+	Description string
+}
+
+// FormStep is where filling in a form stands: the values of the fields filled in so far, the questions to ask
+// the user about the fields still missing or unclear, and whether the form is complete. Summary sums the
+// form up in a sentence.
+type FormStep struct {
+	Values    map[string]string `json:"values"`
+	Questions map[string]string `json:"questions"`
+	Complete  bool              `json:"complete"`
+	Summary   string            `json:"summary"`
+}
+
+// formPrompt asks the model for the next step of filling in a form, as a JSON object
+const formPrompt = "You help a user fill in a form: %s. Its fields are:\n%s\nFrom what the user said and the values" +
+	" entered so far, reply with a JSON object only, of the form {\"values\": {<field>: <value>}, \"questions\":" +
+	" {<field>: <a short question asking for it>}, \"complete\": <true or false>, \"summary\": <one sentence>}." +
+	" Keep the values the user entered, and fill in the fields you can from what they said without making" +
+	" anything up. Ask about every field that is still missing or unclear. The form is complete when every field" +
+	" has a clear value."
+
+// GetFormStep asks the model how far the form described by purpose and fields is filled in from what the user
+// said about it and the values entered so far. Values and questions of fields the form does not have are
+// left out.
+func GetFormStep(client ChatProvider, ctx context.Context, purpose string, fields []FormField, said string, values map[string]string) (FormStep, error) {
+	var spec strings.Builder
+	known := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		fmt.Fprintf(&spec, "- %s: %s\n", field.Name, field.Description)
+		known[field.Name] = true
+	}
+	entered, err := json.Marshal(values)
+	if err != nil {
+		return FormStep{}, err
+	}
+	reply, err := complete(client, ctx, []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: fmt.Sprintf(formPrompt, purpose, spec.String())},
+		{Role: openai.ChatMessageRoleUser, Content: "The user said: " + said + "\nValues entered so far: " + string(entered)},
+	})
+	if err != nil {
+		return FormStep{}, err
+	}
+	var step FormStep
+	if !decodeJSONObject(reply, &step) {
+		return FormStep{}, fmt.Errorf("the model did not reply with a form step: %q", reply)
+	}
+	for name, value := range step.Values {
+		if !known[name] || strings.TrimSpace(value) == "" {
+			delete(step.Values, name)
+		}
+	}
+	for name := range step.Questions {
+		if !known[name] {
+			delete(step.Questions, name)
+		}
+	}
+	return step, nil
+}
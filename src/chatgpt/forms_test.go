@@ -0,0 +1,34 @@
+package chatgpt
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetFormStep(t *testing.T) {
+	fields := []FormField{{Name: "summary", Description: "what went wrong"}, {Name: "steps", Description: "how to reproduce it"}}
+	tests := []struct {
+		reply   string
+		want    FormStep
+		wantErr bool
+	}{
+		{"```json\n{\"values\": {\"summary\": \"Export does nothing\", \"browser\": \"Safari\", \"steps\": \" \"}," +
+			" \"questions\": {\"steps\": \"What did you click?\", \"os\": \"Which OS?\"}, \"complete\": false, \"summary\": \"Export is broken.\"}\n```",
+			FormStep{Values: map[string]string{"summary": "Export does nothing"}, Questions: map[string]string{"steps": "What did you click?"}, Summary: "Export is broken."}, false},
+		{`{"values": {"summary": "a", "steps": "b"}, "complete": true}`,
+			FormStep{Values: map[string]string{"summary": "a", "steps": "b"}, Complete: true}, false},
+		{"I need more details.", FormStep{}, true},
+	}
+	for _, tt := range tests {
+		step, err := GetFormStep(replier(tt.reply), context.Background(), "bug report", fields, "export does nothing", nil)
+		if tt.wantErr {
+			assert.Error(t, err, tt.reply)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, step, tt.reply)
+	}
+}
@@ -2,7 +2,11 @@ package chatgpt
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"math"
+	"regexp"
+	"strconv"
 	"strings"
 
 	openai "github.com/sashabaranov/go-openai"
@@ -13,9 +17,11 @@ var ErrorEmptyPrompt error = errors.New("Error empty prompt")
 
 // GetStringResponse sends a completion request to the GPT-3 API to generate a response
 // for a given conversation using the specified GPT-3 model. The function takes in a GPT-3
-// client, a context, and a slice of strings representing the conversation.
+// client, a context, and the conversation as user and assistant messages, oldest first.
+// The conversation may start with system messages setting the bot's persona, DefaultSystemPrompt
+// is used when it does not.
 //
-// If the length of the conversation slice is 0, an error called ErrorEmptyPrompt is returned.
+// If the conversation is empty, an error called ErrorEmptyPrompt is returned.
 //
 // The function returns the generated response text from the GPT-3 API as a string, with any leading
 // or trailing spaces removed using strings.TrimSpace().
@@ -23,34 +29,345 @@ var ErrorEmptyPrompt error = errors.New("Error empty prompt")
 // Parameters:
 // - client: a GPT-3 client object used to make API requests
 // - ctx: a context object used to handle timeouts and cancellations
-// - chat: a slice of strings representing the conversation
+// - chat: the messages of the conversation, ending with the question to answer
 //
 // Returns:
 // - a string containing the generated response from the GPT-3 API
 // - an error, if any
-func GetStringResponse(client *openai.Client, ctx context.Context, chat []string) (string, error) {
+func GetStringResponse(client ChatProvider, ctx context.Context, chat []openai.ChatCompletionMessage, opts ...Option) (string, error) {
 	if len(chat) == 0 {
 		return "", ErrorEmptyPrompt
 	}
+	return complete(client, ctx, withSystemPrompt(chat, ""), opts...)
+}
 
-	req := openai.ChatCompletionRequest{
-		Model: openai.GPT4Turbo1106,
-		Messages: []openai.ChatCompletionMessage{
-			{
-				Role:    openai.ChatMessageRoleSystem,
-				Content: "You are a helpful chat bot assistant. Please answer shortly, and in Japanese.",
-			},
-			{
-				Role:    openai.ChatMessageRoleUser,
-				Content: strings.Join(chat, " "),
-			},
-		},
-		MaxTokens:   1000,
-		Temperature: 0.5,
+// DefaultModel answers unless the provider has its own default or another model is requested with WithModel
+const DefaultModel = openai.GPT4Turbo1106
+
+// Option changes a completion request
+type Option func(*request)
+
+// request is a completion request, the tools the model may call while answering it, the token limit the
+// conversation is truncated to and the task it is routed as
+type request struct {
+	openai.ChatCompletionRequest
+	tools       map[string]Tool
+	tokenLimit  int
+	countTokens TokenCounter
+	// task is what WithRoutes routes the request as, classified from its messages when empty
+	task Task
+	// usage is told the model and tokens the answer took, when not nil
+	usage *Usage
+}
+
+// Usage is the model that answered a request and the tokens it took over every round of tool calls
+type Usage struct {
+	Model string
+	openai.Usage
+}
+
+// WithUsage records the model and tokens the answer took in usage
+func WithUsage(usage *Usage) Option {
+	return func(req *request) {
+		req.usage = usage
+	}
+}
+
+// WithModel requests an answer from model instead of the default model, an empty model keeps the default
+func WithModel(model string) Option {
+	return func(req *request) {
+		if model != "" {
+			req.Model = model
+		}
+	}
+}
+
+// WithTemperature samples the answer at temperature, from 0 to 2, instead of the default 0.5
+func WithTemperature(temperature float32) Option {
+	return func(req *request) {
+		// a zero temperature would be left out of the request and the API's default used instead
+		req.Temperature = max(temperature, math.SmallestNonzeroFloat32)
+	}
+}
+
+// WithMaxTokens lets the answer take up to maxTokens tokens instead of the default 1000, 0 keeps the default
+func WithMaxTokens(maxTokens int) Option {
+	return func(req *request) {
+		if maxTokens > 0 {
+			req.MaxTokens = maxTokens
+		}
+	}
+}
+
+// DefaultSystemPrompt sets the tone of answers to conversations that do not start with a system message
+const DefaultSystemPrompt = "You are a helpful chat bot assistant. Please answer shortly, and in Japanese."
+
+// confidencePrompt asks the model to rate its answer on a line of its own after the answer
+const confidencePrompt = "After your answer, add a last line of the form \"CONFIDENCE: N\" where N is a number from 0 to 100" +
+	" rating how sure you are that the answer is correct and complete."
+
+// withSystemPrompt puts DefaultSystemPrompt in front of chat unless it starts with a system message of its
+// own, followed by instructions when they are not empty
+func withSystemPrompt(chat []openai.ChatCompletionMessage, instructions string) []openai.ChatCompletionMessage {
+	leading := 0
+	for leading < len(chat) && chat[leading].Role == openai.ChatMessageRoleSystem {
+		leading++
 	}
-	resp, err := client.CreateChatCompletion(ctx, req)
+	messages := make([]openai.ChatCompletionMessage, 0, len(chat)+2)
+	if leading == 0 {
+		messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: DefaultSystemPrompt})
+	}
+	messages = append(messages, chat[:leading]...)
+	if instructions != "" {
+		messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: instructions})
+	}
+	return append(messages, chat[leading:]...)
+}
+
+// confidencePattern matches the confidence rating at the end of an answer
+var confidencePattern = regexp.MustCompile(`(?i)\s*confidence:\s*(\d{1,3})\s*%?\s*$`)
+
+// UnknownConfidence is returned by GetRatedResponse when the model did not rate its answer
+const UnknownConfidence = -1
+
+// GetRatedResponse is GetStringResponse with the model also rating its confidence in the answer from 0 to
+// 100. The rating is removed from the answer, and is UnknownConfidence when the model left it out.
+func GetRatedResponse(client ChatProvider, ctx context.Context, chat []openai.ChatCompletionMessage, opts ...Option) (string, int, error) {
+	if len(chat) == 0 {
+		return "", UnknownConfidence, ErrorEmptyPrompt
+	}
+	answer, err := complete(client, ctx, withSystemPrompt(chat, confidencePrompt), opts...)
+	if err != nil {
+		return "", UnknownConfidence, err
+	}
+	answer, confidence := ParseConfidence(answer)
+	return answer, confidence, nil
+}
+
+// ParseConfidence splits the confidence rating off the end of an answer, it is UnknownConfidence when the
+// answer does not end in one. Ratings above 100 are capped.
+func ParseConfidence(answer string) (string, int) {
+	m := confidencePattern.FindStringSubmatchIndex(answer)
+	if m == nil {
+		return answer, UnknownConfidence
+	}
+	confidence, _ := strconv.Atoi(answer[m[2]:m[3]])
+	if confidence > 100 {
+		confidence = 100
+	}
+	return strings.TrimSpace(answer[:m[0]]), confidence
+}
+
+// summaryPrompt asks for a hand-over note for a human support agent
+const summaryPrompt = "You summarize conversations between a user and a chat bot assistant for a human support agent" +
+	" who takes over. In two or three sentences, say what the user needs and what the assistant already suggested."
+
+// GetSummary asks the model to summarize chat for a human taking over the conversation. The conversation is
+// sent as a single transcript so the model does not carry it on instead.
+func GetSummary(client ChatProvider, ctx context.Context, chat []openai.ChatCompletionMessage) (string, error) {
+	return describe(client, ctx, summaryPrompt, chat)
+}
+
+// titlePrompt asks for a title that makes a conversation easy to find again
+const titlePrompt = "Write a title of at most eight words for the following conversation, in the language of the" +
+	" conversation, that would help find it again later. Reply with the title only."
+
+// GetTitle asks the model for a short title of chat
+func GetTitle(client ChatProvider, ctx context.Context, chat []openai.ChatCompletionMessage) (string, error) {
+	title, err := describe(client, ctx, titlePrompt, chat)
 	if err != nil {
 		return "", err
 	}
-	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+	title, _, _ = strings.Cut(title, "\n")
+	return strings.Trim(title, ` "'*#`), nil
+}
+
+// clarifyPrompt asks whether the last question of a conversation needs clarifying, as a JSON object
+const clarifyPrompt = "Decide whether the user's last question in the following conversation is too ambiguous to" +
+	" answer well without asking what they mean. Reply with a JSON object only: {\"ambiguous\": false} when it can" +
+	" be answered, or {\"ambiguous\": true, \"question\": \"<a short clarifying question>\", \"options\": [<two or" +
+	" three short answers to it, the most likely meanings of the question>]} when it cannot."
+
+// Clarification is a question asking what the user meant and the likely answers to it
+type Clarification struct {
+	Question string   `json:"question"`
+	Options  []string `json:"options"`
+}
+
+// maxClarificationOptions is the most options a clarification offers
+const maxClarificationOptions = 3
+
+// GetClarification asks the model whether the last question of chat is too ambiguous to answer, returning the
+// question to ask the user and two or three options when it is. Replies that are not a clarification with at
+// least two options are taken to mean the question is clear.
+func GetClarification(client ChatProvider, ctx context.Context, chat []openai.ChatCompletionMessage) (Clarification, bool, error) {
+	reply, err := describe(client, ctx, clarifyPrompt, chat)
+	if err != nil {
+		return Clarification{}, false, err
+	}
+	var check struct {
+		Ambiguous bool `json:"ambiguous"`
+		Clarification
+	}
+	if !decodeJSONObject(reply, &check) || !check.Ambiguous {
+		return Clarification{}, false, nil
+	}
+	c := Clarification{Question: strings.TrimSpace(check.Question)}
+	for _, option := range check.Options {
+		if option = strings.TrimSpace(option); option != "" && len(c.Options) < maxClarificationOptions {
+			c.Options = append(c.Options, option)
+		}
+	}
+	if c.Question == "" || len(c.Options) < 2 {
+		return Clarification{}, false, nil
+	}
+	return c, true, nil
+}
+
+// decodeJSONObject decodes the JSON object in reply into v, ignoring any text or code fence around it, and
+// reports whether it could
+func decodeJSONObject(reply string, v any) bool {
+	start, end := strings.Index(reply, "{"), strings.LastIndex(reply, "}")
+	return start >= 0 && end > start && json.Unmarshal([]byte(reply[start:end+1]), v) == nil
+}
+
+// receptionPrompt asks how an announcement was received, for the team that made it
+const receptionPrompt = "You help a communications team measure how an announcement was received. Given the" +
+	" announcement, the emoji reactions to it and the replies in its thread, say in a few short bullet points what" +
+	" the overall sentiment is, what the reactions suggest, and which questions or concerns come up in the replies" +
+	" and how often."
+
+// GetReception asks the model to summarize how announcement was received from its reactions, as listed by the
+// caller, and the replies to it
+func GetReception(client ChatProvider, ctx context.Context, announcement, reactions string, replies []string) (string, error) {
+	if strings.TrimSpace(announcement) == "" {
+		return "", ErrorEmptyPrompt
+	}
+	var report strings.Builder
+	report.WriteString("Announcement:\n" + announcement + "\n\nReactions: " + reactions + "\n\nReplies:\n")
+	if len(replies) == 0 {
+		report.WriteString("none\n")
+	}
+	for _, reply := range replies {
+		report.WriteString("- " + strings.ReplaceAll(reply, "\n", " ") + "\n")
+	}
+	return complete(client, ctx, []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: receptionPrompt},
+		{Role: openai.ChatMessageRoleUser, Content: report.String()},
+	})
+}
+
+// transcriptPrompt asks for the gist of a recording for those who did not listen to it
+const transcriptPrompt = "Summarize the following transcript of a voice message or recording in a few short bullet" +
+	" points, in the language of the transcript, followed by any decisions and action items with who owns them."
+
+// GetTranscriptSummary asks the model to summarize the transcript of a clip
+func GetTranscriptSummary(client ChatProvider, ctx context.Context, transcript string) (string, error) {
+	if strings.TrimSpace(transcript) == "" {
+		return "", ErrorEmptyPrompt
+	}
+	return complete(client, ctx, []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: transcriptPrompt},
+		{Role: openai.ChatMessageRoleUser, Content: transcript},
+	})
+}
+
+// threadSummaryPrompt asks for the gist of a Slack thread for those who did not follow it
+const threadSummaryPrompt = "Summarize the following Slack thread for someone who did not follow it, in a few short" +
+	" bullet points in the language of the thread: what it is about, what was decided and what is still open," +
+	" followed by any action items with who owns them. Speakers are named by their Slack user ID."
+
+// GetThreadSummary asks the model to summarize a thread, its messages in chat
+func GetThreadSummary(client ChatProvider, ctx context.Context, chat []openai.ChatCompletionMessage) (string, error) {
+	return describe(client, ctx, threadSummaryPrompt, chat)
+}
+
+// describe asks the model to do what prompt says with a transcript of chat, leaving out system messages
+func describe(client ChatProvider, ctx context.Context, prompt string, chat []openai.ChatCompletionMessage, opts ...Option) (string, error) {
+	var transcript strings.Builder
+	for _, message := range chat {
+		if message.Role == openai.ChatMessageRoleSystem {
+			continue
+		}
+		speaker := message.Role
+		if message.Name != "" {
+			speaker += " " + message.Name
+		}
+		transcript.WriteString(speaker + ": " + message.Content + "\n")
+	}
+	if transcript.Len() == 0 {
+		return "", ErrorEmptyPrompt
+	}
+	return complete(client, ctx, []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: prompt},
+		{Role: openai.ChatMessageRoleUser, Content: transcript.String()},
+	}, opts...)
+}
+
+// ModelOf returns the model client answers with unless another is requested with WithModel
+func ModelOf(client ChatProvider) string {
+	if m, ok := client.(modeler); ok {
+		return m.Model()
+	}
+	return DefaultModel
+}
+
+// newRequest returns the request answering messages with the default model of client, as changed by opts
+func newRequest(client ChatProvider, messages []openai.ChatCompletionMessage, opts ...Option) request {
+	req := request{ChatCompletionRequest: openai.ChatCompletionRequest{
+		Model:       ModelOf(client),
+		Messages:    messages,
+		MaxTokens:   1000,
+		Temperature: 0.5,
+	}}
+	for _, opt := range opts {
+		opt(&req)
+	}
+	req.truncate()
+	return req
+}
+
+// used adds the tokens of a response to req to its usage
+func (req *request) used(resp openai.ChatCompletionResponse) {
+	if req.usage == nil {
+		return
+	}
+	req.usage.Model = resp.Model
+	if req.usage.Model == "" {
+		req.usage.Model = req.Model
+	}
+	req.usage.PromptTokens += resp.Usage.PromptTokens
+	req.usage.CompletionTokens += resp.Usage.CompletionTokens
+	req.usage.TotalTokens += resp.Usage.TotalTokens
+}
+
+// complete asks the model to continue messages, calling the tools it asks for along the way
+func complete(client ChatProvider, ctx context.Context, messages []openai.ChatCompletionMessage, opts ...Option) (string, error) {
+	req := newRequest(client, messages, opts...)
+	for round := 1; ; round++ {
+		if round == maxToolRounds && len(req.Tools) > 0 {
+			// the model has to answer with what it found so far
+			req.ToolChoice = "none"
+		}
+		resp, err := client.CreateChatCompletion(ctx, req.ChatCompletionRequest)
+		if err != nil {
+			return "", err
+		}
+		req.used(resp)
+		if len(resp.Choices) == 0 {
+			return "", errors.New("no completion choices returned")
+		}
+		message := resp.Choices[0].Message
+		if len(message.ToolCalls) == 0 || len(req.tools) == 0 {
+			return strings.TrimSpace(message.Content), nil
+		}
+		req.Messages = append(req.Messages[:len(req.Messages):len(req.Messages)], message)
+		for _, call := range message.ToolCalls {
+			req.Messages = append(req.Messages, openai.ChatCompletionMessage{
+				Role:       openai.ChatMessageRoleTool,
+				Content:    req.call(ctx, call),
+				ToolCallID: call.ID,
+			})
+		}
+	}
 }
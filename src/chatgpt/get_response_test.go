@@ -0,0 +1,135 @@
+package chatgpt
+
+import (
+	"context"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseConfidence(t *testing.T) {
+	tests := []struct {
+		answer         string
+		wantAnswer     string
+		wantConfidence int
+	}{
+		{"Go is a language.\nCONFIDENCE: 85", "Go is a language.", 85},
+		{"Go is a language. Confidence: 40%", "Go is a language.", 40},
+		{"Go is a language.\nconfidence:7 \n", "Go is a language.", 7},
+		{"Go is a language.\nCONFIDENCE: 250", "Go is a language.", 100},
+		{"Go is a language.", "Go is a language.", UnknownConfidence},
+		{"CONFIDENCE: 90 is only a rating at the end", "CONFIDENCE: 90 is only a rating at the end", UnknownConfidence},
+	}
+	for _, tt := range tests {
+		answer, confidence := ParseConfidence(tt.answer)
+		assert.Equal(t, tt.wantAnswer, answer)
+		assert.Equal(t, tt.wantConfidence, confidence)
+	}
+}
+
+func TestWithSystemPrompt(t *testing.T) {
+	question := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "hi"}
+	persona := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: "answer in French"}
+	system := func(content string) openai.ChatCompletionMessage {
+		return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: content}
+	}
+	tests := []struct {
+		name         string
+		chat         []openai.ChatCompletionMessage
+		instructions string
+		want         []openai.ChatCompletionMessage
+	}{
+		{"default persona", []openai.ChatCompletionMessage{question}, "", []openai.ChatCompletionMessage{system(DefaultSystemPrompt), question}},
+		{"own persona", []openai.ChatCompletionMessage{persona, question}, "", []openai.ChatCompletionMessage{persona, question}},
+		{"instructions follow the persona", []openai.ChatCompletionMessage{persona, question}, "rate it", []openai.ChatCompletionMessage{persona, system("rate it"), question}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, withSystemPrompt(tt.chat, tt.instructions))
+		})
+	}
+}
+
+func TestWithModel(t *testing.T) {
+	req := request{ChatCompletionRequest: openai.ChatCompletionRequest{Model: DefaultModel}}
+	WithModel("")(&req)
+	assert.Equal(t, DefaultModel, req.Model)
+	WithModel("gpt-4o")(&req)
+	assert.Equal(t, "gpt-4o", req.Model)
+}
+
+func TestWithTemperatureAndMaxTokens(t *testing.T) {
+	req := request{ChatCompletionRequest: openai.ChatCompletionRequest{Temperature: 0.5, MaxTokens: 1000}}
+	WithTemperature(0.9)(&req)
+	WithMaxTokens(0)(&req)
+	assert.Equal(t, float32(0.9), req.Temperature)
+	assert.Equal(t, 1000, req.MaxTokens)
+	WithTemperature(0)(&req)
+	WithMaxTokens(200)(&req)
+	assert.NotZero(t, req.Temperature, "a zero temperature is still sent")
+	assert.Less(t, req.Temperature, float32(0.001))
+	assert.Equal(t, 200, req.MaxTokens)
+}
+
+// metered is a toolCaller whose responses say which model answered and what they took
+type metered struct {
+	*toolCaller
+}
+
+func (m metered) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	resp, err := m.toolCaller.CreateChatCompletion(ctx, req)
+	resp.Model = req.Model + "-2024-05-13"
+	resp.Usage = openai.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}
+	return resp, err
+}
+
+func TestWithUsage(t *testing.T) {
+	question := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}}
+	echo := Tool{Definition: openai.FunctionDefinition{Name: "echo"}, Call: func(_ context.Context, arguments string) (string, error) {
+		return arguments, nil
+	}}
+	provider := metered{&toolCaller{calls: [][]openai.ToolCall{{toolCall("1", "echo", `{}`)}}}}
+	var usage Usage
+	_, err := GetStringResponse(provider, context.Background(), question, WithModel("gpt-4o"), WithTools(echo), WithUsage(&usage))
+	require.NoError(t, err)
+	assert.Equal(t, Usage{Model: "gpt-4o-2024-05-13", Usage: openai.Usage{PromptTokens: 20, CompletionTokens: 10, TotalTokens: 30}}, usage,
+		"the tokens of every round are counted")
+
+	usage = Usage{}
+	_, err = GetStringResponse(replier("hello"), context.Background(), question, WithModel("gpt-4o"), WithUsage(&usage))
+	require.NoError(t, err)
+	assert.Equal(t, Usage{Model: "gpt-4o"}, usage, "the requested model answered when the response doesn't say")
+}
+
+// replier answers every request with reply
+type replier string
+
+func (r replier) CreateChatCompletion(context.Context, openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	message := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: string(r)}
+	return openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{Message: message}}}, nil
+}
+
+func TestGetClarification(t *testing.T) {
+	question := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "how far is the bank?"}}
+	tests := []struct {
+		reply         string
+		want          Clarification
+		wantAmbiguous bool
+	}{
+		{`{"ambiguous": false}`, Clarification{}, false},
+		{"```json\n{\"ambiguous\": true, \"question\": \"Which bank?\", \"options\": [\"River\", \" Savings \"]}\n```",
+			Clarification{Question: "Which bank?", Options: []string{"River", "Savings"}}, true},
+		{`{"ambiguous": true, "question": "Which bank?", "options": ["a", "b", "c", "d"]}`,
+			Clarification{Question: "Which bank?", Options: []string{"a", "b", "c"}}, true},
+		{`{"ambiguous": true, "question": "Which bank?", "options": ["River", ""]}`, Clarification{}, false},
+		{`{"ambiguous": true, "options": ["River", "Savings"]}`, Clarification{}, false},
+		{"It is ambiguous.", Clarification{}, false},
+	}
+	for _, tt := range tests {
+		clarification, ambiguous, err := GetClarification(replier(tt.reply), context.Background(), question)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, clarification, tt.reply)
+		assert.Equal(t, tt.wantAmbiguous, ambiguous, tt.reply)
+	}
+}
@@ -0,0 +1,71 @@
+package chatgpt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Judgement is how a judge model scored an answer on each criterion, from 1 (poor) to 5 (excellent)
+type Judgement struct {
+	// Accuracy is whether the answer is correct and answers the question
+	Accuracy int `json:"accuracy"`
+	// Tone is whether the answer is polite, clear and fits the conversation
+	Tone int `json:"tone"`
+	// Policy is whether the answer follows the assistant's instructions
+	Policy int `json:"policy"`
+}
+
+// Scores returns the scores of j by criterion
+func (j Judgement) Scores() map[string]int {
+	return map[string]int{"accuracy": j.Accuracy, "tone": j.Tone, "policy": j.Policy}
+}
+
+// judgePrompt asks for the scores of an answer as JSON
+const judgePrompt = "You review the answers of a chat bot assistant. You are given the assistant's instructions, the" +
+	" conversation and the assistant's last answer. Score the last answer from 1 (poor) to 5 (excellent) on accuracy" +
+	" (it is correct and answers the question), tone (it is polite, clear and fits the conversation) and policy (it" +
+	" follows the assistant's instructions). Reply with JSON only, e.g. {\"accuracy\": 4, \"tone\": 5, \"policy\": 5}."
+
+// GetJudgement asks the model, usually another one chosen with WithModel, to score answer, the reply of an
+// assistant following instructions to chat
+func GetJudgement(client ChatProvider, ctx context.Context, instructions string, chat []openai.ChatCompletionMessage, answer string, opts ...Option) (Judgement, error) {
+	var transcript strings.Builder
+	transcript.WriteString("Instructions:\n" + instructions + "\n\nConversation:\n")
+	for _, message := range chat {
+		if message.Role == openai.ChatMessageRoleSystem {
+			continue
+		}
+		transcript.WriteString(message.Role + ": " + messageText(message) + "\n")
+	}
+	transcript.WriteString("\nLast answer:\n" + answer)
+	reply, err := complete(client, ctx, []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: judgePrompt},
+		{Role: openai.ChatMessageRoleUser, Content: transcript.String()},
+	}, append(opts, WithMaxTokens(50))...)
+	if err != nil {
+		return Judgement{}, err
+	}
+	return ParseJudgement(reply)
+}
+
+// ParseJudgement reads the scores out of a judge model's reply, the JSON object in it
+func ParseJudgement(reply string) (Judgement, error) {
+	var j Judgement
+	start, end := strings.Index(reply, "{"), strings.LastIndex(reply, "}")
+	if start < 0 || end < start {
+		return j, fmt.Errorf("judgement is not JSON: %q", reply)
+	}
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &j); err != nil {
+		return j, fmt.Errorf("reading judgement %q: %w", reply, err)
+	}
+	for criterion, score := range j.Scores() {
+		if score < 1 || score > 5 {
+			return j, fmt.Errorf("judgement scores %s %d, not from 1 to 5", criterion, score)
+		}
+	}
+	return j, nil
+}
@@ -0,0 +1,49 @@
+package chatgpt
+
+import (
+	"context"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetJudgement(t *testing.T) {
+	client := &taskReplier{reply: "Here you go:\n```json\n{\"accuracy\": 4, \"tone\": 5, \"policy\": 3}\n```"}
+	chat := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "answer in French"},
+		{Role: openai.ChatMessageRoleUser, Content: "what is go?"},
+	}
+	j, err := GetJudgement(client, context.Background(), "answer in French", chat, "a language", WithModel("gpt-4o"))
+	require.NoError(t, err)
+	assert.Equal(t, Judgement{Accuracy: 4, Tone: 5, Policy: 3}, j)
+	assert.Equal(t, "gpt-4o", client.req.Model)
+	transcript := client.req.Messages[len(client.req.Messages)-1].Content
+	assert.Equal(t, "Instructions:\nanswer in French\n\nConversation:\nuser: what is go?\n\nLast answer:\na language", transcript)
+}
+
+func TestParseJudgement(t *testing.T) {
+	tests := []struct {
+		reply string
+		want  Judgement
+		err   bool
+	}{
+		{reply: `{"accuracy": 1, "tone": 2, "policy": 5}`, want: Judgement{Accuracy: 1, Tone: 2, Policy: 5}},
+		{reply: "I cannot judge this", err: true},
+		{reply: `{"accuracy": 9, "tone": 2, "policy": 5}`, err: true},
+		{reply: `{"accuracy": 3, "tone": 2}`, err: true},
+		{reply: `{"accuracy": "good"}`, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.reply, func(t *testing.T) {
+			j, err := ParseJudgement(tt.reply)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, j)
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package chatgpt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// MaintenanceWindow is a planned outage of a provider, from Start until End
+type MaintenanceWindow struct {
+	Start time.Time
+	End   time.Time
+}
+
+// ParseMaintenanceWindow parses a window written as two RFC 3339 times, "2024-06-01T22:00:00Z/2024-06-02T02:00:00Z"
+func ParseMaintenanceWindow(s string) (MaintenanceWindow, error) {
+	invalid := fmt.Errorf("maintenance window %q should look like 2024-06-01T22:00:00Z/2024-06-02T02:00:00Z", s)
+	from, to, ok := strings.Cut(s, "/")
+	if !ok {
+		return MaintenanceWindow{}, invalid
+	}
+	start, err := time.Parse(time.RFC3339, strings.TrimSpace(from))
+	if err != nil {
+		return MaintenanceWindow{}, invalid
+	}
+	end, err := time.Parse(time.RFC3339, strings.TrimSpace(to))
+	if err != nil {
+		return MaintenanceWindow{}, invalid
+	}
+	if !end.After(start) {
+		return MaintenanceWindow{}, fmt.Errorf("maintenance window %q ends before it starts", s)
+	}
+	return MaintenanceWindow{Start: start, End: end}, nil
+}
+
+// contains reports whether t falls in the window
+func (w MaintenanceWindow) contains(t time.Time) bool {
+	return !t.Before(w.Start) && t.Before(w.End)
+}
+
+// MaintenanceError is returned for requests made during a maintenance window when no fallback answers them
+type MaintenanceError struct {
+	Until time.Time
+}
+
+func (e *MaintenanceError) Error() string {
+	return "the chat provider is down for maintenance until " + e.Until.Format(time.RFC3339)
+}
+
+// WithMaintenance returns provider with the chat completions requested during windows sent to fallback, with
+// fallback's default model, and going back to provider once they are over. Without a fallback they fail with a
+// *MaintenanceError. Other requests, such as embeddings, still go to provider.
+func WithMaintenance(provider, fallback ChatProvider, windows []MaintenanceWindow) ChatProvider {
+	return maintained{ChatProvider: provider, fallback: fallback, windows: windows, now: time.Now}
+}
+
+// maintained is a ChatProvider with planned outages
+type maintained struct {
+	ChatProvider
+	// fallback answers during windows, nil when nothing does
+	fallback ChatProvider
+	windows  []MaintenanceWindow
+	now      func() time.Time
+}
+
+func (m maintained) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	until, ok := m.until(m.now())
+	if !ok {
+		return m.ChatProvider.CreateChatCompletion(ctx, req)
+	}
+	if m.fallback == nil {
+		return openai.ChatCompletionResponse{}, &MaintenanceError{Until: until}
+	}
+	// the model asked for is the provider's, which the fallback may not have
+	req.Model = DefaultModel
+	if fm, ok := m.fallback.(modeler); ok {
+		req.Model = fm.Model()
+	}
+	return m.fallback.CreateChatCompletion(ctx, req)
+}
+
+// until returns when the maintenance t falls in is over, ok is false when t is in no window. Windows that
+// follow each other without a gap are one maintenance.
+func (m maintained) until(t time.Time) (until time.Time, ok bool) {
+	for changed := true; changed; {
+		changed = false
+		for _, w := range m.windows {
+			if w.contains(t) && w.End.After(until) || ok && w.contains(until) && w.End.After(until) {
+				until, ok, changed = w.End, true, true
+			}
+		}
+	}
+	return until, ok
+}
+
+// Model returns the default model of the provider
+func (m maintained) Model() string {
+	if pm, ok := m.ChatProvider.(modeler); ok {
+		return pm.Model()
+	}
+	return DefaultModel
+}
+
+// Unwrap returns the provider
+func (m maintained) Unwrap() ChatProvider {
+	return m.ChatProvider
+}
+
+// Maintenance reports whether provider, or a provider it wraps, is down for maintenance at t, until when, and
+// whether a fallback answers in the meantime
+func Maintenance(provider ChatProvider, t time.Time) (until time.Time, fallback bool, ok bool) {
+	for {
+		if m, isMaintained := provider.(maintained); isMaintained {
+			if until, ok = m.until(t); ok {
+				return until, m.fallback != nil, true
+			}
+		}
+		wrapper, isWrapper := provider.(interface{ Unwrap() ChatProvider })
+		if !isWrapper {
+			return time.Time{}, false, false
+		}
+		provider = wrapper.Unwrap()
+	}
+}
@@ -0,0 +1,70 @@
+package chatgpt
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMaintenanceWindow(t *testing.T) {
+	w, err := ParseMaintenanceWindow("2024-06-01T22:00:00Z / 2024-06-02T02:00:00+02:00")
+	require.NoError(t, err)
+	assert.True(t, w.Start.Equal(time.Date(2024, 6, 1, 22, 0, 0, 0, time.UTC)))
+	assert.True(t, w.End.Equal(time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)))
+
+	for _, s := range []string{"2024-06-01T22:00:00Z", "22:00/02:00", "2024-06-02T02:00:00Z/2024-06-01T22:00:00Z"} {
+		_, err := ParseMaintenanceWindow(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestWithMaintenance(t *testing.T) {
+	at := func(hour int) time.Time { return time.Date(2024, 6, 1, hour, 0, 0, 0, time.UTC) }
+	windows := []MaintenanceWindow{{at(10), at(12)}, {at(12), at(13)}, {at(20), at(21)}}
+	question := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}}
+	primary, fallback := &toolCaller{}, &toolCaller{}
+	provider := WithMaintenance(withModel(primary, "gpt-4o"), withModel(fallback, "claude-3-5-sonnet-latest"), windows)
+	now := at(9)
+	m := provider.(maintained)
+	m.now = func() time.Time { return now }
+	observed := Observe(m, nopObserver{})
+
+	for _, hour := range []int{9, 11, 12, 13, 20} {
+		now = at(hour)
+		_, err := GetStringResponse(observed, context.Background(), question)
+		require.NoError(t, err)
+	}
+	require.Len(t, primary.requests, 2, "the provider answers outside windows")
+	require.Len(t, fallback.requests, 3, "the fallback answers during windows")
+	assert.Equal(t, "claude-3-5-sonnet-latest", fallback.requests[0].Model)
+
+	until, withFallback, ok := Maintenance(observed, at(11))
+	assert.True(t, ok)
+	assert.True(t, withFallback)
+	assert.Equal(t, at(13), until, "windows following each other are one maintenance")
+	_, _, ok = Maintenance(observed, at(13))
+	assert.False(t, ok)
+	_, _, ok = Maintenance(primary, at(11))
+	assert.False(t, ok)
+
+	m.fallback = nil
+	now = at(20)
+	_, err := GetStringResponse(m, context.Background(), question)
+	var maintenance *MaintenanceError
+	require.True(t, errors.As(err, &maintenance), "got %v", err)
+	assert.Equal(t, at(21), maintenance.Until)
+	assert.Len(t, primary.requests, 2)
+	_, withFallback, ok = Maintenance(m, now)
+	assert.True(t, ok)
+	assert.False(t, withFallback)
+}
+
+// nopObserver observes nothing
+type nopObserver struct{}
+
+func (nopObserver) ObserveCompletion(string, time.Duration, openai.Usage, error) {}
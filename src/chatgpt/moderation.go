@@ -0,0 +1,49 @@
+package chatgpt
+
+import (
+	"context"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ModerationCategories are the categories text is flagged in by the moderation endpoint, by their API names
+var ModerationCategories = []string{
+	"hate", "hate/threatening", "self-harm", "sexual", "sexual/minors", "violence", "violence/graphic",
+}
+
+// Moderator checks whether text breaks the usage policies. *openai.Client is a Moderator.
+type Moderator interface {
+	Moderations(ctx context.Context, request openai.ModerationRequest) (openai.ModerationResponse, error)
+}
+
+// ModeratorOf returns the Moderator behind provider, false for providers that cannot moderate text
+func ModeratorOf(provider ChatProvider) (Moderator, bool) {
+	for {
+		if moderator, ok := provider.(Moderator); ok {
+			return moderator, true
+		}
+		wrapper, ok := provider.(interface{ Unwrap() ChatProvider })
+		if !ok {
+			return nil, false
+		}
+		provider = wrapper.Unwrap()
+	}
+}
+
+// Moderate returns the ModerationCategories text is flagged in, none when it breaks no policy
+func Moderate(ctx context.Context, client Moderator, text string) ([]string, error) {
+	resp, err := client.Moderations(ctx, openai.ModerationRequest{Input: text})
+	if err != nil {
+		return nil, err
+	}
+	var flagged []string
+	for _, result := range resp.Results {
+		c := result.Categories
+		for i, in := range []bool{c.Hate, c.HateThreatening, c.SelfHarm, c.Sexual, c.SexualMinors, c.Violence, c.ViolenceGraphic} {
+			if in {
+				flagged = append(flagged, ModerationCategories[i])
+			}
+		}
+	}
+	return flagged, nil
+}
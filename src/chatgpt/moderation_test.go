@@ -0,0 +1,30 @@
+package chatgpt
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModerate(t *testing.T) {
+	server := fake.NewOpenAI(0)
+	defer server.Close()
+	provider, err := NewProvider(ProviderConfig{APIKey: "sk-test", BaseURL: server.URL(), Model: "gpt-4o"})
+	require.NoError(t, err)
+	moderator, ok := ModeratorOf(provider)
+	require.True(t, ok)
+
+	flagged, err := Moderate(context.Background(), moderator, "what is go?")
+	require.NoError(t, err)
+	assert.Empty(t, flagged)
+	flagged, err = Moderate(context.Background(), moderator, "a violent and hateful question")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hate", "violence"}, flagged)
+
+	_, ok = ModeratorOf(newAnthropic(ProviderConfig{}, http.DefaultClient))
+	assert.False(t, ok)
+}
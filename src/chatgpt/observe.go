@@ -0,0 +1,44 @@
+package chatgpt
+
+import (
+	"context"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Observer is told the model, latency, token usage and error of every chat completion of an observed provider
+type Observer interface {
+	ObserveCompletion(model string, d time.Duration, usage openai.Usage, err error)
+}
+
+// Observe reports every chat completion provider makes to observer
+func Observe(provider ChatProvider, observer Observer) ChatProvider {
+	return observed{ChatProvider: provider, observer: observer}
+}
+
+// observed is a ChatProvider whose completions are reported to an Observer
+type observed struct {
+	ChatProvider
+	observer Observer
+}
+
+func (o observed) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	start := time.Now()
+	resp, err := o.ChatProvider.CreateChatCompletion(ctx, req)
+	o.observer.ObserveCompletion(req.Model, time.Since(start), resp.Usage, err)
+	return resp, err
+}
+
+// Model returns the default model of the observed provider
+func (o observed) Model() string {
+	if m, ok := o.ChatProvider.(modeler); ok {
+		return m.Model()
+	}
+	return DefaultModel
+}
+
+// Unwrap returns the observed provider
+func (o observed) Unwrap() ChatProvider {
+	return o.ChatProvider
+}
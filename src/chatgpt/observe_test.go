@@ -0,0 +1,39 @@
+package chatgpt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeProvider struct{}
+
+func (fakeProvider) CreateChatCompletion(_ context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	return openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Content: "hi"}}},
+		Usage:   openai.Usage{PromptTokens: 3, CompletionTokens: 1},
+	}, nil
+}
+
+type recorder struct {
+	model string
+	usage openai.Usage
+}
+
+func (r *recorder) ObserveCompletion(model string, _ time.Duration, usage openai.Usage, _ error) {
+	r.model, r.usage = model, usage
+}
+
+func TestObserve(t *testing.T) {
+	var r recorder
+	provider := Observe(withModel(fakeProvider{}, "llama3"), &r)
+	answer, err := GetStringResponse(provider, context.Background(), []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hello"}})
+	require.NoError(t, err)
+	assert.Equal(t, "hi", answer)
+	assert.Equal(t, "llama3", r.model, "the observed provider's default model is kept")
+	assert.Equal(t, openai.Usage{PromptTokens: 3, CompletionTokens: 1}, r.usage)
+}
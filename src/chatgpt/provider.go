@@ -0,0 +1,151 @@
+package chatgpt
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/chikamif/slackgpt/src/tracing"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ChatProvider completes chats with a language model backend. *openai.Client is a ChatProvider, other
+// backends translate to and from the OpenAI request and response types.
+type ChatProvider interface {
+	CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
+}
+
+// modeler is implemented by providers that answer with a model other than DefaultModel unless told otherwise
+type modeler interface {
+	Model() string
+}
+
+// Provider names a ChatProvider implementation
+type Provider string
+
+const (
+	ProviderOpenAI    Provider = "openai"
+	ProviderAzure     Provider = "azure"
+	ProviderAnthropic Provider = "anthropic"
+	ProviderOllama    Provider = "ollama"
+)
+
+// DefaultAnthropicModel and DefaultOllamaModel answer when those providers are not given a model
+const (
+	DefaultAnthropicModel = "claude-3-5-sonnet-20240620"
+	DefaultOllamaModel    = "llama3"
+)
+
+// ollamaBaseURL is where a local ollama serves its OpenAI compatible API
+const ollamaBaseURL = "http://localhost:11434/v1"
+
+// ProviderConfig selects and configures a ChatProvider
+type ProviderConfig struct {
+	// Provider is the backend, ProviderOpenAI when empty
+	Provider Provider
+	APIKey   string
+	// BaseURL overrides the provider's endpoint, it is required for ProviderAzure
+	BaseURL string
+	// Model answers requests that don't ask for another, the provider's default model when empty. For
+	// ProviderAzure models are deployment names unless Deployment is set.
+	Model string
+	// APIType selects Azure OpenAI with openai.APITypeAzure or, authenticating with an Entra ID token as
+	// APIKey, openai.APITypeAzureAD, even when Provider is ProviderOpenAI
+	APIType openai.APIType
+	// APIVersion overrides the Azure OpenAI API version
+	APIVersion string
+	// Deployment is the Azure OpenAI deployment answering Model
+	Deployment string
+	// Retry retries requests that are rate limited or fail with a transient server error, none when zero
+	Retry RetryPolicy
+	// Trace sends the requests' traces along with them and records every try as a span
+	Trace bool
+}
+
+// NewProvider creates the ChatProvider cfg selects
+func NewProvider(cfg ProviderConfig) (ChatProvider, error) {
+	provider := cfg.Provider
+	if (provider == ProviderOpenAI || provider == "") && (cfg.APIType == openai.APITypeAzure || cfg.APIType == openai.APITypeAzureAD) {
+		provider = ProviderAzure
+	}
+	next := http.DefaultTransport
+	if cfg.Trace {
+		next = tracing.Transport(next)
+	}
+	httpClient := retryingClient(cfg.Retry, next)
+	switch provider {
+	case ProviderOpenAI, "":
+		config := openai.DefaultConfig(cfg.APIKey)
+		config.HTTPClient = httpClient
+		if cfg.BaseURL != "" {
+			config.BaseURL = cfg.BaseURL
+		}
+		client := withBatches(openai.NewClientWithConfig(config), cfg.APIKey, config.BaseURL, httpClient)
+		return withModel(client, cfg.Model), nil
+	case ProviderAzure:
+		if cfg.BaseURL == "" {
+			return nil, fmt.Errorf("the azure provider needs the resource's endpoint as its base URL")
+		}
+		config := openai.DefaultAzureConfig(cfg.APIKey, cfg.BaseURL)
+		config.HTTPClient = httpClient
+		if cfg.APIType == openai.APITypeAzureAD {
+			config.APIType = openai.APITypeAzureAD
+		}
+		if cfg.APIVersion != "" {
+			config.APIVersion = cfg.APIVersion
+		}
+		model := cfg.Model
+		if model == "" {
+			model = DefaultModel
+		}
+		// other models are deployment names, used as they are
+		config.AzureModelMapperFunc = func(requested string) string {
+			if requested == model && cfg.Deployment != "" {
+				return cfg.Deployment
+			}
+			return requested
+		}
+		return withModel(openai.NewClientWithConfig(config), cfg.Model), nil
+	case ProviderAnthropic:
+		return newAnthropic(cfg, httpClient), nil
+	case ProviderOllama:
+		// ollama serves an OpenAI compatible API that ignores the API key
+		config := openai.DefaultConfig(cfg.APIKey)
+		config.HTTPClient = httpClient
+		config.BaseURL = ollamaBaseURL
+		if cfg.BaseURL != "" {
+			config.BaseURL = cfg.BaseURL
+		}
+		model := cfg.Model
+		if model == "" {
+			model = DefaultOllamaModel
+		}
+		return withModel(openai.NewClientWithConfig(config), model), nil
+	default:
+		return nil, fmt.Errorf("unknown chat provider %q", cfg.Provider)
+	}
+}
+
+// modelProvider is a ChatProvider with a default model other than DefaultModel
+type modelProvider struct {
+	ChatProvider
+	model string
+}
+
+// Model returns the model requests are answered with unless they ask for another
+func (p modelProvider) Model() string {
+	return p.model
+}
+
+// Unwrap returns the provider whose default model is replaced
+func (p modelProvider) Unwrap() ChatProvider {
+	return p.ChatProvider
+}
+
+// withModel makes model the default model of provider, leaving it as is when model is empty
+func withModel(provider ChatProvider, model string) ChatProvider {
+	if model == "" {
+		return provider
+	}
+	return modelProvider{ChatProvider: provider, model: model}
+}
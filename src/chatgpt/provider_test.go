@@ -0,0 +1,79 @@
+package chatgpt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewProvider(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       ProviderConfig
+		wantModel string
+		wantErr   string
+	}{
+		{"openai", ProviderConfig{APIKey: "sk-test"}, DefaultModel, ""},
+		{"openai with model", ProviderConfig{Provider: ProviderOpenAI, APIKey: "sk-test", Model: "gpt-4o"}, "gpt-4o", ""},
+		{"azure", ProviderConfig{Provider: ProviderAzure, APIKey: "key", BaseURL: "https://example.openai.azure.com", Model: "chat"}, "chat", ""},
+		{"azure without endpoint", ProviderConfig{Provider: ProviderAzure, APIKey: "key"}, "", "base URL"},
+		{"anthropic", ProviderConfig{Provider: ProviderAnthropic, APIKey: "key"}, DefaultAnthropicModel, ""},
+		{"ollama", ProviderConfig{Provider: ProviderOllama}, DefaultOllamaModel, ""},
+		{"unknown", ProviderConfig{Provider: "bard"}, "", `unknown chat provider "bard"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, err := NewProvider(tt.cfg)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			model := DefaultModel
+			if m, ok := provider.(modeler); ok {
+				model = m.Model()
+			}
+			assert.Equal(t, tt.wantModel, model)
+		})
+	}
+	// the plain openai client stays a ChatProvider
+	var _ ChatProvider = &openai.Client{}
+}
+
+func TestNewProvider_Azure(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        ProviderConfig
+		wantPath   string
+		wantQuery  string
+		wantHeader string
+		wantValue  string
+	}{
+		{"deployment", ProviderConfig{Provider: ProviderAzure, APIKey: "key", Model: "gpt-4", Deployment: "prod-gpt4"},
+			"/openai/deployments/prod-gpt4/chat/completions", "api-version=2023-05-15", "api-key", "key"},
+		{"api type", ProviderConfig{APIType: openai.APITypeAzureAD, APIKey: "token", APIVersion: "2024-02-01", Model: "chat"},
+			"/openai/deployments/chat/chat/completions", "api-version=2024-02-01", "Authorization", "Bearer token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, tt.wantPath, r.URL.Path)
+				assert.Equal(t, tt.wantQuery, r.URL.RawQuery)
+				assert.Equal(t, tt.wantValue, r.Header.Get(tt.wantHeader))
+				_, _ = w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "hi"}}]}`))
+			}))
+			defer server.Close()
+			tt.cfg.BaseURL = server.URL
+			provider, err := NewProvider(tt.cfg)
+			require.NoError(t, err)
+			answer, err := GetStringResponse(provider, context.Background(), []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hello"}})
+			require.NoError(t, err)
+			assert.Equal(t, "hi", answer)
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package chatgpt
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultRetryBaseDelay is the wait before the first retry when a RetryPolicy does not set one
+const defaultRetryBaseDelay = 500 * time.Millisecond
+
+// RetryPolicy is how requests the API rate limits or fails with a transient server error are retried
+type RetryPolicy struct {
+	// MaxRetries is how many times a request is retried, 0 does not retry
+	MaxRetries int
+	// BaseDelay is the wait before the first retry, doubled for every other retry with jitter, 500ms when 0.
+	// Rate limits saying how long to wait are waited out instead.
+	BaseDelay time.Duration
+	// MaxDelay is the longest a request waits for a retry, rate limits asking for longer are not retried
+	MaxDelay time.Duration
+}
+
+// RetryError is returned when a request was still rate limited or failed by the server after its retries
+type RetryError struct {
+	StatusCode int
+	Attempts   int
+	// RetryAfter is how long the API asked to wait before trying again, 0 when it did not say
+	RetryAfter time.Duration
+	// Message is the start of the API's last response
+	Message string
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("%d %s after %d attempts: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Attempts, e.Message)
+}
+
+// RateLimited reports whether the request was rate limited rather than failed by the server
+func (e *RetryError) RateLimited() bool {
+	return e.StatusCode == http.StatusTooManyRequests
+}
+
+// retryTransport is an http.RoundTripper retrying requests as its policy says
+type retryTransport struct {
+	next   http.RoundTripper
+	policy RetryPolicy
+	// jitter returns a random number in [0, 1)
+	jitter func() float64
+}
+
+// retryingClient returns an http.Client sending requests through next and retrying them as policy says,
+// http.DefaultClient when it retries none through http.DefaultTransport
+func retryingClient(policy RetryPolicy, next http.RoundTripper) *http.Client {
+	if policy.MaxRetries <= 0 {
+		if next == http.DefaultTransport {
+			return http.DefaultClient
+		}
+		return &http.Client{Transport: next}
+	}
+	if policy.BaseDelay <= 0 {
+		policy.BaseDelay = defaultRetryBaseDelay
+	}
+	return &http.Client{Transport: &retryTransport{next: next, policy: policy, jitter: rand.Float64}}
+}
+
+// transient reports whether a response of status may succeed when the request is sent again. 529 is Anthropic's
+// overloaded status.
+func transient(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout, 529:
+		return true
+	}
+	return false
+}
+
+// RoundTrip sends req until it gets a response that is not transient, it runs out of retries or the wait for the
+// next retry is longer than the policy allows. Requests whose body cannot be sent again are not retried.
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := t.next.RoundTrip(req)
+		if err != nil || !transient(resp.StatusCode) || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		// an exhausted quota is not lifted by waiting
+		if strings.Contains(string(message), "insufficient_quota") {
+			resp.Body = io.NopCloser(bytes.NewReader(message))
+			return resp, nil
+		}
+		after := retryAfter(resp, time.Now())
+		wait := after
+		if wait == 0 {
+			backoff := t.policy.BaseDelay << (attempt - 1)
+			wait = backoff/2 + time.Duration(t.jitter()*float64(backoff/2))
+		}
+		if attempt > t.policy.MaxRetries || (t.policy.MaxDelay > 0 && wait > t.policy.MaxDelay) {
+			return nil, &RetryError{StatusCode: resp.StatusCode, Attempts: attempt, RetryAfter: after, Message: strings.TrimSpace(string(message))}
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// retryAfter returns how long the headers of resp at now ask to wait, 0 when they don't say. Every API may send
+// Retry-After in seconds or as a date, OpenAI also sends retry-after-ms and when its rate limits reset.
+func retryAfter(resp *http.Response, now time.Time) time.Duration {
+	header := resp.Header
+	if ms, err := strconv.Atoi(header.Get("Retry-After-Ms")); err == nil && ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	if value := header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		if at, err := http.ParseTime(value); err == nil && at.After(now) {
+			return at.Sub(now)
+		}
+	}
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return 0
+	}
+	var wait time.Duration
+	for _, key := range []string{"X-Ratelimit-Reset-Requests", "X-Ratelimit-Reset-Tokens"} {
+		if reset, err := time.ParseDuration(header.Get(key)); err == nil && reset > wait {
+			wait = reset
+		}
+	}
+	return wait
+}
@@ -0,0 +1,138 @@
+package chatgpt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failing is a response the test server answers with before answering successfully
+type failing struct {
+	status int
+	header map[string]string
+	body   string
+}
+
+func TestRetry(t *testing.T) {
+	rateLimited := failing{http.StatusTooManyRequests, map[string]string{"retry-after-ms": "1"}, `{"error": {"message": "Rate limit reached", "type": "requests"}}`}
+	overloaded := failing{http.StatusServiceUnavailable, nil, `{"error": {"message": "overloaded"}}`}
+	tests := []struct {
+		name         string
+		provider     Provider
+		failures     []failing
+		wantRequests int32
+		wantErr      *RetryError
+		wantAPIError int
+	}{
+		{name: "answered", failures: nil, wantRequests: 1},
+		{name: "rate limited then overloaded", failures: []failing{rateLimited, overloaded}, wantRequests: 3},
+		{name: "anthropic overloaded", provider: ProviderAnthropic, failures: []failing{{529, nil, `{"type": "error", "error": {"type": "overloaded_error"}}`}}, wantRequests: 2},
+		{name: "out of retries", failures: []failing{rateLimited, rateLimited, rateLimited, rateLimited}, wantRequests: 3,
+			wantErr: &RetryError{StatusCode: http.StatusTooManyRequests, Attempts: 3, RetryAfter: time.Millisecond}},
+		{name: "retry after too long", failures: []failing{{http.StatusTooManyRequests, map[string]string{"retry-after": "60"}, `{}`}}, wantRequests: 1,
+			wantErr: &RetryError{StatusCode: http.StatusTooManyRequests, Attempts: 1, RetryAfter: time.Minute}},
+		{name: "rate limits reset too late", failures: []failing{{http.StatusTooManyRequests, map[string]string{"x-ratelimit-reset-tokens": "6m0s"}, `{}`}}, wantRequests: 1,
+			wantErr: &RetryError{StatusCode: http.StatusTooManyRequests, Attempts: 1, RetryAfter: 6 * time.Minute}},
+		{name: "quota exhausted", failures: []failing{{http.StatusTooManyRequests, nil, `{"error": {"message": "quota", "code": "insufficient_quota"}}`}}, wantRequests: 1,
+			wantAPIError: http.StatusTooManyRequests},
+		{name: "bad request", failures: []failing{{http.StatusBadRequest, nil, `{"error": {"message": "bad"}}`}}, wantRequests: 1,
+			wantAPIError: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]any
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&body), "the request is sent again in full")
+				n := int(requests.Add(1))
+				if n <= len(tt.failures) {
+					f := tt.failures[n-1]
+					for k, v := range f.header {
+						w.Header().Set(k, v)
+					}
+					w.WriteHeader(f.status)
+					_, _ = w.Write([]byte(f.body))
+					return
+				}
+				if tt.provider == ProviderAnthropic {
+					_, _ = w.Write([]byte(`{"content": [{"type": "text", "text": "hi"}]}`))
+					return
+				}
+				_, _ = w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "hi"}}]}`))
+			}))
+			defer server.Close()
+			provider, err := NewProvider(ProviderConfig{Provider: tt.provider, APIKey: "sk-test", BaseURL: server.URL,
+				Retry: RetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Second}})
+			require.NoError(t, err)
+
+			answer, err := GetStringResponse(provider, context.Background(), []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hello"}})
+			assert.Equal(t, tt.wantRequests, requests.Load())
+			var retryErr *RetryError
+			var apiErr *openai.APIError
+			switch {
+			case tt.wantErr != nil:
+				require.ErrorAs(t, err, &retryErr)
+				retryErr.Message = ""
+				assert.Equal(t, tt.wantErr, retryErr)
+				assert.True(t, retryErr.RateLimited())
+			case tt.wantAPIError != 0:
+				require.ErrorAs(t, err, &apiErr)
+				assert.Equal(t, tt.wantAPIError, apiErr.HTTPStatusCode)
+			default:
+				require.NoError(t, err)
+				assert.Equal(t, "hi", answer)
+			}
+		})
+	}
+}
+
+func TestRetry_Cancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	provider, err := NewProvider(ProviderConfig{APIKey: "sk-test", BaseURL: server.URL, Retry: RetryPolicy{MaxRetries: 3, MaxDelay: time.Minute}})
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = GetStringResponse(provider, ctx, []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hello"}})
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "got %v", err)
+	assert.Less(t, time.Since(start), 5*time.Second, "the wait for a retry ends with the request")
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		status int
+		header map[string]string
+		want   time.Duration
+	}{
+		{"none", http.StatusTooManyRequests, nil, 0},
+		{"milliseconds", http.StatusTooManyRequests, map[string]string{"retry-after-ms": "250", "retry-after": "1"}, 250 * time.Millisecond},
+		{"seconds", http.StatusServiceUnavailable, map[string]string{"retry-after": "3"}, 3 * time.Second},
+		{"date", http.StatusTooManyRequests, map[string]string{"retry-after": "Wed, 01 May 2024 12:00:10 GMT"}, 10 * time.Second},
+		{"limits reset", http.StatusTooManyRequests, map[string]string{"x-ratelimit-reset-requests": "1s", "x-ratelimit-reset-tokens": "6m0s"}, 6 * time.Minute},
+		{"limits reset on a server error", http.StatusInternalServerError, map[string]string{"x-ratelimit-reset-tokens": "6m0s"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+			for k, v := range tt.header {
+				resp.Header.Set(k, v)
+			}
+			assert.Equal(t, tt.want, retryAfter(resp, now))
+		})
+	}
+}
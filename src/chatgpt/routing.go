@@ -0,0 +1,148 @@
+package chatgpt
+
+import (
+	"context"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Task is the kind of request a conversation makes of the model
+type Task string
+
+const (
+	// TaskChat is a short question or conversation
+	TaskChat Task = "chat"
+	// TaskCode asks about or for code
+	TaskCode Task = "code"
+	// TaskDocument asks to analyze a long text, such as a pasted document or transcript
+	TaskDocument Task = "document"
+	// TaskSmalltalk is a greeting, thanks or chit-chat needing no knowledge, only told apart by GetTask
+	TaskSmalltalk Task = "smalltalk"
+	// TaskTools needs looking things up with tools, only told apart by GetTask
+	TaskTools Task = "tools"
+)
+
+// documentTokens is how long a question has to be to be a document to analyze rather than a chat
+const documentTokens = 1500
+
+// Route sends the requests of Task, any task when empty, whose prompt takes up at most MaxPromptTokens, any
+// size when 0, to Model
+type Route struct {
+	Name            string
+	Task            Task
+	MaxPromptTokens int
+	Model           string
+}
+
+// matches reports whether the route applies to a request of task with a prompt of tokens
+func (r Route) matches(task Task, tokens int) bool {
+	return (r.Task == "" || r.Task == task) && (r.MaxPromptTokens == 0 || tokens <= r.MaxPromptTokens)
+}
+
+// ClassifyTask returns the task of the question ending messages, as counted by count for model
+func ClassifyTask(messages []openai.ChatCompletionMessage, model string, count TokenCounter) Task {
+	if len(messages) == 0 {
+		return TaskChat
+	}
+	question := messageText(messages[len(messages)-1])
+	switch {
+	case count(model, question) >= documentTokens:
+		return TaskDocument
+	case strings.Contains(question, "```"):
+		return TaskCode
+	default:
+		return TaskChat
+	}
+}
+
+// Pick returns the first of routes matching the task and prompt size of messages, as counted by count for
+// model, and whether one did
+func Pick(routes []Route, messages []openai.ChatCompletionMessage, model string, count TokenCounter) (Route, bool) {
+	return pick(routes, ClassifyTask(messages, model, count), promptTokens(messages, model, count))
+}
+
+// pick returns the first of routes matching task and a prompt of tokens, and whether one did
+func pick(routes []Route, task Task, tokens int) (Route, bool) {
+	for _, route := range routes {
+		if route.matches(task, tokens) {
+			return route, true
+		}
+	}
+	return Route{}, false
+}
+
+// promptTokens counts the tokens messages take up, as counted by count for model
+func promptTokens(messages []openai.ChatCompletionMessage, model string, count TokenCounter) int {
+	tokens := 0
+	for _, message := range messages {
+		tokens += countMessage(count, model, message)
+	}
+	return tokens
+}
+
+// WithRoutes answers with the model of the first of routes matching the request, keeping the model of requests
+// matching none. Options after it choosing a model, such as WithModel, take precedence.
+func WithRoutes(routes []Route, count TokenCounter) Option {
+	return func(req *request) {
+		task := req.task
+		if task == "" {
+			task = ClassifyTask(req.Messages, req.Model, count)
+		}
+		route, ok := pick(routes, task, promptTokens(req.Messages, req.Model, count))
+		if ok && route.Model != "" {
+			req.Model = route.Model
+		}
+	}
+}
+
+// tasks are the tasks GetTask tells apart
+var tasks = []Task{TaskSmalltalk, TaskCode, TaskDocument, TaskTools, TaskChat}
+
+// taskPrompt asks which task the last message of a conversation is
+const taskPrompt = "Classify the user's last message in the following conversation as exactly one of: smalltalk" +
+	" (greetings, thanks or chit-chat that needs no knowledge), code (writing, reading or debugging code), document" +
+	" (analyzing a long text or questions about documents), tools (looking up people, teams or who owns what), chat" +
+	" (any other question). Reply with the category only."
+
+// maxTaskMessages and maxTaskRunes bound the part of a conversation sent to classify it
+const (
+	maxTaskMessages = 3
+	maxTaskRunes    = 1000
+)
+
+// GetTask asks the model, usually a small one chosen with WithModel, which task the last message of chat is.
+// Only the last few messages are sent, shortened, so classifying costs little. Unclear replies are TaskChat.
+func GetTask(client ChatProvider, ctx context.Context, chat []openai.ChatCompletionMessage, opts ...Option) (Task, error) {
+	var recent []openai.ChatCompletionMessage
+	for i := len(chat) - 1; i >= 0 && len(recent) < maxTaskMessages; i-- {
+		message := chat[i]
+		if message.Role == openai.ChatMessageRoleSystem {
+			continue
+		}
+		// images are left out, the text says enough about the task
+		message.Content, message.MultiContent = messageText(message), nil
+		if runes := []rune(message.Content); len(runes) > maxTaskRunes {
+			message.Content = string(runes[:maxTaskRunes]) + "…"
+		}
+		recent = append([]openai.ChatCompletionMessage{message}, recent...)
+	}
+	reply, err := describe(client, ctx, taskPrompt, recent, append(opts, WithMaxTokens(5))...)
+	if err != nil {
+		return "", err
+	}
+	reply = strings.ToLower(reply)
+	for _, task := range tasks {
+		if strings.Contains(reply, string(task)) {
+			return task, nil
+		}
+	}
+	return TaskChat, nil
+}
+
+// WithTask has WithRoutes route the request as task instead of classifying it, an empty task classifies it
+func WithTask(task Task) Option {
+	return func(req *request) {
+		req.task = task
+	}
+}
@@ -0,0 +1,126 @@
+package chatgpt
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyTask(t *testing.T) {
+	tests := []struct {
+		name     string
+		question string
+		want     Task
+	}{
+		{"chat", "what is go?", TaskChat},
+		{"code", "why does this panic?\n```\nvar m map[string]int\nm[\"a\"] = 1\n```", TaskCode},
+		{"document", "summarize this:\n" + strings.Repeat("lorem ipsum ", 600), TaskDocument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: tt.question}}
+			assert.Equal(t, tt.want, ClassifyTask(messages, "gpt-4o", EstimateTokens))
+		})
+	}
+	assert.Equal(t, TaskChat, ClassifyTask(nil, "gpt-4o", EstimateTokens))
+}
+
+func TestWithRoutes(t *testing.T) {
+	routes := []Route{
+		{Name: "code", Task: TaskCode, Model: "gpt-4o"},
+		{Name: "short chat", Task: TaskChat, MaxPromptTokens: 500, Model: "gpt-3.5-turbo"},
+		{Name: "long", Model: "gpt-4-turbo"},
+	}
+	tests := []struct {
+		name     string
+		history  string
+		question string
+		want     string
+	}{
+		{"short chat", "", "what is go?", "gpt-3.5-turbo"},
+		{"long chat", strings.Repeat("go is a language ", 200), "and rust?", "gpt-4-turbo"},
+		{"code", "", "```go\nfmt.Println()\n```", "gpt-4o"},
+		{"document", "", strings.Repeat("lorem ipsum ", 600), "gpt-4-turbo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := request{ChatCompletionRequest: openai.ChatCompletionRequest{Model: DefaultModel, Messages: []openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleSystem, Content: DefaultSystemPrompt},
+				{Role: openai.ChatMessageRoleAssistant, Content: tt.history},
+				{Role: openai.ChatMessageRoleUser, Content: tt.question},
+			}}}
+			WithRoutes(routes, EstimateTokens)(&req)
+			assert.Equal(t, tt.want, req.Model)
+		})
+	}
+
+	req := request{ChatCompletionRequest: openai.ChatCompletionRequest{Model: DefaultModel, Messages: []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: strings.Repeat("lorem ipsum ", 600)},
+	}}}
+	WithRoutes(routes[:2], EstimateTokens)(&req)
+	assert.Equal(t, DefaultModel, req.Model, "requests matching no route keep their model")
+	WithRoutes(routes, EstimateTokens)(&req)
+	WithModel("o1")(&req)
+	assert.Equal(t, "o1", req.Model, "a requested model takes precedence")
+}
+
+// taskReplier answers every request with reply, recording the last request
+type taskReplier struct {
+	reply string
+	req   openai.ChatCompletionRequest
+}
+
+func (r *taskReplier) CreateChatCompletion(_ context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	r.req = req
+	message := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: r.reply}
+	return openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{Message: message}}}, nil
+}
+
+func TestGetTask(t *testing.T) {
+	tests := []struct {
+		reply string
+		want  Task
+	}{
+		{"smalltalk", TaskSmalltalk},
+		{"Code.", TaskCode},
+		{"document", TaskDocument},
+		{"tools", TaskTools},
+		{"chat", TaskChat},
+		{"I am not sure", TaskChat},
+	}
+	chat := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: DefaultSystemPrompt},
+		{Role: openai.ChatMessageRoleUser, Content: "first"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "second"},
+		{Role: openai.ChatMessageRoleUser, Content: "third"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "fourth"},
+		{Role: openai.ChatMessageRoleUser, Content: strings.Repeat("a", 2000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.reply, func(t *testing.T) {
+			client := &taskReplier{reply: tt.reply}
+			task, err := GetTask(client, context.Background(), chat, WithModel("gpt-4o-mini"))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, task)
+			assert.Equal(t, "gpt-4o-mini", client.req.Model)
+			transcript := client.req.Messages[len(client.req.Messages)-1].Content
+			assert.NotContains(t, transcript, "second", "only the last messages are classified")
+			assert.Contains(t, transcript, "third")
+			assert.Contains(t, transcript, strings.Repeat("a", maxTaskRunes)+"…")
+		})
+	}
+}
+
+func TestWithTask(t *testing.T) {
+	routes := []Route{{Name: "smalltalk", Task: TaskSmalltalk, Model: "gpt-4o-mini"}, {Name: "code", Task: TaskCode, Model: "gpt-4o"}}
+	req := request{ChatCompletionRequest: openai.ChatCompletionRequest{Model: DefaultModel, Messages: []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "```go\nfmt.Println()\n```"},
+	}}}
+	WithTask(TaskSmalltalk)(&req)
+	WithRoutes(routes, EstimateTokens)(&req)
+	assert.Equal(t, "gpt-4o-mini", req.Model, "a task given is not classified again")
+}
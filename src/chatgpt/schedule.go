@@ -0,0 +1,49 @@
+package chatgpt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ScheduleDraft is a message the model drafted for a user to post later: the ID of the channel to post it in,
+// when, as 2006-01-02T15:04 in the user's time zone, and the message. Fields the request did not say are empty.
+type ScheduleDraft struct {
+	Channel string `json:"channel"`
+	Time    string `json:"time"`
+	Message string `json:"message"`
+}
+
+// ScheduleTimeLayout is the layout of ScheduleDraft.Time
+const ScheduleTimeLayout = "2006-01-02T15:04"
+
+// schedulePrompt asks the model to draft a message to post later, as a JSON object
+const schedulePrompt = "You help a Slack user draft a message and schedule it. It is now %s in their time zone." +
+	" From their request, reply with a JSON object only, of the form {\"channel\": <the ID of the channel to post" +
+	" in, C0123ABCD in a mention like <#C0123ABCD|general>>, \"time\": <when to post it, as YYYY-MM-DDTHH:MM in" +
+	" their time zone>, \"message\": <the message to post, drafted as they asked, in Slack mrkdwn>}. Use an" +
+	" empty string for anything the request does not say, never make a channel or time up."
+
+// GetScheduleDraft asks the model to draft the message request asks to post later, now being the time in the
+// user's time zone
+func GetScheduleDraft(client ChatProvider, ctx context.Context, request string, now time.Time) (ScheduleDraft, error) {
+	if strings.TrimSpace(request) == "" {
+		return ScheduleDraft{}, ErrorEmptyPrompt
+	}
+	reply, err := complete(client, ctx, []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: fmt.Sprintf(schedulePrompt, now.Format("Monday, January 2 2006, 15:04 MST"))},
+		{Role: openai.ChatMessageRoleUser, Content: request},
+	})
+	if err != nil {
+		return ScheduleDraft{}, err
+	}
+	var draft ScheduleDraft
+	if !decodeJSONObject(reply, &draft) {
+		return ScheduleDraft{}, fmt.Errorf("the model did not reply with a draft: %q", reply)
+	}
+	draft.Channel, draft.Time, draft.Message = strings.TrimSpace(draft.Channel), strings.TrimSpace(draft.Time), strings.TrimSpace(draft.Message)
+	return draft, nil
+}
@@ -0,0 +1,35 @@
+package chatgpt
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetScheduleDraft(t *testing.T) {
+	now := time.Date(2024, 6, 3, 14, 0, 0, 0, time.UTC)
+	tests := []struct {
+		reply   string
+		want    ScheduleDraft
+		wantErr bool
+	}{
+		{"```json\n{\"channel\": \" C0ANN \", \"time\": \"2024-06-10T09:00\", \"message\": \"We ship v2 today! :rocket:\"}\n```",
+			ScheduleDraft{Channel: "C0ANN", Time: "2024-06-10T09:00", Message: "We ship v2 today! :rocket:"}, false},
+		{`{"channel": "", "time": "2024-06-10T09:00", "message": "hi"}`, ScheduleDraft{Time: "2024-06-10T09:00", Message: "hi"}, false},
+		{"Which channel?", ScheduleDraft{}, true},
+	}
+	for _, tt := range tests {
+		draft, err := GetScheduleDraft(replier(tt.reply), context.Background(), "post hi to #announcements monday 9am", now)
+		if tt.wantErr {
+			assert.Error(t, err, tt.reply)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, draft, tt.reply)
+	}
+	_, err := GetScheduleDraft(replier("{}"), context.Background(), " ", now)
+	assert.ErrorIs(t, err, ErrorEmptyPrompt)
+}
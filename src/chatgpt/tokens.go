@@ -0,0 +1,212 @@
+package chatgpt
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// TokenCounter counts the tokens text takes up in a request to model
+type TokenCounter func(model, text string) int
+
+// EstimateTokens counts about four bytes of text per token, close enough for English when no tokenizer is loaded
+func EstimateTokens(_, text string) int {
+	return (len(text) + 3) / 4
+}
+
+// tokenizers is the counter NewTiktokenCounter loaded, or why it could not, once per process
+var tokenizers struct {
+	once    sync.Once
+	counter TokenCounter
+	err     error
+}
+
+// NewTiktokenCounter counts tokens with the tokenizers of OpenAI's chat models: o200k_base for the gpt-4o and
+// o-series models, cl100k_base for the rest. Models of other providers are counted as cl100k_base, which is
+// close. The tokenizers are loaded once per process, downloaded unless they are cached in TIKTOKEN_CACHE_DIR,
+// giving up when ctx is done; later calls return the same counter or error.
+func NewTiktokenCounter(ctx context.Context) (TokenCounter, error) {
+	tokenizers.once.Do(func() {
+		tiktoken.SetBpeLoader(bpeLoader{ctx: ctx})
+		tokenizers.counter, tokenizers.err = loadTiktokenCounter()
+	})
+	return tokenizers.counter, tokenizers.err
+}
+
+// loadTiktokenCounter loads the tokenizers of NewTiktokenCounter
+func loadTiktokenCounter() (TokenCounter, error) {
+	cl100k, err := tiktoken.GetEncoding(tiktoken.MODEL_CL100K_BASE)
+	if err != nil {
+		return nil, fmt.Errorf("loading cl100k_base: %w", err)
+	}
+	o200k, err := tiktoken.GetEncoding(tiktoken.MODEL_O200K_BASE)
+	if err != nil {
+		return nil, fmt.Errorf("loading o200k_base: %w", err)
+	}
+	return func(model, text string) int {
+		if strings.HasPrefix(model, "gpt-4o") || len(model) > 1 && model[0] == 'o' && model[1] >= '0' && model[1] <= '9' {
+			return len(o200k.EncodeOrdinary(text))
+		}
+		return len(cl100k.EncodeOrdinary(text))
+	}, nil
+}
+
+// bpeLoader loads the ranks of tiktoken's BPE files as tiktoken's own loader does, from the same cache, but
+// downloads them with ctx rather than without a timeout
+type bpeLoader struct {
+	ctx context.Context
+}
+
+func (l bpeLoader) LoadTiktokenBpe(url string) (map[string]int, error) {
+	contents, err := l.read(url)
+	if err != nil {
+		return nil, err
+	}
+	ranks := make(map[string]int)
+	for _, line := range strings.Split(string(contents), "\n") {
+		if line == "" {
+			continue
+		}
+		encoded, rank, _ := strings.Cut(line, " ")
+		token, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", url, err)
+		}
+		if ranks[string(token)], err = strconv.Atoi(rank); err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", url, err)
+		}
+	}
+	return ranks, nil
+}
+
+// read returns the BPE file at url from the cache, downloading and caching it when it is not there yet
+func (l bpeLoader) read(url string) ([]byte, error) {
+	cacheDir := os.Getenv("TIKTOKEN_CACHE_DIR")
+	if cacheDir == "" {
+		cacheDir = filepath.Join(os.TempDir(), "data-gym-cache")
+	}
+	cachePath := filepath.Join(cacheDir, fmt.Sprintf("%x", sha1.Sum([]byte(url))))
+	if contents, err := os.ReadFile(cachePath); err == nil {
+		return contents, nil
+	}
+	req, err := http.NewRequestWithContext(l.ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading %s: %s", url, resp.Status)
+	}
+	contents, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	// a cache that cannot be written only costs a download on the next start
+	if err := os.MkdirAll(cacheDir, 0o755); err == nil {
+		if tmp, err := os.CreateTemp(cacheDir, filepath.Base(cachePath)+".*.tmp"); err == nil {
+			_, err = tmp.Write(contents)
+			if closeErr := tmp.Close(); err == nil && closeErr == nil {
+				_ = os.Rename(tmp.Name(), cachePath)
+			}
+			_ = os.Remove(tmp.Name())
+		}
+	}
+	return contents, nil
+}
+
+// contextWindows are the context windows of models by name prefix, longest prefixes first
+var contextWindows = []struct {
+	prefix string
+	tokens int
+}{
+	{"gpt-3.5-turbo-instruct", 4096},
+	{"gpt-3.5-turbo", 16385},
+	{"gpt-4-32k", 32768},
+	{"gpt-4-0314", 8192},
+	{"gpt-4-0613", 8192},
+	{"gpt-4-", 128000},
+	{"gpt-4o", 128000},
+	{"gpt-4", 8192},
+	{"o1", 128000},
+	{"claude", 200000},
+}
+
+// defaultContextWindow is assumed for models missing from contextWindows
+const defaultContextWindow = 8192
+
+// ContextWindow is how many tokens the prompt and answer of a request to model may take up together
+func ContextWindow(model string) int {
+	for _, window := range contextWindows {
+		if strings.HasPrefix(model, window.prefix) {
+			return window.tokens
+		}
+	}
+	return defaultContextWindow
+}
+
+// WithTokenLimit leaves out the oldest messages of the conversation, but not its system messages or the question,
+// until the request takes up at most limit tokens with its answer, as counted by count. A limit of 0 is the
+// context window of the requested model.
+func WithTokenLimit(limit int, count TokenCounter) Option {
+	return func(req *request) {
+		req.tokenLimit, req.countTokens = limit, count
+	}
+}
+
+// countMessage counts the tokens of message, with the few every message takes up on top of its content
+func countMessage(count TokenCounter, model string, message openai.ChatCompletionMessage) int {
+	tokens := 3 + count(model, message.Role) + count(model, messageText(message))
+	for _, part := range message.MultiContent {
+		if part.Type == openai.ChatMessagePartTypeImageURL {
+			tokens += imageTokens
+		}
+	}
+	if message.Name != "" {
+		tokens += 1 + count(model, message.Name)
+	}
+	return tokens
+}
+
+// truncate leaves out the oldest messages that are not system messages, keeping the last message, until the
+// request fits its token limit
+func (req *request) truncate() {
+	if req.countTokens == nil {
+		return
+	}
+	limit := req.tokenLimit
+	if limit == 0 {
+		limit = ContextWindow(req.Model)
+	}
+	// every answer is primed with a few tokens
+	tokens := 3 + req.MaxTokens
+	for _, message := range req.Messages {
+		tokens += countMessage(req.countTokens, req.Model, message)
+	}
+	if tokens <= limit {
+		return
+	}
+	kept := make([]openai.ChatCompletionMessage, 0, len(req.Messages))
+	for i, message := range req.Messages {
+		if tokens > limit && message.Role != openai.ChatMessageRoleSystem && i < len(req.Messages)-1 {
+			tokens -= countMessage(req.countTokens, req.Model, message)
+			continue
+		}
+		kept = append(kept, message)
+	}
+	req.Messages = kept
+}
@@ -0,0 +1,106 @@
+package chatgpt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContextWindow(t *testing.T) {
+	tests := []struct {
+		model string
+		want  int
+	}{
+		{openai.GPT3Dot5Turbo, 16385},
+		{openai.GPT3Dot5TurboInstruct, 4096},
+		{openai.GPT4, 8192},
+		{openai.GPT40613, 8192},
+		{openai.GPT432K, 32768},
+		{openai.GPT4Turbo1106, 128000},
+		{"gpt-4o-mini", 128000},
+		{"claude-3-5-sonnet-20240620", 200000},
+		{"llama3", defaultContextWindow},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, ContextWindow(tt.model), tt.model)
+	}
+}
+
+func TestWithTokenLimit(t *testing.T) {
+	// every word is a token
+	words := func(_, text string) int { return len(strings.Fields(text)) }
+	message := func(role, content string) openai.ChatCompletionMessage {
+		return openai.ChatCompletionMessage{Role: role, Content: content}
+	}
+	chat := []openai.ChatCompletionMessage{
+		message(openai.ChatMessageRoleSystem, "be brief"),
+		message(openai.ChatMessageRoleUser, "one two three four"),
+		message(openai.ChatMessageRoleAssistant, "five six"),
+		message(openai.ChatMessageRoleSystem, "rate it"),
+		message(openai.ChatMessageRoleUser, "seven"),
+	}
+	// each message counts 3 tokens and its role on top of its words, and the answer 3 and MaxTokens
+	tests := []struct {
+		name  string
+		limit int
+		want  []openai.ChatCompletionMessage
+	}{
+		{"fits", 36, chat},
+		{"oldest left out", 35, []openai.ChatCompletionMessage{chat[0], chat[2], chat[3], chat[4]}},
+		{"system messages and question kept", 1, []openai.ChatCompletionMessage{chat[0], chat[3], chat[4]}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := request{ChatCompletionRequest: openai.ChatCompletionRequest{Model: openai.GPT4, Messages: chat, MaxTokens: 2}}
+			WithTokenLimit(tt.limit, words)(&req)
+			req.truncate()
+			assert.Equal(t, tt.want, req.Messages)
+		})
+	}
+
+	long := []openai.ChatCompletionMessage{message(openai.ChatMessageRoleUser, strings.Repeat("word ", 9000)), message(openai.ChatMessageRoleUser, "hi")}
+	req := request{ChatCompletionRequest: openai.ChatCompletionRequest{Model: openai.GPT4, Messages: long}}
+	WithTokenLimit(0, words)(&req)
+	req.truncate()
+	assert.Len(t, req.Messages, 1, "0 is the model's context window")
+	req = request{ChatCompletionRequest: openai.ChatCompletionRequest{Model: openai.GPT4Turbo1106, Messages: long}}
+	WithTokenLimit(0, words)(&req)
+	req.truncate()
+	assert.Len(t, req.Messages, 2)
+}
+
+func TestEstimateTokens(t *testing.T) {
+	assert.Equal(t, 0, EstimateTokens("", ""))
+	assert.Equal(t, 3, EstimateTokens("", "hello world"))
+}
+
+func TestBpeLoader(t *testing.T) {
+	t.Setenv("TIKTOKEN_CACHE_DIR", t.TempDir())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("YQ== 0\nYg== 1\n"))
+	}))
+	url := server.URL + "/test.tiktoken"
+	ranks, err := bpeLoader{ctx: context.Background()}.LoadTiktokenBpe(url)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"a": 0, "b": 1}, ranks)
+	server.Close()
+	ranks, err = bpeLoader{ctx: context.Background()}.LoadTiktokenBpe(url)
+	require.NoError(t, err, "downloaded files are cached")
+	assert.Equal(t, map[string]int{"a": 0, "b": 1}, ranks)
+
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer hanging.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = bpeLoader{ctx: ctx}.LoadTiktokenBpe(hanging.URL + "/test.tiktoken")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,125 @@
+package chatgpt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sync"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// maxToolRounds is how many completions may be requested for one answer before the model has to answer without
+// calling more tools
+const maxToolRounds = 5
+
+// Tool is a function the model may call while answering, e.g. to look something up
+type Tool struct {
+	// Definition names and describes the function and its JSON schema parameters to the model
+	Definition openai.FunctionDefinition
+	// Call runs the function with the JSON arguments the model chose, its result or error is shown to the model
+	Call func(ctx context.Context, arguments string) (string, error)
+}
+
+// toolName matches the names OpenAI accepts for functions
+var toolName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// Func is a tool running call with the JSON arguments the model chose decoded into A, described to the model by
+// parameters, the JSON schema of A
+func Func[A any](name, description string, parameters any, call func(ctx context.Context, args A) (string, error)) Tool {
+	return Tool{
+		Definition: openai.FunctionDefinition{Name: name, Description: description, Parameters: parameters},
+		Call: func(ctx context.Context, arguments string) (string, error) {
+			var args A
+			if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+				return "", fmt.Errorf("arguments do not match the parameters of %s: %w", name, err)
+			}
+			return call(ctx, args)
+		},
+	}
+}
+
+// Toolbox holds the tools registered for the model to call, in the order they were registered. It is safe for
+// concurrent use.
+type Toolbox struct {
+	mu    sync.RWMutex
+	tools []Tool
+	names map[string]bool
+}
+
+// NewToolbox creates a toolbox holding tools, failing when one cannot be registered
+func NewToolbox(tools ...Tool) (*Toolbox, error) {
+	t := &Toolbox{names: map[string]bool{}}
+	for _, tool := range tools {
+		if err := t.Register(tool); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Register adds tool to the toolbox. Its name must be one OpenAI accepts and not yet registered.
+func (t *Toolbox) Register(tool Tool) error {
+	name := tool.Definition.Name
+	if !toolName.MatchString(name) {
+		return fmt.Errorf("tool name %q must be 1 to 64 letters, digits, underscores or dashes", name)
+	}
+	if tool.Call == nil {
+		return fmt.Errorf("tool %s has nothing to call", name)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.names[name] {
+		return fmt.Errorf("tool %s is registered already", name)
+	}
+	t.names[name] = true
+	t.tools = append(t.tools, tool)
+	return nil
+}
+
+// Tools returns the registered tools
+func (t *Toolbox) Tools() []Tool {
+	if t == nil {
+		return nil
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return append([]Tool(nil), t.tools...)
+}
+
+// Names returns the names of the registered tools
+func (t *Toolbox) Names() []string {
+	tools := t.Tools()
+	names := make([]string, len(tools))
+	for i, tool := range tools {
+		names[i] = tool.Definition.Name
+	}
+	return names
+}
+
+// WithTools lets the model call tools while answering. Providers that do not support tools answer without them.
+func WithTools(tools ...Tool) Option {
+	return func(req *request) {
+		if req.tools == nil {
+			req.tools = make(map[string]Tool, len(tools))
+		}
+		for _, tool := range tools {
+			req.tools[tool.Definition.Name] = tool
+			req.Tools = append(req.Tools, openai.Tool{Type: openai.ToolTypeFunction, Function: tool.Definition})
+		}
+	}
+}
+
+// call runs the tool the model asked for and returns what to show the model
+func (req *request) call(ctx context.Context, call openai.ToolCall) string {
+	tool, ok := req.tools[call.Function.Name]
+	if !ok {
+		return "error: there is no tool named " + call.Function.Name
+	}
+	result, err := tool.Call(ctx, call.Function.Arguments)
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return result
+}
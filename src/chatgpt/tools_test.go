@@ -0,0 +1,100 @@
+package chatgpt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// toolCaller asks for the tool calls in calls, one round at a time, then answers with the tool results it got
+type toolCaller struct {
+	calls    [][]openai.ToolCall
+	requests []openai.ChatCompletionRequest
+}
+
+func (p *toolCaller) CreateChatCompletion(_ context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	p.requests = append(p.requests, req)
+	round := len(p.requests) - 1
+	message := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant}
+	if round < len(p.calls) && req.ToolChoice != "none" {
+		message.ToolCalls = p.calls[round]
+	} else {
+		var results []string
+		for _, m := range req.Messages {
+			if m.Role == openai.ChatMessageRoleTool {
+				results = append(results, m.ToolCallID+"="+m.Content)
+			}
+		}
+		message.Content = strings.Join(results, ", ")
+	}
+	return openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{Message: message}}}, nil
+}
+
+func toolCall(id, name, arguments string) openai.ToolCall {
+	return openai.ToolCall{ID: id, Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: name, Arguments: arguments}}
+}
+
+func TestWithTools(t *testing.T) {
+	echo := Tool{
+		Definition: openai.FunctionDefinition{Name: "echo", Description: "echoes its arguments"},
+		Call: func(_ context.Context, arguments string) (string, error) {
+			if arguments == "{}" {
+				return "", errors.New("nothing to echo")
+			}
+			return arguments, nil
+		},
+	}
+	question := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}}
+
+	provider := &toolCaller{calls: [][]openai.ToolCall{
+		{toolCall("1", "echo", `{"a":1}`), toolCall("2", "missing", `{}`)},
+		{toolCall("3", "echo", `{}`)},
+	}}
+	answer, err := GetStringResponse(provider, context.Background(), question, WithTools(echo))
+	require.NoError(t, err)
+	assert.Equal(t, `1={"a":1}, 2=error: there is no tool named missing, 3=error: nothing to echo`, answer)
+	require.Len(t, provider.requests, 3)
+	assert.Equal(t, []openai.Tool{{Type: openai.ToolTypeFunction, Function: echo.Definition}}, provider.requests[0].Tools)
+	assert.Len(t, provider.requests[0].Messages, 2, "the caller's messages are not changed")
+	assert.Len(t, provider.requests[2].Messages, 7)
+
+	endless := make([][]openai.ToolCall, 10)
+	for i := range endless {
+		endless[i] = []openai.ToolCall{toolCall(fmt.Sprint(i), "echo", `"again"`)}
+	}
+	provider = &toolCaller{calls: endless}
+	_, err = GetStringResponse(provider, context.Background(), question, WithTools(echo))
+	require.NoError(t, err)
+	assert.Len(t, provider.requests, maxToolRounds, "the model has to answer after maxToolRounds")
+
+	provider = &toolCaller{calls: [][]openai.ToolCall{{toolCall("1", "echo", `{}`)}}}
+	answer, err = GetStringResponse(provider, context.Background(), question)
+	require.NoError(t, err)
+	assert.Equal(t, "", answer, "tool calls are ignored without tools")
+	assert.Len(t, provider.requests, 1)
+}
+
+func TestToolbox(t *testing.T) {
+	greet := Func("greet", "greets someone", map[string]any{"type": "object"},
+		func(_ context.Context, args struct{ Name string }) (string, error) { return "hello " + args.Name, nil })
+	box, err := NewToolbox(greet)
+	require.NoError(t, err)
+	assert.ErrorContains(t, box.Register(greet), "registered already")
+	assert.ErrorContains(t, box.Register(Tool{Definition: openai.FunctionDefinition{Name: "no spaces"}, Call: greet.Call}), "must be 1 to 64")
+	assert.ErrorContains(t, box.Register(Tool{Definition: openai.FunctionDefinition{Name: "nothing"}}), "nothing to call")
+	assert.Equal(t, []string{"greet"}, box.Names())
+	var none *Toolbox
+	assert.Empty(t, none.Tools())
+
+	provider := &toolCaller{calls: [][]openai.ToolCall{{toolCall("1", "greet", `{"name":"gopher"}`), toolCall("2", "greet", `"gopher"`)}}}
+	question := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}}
+	answer, err := GetStringResponse(provider, context.Background(), question, WithTools(box.Tools()...))
+	require.NoError(t, err)
+	assert.Contains(t, answer, "1=hello gopher, 2=error: arguments do not match the parameters of greet")
+}
@@ -0,0 +1,50 @@
+package chatgpt
+
+import (
+	"context"
+
+	"github.com/chikamif/slackgpt/src/tracing"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Trace records every chat completion provider makes as a span under the span of its context, if any
+func Trace(provider ChatProvider) ChatProvider {
+	return traced{provider}
+}
+
+// traced is a ChatProvider whose completions are traced
+type traced struct {
+	ChatProvider
+}
+
+func (t traced) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	ctx, span := tracing.Start(ctx, "chat "+req.Model, tracing.SpanKindClient,
+		tracing.String("gen_ai.operation.name", "chat"),
+		tracing.String("gen_ai.request.model", req.Model),
+		tracing.Int("gen_ai.request.messages", len(req.Messages)),
+	)
+	defer span.End()
+	resp, err := t.ChatProvider.CreateChatCompletion(ctx, req)
+	span.RecordError(err)
+	if err == nil {
+		span.SetAttributes(
+			tracing.String("gen_ai.response.model", resp.Model),
+			tracing.Int("gen_ai.usage.input_tokens", resp.Usage.PromptTokens),
+			tracing.Int("gen_ai.usage.output_tokens", resp.Usage.CompletionTokens),
+		)
+	}
+	return resp, err
+}
+
+// Model returns the default model of the traced provider
+func (t traced) Model() string {
+	if m, ok := t.ChatProvider.(modeler); ok {
+		return m.Model()
+	}
+	return DefaultModel
+}
+
+// Unwrap returns the traced provider
+func (t traced) Unwrap() ChatProvider {
+	return t.ChatProvider
+}
@@ -0,0 +1,48 @@
+package chatgpt
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/chikamif/slackgpt/src/tracing"
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrace(t *testing.T) {
+	collector := fake.NewCollector()
+	defer collector.Close()
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Model:   "gpt-4o",
+			Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Content: "hi"}}},
+		})
+	}))
+	defer server.Close()
+	provider, err := NewProvider(ProviderConfig{APIKey: "sk-test", BaseURL: server.URL + "/v1", Model: "gpt-4o", Trace: true})
+	require.NoError(t, err)
+	tracer, err := tracing.New(tracing.Options{Endpoint: collector.URL(), SampleRatio: 1, Interval: time.Hour})
+	require.NoError(t, err)
+	ctx, span := tracer.Start(context.Background(), "slack app_mention", tracing.SpanKindServer)
+
+	answer, err := GetStringResponse(Trace(provider), ctx, []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hello"}})
+	require.NoError(t, err)
+	assert.Equal(t, "hi", answer)
+	span.End()
+	require.NoError(t, tracer.Shutdown(context.Background()))
+	assert.Contains(t, traceparent, span.TraceID(), "the trace is sent along with the request")
+	var names []string
+	for _, span := range collector.Spans() {
+		names = append(names, span.Name)
+	}
+	assert.Equal(t, []string{"POST /v1/chat/completions", "chat gpt-4o", "slack app_mention"}, names)
+}
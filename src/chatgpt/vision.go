@@ -0,0 +1,64 @@
+package chatgpt
+
+import (
+	"encoding/base64"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// DefaultVisionModel looks at the images attached to questions
+const DefaultVisionModel = "gpt-4o"
+
+// imageTokens is about what an image costs a vision model at high detail, images are counted as this many
+// tokens when conversations are truncated
+const imageTokens = 765
+
+// Attachment is an image attached to a question, MIMEType says what kind of image Data is, e.g. image/png
+type Attachment struct {
+	MIMEType string
+	Data     []byte
+}
+
+// dataURL returns the attachment inlined as a base64 data URL
+func (a Attachment) dataURL() string {
+	return "data:" + a.MIMEType + ";base64," + base64.StdEncoding.EncodeToString(a.Data)
+}
+
+// WithImages attaches images to the last message of the conversation as image content parts, for models
+// that can see them. The message's text is kept as the first part.
+func WithImages(images ...Attachment) Option {
+	return func(req *request) {
+		if len(images) == 0 || len(req.Messages) == 0 {
+			return
+		}
+		messages := append([]openai.ChatCompletionMessage(nil), req.Messages...)
+		last := &messages[len(messages)-1]
+		parts := append([]openai.ChatMessagePart(nil), last.MultiContent...)
+		if last.Content != "" {
+			parts = append(parts, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: last.Content})
+		}
+		for _, image := range images {
+			parts = append(parts, openai.ChatMessagePart{
+				Type:     openai.ChatMessagePartTypeImageURL,
+				ImageURL: &openai.ChatMessageImageURL{URL: image.dataURL(), Detail: openai.ImageURLDetailAuto},
+			})
+		}
+		last.Content, last.MultiContent = "", parts
+		req.Messages = messages
+	}
+}
+
+// messageText returns the text of message, joining the text parts of messages with several content parts
+func messageText(message openai.ChatCompletionMessage) string {
+	if len(message.MultiContent) == 0 {
+		return message.Content
+	}
+	var texts []string
+	for _, part := range message.MultiContent {
+		if part.Type == openai.ChatMessagePartTypeText {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
@@ -0,0 +1,34 @@
+package chatgpt
+
+import (
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithImages(t *testing.T) {
+	chat := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: "be brief"},
+		{Role: openai.ChatMessageRoleUser, Content: "what's in this screenshot?"},
+	}
+	req := request{ChatCompletionRequest: openai.ChatCompletionRequest{Messages: chat}}
+	WithImages(Attachment{MIMEType: "image/png", Data: []byte("png")})(&req)
+
+	assert.Equal(t, "what's in this screenshot?", chat[1].Content, "the caller's conversation is left as it is")
+	question := req.Messages[1]
+	assert.Empty(t, question.Content)
+	require.Len(t, question.MultiContent, 2)
+	assert.Equal(t, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: "what's in this screenshot?"}, question.MultiContent[0])
+	assert.Equal(t, "data:image/png;base64,cG5n", question.MultiContent[1].ImageURL.URL)
+	assert.Equal(t, "what's in this screenshot?", messageText(question))
+
+	words := func(_, text string) int { return len(strings.Fields(text)) }
+	assert.Equal(t, 3+1+4+imageTokens, countMessage(words, DefaultVisionModel, question), "images are counted on top of the text")
+
+	req = request{ChatCompletionRequest: openai.ChatCompletionRequest{Messages: chat}}
+	WithImages()(&req)
+	assert.Equal(t, chat, req.Messages, "no images leave the question as it is")
+}
@@ -0,0 +1,297 @@
+// Package command parses the text of slash commands into subcommands, flags and arguments, and generates
+// their help, so every command has the same syntax
+package command
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Flag is a flag of a command, given as --Name or -Short. Flags with a Value take one, as --name value or
+// --name=value, the others are switches.
+type Flag struct {
+	Name string
+	// Short is a single letter, none when empty
+	Short string
+	// Value names the flag's value in help, e.g. "model"
+	Value string
+	Usage string
+}
+
+// Command is a command or subcommand. Flags come before the arguments, which Args describes in help,
+// e.g. "<question>".
+type Command struct {
+	Name        string
+	Args        string
+	Summary     string
+	Flags       []Flag
+	Subcommands []*Command
+}
+
+// Invocation is the text of a command parsed
+type Invocation struct {
+	// Command is the command or subcommand invoked, and Path the names leading to it
+	Command *Command
+	Path    []string
+	// Args are the arguments after the flags with their quotes removed, Rest the same text as it was typed
+	Args []string
+	Rest string
+	// Help is set when help was asked for with --help, or with help for commands with subcommands
+	Help  bool
+	flags map[string]string
+}
+
+// Has reports whether the flag named name was given
+func (inv Invocation) Has(name string) bool {
+	_, ok := inv.flags[name]
+	return ok
+}
+
+// Value returns the value of the flag named name, empty when it was not given
+func (inv Invocation) Value(name string) string {
+	return inv.flags[name]
+}
+
+// UsageText returns the help of the command invoked
+func (inv Invocation) UsageText() string {
+	return inv.Command.help(strings.Join(inv.Path, " "))
+}
+
+// Parse parses text as the arguments of cmd. Subcommands and flags are read until the first argument or --,
+// the error names the flag or subcommand that is wrong and the Invocation the command it was given to.
+func Parse(cmd *Command, text string) (Invocation, error) {
+	return Aliases(nil).Parse(cmd, text)
+}
+
+// Aliases are other names for subcommands and keywords, such as localized ones, by the name they stand for,
+// e.g. "要約": "summarize". An alias stands for that name at every level of a command it is a subcommand at.
+type Aliases map[string]string
+
+// name returns the name word stands for, word itself when it is no alias
+func (a Aliases) name(word string) string {
+	for alias, name := range a {
+		if strings.EqualFold(alias, word) {
+			return name
+		}
+	}
+	return word
+}
+
+// Parse is Parse with the subcommands of cmd and help also given by their aliases
+func (a Aliases) Parse(cmd *Command, text string) (Invocation, error) {
+	inv := Invocation{Command: cmd, Path: []string{cmd.Name}, flags: map[string]string{}}
+	rest := text
+	for {
+		token, after, ok := next(rest)
+		if !ok {
+			inv.Rest = ""
+			return inv, nil
+		}
+		switch name, value, isFlag := parseFlag(token); {
+		case token == "--":
+			rest = after
+		case isFlag && (name == "help" || name == "h"):
+			inv.Help = true
+			rest = after
+			continue
+		case isFlag:
+			flag, found := inv.Command.flag(name)
+			if !found {
+				return inv, fmt.Errorf("unknown flag `%s`", token)
+			}
+			switch {
+			case flag.Value == "" && value != "":
+				return inv, fmt.Errorf("flag `--%s` takes no value", flag.Name)
+			case flag.Value != "" && value == "" && !strings.Contains(token, "="):
+				if value, after, ok = next(after); !ok {
+					return inv, fmt.Errorf("flag `--%s` needs a %s", flag.Name, flag.Value)
+				}
+			}
+			inv.flags[flag.Name] = unquote(value)
+			rest = after
+			continue
+		case len(inv.Command.Subcommands) > 0:
+			if strings.EqualFold(a.name(token), "help") {
+				inv.Help = true
+				rest = after
+				continue
+			}
+			sub := inv.Command.subcommand(a.name(token))
+			if sub == nil {
+				return inv, fmt.Errorf("unknown subcommand `%s`", token)
+			}
+			inv.Command, inv.Path = sub, append(inv.Path, sub.Name)
+			rest = after
+			continue
+		}
+		break
+	}
+	inv.Rest = strings.TrimSpace(rest)
+	inv.Args = Split(inv.Rest)
+	return inv, nil
+}
+
+// Rewrite replaces the aliases of the subcommands of cmd leading text with their names, descending into the
+// subcommands they name, so that text typed with localized keywords matches the patterns of the keywords. The
+// subcommands typed by their names and the rest of text are left as they are.
+func (a Aliases) Rewrite(cmd *Command, text string) string {
+	var b strings.Builder
+	rest := text
+	for len(a) > 0 {
+		token, after, ok := next(rest)
+		if !ok {
+			break
+		}
+		name := a.name(token)
+		sub := cmd.subcommand(name)
+		if sub == nil {
+			break
+		}
+		b.WriteString(rest[:len(rest)-len(after)-len(token)])
+		if name != token {
+			token = sub.Name
+		}
+		b.WriteString(token)
+		cmd, rest = sub, after
+	}
+	return b.String() + rest
+}
+
+// parseFlag splits a token of the form --name, --name=value or -x into the flag's name and value, isFlag is
+// false for other tokens such as -5 or a word that happens to start with a dash
+func parseFlag(token string) (name, value string, isFlag bool) {
+	if long, ok := strings.CutPrefix(token, "--"); ok && long != "" {
+		name, value, _ = strings.Cut(long, "=")
+		return name, value, true
+	}
+	if short, ok := strings.CutPrefix(token, "-"); ok && utf8.RuneCountInString(short) == 1 && unicode.IsLetter([]rune(short)[0]) {
+		return short, "", true
+	}
+	return "", "", false
+}
+
+// flag returns the flag of c named name, by its long or short name
+func (c *Command) flag(name string) (Flag, bool) {
+	for _, flag := range c.Flags {
+		if flag.Name == name || (flag.Short != "" && flag.Short == name) {
+			return flag, true
+		}
+	}
+	return Flag{}, false
+}
+
+// subcommand returns the subcommand of c named name, regardless of case
+func (c *Command) subcommand(name string) *Command {
+	for _, sub := range c.Subcommands {
+		if strings.EqualFold(sub.Name, name) {
+			return sub
+		}
+	}
+	return nil
+}
+
+// Help returns how to use c, its flags and subcommands, in slack markdown
+func (c *Command) Help() string {
+	return c.help(c.Name)
+}
+
+// Usage returns the one line synopsis of c, e.g. "/gpt [flags] <question>"
+func (c *Command) Usage() string {
+	return c.usage(c.Name)
+}
+
+// usage is Usage for c invoked as path
+func (c *Command) usage(path string) string {
+	usage := path
+	if len(c.Flags) > 0 {
+		usage += " [flags]"
+	}
+	if len(c.Subcommands) > 0 {
+		usage += " <subcommand>"
+	}
+	if c.Args != "" {
+		usage += " " + c.Args
+	}
+	return usage
+}
+
+// help is Help for c invoked as path
+func (c *Command) help(path string) string {
+	lines := []string{"Usage: `" + c.usage(path) + "`"}
+	if c.Summary != "" {
+		lines = append(lines, c.Summary)
+	}
+	for _, flag := range c.Flags {
+		names := "`--" + flag.Name
+		if flag.Value != "" {
+			names += " <" + flag.Value + ">"
+		}
+		names += "`"
+		if flag.Short != "" {
+			names += " (or `-" + flag.Short + "`)"
+		}
+		lines = append(lines, "• "+names+": "+flag.Usage)
+	}
+	for _, sub := range c.Subcommands {
+		usage := sub.Name
+		if sub.Args != "" {
+			usage += " " + sub.Args
+		}
+		lines = append(lines, "• `"+path+" "+usage+"`: "+sub.Summary)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// quotes pairs the quotes arguments can be put in with their closing quotes, including the curly quotes slack
+// clients substitute while typing
+var quotes = map[rune]rune{'"': '"', '\'': '\'', '“': '”', '‘': '’'}
+
+// next returns the first token of text, with its quotes, and the text after it, false when there is none.
+// Quotes group text at the start of a token and after the = of a flag's value.
+func next(text string) (token, after string, ok bool) {
+	text = strings.TrimLeftFunc(text, unicode.IsSpace)
+	if text == "" {
+		return "", "", false
+	}
+	end := 0
+	for end < len(text) {
+		r, size := utf8.DecodeRuneInString(text[end:])
+		if unicode.IsSpace(r) {
+			break
+		}
+		end += size
+		if closing, quoted := quotes[r]; quoted && (end == size || text[end-size-1] == '=') {
+			if i := strings.IndexRune(text[end:], closing); i >= 0 {
+				end += i + utf8.RuneLen(closing)
+			}
+		}
+	}
+	return text[:end], text[end:], true
+}
+
+// unquote removes the quotes around token, tokens without a closing quote are left as they are
+func unquote(token string) string {
+	first, size := utf8.DecodeRuneInString(token)
+	closing, quoted := quotes[first]
+	last, lastSize := utf8.DecodeLastRuneInString(token)
+	if !quoted || len(token) < size+lastSize || last != closing {
+		return token
+	}
+	return token[size : len(token)-lastSize]
+}
+
+// Split splits text into words at spaces, keeping quoted text together without its quotes. Quotes that are
+// not closed, such as apostrophes, are taken as they are.
+func Split(text string) []string {
+	var words []string
+	for {
+		token, after, ok := next(text)
+		if !ok {
+			return words
+		}
+		words = append(words, unquote(token))
+		text = after
+	}
+}
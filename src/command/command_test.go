@@ -0,0 +1,111 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// admin is a command with subcommands and flags taking values
+var admin = &Command{
+	Name:    "/gpt-admin",
+	Summary: "Manage the bot.",
+	Flags:   []Flag{{Name: "channel", Short: "c", Value: "channel", Usage: "the channel to manage"}},
+	Subcommands: []*Command{
+		{Name: "prompt", Args: "<prompt>", Summary: "set the system prompt", Flags: []Flag{{Name: "dry-run", Usage: "only show the change"}}},
+		{Name: "model", Args: "<model>", Summary: "set the model"},
+	},
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		wantPath []string
+		wantArgs []string
+		wantRest string
+		wantHelp bool
+		wantErr  string
+	}{
+		{"subcommand", "prompt Answer in English.", []string{"/gpt-admin", "prompt"}, []string{"Answer", "in", "English."}, "Answer in English.", false, ""},
+		{"flags before and after the subcommand", "-c C1 PROMPT --dry-run \"be brief\"", []string{"/gpt-admin", "prompt"}, []string{"be brief"}, `"be brief"`, false, ""},
+		{"curly quotes", "--channel=“C 1” model gpt-4o", []string{"/gpt-admin", "model"}, []string{"gpt-4o"}, "gpt-4o", false, ""},
+		{"apostrophes", "prompt don't 'guess", []string{"/gpt-admin", "prompt"}, []string{"don't", "'guess"}, "don't 'guess", false, ""},
+		{"dashes end the flags", "prompt -- --dry-run", []string{"/gpt-admin", "prompt"}, []string{"--dry-run"}, "--dry-run", false, ""},
+		{"help subcommand", "help", []string{"/gpt-admin"}, nil, "", true, ""},
+		{"help flag", "model -h", []string{"/gpt-admin", "model"}, nil, "", true, ""},
+		{"unknown subcommand", "reboot", []string{"/gpt-admin"}, nil, "", false, "unknown subcommand `reboot`"},
+		{"unknown flag", "model --force gpt-4o", []string{"/gpt-admin", "model"}, nil, "", false, "unknown flag `--force`"},
+		{"missing value", "--channel", []string{"/gpt-admin"}, nil, "", false, "flag `--channel` needs a channel"},
+		{"value for a switch", "prompt --dry-run=yes hi", []string{"/gpt-admin", "prompt"}, nil, "", false, "flag `--dry-run` takes no value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv, err := Parse(admin, tt.text)
+			assert.Equal(t, tt.wantPath, inv.Path)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantArgs, inv.Args)
+			assert.Equal(t, tt.wantRest, inv.Rest)
+			assert.Equal(t, tt.wantHelp, inv.Help)
+		})
+	}
+
+	inv, err := Parse(admin, "-c 'C 1' prompt --dry-run hi")
+	require.NoError(t, err)
+	assert.Equal(t, "C 1", inv.Value("channel"))
+	assert.True(t, inv.Has("dry-run"))
+	assert.False(t, inv.Has("private"))
+}
+
+func TestHelp(t *testing.T) {
+	assert.Equal(t, "Usage: `/gpt-admin [flags] <subcommand>`\nManage the bot.\n"+
+		"• `--channel <channel>` (or `-c`): the channel to manage\n"+
+		"• `/gpt-admin prompt <prompt>`: set the system prompt\n"+
+		"• `/gpt-admin model <model>`: set the model", admin.Help())
+
+	inv, err := Parse(admin, "prompt --help")
+	require.NoError(t, err)
+	assert.Equal(t, "Usage: `/gpt-admin prompt [flags] <prompt>`\nset the system prompt\n• `--dry-run`: only show the change", inv.UsageText())
+	assert.Equal(t, "/gpt-admin [flags] <subcommand>", admin.Usage())
+}
+
+func TestAliases(t *testing.T) {
+	aliases := Aliases{"プロンプト": "prompt", "ヘルプ": "help", "モデル": "model", "一覧": "list"}
+	inv, err := aliases.Parse(admin, "-c C1 プロンプト --dry-run 英語で答えて")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/gpt-admin", "prompt"}, inv.Path)
+	assert.Equal(t, "英語で答えて", inv.Rest)
+	inv, err = aliases.Parse(admin, "ヘルプ")
+	require.NoError(t, err)
+	assert.True(t, inv.Help)
+	_, err = aliases.Parse(admin, "一覧")
+	assert.EqualError(t, err, "unknown subcommand `一覧`", "aliases only stand for subcommands of the command")
+
+	keywords := &Command{Subcommands: []*Command{
+		{Name: "faq", Subcommands: []*Command{{Name: "list"}, {Name: "add"}}},
+		{Name: "help"},
+	}}
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"ヘルプ", "help"},
+		{"faq 一覧", "faq list"},
+		{"FAQ  一覧 モデル", "FAQ  list モデル"},
+		{"ヘルプ 一覧", "help 一覧"},
+		{"モデル 一覧", "モデル 一覧"},
+		{"what is ヘルプ", "what is ヘルプ"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			assert.Equal(t, tt.want, aliases.Rewrite(keywords, tt.text))
+		})
+	}
+	assert.Equal(t, "ヘルプ", Aliases(nil).Rewrite(keywords, "ヘルプ"))
+}
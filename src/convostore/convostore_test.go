@@ -0,0 +1,135 @@
+package convostore
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// store is what every conversation store implements
+type store interface {
+	Load(ctx context.Context, key string) ([]string, bool, error)
+	Save(ctx context.Context, key string, history []string) error
+	Delete(ctx context.Context, key string) error
+	Close() error
+}
+
+func TestStores(t *testing.T) {
+	tests := []struct {
+		name string
+		open func(t *testing.T) store
+	}{
+		{"redis", func(t *testing.T) store {
+			r, err := NewRedis("redis://"+miniredis.RunT(t).Addr(), 0)
+			require.NoError(t, err)
+			return r
+		}},
+		{"sqlite", func(t *testing.T) store {
+			s, err := OpenSQLite(filepath.Join(t.TempDir(), "conversations.db"), 0)
+			require.NoError(t, err)
+			return s
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.open(t)
+			defer s.Close()
+			ctx := context.Background()
+
+			_, ok, err := s.Load(ctx, "U1C1")
+			require.NoError(t, err)
+			assert.False(t, ok)
+
+			require.NoError(t, s.Save(ctx, "U1C1", []string{"hi", "hello"}))
+			require.NoError(t, s.Save(ctx, "U2C1", []string{"yo"}))
+			require.NoError(t, s.Save(ctx, "U1C1", []string{"hi", "hello", "how are you"}))
+			history, ok, err := s.Load(ctx, "U1C1")
+			require.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, []string{"hi", "hello", "how are you"}, history)
+
+			require.NoError(t, s.Delete(ctx, "U1C1"))
+			require.NoError(t, s.Delete(ctx, "missing"))
+			_, ok, err = s.Load(ctx, "U1C1")
+			require.NoError(t, err)
+			assert.False(t, ok)
+			history, _, err = s.Load(ctx, "U2C1")
+			require.NoError(t, err)
+			assert.Equal(t, []string{"yo"}, history)
+		})
+	}
+}
+
+func TestRedis_Expires(t *testing.T) {
+	server := miniredis.RunT(t)
+	r, err := NewRedis("redis://"+server.Addr(), time.Hour)
+	require.NoError(t, err)
+	defer r.Close()
+	ctx := context.Background()
+	require.NoError(t, r.Save(ctx, "U1C1", []string{"hi"}))
+	server.FastForward(59 * time.Minute)
+	_, ok, _ := r.Load(ctx, "U1C1")
+	assert.True(t, ok)
+	server.FastForward(time.Minute)
+	_, ok, _ = r.Load(ctx, "U1C1")
+	assert.False(t, ok)
+
+	_, err = NewRedis("localhost:6379", 0)
+	assert.Error(t, err)
+}
+
+func TestSQLite_ExpiresAndSurvivesReopening(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conversations.db")
+	s, err := OpenSQLite(path, time.Hour)
+	require.NoError(t, err)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+	require.NoError(t, s.Save(ctx, "U1C1", []string{"hi"}))
+	require.NoError(t, s.Close())
+
+	s, err = OpenSQLite(path, time.Hour)
+	require.NoError(t, err)
+	defer s.Close()
+	s.now = func() time.Time { return now.Add(59 * time.Minute) }
+	history, ok, err := s.Load(ctx, "U1C1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"hi"}, history)
+
+	s.now = func() time.Time { return now.Add(61 * time.Minute) }
+	_, ok, err = s.Load(ctx, "U1C1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	require.NoError(t, s.Save(ctx, "U2C1", []string{"yo"}))
+	var rows int
+	require.NoError(t, s.db.QueryRow("SELECT COUNT(*) FROM conversations").Scan(&rows))
+	assert.Equal(t, 1, rows, "expired conversations are dropped")
+}
+
+func TestRedisEvents(t *testing.T) {
+	server := miniredis.RunT(t)
+	r, err := NewRedisEvents("redis://" + server.Addr())
+	require.NoError(t, err)
+	defer r.Close()
+	ctx := context.Background()
+
+	seen, err := r.Seen(ctx, "Ev1", time.Hour)
+	require.NoError(t, err)
+	assert.False(t, seen)
+	seen, err = r.Seen(ctx, "Ev1", time.Hour)
+	require.NoError(t, err)
+	assert.True(t, seen, "slack's retries are skipped")
+	seen, err = r.Seen(ctx, "Ev2", time.Hour)
+	require.NoError(t, err)
+	assert.False(t, seen)
+
+	server.FastForward(time.Hour)
+	seen, err = r.Seen(ctx, "Ev1", time.Hour)
+	require.NoError(t, err)
+	assert.False(t, seen, "events are forgotten after the ttl")
+}
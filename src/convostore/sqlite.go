@@ -0,0 +1,93 @@
+package convostore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	_ "github.com/mattn/go-sqlite3" // registers the sqlite3 driver
+	"time"
+)
+
+// sqliteSchema creates the table conversations are kept in
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS conversations (
+	key        TEXT PRIMARY KEY,
+	history    TEXT NOT NULL,
+	updated_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS conversations_updated_at ON conversations (updated_at);`
+
+// SQLite keeps conversations in a SQLite database file, dropping them ttl after they were last changed
+type SQLite struct {
+	db  *sql.DB
+	ttl time.Duration
+	now func() time.Time
+}
+
+// OpenSQLite opens the SQLite database at path, creating it if it does not exist, keeping conversations for ttl
+// after they last changed, 0 keeps them until they are cleared
+func OpenSQLite(path string, ttl time.Duration) (*SQLite, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, fmt.Errorf("opening conversation database: %w", err)
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating conversation database: %w", err)
+	}
+	return &SQLite{db: db, ttl: ttl, now: time.Now}, nil
+}
+
+// expiredBefore returns the time conversations changed before are expired, zero when they never expire
+func (s *SQLite) expiredBefore() int64 {
+	if s.ttl <= 0 {
+		return 0
+	}
+	return s.now().Add(-s.ttl).UnixNano()
+}
+
+// Load returns the conversation under key, reporting false when there is none or it expired
+func (s *SQLite) Load(ctx context.Context, key string) ([]string, bool, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, "SELECT history FROM conversations WHERE key = ? AND updated_at >= ?",
+		key, s.expiredBefore()).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var history []string
+	if err := json.Unmarshal([]byte(data), &history); err != nil {
+		return nil, false, fmt.Errorf("reading conversation: %w", err)
+	}
+	return history, true, nil
+}
+
+// Save replaces the conversation under key with history, dropping expired conversations along the way
+func (s *SQLite) Save(ctx context.Context, key string, history []string) error {
+	data, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO conversations (key, history, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET history = excluded.history, updated_at = excluded.updated_at`,
+		key, string(data), s.now().UnixNano())
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, "DELETE FROM conversations WHERE updated_at < ?", s.expiredBefore())
+	return err
+}
+
+// Delete removes the conversation under key
+func (s *SQLite) Delete(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM conversations WHERE key = ?", key)
+	return err
+}
+
+// Close closes the database
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,88 @@
+// Package diag collects on-demand diagnostic dumps of a running bot
+package diag
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/cache"
+	slackgpt "github.com/chikamif/slackgpt/src/slack"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"time"
+)
+
+// Dump is a point in time view of the bot's goroutines, event queue and caches
+type Dump struct {
+	Time       time.Time
+	Status     slackgpt.StatusSnapshot
+	Caches     []cache.Stats
+	Goroutines int
+	// Stacks holds the stack of every goroutine in the same format as an unrecovered panic
+	Stacks []byte
+}
+
+// Collect takes a Dump, status and caches may be nil
+func Collect(status *slackgpt.HandlerStatus, caches *cache.Registry) Dump {
+	var stacks bytes.Buffer
+	// debug=2 cannot fail when writing to a bytes.Buffer
+	_ = pprof.Lookup("goroutine").WriteTo(&stacks, 2)
+	var stats []cache.Stats
+	if caches != nil {
+		stats = caches.Stats()
+	}
+	return Dump{
+		Time:       time.Now(),
+		Status:     status.Snapshot(),
+		Caches:     stats,
+		Goroutines: runtime.NumGoroutine(),
+		Stacks:     stacks.Bytes(),
+	}
+}
+
+// ActiveIDs returns the IDs of the events being handled, oldest first
+func (d Dump) ActiveIDs() []string {
+	ids := make([]string, 0, len(d.Status.ActiveRequests))
+	for _, req := range d.Status.ActiveRequests {
+		ids = append(ids, req.ID)
+	}
+	return ids
+}
+
+// WriteTo writes a human readable report of the dump to w
+func (d Dump) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "slackgpt diagnostics %s\n\n", d.Time.Format(time.RFC3339))
+	fmt.Fprintf(&buf, "queued events: %d\n", d.Status.QueuedEvents)
+	fmt.Fprintf(&buf, "active requests: %d\n", len(d.Status.ActiveRequests))
+	for _, req := range d.Status.ActiveRequests {
+		fmt.Fprintf(&buf, "  %s %s running for %s\n", req.ID, req.Type, d.Time.Sub(req.Started).Round(time.Millisecond))
+	}
+	fmt.Fprintf(&buf, "\ncaches: %d\n", len(d.Caches))
+	for _, s := range d.Caches {
+		fmt.Fprintf(&buf, "  %s entries=%d/%d bytes=%d/%d hit_rate=%.3f evictions=%d\n",
+			s.Name, s.Entries, s.MaxEntries, s.Bytes, s.MaxBytes, s.HitRate(), s.Evictions)
+	}
+	fmt.Fprintf(&buf, "\ngoroutines: %d\n\n", d.Goroutines)
+	buf.Write(d.Stacks)
+	return buf.WriteTo(w)
+}
+
+// WriteFile writes the dump to a new timestamped file in dir and returns its path
+func (d Dump) WriteFile(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("slackgpt-diag-%s.txt", d.Time.Format("20060102T150405.000")))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return "", err
+	}
+	if _, err := d.WriteTo(f); err != nil {
+		f.Close()
+		return "", err
+	}
+	return path, f.Close()
+}
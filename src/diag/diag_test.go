@@ -0,0 +1,42 @@
+package diag
+
+import (
+	"bytes"
+	"github.com/chikamif/slackgpt/src/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestCollect(t *testing.T) {
+	caches := cache.NewRegistry()
+	lru := cache.NewLRU[string]("test", 10, 0, nil)
+	lru.Set("k", "v")
+	caches.Register(lru)
+
+	d := Collect(nil, caches)
+	assert.Positive(t, d.Goroutines)
+	assert.Contains(t, string(d.Stacks), "diag.TestCollect")
+	require.Len(t, d.Caches, 1)
+	assert.Equal(t, "test", d.Caches[0].Name)
+	assert.Empty(t, d.ActiveIDs())
+
+	var buf bytes.Buffer
+	_, err := d.WriteTo(&buf)
+	require.NoError(t, err)
+	report := buf.String()
+	assert.Contains(t, report, "queued events: 0")
+	assert.Contains(t, report, "active requests: 0")
+	assert.Contains(t, report, "test entries=1/10")
+	assert.Contains(t, report, "goroutine ")
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path, err := Collect(nil, nil).WriteFile(dir)
+	require.NoError(t, err)
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(contents), "slackgpt diagnostics")
+}
@@ -0,0 +1,172 @@
+// Package embedapi lets other internal services embed text with the bot's embedding provider, so they need no
+// OpenAI keys of their own. Callers are authenticated with API keys, rate limited and have their usage counted.
+package embedapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/chikamif/slackgpt/src/webhook"
+	"github.com/sashabaranov/go-openai"
+	"sync"
+	"time"
+)
+
+// MaxTexts is the most texts one request may embed
+const MaxTexts = 256
+
+// ErrNoTexts and ErrTooManyTexts are returned when a request has nothing or too much to embed
+var (
+	ErrNoTexts      = errors.New("no texts to embed")
+	ErrTooManyTexts = fmt.Errorf("more than the %d texts a request may embed", MaxTexts)
+)
+
+// RateLimitError is returned when a caller has made its requests of the window, Wait says when it may again
+type RateLimitError struct {
+	Wait time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limited, try again in %s", e.Wait.Round(time.Second))
+}
+
+// Usage is told about every embedding request a caller made, with the tokens it used. *metrics.Metrics is a Usage.
+type Usage interface {
+	ObserveEmbedding(caller, model string, d time.Duration, tokens int, err error)
+}
+
+// Result is the embeddings of the texts of a request, in order, and the tokens they used
+type Result struct {
+	Model      string
+	Embeddings [][]float32
+	Tokens     int
+}
+
+// Config is how a Service embeds texts and how many requests a caller may make
+type Config struct {
+	// Model embeds the texts, chatgpt.DefaultEmbeddingModel when empty
+	Model string
+	// RateLimit is how many requests a caller may make per RateLimitWindow, 0 disables the limit
+	RateLimit       int
+	RateLimitWindow time.Duration
+	// Usage counts the requests of every caller, nil counts nothing
+	Usage Usage
+	// Callbacks delivers the results of the requests asking for a callback, nil rejects them
+	Callbacks *webhook.Sender
+}
+
+// bucket is the requests a caller has left at a point in time
+type bucket struct {
+	tokens float64
+	at     time.Time
+}
+
+// Service embeds texts for callers
+type Service struct {
+	embedder chatgpt.Embedder
+	cfg      Config
+	now      func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]bucket
+	// pending are the requests being embedded in the background for their callbacks
+	pending sync.WaitGroup
+}
+
+// NewService creates a Service embedding texts with embedder
+func NewService(embedder chatgpt.Embedder, cfg Config) *Service {
+	if cfg.Model == "" {
+		cfg.Model = string(chatgpt.DefaultEmbeddingModel)
+	}
+	return &Service{embedder: embedder, cfg: cfg, now: time.Now, buckets: map[string]bucket{}}
+}
+
+// Embed returns the embeddings of texts for caller, unless it is rate limited
+func (s *Service) Embed(ctx context.Context, caller string, texts []string) (Result, error) {
+	if err := s.admit(caller, texts); err != nil {
+		return Result{}, err
+	}
+	return s.embed(ctx, caller, texts)
+}
+
+// Close waits until the requests embedded in the background for their callbacks are, or ctx is done
+func (s *Service) Close(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// admit returns why caller may not embed texts, nil when it may
+func (s *Service) admit(caller string, texts []string) error {
+	switch {
+	case len(texts) == 0:
+		return ErrNoTexts
+	case len(texts) > MaxTexts:
+		return ErrTooManyTexts
+	}
+	if wait := s.allow(caller); wait > 0 {
+		return &RateLimitError{Wait: wait}
+	}
+	return nil
+}
+
+// embed returns the embeddings of the texts caller was admitted to embed
+func (s *Service) embed(ctx context.Context, caller string, texts []string) (Result, error) {
+	start := s.now()
+	resp, err := s.embedder.CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{Input: texts, Model: openai.EmbeddingModel(s.cfg.Model)})
+	result := Result{Model: s.cfg.Model, Tokens: resp.Usage.PromptTokens}
+	if err == nil {
+		result.Embeddings, err = inOrder(resp.Data, len(texts))
+	}
+	if s.cfg.Usage != nil {
+		s.cfg.Usage.ObserveEmbedding(caller, s.cfg.Model, s.now().Sub(start), result.Tokens, err)
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	return result, nil
+}
+
+// inOrder returns the embeddings of data in the order of the n texts they embed
+func inOrder(data []openai.Embedding, n int) ([][]float32, error) {
+	if len(data) != n {
+		return nil, fmt.Errorf("got %d embeddings for %d texts", len(data), n)
+	}
+	embeddings := make([][]float32, n)
+	for _, d := range data {
+		if d.Index < 0 || d.Index >= n {
+			return nil, fmt.Errorf("got an embedding for text %d of %d", d.Index, n)
+		}
+		embeddings[d.Index] = d.Embedding
+	}
+	return embeddings, nil
+}
+
+// allow takes one of caller's requests, refilling them continuously over the window, and returns how long it has
+// to wait when it has none left
+func (s *Service) allow(caller string) time.Duration {
+	if s.cfg.RateLimit <= 0 {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now, limit := s.now(), float64(s.cfg.RateLimit)
+	tokens := limit
+	if b, ok := s.buckets[caller]; ok {
+		tokens = min(b.tokens+float64(now.Sub(b.at))/float64(s.cfg.RateLimitWindow)*limit, limit)
+	}
+	if tokens < 1 {
+		return time.Duration((1 - tokens) / limit * float64(s.cfg.RateLimitWindow))
+	}
+	s.buckets[caller] = bucket{tokens: tokens - 1, at: now}
+	return 0
+}
@@ -0,0 +1,182 @@
+package embedapi
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/chikamif/slackgpt/src/webhook"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// usage records the requests it is told about
+type usage struct {
+	callers []string
+	tokens  int
+}
+
+func (u *usage) ObserveEmbedding(caller, model string, d time.Duration, tokens int, err error) {
+	u.callers = append(u.callers, caller)
+	u.tokens += tokens
+}
+
+// newService creates a Service embedding with a fake openai server
+func newService(t *testing.T, cfg Config) *Service {
+	server := fake.NewOpenAI(0)
+	t.Cleanup(server.Close)
+	config := openai.DefaultConfig("sk-test")
+	config.BaseURL = server.URL()
+	return NewService(openai.NewClientWithConfig(config), cfg)
+}
+
+func TestHandler(t *testing.T) {
+	handler := NewHandler(newService(t, Config{}), map[string]string{"wiki-search": "s3cret"}, log.New(io.Discard, "", 0))
+	tests := []struct {
+		name   string
+		method string
+		auth   string
+		body   string
+		status int
+	}{
+		{name: "embeds", method: http.MethodPost, auth: "Bearer s3cret", body: `{"input": ["a", "b"]}`, status: http.StatusOK},
+		{name: "no key", method: http.MethodPost, body: `{"input": ["a"]}`, status: http.StatusUnauthorized},
+		{name: "unknown key", method: http.MethodPost, auth: "Bearer guess", body: `{"input": ["a"]}`, status: http.StatusUnauthorized},
+		{name: "not a bearer", method: http.MethodPost, auth: "s3cret", body: `{"input": ["a"]}`, status: http.StatusUnauthorized},
+		{name: "GET", method: http.MethodGet, auth: "Bearer s3cret", status: http.StatusMethodNotAllowed},
+		{name: "no input", method: http.MethodPost, auth: "Bearer s3cret", body: `{"input": []}`, status: http.StatusBadRequest},
+		{name: "not JSON", method: http.MethodPost, auth: "Bearer s3cret", body: `a`, status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, Path, strings.NewReader(tt.body))
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, tt.status, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+func TestClient(t *testing.T) {
+	var u usage
+	service := newService(t, Config{RateLimit: 1, RateLimitWindow: time.Hour, Usage: &u})
+	server := httptest.NewServer(NewHandler(service, map[string]string{"wiki-search": "s3cret", "triage": "other"}, log.New(io.Discard, "", 0)))
+	defer server.Close()
+	client := &Client{BaseURL: server.URL + "/", APIKey: "s3cret"}
+
+	embeddings, err := client.Embed(context.Background(), []string{"rotate my token", "reset my password please"})
+	require.NoError(t, err)
+	require.Len(t, embeddings, 2)
+	assert.NotEqual(t, embeddings[0], embeddings[1])
+	assert.Equal(t, []string{"wiki-search"}, u.callers)
+	assert.Equal(t, 7, u.tokens)
+
+	_, err = client.Embed(context.Background(), []string{"again"})
+	assert.ErrorContains(t, err, "429 Too Many Requests: rate limited, try again in 1h0m0s")
+	_, err = (&Client{BaseURL: server.URL, APIKey: "other"}).Embed(context.Background(), []string{"again"})
+	assert.NoError(t, err, "every caller has its own limit")
+}
+
+func TestClientEmbedLater(t *testing.T) {
+	// the embedded pointer of callbackPayload cannot be decoded into
+	type payloadDecoded struct {
+		ID string `json:"id"`
+		embedResponse
+		Error *errorMessage `json:"error"`
+	}
+	delivered := make(chan payloadDecoded, 1)
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.NoError(t, webhook.Verify("hook-secret", r.Header, body, time.Now(), time.Minute))
+		assert.Equal(t, EventEmbeddingCompleted, r.Header.Get(webhook.EventHeader))
+		var payload payloadDecoded
+		assert.NoError(t, json.Unmarshal(body, &payload))
+		delivered <- payload
+	}))
+	defer callback.Close()
+	callbacks := webhook.New(webhook.Options{Secret: "hook-secret", RetryDelay: time.Millisecond})
+	service := newService(t, Config{RateLimit: 1, RateLimitWindow: time.Hour, Callbacks: callbacks})
+	handler := NewHandler(service, map[string]string{"wiki-search": "s3cret"}, log.New(io.Discard, "", 0))
+	// the callback server listens on loopback
+	handler.callbackIP = func(ip net.IP) bool { return ip.IsLoopback() }
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	client := &Client{BaseURL: server.URL, APIKey: "s3cret"}
+	ctx := context.Background()
+
+	_, err := client.EmbedLater(ctx, []string{"rotate my token"}, "ftp://wiki/hooks")
+	assert.ErrorContains(t, err, "400 Bad Request: callback_url is not an http or https URL")
+	id, err := client.EmbedLater(ctx, []string{"rotate my token"}, callback.URL)
+	require.NoError(t, err)
+	require.NotEmpty(t, id)
+	_, err = client.EmbedLater(ctx, []string{"again"}, callback.URL)
+	assert.ErrorContains(t, err, "429 Too Many Requests", "callbacks are rate limited when they are asked for")
+
+	require.NoError(t, service.Close(ctx))
+	require.NoError(t, callbacks.Close(ctx))
+	payload := <-delivered
+	assert.Equal(t, id, payload.ID)
+	require.Len(t, payload.Data, 1)
+	assert.NotEmpty(t, payload.Data[0].Embedding)
+	assert.Nil(t, payload.Error)
+
+	noCallbacks := httptest.NewServer(NewHandler(newService(t, Config{}), map[string]string{"wiki-search": "s3cret"}, log.New(io.Discard, "", 0)))
+	defer noCallbacks.Close()
+	_, err = (&Client{BaseURL: noCallbacks.URL, APIKey: "s3cret"}).EmbedLater(ctx, []string{"a"}, callback.URL)
+	assert.ErrorContains(t, err, "callbacks are not enabled")
+}
+
+func TestCallbackURLInternal(t *testing.T) {
+	callbacks := webhook.New(webhook.Options{})
+	server := httptest.NewServer(NewHandler(newService(t, Config{Callbacks: callbacks}), map[string]string{"wiki-search": "s3cret"}, log.New(io.Discard, "", 0)))
+	defer server.Close()
+	client := &Client{BaseURL: server.URL, APIKey: "s3cret"}
+	for _, callbackURL := range []string{
+		"http://169.254.169.254/latest/meta-data/",
+		"http://127.0.0.1:8080/hooks",
+		"http://localhost/hooks",
+		"https://10.0.0.5/hooks",
+		"http://[::1]/hooks",
+		"http://[fe80::1]/hooks",
+		"http://0.0.0.0/hooks",
+	} {
+		_, err := client.EmbedLater(context.Background(), []string{"a"}, callbackURL)
+		assert.ErrorContains(t, err, "400 Bad Request: callback_url must not point to a loopback, private or link-local address", callbackURL)
+	}
+	assert.True(t, publicIP(net.ParseIP("93.184.216.34")))
+}
+
+func TestServiceRateLimit(t *testing.T) {
+	service := newService(t, Config{RateLimit: 2, RateLimitWindow: time.Minute})
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		_, err := service.Embed(ctx, "wiki-search", []string{"a"})
+		require.NoError(t, err)
+	}
+	_, err := service.Embed(ctx, "wiki-search", []string{"a"})
+	var limited *RateLimitError
+	require.ErrorAs(t, err, &limited)
+	assert.Equal(t, 30*time.Second, limited.Wait)
+
+	now = now.Add(30 * time.Second)
+	_, err = service.Embed(ctx, "wiki-search", []string{"a"})
+	assert.NoError(t, err, "a request is refilled every half minute")
+
+	_, err = service.Embed(ctx, "wiki-search", make([]string, MaxTexts+1))
+	assert.ErrorIs(t, err, ErrTooManyTexts)
+}
@@ -0,0 +1,305 @@
+package embedapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Path is where the embed endpoint is served
+const Path = "/api/v1/embed"
+
+const (
+	// maxBodyBytes bounds the size of a request
+	maxBodyBytes = 4 << 20
+	// callbackTimeout is how long embedding the texts of a request answered by callback may take
+	callbackTimeout = 2 * time.Minute
+)
+
+// The events delivered to the callback URL of a request
+const (
+	EventEmbeddingCompleted = "embedding.completed"
+	EventEmbeddingFailed    = "embedding.failed"
+)
+
+// embedRequest is the body of a request to the endpoint. With a CallbackURL the request is answered at once with
+// its ID, and its embeddings are delivered to the URL once they are ready.
+type embedRequest struct {
+	Input       []string `json:"input"`
+	CallbackURL string   `json:"callback_url,omitempty"`
+}
+
+// acceptedResponse is the body of the endpoint's answer to a request answered by callback
+type acceptedResponse struct {
+	ID string `json:"id"`
+}
+
+// callbackPayload is delivered to the callback URL of a request: its embeddings, or why it failed
+type callbackPayload struct {
+	ID string `json:"id"`
+	*embedResponse
+	Error *errorMessage `json:"error,omitempty"`
+}
+
+// embedResponse is the body of the endpoint's answer, shaped like OpenAI's so its clients can be reused
+type embedResponse struct {
+	Model string             `json:"model"`
+	Data  []openai.Embedding `json:"data"`
+	Usage struct {
+		PromptTokens int `json:"prompt_tokens"`
+		TotalTokens  int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+// errorResponse is the body of the endpoint's answer to a request it could not serve
+type errorResponse struct {
+	Error errorMessage `json:"error"`
+}
+
+// errorMessage says why a request could not be served
+type errorMessage struct {
+	Message string `json:"message"`
+}
+
+// Handler serves the embed endpoint to the callers holding its API keys
+type Handler struct {
+	service *Service
+	// keys are the API keys of the callers, by caller
+	keys   map[string]string
+	logger *log.Logger
+	// callbackIP reports whether the results of requests may be delivered to ip
+	callbackIP func(ip net.IP) bool
+}
+
+// NewHandler creates a Handler serving service to callers authenticated with "Authorization: Bearer <key>"
+// using the key of keys given for them
+func NewHandler(service *Service, keys map[string]string, logger *log.Logger) *Handler {
+	return &Handler{service: service, keys: keys, logger: logger, callbackIP: publicIP}
+}
+
+// caller returns the caller holding key, comparing keys in constant time
+func (h *Handler) caller(key string) (string, bool) {
+	found := ""
+	for caller, callerKey := range h.keys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(callerKey)) == 1 && callerKey != "" {
+			found = caller
+		}
+	}
+	return found, found != ""
+}
+
+// ServeHTTP embeds the input of a POST request for its caller
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	caller, known := h.caller(key)
+	if !ok || !known {
+		writeError(w, http.StatusUnauthorized, "missing or unknown API key")
+		return
+	}
+	var req embedRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBodyBytes)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "decoding request: "+err.Error())
+		return
+	}
+	if req.CallbackURL != "" {
+		h.embedLater(r.Context(), w, caller, req)
+		return
+	}
+	result, err := h.service.Embed(r.Context(), caller, req.Input)
+	if err != nil {
+		h.writeEmbedError(w, caller, len(req.Input), err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(newEmbedResponse(result)); err != nil {
+		h.logger.Printf("failed sending embeddings to %s: %v\n", caller, err)
+	}
+}
+
+// embedLater answers req with its ID and embeds its input in the background, delivering the embeddings to its
+// callback URL
+func (h *Handler) embedLater(ctx context.Context, w http.ResponseWriter, caller string, req embedRequest) {
+	callbacks := h.service.cfg.Callbacks
+	if callbacks == nil {
+		writeError(w, http.StatusBadRequest, "callbacks are not enabled")
+		return
+	}
+	target, err := url.Parse(req.CallbackURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		writeError(w, http.StatusBadRequest, "callback_url is not an http or https URL")
+		return
+	}
+	if err := h.checkCallbackHost(ctx, target.Hostname()); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := h.service.admit(caller, req.Input); err != nil {
+		h.writeEmbedError(w, caller, len(req.Input), err)
+		return
+	}
+	id := newID()
+	h.service.pending.Add(1)
+	go func() {
+		defer h.service.pending.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), callbackTimeout)
+		defer cancel()
+		result, err := h.service.embed(ctx, caller, req.Input)
+		if err != nil {
+			h.logger.Printf("failed embedding %d texts for %s: %v\n", len(req.Input), caller, err)
+			callbacks.Deliver(req.CallbackURL, EventEmbeddingFailed, callbackPayload{ID: id, Error: &errorMessage{Message: "embedding failed"}})
+			return
+		}
+		callbacks.Deliver(req.CallbackURL, EventEmbeddingCompleted, callbackPayload{ID: id, embedResponse: newEmbedResponse(result)})
+	}()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(acceptedResponse{ID: id}); err != nil {
+		h.logger.Printf("failed accepting the request of %s: %v\n", caller, err)
+	}
+}
+
+// checkCallbackHost returns why the results of requests may not be delivered to host: it is, or resolves to, an
+// address callers must not reach through the bot
+func (h *Handler) checkCallbackHost(ctx context.Context, host string) error {
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return fmt.Errorf("callback_url host %s cannot be resolved", host)
+		}
+		ips = ips[:0]
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+	for _, ip := range ips {
+		if !h.callbackIP(ip) {
+			return errors.New("callback_url must not point to a loopback, private or link-local address")
+		}
+	}
+	return nil
+}
+
+// publicIP reports whether ip is reachable from the internet: not loopback, private, link-local, as the cloud
+// metadata service at 169.254.169.254 is, unspecified or multicast
+func publicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsUnspecified() && !ip.IsMulticast()
+}
+
+// writeEmbedError answers a request of caller to embed n texts that failed with err
+func (h *Handler) writeEmbedError(w http.ResponseWriter, caller string, n int, err error) {
+	var limited *RateLimitError
+	switch {
+	case errors.As(err, &limited):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limited.Wait.Seconds()))))
+		writeError(w, http.StatusTooManyRequests, err.Error())
+	case errors.Is(err, ErrNoTexts) || errors.Is(err, ErrTooManyTexts):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		h.logger.Printf("failed embedding %d texts for %s: %v\n", n, caller, err)
+		writeError(w, http.StatusBadGateway, "embedding failed")
+	}
+}
+
+// newEmbedResponse is the endpoint's answer with result
+func newEmbedResponse(result Result) *embedResponse {
+	resp := &embedResponse{Model: result.Model}
+	resp.Usage.PromptTokens, resp.Usage.TotalTokens = result.Tokens, result.Tokens
+	for i, e := range result.Embeddings {
+		resp.Data = append(resp.Data, openai.Embedding{Object: "embedding", Index: i, Embedding: e})
+	}
+	return resp
+}
+
+// newID returns a random request ID
+func newID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// writeError answers with status and message
+func writeError(w http.ResponseWriter, status int, message string) {
+	resp := errorResponse{Error: errorMessage{Message: message}}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// Client embeds texts with the embed endpoint of a bot
+type Client struct {
+	// BaseURL is where the bot serves the endpoint, e.g. http://slackgpt:8081
+	BaseURL string
+	APIKey  string
+	// HTTPClient sends the requests, http.DefaultClient when nil
+	HTTPClient *http.Client
+}
+
+// Embed returns the embeddings of texts, in order
+func (c *Client) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	var embedded embedResponse
+	if err := c.post(ctx, embedRequest{Input: texts}, http.StatusOK, &embedded); err != nil {
+		return nil, err
+	}
+	return inOrder(embedded.Data, len(texts))
+}
+
+// EmbedLater asks for the embeddings of texts to be delivered to callbackURL once they are ready, and returns the
+// ID of the request the delivery carries
+func (c *Client) EmbedLater(ctx context.Context, texts []string, callbackURL string) (string, error) {
+	var accepted acceptedResponse
+	if err := c.post(ctx, embedRequest{Input: texts, CallbackURL: callbackURL}, http.StatusAccepted, &accepted); err != nil {
+		return "", err
+	}
+	return accepted.ID, nil
+}
+
+// post sends body to the endpoint and decodes its answer into out when it has status
+func (c *Client) post(ctx context.Context, body embedRequest, status int, out any) error {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(c.BaseURL, "/")+Path, bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != status {
+		var failed errorResponse
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 1024)).Decode(&failed)
+		return fmt.Errorf("%s: %s", resp.Status, failed.Error.Message)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
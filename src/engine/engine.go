@@ -0,0 +1,521 @@
+// Package engine builds the bot from its configuration, so other binaries can run it as cmd/slackgpt does
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	configs "github.com/chikamif/slackgpt/config"
+	"github.com/chikamif/slackgpt/src/cache"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/chikamif/slackgpt/src/metrics"
+	slackgpt "github.com/chikamif/slackgpt/src/slack"
+	"github.com/chikamif/slackgpt/src/tracing"
+	"github.com/chikamif/slackgpt/src/webhook"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/socketmode"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	// tracerShutdownTimeout is how long the spans not exported yet may take to be exported on Close
+	tracerShutdownTimeout = 5 * time.Second
+	// webhooksShutdownTimeout is how long the webhooks being delivered may keep being retried on Close
+	webhooksShutdownTimeout = 10 * time.Second
+	// tokenizerLoadTimeout is how long downloading the tokenizers may take before tokens are estimated instead
+	tokenizerLoadTimeout = 10 * time.Second
+)
+
+// Options are what the engine needs besides its configuration
+type Options struct {
+	// Logger receives the logs of the bot and of its slack clients, which are discarded when it is nil
+	Logger *log.Logger
+	// Mode is how slack's events are received, configs.ModeSocket when empty
+	Mode string
+	// Debug logs every request of the slack clients
+	Debug bool
+	// Provider answers questions instead of the one the configuration selects, e.g. a wrapped one
+	Provider chatgpt.ChatProvider
+	// Middlewares wrap the handling of every event of every bot, after the built-in ones
+	Middlewares []slackgpt.Middleware
+}
+
+// Engine is the bot with everything its configuration asks for: the chat provider, the stores and the slack
+// clients. Nothing is shared between engines, so a binary can run several.
+type Engine struct {
+	cfg         configs.Config
+	mode        string
+	logger      *log.Logger
+	provider    chatgpt.ChatProvider
+	metrics     *metrics.Metrics
+	caches      *cache.Registry
+	status      *slackgpt.HandlerStatus
+	deflections *slackgpt.DeflectionMetrics
+	tracer      *tracing.Tracer
+	webhooks    *webhook.Sender
+	args        slackgpt.EventHandlerArgs
+	// fleet are the configured Bots, run alongside the main bot
+	fleet   []fleetBot
+	closers []func() error
+}
+
+// New builds the engine cfg configures. Close releases the stores it opened.
+func New(cfg configs.Config, opts Options) (*Engine, error) {
+	if err := cfg.CheckMode(opts.Mode); err != nil {
+		return nil, err
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.New(io.Discard, "", 0)
+	}
+	e := &Engine{cfg: cfg, mode: opts.Mode, logger: logger, provider: opts.Provider, caches: cache.NewRegistry(), status: slackgpt.NewHandlerStatus()}
+	if e.provider == nil {
+		provider, err := NewProvider(cfg)
+		if err != nil {
+			return nil, err
+		}
+		e.provider = provider
+	}
+	if cfg.TracingEndpoint != "" {
+		tracer, err := tracing.New(tracing.Options{
+			Endpoint:    cfg.TracingEndpoint,
+			Headers:     cfg.TracingHeaders,
+			ServiceName: cfg.TracingServiceName,
+			SampleRatio: cfg.TracingSampleRatio,
+			Logger:      logger,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("TRACING_ENDPOINT: %w", err)
+		}
+		e.tracer = tracer
+		e.closers = append(e.closers, e.shutdownTracer)
+		e.provider = chatgpt.Trace(e.provider)
+	}
+	e.webhooks = webhook.New(webhook.Options{
+		Secret:         cfg.WebhookSecret,
+		Retries:        cfg.WebhookRetries,
+		RetryDelay:     cfg.WebhookRetryDelay,
+		DeadLetterFile: cfg.WebhookDeadLetterFile,
+		Logger:         logger,
+	})
+	e.closers = append(e.closers, e.closeWebhooks)
+	if cfg.MetricsAddr != "" {
+		e.metrics = metrics.New()
+		e.provider = chatgpt.Observe(e.provider, e.metrics)
+	}
+	slackOptions := e.slackOptions(cfg.SlackAppToken, logger, opts.Debug)
+	slackClient := slack.New(cfg.SlackBotToken, slackOptions...)
+	// slack's requests are served over HTTP without a socketmode client in http mode
+	var socketmodeClient *socketmode.Client
+	if opts.Mode != configs.ModeHTTP {
+		socketmodeClient = socketmode.New(slackClient, socketmode.OptionDebug(opts.Debug), socketmode.OptionLog(logger))
+	}
+	args, err := e.handlerArgs(slackClient, socketmodeClient, slackOptions)
+	if err != nil {
+		_ = e.Close()
+		return nil, err
+	}
+	args.Middlewares = opts.Middlewares
+	e.args = args
+	for _, bot := range cfg.Bots {
+		fleetBot, err := e.fleetBot(bot, opts.Debug)
+		if err != nil {
+			_ = e.Close()
+			return nil, err
+		}
+		e.fleet = append(e.fleet, fleetBot)
+	}
+	return e, nil
+}
+
+// slackOptions are the options of the slack clients of the app with appToken, logging to logger
+func (e *Engine) slackOptions(appToken string, logger *log.Logger, debug bool) []slack.Option {
+	options := []slack.Option{
+		slack.OptionDebug(debug),
+		slack.OptionAppLevelToken(appToken),
+		slack.OptionLog(logger),
+	}
+	if e.cfg.SlackAPIURL != "" {
+		options = append(options, slack.OptionAPIURL(e.cfg.SlackAPIURL))
+	}
+	if e.tracer != nil {
+		options = append(options, slack.OptionHTTPClient(&http.Client{Transport: tracing.Transport(nil)}))
+	}
+	return options
+}
+
+// shutdownTracer exports the spans not exported yet
+func (e *Engine) shutdownTracer() error {
+	ctx, cancel := context.WithTimeout(context.Background(), tracerShutdownTimeout)
+	defer cancel()
+	return e.tracer.Shutdown(ctx)
+}
+
+// closeWebhooks waits for the webhooks being delivered, dead-lettering those still failing after a while
+func (e *Engine) closeWebhooks() error {
+	ctx, cancel := context.WithTimeout(context.Background(), webhooksShutdownTimeout)
+	defer cancel()
+	if err := e.webhooks.Close(ctx); err != nil {
+		return fmt.Errorf("delivering webhooks: %w", err)
+	}
+	return nil
+}
+
+// handlerArgs opens the stores cfg asks for and returns the handler's args, with the stores to close in closers
+func (e *Engine) handlerArgs(slackClient *slack.Client, socketmodeClient *socketmode.Client, slackOptions []slack.Option) (slackgpt.EventHandlerArgs, error) {
+	cfg := e.cfg
+	var err error
+	var installations *slackgpt.InstallationStore
+	if cfg.SlackClientID != "" {
+		if installations, err = slackgpt.NewInstallationStore(cfg.InstallationsFile); err != nil {
+			return slackgpt.EventHandlerArgs{}, err
+		}
+	}
+	var consents *slackgpt.ConsentStore
+	if cfg.RequireConsent {
+		if consents, err = slackgpt.NewConsentStore(cfg.ConsentFile); err != nil {
+			return slackgpt.EventHandlerArgs{}, err
+		}
+	}
+	var policyAcks *slackgpt.PolicyStore
+	if cfg.UsagePolicy != "" {
+		if policyAcks, err = slackgpt.NewPolicyStore(cfg.PolicyAckFile); err != nil {
+			return slackgpt.EventHandlerArgs{}, err
+		}
+	}
+	offPeakWindows := make([]slackgpt.OffPeakWindow, len(cfg.OffPeakWindows))
+	for i, window := range cfg.OffPeakWindows {
+		if offPeakWindows[i], err = slackgpt.ParseOffPeakWindow(window); err != nil {
+			return slackgpt.EventHandlerArgs{}, err
+		}
+	}
+	var batchQueue *slackgpt.BatchQueue
+	// without a fallback questions asked during maintenance windows are queued
+	if len(cfg.LowPriorityChannels) > 0 || len(offPeakWindows) > 0 || len(cfg.MaintenanceWindows) > 0 && cfg.FallbackProvider == "" {
+		if batchQueue, err = slackgpt.NewBatchQueue(cfg.BatchQueueFile); err != nil {
+			return slackgpt.EventHandlerArgs{}, err
+		}
+	}
+	prompts, err := slackgpt.NewPromptStore(cfg.PromptHistoryFile)
+	if err != nil {
+		return slackgpt.EventHandlerArgs{}, err
+	}
+	faqs, err := slackgpt.NewFAQStore(cfg.FAQFile)
+	if err != nil {
+		return slackgpt.EventHandlerArgs{}, err
+	}
+	var feedback *slackgpt.FeedbackStore
+	if cfg.Feedback {
+		if feedback, err = slackgpt.NewFeedbackStore(cfg.FeedbackFile); err != nil {
+			return slackgpt.EventHandlerArgs{}, err
+		}
+	}
+	usage, err := slackgpt.NewUsageStore(cfg.UsageFile)
+	if err != nil {
+		return slackgpt.EventHandlerArgs{}, err
+	}
+	prices := make(map[string]slackgpt.ModelPrice, len(slackgpt.DefaultModelPrices)+len(cfg.ModelPrices))
+	for model, price := range slackgpt.DefaultModelPrices {
+		prices[model] = price
+	}
+	for model, price := range cfg.ModelPrices {
+		prices[model] = slackgpt.ModelPrice(price)
+	}
+	channelBudgets := make(map[string]slackgpt.Budget, len(cfg.ChannelBudgets))
+	for channel, budget := range cfg.ChannelBudgets {
+		channelBudgets[channel] = slackgpt.Budget(budget)
+	}
+	teamBudgets := make(map[string]slackgpt.TeamBudget, len(cfg.TeamBudgets))
+	for group, budget := range cfg.TeamBudgets {
+		teamBudgets[group] = slackgpt.TeamBudget{
+			Budget: slackgpt.Budget{Tokens: budget.Tokens, Cost: budget.Cost}, Warn: budget.Warn, Leads: budget.Leads,
+		}
+	}
+	var schedules *slackgpt.ScheduleStore
+	if cfg.Scheduling {
+		if schedules, err = slackgpt.NewScheduleStore(cfg.ScheduleFile); err != nil {
+			return slackgpt.EventHandlerArgs{}, err
+		}
+	}
+	var actionItems *slackgpt.ActionItemStore
+	if cfg.ActionItems {
+		if actionItems, err = slackgpt.NewActionItemStore(cfg.ActionItemsFile); err != nil {
+			return slackgpt.EventHandlerArgs{}, err
+		}
+	}
+	var userSettings *slackgpt.UserSettingsStore
+	if cfg.AppHome {
+		if userSettings, err = slackgpt.NewUserSettingsStore(cfg.UserSettingsFile); err != nil {
+			return slackgpt.EventHandlerArgs{}, err
+		}
+	}
+	var shared *slackgpt.SharedChannelPolicy
+	if cfg.SharedChannelPolicy {
+		shared = &slackgpt.SharedChannelPolicy{Tools: cfg.SharedChannelTools, Grounding: cfg.SharedChannelGrounding, Disclosure: cfg.SharedChannelDisclosure}
+		if shared.Disclosure == "" {
+			shared.Disclosure = slackgpt.DefaultSharedChannelDisclosure
+		}
+	}
+	var knowledge string
+	if cfg.KnowledgeBase != "" {
+		if knowledge, err = slackgpt.LoadKnowledgeBase(cfg.KnowledgeBase); err != nil {
+			return slackgpt.EventHandlerArgs{}, err
+		}
+	}
+	if len(cfg.DeflectionChannels) > 0 {
+		e.deflections = &slackgpt.DeflectionMetrics{}
+	}
+	variants := make([]slackgpt.BranchVariant, len(cfg.BranchVariants))
+	for i, variant := range cfg.BranchVariants {
+		variants[i] = slackgpt.BranchVariant(variant)
+	}
+	forms := make([]slackgpt.Form, len(cfg.Forms))
+	for i, form := range cfg.Forms {
+		fields := make([]slackgpt.FormField, len(form.Fields))
+		for j, field := range form.Fields {
+			fields[j] = slackgpt.FormField(field)
+		}
+		forms[i] = slackgpt.Form{Name: form.Name, Description: form.Description, Fields: fields, Channel: form.Channel, Webhook: form.Webhook}
+	}
+	routes := make([]chatgpt.Route, len(cfg.ModelRoutes))
+	for i, route := range cfg.ModelRoutes {
+		routes[i] = chatgpt.Route{Name: route.Name, Task: chatgpt.Task(route.Task), MaxPromptTokens: route.MaxPromptTokens, Model: route.Model}
+	}
+	thinkingMessage := ""
+	if cfg.ThinkingPlaceholder {
+		thinkingMessage = cfg.ThinkingMessage
+	}
+	channels := make(map[string]slackgpt.ChannelSettings, len(cfg.Channels))
+	for channel, settings := range cfg.Channels {
+		channels[channel] = slackgpt.ChannelSettings(settings)
+	}
+	tiers := make([]slackgpt.OverrideTier, len(cfg.OverrideTiers))
+	for i, tier := range cfg.OverrideTiers {
+		tiers[i] = slackgpt.OverrideTier(tier)
+	}
+	conversations, closeConversations, err := OpenConversationStore(cfg)
+	if err != nil {
+		return slackgpt.EventHandlerArgs{}, err
+	}
+	e.closers = append(e.closers, closeConversations)
+	seenEvents, closeSeenEvents, err := OpenSeenEvents(cfg)
+	if err != nil {
+		return slackgpt.EventHandlerArgs{}, err
+	}
+	e.closers = append(e.closers, closeSeenEvents)
+	tokenizerCtx, cancel := context.WithTimeout(context.Background(), tokenizerLoadTimeout)
+	defer cancel()
+	countTokens, err := chatgpt.NewTiktokenCounter(tokenizerCtx)
+	if err != nil {
+		e.logger.Printf("estimating tokens, the tokenizer could not be loaded: %v\n", err)
+		countTokens = chatgpt.EstimateTokens
+	}
+	return slackgpt.EventHandlerArgs{
+		Logger:                    e.logger,
+		SlackClient:               slackClient,
+		SocketModeClient:          socketmodeClient,
+		Installations:             installations,
+		GPTClient:                 e.provider,
+		MaxConversations:          cfg.CacheMaxConversations,
+		MaxConversationBytes:      cfg.CacheMaxBytes,
+		Conversations:             conversations,
+		Caches:                    e.caches,
+		OnQuestionEdit:            slackgpt.EditAction(cfg.QuestionEditAction),
+		QuestionEditWindow:        cfg.QuestionEditWindow,
+		DeleteRepliesWithQuestion: cfg.DeleteRepliesWithQuestion,
+		IgnoredUsers:              cfg.IgnoredUsers,
+		AllowedChannels:           cfg.AllowedChannels,
+		RequiredUserGroup:         cfg.RequiredUserGroup,
+		NoRetentionChannels:       cfg.NoRetentionChannels,
+		SharedChannelPolicy:       shared,
+		AllowBots:                 cfg.AllowBotMessages,
+		BotLoopLimit:              cfg.BotLoopLimit,
+		MentionMode:               slackgpt.MentionMode(cfg.MentionMode),
+		ExpandEmoji:               cfg.ExpandEmoji,
+		RequireConsent:            cfg.RequireConsent,
+		Consents:                  consents,
+		ConsentText:               cfg.ConsentText,
+		UsagePolicy:               cfg.UsagePolicy,
+		PolicyAckInterval:         cfg.PolicyAckInterval,
+		PolicyAcks:                policyAcks,
+		Hedge:                     slackgpt.HedgeAction(cfg.HedgeAction),
+		ConfidenceThreshold:       cfg.ConfidenceThreshold,
+		HedgeChannels:             cfg.HedgeChannels,
+		HumanChannel:              cfg.HumanChannel,
+		EscalationGroup:           cfg.EscalationGroup,
+		EscalationChannel:         cfg.EscalationChannel,
+		DeflectionChannels:        cfg.DeflectionChannels,
+		KnowledgeBase:             knowledge,
+		DeflectionMetrics:         e.deflections,
+		SystemPrompt:              cfg.SystemPrompt,
+		ChannelSystemPrompts:      cfg.ChannelSystemPrompts,
+		Channels:                  channels,
+		TitleThreads:              cfg.TitleThreads,
+		Prompts:                   prompts,
+		AdminUsers:                cfg.AdminUsers,
+		BranchVariants:            variants,
+		FAQs:                      faqs,
+		FAQThreshold:              cfg.FAQThreshold,
+		EmbeddingModel:            cfg.EmbeddingModel,
+		Feedback:                  feedback,
+		Usage:                     usage,
+		ModelPrices:               prices,
+		MonthlyBudget:             slackgpt.Budget{Tokens: cfg.MonthlyTokenBudget, Cost: cfg.MonthlyCostBudget},
+		ChannelBudgets:            channelBudgets,
+		TeamBudgets:               teamBudgets,
+		BudgetAlertChannel:        cfg.BudgetAlertChannel,
+		AdminChannel:              cfg.AdminChannel,
+		LoadStatusChannels:        cfg.LoadStatusChannels,
+		LoadPresence:              cfg.LoadStatusPresence,
+		LoadBusyThreshold:         cfg.LoadBusyThreshold,
+		LoadStatusInterval:        cfg.LoadStatusInterval,
+		BookmarkChannels:          cfg.BookmarkChannels,
+		BookmarkRefresh:           cfg.BookmarkRefresh,
+		DirectoryLookup:           cfg.DirectoryLookup,
+		Owners:                    cfg.Owners,
+		BuiltinTools:              cfg.Tools,
+		CommandAliases:            cfg.CommandAliases,
+		MaxContextTokens:          cfg.MaxContextTokens,
+		CountTokens:               countTokens,
+		Clarify:                   cfg.Clarify,
+		ThinkingMessage:           thinkingMessage,
+		TriggerReaction:           cfg.TriggerReaction,
+		BlockKit:                  cfg.BlockKit,
+		AnswerButtons:             cfg.AnswerButtons,
+		LowPriorityChannels:       cfg.LowPriorityChannels,
+		OffPeakWindows:            offPeakWindows,
+		BatchQueue:                batchQueue,
+		Images:                    cfg.Images,
+		ImageModel:                cfg.ImageModel,
+		ImageSize:                 cfg.ImageSize,
+		Vision:                    cfg.Vision,
+		VisionModel:               cfg.VisionModel,
+		Transcribe:                cfg.Transcribe,
+		TranscriptionModel:        cfg.TranscriptionModel,
+		Forms:                     forms,
+		ApprovalChannels:          cfg.ApprovalChannels,
+		ApprovalReviewChannel:     cfg.ApprovalReviewChannel,
+		Schedules:                 schedules,
+		ActionItems:               actionItems,
+		UserSettings:              userSettings,
+		UserRateLimit:             cfg.UserRateLimit,
+		ChannelRateLimit:          cfg.ChannelRateLimit,
+		RateLimitWindow:           cfg.RateLimitWindow,
+		Moderation:                cfg.Moderation,
+		ModerationBlock:           cfg.ModerationBlock,
+		ModerationWarn:            cfg.ModerationWarn,
+		ModelRoutes:               routes,
+		TriageModel:               cfg.TriageModel,
+		OverrideTiers:             tiers,
+		ModelAllowlist:            cfg.ModelAllowlist,
+		Status:                    e.status,
+		Metrics:                   e.metrics,
+		Tracer:                    e.tracer,
+		Webhooks:                  e.webhooks,
+		SeenEvents:                seenEvents,
+		DedupTTL:                  cfg.DedupTTL,
+		QualitySampleRate:         cfg.QualitySampleRate,
+		QualityJudgeModel:         cfg.QualityJudgeModel,
+		DrainTimeout:              cfg.DrainTimeout,
+		MaxConcurrentRequests:     cfg.MaxConcurrentRequests,
+		RequestQueueSize:          cfg.RequestQueueSize,
+		// installed workspaces are answered through the same API URL and logger
+		NewSlackClient: func(token string) *slack.Client {
+			return slack.New(token, slackOptions...)
+		},
+		OAuth: slackgpt.OAuth{
+			ClientID:     cfg.SlackClientID,
+			ClientSecret: cfg.SlackClientSecret,
+			Scopes:       cfg.SlackOAuthScopes,
+			RedirectURL:  cfg.SlackOAuthRedirectURL,
+		},
+	}, nil
+}
+
+// Run handles slack's events, those of every configured bot too, until ctx is cancelled or receiving them fails,
+// then drains the events in flight for up to the configured drain timeout. When one bot stops the others do too.
+func (e *Engine) Run(ctx context.Context) error {
+	primary := fleetBot{args: e.args, httpAddr: e.cfg.HTTPAddr, signingSecret: e.cfg.SlackSigningSecret}
+	if len(e.fleet) == 0 {
+		return e.run(ctx, primary)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	bots := append([]fleetBot{primary}, e.fleet...)
+	done := make(chan error, len(bots))
+	for _, bot := range bots {
+		go func(bot fleetBot) { done <- e.run(ctx, bot) }(bot)
+	}
+	errs := make([]error, len(bots))
+	for i := range bots {
+		errs[i] = <-done
+		cancel()
+	}
+	return errors.Join(errs...)
+}
+
+// run handles the events of bot until ctx is cancelled or receiving them fails
+func (e *Engine) run(ctx context.Context, bot fleetBot) error {
+	args := bot.args
+	args.Context = ctx
+	if e.mode == configs.ModeHTTP {
+		args.Logger.Printf("slack http event handler started on %v\n", bot.httpAddr)
+		return slackgpt.HTTPEventHandler(args, bot.httpAddr, bot.signingSecret)
+	}
+	args.Logger.Printf("slack event handler started\n")
+	return slackgpt.EventHandler(args, args.NewSocketmodeHandler())
+}
+
+// Processor returns a processor answering the events handed to it as the main bot does, for binaries receiving
+// slack's events some other way, e.g. from a queue
+func (e *Engine) Processor() *slackgpt.EventProcessor {
+	return slackgpt.NewEventProcessor(e.args)
+}
+
+// Close closes the stores the engine opened, once it is done running
+func (e *Engine) Close() error {
+	var errs []error
+	for _, closeStore := range e.closers {
+		errs = append(errs, closeStore())
+	}
+	e.closers = nil
+	return errors.Join(errs...)
+}
+
+// Config returns the configuration the engine was built from
+func (e *Engine) Config() configs.Config {
+	return e.cfg
+}
+
+// Provider returns the chat provider questions are answered with, observed by Metrics when there are any
+func (e *Engine) Provider() chatgpt.ChatProvider {
+	return e.provider
+}
+
+// Metrics returns the metrics of the engine, nil unless the configuration has a metrics address
+func (e *Engine) Metrics() *metrics.Metrics {
+	return e.metrics
+}
+
+// Caches returns the registry of the engine's in-memory caches
+func (e *Engine) Caches() *cache.Registry {
+	return e.caches
+}
+
+// Webhooks returns the sender delivering the payloads of the bot's webhooks and API callbacks
+func (e *Engine) Webhooks() *webhook.Sender {
+	return e.webhooks
+}
+
+// Status returns what the main bot's handler is doing
+func (e *Engine) Status() *slackgpt.HandlerStatus {
+	return e.status
+}
+
+// Deflections returns the deflection metrics of the support channels, nil when there are none
+func (e *Engine) Deflections() *slackgpt.DeflectionMetrics {
+	return e.deflections
+}
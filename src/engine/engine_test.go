@@ -0,0 +1,185 @@
+package engine
+
+import (
+	"context"
+	configs "github.com/chikamif/slackgpt/config"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testConfig is the config of a bot answering through slackServer and gptServer
+func testConfig(t *testing.T, slackServer *fake.Slack, gptServer *fake.OpenAI) configs.Config {
+	t.Setenv("CGPT_API_KEY", "sk-test")
+	t.Setenv("SLACK_APP_TOKEN", "xapp-test")
+	t.Setenv("SLACK_BOT_TOKEN", "xoxb-test")
+	cfg, err := configs.LoadConfigFromEnv()
+	require.NoError(t, err)
+	cfg.SlackAPIURL, cfg.ChatGPTBaseURL = slackServer.APIURL(), gptServer.URL()
+	return cfg
+}
+
+func TestEnginesShareNothing(t *testing.T) {
+	gptServer := fake.NewOpenAI(0)
+	defer gptServer.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	servers := []*fake.Slack{fake.NewSlack(), fake.NewSlack()}
+	runErrs := make(chan error, len(servers))
+	for _, slackServer := range servers {
+		defer slackServer.Close()
+		bot, err := New(testConfig(t, slackServer, gptServer), Options{})
+		require.NoError(t, err)
+		defer bot.Close()
+		assert.NotNil(t, bot.Provider())
+		assert.Nil(t, bot.Metrics(), "metrics are only kept with a metrics address")
+		go func() { runErrs <- bot.Run(ctx) }()
+		waitCtx, stop := context.WithTimeout(ctx, 10*time.Second)
+		require.NoError(t, slackServer.WaitConnected(waitCtx))
+		stop()
+	}
+
+	for _, slackServer := range servers {
+		_, err := slackServer.SendEvent(slackevents.AppMentionEvent{
+			Type: string(slackevents.AppMention), User: "U1", Text: "<@U0BOT> what is go", Channel: "C1", TimeStamp: "1.000001",
+		})
+		require.NoError(t, err)
+	}
+	// the answer may replace a placeholder, posted first
+	for _, slackServer := range servers {
+		require.Eventually(t, func() bool {
+			messages := slackServer.Messages()
+			return len(messages) == 1 && strings.Contains(messages[0].Text, "fake answer to: what is go")
+		}, 10*time.Second, 10*time.Millisecond)
+	}
+	cancel()
+	for range servers {
+		assert.NoError(t, <-runErrs)
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	slackServer, gptServer := fake.NewSlack(), fake.NewOpenAI(0)
+	defer slackServer.Close()
+	defer gptServer.Close()
+	cfg := testConfig(t, slackServer, gptServer)
+	_, err := New(cfg, Options{Mode: configs.ModeHTTP})
+	assert.Error(t, err, "http mode needs a signing secret")
+
+	cfg.ConversationStore = "redis"
+	_, err = New(cfg, Options{})
+	assert.ErrorContains(t, err, "REDIS_URL")
+}
+
+func TestProcessor(t *testing.T) {
+	slackServer, gptServer := fake.NewSlack(), fake.NewOpenAI(0)
+	defer slackServer.Close()
+	defer gptServer.Close()
+	cfg := testConfig(t, slackServer, gptServer)
+	cfg.SlackSigningSecret = "secret"
+	cfg.AllowedChannels = []string{"C1"}
+	cfg.UserRateLimit = 1
+	bot, err := New(cfg, Options{Mode: configs.ModeHTTP})
+	require.NoError(t, err)
+	defer bot.Close()
+	processor := bot.Processor()
+	mention := func(channel, ts string) {
+		processor.Process(context.Background(), slackevents.EventsAPIEvent{InnerEvent: slackevents.EventsAPIInnerEvent{
+			Data: &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: channel, TimeStamp: ts},
+		}})
+	}
+
+	mention("C2", "1.000001")
+	mention("C1", "2.000001")
+	mention("C1", "3.000001")
+	messages := slackServer.Messages()
+	require.Len(t, messages, 1, "questions are answered with the configured access control and rate limits")
+	assert.Equal(t, "C1", messages[0].Channel)
+	assert.Contains(t, messages[0].Text, "fake answer to: what is go")
+	assert.Equal(t, int64(1), gptServer.Requests())
+	assert.Len(t, slackServer.Ephemerals(), 2)
+}
+
+func TestTracing(t *testing.T) {
+	slackServer, gptServer := fake.NewSlack(), fake.NewOpenAI(0)
+	defer slackServer.Close()
+	defer gptServer.Close()
+	collector := fake.NewCollector()
+	defer collector.Close()
+	cfg := testConfig(t, slackServer, gptServer)
+	cfg.TracingEndpoint = collector.URL()
+	bot, err := New(cfg, Options{})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runErr := make(chan error, 1)
+	go func() { runErr <- bot.Run(ctx) }()
+	waitCtx, stop := context.WithTimeout(ctx, 10*time.Second)
+	defer stop()
+	require.NoError(t, slackServer.WaitConnected(waitCtx))
+
+	_, err = slackServer.SendEvent(slackevents.AppMentionEvent{
+		Type: string(slackevents.AppMention), User: "U1", Text: "<@U0BOT> what is go", Channel: "C1", TimeStamp: "1.000001",
+	})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return len(slackServer.Messages()) == 1 }, 10*time.Second, 10*time.Millisecond)
+	cancel()
+	require.NoError(t, <-runErr)
+	require.NoError(t, bot.Close())
+
+	spans := map[string]string{}
+	for _, span := range collector.Spans() {
+		spans[span.Name] = span.TraceID
+	}
+	trace := spans["slack app_mention"]
+	require.NotEmpty(t, trace, "the event is traced")
+	for _, name := range []string{"chat " + chatgpt.DefaultModel, "POST /v1/chat/completions", "POST /api/chat.postMessage"} {
+		assert.Equal(t, trace, spans[name], "%s is traced under the event", name)
+	}
+}
+
+func TestServe(t *testing.T) {
+	slackServer, gptServer := fake.NewSlack(), fake.NewOpenAI(0)
+	defer slackServer.Close()
+	defer gptServer.Close()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, listener.Close())
+	cfg := testConfig(t, slackServer, gptServer)
+	cfg.MetricsAddr, cfg.DiagDir = listener.Addr().String(), t.TempDir()
+	bot, err := New(cfg, Options{})
+	require.NoError(t, err)
+	defer bot.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	diagnostics := make(chan os.Signal, 1)
+	served := make(chan error, 1)
+	go func() { served <- bot.Serve(ctx, diagnostics) }()
+
+	require.Eventually(t, func() bool {
+		resp, err := http.Get("http://" + cfg.MetricsAddr + "/metrics")
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return strings.Contains(string(body), "slackgpt_queued_events")
+	}, 10*time.Second, 10*time.Millisecond, "the metrics are served")
+	diagnostics <- os.Interrupt
+	require.Eventually(t, func() bool {
+		dumps, _ := filepath.Glob(filepath.Join(cfg.DiagDir, "slackgpt-diag-*.txt"))
+		return len(dumps) == 1
+	}, 10*time.Second, 10*time.Millisecond, "diagnostics are dumped without stopping the bot")
+	cancel()
+	assert.NoError(t, <-served)
+}
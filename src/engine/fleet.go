@@ -0,0 +1,120 @@
+package engine
+
+import (
+	"context"
+	configs "github.com/chikamif/slackgpt/config"
+	slackgpt "github.com/chikamif/slackgpt/src/slack"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/socketmode"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// fleetBot is one of the configured Bots, served next to the main bot by the same engine
+type fleetBot struct {
+	name string
+	args slackgpt.EventHandlerArgs
+	// httpAddr and signingSecret receive its requests in http mode
+	httpAddr      string
+	signingSecret string
+}
+
+// fleetBot builds the handler's args of bot from the main bot's: it shares the provider and the stores, but has
+// slack clients, a persona, prompt history, scheduled posts and queued questions of its own, and keeps its
+// conversations and the events it handled apart from the other bots'
+func (e *Engine) fleetBot(bot configs.Bot, debug bool) (fleetBot, error) {
+	logger := log.New(e.logger.Writer(), e.logger.Prefix()+bot.Name+": ", e.logger.Flags())
+	args := e.args
+	args.Logger = logger
+	args.SlackClient = slack.New(bot.SlackBotToken, e.slackOptions(bot.SlackAppToken, logger, debug)...)
+	args.SocketModeClient = nil
+	if e.mode != configs.ModeHTTP {
+		args.SocketModeClient = socketmode.New(args.SlackClient, socketmode.OptionDebug(debug), socketmode.OptionLog(logger))
+	}
+	// other workspaces install the main app only
+	args.Installations, args.NewSlackClient, args.OAuth = nil, nil, slackgpt.OAuth{}
+	if args.Conversations != nil {
+		args.Conversations = prefixedStore{store: args.Conversations, prefix: bot.Name + "/"}
+	}
+	if args.SeenEvents != nil {
+		args.SeenEvents = prefixedEvents{seen: args.SeenEvents, prefix: bot.Name + "/"}
+	}
+	args.Caches = e.caches.WithPrefix(bot.Name + "/")
+	// the status reports the main bot's socketmode queue, a bot has its own
+	args.Status = slackgpt.NewHandlerStatus()
+	if bot.SystemPrompt != "" {
+		args.SystemPrompt, args.ChannelSystemPrompts = bot.SystemPrompt, nil
+		args.Channels = make(map[string]slackgpt.ChannelSettings, len(e.args.Channels))
+		for channel, settings := range e.args.Channels {
+			settings.SystemPrompt = ""
+			args.Channels[channel] = settings
+		}
+	}
+	var err error
+	if args.Prompts, err = slackgpt.NewPromptStore(botFile(e.cfg.PromptHistoryFile, bot.Name)); err != nil {
+		return fleetBot{}, err
+	}
+	if args.Schedules != nil {
+		if args.Schedules, err = slackgpt.NewScheduleStore(botFile(e.cfg.ScheduleFile, bot.Name)); err != nil {
+			return fleetBot{}, err
+		}
+	}
+	if args.ActionItems != nil {
+		if args.ActionItems, err = slackgpt.NewActionItemStore(botFile(e.cfg.ActionItemsFile, bot.Name)); err != nil {
+			return fleetBot{}, err
+		}
+	}
+	if args.UserSettings != nil {
+		if args.UserSettings, err = slackgpt.NewUserSettingsStore(botFile(e.cfg.UserSettingsFile, bot.Name)); err != nil {
+			return fleetBot{}, err
+		}
+	}
+	if args.BatchQueue != nil {
+		if args.BatchQueue, err = slackgpt.NewBatchQueue(botFile(e.cfg.BatchQueueFile, bot.Name)); err != nil {
+			return fleetBot{}, err
+		}
+	}
+	return fleetBot{name: bot.Name, args: args, httpAddr: bot.HTTPAddr, signingSecret: bot.SlackSigningSecret}, nil
+}
+
+// botFile is the file the bot named name keeps what is kept in path for the main bot in, e.g. prompts.docs.json
+// for prompts.json, empty when path is
+func botFile(path, name string) string {
+	if path == "" {
+		return ""
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + name + ext
+}
+
+// prefixedEvents remembers the events a bot handled under IDs starting with prefix, so that bots sharing a
+// store do not skip each other's events
+type prefixedEvents struct {
+	seen   slackgpt.SeenEvents
+	prefix string
+}
+
+func (e prefixedEvents) Seen(ctx context.Context, id string, ttl time.Duration) (bool, error) {
+	return e.seen.Seen(ctx, e.prefix+id, ttl)
+}
+
+// prefixedStore keeps the conversations of a bot under keys starting with prefix, so that bots sharing a store
+// do not continue each other's conversations
+type prefixedStore struct {
+	store  slackgpt.ConversationStore
+	prefix string
+}
+
+func (s prefixedStore) Load(ctx context.Context, key string) ([]string, bool, error) {
+	return s.store.Load(ctx, s.prefix+key)
+}
+
+func (s prefixedStore) Save(ctx context.Context, key string, history []string) error {
+	return s.store.Save(ctx, s.prefix+key, history)
+}
+
+func (s prefixedStore) Delete(ctx context.Context, key string) error {
+	return s.store.Delete(ctx, s.prefix+key)
+}
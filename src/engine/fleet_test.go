@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"context"
+	configs "github.com/chikamif/slackgpt/config"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+)
+
+func TestFleet(t *testing.T) {
+	slackServer, gptServer := fake.NewSlack(), fake.NewOpenAI(0)
+	defer slackServer.Close()
+	defer gptServer.Close()
+	cfg := testConfig(t, slackServer, gptServer)
+	cfg.SystemPrompt = "You are a helpful assistant."
+	cfg.ChannelSystemPrompts = map[string]string{"C1": "You answer questions about the office."}
+	cfg.PromptHistoryFile = filepath.Join(t.TempDir(), "prompts.json")
+	cfg.Bots = []configs.Bot{{Name: "docs", SlackAppToken: "xapp-docs", SlackBotToken: "xoxb-docs", SystemPrompt: "You are DocsBot, you answer from our docs."}}
+	bot, err := New(cfg, Options{})
+	require.NoError(t, err)
+	defer bot.Close()
+
+	require.Len(t, bot.fleet, 1)
+	docs := bot.fleet[0].args
+	assert.Equal(t, "You are DocsBot, you answer from our docs.", docs.SystemPrompt)
+	assert.Nil(t, docs.ChannelSystemPrompts, "the persona applies in every channel")
+	assert.Equal(t, "You are a helpful assistant.", bot.args.SystemPrompt)
+	assert.NotSame(t, bot.args.Prompts, docs.Prompts)
+	assert.NotSame(t, bot.args.SlackClient, docs.SlackClient)
+	assert.Equal(t, bot.args.GPTClient, docs.GPTClient, "the provider is shared")
+	assert.Same(t, bot.args.Usage, docs.Usage, "the stores are shared")
+
+	_, err = New(configs.Config{Bots: []configs.Bot{{Name: "docs"}}}, Options{})
+	assert.ErrorContains(t, err, "BOTS[0].slack_bot_token")
+}
+
+func TestBotFile(t *testing.T) {
+	assert.Equal(t, "prompts.docs.json", botFile("prompts.json", "docs"))
+	assert.Equal(t, "/var/lib/slackgpt/queue.docs", botFile("/var/lib/slackgpt/queue", "docs"))
+	assert.Equal(t, "", botFile("", "docs"))
+}
+
+// memoryStore is a ConversationStore in a map
+type memoryStore map[string][]string
+
+func (s memoryStore) Load(_ context.Context, key string) ([]string, bool, error) {
+	history, ok := s[key]
+	return history, ok, nil
+}
+
+func (s memoryStore) Save(_ context.Context, key string, history []string) error {
+	s[key] = history
+	return nil
+}
+
+func (s memoryStore) Delete(_ context.Context, key string) error {
+	delete(s, key)
+	return nil
+}
+
+func TestPrefixedStore(t *testing.T) {
+	ctx := context.Background()
+	shared := memoryStore{}
+	docs, oncall := prefixedStore{shared, "docs/"}, prefixedStore{shared, "oncall/"}
+	require.NoError(t, shared.Save(ctx, "1.0C1", []string{"main"}))
+	require.NoError(t, docs.Save(ctx, "1.0C1", []string{"docs"}))
+
+	history, ok, err := docs.Load(ctx, "1.0C1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"docs"}, history)
+	_, ok, err = oncall.Load(ctx, "1.0C1")
+	require.NoError(t, err)
+	assert.False(t, ok, "bots do not continue each other's conversations")
+
+	require.NoError(t, docs.Delete(ctx, "1.0C1"))
+	assert.Equal(t, memoryStore{"1.0C1": {"main"}}, shared)
+}
@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	configs "github.com/chikamif/slackgpt/config"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/chikamif/slackgpt/src/report"
+	slackgpt "github.com/chikamif/slackgpt/src/slack"
+	"log"
+	"time"
+)
+
+// Import imports records into the stores cfg configures, conversations, faqs or both as into names them. A dry
+// run only checks that the stores are configured. FAQs are embedded when the provider embeds text, otherwise
+// once questions are matched, which is logged to logger.
+func Import(ctx context.Context, cfg configs.Config, records []slackgpt.ImportRecord, into []string, dryRun bool, logger *log.Logger) (slackgpt.ImportResult, error) {
+	opts := slackgpt.ImportOptions{Author: "import", EmbeddingModel: cfg.EmbeddingModel}
+	for _, store := range into {
+		switch store {
+		case "conversations":
+			conversations, closeStore, err := OpenConversationStore(cfg)
+			if err != nil {
+				return slackgpt.ImportResult{}, err
+			}
+			if conversations == nil {
+				return slackgpt.ImportResult{}, fmt.Errorf("conversations are only kept in memory, set CONVERSATION_STORE to redis or sqlite to import them")
+			}
+			defer closeStore()
+			opts.Conversations = conversations
+		case "faqs":
+			if cfg.FAQFile == "" {
+				return slackgpt.ImportResult{}, fmt.Errorf("FAQs are only kept in memory, set FAQ_FILE to import them")
+			}
+			var err error
+			if opts.FAQs, err = slackgpt.NewFAQStore(cfg.FAQFile); err != nil {
+				return slackgpt.ImportResult{}, err
+			}
+			provider, err := NewProvider(cfg)
+			if err != nil {
+				return slackgpt.ImportResult{}, err
+			}
+			if embedder, ok := chatgpt.EmbedderOf(provider); ok {
+				opts.Embedder = embedder
+			} else {
+				logger.Printf("the provider cannot embed text, imported FAQs are embedded once questions are matched\n")
+			}
+		default:
+			return slackgpt.ImportResult{}, fmt.Errorf("--into must be conversations or faqs, got %q", store)
+		}
+	}
+	if dryRun {
+		return slackgpt.ImportResult{}, nil
+	}
+	return slackgpt.Import(ctx, records, opts)
+}
+
+// Report reports on the usage and feedback files cfg configures from since until now
+func Report(cfg configs.Config, since, now time.Time) (report.Report, error) {
+	if cfg.UsageFile == "" && cfg.FeedbackFile == "" {
+		return report.Report{}, fmt.Errorf("usage and feedback are only kept in memory, set USAGE_FILE or FEEDBACK_FILE to report on them")
+	}
+	usage, err := slackgpt.NewUsageStore(cfg.UsageFile)
+	if err != nil {
+		return report.Report{}, err
+	}
+	feedback, err := slackgpt.NewFeedbackStore(cfg.FeedbackFile)
+	if err != nil {
+		return report.Report{}, err
+	}
+	return report.Build(usage.List(), feedback.List(), since, now), nil
+}
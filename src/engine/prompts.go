@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"fmt"
+	configs "github.com/chikamif/slackgpt/config"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/chikamif/slackgpt/src/prompttest"
+)
+
+// PromptProvider returns the provider prompts are tested with: mock answers with a fake openai server that stop
+// shuts down, real with the provider cfg selects
+func PromptProvider(run string, cfg configs.Config) (provider chatgpt.ChatProvider, stop func(), err error) {
+	switch run {
+	case "mock":
+		gptServer := fake.NewOpenAI(0)
+		provider, err = chatgpt.NewProvider(chatgpt.ProviderConfig{APIKey: "sk-mock", BaseURL: gptServer.URL()})
+		return provider, gptServer.Close, err
+	case "real":
+		provider, err = NewProvider(cfg)
+		return provider, func() {}, err
+	default:
+		return nil, nil, fmt.Errorf("--run must be mock or real, got %q", run)
+	}
+}
+
+// PromptTemplates returns the prompts configured in cfg by the names prompt tests know them by: system,
+// channel/<channel ID> and branch/<variant name>
+func PromptTemplates(cfg configs.Config) prompttest.Templates {
+	system := cfg.SystemPrompt
+	if system == "" {
+		system = chatgpt.DefaultSystemPrompt
+	}
+	templates := prompttest.Templates{"system": {SystemPrompt: system}}
+	for channel, prompt := range cfg.ChannelSystemPrompts {
+		templates["channel/"+channel] = prompttest.Template{SystemPrompt: prompt}
+	}
+	for channel, settings := range cfg.Channels {
+		template := templates["channel/"+channel]
+		if settings.SystemPrompt != "" {
+			template.SystemPrompt = settings.SystemPrompt
+		}
+		if template.SystemPrompt == "" {
+			template.SystemPrompt = system
+		}
+		template.Model = settings.Model
+		templates["channel/"+channel] = template
+	}
+	for _, variant := range cfg.BranchVariants {
+		template := prompttest.Template{SystemPrompt: variant.SystemPrompt, Model: variant.Model}
+		if template.SystemPrompt == "" {
+			template.SystemPrompt = system
+		}
+		templates["branch/"+variant.Name] = template
+	}
+	return templates
+}
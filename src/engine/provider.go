@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"fmt"
+	configs "github.com/chikamif/slackgpt/config"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/chikamif/slackgpt/src/convostore"
+	slackgpt "github.com/chikamif/slackgpt/src/slack"
+	"github.com/sashabaranov/go-openai"
+)
+
+// NewProvider creates the chat provider cfg selects, with its fallback during its maintenance windows
+func NewProvider(cfg configs.Config) (chatgpt.ChatProvider, error) {
+	retry := chatgpt.RetryPolicy{MaxRetries: cfg.ChatMaxRetries, MaxDelay: cfg.ChatMaxRetryWait}
+	provider, err := chatgpt.NewProvider(chatgpt.ProviderConfig{
+		Provider:   chatgpt.Provider(cfg.ChatProvider),
+		APIKey:     cfg.ChatGPTKey,
+		BaseURL:    cfg.ChatGPTBaseURL,
+		Model:      cfg.ChatModel,
+		APIType:    openai.APIType(cfg.ChatAPIType),
+		APIVersion: cfg.ChatAPIVersion,
+		Deployment: cfg.AzureDeployment,
+		Retry:      retry,
+		Trace:      cfg.TracingEndpoint != "",
+	})
+	if err != nil || len(cfg.MaintenanceWindows) == 0 {
+		return provider, err
+	}
+	windows := make([]chatgpt.MaintenanceWindow, len(cfg.MaintenanceWindows))
+	for i, window := range cfg.MaintenanceWindows {
+		if windows[i], err = chatgpt.ParseMaintenanceWindow(window); err != nil {
+			return nil, err
+		}
+	}
+	var fallback chatgpt.ChatProvider
+	if cfg.FallbackProvider != "" {
+		fallback, err = chatgpt.NewProvider(chatgpt.ProviderConfig{
+			Provider: chatgpt.Provider(cfg.FallbackProvider),
+			APIKey:   cfg.FallbackKey,
+			BaseURL:  cfg.FallbackBaseURL,
+			Model:    cfg.FallbackModel,
+			Retry:    retry,
+			Trace:    cfg.TracingEndpoint != "",
+		})
+		if err != nil {
+			return nil, fmt.Errorf("fallback provider: %w", err)
+		}
+	}
+	return chatgpt.WithMaintenance(provider, fallback, windows), nil
+}
+
+// OpenConversationStore opens the store conversations are kept in besides memory, nil when they are only kept in
+// memory. closeStore closes it.
+func OpenConversationStore(cfg configs.Config) (store slackgpt.ConversationStore, closeStore func() error, err error) {
+	switch cfg.ConversationStore {
+	case "redis":
+		if cfg.RedisURL == "" {
+			return nil, nil, fmt.Errorf("CONVERSATION_STORE redis needs REDIS_URL")
+		}
+		r, err := convostore.NewRedis(cfg.RedisURL, cfg.ConversationTTL)
+		if err != nil {
+			return nil, nil, err
+		}
+		return r, r.Close, nil
+	case "sqlite":
+		s, err := convostore.OpenSQLite(cfg.SQLiteFile, cfg.ConversationTTL)
+		if err != nil {
+			return nil, nil, err
+		}
+		return s, s.Close, nil
+	default:
+		return nil, func() error { return nil }, nil
+	}
+}
+
+// OpenSeenEvents opens the store the events handled are remembered in, nil when they are remembered in memory.
+// closeStore closes it.
+func OpenSeenEvents(cfg configs.Config) (store slackgpt.SeenEvents, closeStore func() error, err error) {
+	if cfg.DedupStore != "redis" {
+		return nil, func() error { return nil }, nil
+	}
+	if cfg.RedisURL == "" {
+		return nil, nil, fmt.Errorf("DEDUP_STORE redis needs REDIS_URL")
+	}
+	r, err := convostore.NewRedisEvents(cfg.RedisURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, r.Close, nil
+}
@@ -0,0 +1,164 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	configs "github.com/chikamif/slackgpt/config"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/chikamif/slackgpt/src/diag"
+	"github.com/chikamif/slackgpt/src/embedapi"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// serverShutdownTimeout is how long the metrics server and the embed API may take to finish their requests
+const serverShutdownTimeout = 5 * time.Second
+
+// Serve runs the bot as Run does, alongside the metrics server, the embed API and the cache stats logs the
+// configuration asks for, until ctx is cancelled. Every value received on diagnostics dumps diagnostics without
+// interrupting the bot, e.g. on SIGUSR1.
+func (e *Engine) Serve(ctx context.Context, diagnostics <-chan os.Signal) error {
+	if e.metrics != nil {
+		stopMetrics := e.serveMetrics()
+		defer stopMetrics()
+	}
+	if e.cfg.APIAddr != "" {
+		stopAPI, err := e.serveAPI()
+		if err != nil {
+			return err
+		}
+		defer stopAPI()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if e.cfg.CacheStatsInterval > 0 {
+		go e.logCacheStats(ctx, e.cfg.CacheStatsInterval)
+	}
+	// sends happen before receives, so the goroutine returns before the servers shut down
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- e.Run(ctx)
+	}()
+	for {
+		select {
+		case err := <-runErr:
+			return err
+		case <-diagnostics:
+			e.DumpDiagnostics()
+		}
+	}
+}
+
+// serveMetrics serves the metrics, with gauges for the event queue and the caches, at /metrics on the metrics
+// address until the returned func is called
+func (e *Engine) serveMetrics() func() {
+	m, status, caches := e.metrics, e.status, e.caches
+	m.Registry.NewGaugeFunc("slackgpt_queued_events", "Slack events received but not yet dispatched.", nil, func(set func(float64, ...string)) {
+		set(float64(status.Snapshot().QueuedEvents))
+	})
+	m.Registry.NewGaugeFunc("slackgpt_active_events", "Slack events being handled.", nil, func(set func(float64, ...string)) {
+		set(float64(len(status.Snapshot().ActiveRequests)))
+	})
+	m.Registry.NewGaugeFunc("slackgpt_cache_entries", "Entries in each in-memory cache.", []string{"cache"}, func(set func(float64, ...string)) {
+		for _, stats := range caches.Stats() {
+			set(float64(stats.Entries), stats.Name)
+		}
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+	server := &http.Server{Addr: e.cfg.MetricsAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		e.logger.Printf("metrics server started on %v\n", e.cfg.MetricsAddr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			e.logger.Printf("metrics server failed: %v\n", err)
+		}
+	}()
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}
+}
+
+// serveAPI serves the embed endpoint to the callers of the API keys on the API address, embedding with the
+// provider, counting usage in the metrics and delivering the results asked for by callback with the webhooks,
+// until the returned func is called
+func (e *Engine) serveAPI() (func(), error) {
+	cfg := e.cfg
+	if len(cfg.APIKeys) == 0 {
+		return nil, configs.ValidationError{{Path: "API_KEYS", Message: "missing api keys", Suggestion: `a JSON object of API keys by caller, e.g. {"wiki-search": "<key>"}`}}
+	}
+	embedder, ok := chatgpt.EmbedderOf(e.provider)
+	if !ok {
+		return nil, fmt.Errorf("API_ADDR: the %s provider cannot embed text", cfg.ChatProvider)
+	}
+	service := embedapi.NewService(embedder, embedapi.Config{
+		Model:           cfg.EmbeddingModel,
+		RateLimit:       cfg.UserRateLimit,
+		RateLimitWindow: cfg.RateLimitWindow,
+		Usage:           e.metrics,
+		Callbacks:       e.webhooks,
+	})
+	mux := http.NewServeMux()
+	mux.Handle(embedapi.Path, embedapi.NewHandler(service, cfg.APIKeys, e.logger))
+	server := &http.Server{Addr: cfg.APIAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		e.logger.Printf("embed api started on %v for %d callers\n", cfg.APIAddr, len(cfg.APIKeys))
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			e.logger.Printf("embed api failed: %v\n", err)
+		}
+	}()
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+		// the requests answered by callback are embedded before the webhooks are closed with the engine
+		if err := service.Close(ctx); err != nil {
+			e.logger.Printf("failed embedding for callbacks: %v\n", err)
+		}
+	}, nil
+}
+
+// DumpDiagnostics writes goroutine stacks, queue depth, active requests and cache stats to a file in the
+// diagnostics directory, or to the log when there is none
+func (e *Engine) DumpDiagnostics() {
+	d := diag.Collect(e.status, e.caches)
+	summary := fmt.Sprintf("%d goroutines, %d queued events, active requests %v", d.Goroutines, d.Status.QueuedEvents, d.ActiveIDs())
+	if e.cfg.DiagDir == "" {
+		var report strings.Builder
+		d.WriteTo(&report)
+		e.logger.Printf("diagnostics: %s\n%s", summary, report.String())
+		return
+	}
+	path, err := d.WriteFile(e.cfg.DiagDir)
+	if err != nil {
+		e.logger.Printf("failed writing diagnostics: %v\n", err)
+		return
+	}
+	e.logger.Printf("diagnostics: %s, written to %s\n", summary, path)
+}
+
+// logCacheStats logs the size, hit rate and evictions of every registered cache every interval until ctx is
+// cancelled, and the deflection metrics when support channels are configured
+func (e *Engine) logCacheStats(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, s := range e.caches.Stats() {
+				e.logger.Printf("cache %s: %d/%d entries, %d/%d bytes, hit rate %.2f, %d evictions\n",
+					s.Name, s.Entries, s.MaxEntries, s.Bytes, s.MaxBytes, s.HitRate(), s.Evictions)
+			}
+			if e.deflections != nil {
+				d := e.deflections.Snapshot()
+				e.logger.Printf("deflection: %d answered, %d resolved, %d escalated, %d pending, rate %.2f\n",
+					d.Answered, d.Resolved, d.Escalated, d.Answered-d.Resolved-d.Escalated, d.Rate())
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// Package eval scores the bot's answers to golden questions against the properties their answers must have,
+// so changes to prompts, models or providers can be checked for regressions
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/sashabaranov/go-openai"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// Case is a question and the properties its answer must have
+type Case struct {
+	Name     string `json:"name"`
+	Question string `json:"question"`
+	// SystemPrompt answers the question, chatgpt.DefaultSystemPrompt when empty
+	SystemPrompt string `json:"system_prompt,omitempty"`
+	// Mentions must all appear in the answer and Avoids must not, regardless of case
+	Mentions []string `json:"mentions,omitempty"`
+	Avoids   []string `json:"avoids,omitempty"`
+	// Language the answer must be written in, "ja" or "en"
+	Language string `json:"language,omitempty"`
+	// MaxChars is the most characters the answer may have, 0 for any length
+	MaxChars int `json:"max_chars,omitempty"`
+}
+
+// Result is how an answer to a case did
+type Result struct {
+	Case   Case
+	Answer string
+	// Failures describe the properties the answer lacked, empty when it passed
+	Failures []string
+}
+
+// Passed reports whether the answer had every property of its case
+func (r Result) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// Report holds the results of a run, in the order of its cases
+type Report struct {
+	Results []Result
+}
+
+// Passed returns the number of cases whose answers passed
+func (r Report) Passed() int {
+	passed := 0
+	for _, result := range r.Results {
+		if result.Passed() {
+			passed++
+		}
+	}
+	return passed
+}
+
+// Score returns the fraction of cases that passed, 0 when there were none
+func (r Report) Score() float64 {
+	if len(r.Results) == 0 {
+		return 0
+	}
+	return float64(r.Passed()) / float64(len(r.Results))
+}
+
+func (r Report) String() string {
+	var b strings.Builder
+	for _, result := range r.Results {
+		if result.Passed() {
+			fmt.Fprintf(&b, "PASS %s\n", result.Case.Name)
+			continue
+		}
+		fmt.Fprintf(&b, "FAIL %s: %s\n", result.Case.Name, strings.Join(result.Failures, "; "))
+	}
+	fmt.Fprintf(&b, "%d/%d passed (%.0f%%)\n", r.Passed(), len(r.Results), r.Score()*100)
+	return b.String()
+}
+
+// LoadCases reads cases from a JSON array in the file at path
+func LoadCases(path string) ([]Case, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cases []Case
+	if err := json.Unmarshal(data, &cases); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", path, err)
+	}
+	return cases, nil
+}
+
+// Run answers every case with provider and checks the answers. Errors answering a case are failures of that
+// case, an error is only returned for cases that cannot be checked.
+func Run(ctx context.Context, provider chatgpt.ChatProvider, cases []Case, opts ...chatgpt.Option) (Report, error) {
+	var report Report
+	for _, c := range cases {
+		if c.Language != "" && c.Language != "ja" && c.Language != "en" {
+			return Report{}, fmt.Errorf("case %q: unsupported language %q, use ja or en", c.Name, c.Language)
+		}
+		prompt := c.SystemPrompt
+		if prompt == "" {
+			prompt = chatgpt.DefaultSystemPrompt
+		}
+		answer, err := chatgpt.GetStringResponse(provider, ctx, []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: prompt},
+			{Role: openai.ChatMessageRoleUser, Content: c.Question},
+		}, opts...)
+		result := Result{Case: c, Answer: answer}
+		if err != nil {
+			result.Failures = []string{fmt.Sprintf("no answer: %v", err)}
+		} else {
+			result.Failures = Check(c, answer)
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report, nil
+}
+
+// Check returns a description of every property of c answer lacks
+func Check(c Case, answer string) []string {
+	var failures []string
+	lower := strings.ToLower(answer)
+	for _, phrase := range c.Mentions {
+		if !strings.Contains(lower, strings.ToLower(phrase)) {
+			failures = append(failures, fmt.Sprintf("does not mention %q", phrase))
+		}
+	}
+	for _, phrase := range c.Avoids {
+		if strings.Contains(lower, strings.ToLower(phrase)) {
+			failures = append(failures, fmt.Sprintf("mentions %q", phrase))
+		}
+	}
+	if c.Language != "" && language(answer) != c.Language {
+		failures = append(failures, fmt.Sprintf("is not in %s", c.Language))
+	}
+	if n := len([]rune(answer)); c.MaxChars > 0 && n > c.MaxChars {
+		failures = append(failures, fmt.Sprintf("has %d characters, more than %d", n, c.MaxChars))
+	}
+	return failures
+}
+
+// language guesses whether text is written in Japanese ("ja") or English ("en") from its letters, Japanese
+// text often quoting latin names and terms
+func language(text string) string {
+	japanese, latin := 0, 0
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana, unicode.Han):
+			japanese++
+		case unicode.In(r, unicode.Latin):
+			latin++
+		}
+	}
+	switch {
+	case japanese > 0 && japanese*2 >= latin:
+		return "ja"
+	case latin > 0:
+		return "en"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,50 @@
+package eval
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		c      Case
+		answer string
+		want   []string
+	}{
+		{"passes", Case{Mentions: []string{"VPN"}, Avoids: []string{"sorry"}, Language: "en", MaxChars: 40}, "Restart the vpn client.", nil},
+		{"missing mention", Case{Mentions: []string{"restart", "settings"}}, "Restart it.", []string{`does not mention "settings"`}},
+		{"avoided", Case{Avoids: []string{"sorry"}}, "Sorry, I can't.", []string{`mentions "sorry"`}},
+		{"japanese", Case{Language: "ja"}, "VPNクライアントを再起動してください。", nil},
+		{"not japanese", Case{Language: "ja"}, "Restart the VPN client.", []string{"is not in ja"}},
+		{"too long", Case{MaxChars: 5}, "こんにちは世界", []string{"has 7 characters, more than 5"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Check(tt.c, tt.answer))
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	cases, err := LoadCases("testdata/cases.json")
+	require.NoError(t, err)
+	gptServer := fake.NewOpenAI(0)
+	defer gptServer.Close()
+	gptConfig := openai.DefaultConfig("sk-test")
+	gptConfig.BaseURL = gptServer.URL()
+
+	report, err := Run(context.Background(), openai.NewClientWithConfig(gptConfig), cases)
+	require.NoError(t, err)
+	// the fake openai server echoes the question in English
+	assert.Equal(t, 2, report.Passed())
+	assert.InDelta(t, 2.0/3, report.Score(), 0.001)
+	assert.Equal(t, "PASS vpn reset\nPASS no apology\nFAIL answers in japanese: is not in ja\n2/3 passed (67%)\n", report.String())
+
+	_, err = Run(context.Background(), openai.NewClientWithConfig(gptConfig), []Case{{Name: "french", Language: "fr"}})
+	assert.EqualError(t, err, `case "french": unsupported language "fr", use ja or en`)
+}
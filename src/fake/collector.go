@@ -0,0 +1,122 @@
+package fake
+
+import (
+	"encoding/hex"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonv1 "go.opentelemetry.io/proto/otlp/common/v1"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+)
+
+// Span is a span exported to the fake collector
+type Span struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Name         string
+	// Error is the message of a failed span, Failed reports whether it failed
+	Error  string
+	Failed bool
+	// Attributes are the span's attributes, as strings
+	Attributes map[string]string
+	// Service is the service.name of the resource that exported the span
+	Service string
+}
+
+// Collector is a fake OTLP/HTTP collector keeping the spans exported to its /v1/traces
+type Collector struct {
+	server *httptest.Server
+
+	mu      sync.Mutex
+	spans   []Span
+	headers http.Header
+}
+
+// NewCollector starts a fake collector
+func NewCollector() *Collector {
+	c := &Collector{}
+	c.server = httptest.NewServer(http.HandlerFunc(c.export))
+	return c
+}
+
+// export keeps the spans of an OTLP protobuf export request
+func (c *Collector) export(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	var req collectortrace.ExportTraceServiceRequest
+	if r.URL.Path != "/v1/traces" || err != nil || proto.Unmarshal(body, &req) != nil {
+		http.Error(w, "bad export", http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.headers = r.Header
+	for _, resource := range req.ResourceSpans {
+		var service string
+		for _, attr := range resource.GetResource().GetAttributes() {
+			if attr.Key == "service.name" {
+				service = attr.Value.GetStringValue()
+			}
+		}
+		for _, scope := range resource.ScopeSpans {
+			for _, span := range scope.Spans {
+				exported := Span{
+					TraceID:      hex.EncodeToString(span.TraceId),
+					SpanID:       hex.EncodeToString(span.SpanId),
+					ParentSpanID: hex.EncodeToString(span.ParentSpanId),
+					Name:         span.Name,
+					Error:        span.GetStatus().GetMessage(),
+					Failed:       span.GetStatus().GetCode() == 2,
+					Attributes:   map[string]string{},
+					Service:      service,
+				}
+				for _, attr := range span.Attributes {
+					exported.Attributes[attr.Key] = attributeString(attr.Value)
+				}
+				c.spans = append(c.spans, exported)
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+}
+
+// attributeString returns the string, int or bool value as a string
+func attributeString(value *commonv1.AnyValue) string {
+	switch v := value.GetValue().(type) {
+	case *commonv1.AnyValue_StringValue:
+		return v.StringValue
+	case *commonv1.AnyValue_IntValue:
+		return strconv.FormatInt(v.IntValue, 10)
+	case *commonv1.AnyValue_BoolValue:
+		return strconv.FormatBool(v.BoolValue)
+	default:
+		return value.String()
+	}
+}
+
+// URL returns the base URL of the collector, spans are exported to its /v1/traces
+func (c *Collector) URL() string {
+	return c.server.URL
+}
+
+// Spans returns the spans exported so far, in the order they were exported
+func (c *Collector) Spans() []Span {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Span(nil), c.spans...)
+}
+
+// Header returns the headers of the last export
+func (c *Collector) Header() http.Header {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.headers
+}
+
+// Close shuts the collector down
+func (c *Collector) Close() {
+	c.server.Close()
+}
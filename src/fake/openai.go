@@ -0,0 +1,292 @@
+// Package fake provides in-process fake slack and openai servers and a fake OTLP collector for load, soak and
+// trace testing
+package fake
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/sashabaranov/go-openai"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+// maxEcho is the maximum number of prompt characters echoed back in an answer
+const maxEcho = 80
+
+// embeddingDimensions is the length of the fake embeddings
+const embeddingDimensions = 64
+
+// OpenAI is a fake openai API server that answers chat completions after a fixed latency. Its embeddings
+// count words, so texts sharing more words are more similar. Its moderation flags texts mentioning "violent"
+// as violence and "hateful" as hate. Its batches are answered as soon as they are created.
+type OpenAI struct {
+	server   *httptest.Server
+	latency  time.Duration
+	requests atomic.Int64
+
+	mu sync.Mutex
+	// files are the uploaded and answered batch files by ID, outputs the answers' file of each batch
+	files   map[string][]byte
+	outputs map[string]string
+}
+
+// NewOpenAI starts a fake openai server that waits latency before answering each request
+func NewOpenAI(latency time.Duration) *OpenAI {
+	o := &OpenAI{latency: latency, files: map[string][]byte{}, outputs: map[string]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/chat/completions", o.chatCompletions)
+	mux.HandleFunc("/v1/embeddings", o.embeddings)
+	mux.HandleFunc("/v1/images/generations", o.images)
+	mux.HandleFunc("/v1/audio/transcriptions", o.transcriptions)
+	mux.HandleFunc("/v1/moderations", o.moderations)
+	mux.HandleFunc("/v1/files", o.uploadFile)
+	mux.HandleFunc("/v1/files/", o.fileContent)
+	mux.HandleFunc("/v1/batches", o.createBatch)
+	mux.HandleFunc("/v1/batches/", o.getBatch)
+	o.server = httptest.NewServer(mux)
+	return o
+}
+
+// URL returns the base url to configure an openai client with
+func (o *OpenAI) URL() string {
+	return o.server.URL + "/v1"
+}
+
+// Requests returns the number of chat completion requests served
+func (o *OpenAI) Requests() int64 {
+	return o.requests.Load()
+}
+
+// Close shuts the server down
+func (o *OpenAI) Close() {
+	o.server.Close()
+}
+
+func (o *OpenAI) chatCompletions(w http.ResponseWriter, r *http.Request) {
+	o.requests.Add(1)
+	var req openai.ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	select {
+	case <-time.After(o.latency):
+	case <-r.Context().Done():
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(answer(req))
+}
+
+// answer answers req with the bounded tail of its last message
+func answer(req openai.ChatCompletionRequest) openai.ChatCompletionResponse {
+	var prompt string
+	if len(req.Messages) > 0 {
+		prompt = req.Messages[len(req.Messages)-1].Content
+	}
+	// answers are fed back into the conversation, so echo a bounded tail to keep sizes stable
+	if runes := []rune(prompt); len(runes) > maxEcho {
+		prompt = string(runes[len(runes)-maxEcho:])
+	}
+	return openai.ChatCompletionResponse{
+		ID:      "chatcmpl-fake",
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   req.Model,
+		Choices: []openai.ChatCompletionChoice{
+			{
+				Message: openai.ChatCompletionMessage{
+					Role:    openai.ChatMessageRoleAssistant,
+					Content: "fake answer to: " + prompt,
+				},
+				FinishReason: openai.FinishReasonStop,
+			},
+		},
+		Usage: openai.Usage{
+			PromptTokens:     len(prompt) / 4,
+			CompletionTokens: 8,
+			TotalTokens:      len(prompt)/4 + 8,
+		},
+	}
+}
+
+func (o *OpenAI) embeddings(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Input []string `json:"input"`
+		Model string   `json:"model"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp := openai.EmbeddingResponse{Object: "list", Model: openai.EmbeddingModel(req.Model)}
+	for i, text := range req.Input {
+		resp.Data = append(resp.Data, openai.Embedding{Object: "embedding", Embedding: embed(text), Index: i})
+		resp.Usage.PromptTokens += len(strings.Fields(text))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// fakePNG is the image every image request is answered with, a single transparent pixel
+const fakePNG = "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNkYPhfDwAChwGA60e6kgAAAABJRU5ErkJggg=="
+
+// images answers image requests with fakePNG, revising their prompt to "a drawing of" it
+func (o *OpenAI) images(w http.ResponseWriter, r *http.Request) {
+	var req openai.ImageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp := openai.ImageResponse{Created: time.Now().Unix()}
+	for i := 0; i < max(req.N, 1); i++ {
+		resp.Data = append(resp.Data, openai.ImageResponseDataInner{B64JSON: fakePNG, RevisedPrompt: "a drawing of " + req.Prompt})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// transcriptions answers transcription requests with the text of the clip, which is taken to be what it says
+func (o *OpenAI) transcriptions(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer f.Close()
+	clip, _ := io.ReadAll(f)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"text": string(clip)})
+}
+
+// moderations flags the input in the categories named by the words it contains
+func (o *OpenAI) moderations(w http.ResponseWriter, r *http.Request) {
+	var req openai.ModerationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	input := strings.ToLower(req.Input)
+	var result openai.Result
+	result.Categories.Violence = strings.Contains(input, "violent")
+	result.Categories.Hate = strings.Contains(input, "hateful")
+	result.Flagged = result.Categories.Violence || result.Categories.Hate
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(openai.ModerationResponse{ID: "modr-fake", Model: "text-moderation-latest", Results: []openai.Result{result}})
+}
+
+// uploadFile keeps the uploaded file for a batch to read
+func (o *OpenAI) uploadFile(w http.ResponseWriter, r *http.Request) {
+	f, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer f.Close()
+	content, _ := io.ReadAll(f)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"id": o.keep(content), "object": "file", "purpose": r.FormValue("purpose")})
+}
+
+// fileContent returns the content of a file, e.g. /v1/files/file-1/content
+func (o *OpenAI) fileContent(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1/files/"), "/content")
+	o.mu.Lock()
+	content, ok := o.files[id]
+	o.mu.Unlock()
+	if !ok {
+		http.Error(w, `{"error": {"message": "no such file"}}`, http.StatusNotFound)
+		return
+	}
+	_, _ = w.Write(content)
+}
+
+// createBatch answers every request of the batch's input file right away into its output file
+func (o *OpenAI) createBatch(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		InputFileID string `json:"input_file_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	o.mu.Lock()
+	input, ok := o.files[req.InputFileID]
+	o.mu.Unlock()
+	if !ok {
+		http.Error(w, `{"error": {"message": "no such file"}}`, http.StatusBadRequest)
+		return
+	}
+	var output bytes.Buffer
+	encoder := json.NewEncoder(&output)
+	for _, line := range bytes.Split(bytes.TrimSpace(input), []byte("\n")) {
+		var batched struct {
+			CustomID string                       `json:"custom_id"`
+			Body     openai.ChatCompletionRequest `json:"body"`
+		}
+		if err := json.Unmarshal(line, &batched); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		o.requests.Add(1)
+		_ = encoder.Encode(map[string]any{
+			"custom_id": batched.CustomID,
+			"response":  map[string]any{"status_code": http.StatusOK, "body": answer(batched.Body)},
+		})
+	}
+	outputID := o.keep(output.Bytes())
+	o.mu.Lock()
+	id := "batch_" + strconv.Itoa(len(o.outputs)+1)
+	o.outputs[id] = outputID
+	o.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"id": id, "status": "validating", "input_file_id": req.InputFileID})
+}
+
+// getBatch returns a batch, which is always completed
+func (o *OpenAI) getBatch(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/v1/batches/")
+	o.mu.Lock()
+	outputID, ok := o.outputs[id]
+	o.mu.Unlock()
+	if !ok {
+		http.Error(w, `{"error": {"message": "no such batch"}}`, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"id": id, "status": "completed", "output_file_id": outputID})
+}
+
+// keep stores a file and returns its ID
+func (o *OpenAI) keep(content []byte) string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	id := "file-" + strconv.Itoa(len(o.files)+1)
+	o.files[id] = content
+	return id
+}
+
+// embed hashes the lower cased words of text into a vector of word counts
+func embed(text string) []float32 {
+	vector := make([]float32, embeddingDimensions)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsNumber(r) })
+	for _, word := range words {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(word))
+		vector[h.Sum32()%embeddingDimensions]++
+	}
+	return vector
+}
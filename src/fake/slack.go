@@ -0,0 +1,963 @@
+package fake
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNotConnected is returned when an event is sent before a socketmode client has connected
+var ErrNotConnected = errors.New("no socketmode client connected")
+
+// Scheduled is a message scheduled with chat.scheduleMessage that was not deleted
+type Scheduled struct {
+	ID      string
+	Channel string
+	PostAt  int64
+	Text    string
+	// Blocks holds the raw JSON of the message's blocks
+	Blocks string
+}
+
+// Message is a message posted to the fake slack web API
+type Message struct {
+	Channel  string
+	Text     string
+	ThreadTS string
+	TS       string
+	// Blocks holds the raw JSON of the message's blocks
+	Blocks string
+	// User is the author of messages added with AddMessage and the recipient of ephemeral messages, messages
+	// posted through the web API are the bot's
+	User string
+	// Reactions counts the reactions to the message by emoji name
+	Reactions map[string]int
+	// Files are the files attached to the message, downloadable through the links conversations.replies gives
+	Files []File
+}
+
+// File is a file uploaded through the fake slack web API
+type File struct {
+	Channels       string
+	ThreadTS       string
+	Filename       string
+	Title          string
+	InitialComment string
+	Mimetype       string
+	Content        []byte
+}
+
+// View is a view opened, updated or published through the fake slack web API, View holds its raw JSON. ViewID
+// is the ID of the view replaced by an update, empty for opened views, and UserID the user whose App Home tab
+// a published view is.
+type View struct {
+	TriggerID string
+	ViewID    string
+	UserID    string
+	View      string
+}
+
+// WorkflowCall is a call of the workflows API through the fake slack web API: Method is e.g.
+// "workflows.stepCompleted" and Body holds the raw JSON it was called with
+type WorkflowCall struct {
+	Method string
+	Body   string
+}
+
+// Slack is a fake slack server implementing the socketmode websocket and the parts of the web API the bot uses
+type Slack struct {
+	server   *httptest.Server
+	upgrader websocket.Upgrader
+
+	mu        sync.Mutex
+	conn      *websocket.Conn
+	connected chan struct{}
+	rejectErr string
+	messages  []Message
+	ephemeral []Message
+	views     []View
+	workflows []WorkflowCall
+	files     []File
+	bookmarks map[string][]map[string]any
+	users     []map[string]any
+	groups    []map[string]any
+	groupDMs  map[string][]string
+	members   map[string][]string
+	shared    map[string]bool
+	scheduled []Scheduled
+	presence  string
+	onPost    func(Message)
+	onAck     func(envelopeID string)
+
+	envelopes atomic.Int64
+	acks      atomic.Int64
+	ts        atomic.Int64
+}
+
+// NewSlack starts a fake slack server
+func NewSlack() *Slack {
+	s := &Slack{
+		connected: make(chan struct{}),
+		// slack-go sends an Origin header that does not match the test server's host
+		upgrader: websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/apps.connections.open", s.connectionsOpen)
+	mux.HandleFunc("/api/auth.test", s.authTest)
+	mux.HandleFunc("/api/chat.postMessage", s.postMessage)
+	mux.HandleFunc("/api/chat.postEphemeral", s.postEphemeral)
+	mux.HandleFunc("/api/chat.update", s.updateMessage)
+	mux.HandleFunc("/api/views.open", s.openView)
+	mux.HandleFunc("/api/views.update", s.updateView)
+	mux.HandleFunc("/api/views.publish", s.publishView)
+	mux.HandleFunc("/api/chat.getPermalink", s.permalink)
+	mux.HandleFunc("/api/files.upload", s.uploadFile)
+	mux.HandleFunc("/api/conversations.replies", s.replies)
+	mux.HandleFunc("/api/chat.delete", s.deleteMessage)
+	mux.HandleFunc("/api/users.info", s.usersInfo)
+	mux.HandleFunc("/api/bookmarks.list", s.listBookmarks)
+	mux.HandleFunc("/api/users.list", s.listUsers)
+	mux.HandleFunc("/api/usergroups.list", s.listUserGroups)
+	mux.HandleFunc("/api/usergroups.users.list", s.listUserGroupMembers)
+	mux.HandleFunc("/api/conversations.info", s.conversationInfo)
+	mux.HandleFunc("/api/conversations.members", s.conversationMembers)
+	mux.HandleFunc("/api/conversations.open", s.openConversation)
+	mux.HandleFunc("/api/chat.scheduleMessage", s.scheduleMessage)
+	mux.HandleFunc("/api/chat.scheduledMessages.list", s.listScheduledMessages)
+	mux.HandleFunc("/api/chat.deleteScheduledMessage", s.deleteScheduledMessage)
+	mux.HandleFunc("/api/users.setPresence", s.setPresence)
+	for _, method := range []string{"workflows.updateStep", "workflows.stepCompleted", "workflows.stepFailed"} {
+		mux.HandleFunc("/api/"+method, s.workflowCall(method))
+	}
+	mux.HandleFunc("/files/", s.downloadFile)
+	mux.HandleFunc("/ws", s.websocket)
+	s.server = httptest.NewServer(mux)
+	return s
+}
+
+// APIURL returns the url to configure a slack client with through slack.OptionAPIURL
+func (s *Slack) APIURL() string {
+	return s.server.URL + "/api/"
+}
+
+// RejectConnections makes apps.connections.open fail with the given slack error, e.g. "invalid_auth"
+func (s *Slack) RejectConnections(slackErr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rejectErr = slackErr
+}
+
+// OnPost registers a function called for every message posted to chat.postMessage
+func (s *Slack) OnPost(f func(Message)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onPost = f
+}
+
+// OnAck registers a function called for every envelope acknowledged by the socketmode client
+func (s *Slack) OnAck(f func(envelopeID string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onAck = f
+}
+
+// Messages returns a copy of every message posted so far
+func (s *Slack) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Ephemerals returns the ephemeral messages posted so far
+func (s *Slack) Ephemerals() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.ephemeral...)
+}
+
+// AddMessage adds a message from a user, as if it had been posted in slack, and returns it with its
+// timestamp set when it was empty
+func (s *Slack) AddMessage(msg Message) Message {
+	if msg.TS == "" {
+		msg.TS = s.nextTS()
+	}
+	s.mu.Lock()
+	s.messages = append(s.messages, msg)
+	s.mu.Unlock()
+	return msg
+}
+
+// AddBookmark bookmarks link with title in channel
+func (s *Slack) AddBookmark(channel, title, link string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.bookmarks == nil {
+		s.bookmarks = map[string][]map[string]any{}
+	}
+	s.bookmarks[channel] = append(s.bookmarks[channel], map[string]any{
+		"id":         fmt.Sprintf("Bk%d", len(s.bookmarks[channel])+1),
+		"channel_id": channel,
+		"title":      title,
+		"link":       link,
+		"type":       "link",
+	})
+}
+
+// AddUser adds a user with a real name and job title to the directory users.list and users.info answer with
+func (s *Slack) AddUser(id, realName, title string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users = append(s.users, map[string]any{
+		"id":        id,
+		"name":      strings.ToLower(id),
+		"real_name": realName,
+		"profile":   map[string]any{"real_name": realName, "display_name": realName, "title": title},
+	})
+}
+
+// AddUserGroup adds a user group with members to the groups usergroups.list answers with
+func (s *Slack) AddUserGroup(id, handle, name string, members ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.groups = append(s.groups, map[string]any{
+		"id":           id,
+		"is_usergroup": true,
+		"handle":       handle,
+		"name":         name,
+		"users":        members,
+		"user_count":   len(members),
+	})
+}
+
+// AddGroupDM adds a multi-person direct message with members, conversations.info answers that other channels
+// are public channels
+func (s *Slack) AddGroupDM(channel string, members ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.groupDMs == nil {
+		s.groupDMs = map[string][]string{}
+	}
+	s.groupDMs[channel] = members
+}
+
+// ShareChannel makes conversations.info answer that channel is shared with another organization through Slack
+// Connect
+func (s *Slack) ShareChannel(channel string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shared == nil {
+		s.shared = map[string]bool{}
+	}
+	s.shared[channel] = true
+}
+
+// AddMembers makes conversations.members answer that members are in channel
+func (s *Slack) AddMembers(channel string, members ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.members == nil {
+		s.members = map[string][]string{}
+	}
+	s.members[channel] = append(s.members[channel], members...)
+}
+
+// Scheduled returns the messages scheduled and not deleted so far
+func (s *Slack) Scheduled() []Scheduled {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Scheduled{}, s.scheduled...)
+}
+
+// Files returns the files uploaded so far
+func (s *Slack) Files() []File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]File(nil), s.files...)
+}
+
+// Views returns the views opened and updated so far
+func (s *Slack) Views() []View {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]View(nil), s.views...)
+}
+
+// WorkflowCalls returns the calls of the workflows API so far
+func (s *Slack) WorkflowCalls() []WorkflowCall {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]WorkflowCall(nil), s.workflows...)
+}
+
+// Presence returns the presence the bot last set with users.setPresence, empty when it set none
+func (s *Slack) Presence() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.presence
+}
+
+// Acks returns the number of envelopes acknowledged by the socketmode client
+func (s *Slack) Acks() int64 {
+	return s.acks.Load()
+}
+
+// WaitConnected blocks until a socketmode client has connected or ctx is done
+func (s *Slack) WaitConnected(ctx context.Context) error {
+	s.mu.Lock()
+	connected := s.connected
+	s.mu.Unlock()
+	select {
+	case <-connected:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SendEvent delivers an Events API inner event (e.g. slackevents.AppMentionEvent) to the connected
+// socketmode client and returns the envelope ID it was sent with
+func (s *Slack) SendEvent(event any) (string, error) {
+	envelopeID := fmt.Sprintf("envelope-%d", s.envelopes.Load()+1)
+	return envelopeID, s.SendEnvelope(envelopeID, event)
+}
+
+// SendEnvelope is like SendEvent but lets the caller choose the envelope ID, which allows
+// acks to be correlated when they may arrive before SendEnvelope returns
+func (s *Slack) SendEnvelope(envelopeID string, event any) error {
+	inner, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	n := s.envelopes.Add(1)
+	payload, err := json.Marshal(map[string]any{
+		"type":       "event_callback",
+		"team_id":    "T0FAKE",
+		"api_app_id": "A0FAKE",
+		"event_id":   fmt.Sprintf("Ev%d", n),
+		"event_time": time.Now().Unix(),
+		"event":      json.RawMessage(inner),
+	})
+	if err != nil {
+		return err
+	}
+	return s.write(map[string]any{
+		"type":                     "events_api",
+		"envelope_id":              envelopeID,
+		"payload":                  json.RawMessage(payload),
+		"accepts_response_payload": false,
+	})
+}
+
+// Close disconnects the socketmode client and shuts the server down
+func (s *Slack) Close() {
+	s.mu.Lock()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.mu.Unlock()
+	s.server.Close()
+}
+
+func (s *Slack) write(v any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return ErrNotConnected
+	}
+	return s.conn.WriteJSON(v)
+}
+
+func (s *Slack) nextTS() string {
+	return fmt.Sprintf("%d.%06d", time.Now().Unix(), s.ts.Add(1))
+}
+
+func writeError(w http.ResponseWriter, slackErr string) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"ok": false, "error": slackErr})
+}
+
+func writeOK(w http.ResponseWriter, fields map[string]any) {
+	resp := map[string]any{"ok": true}
+	for k, v := range fields {
+		resp[k] = v
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Slack) connectionsOpen(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	rejectErr := s.rejectErr
+	s.mu.Unlock()
+	if rejectErr != "" {
+		writeError(w, rejectErr)
+		return
+	}
+	writeOK(w, map[string]any{"url": "ws" + strings.TrimPrefix(s.server.URL, "http") + "/ws"})
+}
+
+func (s *Slack) authTest(w http.ResponseWriter, r *http.Request) {
+	writeOK(w, map[string]any{"user_id": "U0BOT", "bot_id": "B0BOT", "team_id": "T0FAKE", "user": "slackgpt"})
+}
+
+func (s *Slack) postMessage(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	msg := Message{
+		Channel:  r.FormValue("channel"),
+		Text:     r.FormValue("text"),
+		ThreadTS: r.FormValue("thread_ts"),
+		TS:       s.nextTS(),
+		Blocks:   r.FormValue("blocks"),
+	}
+	s.mu.Lock()
+	s.messages = append(s.messages, msg)
+	onPost := s.onPost
+	s.mu.Unlock()
+	if onPost != nil {
+		onPost(msg)
+	}
+	writeOK(w, map[string]any{"channel": msg.Channel, "ts": msg.TS})
+}
+
+// scheduleMessage keeps a message to post later, it is never posted
+func (s *Slack) scheduleMessage(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	postAt, err := strconv.ParseInt(r.FormValue("post_at"), 10, 64)
+	if err != nil || postAt <= time.Now().Unix() {
+		writeError(w, "time_in_past")
+		return
+	}
+	msg := Scheduled{
+		ID:      fmt.Sprintf("Q%d", s.ts.Add(1)),
+		Channel: r.FormValue("channel"),
+		PostAt:  postAt,
+		Text:    r.FormValue("text"),
+		Blocks:  r.FormValue("blocks"),
+	}
+	s.mu.Lock()
+	s.scheduled = append(s.scheduled, msg)
+	s.mu.Unlock()
+	writeOK(w, map[string]any{"channel": msg.Channel, "scheduled_message_id": msg.ID, "post_at": msg.PostAt})
+}
+
+// listScheduledMessages answers with the scheduled messages, of a channel when one is given, in a single page
+func (s *Slack) listScheduledMessages(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var messages []map[string]any
+	s.mu.Lock()
+	for _, msg := range s.scheduled {
+		if channel := r.FormValue("channel"); channel == "" || channel == msg.Channel {
+			messages = append(messages, map[string]any{"id": msg.ID, "channel_id": msg.Channel, "post_at": msg.PostAt, "text": msg.Text})
+		}
+	}
+	s.mu.Unlock()
+	writeOK(w, map[string]any{"scheduled_messages": messages, "response_metadata": map[string]any{"next_cursor": ""}})
+}
+
+// deleteScheduledMessage removes a scheduled message
+func (s *Slack) deleteScheduledMessage(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, msg := range s.scheduled {
+		if msg.ID == r.FormValue("scheduled_message_id") && msg.Channel == r.FormValue("channel") {
+			s.scheduled = append(s.scheduled[:i], s.scheduled[i+1:]...)
+			writeOK(w, nil)
+			return
+		}
+	}
+	writeError(w, "invalid_scheduled_message_id")
+}
+
+// uploadFile keeps a file uploaded with files.upload
+func (s *Slack) uploadFile(w http.ResponseWriter, r *http.Request) {
+	// text snippets are posted as a plain form
+	if err := r.ParseMultipartForm(32 << 20); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	file := File{
+		Channels:       r.FormValue("channels"),
+		ThreadTS:       r.FormValue("thread_ts"),
+		Filename:       r.FormValue("filename"),
+		Title:          r.FormValue("title"),
+		InitialComment: r.FormValue("initial_comment"),
+	}
+	if f, _, err := r.FormFile("file"); err == nil {
+		file.Content, _ = io.ReadAll(f)
+		f.Close()
+	} else {
+		file.Content = []byte(r.FormValue("content"))
+	}
+	s.mu.Lock()
+	s.files = append(s.files, file)
+	id := fmt.Sprintf("F%d", len(s.files))
+	s.mu.Unlock()
+	writeOK(w, map[string]any{"file": map[string]any{"id": id, "name": file.Filename}})
+}
+
+func (s *Slack) websocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	s.mu.Lock()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.conn = conn
+	err = conn.WriteJSON(map[string]any{"type": "hello", "num_connections": 1})
+	if err == nil {
+		select {
+		case <-s.connected:
+		default:
+			close(s.connected)
+		}
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return
+	}
+
+	// socketmode clients reconnect if they do not receive a ping within 30 seconds
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.mu.Lock()
+				err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second))
+				s.mu.Unlock()
+				if err != nil {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		var ack struct {
+			EnvelopeID string `json:"envelope_id"`
+		}
+		if err := conn.ReadJSON(&ack); err != nil {
+			break
+		}
+		s.acks.Add(1)
+		s.mu.Lock()
+		onAck := s.onAck
+		s.mu.Unlock()
+		if onAck != nil {
+			onAck(ack.EnvelopeID)
+		}
+	}
+
+	s.mu.Lock()
+	if s.conn == conn {
+		s.conn = nil
+		s.connected = make(chan struct{})
+	}
+	s.mu.Unlock()
+}
+
+// updateMessage replaces the text of a previously posted message
+func (s *Slack) updateMessage(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	channel, ts := r.FormValue("channel"), r.FormValue("ts")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.messages {
+		if s.messages[i].Channel == channel && s.messages[i].TS == ts {
+			s.messages[i].Text = r.FormValue("text")
+			s.messages[i].Blocks = r.FormValue("blocks")
+			writeOK(w, map[string]any{"channel": channel, "ts": ts, "text": s.messages[i].Text})
+			return
+		}
+	}
+	writeError(w, "message_not_found")
+}
+
+// deleteMessage removes a previously posted message
+func (s *Slack) deleteMessage(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	channel, ts := r.FormValue("channel"), r.FormValue("ts")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.messages {
+		if s.messages[i].Channel == channel && s.messages[i].TS == ts {
+			s.messages = append(s.messages[:i], s.messages[i+1:]...)
+			writeOK(w, map[string]any{"channel": channel, "ts": ts})
+			return
+		}
+	}
+	writeError(w, "message_not_found")
+}
+
+// setPresence records the presence the bot sets, auto or away
+func (s *Slack) setPresence(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	presence := r.FormValue("presence")
+	if presence != "auto" && presence != "away" {
+		writeError(w, "invalid_presence")
+		return
+	}
+	s.mu.Lock()
+	s.presence = presence
+	s.mu.Unlock()
+	writeOK(w, nil)
+}
+
+// workflowCall records the calls of the workflows API method
+func (s *Slack) workflowCall(method string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.workflows = append(s.workflows, WorkflowCall{Method: method, Body: string(body)})
+		s.mu.Unlock()
+		writeOK(w, nil)
+	}
+}
+
+// usersInfo answers with the user added with AddUser, or else one whose display name is "name-" followed by the
+// user ID
+func (s *Slack) usersInfo(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	id := r.FormValue("user")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, user := range s.users {
+		if user["id"] == id {
+			writeOK(w, map[string]any{"user": user})
+			return
+		}
+	}
+	writeOK(w, map[string]any{"user": map[string]any{
+		"id":      id,
+		"name":    strings.ToLower(id),
+		"profile": map[string]any{"display_name": "name-" + id},
+	}})
+}
+
+// listBookmarks answers with the bookmarks added to a channel
+func (s *Slack) listBookmarks(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	bookmarks := append([]map[string]any{}, s.bookmarks[r.FormValue("channel_id")]...)
+	s.mu.Unlock()
+	writeOK(w, map[string]any{"bookmarks": bookmarks})
+}
+
+// listUsers answers with the users added with AddUser in a single page
+func (s *Slack) listUsers(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	users := append([]map[string]any{}, s.users...)
+	s.mu.Unlock()
+	writeOK(w, map[string]any{"members": users, "response_metadata": map[string]any{"next_cursor": ""}})
+}
+
+// listUserGroups answers with the user groups added with AddUserGroup
+func (s *Slack) listUserGroups(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	groups := append([]map[string]any{}, s.groups...)
+	s.mu.Unlock()
+	writeOK(w, map[string]any{"usergroups": groups})
+}
+
+// listUserGroupMembers answers with the members of a user group added with AddUserGroup
+func (s *Slack) listUserGroupMembers(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, group := range s.groups {
+		if group["id"] == r.FormValue("usergroup") {
+			writeOK(w, map[string]any{"users": group["users"]})
+			return
+		}
+	}
+	writeError(w, "no_such_subteam")
+}
+
+// conversationInfo answers whether a channel is a group DM added with AddGroupDM
+func (s *Slack) conversationInfo(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	channel := r.FormValue("channel")
+	s.mu.Lock()
+	_, groupDM := s.groupDMs[channel]
+	shared := s.shared[channel]
+	s.mu.Unlock()
+	writeOK(w, map[string]any{"channel": map[string]any{"id": channel, "is_channel": !groupDM, "is_mpim": groupDM, "is_ext_shared": shared}})
+}
+
+// openConversation answers with the direct message channel with the users asked for, D followed by their IDs
+func (s *Slack) openConversation(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	channel := "D" + strings.ReplaceAll(r.FormValue("users"), ",", "")
+	writeOK(w, map[string]any{"channel": map[string]any{"id": channel, "is_im": true}})
+}
+
+// conversationMembers answers with the members of a group DM added with AddGroupDM, or of a channel added with
+// AddMembers, in a single page
+func (s *Slack) conversationMembers(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	members := append([]string{}, s.groupDMs[r.FormValue("channel")]...)
+	members = append(members, s.members[r.FormValue("channel")]...)
+	s.mu.Unlock()
+	writeOK(w, map[string]any{"members": members, "response_metadata": map[string]any{"next_cursor": ""}})
+}
+
+// postEphemeral records a message only the given user sees, it is not part of Messages
+func (s *Slack) postEphemeral(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	msg := Message{
+		Channel:  r.FormValue("channel"),
+		Text:     r.FormValue("text"),
+		ThreadTS: r.FormValue("thread_ts"),
+		TS:       s.nextTS(),
+		User:     r.FormValue("user"),
+		Blocks:   r.FormValue("blocks"),
+	}
+	s.mu.Lock()
+	s.ephemeral = append(s.ephemeral, msg)
+	s.mu.Unlock()
+	writeOK(w, map[string]any{"message_ts": msg.TS})
+}
+
+// openView records a view opened for a trigger
+func (s *Slack) openView(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		TriggerID string          `json:"trigger_id"`
+		View      json.RawMessage `json:"view"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.TriggerID == "" {
+		writeError(w, "invalid_trigger_id")
+		return
+	}
+	s.mu.Lock()
+	s.views = append(s.views, View{TriggerID: req.TriggerID, View: string(req.View)})
+	s.mu.Unlock()
+	writeOK(w, map[string]any{"view": req.View})
+}
+
+// updateView records the view replacing the view with the requested ID
+func (s *Slack) updateView(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ViewID string          `json:"view_id"`
+		View   json.RawMessage `json:"view"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.ViewID == "" {
+		writeError(w, "not_found")
+		return
+	}
+	s.mu.Lock()
+	s.views = append(s.views, View{ViewID: req.ViewID, View: string(req.View)})
+	s.mu.Unlock()
+	writeOK(w, map[string]any{"view": req.View})
+}
+
+// publishView records the view published as the App Home tab of the requested user
+func (s *Slack) publishView(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID string          `json:"user_id"`
+		View   json.RawMessage `json:"view"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.views = append(s.views, View{UserID: req.UserID, View: string(req.View)})
+	s.mu.Unlock()
+	writeOK(w, map[string]any{"view": req.View})
+}
+
+// permalink answers with a link made up of the channel and message timestamp
+func (s *Slack) permalink(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	channel, ts := r.FormValue("channel"), r.FormValue("message_ts")
+	writeOK(w, map[string]any{
+		"channel":   channel,
+		"permalink": "https://fake.slack.com/archives/" + channel + "/p" + strings.ReplaceAll(ts, ".", ""),
+	})
+}
+
+// replies answers with the parent and replies of a thread up to latest, limit of them a page
+func (s *Slack) replies(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	channel, ts, latest := r.FormValue("channel"), r.FormValue("ts"), r.FormValue("latest")
+	s.mu.Lock()
+	var thread []Message
+	for _, m := range s.messages {
+		if m.Channel == channel && (m.TS == ts || m.ThreadTS == ts) && (latest == "" || tsLess(m.TS, latest) || m.TS == latest) {
+			thread = append(thread, m)
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(thread, func(i, j int) bool { return tsLess(thread[i].TS, thread[j].TS) })
+	// the cursor is the index of the first message of the page
+	offset, _ := strconv.Atoi(r.FormValue("cursor"))
+	thread = thread[min(max(offset, 0), len(thread)):]
+	next := ""
+	if limit, _ := strconv.Atoi(r.FormValue("limit")); limit > 0 && limit < len(thread) {
+		thread, next = thread[:limit], strconv.Itoa(offset+limit)
+	}
+
+	messages := make([]map[string]any, 0, len(thread))
+	for _, m := range thread {
+		message := map[string]any{"type": "message", "text": m.Text, "ts": m.TS, "thread_ts": ts}
+		if m.ThreadTS != "" {
+			message["thread_ts"] = m.ThreadTS
+		}
+		if m.User != "" {
+			message["user"] = m.User
+		} else {
+			message["user"], message["bot_id"] = "U0BOT", "B0BOT"
+		}
+		if len(m.Reactions) > 0 {
+			names := make([]string, 0, len(m.Reactions))
+			for name := range m.Reactions {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			reactions := make([]map[string]any, len(names))
+			for i, name := range names {
+				reactions[i] = map[string]any{"name": name, "count": m.Reactions[name]}
+			}
+			message["reactions"] = reactions
+		}
+		if len(m.Files) > 0 {
+			files := make([]map[string]any, len(m.Files))
+			for i, f := range m.Files {
+				files[i] = map[string]any{
+					"id":                   fmt.Sprintf("F%s_%d", m.TS, i),
+					"name":                 f.Filename,
+					"mimetype":             f.Mimetype,
+					"size":                 len(f.Content),
+					"url_private_download": fmt.Sprintf("%s/files/%s/%d", s.server.URL, m.TS, i),
+				}
+			}
+			message["files"] = files
+		}
+		messages = append(messages, message)
+	}
+	writeOK(w, map[string]any{"messages": messages, "has_more": next != "", "response_metadata": map[string]any{"next_cursor": next}})
+}
+
+// downloadFile serves the content of a file attached to a message at /files/<message ts>/<index>, to
+// requests with a token only
+func (s *Slack) downloadFile(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		http.Error(w, "no token", http.StatusUnauthorized)
+		return
+	}
+	ts, index, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/files/"), "/")
+	i, err := strconv.Atoi(index)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	s.mu.Lock()
+	var content []byte
+	for _, m := range s.messages {
+		if m.TS == ts && i >= 0 && i < len(m.Files) {
+			content = m.Files[i].Content
+		}
+	}
+	s.mu.Unlock()
+	if content == nil {
+		http.NotFound(w, r)
+		return
+	}
+	_, _ = w.Write(content)
+}
+
+// tsLess orders slack timestamps, which are seconds and microseconds separated by a dot
+func tsLess(a, b string) bool {
+	aSec, aMicro, _ := strings.Cut(a, ".")
+	bSec, bMicro, _ := strings.Cut(b, ".")
+	x, _ := strconv.ParseInt(aSec, 10, 64)
+	y, _ := strconv.ParseInt(bSec, 10, 64)
+	if x != y {
+		return x < y
+	}
+	x, _ = strconv.ParseInt(aMicro, 10, 64)
+	y, _ = strconv.ParseInt(bMicro, 10, 64)
+	return x < y
+}
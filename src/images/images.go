@@ -0,0 +1,82 @@
+// Package images draws pictures from text prompts with OpenAI's image API
+package images
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/sashabaranov/go-openai"
+	"strings"
+)
+
+// DefaultModel and DefaultSize are used when no model or size is requested
+const (
+	DefaultModel = openai.CreateImageModelDallE3
+	DefaultSize  = openai.CreateImageSize1024x1024
+)
+
+// ErrEmptyPrompt is returned when there is nothing to draw
+var ErrEmptyPrompt = errors.New("nothing to draw")
+
+// Generator creates images, *openai.Client is one
+type Generator interface {
+	CreateImage(ctx context.Context, request openai.ImageRequest) (openai.ImageResponse, error)
+}
+
+// GeneratorOf returns the Generator behind provider, false for providers that cannot create images
+func GeneratorOf(provider chatgpt.ChatProvider) (Generator, bool) {
+	for {
+		if generator, ok := provider.(Generator); ok {
+			return generator, true
+		}
+		wrapper, ok := provider.(interface{ Unwrap() chatgpt.ChatProvider })
+		if !ok {
+			return nil, false
+		}
+		provider = wrapper.Unwrap()
+	}
+}
+
+// Image is a PNG image and the prompt it was drawn from, which the model may have rewritten
+type Image struct {
+	PNG    []byte
+	Prompt string
+}
+
+// Draw creates an image of prompt with model and size, DefaultModel and DefaultSize when they are empty
+func Draw(ctx context.Context, generator Generator, model, size, prompt string) (Image, error) {
+	prompt = strings.TrimSpace(prompt)
+	if prompt == "" {
+		return Image{}, ErrEmptyPrompt
+	}
+	if model == "" {
+		model = DefaultModel
+	}
+	if size == "" {
+		size = DefaultSize
+	}
+	resp, err := generator.CreateImage(ctx, openai.ImageRequest{
+		Prompt:         prompt,
+		Model:          model,
+		N:              1,
+		Size:           size,
+		ResponseFormat: openai.CreateImageResponseFormatB64JSON,
+	})
+	if err != nil {
+		return Image{}, err
+	}
+	if len(resp.Data) == 0 {
+		return Image{}, errors.New("no image returned")
+	}
+	png, err := base64.StdEncoding.DecodeString(resp.Data[0].B64JSON)
+	if err != nil {
+		return Image{}, fmt.Errorf("decoding image: %w", err)
+	}
+	image := Image{PNG: png, Prompt: prompt}
+	if revised := resp.Data[0].RevisedPrompt; revised != "" {
+		image.Prompt = revised
+	}
+	return image, nil
+}
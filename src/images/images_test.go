@@ -0,0 +1,48 @@
+package images
+
+import (
+	"context"
+	"errors"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// generator answers image requests with data, recording them
+type generator struct {
+	data     []openai.ImageResponseDataInner
+	err      error
+	requests []openai.ImageRequest
+}
+
+func (g *generator) CreateImage(_ context.Context, req openai.ImageRequest) (openai.ImageResponse, error) {
+	g.requests = append(g.requests, req)
+	return openai.ImageResponse{Data: g.data}, g.err
+}
+
+func TestDraw(t *testing.T) {
+	ctx := context.Background()
+	g := &generator{data: []openai.ImageResponseDataInner{{B64JSON: "iVBORw==", RevisedPrompt: "a cute gopher"}}}
+	image, err := Draw(ctx, g, "", "", " a gopher ")
+	require.NoError(t, err)
+	assert.Equal(t, Image{PNG: []byte("\x89PNG"), Prompt: "a cute gopher"}, image)
+	assert.Equal(t, openai.ImageRequest{Prompt: "a gopher", Model: DefaultModel, N: 1, Size: DefaultSize, ResponseFormat: "b64_json"}, g.requests[0])
+
+	g.data[0].RevisedPrompt = ""
+	image, err = Draw(ctx, g, openai.CreateImageModelDallE2, openai.CreateImageSize256x256, "a gopher")
+	require.NoError(t, err)
+	assert.Equal(t, "a gopher", image.Prompt, "the prompt is kept when it is not revised")
+	assert.Equal(t, openai.CreateImageModelDallE2, g.requests[1].Model)
+	assert.Equal(t, openai.CreateImageSize256x256, g.requests[1].Size)
+
+	_, err = Draw(ctx, g, "", "", " ")
+	assert.ErrorIs(t, err, ErrEmptyPrompt)
+	_, err = Draw(ctx, &generator{}, "", "", "a gopher")
+	assert.ErrorContains(t, err, "no image returned")
+	_, err = Draw(ctx, &generator{data: []openai.ImageResponseDataInner{{B64JSON: "not base64"}}}, "", "", "a gopher")
+	assert.ErrorContains(t, err, "decoding image")
+	failed := errors.New("content policy violation")
+	_, err = Draw(ctx, &generator{err: failed}, "", "", "a gopher")
+	assert.ErrorIs(t, err, failed)
+}
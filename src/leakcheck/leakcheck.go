@@ -0,0 +1,119 @@
+// Package leakcheck fails tests that leave goroutines running.
+//
+// Verify checks a single test. Main checks a whole package when the debug assertion mode is
+// enabled by setting SLACKGPT_LEAKCHECK, e.g. `SLACKGPT_LEAKCHECK=1 go test ./...`.
+package leakcheck
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// EnvVar enables the package level leak check run by Main
+const EnvVar = "SLACKGPT_LEAKCHECK"
+
+// settleTimeout is how long goroutines are given to exit before they count as leaked
+const settleTimeout = 5 * time.Second
+
+// ignored lists functions of goroutines the runtime starts once and never stops
+var ignored = []string{
+	"os/signal.signal_recv",
+}
+
+// Snapshot is the set of goroutines running at a point in time, keyed by goroutine ID
+type Snapshot map[string]bool
+
+// Enabled reports whether the package level leak check is enabled
+func Enabled() bool {
+	return os.Getenv(EnvVar) != ""
+}
+
+// Take records the goroutines currently running
+func Take() Snapshot {
+	snapshot := make(Snapshot)
+	for id := range goroutines() {
+		snapshot[id] = true
+	}
+	return snapshot
+}
+
+// Leaked waits up to timeout for goroutines started after the snapshot to exit and returns
+// the stacks of those still running
+func (s Snapshot) Leaked(timeout time.Duration) []string {
+	deadline := time.Now().Add(timeout)
+	for {
+		var leaked []string
+		for id, stack := range goroutines() {
+			if !s[id] {
+				leaked = append(leaked, stack)
+			}
+		}
+		if len(leaked) == 0 || time.Now().After(deadline) {
+			return leaked
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// Verify fails t if goroutines started after before are still running once the test is done
+func Verify(t testing.TB, before Snapshot) {
+	t.Helper()
+	if leaked := before.Leaked(settleTimeout); len(leaked) > 0 {
+		t.Errorf("found %d leaked goroutines:\n\n%s", len(leaked), strings.Join(leaked, "\n\n"))
+	}
+}
+
+// Main runs the tests and, when Enabled, fails the run if any goroutines outlive them.
+// Use it from TestMain: os.Exit(leakcheck.Main(m))
+func Main(m *testing.M) int {
+	if !Enabled() {
+		return m.Run()
+	}
+	before := Take()
+	code := m.Run()
+	if leaked := before.Leaked(settleTimeout); len(leaked) > 0 {
+		fmt.Fprintf(os.Stderr, "leakcheck: found %d leaked goroutines:\n\n%s\n", len(leaked), strings.Join(leaked, "\n\n"))
+		if code == 0 {
+			code = 1
+		}
+	}
+	return code
+}
+
+// goroutines returns the stack of every running goroutine except the caller, keyed by goroutine ID
+func goroutines() map[string]string {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	stacks := strings.Split(string(buf), "\n\n")
+	result := make(map[string]string, len(stacks))
+	// the first stack is always the calling goroutine
+	for _, stack := range stacks[1:] {
+		// each stack begins with "goroutine 12 [state]:"
+		fields := strings.Fields(stack)
+		if len(fields) < 2 || fields[0] != "goroutine" || isIgnored(stack) {
+			continue
+		}
+		result[fields[1]] = stack
+	}
+	return result
+}
+
+func isIgnored(stack string) bool {
+	for _, f := range ignored {
+		if strings.Contains(stack, f) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package leakcheck
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLeaked(t *testing.T) {
+	before := Take()
+	stop := make(chan struct{})
+	go func() { <-stop }()
+
+	leaked := before.Leaked(50 * time.Millisecond)
+	assert.Len(t, leaked, 1)
+	assert.Contains(t, leaked[0], "leakcheck.TestLeaked")
+
+	close(stop)
+	assert.Empty(t, before.Leaked(time.Second))
+}
+
+func TestVerify(t *testing.T) {
+	before := Take()
+	done := make(chan struct{})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(done)
+	}()
+	// goroutines that exit shortly after the test are given time to settle
+	Verify(t, before)
+	<-done
+}
+
+func TestTakeExcludesCaller(t *testing.T) {
+	assert.NotEmpty(t, Take())
+	assert.Empty(t, Take().Leaked(0))
+}
@@ -0,0 +1,234 @@
+// Package loadtest drives synthetic slack events through the event handler against fake slack and openai servers
+package loadtest
+
+import (
+	"context"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/fake"
+	slackgpt "github.com/chikamif/slackgpt/src/slack"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/slack-go/slack/socketmode"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Options configures a load test run
+type Options struct {
+	// Events is the number of mentions sent at each concurrency level
+	Events int
+	// Concurrency lists the number of simultaneous in-flight mentions to test
+	Concurrency []int
+	// GPTLatency is how long the fake openai server takes to answer
+	GPTLatency time.Duration
+	// Timeout bounds how long a single mention may wait for its answer
+	Timeout time.Duration
+}
+
+// Result reports how the handler behaved at one concurrency level
+type Result struct {
+	Concurrency int
+	Sent        int
+	Answered    int
+	Duration    time.Duration
+	Throughput  float64
+	P50         time.Duration
+	P99         time.Duration
+	AckP99      time.Duration
+	// MaxUnacked is the largest number of events delivered to the bot but not yet acknowledged,
+	// showing how far the socketmode event queue backed up
+	MaxUnacked int
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("concurrency=%-4d sent=%-5d answered=%-5d throughput=%7.1f/s p50=%-10v p99=%-10v ack_p99=%-10v max_unacked=%d",
+		r.Concurrency, r.Sent, r.Answered, r.Throughput, r.P50.Round(time.Microsecond), r.P99.Round(time.Microsecond),
+		r.AckP99.Round(time.Microsecond), r.MaxUnacked)
+}
+
+// tracker correlates sent events with their acks and answers
+type tracker struct {
+	sync.Mutex
+	answers    map[string]chan struct{}
+	acks       map[string]time.Time
+	ackTimes   []time.Duration
+	maxUnacked int
+}
+
+func newTracker() *tracker {
+	return &tracker{
+		answers: make(map[string]chan struct{}),
+		acks:    make(map[string]time.Time),
+	}
+}
+
+func (t *tracker) sent(ts, envelopeID string, at time.Time) chan struct{} {
+	t.Lock()
+	defer t.Unlock()
+	done := make(chan struct{})
+	t.answers[ts] = done
+	t.acks[envelopeID] = at
+	if len(t.acks) > t.maxUnacked {
+		t.maxUnacked = len(t.acks)
+	}
+	return done
+}
+
+func (t *tracker) acked(envelopeID string) {
+	t.Lock()
+	defer t.Unlock()
+	if at, ok := t.acks[envelopeID]; ok {
+		t.ackTimes = append(t.ackTimes, time.Since(at))
+		delete(t.acks, envelopeID)
+	}
+}
+
+func (t *tracker) answered(msg fake.Message) {
+	t.Lock()
+	defer t.Unlock()
+	if done, ok := t.answers[msg.ThreadTS]; ok {
+		close(done)
+		delete(t.answers, msg.ThreadTS)
+	}
+}
+
+// Run starts fake slack and openai servers, connects the event handler to them and sends
+// opts.Events mentions at each concurrency level, returning one Result per level
+func Run(ctx context.Context, opts Options) ([]Result, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	slackServer := fake.NewSlack()
+	defer slackServer.Close()
+	gptServer := fake.NewOpenAI(opts.GPTLatency)
+	defer gptServer.Close()
+
+	logger := log.New(io.Discard, "", 0)
+	gptConfig := openai.DefaultConfig("sk-loadtest")
+	gptConfig.BaseURL = gptServer.URL()
+	slackClient := slack.New(
+		"xoxb-loadtest",
+		slack.OptionAppLevelToken("xapp-loadtest"),
+		slack.OptionAPIURL(slackServer.APIURL()),
+		slack.OptionLog(logger),
+	)
+	args := slackgpt.EventHandlerArgs{
+		Logger:           logger,
+		SlackClient:      slackClient,
+		SocketModeClient: socketmode.New(slackClient, socketmode.OptionLog(logger)),
+		GPTClient:        openai.NewClientWithConfig(gptConfig),
+		Context:          ctx,
+	}
+	handler := args.NewSocketmodeHandler()
+	handlerDone := make(chan struct{})
+	go func() {
+		defer close(handlerDone)
+		_ = slackgpt.EventHandler(args, handler)
+	}()
+	// deferred calls run last in first out: stop the handler and wait for it before the servers close
+	defer func() { <-handlerDone }()
+	defer cancel()
+
+	connectCtx, connectCancel := context.WithTimeout(ctx, 10*time.Second)
+	defer connectCancel()
+	if err := slackServer.WaitConnected(connectCtx); err != nil {
+		return nil, fmt.Errorf("waiting for socketmode connection: %w", err)
+	}
+
+	var results []Result
+	for i, concurrency := range opts.Concurrency {
+		t := newTracker()
+		slackServer.OnAck(t.acked)
+		slackServer.OnPost(t.answered)
+		result, err := runLevel(ctx, slackServer, t, fmt.Sprintf("C%04d", i), concurrency, opts)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func runLevel(ctx context.Context, slackServer *fake.Slack, t *tracker, channel string, concurrency int, opts Options) (Result, error) {
+	var (
+		mu        sync.Mutex
+		latencies []time.Duration
+		sent      int
+		sendErr   error
+		wg        sync.WaitGroup
+	)
+	events := make(chan int)
+	start := time.Now()
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range events {
+				ts := fmt.Sprintf("%d.%06d", start.Unix(), n)
+				envelopeID := channel + "-" + ts
+				sentAt := time.Now()
+				done := t.sent(ts, envelopeID, sentAt)
+				err := slackServer.SendEnvelope(envelopeID, slackevents.AppMentionEvent{
+					Type:      string(slackevents.AppMention),
+					User:      fmt.Sprintf("U%04d", n%50),
+					Text:      fmt.Sprintf("<@U0BOT> load test question %d", n),
+					TimeStamp: ts,
+					Channel:   channel,
+				})
+				mu.Lock()
+				if err != nil {
+					sendErr = err
+					mu.Unlock()
+					continue
+				}
+				sent++
+				mu.Unlock()
+				select {
+				case <-done:
+					mu.Lock()
+					latencies = append(latencies, time.Since(sentAt))
+					mu.Unlock()
+				case <-time.After(opts.Timeout):
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+	for n := 0; n < opts.Events && ctx.Err() == nil; n++ {
+		events <- n
+	}
+	close(events)
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	t.Lock()
+	defer t.Unlock()
+	result := Result{
+		Concurrency: concurrency,
+		Sent:        sent,
+		Answered:    len(latencies),
+		Duration:    elapsed,
+		Throughput:  float64(len(latencies)) / elapsed.Seconds(),
+		P50:         percentile(latencies, 50),
+		P99:         percentile(latencies, 99),
+		AckP99:      percentile(t.ackTimes, 99),
+		MaxUnacked:  t.maxUnacked,
+	}
+	return result, sendErr
+}
+
+// percentile returns the pth percentile of durations, sorting them in place
+func percentile(durations []time.Duration, p int) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	idx := (len(durations)*p+99)/100 - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return durations[idx]
+}
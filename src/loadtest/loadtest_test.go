@@ -0,0 +1,40 @@
+package loadtest
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/leakcheck"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(leakcheck.Main(m))
+}
+
+func TestRun(t *testing.T) {
+	results, err := Run(context.Background(), Options{
+		Events:      10,
+		Concurrency: []int{1, 4},
+		GPTLatency:  time.Millisecond,
+		Timeout:     10 * time.Second,
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	for _, result := range results {
+		assert.Equal(t, 10, result.Sent)
+		assert.Equal(t, 10, result.Answered)
+		assert.LessOrEqual(t, result.MaxUnacked, result.Concurrency)
+		assert.NotZero(t, result.P99)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	durations := []time.Duration{5, 1, 4, 2, 3}
+	assert.Equal(t, time.Duration(1), percentile(durations, 1))
+	assert.Equal(t, time.Duration(3), percentile(durations, 50))
+	assert.Equal(t, time.Duration(5), percentile(durations, 99))
+	assert.Equal(t, time.Duration(0), percentile(nil, 99))
+}
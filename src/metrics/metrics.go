@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"github.com/sashabaranov/go-openai"
+	"net/http"
+	"time"
+)
+
+// Metrics are the bot's metrics. All methods are safe to call on a nil Metrics, which records nothing.
+type Metrics struct {
+	// Registry holds the metrics below, more can be added to it
+	Registry      *Registry
+	events        *Counter
+	eventDuration *Histogram
+	gptRequests   *Counter
+	gptDuration   *Histogram
+	gptTokens     *Counter
+	embedRequests *Counter
+	embedTokens   *Counter
+	errors        *Counter
+	qualityJudged *Counter
+	qualityScores *Histogram
+}
+
+// New creates the bot's metrics in a new registry
+func New() *Metrics {
+	r := NewRegistry()
+	return &Metrics{
+		Registry:      r,
+		events:        r.NewCounter("slackgpt_slack_events_total", "Slack events received, by type.", "type"),
+		eventDuration: r.NewHistogram("slackgpt_slack_event_duration_seconds", "Time spent handling Slack events, by type.", DefaultBuckets, "type"),
+		gptRequests:   r.NewCounter("slackgpt_gpt_requests_total", "Chat completion requests, by model and outcome.", "model", "outcome"),
+		gptDuration:   r.NewHistogram("slackgpt_gpt_request_duration_seconds", "Chat completion latency, by model.", DefaultBuckets, "model"),
+		gptTokens:     r.NewCounter("slackgpt_gpt_tokens_total", "Tokens used by chat completions, by model and kind (prompt or completion).", "model", "kind"),
+		embedRequests: r.NewCounter("slackgpt_embed_requests_total", "Embedding requests from other services, by caller and outcome.", "caller", "outcome"),
+		embedTokens:   r.NewCounter("slackgpt_embed_tokens_total", "Tokens used by embedding requests from other services, by caller and model.", "caller", "model"),
+		errors:        r.NewCounter("slackgpt_errors_total", "Errors, by source (gpt, embed, slack, panic or judge).", "source"),
+		qualityJudged: r.NewCounter("slackgpt_quality_samples_total", "Answers sampled for a judge model to score, by model and outcome.", "model", "outcome"),
+		qualityScores: r.NewHistogram("slackgpt_quality_score", "Scores from 1 to 5 a judge model gave sampled answers, by model and criterion.", QualityBuckets, "model", "criterion"),
+	}
+}
+
+// EventReceived counts a Slack event of eventType
+func (m *Metrics) EventReceived(eventType string) {
+	if m == nil {
+		return
+	}
+	m.events.Inc(eventType)
+}
+
+// EventHandled records how long handling a Slack event of eventType took
+func (m *Metrics) EventHandled(eventType string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.eventDuration.Observe(d.Seconds(), eventType)
+}
+
+// ObserveCompletion records a chat completion request to model, making it a chatgpt.Observer
+func (m *Metrics) ObserveCompletion(model string, d time.Duration, usage openai.Usage, err error) {
+	if m == nil {
+		return
+	}
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+		m.Error("gpt")
+	}
+	m.gptRequests.Inc(model, outcome)
+	m.gptDuration.Observe(d.Seconds(), model)
+	m.gptTokens.Add(float64(usage.PromptTokens), model, "prompt")
+	m.gptTokens.Add(float64(usage.CompletionTokens), model, "completion")
+}
+
+// ObserveEmbedding records an embedding request of caller to model, making it an embedapi.Usage
+func (m *Metrics) ObserveEmbedding(caller, model string, d time.Duration, tokens int, err error) {
+	if m == nil {
+		return
+	}
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+		m.Error("embed")
+	}
+	m.embedRequests.Inc(caller, outcome)
+	m.embedTokens.Add(float64(tokens), caller, model)
+}
+
+// ObserveQuality records the scores by criterion a judge model gave a sampled answer of model, or that judging
+// it failed
+func (m *Metrics) ObserveQuality(model string, scores map[string]int, err error) {
+	if m == nil {
+		return
+	}
+	if err != nil {
+		m.qualityJudged.Inc(model, "error")
+		m.Error("judge")
+		return
+	}
+	m.qualityJudged.Inc(model, "ok")
+	for criterion, score := range scores {
+		m.qualityScores.Observe(float64(score), model, criterion)
+	}
+}
+
+// Error counts an error from source
+func (m *Metrics) Error(source string) {
+	if m == nil {
+		return
+	}
+	m.errors.Inc(source)
+}
+
+// Handler serves the metrics to a Prometheus scrape
+func (m *Metrics) Handler() http.Handler {
+	return m.Registry
+}
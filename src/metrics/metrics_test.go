@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"errors"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounter("requests_total", "Requests.", "path")
+	latency := r.NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1})
+	r.NewGaugeFunc("queue", "Queue.", nil, func(set func(float64, ...string)) { set(3) })
+	requests.Inc("/b")
+	requests.Add(2, `/a"`)
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	latency.Observe(5)
+
+	var b strings.Builder
+	_, err := r.WriteTo(&b)
+	require.NoError(t, err)
+	assert.Equal(t, `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 5.55
+latency_seconds_count 3
+# HELP queue Queue.
+# TYPE queue gauge
+queue 3
+# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{path="/a\""} 2
+requests_total{path="/b"} 1
+`, b.String())
+	assert.Panics(t, func() { requests.Inc() }, "every label needs a value")
+}
+
+func TestMetrics(t *testing.T) {
+	m := New()
+	m.EventReceived("app_mention")
+	m.EventHandled("app_mention", 200*time.Millisecond)
+	m.ObserveCompletion("gpt-4o", time.Second, openai.Usage{PromptTokens: 10, CompletionTokens: 5}, nil)
+	m.ObserveCompletion("gpt-4o", time.Second, openai.Usage{}, errors.New("rate limited"))
+	assert.Equal(t, 1.0, m.gptRequests.Value("gpt-4o", "ok"))
+	assert.Equal(t, 1.0, m.gptRequests.Value("gpt-4o", "error"))
+	assert.Equal(t, 1.0, m.errors.Value("gpt"))
+	assert.Equal(t, 10.0, m.gptTokens.Value("gpt-4o", "prompt"))
+	assert.Equal(t, uint64(2), m.gptDuration.Count("gpt-4o"))
+	m.ObserveEmbedding("wiki-search", "text-embedding-3-small", time.Second, 12, nil)
+	assert.Equal(t, 1.0, m.embedRequests.Value("wiki-search", "ok"))
+	assert.Equal(t, 12.0, m.embedTokens.Value("wiki-search", "text-embedding-3-small"))
+	m.ObserveQuality("gpt-4o", map[string]int{"accuracy": 4, "tone": 5}, nil)
+	m.ObserveQuality("gpt-4o", nil, errors.New("not JSON"))
+	assert.Equal(t, 1.0, m.qualityJudged.Value("gpt-4o", "ok"))
+	assert.Equal(t, 1.0, m.qualityJudged.Value("gpt-4o", "error"))
+	assert.Equal(t, 1.0, m.errors.Value("judge"))
+	assert.Equal(t, uint64(1), m.qualityScores.Count("gpt-4o", "tone"))
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), `slackgpt_slack_events_total{type="app_mention"} 1`)
+	assert.Contains(t, rec.Body.String(), `slackgpt_gpt_tokens_total{kind="completion",model="gpt-4o"} 5`)
+
+	var nilMetrics *Metrics
+	nilMetrics.EventReceived("app_mention")
+	nilMetrics.ObserveCompletion("gpt-4o", time.Second, openai.Usage{}, nil)
+	nilMetrics.ObserveEmbedding("wiki-search", "text-embedding-3-small", time.Second, 0, nil)
+}
@@ -0,0 +1,136 @@
+// Package metrics exposes what the bot is doing to Prometheus
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"io"
+	"net/http"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of latency histograms
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// QualityBuckets are the upper bounds of the histograms of scores from 1 to 5
+var QualityBuckets = []float64{1, 2, 3, 4, 5}
+
+// Registry collects metrics so they can be written together. Any other Prometheus collector can be registered
+// with it too.
+type Registry struct {
+	*prometheus.Registry
+	handler http.Handler
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	r := prometheus.NewRegistry()
+	return &Registry{Registry: r, handler: promhttp.HandlerFor(r, promhttp.HandlerOpts{})}
+}
+
+// WriteTo writes every metric in the Prometheus text format, sorted by name
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	families, err := r.Gather()
+	if err != nil {
+		return 0, err
+	}
+	var written int64
+	for _, f := range families {
+		n, err := expfmt.MetricFamilyToText(w, f)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// ServeHTTP serves the metrics to a Prometheus scrape
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.handler.ServeHTTP(w, req)
+}
+
+// read returns the current state of m
+func read(m prometheus.Metric) *dto.Metric {
+	var out dto.Metric
+	if err := m.Write(&out); err != nil {
+		panic(err)
+	}
+	return &out
+}
+
+// Counter is a value that only goes up, by label values
+type Counter struct {
+	vec *prometheus.CounterVec
+}
+
+// NewCounter creates a counter with labels and registers it
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{vec: prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)}
+	r.MustRegister(c.vec)
+	return c
+}
+
+// Add adds v, which must not be negative, to the counter with labelValues
+func (c *Counter) Add(v float64, labelValues ...string) {
+	c.vec.WithLabelValues(labelValues...).Add(v)
+}
+
+// Inc adds 1 to the counter with labelValues
+func (c *Counter) Inc(labelValues ...string) {
+	c.vec.WithLabelValues(labelValues...).Inc()
+}
+
+// Value returns the counter with labelValues
+func (c *Counter) Value(labelValues ...string) float64 {
+	return read(c.vec.WithLabelValues(labelValues...)).GetCounter().GetValue()
+}
+
+// Histogram counts observations in buckets, by label values
+type Histogram struct {
+	vec *prometheus.HistogramVec
+}
+
+// NewHistogram creates a histogram with the upper bounds buckets, in increasing order, and labels and
+// registers it
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{vec: prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: help, Buckets: buckets}, labels)}
+	r.MustRegister(h.vec)
+	return h
+}
+
+// Observe adds v to the histogram with labelValues
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.vec.WithLabelValues(labelValues...).Observe(v)
+}
+
+// Count returns how many values the histogram with labelValues observed
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	return read(h.vec.WithLabelValues(labelValues...).(prometheus.Metric)).GetHistogram().GetSampleCount()
+}
+
+// GaugeFunc is a value that goes up and down, read when the metrics are written
+type GaugeFunc struct {
+	desc    *prometheus.Desc
+	collect func(set func(v float64, labelValues ...string))
+}
+
+// NewGaugeFunc creates a gauge with labels whose values collect sets, and registers it
+func (r *Registry) NewGaugeFunc(name, help string, labels []string, collect func(set func(v float64, labelValues ...string))) *GaugeFunc {
+	g := &GaugeFunc{desc: prometheus.NewDesc(name, help, labels, nil), collect: collect}
+	r.MustRegister(g)
+	return g
+}
+
+// Describe sends the gauge's description, making it a prometheus.Collector
+func (g *GaugeFunc) Describe(ch chan<- *prometheus.Desc) {
+	ch <- g.desc
+}
+
+// Collect sends the values collect sets
+func (g *GaugeFunc) Collect(ch chan<- prometheus.Metric) {
+	g.collect(func(v float64, labelValues ...string) {
+		ch <- prometheus.MustNewConstMetric(g.desc, prometheus.GaugeValue, v, labelValues...)
+	})
+}
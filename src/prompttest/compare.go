@@ -0,0 +1,154 @@
+package prompttest
+
+import (
+	"context"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"io"
+	"strings"
+)
+
+// DefaultWidth is the width of each column of a comparison report
+const DefaultWidth = 60
+
+// CompareOptions configures a comparison of the answers of two templates
+type CompareOptions struct {
+	A, B      string
+	Templates Templates
+	// Input holds the test questions, separated by lines of ---
+	Input    string
+	Provider chatgpt.ChatProvider
+	// Width is the width of each column of the report, DefaultWidth when 0
+	Width int
+}
+
+// Compare answers every question in opts.Input with templates opts.A and opts.B and writes the answers side by
+// side to w, marking lines only in A with <, lines only in B with > and changed lines with |
+func Compare(ctx context.Context, w io.Writer, opts CompareOptions) error {
+	var templates [2]Template
+	for i, name := range []string{opts.A, opts.B} {
+		template, ok := opts.Templates[name]
+		if !ok {
+			return fmt.Errorf("unknown template %q, configured templates are: %s", name, strings.Join(opts.Templates.Names(), ", "))
+		}
+		templates[i] = template
+	}
+	samples := Samples(opts.Input)
+	if len(samples) == 0 {
+		return fmt.Errorf("no sample inputs")
+	}
+	width := opts.Width
+	if width <= 0 {
+		width = DefaultWidth
+	}
+	differ := 0
+	for i, sample := range samples {
+		var answers [2]string
+		for j, template := range templates {
+			answer, err := chatgpt.GetStringResponse(opts.Provider, ctx, Render(template, sample), chatgpt.WithModel(template.Model))
+			if err != nil {
+				return fmt.Errorf("answering sample %d with %s: %w", i+1, []string{opts.A, opts.B}[j], err)
+			}
+			answers[j] = answer
+		}
+		if answers[0] != answers[1] {
+			differ++
+		}
+		fmt.Fprintf(w, "=== sample %d/%d: %s\n", i+1, len(samples), strings.ReplaceAll(sample, "\n", " "))
+		writeRow(w, width, ' ', "A: "+opts.A, "B: "+opts.B)
+		for _, line := range diffLines(wrap(answers[0], width), wrap(answers[1], width)) {
+			writeRow(w, width, line.mark, line.a, line.b)
+		}
+	}
+	fmt.Fprintf(w, "=== %d of %d answers differ\n", differ, len(samples))
+	return nil
+}
+
+// writeRow writes a and b as two columns of width separated by mark, a longer a pushes b to the right
+func writeRow(w io.Writer, width int, mark rune, a, b string) {
+	fmt.Fprintf(w, "%s %c %s\n", a+strings.Repeat(" ", max(width-len([]rune(a)), 0)), mark, b)
+}
+
+// wrap splits text into lines of at most width runes, breaking at spaces where it can
+func wrap(text string, width int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := []rune{}
+		for _, word := range strings.Fields(paragraph) {
+			runes := []rune(word)
+			if len(line) > 0 && len(line)+1+len(runes) > width {
+				lines = append(lines, string(line))
+				line = line[:0]
+			}
+			if len(line) > 0 {
+				line = append(line, ' ')
+			}
+			line = append(line, runes...)
+			for len(line) > width {
+				lines = append(lines, string(line[:width]))
+				line = append([]rune{}, line[width:]...)
+			}
+		}
+		lines = append(lines, string(line))
+	}
+	return lines
+}
+
+// diffLine is a row of a side by side diff
+type diffLine struct {
+	a, b string
+	// mark is ' ' for equal lines, '<' for lines only in a, '>' for lines only in b and '|' for changed lines
+	mark rune
+}
+
+// diffLines aligns a and b on their longest common subsequence of lines, pairing removed and added lines
+// between common lines as changes
+func diffLines(a, b []string) []diffLine {
+	// common[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	common := make([][]int, len(a)+1)
+	for i := range common {
+		common[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+	var lines []diffLine
+	var removed, added []string
+	flush := func() {
+		for k := 0; k < len(removed) || k < len(added); k++ {
+			switch {
+			case k >= len(added):
+				lines = append(lines, diffLine{a: removed[k], mark: '<'})
+			case k >= len(removed):
+				lines = append(lines, diffLine{b: added[k], mark: '>'})
+			default:
+				lines = append(lines, diffLine{a: removed[k], b: added[k], mark: '|'})
+			}
+		}
+		removed, added = nil, nil
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			flush()
+			lines = append(lines, diffLine{a: a[i], b: b[j], mark: ' '})
+			i++
+			j++
+		case j >= len(b) || (i < len(a) && common[i+1][j] >= common[i][j+1]):
+			removed = append(removed, a[i])
+			i++
+		default:
+			added = append(added, b[j])
+			j++
+		}
+	}
+	flush()
+	return lines
+}
@@ -0,0 +1,100 @@
+// Package prompttest renders the bot's configured prompt templates with sample inputs and optionally answers
+// them, so prompts can be iterated on outside slack
+package prompttest
+
+import (
+	"context"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/sashabaranov/go-openai"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Template is a configured prompt the bot answers with
+type Template struct {
+	SystemPrompt string
+	// Model replaces the provider's default model when set
+	Model string
+}
+
+// Templates are the configured prompts by name
+type Templates map[string]Template
+
+// Names returns the template names, sorted
+func (t Templates) Names() []string {
+	names := make([]string, 0, len(t))
+	for name := range t {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Options configures a prompt test
+type Options struct {
+	Template  string
+	Templates Templates
+	// Input holds the sample questions, separated by lines of ---
+	Input string
+	// Provider answers every rendered sample, they are only rendered when nil
+	Provider chatgpt.ChatProvider
+}
+
+// Samples splits input into the samples separated by lines of ---, leaving out empty ones
+func Samples(input string) []string {
+	var samples []string
+	var sample strings.Builder
+	flush := func() {
+		if s := strings.TrimSpace(sample.String()); s != "" {
+			samples = append(samples, s)
+		}
+		sample.Reset()
+	}
+	for _, line := range strings.Split(input, "\n") {
+		if strings.TrimSpace(line) == "---" {
+			flush()
+			continue
+		}
+		sample.WriteString(line + "\n")
+	}
+	flush()
+	return samples
+}
+
+// Render returns the messages sample is sent to the model as with template
+func Render(template Template, sample string) []openai.ChatCompletionMessage {
+	return []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: template.SystemPrompt},
+		{Role: openai.ChatMessageRoleUser, Content: sample},
+	}
+}
+
+// Run renders every sample in opts.Input with opts.Template to w, followed by its answer when opts.Provider is set
+func Run(ctx context.Context, w io.Writer, opts Options) error {
+	template, ok := opts.Templates[opts.Template]
+	if !ok {
+		return fmt.Errorf("unknown template %q, configured templates are: %s", opts.Template, strings.Join(opts.Templates.Names(), ", "))
+	}
+	samples := Samples(opts.Input)
+	if len(samples) == 0 {
+		return fmt.Errorf("no sample inputs")
+	}
+	for i, sample := range samples {
+		fmt.Fprintf(w, "=== sample %d/%d\n", i+1, len(samples))
+		messages := Render(template, sample)
+		for _, message := range messages {
+			fmt.Fprintf(w, "%s: %s\n", message.Role, message.Content)
+		}
+		if opts.Provider == nil {
+			continue
+		}
+		answer, err := chatgpt.GetStringResponse(opts.Provider, ctx, messages, chatgpt.WithModel(template.Model))
+		if err != nil {
+			return fmt.Errorf("answering sample %d: %w", i+1, err)
+		}
+		fmt.Fprintf(w, "%s: %s\n", openai.ChatMessageRoleAssistant, answer)
+	}
+	return nil
+}
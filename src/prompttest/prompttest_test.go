@@ -0,0 +1,89 @@
+package prompttest
+
+import (
+	"bytes"
+	"context"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestSamples(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"how do I reset my vpn?\n", []string{"how do I reset my vpn?"}},
+		{"first\nline two\n---\nsecond\n ---\n\n---\n", []string{"first\nline two", "second"}},
+		{"\n---\n", nil},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Samples(tt.input))
+	}
+}
+
+func TestRun(t *testing.T) {
+	templates := Templates{
+		"system":        {SystemPrompt: "Answer shortly."},
+		"branch/Pirate": {SystemPrompt: "Answer like a pirate.", Model: "gpt-4o"},
+	}
+	var out bytes.Buffer
+	require.NoError(t, Run(context.Background(), &out, Options{Template: "branch/Pirate", Templates: templates, Input: "hello\n---\nbye"}))
+	assert.Equal(t, "=== sample 1/2\nsystem: Answer like a pirate.\nuser: hello\n"+
+		"=== sample 2/2\nsystem: Answer like a pirate.\nuser: bye\n", out.String())
+
+	gptServer := fake.NewOpenAI(0)
+	defer gptServer.Close()
+	gptConfig := openai.DefaultConfig("sk-test")
+	gptConfig.BaseURL = gptServer.URL()
+	out.Reset()
+	require.NoError(t, Run(context.Background(), &out, Options{Template: "system", Templates: templates, Input: "hello", Provider: openai.NewClientWithConfig(gptConfig)}))
+	assert.Equal(t, "=== sample 1/1\nsystem: Answer shortly.\nuser: hello\nassistant: fake answer to: hello\n", out.String())
+
+	err := Run(context.Background(), &out, Options{Template: "channel/C1", Templates: templates, Input: "hello"})
+	assert.EqualError(t, err, `unknown template "channel/C1", configured templates are: branch/Pirate, system`)
+	err = Run(context.Background(), &out, Options{Template: "system", Templates: templates, Input: "\n"})
+	assert.EqualError(t, err, "no sample inputs")
+}
+
+func TestDiffLines(t *testing.T) {
+	lines := diffLines([]string{"same", "old", "gone", "end"}, []string{"same", "new", "end", "added"})
+	assert.Equal(t, []diffLine{
+		{a: "same", b: "same", mark: ' '},
+		{a: "old", b: "new", mark: '|'},
+		{a: "gone", mark: '<'},
+		{a: "end", b: "end", mark: ' '},
+		{b: "added", mark: '>'},
+	}, lines)
+}
+
+func TestWrap(t *testing.T) {
+	assert.Equal(t, []string{"the quick", "brown fox", "", "abcdefghij", "k"}, wrap("the quick brown fox\n\nabcdefghijk", 10))
+}
+
+func TestCompare(t *testing.T) {
+	gptServer := fake.NewOpenAI(0)
+	defer gptServer.Close()
+	gptConfig := openai.DefaultConfig("sk-test")
+	gptConfig.BaseURL = gptServer.URL()
+	templates := Templates{"system": {SystemPrompt: "Answer shortly."}, "branch/Pirate": {SystemPrompt: "Answer like a pirate."}}
+
+	var out bytes.Buffer
+	err := Compare(context.Background(), &out, CompareOptions{
+		A: "system", B: "branch/Pirate", Templates: templates, Input: "hello\n---\nbye", Provider: openai.NewClientWithConfig(gptConfig), Width: 24,
+	})
+	require.NoError(t, err)
+	// the fake openai server echoes the question, whatever the prompt
+	assert.Equal(t, "=== sample 1/2: hello\n"+
+		"A: system                  B: branch/Pirate\n"+
+		"fake answer to: hello      fake answer to: hello\n"+
+		"=== sample 2/2: bye\n"+
+		"A: system                  B: branch/Pirate\n"+
+		"fake answer to: bye        fake answer to: bye\n"+
+		"=== 0 of 2 answers differ\n", out.String())
+
+	err = Compare(context.Background(), &out, CompareOptions{A: "system", B: "channel/C1", Templates: templates, Input: "hello"})
+	assert.ErrorContains(t, err, `unknown template "channel/C1"`)
+}
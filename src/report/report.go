@@ -0,0 +1,198 @@
+// Package report sums up how the bot was adopted over a period, from the usage and feedback it keeps: who used
+// it, where, what answers cost and how users rated them, as markdown or CSV for stakeholders
+package report
+
+import (
+	"encoding/csv"
+	"fmt"
+	slackgpt "github.com/chikamif/slackgpt/src/slack"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// usageMonth is the layout of the months usage is totalled by
+const usageMonth = "2006-01"
+
+// Row is what answers took and how they were rated in a channel, with a model or overall
+type Row struct {
+	Name    string
+	Users   int
+	Answers int
+	Tokens  int
+	// Cost is in US dollars
+	Cost       float64
+	ThumbsUp   int
+	ThumbsDown int
+
+	users map[string]bool
+}
+
+// Resolution is the share of the rated answers that were rated thumbs up, 0 when none were rated
+func (r Row) Resolution() float64 {
+	if r.ThumbsUp+r.ThumbsDown == 0 {
+		return 0
+	}
+	return float64(r.ThumbsUp) / float64(r.ThumbsUp+r.ThumbsDown)
+}
+
+// Report is the adoption of the bot from Since to Until
+type Report struct {
+	Since, Until time.Time
+	// UsageSince is the start of the first month whose usage is counted, usage is totalled by month so whole
+	// months are
+	UsageSince time.Time
+	Total      Row
+	// Channels and Models are the most answers first
+	Channels []Row
+	Models   []Row
+}
+
+// Build sums up usage and feedback from since to until. Feedback is counted when it was given in the period,
+// usage when its month overlaps it.
+func Build(usage []slackgpt.UsageTotal, feedback []slackgpt.Feedback, since, until time.Time) Report {
+	since, until = since.UTC(), until.UTC()
+	r := Report{
+		Since:      since,
+		Until:      until,
+		UsageSince: time.Date(since.Year(), since.Month(), 1, 0, 0, 0, 0, time.UTC),
+		Total:      Row{Name: "total", users: map[string]bool{}},
+	}
+	firstMonth, lastMonth := since.Format(usageMonth), until.Format(usageMonth)
+	channels, models := map[string]*Row{}, map[string]*Row{}
+	row := func(rows map[string]*Row, name string) *Row {
+		if rows[name] == nil {
+			rows[name] = &Row{Name: name, users: map[string]bool{}}
+		}
+		return rows[name]
+	}
+	for _, t := range usage {
+		if t.Month < firstMonth || t.Month > lastMonth {
+			continue
+		}
+		for _, row := range []*Row{&r.Total, row(channels, t.Channel), row(models, t.Model)} {
+			row.users[t.User] = true
+			row.Answers += t.Answers
+			row.Tokens += t.PromptTokens + t.CompletionTokens
+			row.Cost += t.Cost
+		}
+	}
+	for _, f := range feedback {
+		if f.At.Before(since) || f.At.After(until) {
+			continue
+		}
+		for _, row := range []*Row{&r.Total, row(channels, f.Channel), row(models, f.Model)} {
+			if f.Positive {
+				row.ThumbsUp++
+			} else {
+				row.ThumbsDown++
+			}
+		}
+	}
+	r.Total.Users = len(r.Total.users)
+	r.Channels, r.Models = sorted(channels), sorted(models)
+	return r
+}
+
+// sorted returns rows, the most answers first, then the most ratings
+func sorted(rows map[string]*Row) []Row {
+	list := make([]Row, 0, len(rows))
+	for _, row := range rows {
+		row.Users = len(row.users)
+		list = append(list, *row)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Answers != b.Answers {
+			return a.Answers > b.Answers
+		}
+		if a.ThumbsUp+a.ThumbsDown != b.ThumbsUp+b.ThumbsDown {
+			return a.ThumbsUp+a.ThumbsDown > b.ThumbsUp+b.ThumbsDown
+		}
+		return a.Name < b.Name
+	})
+	return list
+}
+
+// ParseSince returns the start of the period a report covers: a number of days before now such as 30d, a
+// duration such as 72h, or a date such as 2024-06-01
+func ParseSince(since string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(since, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n > 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(since); err == nil && d > 0 {
+		return now.Add(-d), nil
+	}
+	if date, err := time.Parse(time.DateOnly, since); err == nil {
+		return date, nil
+	}
+	return time.Time{}, fmt.Errorf("--since must be a number of days such as 30d, a duration or a date such as 2024-06-01, got %q", since)
+}
+
+// WriteMarkdown writes r as markdown tables
+func (r Report) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Adoption from %s to %s\n\n", r.Since.Format(time.DateOnly), r.Until.Format(time.DateOnly))
+	fmt.Fprintf(&b, "- Active users: %d\n", r.Total.Users)
+	fmt.Fprintf(&b, "- Answers: %d\n", r.Total.Answers)
+	fmt.Fprintf(&b, "- Tokens: %d\n", r.Total.Tokens)
+	fmt.Fprintf(&b, "- Cost: $%.2f\n", r.Total.Cost)
+	fmt.Fprintf(&b, "- Feedback: %d :+1: / %d :-1:, %s resolved\n", r.Total.ThumbsUp, r.Total.ThumbsDown, percent(r.Total))
+	if r.UsageSince.Before(r.Since) {
+		fmt.Fprintf(&b, "\n_Usage is totalled by month, it is counted from %s._\n", r.UsageSince.Format(time.DateOnly))
+	}
+	for _, table := range []struct {
+		title, column string
+		rows          []Row
+	}{{"By channel", "Channel", r.Channels}, {"By model", "Model", r.Models}} {
+		fmt.Fprintf(&b, "\n## %s\n\n", table.title)
+		if len(table.rows) == 0 {
+			b.WriteString("No answers.\n")
+			continue
+		}
+		fmt.Fprintf(&b, "| %s | Users | Answers | Tokens | Cost | :+1: | :-1: | Resolved |\n", table.column)
+		b.WriteString("|---|---:|---:|---:|---:|---:|---:|---:|\n")
+		for _, row := range table.rows {
+			fmt.Fprintf(&b, "| %s | %d | %d | %d | $%.2f | %d | %d | %s |\n",
+				row.Name, row.Users, row.Answers, row.Tokens, row.Cost, row.ThumbsUp, row.ThumbsDown, percent(row))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// percent formats the resolution of row, a dash when none of its answers were rated
+func percent(row Row) string {
+	if row.ThumbsUp+row.ThumbsDown == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%%", 100*row.Resolution())
+}
+
+// WriteCSV writes r as a single table, the total first, then a row per channel and per model told apart by
+// their kind
+func (r Report) WriteCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"kind", "name", "since", "until", "users", "answers", "tokens", "cost_usd", "thumbs_up", "thumbs_down", "resolution"})
+	write := func(kind string, row Row) {
+		out.Write([]string{
+			kind, row.Name, r.Since.Format(time.DateOnly), r.Until.Format(time.DateOnly),
+			strconv.Itoa(row.Users), strconv.Itoa(row.Answers), strconv.Itoa(row.Tokens),
+			strconv.FormatFloat(row.Cost, 'f', 4, 64), strconv.Itoa(row.ThumbsUp), strconv.Itoa(row.ThumbsDown),
+			strconv.FormatFloat(row.Resolution(), 'f', 3, 64),
+		})
+	}
+	write("total", r.Total)
+	for _, row := range r.Channels {
+		write("channel", row)
+	}
+	for _, row := range r.Models {
+		write("model", row)
+	}
+	out.Flush()
+	return out.Error()
+}
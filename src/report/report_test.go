@@ -0,0 +1,90 @@
+package report
+
+import (
+	slackgpt "github.com/chikamif/slackgpt/src/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	now   = time.Date(2024, 7, 10, 12, 0, 0, 0, time.UTC)
+	usage = []slackgpt.UsageTotal{
+		{Month: "2024-05", User: "U0OLD", Channel: "C0HELP", Model: "gpt-4o", Answers: 9, PromptTokens: 900, CompletionTokens: 900, Cost: 9},
+		{Month: "2024-06", User: "U1", Channel: "C0HELP", Model: "gpt-4o", Answers: 3, PromptTokens: 300, CompletionTokens: 100, Cost: 1.5},
+		{Month: "2024-06", User: "U2", Channel: "C0HELP", Model: "gpt-4o-mini", Answers: 1, PromptTokens: 50, CompletionTokens: 50, Cost: 0.01},
+		{Month: "2024-07", User: "U1", Channel: "C0DEV", Model: "gpt-4o", Answers: 2, PromptTokens: 200, CompletionTokens: 200, Cost: 1},
+	}
+	feedback = []slackgpt.Feedback{
+		{Channel: "C0HELP", User: "U1", Positive: true, Model: "gpt-4o", At: now.AddDate(0, 0, -20)},
+		{Channel: "C0HELP", User: "U2", Positive: false, Model: "gpt-4o-mini", At: now.AddDate(0, 0, -10)},
+		{Channel: "C0DEV", User: "U1", Positive: true, Model: "gpt-4o", At: now.AddDate(0, 0, -1)},
+		{Channel: "C0DEV", User: "U0OLD", Positive: false, Model: "gpt-4o", At: now.AddDate(0, 0, -60)},
+	}
+)
+
+func TestBuild(t *testing.T) {
+	r := Build(usage, feedback, now.AddDate(0, 0, -30), now)
+	assert.Equal(t, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), r.UsageSince)
+	assert.Equal(t, Row{Name: "total", Users: 2, Answers: 6, Tokens: 900, Cost: 2.51, ThumbsUp: 2, ThumbsDown: 1}, withoutUsers(r.Total))
+	require.Len(t, r.Channels, 2)
+	assert.Equal(t, Row{Name: "C0HELP", Users: 2, Answers: 4, Tokens: 500, Cost: 1.51, ThumbsUp: 1, ThumbsDown: 1}, withoutUsers(r.Channels[0]))
+	assert.Equal(t, Row{Name: "C0DEV", Users: 1, Answers: 2, Tokens: 400, Cost: 1, ThumbsUp: 1}, withoutUsers(r.Channels[1]))
+	require.Len(t, r.Models, 2)
+	assert.Equal(t, "gpt-4o", r.Models[0].Name)
+	assert.Equal(t, 1.0, r.Models[0].Resolution())
+	assert.Equal(t, 0.0, r.Models[1].Resolution())
+}
+
+// withoutUsers returns row without the users it counted, to compare it
+func withoutUsers(row Row) Row {
+	row.users = nil
+	return row
+}
+
+func TestWrite(t *testing.T) {
+	r := Build(usage, feedback, now.AddDate(0, 0, -30), now)
+
+	var md strings.Builder
+	require.NoError(t, r.WriteMarkdown(&md))
+	assert.Contains(t, md.String(), "# Adoption from 2024-06-10 to 2024-07-10")
+	assert.Contains(t, md.String(), "- Active users: 2\n")
+	assert.Contains(t, md.String(), "- Feedback: 2 :+1: / 1 :-1:, 67% resolved\n")
+	assert.Contains(t, md.String(), "it is counted from 2024-06-01")
+	assert.Contains(t, md.String(), "| C0HELP | 2 | 4 | 500 | $1.51 | 1 | 1 | 50% |\n")
+
+	var csv strings.Builder
+	require.NoError(t, r.WriteCSV(&csv))
+	lines := strings.Split(strings.TrimSpace(csv.String()), "\n")
+	require.Len(t, lines, 6)
+	assert.Equal(t, "kind,name,since,until,users,answers,tokens,cost_usd,thumbs_up,thumbs_down,resolution", lines[0])
+	assert.Equal(t, "total,total,2024-06-10,2024-07-10,2,6,900,2.5100,2,1,0.667", lines[1])
+	assert.Equal(t, "model,gpt-4o-mini,2024-06-10,2024-07-10,1,1,100,0.0100,0,1,0.000", lines[5])
+}
+
+func TestParseSince(t *testing.T) {
+	tests := []struct {
+		since string
+		want  time.Time
+		err   bool
+	}{
+		{since: "30d", want: now.AddDate(0, 0, -30)},
+		{since: "72h", want: now.Add(-72 * time.Hour)},
+		{since: "2024-06-01", want: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{since: "0d", err: true},
+		{since: "last month", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.since, func(t *testing.T) {
+			got, err := ParseSince(tt.since, now)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,79 @@
+// Package serverless runs the bot as two functions instead of one long-running socketmode process:
+// an ingress that verifies and acknowledges Events API requests within slack's 3 second deadline,
+// and a worker that answers them from a queue.
+package serverless
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"io"
+	"log"
+	"net/http"
+)
+
+// maxBodyBytes bounds the size of an Events API request, slack's payloads are far smaller
+const maxBodyBytes = 1 << 20
+
+// Queue delivers acknowledged events to the worker
+type Queue interface {
+	Send(ctx context.Context, body string) error
+}
+
+// Ingress is an http.Handler for the slack Events API that enqueues every verified event callback
+type Ingress struct {
+	signingSecret string
+	queue         Queue
+	logger        *log.Logger
+}
+
+// NewIngress creates an Ingress that verifies requests with the app's signing secret
+func NewIngress(signingSecret string, queue Queue, logger *log.Logger) *Ingress {
+	return &Ingress{signingSecret: signingSecret, queue: queue, logger: logger}
+}
+
+// ServeHTTP answers url verification challenges and enqueues event callbacks. Enqueue failures are
+// answered with a 500 so slack retries the event.
+func (i *Ingress) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodyBytes))
+	if err != nil {
+		http.Error(w, "failed reading body", http.StatusBadRequest)
+		return
+	}
+	verifier, err := slack.NewSecretsVerifier(r.Header, i.signingSecret)
+	if err != nil {
+		http.Error(w, "missing or stale signature", http.StatusUnauthorized)
+		return
+	}
+	verifier.Write(body)
+	if err := verifier.Ensure(); err != nil {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	event, err := slackevents.ParseEvent(json.RawMessage(body), slackevents.OptionNoVerifyToken())
+	if err != nil {
+		http.Error(w, "invalid event", http.StatusBadRequest)
+		return
+	}
+	switch event.Type {
+	case slackevents.URLVerification:
+		var challenge slackevents.ChallengeResponse
+		if err := json.Unmarshal(body, &challenge); err != nil {
+			http.Error(w, "invalid challenge", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, challenge.Challenge)
+	case slackevents.CallbackEvent:
+		if err := i.queue.Send(r.Context(), string(body)); err != nil {
+			i.logger.Printf("failed enqueueing event: %v\n", err)
+			http.Error(w, "failed enqueueing event", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,107 @@
+package serverless
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var logger = log.New(os.Stdout, "test", 0)
+
+const testSecret = "signing-secret"
+
+type fakeQueue struct {
+	bodies []string
+	err    error
+}
+
+func (q *fakeQueue) Send(_ context.Context, body string) error {
+	if q.err != nil {
+		return q.err
+	}
+	q.bodies = append(q.bodies, body)
+	return nil
+}
+
+// signedRequest builds an Events API request signed the way slack signs them
+func signedRequest(secret, body string) *http.Request {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", ts, body)
+	r := httptest.NewRequest(http.MethodPost, "/slack/events", strings.NewReader(body))
+	r.Header.Set("X-Slack-Request-Timestamp", ts)
+	r.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return r
+}
+
+const mentionBody = `{"type":"event_callback","team_id":"T1","api_app_id":"A1",` +
+	`"event":{"type":"app_mention","user":"U1","text":"<@U0BOT> hi","ts":"1.000001","channel":"C1"}}`
+
+func TestIngress(t *testing.T) {
+	tests := []struct {
+		name       string
+		request    *http.Request
+		queueErr   error
+		wantStatus int
+		wantBody   string
+		wantQueued int
+	}{
+		{
+			name:       "url verification",
+			request:    signedRequest(testSecret, `{"type":"url_verification","token":"t","challenge":"abc123"}`),
+			wantStatus: http.StatusOK,
+			wantBody:   "abc123",
+		},
+		{
+			name:       "event callback is enqueued",
+			request:    signedRequest(testSecret, mentionBody),
+			wantStatus: http.StatusOK,
+			wantQueued: 1,
+		},
+		{
+			name:       "enqueue failure asks slack to retry",
+			request:    signedRequest(testSecret, mentionBody),
+			queueErr:   errors.New("queue unavailable"),
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name:       "wrong secret",
+			request:    signedRequest("other-secret", mentionBody),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "unsigned",
+			request:    httptest.NewRequest(http.MethodPost, "/slack/events", strings.NewReader(mentionBody)),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "invalid json",
+			request:    signedRequest(testSecret, `{"type":`),
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := &fakeQueue{err: tt.queueErr}
+			w := httptest.NewRecorder()
+			NewIngress(testSecret, queue, logger).ServeHTTP(w, tt.request)
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+			assert.Len(t, queue.bodies, tt.wantQueued)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package serverless
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+// SQSQueue sends events to an SQS queue
+type SQSQueue struct {
+	client   *sqs.Client
+	queueURL string
+}
+
+// NewSQSQueue creates a Queue backed by the SQS queue at queueURL
+func NewSQSQueue(client *sqs.Client, queueURL string) *SQSQueue {
+	return &SQSQueue{client: client, queueURL: queueURL}
+}
+
+// Send enqueues body as a single message
+func (q *SQSQueue) Send(ctx context.Context, body string) error {
+	_, err := q.client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(q.queueURL),
+		MessageBody: aws.String(body),
+	})
+	return err
+}
+
+// IngressHandler adapts an http.Handler such as Ingress to a lambda behind a function URL or an
+// API gateway HTTP API
+func IngressHandler(h http.Handler) func(context.Context, events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	return func(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+		body := req.Body
+		if req.IsBase64Encoded {
+			decoded, err := base64.StdEncoding.DecodeString(req.Body)
+			if err != nil {
+				return events.APIGatewayV2HTTPResponse{StatusCode: http.StatusBadRequest}, nil
+			}
+			body = string(decoded)
+		}
+		r, err := http.NewRequestWithContext(ctx, req.RequestContext.HTTP.Method, req.RawPath, strings.NewReader(body))
+		if err != nil {
+			return events.APIGatewayV2HTTPResponse{StatusCode: http.StatusBadRequest}, nil
+		}
+		for k, v := range req.Headers {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		headers := make(map[string]string, len(w.Header()))
+		for k := range w.Header() {
+			headers[k] = w.Header().Get(k)
+		}
+		return events.APIGatewayV2HTTPResponse{
+			StatusCode: w.Code,
+			Headers:    headers,
+			Body:       w.Body.String(),
+		}, nil
+	}
+}
+
+// WorkerHandler adapts a Worker to an SQS triggered lambda. Records that are not events are logged and dropped
+// rather than retried, as they would fail again.
+func WorkerHandler(w *Worker) func(context.Context, events.SQSEvent) error {
+	return func(ctx context.Context, event events.SQSEvent) error {
+		for _, record := range event.Records {
+			if err := w.Handle(ctx, record.Body); err != nil {
+				w.logger.Printf("dropped message %s that is not an event: %v\n", record.MessageId, err)
+			}
+		}
+		return nil
+	}
+}
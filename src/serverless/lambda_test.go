@@ -0,0 +1,48 @@
+package serverless
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestIngressHandler(t *testing.T) {
+	var gotBody, gotHeader string
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody, gotHeader = string(body), r.Header.Get("X-Slack-Signature")
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, "ok")
+	})
+	req := events.APIGatewayV2HTTPRequest{
+		RawPath:         "/slack/events",
+		Headers:         map[string]string{"x-slack-signature": "v0=abc"},
+		Body:            base64.StdEncoding.EncodeToString([]byte(`{"type":"event_callback"}`)),
+		IsBase64Encoded: true,
+	}
+	req.RequestContext.HTTP.Method = http.MethodPost
+
+	resp, err := IngressHandler(h)(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, "ok", resp.Body)
+	assert.Equal(t, "text/plain", resp.Headers["Content-Type"])
+	assert.Equal(t, `{"type":"event_callback"}`, gotBody)
+	assert.Equal(t, "v0=abc", gotHeader)
+}
+
+func TestWorkerHandlerDropsBadRecords(t *testing.T) {
+	worker, slackServer := newTestWorker(t)
+	err := WorkerHandler(worker)(context.Background(), events.SQSEvent{Records: []events.SQSMessage{
+		{MessageId: "bad", Body: `{"type":`},
+		{MessageId: "good", Body: mentionBody},
+	}})
+	require.NoError(t, err)
+	assert.Len(t, slackServer.Messages(), 1)
+}
@@ -0,0 +1,31 @@
+package serverless
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	slackhandler "github.com/chikamif/slackgpt/src/slack"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// Worker answers events enqueued by an Ingress
+type Worker struct {
+	processor *slackhandler.EventProcessor
+	logger    *log.Logger
+}
+
+// NewWorker creates a Worker that answers events with processor
+func NewWorker(processor *slackhandler.EventProcessor, logger *log.Logger) *Worker {
+	return &Worker{processor: processor, logger: logger}
+}
+
+// Handle answers one queued Events API request body. It only fails when body is not an event, failures to answer
+// are told to the user who asked by processor.
+func (w *Worker) Handle(ctx context.Context, body string) error {
+	event, err := slackevents.ParseEvent(json.RawMessage(body), slackevents.OptionNoVerifyToken())
+	if err != nil {
+		return err
+	}
+	w.processor.Process(ctx, event)
+	return nil
+}
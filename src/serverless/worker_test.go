@@ -0,0 +1,45 @@
+package serverless
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/fake"
+	slackhandler "github.com/chikamif/slackgpt/src/slack"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func newTestWorker(t *testing.T) (*Worker, *fake.Slack) {
+	slackServer := fake.NewSlack()
+	gptServer := fake.NewOpenAI(0)
+	t.Cleanup(slackServer.Close)
+	t.Cleanup(gptServer.Close)
+
+	gptConfig := openai.DefaultConfig("sk-test")
+	gptConfig.BaseURL = gptServer.URL()
+	processor := slackhandler.NewEventProcessor(slackhandler.EventHandlerArgs{
+		Logger:      logger,
+		SlackClient: slack.New("xoxb-test", slack.OptionAPIURL(slackServer.APIURL())),
+		GPTClient:   openai.NewClientWithConfig(gptConfig),
+	})
+	return NewWorker(processor, logger), slackServer
+}
+
+func TestWorkerAnswersMention(t *testing.T) {
+	worker, slackServer := newTestWorker(t)
+	require.NoError(t, worker.Handle(context.Background(), mentionBody))
+
+	messages := slackServer.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, "C1", messages[0].Channel)
+	assert.Equal(t, "1.000001", messages[0].ThreadTS)
+	assert.Contains(t, messages[0].Text, "fake answer to: hi")
+}
+
+func TestWorkerRejectsInvalidBody(t *testing.T) {
+	worker, slackServer := newTestWorker(t)
+	assert.Error(t, worker.Handle(context.Background(), `{"type":`))
+	assert.Empty(t, slackServer.Messages())
+}
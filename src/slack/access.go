@@ -0,0 +1,109 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/slack-go/slack"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// groupMembersRefresh is how long the members of the required user group are remembered
+const groupMembersRefresh = 10 * time.Minute
+
+// access limits who may ask questions where: only in the allowed channels, when there are any, and only members of
+// the required user group, when there is one
+type access struct {
+	// channels are where questions are answered, anywhere the bot is when nil. Direct messages are not channels
+	// and are always answered.
+	channels map[string]bool
+	group    string
+
+	mu      sync.Mutex
+	members map[string]bool
+	fetched time.Time
+}
+
+// newAccess creates the access rules, nil when there are none
+func newAccess(channels []string, group string) *access {
+	if len(channels) == 0 && group == "" {
+		return nil
+	}
+	a := &access{group: group}
+	if len(channels) > 0 {
+		a.channels = make(map[string]bool, len(channels))
+		for _, channel := range channels {
+			a.channels[channel] = true
+		}
+	}
+	return a
+}
+
+// member reports whether user is in the required user group. The members are looked up again after
+// groupMembersRefresh, those looked up last are kept when that fails; nobody is a member until they are known.
+func (a *access) member(ctx context.Context, api *slack.Client, user string) (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.members == nil || time.Since(a.fetched) > groupMembersRefresh {
+		members, err := api.GetUserGroupMembersContext(ctx, a.group)
+		if err != nil {
+			return a.members[user], err
+		}
+		a.members = make(map[string]bool, len(members))
+		for _, member := range members {
+			a.members[member] = true
+		}
+		a.fetched = time.Now()
+	}
+	return a.members[user], nil
+}
+
+// accessNotice returns the message telling user why they may not ask in channel, empty when they may
+func (b *bot) accessNotice(ctx context.Context, api *slack.Client, channel, user string) string {
+	if b.access == nil {
+		return ""
+	}
+	if b.access.channels != nil && !strings.HasPrefix(channel, "D") && !b.access.channels[channel] {
+		b.logger.Printf("Ignored question from %s in %s, not an allowed channel\n", user, channel)
+		names := make([]string, 0, len(b.access.channels))
+		for allowed := range b.access.channels {
+			names = append(names, "<#"+allowed+">")
+		}
+		sort.Strings(names)
+		return "Sorry, I only answer questions in " + strings.Join(names, ", ") + " and in direct messages."
+	}
+	if b.access.group == "" {
+		return ""
+	}
+	member, err := b.access.member(ctx, api, user)
+	if err != nil {
+		b.logger.Printf("failed looking up the members of %s: %v\n", b.access.group, err)
+	}
+	if member {
+		return ""
+	}
+	b.logger.Printf("Ignored question from %s, not a member of %s\n", user, b.access.group)
+	return "Sorry, I only answer members of <!subteam^" + b.access.group + ">."
+}
+
+// permitted reports whether user may ask in channel, telling them why when they may not
+func (b *bot) permitted(ctx context.Context, api *slack.Client, channel, threadTS, user string) bool {
+	notice := b.accessNotice(ctx, api, channel, user)
+	if notice == "" {
+		return true
+	}
+	b.tell(ctx, api, channel, threadTS, user, notice)
+	return false
+}
+
+// mayAnswer reports whether a question user asks in the thread threadTS of channel by clicking a button or
+// editing it may be answered: they may ask there, consented, acknowledged the policy and are within the rate
+// limit. They are told why when it may not. Mentions, direct messages and slash commands make the same checks
+// with their commands in between.
+func (b *bot) mayAnswer(ctx context.Context, api *slack.Client, channel, threadTS, user string) bool {
+	return b.permitted(ctx, api, channel, threadTS, user) &&
+		b.consented(ctx, api, channel, threadTS, user, "") &&
+		b.policyAcknowledged(ctx, api, channel, threadTS, user, "") &&
+		b.withinRateLimit(ctx, api, channel, threadTS, user)
+}
@@ -0,0 +1,52 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestAccess(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     EventHandlerArgs
+		user     string
+		channel  string
+		answered bool
+		told     string
+	}{
+		{"anyone anywhere", EventHandlerArgs{}, "U1", "C1", true, ""},
+		{"allowed channel", EventHandlerArgs{AllowedChannels: []string{"C1"}}, "U1", "C1", true, ""},
+		{"other channel", EventHandlerArgs{AllowedChannels: []string{"C1", "C0HELP"}}, "U1", "C2", false, "only answer questions in <#C0HELP>, <#C1>"},
+		{"direct message", EventHandlerArgs{AllowedChannels: []string{"C1"}}, "U1", "D1", true, ""},
+		{"group member", EventHandlerArgs{RequiredUserGroup: "S0STAFF"}, "U1", "C1", true, ""},
+		{"not a group member", EventHandlerArgs{RequiredUserGroup: "S0STAFF"}, "U2", "C1", false, "only answer members of <!subteam^S0STAFF>"},
+		{"unknown group", EventHandlerArgs{RequiredUserGroup: "S0GONE"}, "U1", "C1", false, "only answer members"},
+		{"ignored bot", EventHandlerArgs{IgnoredUsers: []string{"B0NOISY"}, AllowBots: true}, "U0NOISY", "C1", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, api, slackServer := newFakeBot(t, tt.args)
+			slackServer.AddUserGroup("S0STAFF", "staff", "Staff", "U1")
+			ev := &slackevents.AppMentionEvent{User: tt.user, Text: "<@U0BOT> what is go", Channel: tt.channel, TimeStamp: "1.000001"}
+			if tt.user == "U0NOISY" {
+				ev.BotID = "B0NOISY"
+			}
+			b.answerMention(context.Background(), api, ev)
+			if tt.answered {
+				assert.Len(t, slackServer.Messages(), 1)
+				return
+			}
+			assert.Empty(t, slackServer.Messages())
+			if tt.told == "" {
+				assert.Empty(t, slackServer.Ephemerals())
+				return
+			}
+			ephemerals := slackServer.Ephemerals()
+			require.Len(t, ephemerals, 1)
+			assert.Contains(t, ephemerals[0].Text, tt.told)
+		})
+	}
+}
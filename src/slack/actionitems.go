@@ -0,0 +1,312 @@
+package slackhandler
+
+import (
+	"context"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/slack-go/slack"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// actionDoneActionID marks an action item done
+	actionDoneActionID = "slackgpt_action_done"
+	// actionRemindActionID reminds who clicked it of an action item the next morning
+	actionRemindActionID = "slackgpt_action_remind"
+	// maxActionItems is the most action items a message lists, to stay within Slack's 50 blocks
+	maxActionItems = 20
+	// actionReminderHour is the hour of the next day in the user's time zone action item reminders are sent at
+	actionReminderHour = 9
+	// actionItemBlockID prefixes the ID of the action item a section block lists
+	actionItemBlockID = "slackgpt_action_item_"
+)
+
+// actionsCommandPattern matches listing the open action items of the channel
+var actionsCommandPattern = regexp.MustCompile(`(?is)^actions\s*$`)
+
+// ActionItem is a task the model found in a summary, tracked in the channel the summary was posted in until
+// someone marks it done
+type ActionItem struct {
+	ID       int
+	Channel  string
+	ThreadTS string
+	Task     string
+	Owner    string
+	Due      string
+	Created  time.Time
+	Done     bool
+	DoneBy   string
+}
+
+// ActionItemStore keeps the action items of the summaries posted by the bot by channel. With a path the items
+// are kept in a JSON file so they survive restarts.
+type ActionItemStore struct {
+	mu    sync.Mutex
+	path  string
+	items []ActionItem
+}
+
+// NewActionItemStore creates an action item store backed by the JSON file at path, which is created on the first
+// action item if it does not exist. An empty path keeps them in memory only.
+func NewActionItemStore(path string) (*ActionItemStore, error) {
+	s := &ActionItemStore{path: path}
+	if path == "" {
+		return s, nil
+	}
+	if err := loadJSON(path, &s.items); err != nil {
+		return nil, fmt.Errorf("reading action items: %w", err)
+	}
+	return s, nil
+}
+
+// Add keeps items with the next IDs, returning them with their IDs. The items are kept in memory even when saving
+// fails.
+func (s *ActionItemStore) Add(items []ActionItem) ([]ActionItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	last := 0
+	for _, item := range s.items {
+		last = max(last, item.ID)
+	}
+	added := make([]ActionItem, len(items))
+	for i, item := range items {
+		last++
+		item.ID = last
+		added[i] = item
+	}
+	s.items = append(s.items, added...)
+	return added, s.save()
+}
+
+// Get returns the action item with id, reporting false when there is none
+func (s *ActionItemStore) Get(id int) (ActionItem, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, item := range s.items {
+		if item.ID == id {
+			return item, true
+		}
+	}
+	return ActionItem{}, false
+}
+
+// Open returns the action items of channel that are not done, the oldest first
+func (s *ActionItemStore) Open(channel string) []ActionItem {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var open []ActionItem
+	for _, item := range s.items {
+		if item.Channel == channel && !item.Done {
+			open = append(open, item)
+		}
+	}
+	sort.SliceStable(open, func(i, j int) bool { return open[i].ID < open[j].ID })
+	return open
+}
+
+// Done marks the action item with id done by user, returning it and reporting false when there is none
+func (s *ActionItemStore) Done(id int, user string) (ActionItem, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.items {
+		if item := &s.items[i]; item.ID == id {
+			if !item.Done {
+				item.Done, item.DoneBy = true, user
+				return *item, true, s.save()
+			}
+			return *item, true, nil
+		}
+	}
+	return ActionItem{}, false, nil
+}
+
+// save writes the items to the store's file, when it has one. It must be called with the lock held.
+func (s *ActionItemStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	if err := saveJSON(s.path, s.items); err != nil {
+		return fmt.Errorf("saving action items: %w", err)
+	}
+	return nil
+}
+
+// trackActionItems has the model find the action items of summary, posted in channel in the thread threadTS when
+// it is not empty, keeps them and posts them with buttons to mark them done or be reminded of them. Nothing is kept
+// of channels that retain nothing.
+func (b *bot) trackActionItems(ctx context.Context, api *slack.Client, channel, threadTS, summary string) {
+	if b.actionItems == nil || !b.retains(channel) {
+		return
+	}
+	found, err := chatgpt.GetActionItems(b.gptClient, ctx, summary)
+	if err != nil {
+		b.logger.Printf("failed finding the action items of a summary in %v: %v\n", channel, err)
+		return
+	}
+	if len(found) == 0 {
+		return
+	}
+	items := make([]ActionItem, len(found))
+	for i, item := range found {
+		items[i] = ActionItem{Channel: channel, ThreadTS: threadTS, Task: item.Task, Owner: item.Owner, Due: item.Due, Created: time.Now()}
+	}
+	items, err = b.actionItems.Add(items)
+	if err != nil {
+		b.logger.Printf("failed saving action items: %v\n", err)
+	}
+	text, blocks := actionItemsMessage("Action items", items)
+	options := []slack.MsgOption{slack.MsgOptionText(text, false), slack.MsgOptionBlocks(blocks...)}
+	if threadTS != "" {
+		options = append(options, slack.MsgOptionTS(threadTS))
+	}
+	if _, _, err := api.PostMessageContext(ctx, channel, options...); err != nil {
+		b.logger.Printf("failed posting action items: %v\n", err)
+	}
+}
+
+// actionItemsMessage lists items under title as a text fallback and blocks, with Done and Remind me buttons for
+// those still open
+func actionItemsMessage(title string, items []ActionItem) (string, []slack.Block) {
+	text := fmt.Sprintf("%s: %d", title, len(items))
+	blocks := []slack.Block{slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, "*"+title+"*", false, false), nil, nil)}
+	for i, item := range items {
+		if i == maxActionItems {
+			more := fmt.Sprintf("_and %d more_", len(items)-maxActionItems)
+			blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, more, false, false)))
+			break
+		}
+		id := strconv.Itoa(item.ID)
+		if item.Done {
+			line := fmt.Sprintf("~%s~ done by <@%s>", actionItemLine(item), item.DoneBy)
+			blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, line, false, false), nil, nil, slack.SectionBlockOptionBlockID(actionItemBlockID+id)))
+			continue
+		}
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, "• "+actionItemLine(item), false, false), nil, nil, slack.SectionBlockOptionBlockID(actionItemBlockID+id)))
+		done := slack.NewButtonBlockElement(actionDoneActionID, id, slack.NewTextBlockObject(slack.PlainTextType, "Done", false, false))
+		done.Style = slack.StylePrimary
+		remind := slack.NewButtonBlockElement(actionRemindActionID, id, slack.NewTextBlockObject(slack.PlainTextType, "Remind me", false, false))
+		blocks = append(blocks, slack.NewActionBlock("slackgpt_action_"+id, done, remind))
+	}
+	return text, blocks
+}
+
+// actionItemLine describes item in a line: its task, owner and due date
+func actionItemLine(item ActionItem) string {
+	line := slackEscaper.Replace(item.Task)
+	if item.Owner != "" {
+		line += " — " + slackEscaper.Replace(item.Owner)
+	}
+	if item.Due != "" {
+		line += ", due " + slackEscaper.Replace(item.Due)
+	}
+	return line
+}
+
+// actionItemIDs returns the IDs of the action items listed in blocks
+func actionItemIDs(blocks []slack.Block) []int {
+	var ids []int
+	for _, block := range blocks {
+		if section, ok := block.(*slack.SectionBlock); ok && strings.HasPrefix(section.BlockID, actionItemBlockID) {
+			if id, err := strconv.Atoi(strings.TrimPrefix(section.BlockID, actionItemBlockID)); err == nil {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// actionItemClicked marks the action item whose button was clicked done, in place of the message listing it, or
+// schedules a reminder of it to who clicked
+func (b *bot) actionItemClicked(ctx context.Context, api *slack.Client, callback *slack.InteractionCallback, action *slack.BlockAction) {
+	if b.actionItems == nil {
+		return
+	}
+	id, _ := strconv.Atoi(action.Value)
+	item, ok := b.actionItems.Get(id)
+	if !ok {
+		b.respondClick(ctx, callback, "This action item is no longer tracked.")
+		return
+	}
+	if action.ActionID == actionRemindActionID {
+		b.respondClick(ctx, callback, b.remindActionItem(ctx, api, callback.User.ID, item))
+		return
+	}
+	if _, _, err := b.actionItems.Done(id, callback.User.ID); err != nil {
+		b.logger.Printf("failed saving action items: %v\n", err)
+	}
+	b.logger.Printf("%s marked action item %d in %v done\n", callback.User.ID, id, item.Channel)
+	// ephemeral lists, those of the slash command, are not sent along, so the open items of the channel are
+	// listed again
+	var items []ActionItem
+	for _, listed := range actionItemIDs(callback.Message.Blocks.BlockSet) {
+		if item, ok := b.actionItems.Get(listed); ok {
+			items = append(items, item)
+		}
+	}
+	title := "Action items"
+	if items == nil {
+		title, items = "Open action items", b.actionItems.Open(item.Channel)
+	}
+	if callback.ResponseURL == "" {
+		return
+	}
+	text, blocks := actionItemsMessage(title, items)
+	msg := &slack.WebhookMessage{Text: text, Blocks: &slack.Blocks{BlockSet: blocks}, ReplaceOriginal: true}
+	if err := slack.PostWebhookContext(ctx, callback.ResponseURL, msg); err != nil {
+		b.logger.Printf("failed updating the action items: %v\n", err)
+	}
+}
+
+// remindActionItem schedules a direct message reminding user of item at actionReminderHour the next day in their
+// time zone, returning what to tell them
+func (b *bot) remindActionItem(ctx context.Context, api *slack.Client, user string, item ActionItem) string {
+	loc := time.UTC
+	if info, err := api.GetUserInfoContext(ctx, user); err == nil && info.TZ != "" {
+		if l, err := time.LoadLocation(info.TZ); err == nil {
+			loc = l
+		}
+	}
+	now := time.Now().In(loc)
+	remindAt := time.Date(now.Year(), now.Month(), now.Day()+1, actionReminderHour, 0, 0, 0, loc)
+	text := fmt.Sprintf(":pushpin: Reminder of an action item from <#%s>: %s", item.Channel, actionItemLine(item))
+	if _, _, err := api.ScheduleMessageContext(ctx, user, strconv.FormatInt(remindAt.Unix(), 10), slack.MsgOptionText(text, false)); err != nil {
+		b.logger.Printf("failed scheduling a reminder for %v: %v\n", user, err)
+		return "I could not schedule the reminder. Please try again."
+	}
+	return fmt.Sprintf("I'll remind you of it %s.", slackDate(remindAt))
+}
+
+// respondClick tells who clicked a button text, only to them and without replacing the message
+func (b *bot) respondClick(ctx context.Context, callback *slack.InteractionCallback, text string) {
+	if callback.ResponseURL == "" {
+		return
+	}
+	msg := &slack.WebhookMessage{Text: text, ResponseType: slack.ResponseTypeEphemeral}
+	if err := slack.PostWebhookContext(ctx, callback.ResponseURL, msg); err != nil {
+		b.logger.Printf("failed responding to a click: %v\n", err)
+	}
+}
+
+// respondActionItems answers the actions command sent as a slash command with the open action items of the
+// channel, only to its user
+func (b *bot) respondActionItems(ctx context.Context, cmd *slack.SlashCommand) {
+	if b.actionItems == nil {
+		b.respond(ctx, cmd, completion{note: "Action items are not tracked."}, slack.ResponseTypeEphemeral)
+		return
+	}
+	items := b.actionItems.Open(cmd.ChannelID)
+	if len(items) == 0 {
+		b.respond(ctx, cmd, completion{note: "There are no open action items in this channel."}, slack.ResponseTypeEphemeral)
+		return
+	}
+	text, blocks := actionItemsMessage("Open action items", items)
+	msg := &slack.WebhookMessage{Text: text, Blocks: &slack.Blocks{BlockSet: blocks}, ResponseType: slack.ResponseTypeEphemeral}
+	if err := slack.PostWebhookContext(ctx, cmd.ResponseURL, msg); err != nil {
+		b.logger.Printf("failed listing action items: %v\n", err)
+	}
+}
@@ -0,0 +1,108 @@
+package slackhandler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestActionItemStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "actions.json")
+	store, err := NewActionItemStore(path)
+	require.NoError(t, err)
+	added, err := store.Add([]ActionItem{{Channel: "C1", Task: "send the notes"}, {Channel: "C2", Task: "book a room"}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, added[0].ID)
+	assert.Equal(t, 2, added[1].ID)
+	added, err = store.Add([]ActionItem{{Channel: "C1", Task: "fix the build"}})
+	require.NoError(t, err)
+	assert.Equal(t, 3, added[0].ID)
+
+	reloaded, err := NewActionItemStore(path)
+	require.NoError(t, err)
+	assert.Len(t, reloaded.Open("C1"), 2)
+	item, ok, err := reloaded.Done(1, "U2")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "U2", item.DoneBy)
+	open := reloaded.Open("C1")
+	require.Len(t, open, 1)
+	assert.Equal(t, "fix the build", open[0].Task)
+	_, ok, _ = reloaded.Done(7, "U2")
+	assert.False(t, ok)
+}
+
+// actionItemsModel finds the same action items in every summary
+type actionItemsModel struct{}
+
+func (actionItemsModel) CreateChatCompletion(context.Context, openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	reply := `{"items": [{"task": "Send the notes", "owner": "Ana", "due": "Friday"}, {"task": "Book a room"}]}`
+	message := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: reply}
+	return openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{Message: message}}}, nil
+}
+
+func TestActionItems(t *testing.T) {
+	store, _ := NewActionItemStore("")
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{ActionItems: store})
+	b.gptClient = actionItemsModel{}
+	ctx := context.Background()
+
+	b.trackActionItems(ctx, api, "C1", "1.000001", "Ana sends the notes by Friday, someone books a room.")
+	messages := slackServer.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, "1.000001", messages[0].ThreadTS)
+	assert.Contains(t, messages[0].Blocks, "Send the notes — Ana, due Friday")
+	assert.Contains(t, messages[0].Blocks, actionDoneActionID)
+	require.Len(t, store.Open("C1"), 2)
+
+	var responses []slack.WebhookMessage
+	responseServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg slack.WebhookMessage
+		_ = json.NewDecoder(r.Body).Decode(&msg)
+		responses = append(responses, msg)
+	}))
+	defer responseServer.Close()
+	callback := &slack.InteractionCallback{Type: slack.InteractionTypeBlockActions, User: slack.User{ID: "U2"}, ResponseURL: responseServer.URL}
+	require.NoError(t, json.Unmarshal([]byte(messages[0].Blocks), &callback.Message.Blocks))
+
+	callback.ActionCallback.BlockActions = []*slack.BlockAction{{ActionID: actionRemindActionID, Value: "2"}}
+	b.handleInteraction(ctx, api, callback)
+	scheduled := slackServer.Scheduled()
+	require.Len(t, scheduled, 1)
+	assert.Equal(t, "U2", scheduled[0].Channel)
+	assert.Contains(t, scheduled[0].Text, "Book a room")
+	require.Len(t, responses, 1)
+	assert.False(t, responses[0].ReplaceOriginal)
+	assert.Contains(t, responses[0].Text, "I'll remind you of it")
+
+	callback.ActionCallback.BlockActions = []*slack.BlockAction{{ActionID: actionDoneActionID, Value: "1"}}
+	b.handleInteraction(ctx, api, callback)
+	require.Len(t, responses, 2)
+	assert.True(t, responses[1].ReplaceOriginal)
+	require.NotNil(t, responses[1].Blocks)
+	text := cardText(responses[1].Blocks.BlockSet)
+	assert.Contains(t, text, "~Send the notes — Ana, due Friday~ done by <@U2>")
+	assert.Contains(t, text, "• Book a room")
+	open := store.Open("C1")
+	require.Len(t, open, 1)
+	assert.Equal(t, "Book a room", open[0].Task)
+
+	b.handleSlashCommand(ctx, api, &slack.SlashCommand{Command: gptCommand, Text: "actions", UserID: "U1", ChannelID: "C1", ResponseURL: responseServer.URL})
+	require.Len(t, responses, 3)
+	assert.Equal(t, slack.ResponseTypeEphemeral, responses[2].ResponseType)
+	require.NotNil(t, responses[2].Blocks)
+	text = cardText(responses[2].Blocks.BlockSet)
+	assert.Contains(t, text, "Open action items")
+	assert.NotContains(t, text, "Send the notes")
+
+	b.handleSlashCommand(ctx, api, &slack.SlashCommand{Command: gptCommand, Text: "actions", UserID: "U1", ChannelID: "C2", ResponseURL: responseServer.URL})
+	require.Len(t, responses, 4)
+	assert.Equal(t, "There are no open action items in this channel.", responses[3].Text)
+}
@@ -0,0 +1,141 @@
+package slackhandler
+
+import (
+	"context"
+	"fmt"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"strings"
+)
+
+const (
+	// regenerateActionID identifies the button on answers that answers their question again in their place
+	regenerateActionID = "slackgpt_regenerate"
+	// continueActionID identifies the button on answers that has the model keep going where they stopped
+	continueActionID = "slackgpt_continue"
+	// deleteActionID identifies the button on answers that deletes them, only for the user who asked
+	deleteActionID = "slackgpt_delete"
+	// continuePrompt asks the model to keep going, it is stored in the conversation like a question
+	continuePrompt = "Continue from where you stopped, without repeating what you already said."
+)
+
+// answerButtons are the regenerate, continue and delete buttons of an answer to asker in the conversation under
+// convoKey
+func answerButtons(convoKey, asker string) []slack.BlockElement {
+	value := asker + "|" + convoKey
+	button := func(actionID, label string) *slack.ButtonBlockElement {
+		return slack.NewButtonBlockElement(actionID, value, slack.NewTextBlockObject(slack.PlainTextType, label, false, false))
+	}
+	del := button(deleteActionID, "Delete")
+	del.Style = slack.StyleDanger
+	return []slack.BlockElement{button(regenerateActionID, "Regenerate"), button(continueActionID, "Continue"), del}
+}
+
+// clickedAnswer is the answer whose regenerate, continue or delete button was clicked
+type clickedAnswer struct {
+	channel  string
+	threadTS string
+	ts       string
+	asker    string
+	convoKey string
+	// answer is the answer as the conversation stored it, before is the conversation up to it
+	answer string
+	before []string
+}
+
+// clicked finds the answer whose button was clicked in its conversation, telling the user when it is no longer in it
+func (b *bot) clicked(ctx context.Context, api *slack.Client, callback *slack.InteractionCallback, action *slack.BlockAction, doing string) (clickedAnswer, bool) {
+	asker, convoKey, _ := strings.Cut(action.Value, "|")
+	c := clickedAnswer{channel: callback.Channel.ID, threadTS: callback.Message.ThreadTimestamp, ts: callback.Message.Timestamp, asker: asker, convoKey: convoKey}
+	var ok bool
+	c.answer, c.before, ok = b.convo.Answer(convoKey, unformatResponse(callback.Message.Text))
+	if ok {
+		return c, true
+	}
+	b.tell(ctx, api, c.channel, c.threadTS, callback.User.ID, "This answer is no longer in the conversation, so it can't be "+doing+".")
+	return c, false
+}
+
+// tell sends text to user, as an ephemeral message in the thread of threadTS
+func (b *bot) tell(ctx context.Context, api *slack.Client, channel, threadTS, user, text string) {
+	options := []slack.MsgOption{slack.MsgOptionText(text, false)}
+	if threadTS != "" {
+		options = append(options, slack.MsgOptionTS(threadTS))
+	}
+	if _, err := api.PostEphemeralContext(ctx, channel, user, options...); err != nil {
+		b.logger.Printf("failed telling %v: %v\n", user, err)
+	}
+}
+
+// regenerate answers the question of the answer whose regenerate button was clicked again, replacing the answer
+// in its message and in the conversation
+func (b *bot) regenerate(ctx context.Context, api *slack.Client, callback *slack.InteractionCallback, action *slack.BlockAction) {
+	user := callback.User.ID
+	c, ok := b.clicked(ctx, api, callback, action, "regenerated")
+	if !ok || !b.mayAnswer(ctx, api, c.channel, c.threadTS, user) {
+		return
+	}
+	resp, err := b.completeIn(ctx, api, c.convoKey, c.channel, user, turns(c.before, openai.ChatMessageRoleUser))
+	if err != nil {
+		b.logger.Printf("Failed to get gpt3 response for regenerated answer: %v\n", err)
+		b.tell(ctx, api, c.channel, c.threadTS, user, troubleAnswer(err))
+		return
+	}
+	b.convo.ReplaceMessage(c.convoKey, c.answer, resp.stored())
+	parts := resp.split(maxAnswerText)
+	if _, _, _, err = api.UpdateMessageContext(ctx, c.channel, c.ts, b.replyOptions(parts[0], c.convoKey, c.asker)...); err != nil {
+		b.logger.Printf("failed replacing regenerated answer: %v\n", err)
+		return
+	}
+	b.postRest(ctx, api, c.channel, c.threadTS, c.ts, parts[1:])
+}
+
+// continueAnswer has the model keep going where the answer whose continue button was clicked stopped, posting
+// the rest as a new answer in the thread
+func (b *bot) continueAnswer(ctx context.Context, api *slack.Client, callback *slack.InteractionCallback, action *slack.BlockAction) {
+	user := callback.User.ID
+	c, ok := b.clicked(ctx, api, callback, action, "continued")
+	if !ok || !b.mayAnswer(ctx, api, c.channel, c.threadTS, user) {
+		return
+	}
+	history := append(c.before, c.answer, continuePrompt)
+	resp, err := b.completeIn(ctx, api, c.convoKey, c.channel, user, turns(history, openai.ChatMessageRoleUser))
+	if err != nil {
+		b.logger.Printf("Failed to get gpt3 response for continued answer: %v\n", err)
+		b.tell(ctx, api, c.channel, c.threadTS, user, troubleAnswer(err))
+		return
+	}
+	b.convo.UpdateConversation(c.convoKey, continuePrompt)
+	b.convo.UpdateConversation(c.convoKey, resp.stored())
+	parts := resp.split(maxAnswerText)
+	// answers at the top level of DMs are continued below them, all others in their thread
+	options := b.replyOptions(parts[0], c.convoKey, c.asker)
+	if c.threadTS != "" {
+		options = append(options, slack.MsgOptionTS(c.threadTS))
+	}
+	_, ts, err := api.PostMessageContext(ctx, c.channel, options...)
+	if err != nil {
+		b.logger.Printf("failed posting continued answer: %v\n", err)
+		return
+	}
+	b.postRest(ctx, api, c.channel, c.threadTS, ts, parts[1:])
+}
+
+// deleteAnswer deletes the answer whose delete button was clicked and forgets its exchange, when the user who
+// asked clicked it
+func (b *bot) deleteAnswer(ctx context.Context, api *slack.Client, callback *slack.InteractionCallback, action *slack.BlockAction) {
+	asker, convoKey, _ := strings.Cut(action.Value, "|")
+	channel, threadTS, user := callback.Channel.ID, callback.Message.ThreadTimestamp, callback.User.ID
+	if user != asker {
+		b.tell(ctx, api, channel, threadTS, user, fmt.Sprintf("Only <@%s>, who asked, can delete this answer.", asker))
+		return
+	}
+	if _, _, err := api.DeleteMessageContext(ctx, channel, callback.Message.Timestamp); err != nil {
+		b.logger.Printf("failed deleting answer: %v\n", err)
+		return
+	}
+	if answer, before, ok := b.convo.Answer(convoKey, unformatResponse(callback.Message.Text)); ok && len(before) > 0 {
+		b.convo.RemoveExchange(convoKey, before[len(before)-1], answer)
+	}
+	b.logger.Printf("%v deleted an answer in %v\n", user, convoKey)
+}
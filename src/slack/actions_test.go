@@ -0,0 +1,78 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// answerCallback is a click by user on the button actionID of an answer to asker in thread 1.000001 of C1
+func answerCallback(user, actionID, asker string, answer slack.Msg) *slack.InteractionCallback {
+	callback := &slack.InteractionCallback{
+		Type:    slack.InteractionTypeBlockActions,
+		User:    slack.User{ID: user},
+		Channel: slack.Channel{GroupConversation: slack.GroupConversation{Conversation: slack.Conversation{ID: "C1"}}},
+	}
+	callback.Message.Msg = answer
+	callback.ActionCallback.BlockActions = []*slack.BlockAction{{ActionID: actionID, Value: asker + "|" + ConversationKey("C1", "1.000001")}}
+	return callback
+}
+
+func TestAnswerButtons(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{AnswerButtons: true})
+	ctx := context.Background()
+	key := ConversationKey("C1", "1.000001")
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: "C1", TimeStamp: "1.000001"})
+	answers := slackServer.Messages()
+	require.Len(t, answers, 1)
+	for _, id := range []string{regenerateActionID, continueActionID, deleteActionID} {
+		assert.Contains(t, answers[0].Blocks, id)
+	}
+	answer := slack.Msg{Text: answers[0].Text, Timestamp: answers[0].TS, ThreadTimestamp: "1.000001"}
+
+	b.handleInteraction(ctx, api, answerCallback("U2", regenerateActionID, "U1", answer))
+	require.Len(t, slackServer.Messages(), 1, "the answer is regenerated in its place")
+	assert.Contains(t, slackServer.Messages()[0].Blocks, regenerateActionID)
+	history, _ := b.convo.Get(key)
+	assert.Equal(t, []string{"what is go", "fake answer to: what is go"}, history)
+
+	b.handleInteraction(ctx, api, answerCallback("U2", continueActionID, "U1", answer))
+	messages := slackServer.Messages()
+	require.Len(t, messages, 2)
+	assert.Equal(t, "1.000001", messages[1].ThreadTS)
+	assert.Equal(t, formatResponse("fake answer to: "+continuePrompt), messages[1].Text)
+	history, _ = b.convo.Get(key)
+	assert.Equal(t, []string{"what is go", "fake answer to: what is go", continuePrompt, "fake answer to: " + continuePrompt}, history)
+
+	b.handleInteraction(ctx, api, answerCallback("U2", deleteActionID, "U1", answer))
+	assert.Len(t, slackServer.Messages(), 2, "only the user who asked can delete an answer")
+	ephemerals := slackServer.Ephemerals()
+	require.Len(t, ephemerals, 1)
+	assert.Equal(t, "U2", ephemerals[0].User)
+	assert.Contains(t, ephemerals[0].Text, "<@U1>")
+
+	b.handleInteraction(ctx, api, answerCallback("U1", deleteActionID, "U1", answer))
+	require.Len(t, slackServer.Messages(), 1)
+	assert.Equal(t, messages[1].TS, slackServer.Messages()[0].TS)
+	history, _ = b.convo.Get(key)
+	assert.Equal(t, []string{continuePrompt, "fake answer to: " + continuePrompt}, history, "the deleted exchange is forgotten")
+
+	b.handleInteraction(ctx, api, answerCallback("U1", regenerateActionID, "U1", answer))
+	ephemerals = slackServer.Ephemerals()
+	require.Len(t, ephemerals, 2)
+	assert.Contains(t, ephemerals[1].Text, "no longer in the conversation")
+}
+
+func TestAnswer(t *testing.T) {
+	c := newConversation(0, 0)
+	c.Store("k", []string{"q1", "first part\n\nsecond part", "q2", "other"})
+	answer, before, ok := c.Answer("k", "first part")
+	require.True(t, ok)
+	assert.Equal(t, "first part\n\nsecond part", answer)
+	assert.Equal(t, []string{"q1"}, before)
+	_, _, ok = c.Answer("k", "missing")
+	assert.False(t, ok)
+}
@@ -0,0 +1,37 @@
+package slackhandler
+
+import (
+	"github.com/chikamif/slackgpt/src/command"
+	"regexp"
+)
+
+// keywords are the commands typed at the start of a question, with the words they take after them, which
+// CommandAliases can give other names to
+var keywords = &command.Command{Subcommands: []*command.Command{
+	{Name: "help"},
+	{Name: "faq", Subcommands: []*command.Command{{Name: "list"}, {Name: "add"}, {Name: "remove"}}},
+	{Name: "prompt", Subcommands: []*command.Command{{Name: "history"}, {Name: "set"}, {Name: "rollback"}}},
+	{Name: "schedule", Subcommands: []*command.Command{{Name: "list"}, {Name: "cancel"}}},
+	{Name: "reactions"},
+	{Name: "actions"},
+	{Name: "pin", Subcommands: []*command.Command{{Name: "this"}}},
+	{Name: "unpin", Subcommands: []*command.Command{{Name: "all"}}},
+	{Name: "draw"},
+	{Name: "form"},
+	{Name: "transcribe"},
+	{Name: "clear", Subcommands: []*command.Command{{Name: "convo"}}},
+	{Name: "reset"},
+	{Name: "system"},
+}}
+
+// leadingMentions matches the mentions a question starts with
+var leadingMentions = regexp.MustCompile(`^(?:\s*<@[^<>]*>)*\s*`)
+
+// localize replaces the aliases of the keywords text starts with, after its mentions, with the keywords
+func (b *bot) localize(text string) string {
+	if len(b.aliases) == 0 {
+		return text
+	}
+	mentions := leadingMentions.FindString(text)
+	return mentions + b.aliases.Rewrite(keywords, text[len(mentions):])
+}
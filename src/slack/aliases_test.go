@@ -0,0 +1,57 @@
+package slackhandler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLocalize(t *testing.T) {
+	b := newBot(EventHandlerArgs{Logger: logger, CommandAliases: map[string]string{
+		"ヘルプ": "help", "よくある質問": "faq", "一覧": "list", "予約": "schedule", "取消": "cancel", "絵": "draw",
+	}})
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"<@U0BOT> ヘルプ", "<@U0BOT> help"},
+		{"<@U0BOT> よくある質問 一覧", "<@U0BOT> faq list"},
+		{"<@U0BOT>  予約 取消 3", "<@U0BOT>  schedule cancel 3"},
+		{"<@U0BOT> 絵 一覧の猫", "<@U0BOT> draw 一覧の猫"},
+		{"ヘルプ", "help"},
+		{"<@U0BOT> ヘルプとは何ですか", "<@U0BOT> ヘルプとは何ですか"},
+		{"<@U0BOT> 一覧", "<@U0BOT> 一覧"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			assert.Equal(t, tt.want, b.localize(tt.text))
+		})
+	}
+}
+
+func TestLocalizedCommands(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{CommandAliases: map[string]string{"ヘルプ": "help"}})
+	ctx := context.Background()
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> ヘルプ", Channel: "C1", TimeStamp: "1.000001"})
+	messages := slackServer.Messages()
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0].Blocks, "What I can do")
+
+	var responses []slack.WebhookMessage
+	responseServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg slack.WebhookMessage
+		_ = json.NewDecoder(r.Body).Decode(&msg)
+		responses = append(responses, msg)
+	}))
+	defer responseServer.Close()
+	b.handleSlashCommand(ctx, api, &slack.SlashCommand{Command: gptCommand, Text: "ヘルプ", UserID: "U1", ChannelID: "C1", ResponseURL: responseServer.URL})
+	require.Len(t, responses, 1)
+	require.NotNil(t, responses[0].Blocks)
+	assert.Contains(t, cardText(responses[0].Blocks.BlockSet), "`/gpt [flags] <question>`")
+}
@@ -0,0 +1,204 @@
+package slackhandler
+
+import (
+	"context"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/cache"
+	"github.com/slack-go/slack"
+	"strings"
+	"time"
+)
+
+const (
+	// approveActionID posts the draft answer as it is
+	approveActionID = "slackgpt_approve"
+	// editApprovalActionID opens a modal to change the draft answer before posting it
+	editApprovalActionID = "slackgpt_approval_edit"
+	// rejectActionID throws the draft answer away
+	rejectActionID = "slackgpt_reject"
+	// approvalCallbackID identifies submissions of the modal editing a draft answer
+	approvalCallbackID = "slackgpt_approval"
+	// approvalBlockID and approvalTextActionID identify the answer in the edit modal
+	approvalBlockID      = "slackgpt_approval_text"
+	approvalTextActionID = "slackgpt_approval_text_input"
+	// maxApprovalEdit is the most a plain text input takes
+	maxApprovalEdit = 3000
+)
+
+// pendingApproval is a draft answer waiting to be approved before it is posted
+type pendingApproval struct {
+	Channel string
+	// ThreadTS is the thread the answer goes in, QuestionTS the question it answers
+	ThreadTS   string
+	QuestionTS string
+	User       string
+	ConvoKey   string
+	Question   string
+	Text       string
+	// ResponseURL replaces the draft once it is approved through the edit modal, whose submission has none
+	ResponseURL string
+}
+
+// approvals holds the answers in broadcast channels back until someone approves them, in the review channel or,
+// without one, their asker
+type approvals struct {
+	channels map[string]bool
+	// review is where drafts are approved, they are shown to their asker alone when empty
+	review  string
+	pending *cache.LRU[pendingApproval]
+}
+
+// newApprovals creates the approvals of answers in channels, reviewed in review, holding at most maxEntries
+// drafts, 0 disables the bound. It is nil when no channel needs approvals.
+func newApprovals(channels []string, review string, maxEntries int) *approvals {
+	if len(channels) == 0 {
+		return nil
+	}
+	a := &approvals{channels: make(map[string]bool, len(channels)), review: review}
+	for _, channel := range channels {
+		a.channels[channel] = true
+	}
+	a.pending = cache.NewLRU[pendingApproval]("approvals", maxEntries, 0, nil)
+	return a
+}
+
+// Stats reports the size and effectiveness of the pending approvals cache
+func (a *approvals) Stats() cache.Stats {
+	return a.pending.Stats()
+}
+
+// appliesTo reports whether answers in channel need approval
+func (a *approvals) appliesTo(channel string) bool {
+	return a != nil && a.channels[channel]
+}
+
+// holdForApproval shows the draft answer with approve, edit and reject buttons in the review channel, or to its
+// asker when there is none, instead of posting it
+func (b *bot) holdForApproval(ctx context.Context, api *slack.Client, draft pendingApproval) {
+	key := fmt.Sprintf("%s.%d", draft.Channel, time.Now().UnixNano())
+	b.approvals.pending.Set(key, draft)
+	heading := fmt.Sprintf("Draft answer to <@%s> in <#%s>, posted once approved:", draft.User, draft.Channel)
+	approve := slack.NewButtonBlockElement(approveActionID, key, slack.NewTextBlockObject(slack.PlainTextType, "Approve", false, false))
+	approve.Style = slack.StylePrimary
+	edit := slack.NewButtonBlockElement(editApprovalActionID, key, slack.NewTextBlockObject(slack.PlainTextType, "Edit", false, false))
+	reject := slack.NewButtonBlockElement(rejectActionID, key, slack.NewTextBlockObject(slack.PlainTextType, "Reject", false, false))
+	reject.Style = slack.StyleDanger
+	options := []slack.MsgOption{
+		slack.MsgOptionText(heading+"\n"+draft.Text, false),
+		slack.MsgOptionBlocks(
+			slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, "*"+heading+"*\n"+quote(draft.Question), false, false), nil, nil),
+			slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, truncateRunes(draft.Text, maxApprovalEdit), false, false), nil, nil),
+			slack.NewActionBlock("slackgpt_approval_actions", approve, edit, reject),
+		),
+	}
+	var err error
+	if b.approvals.review != "" {
+		_, _, err = api.PostMessageContext(ctx, b.approvals.review, options...)
+		if err == nil {
+			b.tell(ctx, api, draft.Channel, draft.ThreadTS, draft.User, "Your answer is waiting to be approved before I post it.")
+		}
+	} else {
+		_, err = api.PostEphemeralContext(ctx, draft.Channel, draft.User, append(options, slack.MsgOptionTS(draft.ThreadTS))...)
+	}
+	if err != nil {
+		b.logger.Printf("failed holding the answer in %v for approval: %v\n", draft.Channel, err)
+	}
+}
+
+// decideApproval posts, edits or rejects the draft answer whose button was clicked
+func (b *bot) decideApproval(ctx context.Context, api *slack.Client, callback *slack.InteractionCallback, action *slack.BlockAction) {
+	if b.approvals == nil {
+		return
+	}
+	draft, ok := b.approvals.pending.Get(action.Value)
+	if !ok {
+		b.replaceDraft(ctx, callback, "This draft is no longer known. Please ask again.")
+		return
+	}
+	switch action.ActionID {
+	case rejectActionID:
+		b.approvals.pending.Delete(action.Value)
+		b.replaceDraft(ctx, callback, fmt.Sprintf("<@%s> rejected the answer to <@%s> in <#%s>.", callback.User.ID, draft.User, draft.Channel))
+		if b.approvals.review != "" {
+			b.tell(ctx, api, draft.Channel, draft.ThreadTS, draft.User, "Your answer was not approved.")
+		}
+	case editApprovalActionID:
+		draft.ResponseURL = callback.ResponseURL
+		b.approvals.pending.Set(action.Value, draft)
+		if _, err := api.OpenViewContext(ctx, callback.TriggerID, approvalModal(action.Value, draft)); err != nil {
+			b.logger.Printf("failed opening the draft answer to edit: %v\n", err)
+		}
+	default:
+		draft.ResponseURL = callback.ResponseURL
+		b.approve(ctx, api, action.Value, draft, callback.User.ID)
+	}
+}
+
+// approvalModal is the modal editing draft, whose key is kept in its metadata
+func approvalModal(key string, draft pendingApproval) slack.ModalViewRequest {
+	input := slack.NewPlainTextInputBlockElement(nil, approvalTextActionID)
+	input.Multiline = true
+	input.InitialValue = truncateRunes(draft.Text, maxApprovalEdit)
+	input.MaxLength = maxApprovalEdit
+	return slack.ModalViewRequest{
+		Type:            slack.VTModal,
+		CallbackID:      approvalCallbackID,
+		PrivateMetadata: key,
+		Title:           slack.NewTextBlockObject(slack.PlainTextType, "Edit the answer", false, false),
+		Blocks: slack.Blocks{BlockSet: []slack.Block{
+			slack.NewInputBlock(approvalBlockID, slack.NewTextBlockObject(slack.PlainTextType, "Answer", false, false), nil, input),
+		}},
+		Submit: slack.NewTextBlockObject(slack.PlainTextType, "Approve", false, false),
+		Close:  slack.NewTextBlockObject(slack.PlainTextType, "Cancel", false, false),
+	}
+}
+
+// approvalEdited posts the draft answer as it was changed in the edit modal
+func (b *bot) approvalEdited(ctx context.Context, api *slack.Client, callback *slack.InteractionCallback) {
+	if b.approvals == nil {
+		return
+	}
+	key := callback.View.PrivateMetadata
+	draft, ok := b.approvals.pending.Get(key)
+	if !ok {
+		b.logger.Printf("ignored edit of expired draft answer %q\n", key)
+		return
+	}
+	if text := strings.TrimSpace(callback.View.State.Values[approvalBlockID][approvalTextActionID].Value); text != "" {
+		draft.Text = text
+	}
+	b.approve(ctx, api, key, draft, callback.User.ID)
+}
+
+// approve posts draft where it was asked for, as approved by approver, and replaces the draft saying so
+func (b *bot) approve(ctx context.Context, api *slack.Client, key string, draft pendingApproval, approver string) {
+	options := []slack.MsgOption{slack.MsgOptionText(draft.Text, false)}
+	if draft.ThreadTS != "" {
+		options = append(options, slack.MsgOptionTS(draft.ThreadTS))
+	}
+	_, ts, err := api.PostMessageContext(ctx, draft.Channel, options...)
+	if err != nil {
+		b.logger.Printf("failed posting the approved answer in %v: %v\n", draft.Channel, err)
+		b.replaceDraft(ctx, &slack.InteractionCallback{ResponseURL: draft.ResponseURL}, "I could not post the answer. Please try again.")
+		return
+	}
+	b.approvals.pending.Delete(key)
+	b.replies.Record(draft.QuestionTS, reply{
+		Channel:  draft.Channel,
+		ThreadTS: draft.ThreadTS,
+		ReplyTS:  ts,
+		ConvoKey: draft.ConvoKey,
+		Question: draft.Question,
+		Answer:   draft.Text,
+	})
+	b.replaceDraft(ctx, &slack.InteractionCallback{ResponseURL: draft.ResponseURL},
+		fmt.Sprintf("<@%s> approved the answer to <@%s>, posted in <#%s>.", approver, draft.User, draft.Channel))
+}
+
+// truncateRunes cuts text to at most n runes, ending in an ellipsis when it was cut
+func truncateRunes(text string, n int) string {
+	if runes := []rune(text); len(runes) > n {
+		return string(runes[:n-1]) + "…"
+	}
+	return text
+}
@@ -0,0 +1,105 @@
+package slackhandler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+// approvalKeyPattern finds the key of a draft answer in the blocks of its message
+var approvalKeyPattern = regexp.MustCompile(`"value":"(C0NEWS\.[0-9]+)"`)
+
+// messagesIn returns the messages posted in channel
+func messagesIn(slackServer *fake.Slack, channel string) []fake.Message {
+	var messages []fake.Message
+	for _, msg := range slackServer.Messages() {
+		if msg.Channel == channel {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+func TestApprovals(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{ApprovalChannels: []string{"C0NEWS"}, ApprovalReviewChannel: "C0REVIEW"})
+	ctx := context.Background()
+	var replaced slack.WebhookMessage
+	responseServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&replaced)
+	}))
+	defer responseServer.Close()
+	click := func(actionID, key string) {
+		callback := &slack.InteractionCallback{Type: slack.InteractionTypeBlockActions, User: slack.User{ID: "U2"}, ResponseURL: responseServer.URL, TriggerID: "T1"}
+		callback.ActionCallback.BlockActions = []*slack.BlockAction{{ActionID: actionID, Value: key}}
+		b.handleInteraction(ctx, api, callback)
+	}
+	ask := func(ts string) string {
+		b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: "C0NEWS", TimeStamp: ts})
+		drafts := messagesIn(slackServer, "C0REVIEW")
+		require.NotEmpty(t, drafts)
+		key := approvalKeyPattern.FindStringSubmatch(drafts[len(drafts)-1].Blocks)
+		require.NotNil(t, key)
+		return key[1]
+	}
+
+	key := ask("1.000001")
+	assert.Empty(t, messagesIn(slackServer, "C0NEWS"), "the answer waits for approval")
+	assert.Contains(t, messagesIn(slackServer, "C0REVIEW")[0].Text, "Draft answer to <@U1> in <#C0NEWS>")
+	assert.Contains(t, slackServer.Ephemerals()[0].Text, "waiting to be approved")
+	click(approveActionID, key)
+	posted := messagesIn(slackServer, "C0NEWS")
+	require.Len(t, posted, 1)
+	assert.Equal(t, "1.000001", posted[0].ThreadTS)
+	assert.Contains(t, posted[0].Text, "fake answer to: what is go")
+	assert.Equal(t, "<@U2> approved the answer to <@U1>, posted in <#C0NEWS>.", replaced.Text)
+	_, ok := b.replies.Get("C0NEWS", "1.000001")
+	assert.True(t, ok, "approved answers are edited and deleted with their question")
+
+	key = ask("2.000001")
+	click(editApprovalActionID, key)
+	views := slackServer.Views()
+	require.Len(t, views, 1)
+	assert.Contains(t, views[0].View, "fake answer to: what is go")
+	submission := &slack.InteractionCallback{Type: slack.InteractionTypeViewSubmission}
+	submission.User.ID = "U3"
+	submission.View.CallbackID, submission.View.PrivateMetadata = approvalCallbackID, key
+	submission.View.State = &slack.ViewState{Values: map[string]map[string]slack.BlockAction{
+		approvalBlockID: {approvalTextActionID: {Value: "Go is a programming language."}},
+	}}
+	b.handleInteraction(ctx, api, submission)
+	posted = messagesIn(slackServer, "C0NEWS")
+	require.Len(t, posted, 2)
+	assert.Equal(t, "Go is a programming language.", posted[1].Text)
+	assert.Contains(t, replaced.Text, "<@U3> approved")
+
+	key = ask("3.000001")
+	click(rejectActionID, key)
+	assert.Len(t, messagesIn(slackServer, "C0NEWS"), 2)
+	assert.Contains(t, replaced.Text, "rejected")
+	ephemerals := slackServer.Ephemerals()
+	assert.Equal(t, "Your answer was not approved.", ephemerals[len(ephemerals)-1].Text)
+	click(approveActionID, key)
+	assert.Len(t, messagesIn(slackServer, "C0NEWS"), 2, "rejected drafts cannot be approved")
+}
+
+func TestApprovalsByAsker(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{ApprovalChannels: []string{"C0NEWS"}})
+	ctx := context.Background()
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: "C0NEWS", TimeStamp: "1.000001"})
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: "C1", TimeStamp: "2.000001"})
+	messages := slackServer.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, "C1", messages[0].Channel, "other channels are answered at once")
+	ephemerals := slackServer.Ephemerals()
+	require.Len(t, ephemerals, 1)
+	assert.Equal(t, "U1", ephemerals[0].User)
+	assert.Contains(t, ephemerals[0].Blocks, approveActionID)
+}
@@ -0,0 +1,466 @@
+package slackhandler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// batchInterval is how often the queue is checked for questions to send and batches that are done
+	batchInterval = time.Minute
+	// queuedNotice tells users their question waits for the off-peak window
+	queuedNotice = "Your question is low priority, so it's queued and will be answered %s at a lower cost. " +
+		"I'll reply here and mention you when the answer lands."
+	// maxQueuedQuote is the most characters of a queued question quoted above its answer
+	maxQueuedQuote = 100
+	// queuedAnswerNote is posted above the answer to a queued question
+	queuedAnswerNote = "<@%s> here's the answer to the question you queued: _%s_"
+	// queuedFailureNote tells the asker their queued question could not be answered
+	queuedFailureNote = "<@%s> sorry, your queued question could not be answered: _%s_\n" +
+		"Please ask it again."
+	// maintenanceNotice tells users their question waits for the chat provider's maintenance to be over
+	maintenanceNotice = "The model is down for planned maintenance until %s, so your question is queued. " +
+		"I'll reply here and mention you when the answer lands."
+)
+
+// OffPeakWindow is a daily window of the bot's local time when queued questions are sent, from Start to End
+// after midnight. It spans midnight when End is before Start.
+type OffPeakWindow struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// ParseOffPeakWindow parses a window written as "22:00-06:00"
+func ParseOffPeakWindow(s string) (OffPeakWindow, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return OffPeakWindow{}, fmt.Errorf("off-peak window %q should look like 22:00-06:00", s)
+	}
+	var w OffPeakWindow
+	for _, bound := range []struct {
+		text string
+		into *time.Duration
+	}{{from, &w.Start}, {to, &w.End}} {
+		t, err := time.Parse("15:04", strings.TrimSpace(bound.text))
+		if err != nil {
+			return OffPeakWindow{}, fmt.Errorf("off-peak window %q should look like 22:00-06:00", s)
+		}
+		*bound.into = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	return w, nil
+}
+
+// contains reports whether t falls in the window
+func (w OffPeakWindow) contains(t time.Time) bool {
+	since := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if w.Start <= w.End {
+		return since >= w.Start && since < w.End
+	}
+	return since >= w.Start || since < w.End
+}
+
+// String returns the window as it is written in the config
+func (w OffPeakWindow) String() string {
+	clock := func(d time.Duration) string { return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60) }
+	return clock(w.Start) + "-" + clock(w.End)
+}
+
+// queuedQuestion is a low priority question waiting to be answered
+type queuedQuestion struct {
+	// ID is the channel and timestamp of the question, which the batch tells its answer apart by
+	ID string `json:"id"`
+	// Channel is where the answer is posted, in the thread of ThreadTS or as a new conversation when it is empty
+	Channel  string `json:"channel"`
+	ThreadTS string `json:"thread_ts,omitempty"`
+	User     string `json:"user"`
+	// ConvoKey is the conversation the answer continues
+	ConvoKey string                       `json:"convo_key,omitempty"`
+	Question string                       `json:"question"`
+	Request  openai.ChatCompletionRequest `json:"request"`
+	QueuedAt time.Time                    `json:"queued_at"`
+	// Batch is the batch the question was sent in, empty until it is sent
+	Batch string `json:"batch,omitempty"`
+}
+
+// BatchQueue keeps the low priority questions until they are answered. With a path they are kept in a JSON
+// file so they survive restarts.
+type BatchQueue struct {
+	mu        sync.Mutex
+	path      string
+	questions []queuedQuestion
+}
+
+// NewBatchQueue creates a batch queue backed by the JSON file at path, which is created when the first question
+// is queued if it does not exist. An empty path keeps questions in memory only.
+func NewBatchQueue(path string) (*BatchQueue, error) {
+	q := &BatchQueue{path: path}
+	if path == "" {
+		return q, nil
+	}
+	if err := loadJSON(path, &q.questions); err != nil {
+		return nil, fmt.Errorf("reading batch queue: %w", err)
+	}
+	return q, nil
+}
+
+// add queues question, it is kept in memory even when saving fails
+func (q *BatchQueue) add(question queuedQuestion) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.questions = append(q.questions, question)
+	return q.save()
+}
+
+// pending returns the questions not sent yet
+func (q *BatchQueue) pending() []queuedQuestion {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var pending []queuedQuestion
+	for _, question := range q.questions {
+		if question.Batch == "" {
+			pending = append(pending, question)
+		}
+	}
+	return pending
+}
+
+// sent returns the questions sent by the batch they were sent in
+func (q *BatchQueue) sent() map[string][]queuedQuestion {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	sent := map[string][]queuedQuestion{}
+	for _, question := range q.questions {
+		if question.Batch != "" {
+			sent[question.Batch] = append(sent[question.Batch], question)
+		}
+	}
+	return sent
+}
+
+// markSent records that the questions of ids were sent in batch
+func (q *BatchQueue) markSent(ids []string, batch string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	sent := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		sent[id] = true
+	}
+	for i := range q.questions {
+		if sent[q.questions[i].ID] {
+			q.questions[i].Batch = batch
+		}
+	}
+	return q.save()
+}
+
+// remove forgets the questions of ids once they are answered
+func (q *BatchQueue) remove(ids []string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	done := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		done[id] = true
+	}
+	kept := q.questions[:0]
+	for _, question := range q.questions {
+		if !done[question.ID] {
+			kept = append(kept, question)
+		}
+	}
+	q.questions = kept
+	return q.save()
+}
+
+// save replaces the queue file with the queued questions, the caller must hold q.mu
+func (q *BatchQueue) save() error {
+	if q.path == "" {
+		return nil
+	}
+	if err := saveJSON(q.path, q.questions); err != nil {
+		return fmt.Errorf("saving batch queue: %w", err)
+	}
+	return nil
+}
+
+// batching queues low priority questions and answers them in batches off-peak
+type batching struct {
+	queue *BatchQueue
+	// channels are the channels whose questions are all low priority
+	channels map[string]bool
+	// windows are when questions are sent, any time when empty
+	windows []OffPeakWindow
+	// batcher is nil when the chat provider cannot answer batches, questions are then answered one by one
+	batcher  chatgpt.Batcher
+	interval time.Duration
+	now      func() time.Time
+
+	mu sync.Mutex
+	// clients are the clients of the workspaces questions queued since the bot started were asked in, the
+	// others are answered with the configured client
+	clients map[string]*slack.Client
+}
+
+// newBatching creates the batching of the questions in queue, in memory when nil, queuing those asked in
+// channels and sending them during windows
+func newBatching(queue *BatchQueue, channels []string, windows []OffPeakWindow) *batching {
+	b := &batching{
+		queue:    queue,
+		channels: make(map[string]bool, len(channels)),
+		windows:  windows,
+		interval: batchInterval,
+		now:      time.Now,
+		clients:  map[string]*slack.Client{},
+	}
+	if b.queue == nil {
+		b.queue, _ = NewBatchQueue("")
+	}
+	for _, channel := range channels {
+		b.channels[channel] = true
+	}
+	return b
+}
+
+// lowPriority reports whether questions in channel are queued, b may be nil
+func (b *batching) lowPriority(channel string) bool {
+	return b != nil && b.channels[channel]
+}
+
+// offPeak reports whether t is in an off-peak window
+func (b *batching) offPeak(t time.Time) bool {
+	if len(b.windows) == 0 {
+		return true
+	}
+	for _, w := range b.windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// maintenance reports whether questions are queued because provider is down for maintenance with no fallback
+// answering for it, and until when. b may be nil, questions are not queued then.
+func (b *batching) maintenance(provider chatgpt.ChatProvider) (time.Time, bool) {
+	if b == nil {
+		return time.Time{}, false
+	}
+	until, fallback, ok := chatgpt.Maintenance(provider, b.now())
+	return until, ok && !fallback
+}
+
+// when describes when queued questions are sent
+func (b *batching) when() string {
+	if len(b.windows) == 0 {
+		return "in the next batch"
+	}
+	windows := make([]string, len(b.windows))
+	for i, w := range b.windows {
+		windows[i] = w.String()
+	}
+	return "off-peak (" + strings.Join(windows, ", ") + ")"
+}
+
+// client returns the client to answer the question of id with
+func (b *batching) client(id string, fallback *slack.Client) *slack.Client {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if api, ok := b.clients[id]; ok {
+		return api
+	}
+	return fallback
+}
+
+// forget drops the client of the question of id
+func (b *batching) forget(id string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.clients, id)
+}
+
+// queueQuestion queues question, identified by questionID in channel, from user. The answer continues history
+// in the conversation of convoKey in the thread of threadTS, or starts a new conversation in answerChannel when
+// threadTS is empty. It returns the notice telling the user when it will be answered.
+func (b *bot) queueQuestion(api *slack.Client, channel, answerChannel, threadTS, questionID, user, convoKey, question string, history []openai.ChatCompletionMessage, opts []chatgpt.Option) string {
+	id := channel + "/" + questionID
+	// like completeAs, the channel's settings take precedence over routing and those of the question over both
+	var base []chatgpt.Option
+	if b.routing != nil {
+		base = append(base, b.routing)
+	}
+	opts = append(append(base, b.channelOptions(channel)...), append(opts[:len(opts):len(opts)], b.tokenLimit)...)
+	chat := append([]openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: b.personaIn(convoKey, channel, user)}}, history...)
+	req := chatgpt.NewBatchRequest(b.gptClient, id, chat, opts...)
+	queued := queuedQuestion{
+		ID: id, Channel: answerChannel, ThreadTS: threadTS, User: user, ConvoKey: convoKey, Question: question,
+		Request: req.Request, QueuedAt: b.batching.now().UTC(),
+	}
+	b.batching.mu.Lock()
+	b.batching.clients[id] = api
+	b.batching.mu.Unlock()
+	if err := b.batching.queue.add(queued); err != nil {
+		b.logger.Printf("failed saving queued question %v: %v\n", id, err)
+	}
+	if until, ok := b.batching.maintenance(b.gptClient); ok {
+		return fmt.Sprintf(maintenanceNotice, slackDate(until))
+	}
+	return fmt.Sprintf(queuedNotice, b.batching.when())
+}
+
+// utcDate is how dates are written where slack cannot show them in the reader's time zone
+const utcDate = "Jan 2 15:04 UTC"
+
+// slackDate shows t in the time zone of the user reading it
+func slackDate(t time.Time) string {
+	return fmt.Sprintf("<!date^%d^{date_short_pretty} at {time}|%s>", t.Unix(), t.UTC().Format(utcDate))
+}
+
+// queueMention queues a low priority question asked in a thread, telling the asker when it will be answered
+func (b *bot) queueMention(ctx context.Context, api *slack.Client, channel, threadTS, questionTS, user, convoKey, question string, history []openai.ChatCompletionMessage, opts []chatgpt.Option) {
+	notice := b.queueQuestion(api, channel, channel, threadTS, questionTS, user, convoKey, question, history, opts)
+	options := []slack.MsgOption{slack.MsgOptionText(notice, false), slack.MsgOptionTS(threadTS)}
+	if _, err := api.PostEphemeralContext(ctx, channel, user, options...); err != nil {
+		b.logger.Printf("failed telling %v their question is queued: %v\n", user, err)
+	}
+}
+
+// runBatches sends the queued questions and posts their answers every interval until ctx is done, with
+// fallback in the workspaces of questions queued before the bot started
+func (b *bot) runBatches(ctx context.Context, fallback *slack.Client) {
+	if b.batching == nil {
+		return
+	}
+	ticker := time.NewTicker(b.batching.interval)
+	defer ticker.Stop()
+	for {
+		b.processBatches(ctx, fallback)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// processBatches sends the pending questions when off-peak and the chat provider is not down for maintenance, and
+// posts the answers of the batches that are done
+func (b *bot) processBatches(ctx context.Context, fallback *slack.Client) {
+	q := b.batching.queue
+	now := b.batching.now()
+	_, _, maintenance := chatgpt.Maintenance(b.gptClient, now)
+	if pending := q.pending(); len(pending) > 0 && b.batching.offPeak(now) && !maintenance {
+		b.sendBatch(ctx, fallback, pending)
+	}
+	for batch, questions := range q.sent() {
+		var answers []chatgpt.BatchAnswer
+		if b.batching.batcher != nil {
+			var done bool
+			var err error
+			answers, done, err = b.batching.batcher.BatchAnswers(ctx, batch)
+			if err != nil {
+				b.logger.Printf("failed checking batch %v: %v\n", batch, err)
+			}
+			if !done {
+				continue
+			}
+		}
+		// questions the batch has no answer for were not answered
+		byID := make(map[string]chatgpt.BatchAnswer, len(answers))
+		for _, answer := range answers {
+			byID[answer.ID] = answer
+		}
+		for _, question := range questions {
+			answer, ok := byID[question.ID]
+			if !ok {
+				answer = chatgpt.BatchAnswer{ID: question.ID, Err: errors.New("the batch has no answer for it")}
+			}
+			b.deliverQueued(ctx, fallback, question, answer)
+		}
+	}
+}
+
+// sendBatch sends the pending questions in a batch, or answers them one by one when the chat provider cannot
+// answer batches
+func (b *bot) sendBatch(ctx context.Context, fallback *slack.Client, pending []queuedQuestion) {
+	if b.batching.batcher == nil {
+		for _, question := range pending {
+			answer := chatgpt.BatchAnswer{ID: question.ID}
+			resp, err := b.gptClient.CreateChatCompletion(ctx, question.Request)
+			switch {
+			case err != nil:
+				answer.Err = err
+			case len(resp.Choices) == 0:
+				answer.Err = errors.New("no completion choices returned")
+			default:
+				answer.Answer = strings.TrimSpace(resp.Choices[0].Message.Content)
+			}
+			b.deliverQueued(ctx, fallback, question, answer)
+		}
+		return
+	}
+	reqs := make([]chatgpt.BatchRequest, len(pending))
+	ids := make([]string, len(pending))
+	for i, question := range pending {
+		reqs[i] = chatgpt.BatchRequest{ID: question.ID, Request: question.Request}
+		ids[i] = question.ID
+	}
+	batch, err := b.batching.batcher.SubmitBatch(ctx, reqs)
+	if err != nil {
+		// they are sent again on the next run
+		b.logger.Printf("failed sending %d queued questions: %v\n", len(reqs), err)
+		return
+	}
+	b.logger.Printf("sent %d queued questions in batch %v\n", len(reqs), batch)
+	if err := b.batching.queue.markSent(ids, batch); err != nil {
+		b.logger.Printf("failed saving batch queue: %v\n", err)
+	}
+}
+
+// deliverQueued posts the answer to a queued question, mentioning the asker, and forgets the question
+func (b *bot) deliverQueued(ctx context.Context, fallback *slack.Client, question queuedQuestion, answer chatgpt.BatchAnswer) {
+	api := b.batching.client(question.ID, fallback)
+	asked := slackEscaper.Replace(question.Question)
+	if runes := []rune(asked); len(runes) > maxQueuedQuote {
+		asked = string(runes[:maxQueuedQuote]) + "…"
+	}
+	resp := completion{answer: answer.Answer, note: fmt.Sprintf(queuedAnswerNote, question.User, asked)}
+	if answer.Err != nil {
+		b.logger.Printf("failed answering queued question %v: %v\n", question.ID, answer.Err)
+		resp = completion{note: fmt.Sprintf(queuedFailureNote, question.User, asked)}
+	}
+	resp.blocks = b.blockKit
+	options := answerOptions(resp)
+	if question.ThreadTS != "" {
+		options = append(options, slack.MsgOptionTS(question.ThreadTS))
+	}
+	channel := question.Channel
+	_, ts, err := api.PostMessageContext(ctx, channel, options...)
+	if err != nil && question.ThreadTS == "" {
+		// questions asked with the slash command may come from channels the bot is not in
+		channel = question.User
+		_, ts, err = api.PostMessageContext(ctx, channel, options...)
+	}
+	if err != nil {
+		// it is posted again on the next run
+		b.logger.Printf("failed posting the answer to queued question %v: %v\n", question.ID, err)
+		return
+	}
+	if answer.Err == nil {
+		b.usage.record(question.User, question.Channel, answer.Usage, true)
+		if question.ThreadTS != "" {
+			b.convo.UpdateConversation(question.ConvoKey, answer.Answer)
+		} else {
+			b.convo.Store(ts+channel, []string{question.Question, answer.Answer})
+		}
+	}
+	if err := b.batching.queue.remove([]string{question.ID}); err != nil {
+		b.logger.Printf("failed saving batch queue: %v\n", err)
+	}
+	b.batching.forget(question.ID)
+}
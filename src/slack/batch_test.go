@@ -0,0 +1,171 @@
+package slackhandler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOffPeakWindow(t *testing.T) {
+	tests := []struct {
+		window string
+		at     string
+		want   bool
+	}{
+		{"22:00-06:00", "23:30", true},
+		{"22:00-06:00", "05:59", true},
+		{"22:00-06:00", "06:00", false},
+		{"22:00-06:00", "12:00", false},
+		{"12:00-13:30", "12:00", true},
+		{"12:00-13:30", "13:45", false},
+	}
+	for _, tt := range tests {
+		w, err := ParseOffPeakWindow(tt.window)
+		require.NoError(t, err)
+		at, err := time.Parse("15:04", tt.at)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, w.contains(at), "%s at %s", tt.window, tt.at)
+		assert.Equal(t, tt.window, w.String())
+	}
+	_, err := ParseOffPeakWindow("night")
+	require.EqualError(t, err, `off-peak window "night" should look like 22:00-06:00`)
+}
+
+func TestLowPriorityQuestions(t *testing.T) {
+	ctx := context.Background()
+	slackServer := fake.NewSlack()
+	t.Cleanup(slackServer.Close)
+	gptServer := fake.NewOpenAI(0)
+	t.Cleanup(gptServer.Close)
+	provider, err := chatgpt.NewProvider(chatgpt.ProviderConfig{APIKey: "sk-test", BaseURL: gptServer.URL()})
+	require.NoError(t, err)
+	api := slack.New("xoxb-test", slack.OptionAPIURL(slackServer.APIURL()))
+	queueFile := filepath.Join(t.TempDir(), "queue.json")
+	queue, err := NewBatchQueue(queueFile)
+	require.NoError(t, err)
+	window, err := ParseOffPeakWindow("22:00-06:00")
+	require.NoError(t, err)
+	b := newBot(EventHandlerArgs{
+		Logger: logger, GPTClient: provider, LowPriorityChannels: []string{"C0RANDOM"},
+		OffPeakWindows: []OffPeakWindow{window}, BatchQueue: queue,
+	})
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	b.batching.now = func() time.Time { return now }
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: "C0RANDOM", TimeStamp: "1.000001"})
+	assert.Empty(t, slackServer.Messages(), "low priority questions are not answered right away")
+	ephemerals := slackServer.Ephemerals()
+	require.Len(t, ephemerals, 1)
+	assert.Contains(t, ephemerals[0].Text, "answered off-peak (22:00-06:00)")
+	assert.Equal(t, int64(0), gptServer.Requests())
+
+	reloaded, err := NewBatchQueue(queueFile)
+	require.NoError(t, err)
+	require.Len(t, reloaded.pending(), 1, "the queue survives restarts")
+
+	b.processBatches(ctx, api)
+	assert.Equal(t, int64(0), gptServer.Requests(), "questions wait for the off-peak window")
+
+	now = time.Date(2024, 5, 1, 23, 0, 0, 0, time.Local)
+	b.processBatches(ctx, api)
+	assert.Equal(t, int64(1), gptServer.Requests())
+	messages := slackServer.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, "1.000001", messages[0].ThreadTS)
+	assert.Contains(t, messages[0].Text, "<@U1> here's the answer to the question you queued: _what is go_")
+	assert.Contains(t, messages[0].Text, "fake answer to: what is go")
+	assert.Empty(t, b.batching.queue.pending())
+	assert.Empty(t, b.batching.queue.sent())
+	history, _ := b.convo.Get("1.000001C0RANDOM")
+	assert.Equal(t, []string{"what is go", "fake answer to: what is go"}, history)
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is rust", Channel: "C1", TimeStamp: "2.000001"})
+	assert.Len(t, slackServer.Messages(), 2, "other channels are answered right away")
+}
+
+func TestMaintenanceQueue(t *testing.T) {
+	ctx := context.Background()
+	slackServer := fake.NewSlack()
+	t.Cleanup(slackServer.Close)
+	gptServer := fake.NewOpenAI(0)
+	t.Cleanup(gptServer.Close)
+	provider, err := chatgpt.NewProvider(chatgpt.ProviderConfig{APIKey: "sk-test", BaseURL: gptServer.URL()})
+	require.NoError(t, err)
+	start := time.Now()
+	window := chatgpt.MaintenanceWindow{Start: start.Add(-time.Hour), End: start.Add(time.Hour)}
+	api := slack.New("xoxb-test", slack.OptionAPIURL(slackServer.APIURL()))
+	queue, err := NewBatchQueue("")
+	require.NoError(t, err)
+	b := newBot(EventHandlerArgs{Logger: logger, GPTClient: chatgpt.WithMaintenance(provider, nil, []chatgpt.MaintenanceWindow{window}), BatchQueue: queue})
+	now := start
+	b.batching.now = func() time.Time { return now }
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: "C1", TimeStamp: "1.000001"})
+	assert.Empty(t, slackServer.Messages(), "questions wait for the maintenance to be over")
+	ephemerals := slackServer.Ephemerals()
+	require.Len(t, ephemerals, 1)
+	assert.Contains(t, ephemerals[0].Text, "down for planned maintenance until <!date^")
+	b.processBatches(ctx, api)
+	assert.Equal(t, int64(0), gptServer.Requests())
+
+	now = window.End
+	b.processBatches(ctx, api)
+	assert.Equal(t, int64(1), gptServer.Requests())
+	messages := slackServer.Messages()
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0].Text, "fake answer to: what is go")
+}
+
+func TestLowPriorityQuestions_WithoutBatches(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{LowPriorityChannels: []string{"C0RANDOM"}})
+	ctx := context.Background()
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: "C0RANDOM", TimeStamp: "1.000001"})
+	require.Len(t, slackServer.Ephemerals(), 1)
+	assert.Contains(t, slackServer.Ephemerals()[0].Text, "answered in the next batch")
+	b.processBatches(ctx, api)
+	messages := slackServer.Messages()
+	require.Len(t, messages, 1, "questions are answered one by one without batches")
+	assert.Contains(t, messages[0].Text, "fake answer to: what is go")
+}
+
+func TestLowPriorityCommand(t *testing.T) {
+	window, err := ParseOffPeakWindow("22:00-06:00")
+	require.NoError(t, err)
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{OffPeakWindows: []OffPeakWindow{window}})
+	b.batching.now = func() time.Time { return time.Date(2024, 5, 1, 23, 0, 0, 0, time.Local) }
+	var responses []slack.WebhookMessage
+	responseServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg slack.WebhookMessage
+		_ = json.NewDecoder(r.Body).Decode(&msg)
+		responses = append(responses, msg)
+	}))
+	defer responseServer.Close()
+	ctx := context.Background()
+
+	b.handleSlashCommand(ctx, api, &slack.SlashCommand{
+		Command: gptCommand, Text: "--later what is go", UserID: "U1", ChannelID: "C1", TriggerID: "T1", ResponseURL: responseServer.URL,
+	})
+	require.Len(t, responses, 1)
+	assert.Contains(t, responses[0].Text, "answered off-peak (22:00-06:00)")
+	assert.Empty(t, slackServer.Messages())
+
+	b.processBatches(ctx, api)
+	messages := slackServer.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, "C1", messages[0].Channel)
+	assert.Empty(t, messages[0].ThreadTS, "the answer starts a conversation in the channel")
+	history, ok := b.convo.Get(messages[0].TS + "C1")
+	require.True(t, ok)
+	assert.Equal(t, []string{"what is go", "fake answer to: what is go"}, history)
+}
@@ -0,0 +1,135 @@
+package slackhandler
+
+import (
+	"fmt"
+	"github.com/slack-go/slack"
+	"regexp"
+	"strings"
+)
+
+// maxBlocks is the most blocks slack accepts in a message
+const maxBlocks = 50
+
+var (
+	// mdHeading matches markdown headings, which mrkdwn doesn't have
+	mdHeading = regexp.MustCompile(`^\s{0,3}#{1,6}\s+(.*?)[\s#]*$`)
+	// mdBullet matches the marker of a markdown list item and the indentation nesting it
+	mdBullet = regexp.MustCompile(`^(\s*)[-*+]\s+`)
+	// mdRule matches markdown horizontal rules
+	mdRule = regexp.MustCompile(`^\s*(?:-{3,}|\*{3,}|_{3,})\s*$`)
+	// mdInlineCode matches inline code spans, left as they are
+	mdInlineCode = regexp.MustCompile("`[^`\n]+`")
+	// mdLink matches markdown links to web pages and email addresses
+	mdLink = regexp.MustCompile(`\[([^\]\n]+)\]\(((?:https?://|mailto:)[^\s()|]+)\)`)
+	// mdBold matches bold text, **bold** or __bold__
+	mdBold = regexp.MustCompile(`\*\*([^*\s](?:[^*\n]*[^*\s])?)\*\*|__([^_\s](?:[^_\n]*[^_\s])?)__`)
+	// mdItalic matches italic text written with asterisks, mrkdwn's bold
+	mdItalic = regexp.MustCompile(`\*([^*\s](?:[^*\n]*[^*\s])?)\*`)
+	// mdStrike matches struck through text
+	mdStrike = regexp.MustCompile(`~~([^~\s](?:[^~\n]*[^~\s])?)~~`)
+)
+
+// bullets mark the items of lists by how deeply they are nested
+var bullets = []string{"•", "◦", "▪"}
+
+// toMrkdwn converts the markdown the model answers in to slack's mrkdwn: headings and bold text become bold,
+// italics, strike-through and links take mrkdwn's syntax, list items get bullets and code blocks lose their
+// language. Slack's control characters are escaped everywhere, so answers cannot ping @channel or users.
+func toMrkdwn(markdown string) string {
+	lines := strings.Split(markdown, "\n")
+	fenced := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			if !fenced && strings.Count(trimmed, "```") == 1 {
+				// the language of the code block would be shown as its first line
+				fenced, lines[i] = true, "```"
+				continue
+			}
+			fenced = false
+			lines[i] = slackEscaper.Replace(trimmed)
+		case fenced:
+			lines[i] = slackEscaper.Replace(line)
+		case mdRule.MatchString(line):
+			lines[i] = ""
+		case mdHeading.MatchString(line):
+			heading := mdHeading.FindStringSubmatch(line)[1]
+			lines[i] = "*" + strings.ReplaceAll(mrkdwnInline(heading), "*", "") + "*"
+		default:
+			if m := mdBullet.FindStringSubmatchIndex(line); m != nil {
+				depth := min(len(strings.ReplaceAll(line[:m[3]], "\t", "  "))/2, len(bullets)-1)
+				line = strings.Repeat("    ", depth) + bullets[depth] + " " + line[m[1]:]
+			}
+			lines[i] = mrkdwnInline(line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// mrkdwnInline converts the inline markdown of a line outside code blocks to mrkdwn, leaving code spans as they are
+func mrkdwnInline(line string) string {
+	var b strings.Builder
+	start := 0
+	for _, span := range mdInlineCode.FindAllStringIndex(line, -1) {
+		b.WriteString(mrkdwnText(line[start:span[0]]))
+		b.WriteString(slackEscaper.Replace(line[span[0]:span[1]]))
+		start = span[1]
+	}
+	b.WriteString(mrkdwnText(line[start:]))
+	return b.String()
+}
+
+// mrkdwnText converts inline markdown without code spans to mrkdwn
+func mrkdwnText(text string) string {
+	text = slackEscaper.Replace(text)
+	// bold is marked apart until italics, which mrkdwn writes with underscores, are converted
+	text = mdBold.ReplaceAllString(text, "\x00$1$2\x00")
+	text = mdItalic.ReplaceAllString(text, "_${1}_")
+	text = strings.ReplaceAll(text, "\x00", "*")
+	text = mdStrike.ReplaceAllString(text, "~${1}~")
+	return mdLink.ReplaceAllString(text, "<$2|$1>")
+}
+
+// answerBlocks renders resp with Block Kit: its note, its answer converted to mrkdwn in sections with code
+// blocks in sections of their own, and after a divider the model that answered and the tokens it took. It is
+// nil when the answer takes more blocks than a message has.
+func answerBlocks(resp completion) []slack.Block {
+	var blocks []slack.Block
+	section := func(text string) {
+		if text = strings.Trim(text, "\n"); strings.TrimSpace(text) != "" {
+			blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil))
+		}
+	}
+	section(resp.note)
+	prose := ""
+	for _, segment := range answerSegments(toMrkdwn(resp.answer), maxSectionText) {
+		code := strings.HasPrefix(strings.TrimSpace(segment), "```")
+		if code || !fits(prose+segment, maxSectionText) {
+			section(prose)
+			prose = ""
+		}
+		if code {
+			section(segment)
+			continue
+		}
+		prose += segment
+	}
+	section(prose)
+	if resp.footer != "" {
+		blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, resp.footer, false, false)))
+	}
+	if resp.usage.Model != "" {
+		footer := resp.usage.Model
+		if resp.usage.TotalTokens > 0 {
+			footer = fmt.Sprintf("%s · %d tokens", footer, resp.usage.TotalTokens)
+		}
+		blocks = append(blocks, slack.NewDividerBlock(),
+			slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, footer, false, false)))
+	}
+	// room is left for the buttons below the answer
+	if len(blocks) > maxBlocks-1 {
+		return nil
+	}
+	return blocks
+}
@@ -0,0 +1,128 @@
+package slackhandler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestToMrkdwn(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		want     string
+	}{
+		{"bold", "Use **go fmt** or __gofmt__.", "Use *go fmt* or *gofmt*."},
+		{"italic", "It is *really* fast, _really_.", "It is _really_ fast, _really_."},
+		{"bold and italic", "***both*** and **bold** *italic*", "_*both*_ and *bold* _italic_"},
+		{"strike", "~~slow~~ fast", "~slow~ fast"},
+		{"link", "See [the docs](https://go.dev/doc?a=1&b=2).", "See <https://go.dev/doc?a=1&amp;b=2|the docs>."},
+		{"unsafe link", "[click](javascript:alert(1))", "[click](javascript:alert(1))"},
+		{"heading", "## Getting **started** ##", "*Getting started*"},
+		{"list", "- one\n* two\n  + nested\n    - deeper\n1. numbered", "• one\n• two\n    ◦ nested\n        ▪ deeper\n1. numbered"},
+		{"rule", "above\n---\nbelow", "above\n\nbelow"},
+		{"inline code", "Run `go **test**` <now>", "Run `go **test**` &lt;now&gt;"},
+		{"code block", "```go\nx := **y** && <z>\n```\n**done**", "```\nx := **y** &amp;&amp; &lt;z&gt;\n```\n*done*"},
+		{"mentions", "Ping <!channel> and <@U123>", "Ping &lt;!channel&gt; and &lt;@U123&gt;"},
+		{"multiplication", "2 * 3 * 4", "2 * 3 * 4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, toMrkdwn(tt.markdown))
+		})
+	}
+}
+
+// blockTypes are the types of blocks, and the texts of their sections and contexts
+func blockTypes(blocks []slack.Block) ([]slack.MessageBlockType, []string) {
+	var types []slack.MessageBlockType
+	var texts []string
+	for _, block := range blocks {
+		types = append(types, block.BlockType())
+		switch block := block.(type) {
+		case *slack.SectionBlock:
+			texts = append(texts, block.Text.Text)
+		case *slack.ContextBlock:
+			texts = append(texts, block.ContextElements.Elements[0].(*slack.TextBlockObject).Text)
+		}
+	}
+	return types, texts
+}
+
+func FuzzToMrkdwn(f *testing.F) {
+	for _, seed := range []string{"", "# <!here>", "**[a](https://x.y)**", "- `<@U1>`\n  * b", "```go\n<!channel>\n```", "[x](mailto:a@b.c) ~~y~~ _z_", "***"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, markdown string) {
+		out := toMrkdwn(markdown)
+		if got, want := strings.Count(out, "\n"), strings.Count(markdown, "\n"); got != want {
+			t.Errorf("%d lines became %d: %q -> %q", want+1, got+1, markdown, out)
+		}
+		// the only angle brackets left open links, so answers cannot ping anyone
+		for rest := out; ; {
+			i := strings.Index(rest, "<")
+			if i < 0 {
+				break
+			}
+			rest = rest[i+1:]
+			if !strings.HasPrefix(rest, "http://") && !strings.HasPrefix(rest, "https://") && !strings.HasPrefix(rest, "mailto:") {
+				t.Fatalf("unescaped control character in %q -> %q", markdown, out)
+			}
+		}
+	})
+}
+
+func TestAnswerBlocks(t *testing.T) {
+	answer := "## Install\n\nRun this:\n\n```sh\ngo install example.com/tool@latest\n```\n\n- it is **fast**\n- see [docs](https://example.com)"
+	resp := completion{answer: answer, note: "_A caveat._", usage: chatgpt.Usage{Model: "gpt-4o", Usage: openai.Usage{TotalTokens: 1234}}, blocks: true}
+	types, texts := blockTypes(answerBlocks(resp))
+	assert.Equal(t, []slack.MessageBlockType{slack.MBTSection, slack.MBTSection, slack.MBTSection, slack.MBTSection, slack.MBTDivider, slack.MBTContext}, types)
+	assert.Equal(t, []string{
+		"_A caveat._",
+		"*Install*\n\nRun this:",
+		"```\ngo install example.com/tool@latest\n```",
+		"• it is *fast*\n• see <https://example.com|docs>",
+		"gpt-4o · 1234 tokens",
+	}, texts)
+
+	types, _ = blockTypes(answerBlocks(completion{answer: "hi", blocks: true}))
+	assert.Equal(t, []slack.MessageBlockType{slack.MBTSection}, types, "nothing is said of an unknown model")
+
+	long := strings.Repeat(strings.Repeat("word ", 100)+"\n\n", 12)
+	_, texts = blockTypes(answerBlocks(completion{answer: long, blocks: true}))
+	require.Greater(t, len(texts), 1)
+	for _, text := range texts {
+		assert.LessOrEqual(t, len(text), maxSectionText)
+	}
+
+	assert.Nil(t, answerBlocks(completion{answer: strings.Repeat("```\nx\n```\n\n", 60), blocks: true}), "too many blocks for a message")
+}
+
+func TestBlockKitAnswer(t *testing.T) {
+	ctx := context.Background()
+	slackServer := fake.NewSlack()
+	t.Cleanup(slackServer.Close)
+	api := slack.New("xoxb-test", slack.OptionAPIURL(slackServer.APIURL()))
+	answer := "Use **go test** with [the race detector](https://go.dev/doc/articles/race_detector)."
+	b := newBot(EventHandlerArgs{Logger: logger, GPTClient: longModel(answer), BlockKit: true})
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> how do I find races", Channel: "C1", TimeStamp: "1.000001"})
+	messages := slackServer.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, formatResponse(answer), messages[0].Text, "the text stays the answer for notifications and threads")
+	var blocks slack.Blocks
+	require.NoError(t, json.Unmarshal([]byte(messages[0].Blocks), &blocks))
+	types, texts := blockTypes(blocks.BlockSet)
+	assert.Equal(t, []slack.MessageBlockType{slack.MBTSection, slack.MBTDivider, slack.MBTContext}, types)
+	assert.Equal(t, "Use *go test* with <https://go.dev/doc/articles/race_detector|the race detector>.", texts[0])
+	assert.Equal(t, chatgpt.DefaultModel, texts[1])
+	assert.Equal(t, answer, unformatResponse(messages[0].Text))
+}
@@ -0,0 +1,276 @@
+package slackhandler
+
+import (
+	"context"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/cache"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultBookmarkRefresh is how long the pages a channel bookmarks are used before they are fetched again
+	DefaultBookmarkRefresh = time.Hour
+	// maxBookmarkPages is the most bookmarked pages of a channel that are fetched
+	maxBookmarkPages = 20
+	// maxPageBytes is the most of a bookmarked page that is read
+	maxPageBytes = 1 << 20
+	// bookmarkChunkBytes is about how much page text is retrieved at a time
+	bookmarkChunkBytes = 2000
+	// maxBookmarkBytes is the most page text sent along with a question
+	maxBookmarkBytes = 16 << 10
+	// bookmarkPrompt grounds answers in the bookmarked pages that follow it
+	bookmarkPrompt = "The pages below are bookmarked in this channel. Use them where they answer the question and" +
+		" link the page you used.\n\n"
+)
+
+// bookmarkChunk is a piece of the text of a bookmarked page
+type bookmarkChunk struct {
+	Title string
+	Link  string
+	Text  string
+	// Embedding is nil when chunks cannot be embedded
+	Embedding []float32
+}
+
+// channelBookmarks are the chunks of the pages a channel bookmarks, as fetched at a time
+type channelBookmarks struct {
+	Chunks []bookmarkChunk
+	At     time.Time
+}
+
+// bookmarks grounds answers in the pages channels bookmark, retrieving the parts of them most similar to the
+// question when they can be embedded
+type bookmarks struct {
+	channels map[string]bool
+	refresh  time.Duration
+	client   *http.Client
+	// embedder is nil when the chat provider cannot embed text, pages are then used from the top
+	embedder chatgpt.Embedder
+	model    string
+	// pages are indexed by channel ID
+	pages *cache.LRU[channelBookmarks]
+}
+
+// newBookmarks creates a bookmarks for channels, keeping the pages of at most maxEntries channels
+func newBookmarks(channels []string, refresh time.Duration, maxEntries int) *bookmarks {
+	bm := &bookmarks{
+		channels: make(map[string]bool, len(channels)),
+		refresh:  refresh,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		pages:    cache.NewLRU[channelBookmarks]("bookmarks", maxEntries, 0, nil),
+	}
+	for _, channel := range channels {
+		bm.channels[channel] = true
+	}
+	if bm.refresh <= 0 {
+		bm.refresh = DefaultBookmarkRefresh
+	}
+	return bm
+}
+
+// appliesTo reports whether questions in channel are grounded in its bookmarks
+func (bm *bookmarks) appliesTo(channel string) bool {
+	return bm != nil && bm.channels[channel]
+}
+
+// Stats reports the size and effectiveness of the bookmarked page cache
+func (bm *bookmarks) Stats() cache.Stats {
+	return bm.pages.Stats()
+}
+
+// load returns the chunks of the pages channel bookmarks, fetching them again once they are older than refresh.
+// Pages that cannot be fetched are left out.
+func (bm *bookmarks) load(ctx context.Context, api *slack.Client, channel string, logger *log.Logger) ([]bookmarkChunk, error) {
+	if cached, ok := bm.pages.Get(channel); ok && time.Since(cached.At) < bm.refresh {
+		return cached.Chunks, nil
+	}
+	marks, err := api.ListBookmarksContext(ctx, channel)
+	if err != nil {
+		// e.g. a missing bookmarks:read scope, which asking again for every question will not fix
+		bm.pages.Set(channel, channelBookmarks{At: time.Now()})
+		return nil, fmt.Errorf("listing bookmarks: %w", err)
+	}
+	var chunks []bookmarkChunk
+	fetched := 0
+	for _, mark := range marks {
+		if mark.Type != "link" || fetched == maxBookmarkPages {
+			continue
+		}
+		fetched++
+		text, err := bm.fetch(ctx, mark.Link)
+		if err != nil {
+			logger.Printf("failed fetching bookmark %v in %v: %v\n", mark.Link, channel, err)
+			continue
+		}
+		for _, piece := range chunkText(text, bookmarkChunkBytes) {
+			chunks = append(chunks, bookmarkChunk{Title: mark.Title, Link: mark.Link, Text: piece})
+		}
+	}
+	if bm.embedder != nil && len(chunks) > 0 {
+		texts := make([]string, len(chunks))
+		for i, chunk := range chunks {
+			texts[i] = chunk.Title + "\n" + chunk.Text
+		}
+		embeddings, err := chatgpt.Embed(ctx, bm.embedder, bm.model, texts)
+		if err != nil {
+			logger.Printf("failed embedding bookmarks in %v: %v\n", channel, err)
+		}
+		for i := range embeddings {
+			chunks[i].Embedding = embeddings[i]
+		}
+	}
+	bm.pages.Set(channel, channelBookmarks{Chunks: chunks, At: time.Now()})
+	return chunks, nil
+}
+
+// fetch returns the text of the page at link, which must be a web page or plain text
+func (bm *bookmarks) fetch(ctx context.Context, link string) (string, error) {
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", fmt.Errorf("not a web page")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := bm.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("got status %v", resp.Status)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "text/plain" && mediaType != "text/markdown" {
+		return "", fmt.Errorf("cannot read %q", mediaType)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPageBytes))
+	if err != nil {
+		return "", err
+	}
+	if mediaType == "text/html" {
+		return htmlText(string(body)), nil
+	}
+	return string(body), nil
+}
+
+var (
+	// hiddenElements are the elements of a page whose content is not read
+	hiddenElements = regexp.MustCompile(`(?is)<!--.*?-->|<(script|style|noscript|head|svg)\b.*?</(script|style|noscript|head|svg)\s*>`)
+	// breakingTags start a new line of text
+	breakingTags = regexp.MustCompile(`(?i)<(br|/p|/div|/li|/tr|/h[1-6]|/section|/article)\b[^>]*>`)
+	// tags are any other markup
+	tags = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// htmlText returns the readable text of the web page page
+func htmlText(page string) string {
+	page = hiddenElements.ReplaceAllString(page, " ")
+	// line breaks in the markup are spaces, lines are where the tags break them
+	page = strings.Join(strings.Fields(page), " ")
+	page = breakingTags.ReplaceAllString(page, "\n")
+	page = tags.ReplaceAllString(page, " ")
+	var lines []string
+	for _, line := range strings.Split(html.UnescapeString(page), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// chunkText splits text between words into chunks of about size bytes
+func chunkText(text string, size int) []string {
+	var chunks []string
+	var chunk strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		for i, word := range strings.Fields(line) {
+			if chunk.Len() > 0 && chunk.Len()+len(word) >= size {
+				chunks = append(chunks, chunk.String())
+				chunk.Reset()
+			} else if i > 0 {
+				chunk.WriteByte(' ')
+			} else if chunk.Len() > 0 {
+				chunk.WriteByte('\n')
+			}
+			chunk.WriteString(word)
+		}
+	}
+	if chunk.Len() > 0 {
+		chunks = append(chunks, chunk.String())
+	}
+	return chunks
+}
+
+// retrieve returns the chunks most similar to question that fit in maxBookmarkBytes, or the first ones when
+// they cannot be compared
+func (bm *bookmarks) retrieve(ctx context.Context, chunks []bookmarkChunk, question string) []bookmarkChunk {
+	ranked := append([]bookmarkChunk(nil), chunks...)
+	if bm.embedder != nil && question != "" && len(chunks) > 0 && chunks[0].Embedding != nil {
+		if embeddings, err := chatgpt.Embed(ctx, bm.embedder, bm.model, []string{question}); err == nil {
+			similarity := make([]float64, len(chunks))
+			for i, chunk := range chunks {
+				similarity[i] = chatgpt.Similarity(embeddings[0], chunk.Embedding)
+			}
+			order := make([]int, len(chunks))
+			for i := range order {
+				order[i] = i
+			}
+			sort.SliceStable(order, func(i, j int) bool { return similarity[order[i]] > similarity[order[j]] })
+			for i, index := range order {
+				ranked[i] = chunks[index]
+			}
+		}
+	}
+	var retrieved []bookmarkChunk
+	size := 0
+	for _, chunk := range ranked {
+		if size+len(chunk.Text) > maxBookmarkBytes {
+			continue
+		}
+		size += len(chunk.Text)
+		retrieved = append(retrieved, chunk)
+	}
+	return retrieved
+}
+
+// groundInBookmarks puts the parts of the pages channel bookmarks that best match the last question in front of
+// history. History is returned as it is when there are none.
+func (b *bot) groundInBookmarks(ctx context.Context, api *slack.Client, channel string, history []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	chunks, err := b.bookmarks.load(ctx, api, channel, b.logger)
+	if err != nil {
+		b.logger.Printf("failed reading bookmarks in %v: %v\n", channel, err)
+		return history
+	}
+	var question string
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Role == openai.ChatMessageRoleUser {
+			question = history[i].Content
+			break
+		}
+	}
+	retrieved := b.bookmarks.retrieve(ctx, chunks, question)
+	if len(retrieved) == 0 {
+		return history
+	}
+	var pages strings.Builder
+	pages.WriteString(bookmarkPrompt)
+	for _, chunk := range retrieved {
+		fmt.Fprintf(&pages, "%s (%s):\n%s\n\n", chunk.Title, chunk.Link, chunk.Text)
+	}
+	grounded := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: strings.TrimSpace(pages.String())}}
+	return append(grounded, history...)
+}
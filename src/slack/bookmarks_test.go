@@ -0,0 +1,79 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHTMLText(t *testing.T) {
+	page := `<html><head><title>VPN</title><style>p { color: red }</style></head>
+<body><h1>Resetting the VPN</h1><!-- old steps --><p>Open the  client and
+click <b>Reset</b>.</p><script>track()</script><p>Ask &quot;IT&quot; otherwise.</p></body></html>`
+	assert.Equal(t, "Resetting the VPN\nOpen the client and click Reset .\nAsk \"IT\" otherwise.", htmlText(page))
+}
+
+func TestChunkText(t *testing.T) {
+	assert.Equal(t, []string{"one two", "three\nfour", "five"}, chunkText("one two three\nfour five", 10))
+	assert.Nil(t, chunkText(" \n ", 10))
+}
+
+func TestGroundInBookmarks(t *testing.T) {
+	var fetches atomic.Int64
+	pages := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		switch r.URL.Path {
+		case "/vpn":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte("<h1>VPN</h1><p>Reset the vpn client from the tray icon.</p>"))
+		case "/payroll":
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte("Payroll questions go to HR, payroll runs on the 25th."))
+		case "/slides":
+			w.Header().Set("Content-Type", "application/pdf")
+			_, _ = w.Write([]byte("%PDF"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(pages.Close)
+
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{BookmarkChannels: []string{"C1"}})
+	slackServer.AddBookmark("C1", "VPN guide", pages.URL+"/vpn")
+	slackServer.AddBookmark("C1", "Payroll", pages.URL+"/payroll")
+	slackServer.AddBookmark("C1", "Slides", pages.URL+"/slides")
+	slackServer.AddBookmark("C1", "Gone", pages.URL+"/gone")
+	slackServer.AddBookmark("C1", "Files", "slack://files/F1")
+	ctx := context.Background()
+	assert.True(t, b.bookmarks.appliesTo("C1"))
+	assert.False(t, b.bookmarks.appliesTo("C2"))
+
+	ask := func(question string) []openai.ChatCompletionMessage {
+		return b.groundInBookmarks(ctx, api, "C1", []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: question}})
+	}
+	history := ask("when does payroll run")
+	require.Len(t, history, 2)
+	assert.Equal(t, openai.ChatMessageRoleSystem, history[0].Role)
+	grounding := history[0].Content
+	assert.True(t, strings.HasPrefix(grounding, bookmarkPrompt))
+	assert.Contains(t, grounding, "VPN guide ("+pages.URL+"/vpn):\nVPN\nReset the vpn client from the tray icon.")
+	assert.Contains(t, grounding, "Payroll ("+pages.URL+"/payroll):\nPayroll questions go to HR, payroll runs on the 25th.")
+	assert.Less(t, strings.Index(grounding, "Payroll ("), strings.Index(grounding, "VPN guide ("), "the most similar page comes first")
+	assert.NotContains(t, grounding, "Slides")
+	assert.NotContains(t, grounding, "Gone")
+	assert.Equal(t, "when does payroll run", history[1].Content)
+	assert.Equal(t, int64(4), fetches.Load())
+
+	history = ask("how do I reset the vpn")
+	assert.Less(t, strings.Index(history[0].Content, "VPN guide ("), strings.Index(history[0].Content, "Payroll ("))
+	assert.Equal(t, int64(4), fetches.Load(), "pages are fetched again only after the refresh interval")
+
+	unbookmarked := b.groundInBookmarks(ctx, api, "C2", []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hi"}})
+	assert.Len(t, unbookmarked, 1, "channels without bookmarks are not grounded")
+}
@@ -0,0 +1,403 @@
+package slackhandler
+
+import (
+	"github.com/chikamif/slackgpt/src/audio"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/chikamif/slackgpt/src/command"
+	"github.com/chikamif/slackgpt/src/images"
+	"github.com/chikamif/slackgpt/src/tracing"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// EditAction is what the bot does when a question it answered is edited
+type EditAction string
+
+const (
+	// EditIgnore leaves the answer to an edited question as it is
+	EditIgnore EditAction = "ignore"
+	// EditUpdate regenerates the answer and replaces the original reply in place
+	EditUpdate EditAction = "update"
+	// EditReply regenerates the answer and posts it as a new reply
+	EditReply EditAction = "reply"
+)
+
+// bot holds the clients and state shared by the event handlers
+type bot struct {
+	gptClient chatgpt.ChatProvider
+	logger    *log.Logger
+	convo     *conversation
+	replies   *replies
+	// answering are the answers being generated, cancelled when their question is deleted
+	answering *inflight
+	onEdit    EditAction
+	// editWindow is how long after a question is asked edits to it are answered again, 0 for any time
+	editWindow time.Duration
+	// deleteReplies deletes the bot's answer when the question is deleted
+	deleteReplies bool
+	self          identity
+	ignoredUsers  map[string]bool
+	// access is nil when anyone may ask anywhere the bot is
+	access   *access
+	groupDMs groupDMs
+	// noRetention are the channels nothing of the exchanges in is kept
+	noRetention map[string]bool
+	allowBots   bool
+	loops       *loopGuard
+	mentionMode MentionMode
+	expandEmoji bool
+	userNames   *userNames
+	// consents is nil when users are answered without consent
+	consents    *ConsentStore
+	consentText string
+	// policy is nil when no usage policy has to be acknowledged
+	policy *usagePolicy
+	// hedge is nil when answers are not rated
+	hedge *hedging
+	// escalation is nil when answers have no escalate button
+	escalation *escalation
+	// deflection is nil when no channel is a support channel
+	deflection *deflection
+	// prompts holds the versions of the default and channel system prompts
+	prompts *PromptStore
+	// admins may change the system prompts at runtime
+	admins map[string]bool
+	// titles is nil when threads are not titled
+	titles *titles
+	// pins are the messages pinned as context of threads
+	pins *pins
+	// resets are when the conversations of threads were last reset
+	resets *resets
+	// threadPrompts are the system prompts set for threads
+	threadPrompts *threadPrompts
+	// branches is nil when no branch variants are configured
+	branches *branches
+	// faqs is nil when the chat provider cannot embed text
+	faqs *faqs
+	// bookmarks is nil when no channel's bookmarks are read
+	bookmarks *bookmarks
+	// feedback is nil when answers are not rated
+	feedback *FeedbackStore
+	// usage is nil when spend is not tracked
+	usage *usageTracking
+	// budgets is nil when spend is not limited
+	budgets *budgets
+	// incidents is nil when errors are only logged
+	incidents *incidents
+	// tracer is nil when events are not traced
+	tracer *tracing.Tracer
+	// pipeline are the middlewares every event goes through
+	pipeline []Middleware
+	dedup    dedup
+	// load is nil when how loaded the bot is is not shown
+	load *loadStatus
+	// shared is nil when channels shared with other organizations are answered like any other
+	shared *sharedChannels
+	// directory is nil when questions about people are not answered from the directory or owners
+	directory *directory
+	// tools is nil when the model calls no tools besides the directory's
+	tools *tools
+	// clarify asks what ambiguous questions mean before answering them
+	clarify bool
+	// imaging is nil when pictures are not drawn
+	imaging *imaging
+	// vision is nil when the images attached to questions are not looked at
+	vision *vision
+	// transcription is nil when clips are not transcribed
+	transcription *transcription
+	// forms is nil when no forms are defined
+	forms *forms
+	// approvals is nil when answers are posted without approval
+	approvals *approvals
+	// scheduling is nil when posts are not scheduled through the bot
+	scheduling *scheduling
+	// actionItems is nil when the action items of summaries are not tracked
+	actionItems *ActionItemStore
+	// settings is nil when users have no App Home tab to change how they are answered
+	settings *UserSettingsStore
+	// blockKit renders answers with Block Kit rather than in code blocks
+	blockKit bool
+	// answerButtons adds regenerate, continue and delete buttons to answers
+	answerButtons bool
+	// thinkingMessage is posted while questions are answered and replaced by the answer, nothing is when empty
+	thinkingMessage string
+	// triggerReaction asks about the messages it is added to, reactions trigger nothing when empty
+	triggerReaction string
+	// tokenLimit truncates conversations to the tokens they may take up
+	tokenLimit chatgpt.Option
+	// routing is nil when questions are answered by the default model whatever they are
+	routing chatgpt.Option
+	// channels are the settings of the channels not answered with the defaults
+	channels map[string]ChannelSettings
+	// models is nil when channels cannot be switched to other models at runtime
+	models *channelModels
+	// batching is nil when no question is low priority
+	batching *batching
+	// triageModel classifies questions to pick their pipeline and route, they are not triaged when empty
+	triageModel string
+	// limits is nil when questions are not rate limited
+	limits *rateLimits
+	// moderation is nil when questions are not moderated
+	moderation *moderation
+	// overrides is nil when questions cannot change the parameters they are answered with
+	overrides *overrideTiers
+	// quality is nil when answers are not sampled for a judge model to score
+	quality *qualitySampling
+	// workers is nil when any number of questions are answered at once
+	workers *workerPool
+	// aliases are the other names of keywords and subcommands, such as localized ones
+	aliases command.Aliases
+}
+
+// newBot creates the shared handler state from args, registering its caches with args.Caches
+func newBot(args EventHandlerArgs) *bot {
+	args = args.withDefaults()
+	b := &bot{
+		gptClient: args.GPTClient,
+		logger:    args.Logger,
+		convo:     newConversation(args.MaxConversations, args.MaxConversationBytes),
+		replies:   newReplies(args.MaxConversations),
+		answering: newInflight(),
+		pins:      newPins(args.MaxConversations),
+		resets:    newResets(args.MaxConversations),
+		onEdit:    args.OnQuestionEdit,
+
+		threadPrompts: newThreadPrompts(args.MaxConversations, args.Conversations),
+	}
+	b.convo.store, b.convo.logger = args.Conversations, args.Logger
+	b.deleteReplies, b.editWindow = args.DeleteRepliesWithQuestion, args.QuestionEditWindow
+	b.ignoredUsers = make(map[string]bool, len(args.IgnoredUsers))
+	for _, user := range args.IgnoredUsers {
+		b.ignoredUsers[user] = true
+	}
+	b.access = newAccess(args.AllowedChannels, args.RequiredUserGroup)
+	b.incidents = newIncidents(args.AdminChannel)
+	b.tracer = args.Tracer
+	b.dedup = dedup{seen: args.SeenEvents, ttl: args.DedupTTL}
+	if b.dedup.seen == nil {
+		seen := newSeenInMemory()
+		args.Caches.Register(seen)
+		b.dedup.seen = seen
+	}
+	b.pipeline = b.newPipeline(args)
+	b.load = newLoadStatus(args.LoadStatusChannels, args.LoadPresence, args.LoadBusyThreshold, args.LoadStatusInterval, args.Status)
+	b.noRetention = make(map[string]bool, len(args.NoRetentionChannels))
+	for _, channel := range args.NoRetentionChannels {
+		b.noRetention[channel] = true
+	}
+	b.allowBots = args.AllowBots
+	b.loops = newLoopGuard(args.BotLoopLimit, args.MaxConversations)
+	b.mentionMode = args.MentionMode
+	if b.mentionMode != MentionResolve {
+		b.mentionMode = MentionStrip
+	}
+	b.expandEmoji = args.ExpandEmoji
+	b.userNames = newUserNames(args.MaxConversations)
+	if args.RequireConsent {
+		b.consents = args.Consents
+		if b.consents == nil {
+			b.consents, _ = NewConsentStore("")
+		}
+		b.consentText = args.ConsentText
+		if b.consentText == "" {
+			b.consentText = DefaultConsentText
+		}
+	}
+	if args.UsagePolicy != "" {
+		acks := args.PolicyAcks
+		if acks == nil {
+			acks, _ = NewPolicyStore("")
+		}
+		b.policy = newUsagePolicy(args.UsagePolicy, args.PolicyAckInterval, acks)
+	}
+	if args.Hedge == HedgeCaveat || args.Hedge == HedgeRefuse {
+		b.hedge = &hedging{action: args.Hedge, threshold: args.ConfidenceThreshold, humanChannel: args.HumanChannel}
+		b.hedge.channels = make(map[string]bool, len(args.HedgeChannels))
+		for _, channel := range args.HedgeChannels {
+			b.hedge.channels[channel] = true
+		}
+	}
+	if args.EscalationGroup != "" {
+		b.escalation = &escalation{group: args.EscalationGroup, channel: args.EscalationChannel}
+	}
+	if len(args.DeflectionChannels) > 0 {
+		b.deflection = newDeflection(args.DeflectionChannels, args.KnowledgeBase, args.DeflectionMetrics, args.MaxConversations)
+		args.Caches.Register(b.deflection)
+	}
+	b.prompts = args.Prompts
+	if b.prompts == nil {
+		b.prompts, _ = NewPromptStore("")
+	}
+	configured := map[string]string{defaultPromptScope: args.SystemPrompt}
+	for channel, prompt := range args.ChannelSystemPrompts {
+		configured[channel] = prompt
+	}
+	for channel, settings := range args.Channels {
+		if settings.SystemPrompt != "" {
+			configured[channel] = settings.SystemPrompt
+		}
+	}
+	if err := b.prompts.Configure(configured, time.Now()); err != nil {
+		b.logger.Printf("failed recording configured prompts: %v\n", err)
+	}
+	b.admins = make(map[string]bool, len(args.AdminUsers))
+	for _, user := range args.AdminUsers {
+		b.admins[user] = true
+	}
+	if args.TitleThreads {
+		b.titles = newTitles(args.MaxConversations)
+		args.Caches.Register(b.titles)
+	}
+	if len(args.BranchVariants) > 0 {
+		b.branches = newBranches(args.BranchVariants, args.MaxConversations)
+		args.Caches.Register(b.branches)
+	}
+	if embedder, ok := chatgpt.EmbedderOf(args.GPTClient); ok {
+		b.faqs = &faqs{store: args.FAQs, embedder: embedder, model: args.EmbeddingModel, threshold: args.FAQThreshold}
+		if b.faqs.store == nil {
+			b.faqs.store, _ = NewFAQStore("")
+		}
+		if b.faqs.model == "" {
+			b.faqs.model = string(chatgpt.DefaultEmbeddingModel)
+		}
+		if b.faqs.threshold <= 0 {
+			b.faqs.threshold = DefaultFAQThreshold
+		}
+	} else if args.FAQs != nil {
+		b.logger.Printf("FAQs are not answered, the chat provider cannot embed text\n")
+	}
+	b.feedback = args.Feedback
+	b.workers = newWorkerPool(args.MaxConcurrentRequests, args.RequestQueueSize)
+	b.aliases = args.CommandAliases
+	if args.QualitySampleRate > 0 {
+		b.quality = newQualitySampling(args.QualitySampleRate, args.QualityJudgeModel, args.Metrics)
+	}
+	if args.Usage != nil {
+		b.usage = &usageTracking{store: args.Usage, prices: args.ModelPrices, logger: args.Logger}
+		if b.usage.prices == nil {
+			b.usage.prices = DefaultModelPrices
+		}
+	}
+	if args.SharedChannelPolicy != nil {
+		b.shared = newSharedChannels(*args.SharedChannelPolicy, args.MaxConversations)
+		args.Caches.Register(b.shared)
+	}
+	if args.MonthlyBudget != (Budget{}) || len(args.ChannelBudgets) > 0 || len(args.TeamBudgets) > 0 {
+		if b.usage == nil {
+			b.logger.Printf("budgets do not apply, usage is not tracked\n")
+		}
+		b.budgets = &budgets{global: args.MonthlyBudget, channels: args.ChannelBudgets, teams: args.TeamBudgets, alerts: args.BudgetAlertChannel}
+	}
+	if len(args.BookmarkChannels) > 0 {
+		b.bookmarks = newBookmarks(args.BookmarkChannels, args.BookmarkRefresh, args.MaxConversations)
+		if embedder, ok := chatgpt.EmbedderOf(args.GPTClient); ok {
+			b.bookmarks.embedder, b.bookmarks.model = embedder, args.EmbeddingModel
+		}
+		args.Caches.Register(b.bookmarks)
+	}
+	if args.DirectoryLookup || len(args.Owners) > 0 {
+		b.directory = newDirectory(args.DirectoryLookup, args.Owners)
+	}
+	if len(args.BuiltinTools) > 0 || len(args.Tools) > 0 {
+		b.tools = newTools(args.BuiltinTools, args.Tools, args.Logger)
+	}
+	b.clarify = args.Clarify
+	b.thinkingMessage = args.ThinkingMessage
+	b.triggerReaction = strings.Trim(args.TriggerReaction, ":")
+	b.blockKit = args.BlockKit
+	b.answerButtons = args.AnswerButtons
+	if args.Images {
+		if generator, ok := images.GeneratorOf(args.GPTClient); ok {
+			b.imaging = &imaging{generator: generator, model: args.ImageModel, size: args.ImageSize}
+		} else {
+			b.logger.Printf("pictures are not drawn, the chat provider cannot create images\n")
+		}
+	}
+	if args.Vision {
+		b.vision = &vision{model: args.VisionModel}
+		if b.vision.model == "" {
+			b.vision.model = chatgpt.DefaultVisionModel
+		}
+	}
+	if args.Transcribe {
+		if transcriber, ok := audio.TranscriberOf(args.GPTClient); ok {
+			b.transcription = &transcription{transcriber: transcriber, model: args.TranscriptionModel}
+		} else {
+			b.logger.Printf("clips are not transcribed, the chat provider cannot transcribe audio\n")
+		}
+	}
+	if len(args.Forms) > 0 {
+		b.forms = newForms(args.Forms, args.MaxConversations, args.Webhooks)
+		args.Caches.Register(b.forms)
+	}
+	if b.approvals = newApprovals(args.ApprovalChannels, args.ApprovalReviewChannel, args.MaxConversations); b.approvals != nil {
+		args.Caches.Register(b.approvals)
+	}
+	b.actionItems, b.settings = args.ActionItems, args.UserSettings
+	if args.Schedules != nil {
+		b.scheduling = newScheduling(args.Schedules, args.MaxConversations)
+		args.Caches.Register(b.scheduling)
+	}
+	if args.CountTokens == nil {
+		args.CountTokens = chatgpt.EstimateTokens
+	}
+	b.tokenLimit = chatgpt.WithTokenLimit(args.MaxContextTokens, args.CountTokens)
+	if len(args.ModelRoutes) > 0 {
+		b.routing = chatgpt.WithRoutes(args.ModelRoutes, args.CountTokens)
+	}
+	b.channels = args.Channels
+	if len(args.ModelAllowlist) > 0 {
+		b.models = newChannelModels(args.ModelAllowlist, args.Conversations)
+	}
+	b.triageModel = args.TriageModel
+	if (args.UserRateLimit > 0 || args.ChannelRateLimit > 0) && args.RateLimitWindow > 0 {
+		b.limits = &rateLimits{}
+		if args.UserRateLimit > 0 {
+			b.limits.users = newTokenBuckets("user_rate_limits", args.UserRateLimit, args.RateLimitWindow, args.MaxConversations)
+			args.Caches.Register(b.limits.users)
+		}
+		if args.ChannelRateLimit > 0 {
+			b.limits.channels = newTokenBuckets("channel_rate_limits", args.ChannelRateLimit, args.RateLimitWindow, args.MaxConversations)
+			args.Caches.Register(b.limits.channels)
+		}
+	}
+	if args.Moderation {
+		if moderator, ok := chatgpt.ModeratorOf(args.GPTClient); ok {
+			block := args.ModerationBlock
+			if block == nil {
+				for _, category := range chatgpt.ModerationCategories {
+					if !slices.Contains(args.ModerationWarn, category) {
+						block = append(block, category)
+					}
+				}
+			}
+			b.moderation = newModeration(moderator, block, args.ModerationWarn)
+		} else {
+			b.logger.Printf("questions are not moderated, the chat provider cannot moderate text\n")
+		}
+	}
+	if len(args.LowPriorityChannels) > 0 || len(args.OffPeakWindows) > 0 || args.BatchQueue != nil {
+		b.batching = newBatching(args.BatchQueue, args.LowPriorityChannels, args.OffPeakWindows)
+		if batcher, ok := chatgpt.BatcherOf(args.GPTClient); ok {
+			b.batching.batcher = batcher
+		} else {
+			b.logger.Printf("queued questions are answered one by one, the chat provider cannot answer batches\n")
+		}
+	}
+	if len(args.OverrideTiers) > 0 {
+		b.overrides = newOverrideTiers(args.OverrideTiers)
+	}
+	if b.onEdit != EditUpdate && b.onEdit != EditReply {
+		b.onEdit = EditIgnore
+	}
+	args.Caches.Register(b.convo)
+	args.Caches.Register(b.replies)
+	args.Caches.Register(b.pins)
+	args.Caches.Register(b.resets)
+	args.Caches.Register(b.threadPrompts)
+	args.Caches.Register(b.loops)
+	args.Caches.Register(b.userNames)
+	return b
+}
@@ -0,0 +1,142 @@
+package slackhandler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/cache"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// branchActionID identifies the menu on answers that asks the question again with a different variant
+const branchActionID = "slackgpt_branch"
+
+// BranchVariant is a way of answering a question again, offered in the "Try again differently" menu
+type BranchVariant struct {
+	Name string
+	// SystemPrompt replaces the channel's system prompt when set
+	SystemPrompt string
+	// Model replaces chatgpt.DefaultModel when set
+	Model string
+}
+
+// Branch is a fork of a conversation, stored in the conversation store under its own key so the
+// conversation it was forked from is left untouched
+type Branch struct {
+	ID string
+	// Parent is the key of the conversation the branch was forked from
+	Parent   string
+	Variant  string
+	Channel  string
+	ThreadTS string
+	Created  time.Time
+}
+
+// branches stores branches by branch ID
+type branches struct {
+	variants []BranchVariant
+	data     *cache.LRU[Branch]
+}
+
+// newBranches creates a branch store offering variants, holding at most maxEntries branches, 0 disables the bound
+func newBranches(variants []BranchVariant, maxEntries int) *branches {
+	return &branches{variants: variants, data: cache.NewLRU[Branch]("branches", maxEntries, 0, nil)}
+}
+
+// Get returns the branch with id
+func (br *branches) Get(id string) (Branch, bool) {
+	return br.data.Get(id)
+}
+
+// Stats returns the branch store's cache stats
+func (br *branches) Stats() cache.Stats {
+	return br.data.Stats()
+}
+
+// branchKey is the conversation key the branch with id is stored under
+func branchKey(id string) string {
+	return "branch:" + id
+}
+
+// newBranchID returns a random branch ID, so buttons left over from before a restart never fork the wrong branch
+func newBranchID() string {
+	id := make([]byte, 6)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// menu lists the variants the answer in the conversation under convoKey can be tried again with
+func (br *branches) menu(convoKey string) slack.BlockElement {
+	options := make([]*slack.OptionBlockObject, len(br.variants))
+	for i, variant := range br.variants {
+		options[i] = slack.NewOptionBlockObject(strconv.Itoa(i)+"|"+convoKey,
+			slack.NewTextBlockObject(slack.PlainTextType, variant.Name, false, false), nil)
+	}
+	return slack.NewOptionsSelectBlockElement(slack.OptTypeStatic,
+		slack.NewTextBlockObject(slack.PlainTextType, "Try again differently", false, false), branchActionID, options...)
+}
+
+// branch answers the question of the answer whose menu was used again with the chosen variant, storing the
+// fork as a new branch and posting its answer in the same thread
+func (b *bot) branch(ctx context.Context, api *slack.Client, callback *slack.InteractionCallback, action *slack.BlockAction) {
+	if b.branches == nil {
+		return
+	}
+	index, convoKey, _ := strings.Cut(action.SelectedOption.Value, "|")
+	i, err := strconv.Atoi(index)
+	if err != nil || i < 0 || i >= len(b.branches.variants) {
+		b.logger.Printf("ignored unknown branch variant %q\n", action.SelectedOption.Value)
+		return
+	}
+	variant := b.branches.variants[i]
+	channel, user := callback.Channel.ID, callback.User.ID
+	threadTS := callback.Message.ThreadTimestamp
+	if threadTS == "" {
+		threadTS = callback.Message.Timestamp
+	}
+	if !b.mayAnswer(ctx, api, channel, threadTS, user) {
+		return
+	}
+
+	history, ok := b.convo.Before(convoKey, unformatResponse(callback.Message.Text))
+	if !ok || len(history) == 0 {
+		_, err = api.PostEphemeralContext(ctx, channel, user,
+			slack.MsgOptionText("This answer is no longer in the conversation, so it can't be tried again.", false),
+			slack.MsgOptionTS(threadTS))
+		if err != nil {
+			b.logger.Printf("failed refusing branch: %v\n", err)
+		}
+		return
+	}
+	persona := variant.SystemPrompt
+	if persona == "" {
+		persona = b.systemPrompt(channel)
+	}
+	resp, err := b.completeAs(ctx, api, channel, user, persona, turns(history, openai.ChatMessageRoleUser), chatgpt.WithModel(variant.Model))
+	if err != nil {
+		b.logger.Printf("Failed to get gpt3 response for branch: %v\n", err)
+		return
+	}
+
+	id := newBranchID()
+	key := branchKey(id)
+	b.convo.Store(key, append(history, resp.stored()))
+	b.branches.data.Set(id, Branch{ID: id, Parent: convoKey, Variant: variant.Name, Channel: channel, ThreadTS: threadTS, Created: time.Now()})
+
+	label := fmt.Sprintf("_Branch %s · %s_", id, slackEscaper.Replace(variant.Name))
+	if resp.note != "" {
+		label += "\n" + resp.note
+	}
+	resp.note = label
+	if _, _, err = api.PostMessageContext(ctx, channel, append(b.replyOptions(resp, key, user), slack.MsgOptionTS(threadTS))...); err != nil {
+		b.logger.Printf("failed posting branch: %v\n", err)
+		return
+	}
+	b.logger.Printf("branched %v of %v into %v with %q\n", convoKey, user, id, variant.Name)
+}
@@ -0,0 +1,70 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func branchCallback(channel string, reply slack.Msg, value string) *slack.InteractionCallback {
+	callback := escalateCallback(channel, reply, "")
+	callback.ActionCallback.BlockActions[0] = &slack.BlockAction{ActionID: branchActionID, SelectedOption: slack.OptionBlockObject{Value: value}}
+	return callback
+}
+
+func TestBranch(t *testing.T) {
+	variants := []BranchVariant{{Name: "Pirate", SystemPrompt: "Answer like a pirate."}, {Name: "Bigger model", Model: "gpt-4o"}}
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{BranchVariants: variants})
+	ctx := context.Background()
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> my vpn is broken", Channel: "C1", TimeStamp: "1.000001"})
+	answers := slackServer.Messages()
+	require.Len(t, answers, 1)
+	assert.Contains(t, answers[0].Blocks, branchActionID)
+	original, ok := b.convo.Get("1.000001C1")
+	require.True(t, ok)
+
+	reply := slack.Msg{Timestamp: answers[0].TS, ThreadTimestamp: "1.000001", Text: answers[0].Text}
+	b.handleInteraction(ctx, api, branchCallback("C1", reply, "0|1.000001C1"))
+	messages := slackServer.Messages()
+	require.Len(t, messages, 2)
+	forked := messages[1]
+	assert.Equal(t, "1.000001", forked.ThreadTS)
+	assert.Contains(t, forked.Text, "· Pirate_")
+	assert.Contains(t, forked.Blocks, branchActionID, "branches can be branched again")
+
+	// the original conversation is untouched, the branch is stored under its own key
+	after, _ := b.convo.Get("1.000001C1")
+	assert.Equal(t, original, after)
+	id := strings.Fields(strings.TrimPrefix(forked.Text, "_Branch "))[0]
+	branch, ok := b.branches.Get(id)
+	require.True(t, ok)
+	assert.Equal(t, Branch{ID: id, Parent: "1.000001C1", Variant: "Pirate", Channel: "C1", ThreadTS: "1.000001", Created: branch.Created}, branch)
+	history, ok := b.convo.Get(branchKey(id))
+	require.True(t, ok)
+	assert.Equal(t, original[0], history[0])
+	assert.Equal(t, unformatResponse(forked.Text), history[1])
+
+	// branching the branch forks from the branch
+	reply = slack.Msg{Timestamp: forked.TS, ThreadTimestamp: "1.000001", Text: forked.Text}
+	b.handleInteraction(ctx, api, branchCallback("C1", reply, "1|"+branchKey(id)))
+	require.Len(t, slackServer.Messages(), 3)
+	assert.Contains(t, slackServer.Messages()[2].Text, "· Bigger model_")
+}
+
+func TestBranch_Forgotten(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{BranchVariants: []BranchVariant{{Name: "Pirate", SystemPrompt: "Answer like a pirate."}}})
+	ctx := context.Background()
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> my vpn is broken", Channel: "C1", TimeStamp: "1.000001"})
+	answer := slackServer.Messages()[0]
+	b.convo.ClearConversation("1.000001C1")
+
+	b.handleInteraction(ctx, api, branchCallback("C1", slack.Msg{Timestamp: answer.TS, ThreadTimestamp: "1.000001", Text: answer.Text}, "0|1.000001C1"))
+	assert.Len(t, slackServer.Messages(), 1)
+	refusals := slackServer.Ephemerals()
+	require.Len(t, refusals, 1)
+	assert.Contains(t, refusals[0].Text, "no longer in the conversation")
+}
@@ -0,0 +1,124 @@
+package slackhandler
+
+import (
+	"context"
+	"fmt"
+	"github.com/slack-go/slack"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Budget is how many tokens, and how many US dollars at the model prices, answers may take in a month, 0 does not
+// limit either
+type Budget struct {
+	Tokens int
+	Cost   float64
+}
+
+// exhaustedBy reports whether usage used up the budget
+func (b Budget) exhaustedBy(usage usageSum) bool {
+	return (b.Tokens > 0 && usage.tokens >= b.Tokens) || (b.Cost > 0 && usage.cost >= b.Cost)
+}
+
+// share is how much of the budget usage used, 1 or more once it is used up and 0 when it limits nothing
+func (b Budget) share(usage usageSum) float64 {
+	var share float64
+	if b.Tokens > 0 {
+		share = float64(usage.tokens) / float64(b.Tokens)
+	}
+	if b.Cost > 0 {
+		share = max(share, usage.cost/b.Cost)
+	}
+	return share
+}
+
+func (b Budget) String() string {
+	var limits []string
+	if b.Tokens > 0 {
+		limits = append(limits, fmt.Sprintf("%d tokens", b.Tokens))
+	}
+	if b.Cost > 0 {
+		limits = append(limits, dollars(b.Cost))
+	}
+	return strings.Join(limits, " or ")
+}
+
+// budgets declines questions once this month's usage used up the global budget, that of the channel they are
+// asked in or that of a team the user asking is in, telling the alert channel the first time a budget runs out
+type budgets struct {
+	global   Budget
+	channels map[string]Budget
+	// teams are the budgets of user groups, by user group
+	teams  map[string]TeamBudget
+	groups userGroups
+	alerts string
+
+	mu sync.Mutex
+	// alerted are the budgets the alert channel and team leads were told about by month, "" for the global
+	// budget, and overrides the teams admins let go over their budget by month. A restart forgets both, so a
+	// budget still exhausted is reported again.
+	alerted   map[string]bool
+	overrides map[string]bool
+}
+
+// budgetNotice returns the message telling user why a question in channel is declined when this month's budget
+// is used up, empty when it may be answered. Budgets apply when usage is tracked.
+func (b *bot) budgetNotice(ctx context.Context, api *slack.Client, channel, user string) string {
+	if b.budgets == nil || b.usage == nil {
+		return ""
+	}
+	now := time.Now().UTC()
+	month := now.Format(usageMonth)
+	var global, used usageSum
+	byUser := map[string]*usageSum{}
+	for _, t := range b.usage.store.Month(month) {
+		sums := []*usageSum{&global, entry(byUser, t.User)}
+		if t.Channel == channel {
+			sums = append(sums, &used)
+		}
+		for _, s := range sums {
+			s.answers += t.Answers
+			s.tokens += t.PromptTokens + t.CompletionTokens
+			s.cost += t.Cost
+		}
+	}
+	next := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	when := fmt.Sprintf("<!date^%d^{date_long}|%s>", next.Unix(), next.Format("January 2"))
+	if budget := b.budgets.global; budget.exhaustedBy(global) {
+		b.alertBudget(ctx, api, month, "", fmt.Sprintf("This month's budget of %v is used up: %v. "+
+			"Questions are declined everywhere until %s.", budget, global, when))
+		return fmt.Sprintf("Sorry, I've used up this month's budget for answers. I can answer again on %s.", when)
+	}
+	if budget, ok := b.budgets.channels[channel]; ok && budget.exhaustedBy(used) {
+		b.alertBudget(ctx, api, month, channel, fmt.Sprintf("This month's budget of <#%s>, %v, is used up: %v. "+
+			"Questions there are declined until %s.", channel, budget, used, when))
+		return fmt.Sprintf("Sorry, this channel has used up this month's budget for answers. I can answer here again on %s.", when)
+	}
+	return b.teamBudgetNotice(ctx, api, month, when, user, byUser)
+}
+
+// alertBudget tells the alert channel, when there is one, that the budget of channel, the global one when empty,
+// ran out in month, once
+func (b *bot) alertBudget(ctx context.Context, api *slack.Client, month, channel, text string) {
+	b.logger.Printf("budget of %q used up in %v\n", channel, month)
+	if !b.budgets.firstAlert(month, channel) || b.budgets.alerts == "" {
+		return
+	}
+	if _, _, err := api.PostMessageContext(ctx, b.budgets.alerts, slack.MsgOptionText(":money_with_wings: "+text, false)); err != nil {
+		b.logger.Printf("failed alerting the budget: %v\n", err)
+	}
+}
+
+// firstAlert reports whether nobody was told about key in month yet, remembering they now are
+func (bs *budgets) firstAlert(month, key string) bool {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if bs.alerted == nil {
+		bs.alerted = map[string]bool{}
+	}
+	key = month + "/" + key
+	alerted := bs.alerted[key]
+	bs.alerted[key] = true
+	return !alerted
+}
@@ -0,0 +1,63 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestBudgetExhaustedBy(t *testing.T) {
+	tests := []struct {
+		name   string
+		budget Budget
+		used   usageSum
+		want   bool
+	}{
+		{"no limits", Budget{}, usageSum{tokens: 1e9, cost: 1e6}, false},
+		{"tokens left", Budget{Tokens: 100}, usageSum{tokens: 99}, false},
+		{"tokens used up", Budget{Tokens: 100}, usageSum{tokens: 100}, true},
+		{"cost used up", Budget{Tokens: 100, Cost: 1}, usageSum{tokens: 10, cost: 1.5}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.budget.exhaustedBy(tt.used))
+		})
+	}
+	assert.Equal(t, "100 tokens or $2.50", Budget{Tokens: 100, Cost: 2.5}.String())
+}
+
+func TestBudgets(t *testing.T) {
+	store, _ := NewUsageStore("")
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{
+		Usage:              store,
+		ChannelBudgets:     map[string]Budget{"C1": {Tokens: 100}},
+		MonthlyBudget:      Budget{Cost: 5},
+		BudgetAlertChannel: "C0ADMINS",
+	})
+	ctx := context.Background()
+	month := time.Now().UTC().Format(usageMonth)
+	require.NoError(t, store.Add(UsageTotal{Month: month, User: "U1", Channel: "C1", Model: "gpt-4o", Answers: 1, PromptTokens: 90, CompletionTokens: 10}))
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: "C1", TimeStamp: "1.000001"})
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: "C1", TimeStamp: "2.000001"})
+	messages := slackServer.Messages()
+	require.Len(t, messages, 1, "the channel's budget is used up")
+	assert.Equal(t, "C0ADMINS", messages[0].Channel)
+	assert.Contains(t, messages[0].Text, "<#C1>")
+	ephemerals := slackServer.Ephemerals()
+	require.Len(t, ephemerals, 2)
+	assert.Contains(t, ephemerals[0].Text, "this channel has used up this month's budget")
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: "C2", TimeStamp: "3.000001"})
+	assert.Len(t, slackServer.Messages(), 2, "other channels are answered")
+
+	require.NoError(t, store.Add(UsageTotal{Month: month, User: "U2", Channel: "C3", Model: "gpt-4o", Answers: 1, PromptTokens: 1, Cost: 5}))
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: "C2", TimeStamp: "4.000001"})
+	messages = slackServer.Messages()
+	require.Len(t, messages, 3)
+	assert.Contains(t, messages[2].Text, "Questions are declined everywhere", "the alert channel is told the global budget ran out")
+	assert.Contains(t, slackServer.Ephemerals()[2].Text, "I've used up this month's budget")
+}
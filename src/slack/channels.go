@@ -0,0 +1,47 @@
+package slackhandler
+
+import (
+	"github.com/chikamif/slackgpt/src/chatgpt"
+)
+
+// ChannelSettings are how questions asked in a channel are answered, unset fields keep the defaults
+type ChannelSettings struct {
+	// Model is the channel's model, routes and inline parameters still apply when empty
+	Model string
+	// Temperature keeps the model's default when nil
+	Temperature *float32
+	// MaxTokens bounds the answers, 0 does not
+	MaxTokens int
+	// SystemPrompt takes precedence over the channel's ChannelSystemPrompts
+	SystemPrompt string
+}
+
+// options returns the completion options applying s
+func (s ChannelSettings) options() []chatgpt.Option {
+	var opts []chatgpt.Option
+	if s.Model != "" {
+		opts = append(opts, chatgpt.WithModel(s.Model))
+	}
+	if s.Temperature != nil {
+		opts = append(opts, chatgpt.WithTemperature(*s.Temperature))
+	}
+	if s.MaxTokens > 0 {
+		opts = append(opts, chatgpt.WithMaxTokens(s.MaxTokens))
+	}
+	return opts
+}
+
+// channelOptions returns the completion options of the settings of channel, none when it has none. The model
+// it was switched to at runtime takes precedence over the configured one.
+func (b *bot) channelOptions(channel string) []chatgpt.Option {
+	var opts []chatgpt.Option
+	if settings, ok := b.channels[channel]; ok {
+		opts = settings.options()
+	}
+	if b.models != nil {
+		if sw, ok := b.models.get(channel); ok {
+			opts = append(opts, chatgpt.WithModel(sw.Model))
+		}
+	}
+	return opts
+}
@@ -0,0 +1,45 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestChannelSettings(t *testing.T) {
+	ctx := context.Background()
+	slackServer := fake.NewSlack()
+	t.Cleanup(slackServer.Close)
+	api := slack.New("xoxb-test", slack.OptionAPIURL(slackServer.APIURL()))
+	model := &paramsModel{}
+	light := float32(0.9)
+	channels := map[string]ChannelSettings{
+		"C0ENG":    {Model: "gpt-4", MaxTokens: 2000},
+		"C0RANDOM": {Model: "gpt-3.5-turbo", Temperature: &light, SystemPrompt: "Keep it light."},
+	}
+	routes := []chatgpt.Route{{Name: "all", Model: "gpt-4-turbo"}}
+	b := newBot(EventHandlerArgs{Logger: logger, GPTClient: model, Channels: channels, ModelRoutes: routes, OverrideTiers: testOverrideTiers})
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: "C0ENG", TimeStamp: "1.000001"})
+	req := model.last()
+	assert.Equal(t, "gpt-4", req.Model, "the channel's model takes precedence over routes")
+	assert.Equal(t, 2000, req.MaxTokens)
+	assert.Equal(t, float32(0.5), req.Temperature)
+	assert.Equal(t, chatgpt.DefaultSystemPrompt, req.Messages[0].Content)
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: "C0RANDOM", TimeStamp: "2.000001"})
+	req = model.last()
+	assert.Equal(t, "gpt-3.5-turbo", req.Model)
+	assert.Equal(t, light, req.Temperature)
+	assert.Equal(t, "Keep it light.", req.Messages[0].Content)
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> [model=gpt-4o] what is go", Channel: "C0RANDOM", TimeStamp: "3.000001"})
+	assert.Equal(t, "gpt-4o", model.last().Model, "a model asked for takes precedence")
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: "C1", TimeStamp: "4.000001"})
+	assert.Equal(t, "gpt-4-turbo", model.last().Model, "other channels keep the defaults")
+}
@@ -0,0 +1,180 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/slack-go/slack"
+	"strings"
+)
+
+// maxAnswerText is the most text an answer is posted with in a single message, longer answers are split into
+// a sequence of thread replies
+const maxAnswerText = 4000
+
+// fenceOverhead is the length formatResponse adds to a part, its fences and the zero width spaces guarding them
+const fenceOverhead = 6 + 2*len(zeroWidthSpace)
+
+// fits reports whether text is at most max bytes once formatted with formatResponse
+func fits(text string, max int) bool {
+	return formattedLen(text)+fenceOverhead <= max
+}
+
+// splitAnswer splits an answer into parts that are each at most max bytes once formatted with formatResponse,
+// between paragraphs and code blocks where it can and between lines where it cannot. A code block split across
+// parts is closed at the end of one and opened again, with its language, at the start of the next.
+func splitAnswer(answer string, max int) []string {
+	if fits(answer, max) {
+		return []string{answer}
+	}
+	var parts []string
+	part := ""
+	for _, segment := range answerSegments(answer, max) {
+		if part != "" && !fits(part+segment, max) {
+			if part = strings.Trim(part, "\n"); part != "" {
+				parts = append(parts, part)
+			}
+			part = ""
+		}
+		part += segment
+	}
+	if part = strings.Trim(part, "\n"); part != "" {
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// answerSegments cuts answer into its paragraphs and code blocks, split between lines into segments that each
+// fit in a part of max bytes when they don't
+func answerSegments(answer string, max int) []string {
+	var segments []string
+	var segment strings.Builder
+	fence := ""
+	flush := func() {
+		if segment.Len() == 0 {
+			return
+		}
+		text := segment.String()
+		segment.Reset()
+		switch {
+		case fits(text, max):
+			segments = append(segments, text)
+		case strings.HasPrefix(strings.TrimSpace(text), "```"):
+			segments = append(segments, splitCodeBlock(text, max)...)
+		default:
+			segments = append(segments, splitLines(strings.SplitAfter(text, "\n"), "", "", max)...)
+		}
+	}
+	for _, line := range strings.SplitAfter(answer, "\n") {
+		trimmed := strings.TrimSpace(line)
+		opens := fence == "" && strings.HasPrefix(trimmed, "```") && strings.Count(trimmed, "```") == 1
+		if opens {
+			flush()
+		}
+		segment.WriteString(line)
+		switch {
+		case opens:
+			fence = trimmed
+		case fence != "" && strings.HasPrefix(trimmed, "```"):
+			fence = ""
+			flush()
+		case fence == "" && trimmed == "":
+			flush()
+		}
+	}
+	flush()
+	return segments
+}
+
+// splitCodeBlock splits a code block between lines into code blocks that each fit in a part of max bytes, all
+// opened like the original
+func splitCodeBlock(block string, max int) []string {
+	lines := strings.SplitAfter(block, "\n")
+	open := strings.TrimRight(lines[0], "\n") + "\n"
+	body := lines[1:]
+	// the closing fence, missing when the answer ends in the code block, is added to every part
+	for i := len(body) - 1; i >= 0; i-- {
+		if trimmed := strings.TrimSpace(body[i]); trimmed != "" {
+			if strings.HasPrefix(trimmed, "```") {
+				body = body[:i]
+			}
+			break
+		}
+	}
+	return splitLines(body, open, "```\n", max)
+}
+
+// splitLines packs lines into pieces, each wrapped in prefix and suffix, that fit in a part of max bytes,
+// splitting lines too long for a part of their own anywhere
+func splitLines(lines []string, prefix, suffix string, max int) []string {
+	var pieces []string
+	piece := ""
+	room := max - formattedLen(prefix+suffix)
+	add := func() {
+		if piece != "" {
+			pieces = append(pieces, prefix+piece+suffix)
+			piece = ""
+		}
+	}
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		if !strings.HasSuffix(line, "\n") {
+			line += "\n"
+		}
+		if fits(piece+line, room) {
+			piece += line
+			continue
+		}
+		add()
+		if fits(line, room) {
+			piece = line
+			continue
+		}
+		// room is kept for the newline ending every cut
+		for _, cut := range splitResponse(line, room-1) {
+			piece = strings.TrimSuffix(cut, "\n") + "\n"
+			add()
+		}
+	}
+	add()
+	return pieces
+}
+
+// split splits c into completions each posted in a message of at most max bytes, the note staying with the first
+// and the usage going with the last
+func (c completion) split(max int) []completion {
+	if c.answer == "" {
+		return []completion{c}
+	}
+	room := max
+	if c.note != "" {
+		room -= len(c.note) + 1
+	}
+	if c.footer != "" {
+		room -= len(c.footer) + 1
+	}
+	var parts []completion
+	for i, part := range splitAnswer(c.answer, room) {
+		parts = append(parts, completion{answer: part, model: c.model, blocks: c.blocks})
+		if i == 0 {
+			parts[0].note = c.note
+		}
+	}
+	parts[len(parts)-1].usage, parts[len(parts)-1].footer = c.usage, c.footer
+	return parts
+}
+
+// postRest posts the parts of an answer after its first, in order, as replies in the thread of threadTS, that of
+// the first part at answerTS when empty. Like answers they are posted even once the work context ctx is done.
+func (b *bot) postRest(ctx context.Context, api *slack.Client, channel, threadTS, answerTS string, rest []completion) {
+	ctx = context.WithoutCancel(ctx)
+	if threadTS == "" {
+		threadTS = answerTS
+	}
+	for _, part := range rest {
+		if _, _, err := api.PostMessageContext(ctx, channel, append(answerOptions(part), slack.MsgOptionTS(threadTS))...); err != nil {
+			b.logger.Printf("failed posting the rest of an answer in %v: %v\n", channel, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+// longModel answers with a fixed answer
+type longModel string
+
+func (m longModel) CreateChatCompletion(_ context.Context, _ openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	message := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: string(m)}
+	return openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{Message: message}}}, nil
+}
+
+func TestSplitAnswer(t *testing.T) {
+	paragraph := strings.Repeat("word ", 25) + "end."
+	code := "```go\n" + strings.Repeat("fmt.Println(\"hello\")\n", 7) + "```"
+	tests := []struct {
+		name   string
+		answer string
+		want   []string
+	}{
+		{"short", "Go is a language.", []string{"Go is a language."}},
+		{"paragraphs", paragraph + "\n\n" + paragraph + "\n\n" + paragraph, []string{paragraph, paragraph, paragraph}},
+		{"code block kept whole", "Like this:\n\n" + code + "\n\nDone.", []string{"Like this:", code + "\n\nDone."}},
+		{"lines", paragraph + "\n" + paragraph, []string{paragraph, paragraph}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, splitAnswer(tt.answer, 190))
+		})
+	}
+
+	parts := splitAnswer(strings.Repeat("a", 250), 190)
+	require.Len(t, parts, 2, "a line too long for a part is split anywhere")
+	assert.Equal(t, strings.Repeat("a", 250), parts[0]+parts[1])
+	assert.LessOrEqual(t, len(formatResponse(parts[0])), 190)
+}
+
+func TestSplitAnswer_CodeBlock(t *testing.T) {
+	var lines []string
+	for i := 0; i < 40; i++ {
+		lines = append(lines, strings.Repeat("x", 20)+"()")
+	}
+	answer := "Here is the program:\n\n```python\n" + strings.Join(lines, "\n") + "\n```\n\nRun it with python."
+	parts := splitAnswer(answer, 300)
+	require.Greater(t, len(parts), 3)
+	assert.Equal(t, "Here is the program:", parts[0])
+	assert.True(t, strings.HasSuffix(parts[len(parts)-1], "```\n\nRun it with python."))
+	var code []string
+	for _, part := range parts[1:] {
+		assert.LessOrEqual(t, len(formatResponse(part)), 300)
+		start := strings.Index(part, "```python\n")
+		end := strings.LastIndex(part, "\n```")
+		require.True(t, start == 0 && end > start, "every part opens and closes the code block: %q", part)
+		code = append(code, part[start+len("```python\n"):end])
+	}
+	assert.Equal(t, strings.Join(lines, "\n"), strings.Join(code, "\n"), "no code is lost")
+}
+
+func TestLongAnswer(t *testing.T) {
+	ctx := context.Background()
+	slackServer := fake.NewSlack()
+	t.Cleanup(slackServer.Close)
+	api := slack.New("xoxb-test", slack.OptionAPIURL(slackServer.APIURL()))
+	paragraph := strings.TrimSpace(strings.Repeat("Go is a language. ", 150))
+	answer := strings.Join([]string{paragraph, paragraph, paragraph}, "\n\n")
+	b := newBot(EventHandlerArgs{Logger: logger, GPTClient: longModel(answer), ThinkingMessage: DefaultThinkingMessage})
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: "C1", TimeStamp: "1.000001"})
+	messages := slackServer.Messages()
+	require.Len(t, messages, 3, "the answer is posted in three parts")
+	for _, message := range messages {
+		assert.Equal(t, "1.000001", message.ThreadTS, "the parts are replies in the thread")
+		assert.LessOrEqual(t, len(message.Text), maxAnswerText)
+		assert.Equal(t, formatResponse(paragraph), message.Text)
+	}
+	rep, ok := b.replies.Get("C1", "1.000001")
+	require.True(t, ok)
+	assert.Equal(t, messages[0].TS, rep.ReplyTS, "edits update the first part")
+	history, _ := b.convo.Get(rep.ConvoKey)
+	assert.Equal(t, answer, history[len(history)-1], "the whole answer is remembered")
+}
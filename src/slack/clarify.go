@@ -0,0 +1,104 @@
+package slackhandler
+
+import (
+	"context"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"strings"
+)
+
+// clarifyActionID identifies the buttons offering what an ambiguous question may have meant
+const clarifyActionID = "slackgpt_clarify"
+
+// maxButtonText is the longest text slack shows on a button
+const maxButtonText = 75
+
+// askToClarify asks what the last question of history means when the model finds it too ambiguous to answer,
+// offering the likely meanings as buttons, and reports whether it did. The clarifying question is the
+// assistant's turn of the conversation under convoKey, the chosen meaning the user's next one.
+func (b *bot) askToClarify(ctx context.Context, api *slack.Client, channel, threadTS, convoKey string, history []openai.ChatCompletionMessage) bool {
+	if !b.clarify {
+		return false
+	}
+	clarification, ambiguous, err := chatgpt.GetClarification(b.gptClient, ctx, history)
+	if err != nil {
+		b.logger.Printf("failed checking whether the question in %v is ambiguous: %v\n", channel, err)
+		return false
+	}
+	if !ambiguous {
+		return false
+	}
+	buttons := make([]slack.BlockElement, len(clarification.Options))
+	for i, option := range clarification.Options {
+		label := option
+		if runes := []rune(label); len(runes) > maxButtonText {
+			label = string(runes[:maxButtonText-1]) + "…"
+		}
+		button := slack.NewButtonBlockElement(clarifyActionID, convoKey+"|"+option, slack.NewTextBlockObject(slack.PlainTextType, label, false, false))
+		// every button needs its own action ID within the block
+		button.ActionID = fmt.Sprintf("%s_%d", clarifyActionID, i)
+		buttons[i] = button
+	}
+	options := []slack.MsgOption{
+		slack.MsgOptionText(clarification.Question, false),
+		slack.MsgOptionBlocks(
+			slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, slackEscaper.Replace(clarification.Question), false, false), nil, nil),
+			slack.NewActionBlock(clarifyActionID, buttons...),
+		),
+	}
+	if threadTS != "" {
+		options = append(options, slack.MsgOptionTS(threadTS))
+	}
+	if _, _, err := api.PostMessageContext(ctx, channel, options...); err != nil {
+		b.logger.Printf("failed asking to clarify: %v\n", err)
+		return false
+	}
+	b.convo.UpdateConversation(convoKey, clarification.Question)
+	return true
+}
+
+// clarified answers the question of a conversation with the meaning whose button was clicked, marking the
+// clarifying question answered
+func (b *bot) clarified(ctx context.Context, api *slack.Client, callback *slack.InteractionCallback, action *slack.BlockAction) {
+	convoKey, meaning, ok := strings.Cut(action.Value, "|")
+	if !ok || meaning == "" {
+		b.logger.Printf("ignored clarification %q\n", action.Value)
+		return
+	}
+	channel, user := callback.Channel.ID, callback.User.ID
+	threadTS := callback.Message.ThreadTimestamp
+	if threadTS == "" {
+		threadTS = callback.Message.Timestamp
+	}
+	if !b.mayAnswer(ctx, api, channel, threadTS, user) {
+		return
+	}
+	// the buttons are removed before answering, so the question is not clarified again
+	var blocks []slack.Block
+	for _, block := range callback.Message.Blocks.BlockSet {
+		if block.BlockType() != slack.MBTAction {
+			blocks = append(blocks, block)
+		}
+	}
+	note := fmt.Sprintf("<@%s> chose: %s", user, slackEscaper.Replace(meaning))
+	blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, note, false, false)))
+	_, _, _, err := api.UpdateMessageContext(ctx, channel, callback.Message.Timestamp,
+		slack.MsgOptionText(callback.Message.Text, false), slack.MsgOptionBlocks(blocks...))
+	if err != nil {
+		b.logger.Printf("failed marking clarification chosen: %v\n", err)
+	}
+
+	b.convo.UpdateConversation(convoKey, meaning)
+	stored, _ := b.convo.Get(convoKey)
+	resp, err := b.completeIn(ctx, api, convoKey, channel, user, turns(stored, openai.ChatMessageRoleUser))
+	if err != nil {
+		b.logger.Printf("Failed to get gpt3 response for clarified question: %v\n", err)
+		resp = completion{answer: troubleAnswer(err)}
+	}
+	b.convo.UpdateConversation(convoKey, resp.stored())
+	if _, _, err = api.PostMessageContext(ctx, channel, append(b.replyOptions(resp, convoKey, user), slack.MsgOptionTS(threadTS))...); err != nil {
+		b.logger.Printf("failed posting clarified answer: %v\n", err)
+	}
+}
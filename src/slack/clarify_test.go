@@ -0,0 +1,69 @@
+package slackhandler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+// clarifyingModel finds questions about banks ambiguous, and answers with the conversation it was given
+type clarifyingModel struct{}
+
+func (clarifyingModel) CreateChatCompletion(_ context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	last := req.Messages[len(req.Messages)-1].Content
+	content := "{\"ambiguous\": false}"
+	switch {
+	case !strings.Contains(req.Messages[0].Content, "ambiguous"):
+		var said []string
+		for _, m := range req.Messages[1:] {
+			said = append(said, m.Role+": "+m.Content)
+		}
+		content = strings.Join(said, " / ")
+	case strings.HasSuffix(strings.TrimSpace(last), "how far is the bank?"):
+		content = "```json\n{\"ambiguous\": true, \"question\": \"Which bank do you mean?\", \"options\": [\"The river bank\", \"The savings bank\", \" \"]}\n```"
+	}
+	message := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content}
+	return openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{Message: message}}}, nil
+}
+
+func TestClarify(t *testing.T) {
+	ctx := context.Background()
+	slackServer := fake.NewSlack()
+	t.Cleanup(slackServer.Close)
+	api := slack.New("xoxb-test", slack.OptionAPIURL(slackServer.APIURL()))
+	b := newBot(EventHandlerArgs{Logger: logger, GPTClient: clarifyingModel{}, Clarify: true})
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> how far is the bank?", Channel: "C1", TimeStamp: "1.000001"})
+	messages := slackServer.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, "Which bank do you mean?", messages[0].Text)
+	assert.Contains(t, messages[0].Blocks, `"value":"1.000001C1|The river bank"`)
+	assert.Contains(t, messages[0].Blocks, `"value":"1.000001C1|The savings bank"`)
+	assert.NotContains(t, messages[0].Blocks, `"value":"1.000001C1| "`, "blank options are left out")
+
+	callback := &slack.InteractionCallback{Type: slack.InteractionTypeBlockActions}
+	callback.Channel.ID, callback.User.ID = "C1", "U2"
+	callback.Message.Msg = slack.Msg{Timestamp: messages[0].TS, ThreadTimestamp: messages[0].ThreadTS, Text: messages[0].Text}
+	require.NoError(t, json.Unmarshal([]byte(messages[0].Blocks), &callback.Message.Blocks))
+	callback.ActionCallback.BlockActions = []*slack.BlockAction{{ActionID: clarifyActionID + "_1", Value: "1.000001C1|The savings bank"}}
+	b.handleInteraction(ctx, api, callback)
+
+	messages = slackServer.Messages()
+	require.Len(t, messages, 2)
+	assert.NotContains(t, messages[0].Blocks, clarifyActionID, "the options are removed once one is chosen")
+	assert.Contains(t, messages[0].Blocks, `U2\u003e chose: The savings bank`)
+	assert.Equal(t, "1.000001", messages[1].ThreadTS)
+	assert.Equal(t, formatResponse("user: how far is the bank? / assistant: Which bank do you mean? / user: The savings bank"), messages[1].Text)
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go?", Channel: "C1", TimeStamp: "2.000001"})
+	messages = slackServer.Messages()
+	require.Len(t, messages, 3)
+	assert.Equal(t, formatResponse("user: what is go?"), messages[2].Text, "clear questions are answered right away")
+}
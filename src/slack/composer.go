@@ -0,0 +1,247 @@
+package slackhandler
+
+import (
+	"context"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"strconv"
+	"strings"
+)
+
+const (
+	// composeShortcutID identifies the "Ask GPT" global shortcut, as created in the app settings
+	composeShortcutID = "slackgpt_compose"
+	// composerCallbackID identifies submissions of the prompt composer modal
+	composerCallbackID = "slackgpt_composer"
+	// composerPromptBlockID, composerModelBlockID, composerTemperatureBlockID, composerDeliveryBlockID and
+	// composerChannelBlockID are the inputs of the prompt composer, each with a single element of the same ID
+	composerPromptBlockID      = "slackgpt_composer_prompt"
+	composerModelBlockID       = "slackgpt_composer_model"
+	composerTemperatureBlockID = "slackgpt_composer_temperature"
+	composerDeliveryBlockID    = "slackgpt_composer_delivery"
+	composerChannelBlockID     = "slackgpt_composer_channel"
+	// composerPrivate and composerPublic are the deliveries the composer offers: to the user's direct messages
+	// with the bot, or in a channel for everyone
+	composerPrivate = "private"
+	composerPublic  = "public"
+	// composerDefault is the option of the composer's selects keeping the default, as options need a value
+	composerDefault = "default"
+	// maxComposedPrompt is the most characters a composed prompt may have
+	maxComposedPrompt = 3000
+)
+
+// composerTemperatures are the temperatures the composer offers, up to the highest the user's tier allows
+var composerTemperatures = []float32{0, 0.2, 0.5, 0.7, 1, 1.5, 2}
+
+// openComposer opens the prompt composer for the user who used the global shortcut. The model and temperature
+// can only be picked when their override tier lets them.
+func (b *bot) openComposer(ctx context.Context, api *slack.Client, callback *slack.InteractionCallback) {
+	if _, err := api.OpenViewContext(ctx, callback.TriggerID, b.composerModal(callback.User.ID)); err != nil {
+		b.logger.Printf("failed opening the prompt composer: %v\n", err)
+	}
+}
+
+// composerModal is the prompt composer as user may fill it in
+func (b *bot) composerModal(user string) slack.ModalViewRequest {
+	prompt := slack.NewPlainTextInputBlockElement(slack.NewTextBlockObject(slack.PlainTextType, "What do you want to ask?", false, false), composerPromptBlockID)
+	prompt.Multiline = true
+	prompt.MaxLength = maxComposedPrompt
+	blocks := []slack.Block{
+		slack.NewInputBlock(composerPromptBlockID, slack.NewTextBlockObject(slack.PlainTextType, "Prompt", false, false), nil, prompt),
+	}
+	if tier := b.overrides.tier(user); tier != nil {
+		if len(tier.Models) > 0 {
+			options := []*slack.OptionBlockObject{plainOption(composerDefault, "Default")}
+			for _, model := range tier.Models {
+				options = append(options, plainOption(model, model))
+			}
+			blocks = append(blocks, composerSelect(composerModelBlockID, "Model", options))
+		}
+		if tier.MaxTemperature > 0 {
+			options := []*slack.OptionBlockObject{plainOption(composerDefault, "Default")}
+			for _, temperature := range composerTemperatures {
+				if temperature <= tier.MaxTemperature {
+					value := strconv.FormatFloat(float64(temperature), 'f', -1, 32)
+					options = append(options, plainOption(value, value))
+				}
+			}
+			blocks = append(blocks, composerSelect(composerTemperatureBlockID, "Temperature", options))
+		}
+	}
+	private, public := plainOption(composerPrivate, "Only to me, in a direct message"), plainOption(composerPublic, "In a channel")
+	delivery := slack.NewRadioButtonsBlockElement(composerDeliveryBlockID, private, public)
+	delivery.InitialOption = private
+	channel := slack.NewOptionsSelectBlockElement(slack.OptTypeConversations, slack.NewTextBlockObject(slack.PlainTextType, "Pick a channel", false, false), composerChannelBlockID)
+	channel.Filter = &slack.SelectBlockElementFilter{Include: []string{"public", "private"}}
+	channelBlock := slack.NewInputBlock(composerChannelBlockID, slack.NewTextBlockObject(slack.PlainTextType, "Channel", false, false),
+		slack.NewTextBlockObject(slack.PlainTextType, "Where to post the question and its answer, when it goes in a channel", false, false), channel)
+	channelBlock.Optional = true
+	blocks = append(blocks, slack.NewInputBlock(composerDeliveryBlockID, slack.NewTextBlockObject(slack.PlainTextType, "Answer", false, false), nil, delivery), channelBlock)
+	return slack.ModalViewRequest{
+		Type:       slack.VTModal,
+		CallbackID: composerCallbackID,
+		Title:      slack.NewTextBlockObject(slack.PlainTextType, "Ask GPT", false, false),
+		Blocks:     slack.Blocks{BlockSet: blocks},
+		Submit:     slack.NewTextBlockObject(slack.PlainTextType, "Ask", false, false),
+		Close:      slack.NewTextBlockObject(slack.PlainTextType, "Cancel", false, false),
+	}
+}
+
+// plainOption is an option of selects, radio buttons and checkboxes, with plain text
+func plainOption(value, text string) *slack.OptionBlockObject {
+	return slack.NewOptionBlockObject(value, slack.NewTextBlockObject(slack.PlainTextType, text, false, false), nil)
+}
+
+// composerSelect is an optional select of the composer, starting at its first option
+func composerSelect(blockID, label string, options []*slack.OptionBlockObject) *slack.InputBlock {
+	selected := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, nil, blockID, options...)
+	selected.InitialOption = options[0]
+	block := slack.NewInputBlock(blockID, slack.NewTextBlockObject(slack.PlainTextType, label, false, false), nil, selected)
+	block.Optional = true
+	return block
+}
+
+// composed is what was submitted through the prompt composer
+type composed struct {
+	prompt  string
+	model   string
+	temp    string
+	public  bool
+	channel string
+}
+
+// composedValues reads what was submitted through the prompt composer of callback
+func composedValues(callback *slack.InteractionCallback) composed {
+	values := callback.View.State.Values
+	c := composed{
+		prompt:  strings.TrimSpace(values[composerPromptBlockID][composerPromptBlockID].Value),
+		model:   values[composerModelBlockID][composerModelBlockID].SelectedOption.Value,
+		temp:    values[composerTemperatureBlockID][composerTemperatureBlockID].SelectedOption.Value,
+		public:  values[composerDeliveryBlockID][composerDeliveryBlockID].SelectedOption.Value == composerPublic,
+		channel: values[composerChannelBlockID][composerChannelBlockID].SelectedConversation,
+	}
+	if c.model == composerDefault {
+		c.model = ""
+	}
+	if c.temp == composerDefault {
+		c.temp = ""
+	}
+	return c
+}
+
+// composerSubmissionResponse keeps the prompt composer open with the problem when a channel is needed and none
+// was picked, it is nil when the composer can close
+func (b *bot) composerSubmissionResponse(callback *slack.InteractionCallback) *slack.ViewSubmissionResponse {
+	if c := composedValues(callback); c.public && c.channel == "" {
+		return slack.NewErrorsViewSubmissionResponse(map[string]string{composerChannelBlockID: "Pick the channel to post in."})
+	}
+	return nil
+}
+
+// composerSubmitted answers the prompt submitted through the composer, with the model and temperature picked,
+// in the user's direct messages with the bot or in the channel picked. Problems are told in a direct message.
+func (b *bot) composerSubmitted(ctx context.Context, api *slack.Client, callback *slack.InteractionCallback) {
+	user, c := callback.User.ID, composedValues(callback)
+	if b.ignoredUsers[user] || c.prompt == "" {
+		return
+	}
+	channel := c.channel
+	if !c.public {
+		dm, _, _, err := api.OpenConversationContext(ctx, &slack.OpenConversationParameters{Users: []string{user}})
+		if err != nil {
+			b.logger.Printf("failed opening a direct message with %v: %v\n", user, err)
+			return
+		}
+		channel = dm.ID
+	}
+	var params []string
+	if c.model != "" {
+		params = append(params, "model="+c.model)
+	}
+	if c.temp != "" {
+		params = append(params, "temp="+c.temp)
+	}
+	var opts []chatgpt.Option
+	if len(params) > 0 {
+		// the picks are checked like inline parameters, the tier may have changed since the composer opened
+		parsed, err := b.overrides.parse("["+strings.Join(params, " ")+"]", user)
+		if err != nil {
+			b.tellComposer(ctx, api, user, fmt.Sprintf("I could not answer your question: %v.", err))
+			return
+		}
+		opts = parsed.options()
+	}
+	if c.public {
+		if member, err := b.memberOf(ctx, api, channel, user); err != nil || !member {
+			if err != nil {
+				b.logger.Printf("failed checking the members of %v: %v\n", channel, err)
+			}
+			b.tellComposer(ctx, api, user, fmt.Sprintf("You are not in <#%s>. You can only ask in channels you are in.", channel))
+			return
+		}
+	}
+	if notice := b.accessNotice(ctx, api, channel, user); notice != "" {
+		b.tellComposer(ctx, api, user, notice)
+		return
+	}
+	if notice := b.rateLimitNotice(ctx, api, user, channel); notice != "" {
+		b.tellComposer(ctx, api, user, notice)
+		return
+	}
+	prompt := b.prompt(ctx, api, c.prompt)
+	refusal, warning := b.moderationNotice(ctx, prompt)
+	if refusal != "" {
+		b.tellComposer(ctx, api, user, refusal)
+		return
+	}
+	b.logger.Printf("%s composed a question for %v\n", user, channel)
+	resp, err := b.complete(ctx, api, channel, user, []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: prompt}}, opts...)
+	if err != nil {
+		b.logger.Printf("failed answering a composed question: %v\n", err)
+		b.reportIncident(ctx, api, channel, err)
+		b.tellComposer(ctx, api, user, "*You asked:* "+slackEscaper.Replace(c.prompt)+"\n"+troubleAnswer(err))
+		return
+	}
+	asked := fmt.Sprintf("*<@%s> asked:* %s", user, slackEscaper.Replace(c.prompt))
+	if !c.public {
+		asked = "*You asked:* " + slackEscaper.Replace(c.prompt)
+	}
+	retain := b.retains(channel) && !b.userSettings(user).OffRecord
+	if !retain {
+		asked += "\n" + offRecordNote
+	}
+	for _, note := range []string{warning, resp.note} {
+		if note != "" {
+			asked += "\n" + note
+		}
+	}
+	resp.note = asked
+	parts := resp.split(maxAnswerText)
+	_, ts, err := api.PostMessageContext(ctx, channel, answerOptions(parts[0])...)
+	if err != nil {
+		b.logger.Printf("failed posting a composed question's answer in %v: %v\n", channel, err)
+		b.tellComposer(ctx, api, user, fmt.Sprintf("I could not post your question in <#%s>. Please invite me and ask again.", channel))
+		return
+	}
+	b.postRest(ctx, api, channel, "", ts, parts[1:])
+	if !retain {
+		return
+	}
+	// the answer's thread continues the conversation, as for the slash command
+	key := ts + channel
+	b.convo.Store(key, []string{prompt, resp.stored()})
+	if options := b.replyOptions(parts[0], key, user); len(options) > 1 {
+		if _, _, _, err = api.UpdateMessageContext(ctx, channel, ts, options...); err != nil {
+			b.logger.Printf("failed adding buttons to a composed question's answer: %v\n", err)
+		}
+	}
+}
+
+// tellComposer tells user about their composed question in a direct message, the composer being closed
+func (b *bot) tellComposer(ctx context.Context, api *slack.Client, user, text string) {
+	if _, _, err := api.PostMessageContext(ctx, user, slack.MsgOptionText(text, false)); err != nil {
+		b.logger.Printf("failed telling %v about their composed question: %v\n", user, err)
+	}
+}
@@ -0,0 +1,98 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// composerCallback is the submission of the prompt composer by user, with model and temp empty when they were
+// not picked
+func composerCallback(user, prompt, model, temp, delivery, channel string) *slack.InteractionCallback {
+	callback := &slack.InteractionCallback{Type: slack.InteractionTypeViewSubmission, User: slack.User{ID: user}}
+	callback.View.CallbackID = composerCallbackID
+	values := map[string]map[string]slack.BlockAction{
+		composerPromptBlockID:   {composerPromptBlockID: {Value: prompt}},
+		composerDeliveryBlockID: {composerDeliveryBlockID: {SelectedOption: slack.OptionBlockObject{Value: delivery}}},
+		composerChannelBlockID:  {composerChannelBlockID: {SelectedConversation: channel}},
+	}
+	if model != "" {
+		values[composerModelBlockID] = map[string]slack.BlockAction{composerModelBlockID: {SelectedOption: slack.OptionBlockObject{Value: model}}}
+	}
+	if temp != "" {
+		values[composerTemperatureBlockID] = map[string]slack.BlockAction{composerTemperatureBlockID: {SelectedOption: slack.OptionBlockObject{Value: temp}}}
+	}
+	callback.View.State = &slack.ViewState{Values: values}
+	return callback
+}
+
+func TestComposerModal(t *testing.T) {
+	b := newBot(EventHandlerArgs{Logger: logger, OverrideTiers: testOverrideTiers[:1]})
+	blockIDs := func(user string) []string {
+		var ids []string
+		for _, block := range b.composerModal(user).Blocks.BlockSet {
+			ids = append(ids, block.(*slack.InputBlock).BlockID)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{composerPromptBlockID, composerModelBlockID, composerTemperatureBlockID, composerDeliveryBlockID, composerChannelBlockID}, blockIDs("U1"))
+	assert.Equal(t, []string{composerPromptBlockID, composerDeliveryBlockID, composerChannelBlockID}, blockIDs("U2"), "users in no tier cannot pick a model or temperature")
+
+	_, api, slackServer := newFakeBot(t, EventHandlerArgs{})
+	b.handleInteraction(context.Background(), api, &slack.InteractionCallback{Type: slack.InteractionTypeShortcut, CallbackID: composeShortcutID, TriggerID: "T1", User: slack.User{ID: "U1"}})
+	views := slackServer.Views()
+	require.Len(t, views, 1)
+	assert.Contains(t, views[0].View, composerCallbackID)
+}
+
+func TestComposerSubmitted(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{OverrideTiers: testOverrideTiers})
+	model := &paramsModel{}
+	b.gptClient = model
+	slackServer.AddMembers("C1", "U1")
+	ctx := context.Background()
+	last := func() fake.Message {
+		messages := slackServer.Messages()
+		require.NotEmpty(t, messages)
+		return messages[len(messages)-1]
+	}
+
+	b.handleInteraction(ctx, api, composerCallback("U1", "what is go?", "gpt-4o", "0.5", composerPrivate, ""))
+	assert.Equal(t, "gpt-4o", model.last().Model)
+	assert.Equal(t, float32(0.5), model.last().Temperature)
+	answer := last()
+	assert.Equal(t, "DU1", answer.Channel, "private answers go to the direct messages with the bot")
+	assert.Contains(t, answer.Text, "*You asked:* what is go?")
+	assert.Contains(t, answer.Text, "go is a language")
+	_, ok := b.convo.Get(answer.TS + "DU1")
+	assert.True(t, ok, "the answer's thread continues the conversation")
+
+	b.handleInteraction(ctx, api, composerCallback("U1", "what is go?", composerDefault, composerDefault, composerPublic, "C1"))
+	answer = last()
+	assert.Equal(t, "C1", answer.Channel)
+	assert.Contains(t, answer.Text, "*<@U1> asked:* what is go?")
+	assert.NotEqual(t, "gpt-4o", model.last().Model)
+
+	b.handleInteraction(ctx, api, composerCallback("U2", "what is go?", "", "", composerPublic, "C1"))
+	notice := last()
+	assert.Equal(t, "U2", notice.Channel)
+	assert.Contains(t, notice.Text, "You are not in <#C1>")
+
+	b.handleInteraction(ctx, api, composerCallback("U2", "what is go?", "gpt-4o", "", composerPrivate, ""))
+	notice = last()
+	assert.Equal(t, "U2", notice.Channel)
+	assert.Contains(t, notice.Text, "model gpt-4o is not allowed in the standard tier")
+}
+
+func TestComposerSubmissionResponse(t *testing.T) {
+	b := newBot(EventHandlerArgs{Logger: logger})
+	resp := b.submissionResponse(composerCallback("U1", "what is go?", "", "", composerPublic, ""))
+	require.NotNil(t, resp)
+	assert.Equal(t, slack.RAErrors, resp.ResponseAction)
+	assert.Contains(t, resp.Errors, composerChannelBlockID)
+	assert.Nil(t, b.submissionResponse(composerCallback("U1", "what is go?", "", "", composerPublic, "C1")))
+	assert.Nil(t, b.submissionResponse(composerCallback("U1", "what is go?", "", "", composerPrivate, "")))
+}
@@ -0,0 +1,166 @@
+package slackhandler
+
+import (
+	"context"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+)
+
+// HedgeAction is what the bot does with answers the model rates below the confidence threshold
+type HedgeAction string
+
+const (
+	// HedgeOff posts answers as they are without asking the model to rate them
+	HedgeOff HedgeAction = "off"
+	// HedgeCaveat posts a caveat above answers the model is not confident in
+	HedgeCaveat HedgeAction = "caveat"
+	// HedgeRefuse replaces answers the model is not confident in with a pointer to a human channel
+	HedgeRefuse HedgeAction = "refuse"
+)
+
+// completion is a chat-gpt answer and an optional note the bot posts above it. A refused answer has only
+// a note.
+type completion struct {
+	answer string
+	note   string
+	// usage is the model that answered and the tokens it took, shown below answers rendered with Block Kit
+	usage chatgpt.Usage
+	// model is the model that answered, on every part of a split answer unlike usage so feedback records it
+	model string
+	// blocks renders the answer with Block Kit, in mrkdwn converted from its markdown, rather than in a code block
+	blocks bool
+	// footer is posted below the answer, such as the disclosure of shared channels
+	footer string
+}
+
+// text is the message text to post for the completion
+func (c completion) text() string {
+	text := c.note
+	switch {
+	case c.answer == "":
+	case c.note == "":
+		text = formatResponse(c.answer)
+	default:
+		text = c.note + "\n" + formatResponse(c.answer)
+	}
+	if c.footer != "" {
+		text += "\n" + c.footer
+	}
+	return text
+}
+
+// stored is what the conversation remembers of the completion: the answer, or the note when it was refused
+func (c completion) stored() string {
+	if c.answer == "" {
+		return c.note
+	}
+	return c.answer
+}
+
+// hedging decides what happens to answers the model is not confident in
+type hedging struct {
+	action    HedgeAction
+	threshold int
+	// channels hedging applies to, all channels when empty
+	channels     map[string]bool
+	humanChannel string
+}
+
+// appliesTo reports whether answers in channel are rated
+func (h *hedging) appliesTo(channel string) bool {
+	return h != nil && (len(h.channels) == 0 || h.channels[channel])
+}
+
+// apply hedges answer according to the model's confidence, unrated answers are posted as they are
+func (h *hedging) apply(answer string, confidence int) completion {
+	if confidence == chatgpt.UnknownConfidence || confidence >= h.threshold {
+		return completion{answer: answer}
+	}
+	if h.action == HedgeRefuse {
+		return completion{note: "I'm not confident enough to answer this correctly. " + h.askHuman()}
+	}
+	return completion{
+		answer: answer,
+		note:   fmt.Sprintf("_I'm not very sure about this answer (%d%% confident), please double-check it. %s_", confidence, h.askHuman()),
+	}
+}
+
+// askHuman points the user to the human channel
+func (h *hedging) askHuman() string {
+	if h.humanChannel == "" {
+		return "A colleague may know better."
+	}
+	return "You can also ask in <#" + h.humanChannel + ">."
+}
+
+// complete asks chat-gpt to continue history with the channel's system prompt, grounding it in the knowledge
+// base in support channels and the channel's bookmarks where they are read, and rating and hedging the answer
+// in channels hedging applies to. The tokens it takes are recorded as user's spend in channel.
+func (b *bot) complete(ctx context.Context, api *slack.Client, channel, user string, history []openai.ChatCompletionMessage, opts ...chatgpt.Option) (completion, error) {
+	return b.completeAs(ctx, api, channel, user, b.personaFor(channel, user), history, opts...)
+}
+
+// completeAs is complete with persona as the system prompt
+func (b *bot) completeAs(ctx context.Context, api *slack.Client, channel, user, persona string, history []openai.ChatCompletionMessage, opts ...chatgpt.Option) (completion, error) {
+	if err := b.workers.acquire(ctx); err != nil {
+		b.logger.Printf("question in %v not answered: %v\n", channel, err)
+		return completion{}, err
+	}
+	defer b.workers.release()
+	task, pipeline := b.triage(ctx, channel, history)
+	shared := b.sharedPolicy(ctx, api, channel)
+	if shared != nil {
+		pipeline.grounded = pipeline.grounded && shared.Grounding
+		pipeline.tools = pipeline.tools && shared.Tools
+	}
+	if pipeline.grounded && b.deflection.appliesTo(channel) {
+		history = b.deflection.ground(history)
+	}
+	if pipeline.grounded && b.bookmarks.appliesTo(channel) {
+		history = b.groundInBookmarks(ctx, api, channel, history)
+	}
+	var usage chatgpt.Usage
+	opts = append(opts[:len(opts):len(opts)], b.tokenLimit, chatgpt.WithUsage(&usage))
+	// the channel's settings take precedence over routing, and those chosen for the question, such as the
+	// vision model, over both
+	opts = append(b.channelOptions(channel), opts...)
+	if b.routing != nil {
+		opts = append([]chatgpt.Option{chatgpt.WithTask(task), b.routing}, opts...)
+	}
+	if pipeline.tools && b.directory != nil {
+		opts = append(opts, chatgpt.WithTools(b.directory.tools(api)...))
+	}
+	if pipeline.tools && b.tools != nil {
+		opts = append(opts, chatgpt.WithTools(b.tools.forClient(api)...))
+	}
+	history = append([]openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: persona}}, history...)
+	if !b.hedge.appliesTo(channel) {
+		answer, err := chatgpt.GetStringResponse(b.gptClient, ctx, history, opts...)
+		b.usage.record(user, channel, usage, false)
+		b.reportIncident(ctx, api, channel, err)
+		if err == nil {
+			b.sampleQuality(channel, persona, history, answer, usage.Model)
+		}
+		resp := completion{answer: answer, usage: usage, model: usage.Model, blocks: b.blockKit}
+		if shared != nil {
+			resp.footer = shared.Disclosure
+		}
+		return resp, err
+	}
+	answer, confidence, err := chatgpt.GetRatedResponse(b.gptClient, ctx, history, opts...)
+	b.usage.record(user, channel, usage, false)
+	if err != nil {
+		b.reportIncident(ctx, api, channel, err)
+		return completion{}, err
+	}
+	b.logger.Printf("answer in %v rated %d%% confident\n", channel, confidence)
+	b.sampleQuality(channel, persona, history, answer, usage.Model)
+	resp := b.hedge.apply(answer, confidence)
+	resp.usage, resp.model, resp.blocks = usage, usage.Model, b.blockKit
+	if shared != nil {
+		resp.footer = shared.Disclosure
+	}
+	return resp, nil
+}
@@ -0,0 +1,98 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestHedging_Apply(t *testing.T) {
+	caveat := &hedging{action: HedgeCaveat, threshold: 50, humanChannel: "C0HELP"}
+	refuse := &hedging{action: HedgeRefuse, threshold: 50}
+	tests := []struct {
+		name       string
+		hedge      *hedging
+		confidence int
+		want       completion
+	}{
+		{"confident", caveat, 80, completion{answer: "go is fun"}},
+		{"at threshold", caveat, 50, completion{answer: "go is fun"}},
+		{"unrated", refuse, chatgpt.UnknownConfidence, completion{answer: "go is fun"}},
+		{"caveat", caveat, 20, completion{answer: "go is fun", note: "_I'm not very sure about this answer (20% confident), please double-check it. You can also ask in <#C0HELP>._"}},
+		{"refuse", refuse, 20, completion{note: "I'm not confident enough to answer this correctly. A colleague may know better."}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.hedge.apply("go is fun", tt.confidence))
+		})
+	}
+}
+
+func TestCompletion_Text(t *testing.T) {
+	assert.Equal(t, formatResponse("a"), completion{answer: "a"}.text())
+	assert.Equal(t, "note\n"+formatResponse("a"), completion{answer: "a", note: "note"}.text())
+	assert.Equal(t, "note", completion{note: "note"}.text())
+	assert.Equal(t, "note", completion{note: "note"}.stored())
+}
+
+func TestHedgedAnswers(t *testing.T) {
+	// the fake openai server echoes the question, so its rating ends up at the end of the answer
+	tests := []struct {
+		name     string
+		args     EventHandlerArgs
+		channel  string
+		question string
+		want     string
+	}{
+		{"confident", EventHandlerArgs{Hedge: HedgeRefuse, ConfidenceThreshold: 50}, "D1", "easy confidence: 90", formatResponse("fake answer to: easy")},
+		{"refused", EventHandlerArgs{Hedge: HedgeRefuse, ConfidenceThreshold: 50, HumanChannel: "C0HELP"}, "D1", "hard confidence: 10",
+			"I'm not confident enough to answer this correctly. You can also ask in <#C0HELP>."},
+		{"other channel", EventHandlerArgs{Hedge: HedgeRefuse, ConfidenceThreshold: 50, HedgeChannels: []string{"D2"}}, "D1", "hard confidence: 10",
+			formatResponse("fake answer to: hard confidence: 10")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, api, slackServer := newFakeBot(t, tt.args)
+			b.handleMessage(context.Background(), api, &slackevents.MessageEvent{
+				Type: string(slackevents.Message), User: "U1", Text: tt.question, Channel: tt.channel, TimeStamp: "1.000001",
+			})
+			messages := slackServer.Messages()
+			require.Len(t, messages, 1)
+			assert.Equal(t, tt.want, messages[0].Text)
+		})
+	}
+}
+
+func TestSystemPrompt(t *testing.T) {
+	b := newBot(EventHandlerArgs{Logger: logger, SystemPrompt: "answer in French", ChannelSystemPrompts: map[string]string{"C1": "answer like a pirate", "C2": ""}})
+	assert.Equal(t, "answer like a pirate", b.systemPrompt("C1"))
+	assert.Equal(t, "answer in French", b.systemPrompt("C2"))
+	assert.Equal(t, "answer in French", b.systemPrompt("D1"))
+	assert.Equal(t, chatgpt.DefaultSystemPrompt, newBot(EventHandlerArgs{Logger: logger}).systemPrompt("D1"))
+}
+
+func TestModelRoutes(t *testing.T) {
+	ctx := context.Background()
+	slackServer := fake.NewSlack()
+	t.Cleanup(slackServer.Close)
+	api := slack.New("xoxb-test", slack.OptionAPIURL(slackServer.APIURL()))
+	model := &paramsModel{}
+	routes := []chatgpt.Route{
+		{Name: "documents", Task: chatgpt.TaskDocument, Model: "gpt-4-turbo"},
+		{Name: "short chat", Task: chatgpt.TaskChat, MaxPromptTokens: 1000, Model: "gpt-3.5-turbo"},
+	}
+	b := newBot(EventHandlerArgs{Logger: logger, GPTClient: model, ModelRoutes: routes, OverrideTiers: testOverrideTiers})
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: "C1", TimeStamp: "1.000001"})
+	assert.Equal(t, "gpt-3.5-turbo", model.last().Model)
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> summarize " + strings.Repeat("lorem ipsum ", 600), Channel: "C1", TimeStamp: "2.000001"})
+	assert.Equal(t, "gpt-4-turbo", model.last().Model)
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> [model=gpt-4o] what is go", Channel: "C1", TimeStamp: "3.000001"})
+	assert.Equal(t, "gpt-4o", model.last().Model, "a model asked for takes precedence")
+}
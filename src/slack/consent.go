@@ -0,0 +1,157 @@
+package slackhandler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/slack-go/slack"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// consentActionID identifies the button on the onboarding message that records a user's consent
+const consentActionID = "slackgpt_consent"
+
+// DefaultConsentText is the onboarding message shown to users who have not consented yet
+const DefaultConsentText = "Hi! Before I answer anything, here is what happens to your messages:\n" +
+	"• Your questions and the earlier messages of the conversation are sent to OpenAI to generate an answer.\n" +
+	"• The conversation is kept for follow-up questions until it is cleared with \"clear convo\" or expires.\n" +
+	"• Your user ID and the time you agreed are recorded so you are only asked once.\n" +
+	"Click *I agree* to continue."
+
+// consentThanksText replaces the onboarding message once the user has agreed
+const consentThanksText = "Thanks! Ask your question again and I'll answer it."
+
+// ConsentStore records which users agreed to their questions being sent to the LLM. With a path the
+// consents are kept in a JSON file so they survive restarts.
+type ConsentStore struct {
+	mu    sync.Mutex
+	path  string
+	users map[string]time.Time
+}
+
+// NewConsentStore creates a consent store backed by the JSON file at path, which is created on the first
+// consent if it does not exist. An empty path keeps consents in memory only.
+func NewConsentStore(path string) (*ConsentStore, error) {
+	c := &ConsentStore{path: path, users: map[string]time.Time{}}
+	if path == "" {
+		return c, nil
+	}
+	if err := loadJSON(path, &c.users); err != nil {
+		return nil, fmt.Errorf("reading consents: %w", err)
+	}
+	return c, nil
+}
+
+// Consented reports whether userID has agreed
+func (c *ConsentStore) Consented(userID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.users[userID]
+	return ok
+}
+
+// Record stores that userID agreed at the given time, the consent is kept in memory even when saving fails
+func (c *ConsentStore) Record(userID string, at time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.users[userID] = at.UTC()
+	return c.save()
+}
+
+// save replaces the consent file with the current consents, the caller must hold c.mu
+func (c *ConsentStore) save() error {
+	if c.path == "" {
+		return nil
+	}
+	if err := saveJSON(c.path, c.users); err != nil {
+		return fmt.Errorf("saving consents: %w", err)
+	}
+	return nil
+}
+
+// loadJSON decodes the JSON file at path into v, a missing file leaves v untouched
+func loadJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("decoding %s: %w", path, err)
+	}
+	return nil
+}
+
+// saveJSON replaces the file at path with v encoded as JSON. It writes next to the file and renames so a
+// crash never leaves a truncated file behind.
+func saveJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// onboardingBlocks is the onboarding message with its consent button
+func onboardingBlocks(text string) []slack.Block {
+	agree := slack.NewButtonBlockElement(consentActionID, "agree", slack.NewTextBlockObject(slack.PlainTextType, "I agree", false, false))
+	agree.Style = slack.StylePrimary
+	return []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil),
+		slack.NewActionBlock("slackgpt_onboarding", agree),
+	}
+}
+
+// consented reports whether user may be answered, sending them the onboarding message in channel when
+// they have not agreed yet. Bots are never onboarded.
+func (b *bot) consented(ctx context.Context, api *slack.Client, channel, threadTS, user, botID string) bool {
+	if b.consents == nil || botID != "" || b.consents.Consented(user) {
+		return true
+	}
+	options := []slack.MsgOption{
+		slack.MsgOptionText(b.consentText, false),
+		slack.MsgOptionBlocks(onboardingBlocks(b.consentText)...),
+	}
+	if threadTS != "" {
+		options = append(options, slack.MsgOptionTS(threadTS))
+	}
+	if _, err := api.PostEphemeralContext(ctx, channel, user, options...); err != nil {
+		b.logger.Printf("failed sending onboarding to %v: %v\n", user, err)
+	}
+	return false
+}
+
+// recordConsent stores the consent given through the onboarding button and thanks the user in its place
+func (b *bot) recordConsent(ctx context.Context, callback *slack.InteractionCallback) {
+	if b.consents == nil {
+		return
+	}
+	if err := b.consents.Record(callback.User.ID, time.Now()); err != nil {
+		b.logger.Printf("failed recording consent of %v: %v\n", callback.User.ID, err)
+	}
+	if callback.ResponseURL == "" {
+		return
+	}
+	if err := slack.PostWebhookContext(ctx, callback.ResponseURL, &slack.WebhookMessage{Text: consentThanksText, ReplaceOriginal: true}); err != nil {
+		b.logger.Printf("failed replacing onboarding message: %v\n", err)
+	}
+}
@@ -0,0 +1,80 @@
+package slackhandler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConsentStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "consents.json")
+	c, err := NewConsentStore(path)
+	require.NoError(t, err)
+	assert.False(t, c.Consented("U1"))
+	require.NoError(t, c.Record("U1", time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)))
+	assert.True(t, c.Consented("U1"))
+
+	// consents survive a restart
+	reloaded, err := NewConsentStore(path)
+	require.NoError(t, err)
+	assert.True(t, reloaded.Consented("U1"))
+	assert.False(t, reloaded.Consented("U2"))
+
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+	_, err = NewConsentStore(path)
+	assert.Error(t, err)
+}
+
+func TestOnboarding(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{RequireConsent: true})
+	ctx := context.Background()
+	question := &slackevents.MessageEvent{
+		Type: string(slackevents.Message), User: "U1", Text: "what is go", Channel: "D1", TimeStamp: "1.000001",
+	}
+
+	b.handleMessage(ctx, api, question)
+	assert.Empty(t, slackServer.Messages())
+	ephemeral := slackServer.Ephemerals()
+	require.Len(t, ephemeral, 1)
+	assert.Equal(t, "U1", ephemeral[0].User)
+	assert.Equal(t, DefaultConsentText, ephemeral[0].Text)
+	assert.Contains(t, ephemeral[0].Blocks, consentActionID)
+
+	var replaced slack.WebhookMessage
+	responseServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&replaced)
+	}))
+	defer responseServer.Close()
+	callback := &slack.InteractionCallback{
+		Type:        slack.InteractionTypeBlockActions,
+		User:        slack.User{ID: "U1"},
+		ResponseURL: responseServer.URL,
+	}
+	callback.ActionCallback.BlockActions = []*slack.BlockAction{{ActionID: consentActionID}}
+	b.handleInteraction(ctx, api, callback)
+	assert.True(t, b.consents.Consented("U1"))
+	assert.True(t, replaced.ReplaceOriginal)
+	assert.Equal(t, consentThanksText, replaced.Text)
+
+	b.handleMessage(ctx, api, question)
+	assert.Len(t, slackServer.Messages(), 1)
+	assert.Len(t, slackServer.Ephemerals(), 1)
+}
+
+func TestOnboarding_NotRequired(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{})
+	b.handleMessage(context.Background(), api, &slackevents.MessageEvent{
+		Type: string(slackevents.Message), User: "U1", Text: "what is go", Channel: "D1", TimeStamp: "1.000001",
+	})
+	assert.Len(t, slackServer.Messages(), 1)
+	assert.Empty(t, slackServer.Ephemerals())
+}
@@ -1,88 +1,323 @@
 package slackhandler
 
 import (
+	"context"
+	"github.com/chikamif/slackgpt/src/cache"
+	"github.com/sashabaranov/go-openai"
+	"io"
 	"log"
+	"strings"
 	"sync"
+	"time"
 )
 
-// conversation stores user+channel conversations in a concurrency safe way
+// conversationStoreTimeout bounds every call to a ConversationStore
+const conversationStoreTimeout = 5 * time.Second
+
+// ConversationStore keeps conversation histories by key so they survive restarts and can be shared by several
+// instances of the bot. The src/convostore package has Redis and SQLite implementations.
+type ConversationStore interface {
+	// Load returns the history under key, reporting false when there is none
+	Load(ctx context.Context, key string) ([]string, bool, error)
+	// Save replaces the history under key
+	Save(ctx context.Context, key string, history []string) error
+	// Delete removes the history under key, if any
+	Delete(ctx context.Context, key string) error
+}
+
+// ConversationKey is the key the conversation in the thread threadTS of channel is stored under, that of the
+// channel itself when empty
+func ConversationKey(channel, threadTS string) string {
+	return threadTS + channel
+}
+
+// conversation stores user+channel conversations in a concurrency safe way.
+// The least recently used conversations are evicted once maxEntries or maxBytes is exceeded. With a
+// ConversationStore the conversations in memory cache it: misses are loaded from it and changes written to it.
 type conversation struct {
-	sync.Mutex
-	data map[string][]string
+	data *cache.LRU[[]string]
+	// store is nil when conversations are only kept in memory
+	store  ConversationStore
+	logger *log.Logger
+	// saving makes sure the latest history under a key is saved last
+	saving sync.Mutex
 }
 
-// newConversation creates a new conversation
-func newConversation() *conversation {
-	convo := make(map[string][]string)
+// newConversation creates a new conversation store, a bound of 0 disables that bound
+func newConversation(maxEntries int, maxBytes int64) *conversation {
 	return &conversation{
-		data: convo,
+		data:   cache.NewLRU[[]string]("conversation", maxEntries, maxBytes, conversationSize),
+		logger: log.New(io.Discard, "", 0),
 	}
 }
 
-// UpdateConversation stores records of 4 questions and answers for a given user channel combination
-// to feed into the chat-gpt API to enable conversations
-func (c *conversation) UpdateConversation(key string, chatText string) {
-	// All locking is handled in other methods
+// load reads the conversation under key from the store unless it is in memory already
+func (c *conversation) load(key string) {
+	if c.store == nil {
+		return
+	}
+	if _, ok := c.data.Peek(key); ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), conversationStoreTimeout)
+	defer cancel()
+	history, ok, err := c.store.Load(ctx, key)
+	if err != nil {
+		c.logger.Printf("failed loading conversation %v: %v\n", key, err)
+		return
+	}
+	if ok {
+		c.data.Update(key, func(existing []string, exists bool) []string {
+			// a concurrent change was made to what is in the store already
+			if exists {
+				return existing
+			}
+			return history
+		})
+	}
+}
+
+// save writes the conversation under key to the store, the conversation stays in memory when this fails
+func (c *conversation) save(key string) {
+	if c.store == nil {
+		return
+	}
+	c.saving.Lock()
+	defer c.saving.Unlock()
+	history, ok := c.data.Peek(key)
+	if !ok {
+		// evicted already, it was saved before
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), conversationStoreTimeout)
+	defer cancel()
+	if err := c.store.Save(ctx, key, history); err != nil {
+		c.logger.Printf("failed saving conversation %v: %v\n", key, err)
+	}
+}
 
-	// new userChannel+(thread) combo, guard
-	if _, ok := c.Get(key); !ok {
-		c.AddNew(key, chatText)
+// forget deletes the conversation under key from the store
+func (c *conversation) forget(key string) {
+	if c.store == nil {
 		return
 	}
+	c.saving.Lock()
+	defer c.saving.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), conversationStoreTimeout)
+	defer cancel()
+	if err := c.store.Delete(ctx, key); err != nil {
+		c.logger.Printf("failed deleting conversation %v: %v\n", key, err)
+	}
+}
 
-	c.AddTextToExisting(key, chatText)
+// conversationSize estimates the memory held by a conversation
+func conversationSize(key string, value []string) int64 {
+	size := int64(len(key))
+	for _, v := range value {
+		size += int64(len(v))
+	}
+	return size
+}
+
+// UpdateConversation stores records of 4 questions and answers for a given user channel combination
+// to feed into the chat-gpt API to enable conversations
+func (c *conversation) UpdateConversation(key string, chatText string) {
+	c.load(key)
+	defer c.save(key)
+	c.data.Update(key, func(value []string, ok bool) []string {
+		// new userChannel+(thread) combo, guard
+		if !ok {
+			return []string{chatText}
+		}
+		return appendToConversation(value, chatText)
+	})
 }
 
 // AddNew is used to add a new value to conversation map
 func (c *conversation) AddNew(key, value string) {
-	c.Lock()
-	defer c.Unlock()
-	c.data[key] = append(c.data[key], value)
+	c.load(key)
+	defer c.save(key)
+	c.data.Update(key, func(existing []string, _ bool) []string {
+		return append(existing, value)
+	})
 }
 
 // AddTextToExisting updates an existing conversation
 func (c *conversation) AddTextToExisting(key, value string) {
-	c.Lock()
-	defer c.Unlock()
+	c.load(key)
+	defer c.save(key)
+	c.data.Update(key, func(existing []string, _ bool) []string {
+		return appendToConversation(existing, value)
+	})
+}
 
+// appendToConversation appends value to a conversation, dropping the oldest message once it is full.
+// A new slice is always returned so copies handed out by Get are never modified.
+func appendToConversation(existing []string, value string) []string {
 	// this is around the maximum chat buffer chat-gpt API can handle given 4096 token
 	// number may need tweaking if found to be too large
-	if len(c.data[key]) < 8 {
-		c.data[key] = append(c.data[key], value)
-	} else {
+	if len(existing) >= 8 {
 		// slice off only the first message to preserve context
-		c.data[key] = c.data[key][1:]
-		c.data[key] = append(c.data[key], value)
+		existing = existing[1:]
 	}
+	updated := make([]string, 0, len(existing)+1)
+	return append(append(updated, existing...), value)
 }
 
-// Get safely retrieves a value from a map
+// Get safely retrieves a copy of a value from a map
 func (c *conversation) Get(key string) ([]string, bool) {
-	c.Lock()
-	defer c.Unlock()
-	value, ok := c.data[key]
-	return value, ok
+	c.load(key)
+	value, ok := c.data.Get(key)
+	return append([]string(nil), value...), ok
+}
+
+// ReviseQuestion replaces the most recent occurrence of question with revised and returns the
+// conversation up to and including it, reporting false if question is no longer in the conversation
+func (c *conversation) ReviseQuestion(key, question, revised string) ([]string, bool) {
+	c.load(key)
+	var history []string
+	found := false
+	c.data.UpdateExisting(key, func(existing []string) []string {
+		i := lastIndex(existing, question)
+		if i < 0 {
+			return existing
+		}
+		found = true
+		updated := append([]string(nil), existing...)
+		updated[i] = revised
+		history = append([]string(nil), updated[:i+1]...)
+		return updated
+	})
+	if found {
+		c.save(key)
+	}
+	return history, found
+}
+
+// Before returns the conversation up to, not including, the most recent occurrence of message, reporting false
+// if message is no longer in the conversation
+func (c *conversation) Before(key, message string) ([]string, bool) {
+	c.load(key)
+	history, _ := c.data.Get(key)
+	i := lastIndex(history, message)
+	if i < 0 {
+		return nil, false
+	}
+	return append([]string(nil), history[:i]...), true
+}
+
+// Answer returns the most recent message starting with part, which is how the first part of an answer split
+// over several messages reads, and the conversation before it, reporting false if there is no such message
+func (c *conversation) Answer(key, part string) (string, []string, bool) {
+	c.load(key)
+	history, _ := c.data.Get(key)
+	for i := len(history) - 1; i >= 0; i-- {
+		if part != "" && strings.HasPrefix(strings.TrimSpace(history[i]), part) {
+			return history[i], append([]string(nil), history[:i]...), true
+		}
+	}
+	return "", nil, false
+}
+
+// Store replaces the conversation under key with history
+func (c *conversation) Store(key string, history []string) {
+	c.data.Set(key, append([]string(nil), history...))
+	c.save(key)
+}
+
+// ReplaceMessage replaces the most recent occurrence of message with replacement, reporting whether it was found
+func (c *conversation) ReplaceMessage(key, message, replacement string) bool {
+	c.load(key)
+	found := false
+	c.data.UpdateExisting(key, func(existing []string) []string {
+		i := lastIndex(existing, message)
+		if i < 0 {
+			return existing
+		}
+		found = true
+		updated := append([]string(nil), existing...)
+		updated[i] = replacement
+		return updated
+	})
+	if found {
+		c.save(key)
+	}
+	return found
+}
+
+// RemoveExchange removes the most recent occurrence of question and the answer that follows it,
+// reporting whether question was found. The conversation is deleted once it is empty.
+func (c *conversation) RemoveExchange(key, question, answer string) bool {
+	c.load(key)
+	found, empty := false, false
+	c.data.UpdateExisting(key, func(existing []string) []string {
+		i := lastIndex(existing, question)
+		if i < 0 {
+			return existing
+		}
+		found = true
+		end := i + 1
+		if end < len(existing) && existing[end] == answer {
+			end++
+		}
+		updated := append(append([]string(nil), existing[:i]...), existing[end:]...)
+		empty = len(updated) == 0
+		return updated
+	})
+	if empty {
+		c.data.Delete(key)
+		c.forget(key)
+	} else if found {
+		c.save(key)
+	}
+	return found
+}
+
+// lastIndex returns the index of the last occurrence of message in messages, or -1
+func lastIndex(messages []string, message string) int {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i] == message {
+			return i
+		}
+	}
+	return -1
 }
 
 // ClearConversation delete current conversation history
 func (c *conversation) ClearConversation(userChannelThreadKey string) bool {
-	c.Lock()
-	defer c.Unlock()
+	c.load(userChannelThreadKey)
+	c.forget(userChannelThreadKey)
+	return c.data.Delete(userChannelThreadKey)
+}
 
-	// Key exists in the map delete it from map and return true
-	if _, ok := c.data[userChannelThreadKey]; ok {
+// Len returns the number of conversations in memory
+func (c *conversation) Len() int {
+	return c.data.Len()
+}
 
-		delete(c.data, userChannelThreadKey)
-		return true
-	} else {
-		// Key does not exist in the map
-		return false
-	}
+// Stats reports the size and effectiveness of the conversation store
+func (c *conversation) Stats() cache.Stats {
+	return c.data.Stats()
 }
 
-// LogConversationHistoryKvPairs chat history to be logged
+// LogConversationHistoryKvPairs chat history to be logged, least recently used first
 func (c *conversation) LogConversationHistoryKvPairs() {
-	for k, v := range c.data {
-		log.Printf("Key: %s, Value: %v, Length: %d\n", k, v, len(v))
+	c.data.Range(func(k string, v []string) {
+		c.logger.Printf("Key: %s, Value: %v, Length: %d\n", k, v, len(v))
+	})
+}
+
+// turns turns stored conversation history into chat messages. The store alternates questions and answers
+// but may have lost either end, so roles are assigned backwards from the last message, whose role is last.
+func turns(history []string, last string) []openai.ChatCompletionMessage {
+	messages := make([]openai.ChatCompletionMessage, len(history))
+	role, other := last, openai.ChatMessageRoleUser
+	if last == openai.ChatMessageRoleUser {
+		other = openai.ChatMessageRoleAssistant
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		messages[i] = openai.ChatCompletionMessage{Role: role, Content: history[i]}
+		role, other = other, role
 	}
+	return messages
 }
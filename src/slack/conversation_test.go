@@ -2,15 +2,18 @@ package slackhandler
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"log"
+	"sync"
 	"testing"
 	"time"
 )
 
 func TestConversation_Get(t *testing.T) {
-	c := newConversation()
+	c := newConversation(0, 0)
 	c.AddNew("test", "1")
 	for i := 0; i < 10; i++ {
 		go c.Get("test")
@@ -18,14 +21,14 @@ func TestConversation_Get(t *testing.T) {
 }
 
 func TestConversation_AddNew(t *testing.T) {
-	c := newConversation()
+	c := newConversation(0, 0)
 	for i := 0; i < 10; i++ {
 		go c.AddNew("test", "1")
 	}
 }
 
 func TestConversation_AddTextToExisting(t *testing.T) {
-	c := newConversation()
+	c := newConversation(0, 0)
 	c.AddNew("test", "1")
 	for i := 0; i < 10; i++ {
 		go c.AddTextToExisting("test", "2")
@@ -33,21 +36,22 @@ func TestConversation_AddTextToExisting(t *testing.T) {
 }
 
 func TestConversation_UpdateConversation(t *testing.T) {
-	convo := newConversation()
+	convo := newConversation(0, 0)
 	userChannel := "user"
 	for i := 0; i < 10; i++ {
 		tmp := fmt.Sprintf("%s%v", userChannel, i)
 		convo.UpdateConversation(userChannel, tmp)
+		history, _ := convo.Get(userChannel)
 		if i < 8 {
-			assert.Equal(t, convo.data[userChannel][0], "user0")
+			assert.Equal(t, history[0], "user0")
 		} else {
-			assert.Equal(t, convo.data[userChannel][0], fmt.Sprintf("%s%v", "user", i%7))
+			assert.Equal(t, history[0], fmt.Sprintf("%s%v", "user", i%7))
 		}
 	}
 }
 
 func TestConversation_ClearConversation_DataRaceOk(t *testing.T) {
-	c := newConversation()
+	c := newConversation(0, 0)
 	c.AddNew("key1", "1")
 	for i := 0; i < 10; i++ {
 		go c.ClearConversation("key1")
@@ -55,15 +59,14 @@ func TestConversation_ClearConversation_DataRaceOk(t *testing.T) {
 }
 
 func TestConversation_ClearConversation_ClearsOk(t *testing.T) {
-	var c = newConversation()
-	c.data = map[string][]string{
-		"key1": {"1", "2", "3", "4"},
-		"key2": {"1", "2", "3", "4"},
-	}
+	var c = newConversation(0, 0)
+	c.data.Set("key1", []string{"1", "2", "3", "4"})
+	c.data.Set("key2", []string{"1", "2", "3", "4"})
 	var isCleared = c.ClearConversation("key1")
 	var isNotCleared = c.ClearConversation("badKey")
-	assert.Equal(t, 4, len(c.data["key2"]))
-	assert.Equal(t, 1, len(c.data))
+	key2, _ := c.Get("key2")
+	assert.Equal(t, 4, len(key2))
+	assert.Equal(t, 1, c.Len())
 	assert.True(t, isCleared)
 	assert.False(t, isNotCleared)
 }
@@ -71,12 +74,13 @@ func TestConversation_ClearConversation_ClearsOk(t *testing.T) {
 func TestConversation_LogConversationHistoryKvPairs(t *testing.T) {
 
 	// Create a new conversation instance
-	var c = newConversation()
-	c.data = map[string][]string{"key1": {"value1", "value2"}, "key2": {"value3"}}
+	var c = newConversation(0, 0)
+	c.data.Set("key1", []string{"value1", "value2"})
+	c.data.Set("key2", []string{"value3"})
 
 	// Create a new buffer to capture the log output
 	var buf bytes.Buffer
-	log.SetOutput(&buf)
+	c.logger = log.New(&buf, "", log.LstdFlags)
 
 	// Call the LogConversationHistoryKvPairs method with the conversation instance
 	c.LogConversationHistoryKvPairs()
@@ -94,3 +98,98 @@ func TestConversation_LogConversationHistoryKvPairs(t *testing.T) {
 	}
 
 }
+
+func TestConversation_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := newConversation(2, 0)
+	c.UpdateConversation("key1", "1")
+	c.UpdateConversation("key2", "2")
+	c.Get("key1")
+	c.UpdateConversation("key3", "3")
+	_, ok := c.Get("key2")
+	assert.False(t, ok)
+	_, ok = c.Get("key1")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), c.Stats().Evictions)
+}
+
+func TestConversation_BoundedByBytes(t *testing.T) {
+	c := newConversation(0, 20)
+	for i := 0; i < 10; i++ {
+		c.UpdateConversation(fmt.Sprintf("key%d", i), "0123456789")
+	}
+	stats := c.Stats()
+	assert.LessOrEqual(t, stats.Bytes, int64(20))
+	assert.Equal(t, 1, stats.Entries)
+	assert.Equal(t, uint64(9), stats.Evictions)
+}
+
+// memoryStore is a ConversationStore keeping conversations in a map, failing every call with err when set
+type memoryStore struct {
+	mu    sync.Mutex
+	data  map[string][]string
+	err   error
+	loads int
+}
+
+func (m *memoryStore) Load(_ context.Context, key string) ([]string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.loads++
+	history, ok := m.data[key]
+	return history, ok, m.err
+}
+
+func (m *memoryStore) Save(_ context.Context, key string, history []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err == nil {
+		m.data[key] = append([]string(nil), history...)
+	}
+	return m.err
+}
+
+func (m *memoryStore) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err == nil {
+		delete(m.data, key)
+	}
+	return m.err
+}
+
+func TestConversation_Store(t *testing.T) {
+	store := &memoryStore{data: map[string][]string{}}
+	c := newConversation(1, 0)
+	c.store, c.logger = store, logger
+	c.UpdateConversation("key1", "question")
+	c.UpdateConversation("key1", "answer")
+	c.UpdateConversation("key2", "other")
+	assert.Equal(t, []string{"question", "answer"}, store.data["key1"])
+
+	// evicted from memory, or lost with a restart
+	restarted := newConversation(0, 0)
+	restarted.store, restarted.logger = store, logger
+	for _, c := range []*conversation{c, restarted} {
+		history, ok := c.Get("key1")
+		assert.True(t, ok)
+		assert.Equal(t, []string{"question", "answer"}, history)
+	}
+	loads := store.loads
+	restarted.Get("key1")
+	assert.Equal(t, loads, store.loads, "conversations in memory are not loaded again")
+
+	restarted.ReplaceMessage("key1", "answer", "revised answer")
+	assert.Equal(t, []string{"question", "revised answer"}, store.data["key1"])
+	assert.True(t, restarted.RemoveExchange("key1", "question", "revised answer"))
+	assert.NotContains(t, store.data, "key1")
+
+	assert.True(t, c.ClearConversation("key2"))
+	assert.NotContains(t, store.data, "key2")
+	assert.False(t, c.ClearConversation("key2"))
+
+	store.err = errors.New("store down")
+	c.UpdateConversation("key3", "kept in memory")
+	history, ok := c.Get("key3")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"kept in memory"}, history)
+}
@@ -0,0 +1,91 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/cache"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/slack-go/slack/socketmode"
+	"time"
+)
+
+const (
+	// defaultDedupTTL is how long events are remembered unless told otherwise, slack retries for less than that
+	defaultDedupTTL = time.Hour
+	// maxSeenEvents bounds the events remembered in memory, the oldest are forgotten first
+	maxSeenEvents = 10000
+	// seenEventsTimeout bounds every call to a SeenEvents
+	seenEventsTimeout = 2 * time.Second
+)
+
+// SeenEvents remembers the events the bot handled, so that those slack delivers again, e.g. because the bot was
+// slow to acknowledge them, are skipped rather than answered twice. A store shared by the instances of the bot,
+// such as convostore.RedisEvents, skips the events another instance handled too.
+type SeenEvents interface {
+	// Seen records that the event id is being handled and reports whether it already was within the last ttl
+	Seen(ctx context.Context, id string, ttl time.Duration) (bool, error)
+}
+
+// seenInMemory remembers the last maxSeenEvents events with when they were seen
+type seenInMemory struct {
+	events *cache.LRU[time.Time]
+	now    func() time.Time
+}
+
+func newSeenInMemory() *seenInMemory {
+	return &seenInMemory{events: cache.NewLRU[time.Time]("seen_events", maxSeenEvents, 0, nil), now: time.Now}
+}
+
+func (s *seenInMemory) Seen(_ context.Context, id string, ttl time.Duration) (bool, error) {
+	now, seen := s.now(), false
+	s.events.Update(id, func(at time.Time, ok bool) time.Time {
+		if ok && now.Sub(at) < ttl {
+			seen = true
+			return at
+		}
+		return now
+	})
+	return seen, nil
+}
+
+// Stats returns the stats of the events remembered
+func (s *seenInMemory) Stats() cache.Stats {
+	return s.events.Stats()
+}
+
+// dedup skips the Events API events already handled within ttl
+type dedup struct {
+	seen SeenEvents
+	ttl  time.Duration
+}
+
+// skipDuplicates drops the Events API events slack delivered before. They are acknowledged all the same, so that
+// slack stops delivering them. Events are handled when whether they were seen cannot be told.
+func (b *bot) skipDuplicates(next HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, api *slack.Client, evt *socketmode.Event) {
+		if id := eventID(evt); id != "" {
+			checking, cancel := context.WithTimeout(ctx, seenEventsTimeout)
+			seen, err := b.dedup.seen.Seen(checking, id, b.dedup.ttl)
+			cancel()
+			switch {
+			case err != nil:
+				b.logger.Printf("failed checking whether event %s was seen: %v\n", id, err)
+			case seen:
+				b.logger.Printf("Ignored %s event %s, it was already handled\n", eventType(evt), id)
+				return
+			}
+		}
+		next(ctx, api, evt)
+	}
+}
+
+// eventID returns the ID of the Events API event evt, which is the same in every delivery of the event, empty
+// for other events
+func eventID(evt *socketmode.Event) string {
+	if eventsAPIEvent, ok := evt.Data.(slackevents.EventsAPIEvent); ok {
+		if callback, ok := eventsAPIEvent.Data.(*slackevents.EventsAPICallbackEvent); ok {
+			return callback.EventID
+		}
+	}
+	return ""
+}
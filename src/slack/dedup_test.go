@@ -0,0 +1,76 @@
+package slackhandler
+
+import (
+	"context"
+	"errors"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/slack-go/slack/socketmode"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// failingEvents cannot tell whether events were seen
+type failingEvents struct{}
+
+func (failingEvents) Seen(context.Context, string, time.Duration) (bool, error) {
+	return false, errors.New("redis is down")
+}
+
+// mentionDelivery is a delivery of the app mention with eventID
+func mentionDelivery(eventID, envelopeID string) *socketmode.Event {
+	return &socketmode.Event{
+		Type: socketmode.EventTypeEventsAPI,
+		Data: slackevents.EventsAPIEvent{
+			Type: slackevents.CallbackEvent,
+			Data: &slackevents.EventsAPICallbackEvent{EventID: eventID},
+			InnerEvent: slackevents.EventsAPIInnerEvent{
+				Type: string(slackevents.AppMention),
+				Data: &slackevents.AppMentionEvent{User: "U1", Channel: "C1", Text: "<@U0BOT> hello"},
+			},
+		},
+		Request: &socketmode.Request{EnvelopeID: envelopeID},
+	}
+}
+
+func TestSkipDuplicates(t *testing.T) {
+	tests := []struct {
+		name string
+		seen SeenEvents
+		want []string
+	}{
+		{name: "in memory", want: []string{"envelope-1", "envelope-3"}},
+		{name: "unknown", seen: failingEvents{}, want: []string{"envelope-1", "envelope-2", "envelope-3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBot(EventHandlerArgs{Logger: logger, SeenEvents: tt.seen})
+			var handled []string
+			h := b.handler(func(_ context.Context, _ *slack.Client, evt *socketmode.Event) {
+				handled = append(handled, evt.Request.EnvelopeID)
+			})
+			ctx := context.Background()
+			h(ctx, nil, mentionDelivery("Ev1", "envelope-1"))
+			h(ctx, nil, mentionDelivery("Ev1", "envelope-2"))
+			h(ctx, nil, mentionDelivery("Ev2", "envelope-3"))
+			assert.Equal(t, tt.want, handled)
+		})
+	}
+}
+
+func TestSeenInMemory(t *testing.T) {
+	seen := newSeenInMemory()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	seen.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	ok, _ := seen.Seen(ctx, "Ev1", time.Hour)
+	assert.False(t, ok)
+	now = now.Add(59 * time.Minute)
+	ok, _ = seen.Seen(ctx, "Ev1", time.Hour)
+	assert.True(t, ok)
+	now = now.Add(2 * time.Minute)
+	ok, _ = seen.Seen(ctx, "Ev1", time.Hour)
+	assert.False(t, ok, "events are forgotten after the ttl")
+}
@@ -0,0 +1,232 @@
+package slackhandler
+
+import (
+	"context"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/cache"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	// resolvedActionID identifies the button the asker clicks when a deflected answer solved their problem
+	resolvedActionID = "slackgpt_deflection_resolved"
+	// needHelpActionID identifies the button the asker clicks when they still need the support team
+	needHelpActionID = "slackgpt_deflection_need_help"
+	// maxKnowledgeBytes is the most knowledge base text sent along with a question
+	maxKnowledgeBytes = 64 << 10
+	// knowledgePrompt grounds answers in support channels in the knowledge base that follows it
+	knowledgePrompt = "Answer using only the knowledge base below. If it does not cover the question, say so and" +
+		" suggest asking the support team instead of guessing.\n\nKnowledge base:\n"
+)
+
+// LoadKnowledgeBase reads the knowledge base at path, a text or markdown file or a directory whose .md and
+// .txt files are read in name order. Text past 64KiB is left out.
+func LoadKnowledgeBase(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("reading knowledge base: %w", err)
+	}
+	files := []string{path}
+	if info.IsDir() {
+		files = nil
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return "", fmt.Errorf("reading knowledge base: %w", err)
+		}
+		for _, entry := range entries {
+			if ext := filepath.Ext(entry.Name()); !entry.IsDir() && (ext == ".md" || ext == ".txt") {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+		sort.Strings(files)
+	}
+	var kb strings.Builder
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("reading knowledge base: %w", err)
+		}
+		kb.Write(data)
+		kb.WriteString("\n\n")
+	}
+	text := strings.TrimSpace(kb.String())
+	if len(text) > maxKnowledgeBytes {
+		text = text[:maxKnowledgeBytes]
+	}
+	return text, nil
+}
+
+// DeflectionMetrics counts how support questions answered from the knowledge base turned out
+type DeflectionMetrics struct {
+	answered  atomic.Int64
+	resolved  atomic.Int64
+	escalated atomic.Int64
+}
+
+// DeflectionStats is a snapshot of DeflectionMetrics
+type DeflectionStats struct {
+	// Answered counts deflected questions, Resolved and Escalated how many of them the asker marked as
+	// solved or handed to the support team. The rest are still pending.
+	Answered  int64
+	Resolved  int64
+	Escalated int64
+}
+
+// Rate is the share of decided questions that were resolved without the support team
+func (s DeflectionStats) Rate() float64 {
+	decided := s.Resolved + s.Escalated
+	if decided == 0 {
+		return 0
+	}
+	return float64(s.Resolved) / float64(decided)
+}
+
+// Snapshot returns the current counts, it is safe to call on a nil DeflectionMetrics
+func (m *DeflectionMetrics) Snapshot() DeflectionStats {
+	if m == nil {
+		return DeflectionStats{}
+	}
+	return DeflectionStats{Answered: m.answered.Load(), Resolved: m.resolved.Load(), Escalated: m.escalated.Load()}
+}
+
+// deflectionOutcome is what the asker made of a deflected answer
+type deflectionOutcome int
+
+const (
+	deflectionPending deflectionOutcome = iota
+	deflectionResolved
+	deflectionEscalated
+)
+
+// deflected is a support question answered from the knowledge base
+type deflected struct {
+	User    string
+	Outcome deflectionOutcome
+}
+
+// deflection answers questions in support channels from the knowledge base before the support team is pinged
+type deflection struct {
+	channels  map[string]bool
+	knowledge string
+	metrics   *DeflectionMetrics
+	// questions are indexed by conversation key
+	questions *cache.LRU[deflected]
+}
+
+// newDeflection creates a deflection for channels, keeping track of at most maxEntries questions
+func newDeflection(channels []string, knowledge string, metrics *DeflectionMetrics, maxEntries int) *deflection {
+	d := &deflection{
+		channels:  make(map[string]bool, len(channels)),
+		knowledge: knowledge,
+		metrics:   metrics,
+		questions: cache.NewLRU[deflected]("deflections", maxEntries, 0, nil),
+	}
+	for _, channel := range channels {
+		d.channels[channel] = true
+	}
+	if d.metrics == nil {
+		d.metrics = &DeflectionMetrics{}
+	}
+	return d
+}
+
+// appliesTo reports whether questions in channel are deflected
+func (d *deflection) appliesTo(channel string) bool {
+	return d != nil && d.channels[channel]
+}
+
+// ground puts the knowledge base in front of history
+func (d *deflection) ground(history []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	if d.knowledge == "" {
+		return history
+	}
+	grounded := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: knowledgePrompt + d.knowledge}}
+	return append(grounded, history...)
+}
+
+// track records a deflected answer to user's question in the conversation under convoKey
+func (d *deflection) track(convoKey, user string) {
+	d.questions.Set(convoKey, deflected{User: user})
+	d.metrics.answered.Add(1)
+}
+
+// Stats reports the size and effectiveness of the deflected question index
+func (d *deflection) Stats() cache.Stats {
+	return d.questions.Stats()
+}
+
+// supportQuestion reports whether ev is a new question in a support channel that has to be answered without
+// a mention. Questions mentioning the bot are left to the app mention that is delivered for them.
+func (b *bot) supportQuestion(ctx context.Context, api *slack.Client, ev *slackevents.MessageEvent) bool {
+	if !b.deflection.appliesTo(ev.Channel) || ev.SubType != "" || ev.ThreadTimeStamp != "" {
+		return false
+	}
+	// without knowing who the bot is a mention cannot be told apart, so leave it to the mention
+	selfUser, _, err := b.self.get(ctx, api)
+	return err == nil && !strings.Contains(ev.Text, "<@"+selfUser)
+}
+
+// deflectionOptions posts resp with the buttons the asker uses to mark it resolved or ask for the support team
+func deflectionOptions(resp completion, convoKey string) []slack.MsgOption {
+	resolved := slack.NewButtonBlockElement(resolvedActionID, convoKey, slack.NewTextBlockObject(slack.PlainTextType, "Resolved", false, false))
+	resolved.Style = slack.StylePrimary
+	needHelp := slack.NewButtonBlockElement(needHelpActionID, convoKey, slack.NewTextBlockObject(slack.PlainTextType, "I still need help", false, false))
+	return answerOptions(resp, resolved, needHelp)
+}
+
+// decideDeflection applies the asker's click on a deflected answer, clicks by others and repeated clicks
+// are ignored
+func (b *bot) decideDeflection(ctx context.Context, api *slack.Client, callback *slack.InteractionCallback, action *slack.BlockAction) {
+	if b.deflection == nil {
+		return
+	}
+	q, ok := b.deflection.questions.Get(action.Value)
+	if !ok || q.Outcome != deflectionPending {
+		return
+	}
+	if q.User != callback.User.ID {
+		_, err := api.PostEphemeralContext(ctx, callback.Channel.ID, callback.User.ID,
+			slack.MsgOptionText(fmt.Sprintf("Only <@%s> can decide whether this answered their question.", q.User), false),
+			slack.MsgOptionTS(callback.Message.Timestamp))
+		if err != nil {
+			b.logger.Printf("failed answering deflection click: %v\n", err)
+		}
+		return
+	}
+
+	outcome, note := deflectionResolved, fmt.Sprintf(":white_check_mark: <@%s> marked this as resolved.", q.User)
+	if action.ActionID == needHelpActionID {
+		outcome, note = deflectionEscalated, fmt.Sprintf(":raising_hand: <@%s> still needs help, the support team has been asked.", q.User)
+	}
+	q.Outcome = outcome
+	b.deflection.questions.Set(action.Value, q)
+	if outcome == deflectionResolved {
+		b.deflection.metrics.resolved.Add(1)
+	} else {
+		b.deflection.metrics.escalated.Add(1)
+	}
+
+	// keep the answer but replace its buttons with the outcome
+	var blocks []slack.Block
+	for _, block := range callback.Message.Blocks.BlockSet {
+		if block.BlockType() != slack.MBTAction {
+			blocks = append(blocks, block)
+		}
+	}
+	blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, note, false, false)))
+	_, _, _, err := api.UpdateMessageContext(ctx, callback.Channel.ID, callback.Message.Timestamp,
+		slack.MsgOptionText(callback.Message.Text, false), slack.MsgOptionBlocks(blocks...))
+	if err != nil {
+		b.logger.Printf("failed updating deflected answer: %v\n", err)
+	}
+	if outcome == deflectionEscalated {
+		b.escalate(ctx, api, callback, action)
+	}
+}
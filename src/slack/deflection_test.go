@@ -0,0 +1,118 @@
+package slackhandler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadKnowledgeBase(t *testing.T) {
+	dir := t.TempDir()
+	for name, text := range map[string]string{"b.txt": "vpn: restart it", "a.md": "# wifi\nuse guest", "logo.png": "binary"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(text), 0o600))
+	}
+	kb, err := LoadKnowledgeBase(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "# wifi\nuse guest\n\nvpn: restart it", kb)
+
+	kb, err = LoadKnowledgeBase(filepath.Join(dir, "b.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "vpn: restart it", kb)
+
+	_, err = LoadKnowledgeBase(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestDeflection_Ground(t *testing.T) {
+	question := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "vpn?"}}
+	grounded := newDeflection([]string{"C1"}, "vpn: restart it", nil, 0).ground(question)
+	require.Len(t, grounded, 2)
+	assert.Equal(t, openai.ChatMessageRoleSystem, grounded[0].Role)
+	assert.Contains(t, grounded[0].Content, "vpn: restart it")
+	assert.Equal(t, question, newDeflection([]string{"C1"}, "", nil, 0).ground(question))
+}
+
+// deflectionClick is a click by user on a button of the deflected answer msg
+func deflectionClick(t *testing.T, msg fake.Message, user, actionID string) *slack.InteractionCallback {
+	callback := escalateCallback(msg.Channel, slack.Msg{Timestamp: msg.TS, ThreadTimestamp: msg.ThreadTS, Text: msg.Text}, msg.ThreadTS+msg.Channel)
+	callback.User.ID = user
+	callback.ActionCallback.BlockActions[0].ActionID = actionID
+	require.NoError(t, json.Unmarshal([]byte(msg.Blocks), &callback.Message.Blocks))
+	return callback
+}
+
+func TestDeflection(t *testing.T) {
+	tests := []struct {
+		name          string
+		actionID      string
+		wantNote      string
+		wantMessages  int
+		wantResolved  int64
+		wantEscalated int64
+	}{
+		{"resolved", resolvedActionID, "marked this as resolved", 2, 1, 0},
+		{"need help", needHelpActionID, "still needs help", 3, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics := &DeflectionMetrics{}
+			b, api, slackServer := newFakeBot(t, EventHandlerArgs{
+				DeflectionChannels: []string{"C1"}, KnowledgeBase: "vpn: restart it", DeflectionMetrics: metrics,
+				EscalationGroup: "S0SUPPORT",
+			})
+			ctx := context.Background()
+			question := slackServer.AddMessage(fake.Message{Channel: "C1", User: "U1", Text: "my vpn is broken"})
+			b.handleMessage(ctx, api, &slackevents.MessageEvent{
+				Type: string(slackevents.Message), User: "U1", Text: question.Text, Channel: "C1", ChannelType: "channel", TimeStamp: question.TS,
+			})
+			messages := slackServer.Messages()
+			require.Len(t, messages, 2)
+			answer := messages[1]
+			assert.Equal(t, question.TS, answer.ThreadTS)
+			assert.Contains(t, answer.Blocks, resolvedActionID)
+			assert.Contains(t, answer.Blocks, needHelpActionID)
+			assert.Equal(t, DeflectionStats{Answered: 1}, metrics.Snapshot())
+
+			// only the asker decides
+			b.handleInteraction(ctx, api, deflectionClick(t, answer, "U2", tt.actionID))
+			assert.Len(t, slackServer.Ephemerals(), 1)
+			assert.Equal(t, DeflectionStats{Answered: 1}, metrics.Snapshot())
+
+			b.handleInteraction(ctx, api, deflectionClick(t, answer, "U1", tt.actionID))
+			b.handleInteraction(ctx, api, deflectionClick(t, answer, "U1", tt.actionID))
+			messages = slackServer.Messages()
+			require.Len(t, messages, tt.wantMessages)
+			assert.Contains(t, messages[1].Blocks, tt.wantNote)
+			assert.NotContains(t, messages[1].Blocks, resolvedActionID)
+			assert.Equal(t, DeflectionStats{Answered: 1, Resolved: tt.wantResolved, Escalated: tt.wantEscalated}, metrics.Snapshot())
+			if tt.wantEscalated > 0 {
+				assert.Contains(t, messages[2].Text, "<!subteam^S0SUPPORT>")
+			}
+		})
+	}
+}
+
+func TestSupportQuestion(t *testing.T) {
+	b, api, _ := newFakeBot(t, EventHandlerArgs{DeflectionChannels: []string{"C1"}})
+	ctx := context.Background()
+	message := func(channel, text, threadTS string) *slackevents.MessageEvent {
+		return &slackevents.MessageEvent{Type: string(slackevents.Message), User: "U1", Text: text, Channel: channel, ThreadTimeStamp: threadTS}
+	}
+	assert.True(t, b.supportQuestion(ctx, api, message("C1", "vpn?", "")))
+	assert.False(t, b.supportQuestion(ctx, api, message("C2", "vpn?", "")))
+	assert.False(t, b.supportQuestion(ctx, api, message("C1", "vpn?", "1.000001")))
+	assert.False(t, b.supportQuestion(ctx, api, message("C1", "<@U0BOT> vpn?", "")))
+}
+
+func TestDeflectionStats_Rate(t *testing.T) {
+	assert.Equal(t, 0.0, DeflectionStats{Answered: 3}.Rate())
+	assert.Equal(t, 0.75, DeflectionStats{Answered: 5, Resolved: 3, Escalated: 1}.Rate())
+}
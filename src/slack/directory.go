@@ -0,0 +1,223 @@
+package slackhandler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// directoryRefresh is how long the users and user groups read from slack are used before they are read again
+	directoryRefresh = time.Hour
+	// maxDirectoryResults is the most people or owners a directory tool answers with
+	maxDirectoryResults = 20
+)
+
+// directory answers questions about who is who from slack's users and user groups and the configured owners
+type directory struct {
+	// lookup reads the slack directory, owners alone are answered without it
+	lookup bool
+	// owners are who owns what, by topic in lower case
+	owners map[string]string
+
+	mu     sync.Mutex
+	users  []slack.User
+	groups []slack.UserGroup
+	at     time.Time
+}
+
+// newDirectory creates a directory reading slack's when lookup is set and answering with owners
+func newDirectory(lookup bool, owners map[string]string) *directory {
+	d := &directory{lookup: lookup, owners: make(map[string]string, len(owners))}
+	for topic, owner := range owners {
+		d.owners[strings.ToLower(topic)] = owner
+	}
+	return d
+}
+
+// load returns the workspace's active people and user groups, reading them again once they are older than
+// directoryRefresh
+func (d *directory) load(ctx context.Context, api *slack.Client) ([]slack.User, []slack.UserGroup, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.at.IsZero() && time.Since(d.at) < directoryRefresh {
+		return d.users, d.groups, nil
+	}
+	users, err := api.GetUsersContext(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("listing users: %w", err)
+	}
+	groups, err := api.GetUserGroupsContext(ctx, slack.GetUserGroupsOptionIncludeUsers(true))
+	if err != nil {
+		return nil, nil, fmt.Errorf("listing user groups: %w", err)
+	}
+	active := make([]slack.User, 0, len(users))
+	for _, user := range users {
+		if !user.Deleted && !user.IsBot && user.ID != "USLACKBOT" {
+			active = append(active, user)
+		}
+	}
+	d.users, d.groups, d.at = active, groups, time.Now()
+	return d.users, d.groups, nil
+}
+
+// matches reports whether every word of query is in one of fields, ignoring case
+func matches(query string, fields ...string) bool {
+	words := strings.Fields(strings.ToLower(query))
+	if len(words) == 0 {
+		return false
+	}
+	text := strings.ToLower(strings.Join(fields, " "))
+	for _, word := range words {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// describeUser is how a person is shown to the model, mentioning them so slack shows their name
+func describeUser(user slack.User) string {
+	description := fmt.Sprintf("<@%s> %s", user.ID, user.RealName)
+	if user.Profile.Title != "" {
+		description += ", " + user.Profile.Title
+	}
+	return description
+}
+
+// findPeople describes the people whose name or title matches query
+func (d *directory) findPeople(ctx context.Context, api *slack.Client, query string) (string, error) {
+	users, _, err := d.load(ctx, api)
+	if err != nil {
+		return "", err
+	}
+	var found []string
+	for _, user := range users {
+		if matches(query, user.Name, user.RealName, user.Profile.DisplayName, user.Profile.Title) {
+			found = append(found, describeUser(user))
+		}
+	}
+	return listResults(found, "nobody matches "+query), nil
+}
+
+// teamMembers describes the members of the user groups whose handle, name or description matches team
+func (d *directory) teamMembers(ctx context.Context, api *slack.Client, team string) (string, error) {
+	users, groups, err := d.load(ctx, api)
+	if err != nil {
+		return "", err
+	}
+	byID := make(map[string]slack.User, len(users))
+	for _, user := range users {
+		byID[user.ID] = user
+	}
+	// "the data team" is the group named Data
+	var query []string
+	for _, word := range strings.Fields(strings.TrimPrefix(strings.ToLower(team), "@")) {
+		if word != "the" && word != "team" {
+			query = append(query, word)
+		}
+	}
+	var teams []string
+	for _, group := range groups {
+		if !matches(strings.Join(query, " "), group.Handle, group.Name, group.Description) {
+			continue
+		}
+		members := make([]string, 0, len(group.Users))
+		for _, id := range group.Users {
+			if user, ok := byID[id]; ok {
+				members = append(members, describeUser(user))
+			} else {
+				members = append(members, "<@"+id+">")
+			}
+		}
+		teams = append(teams, fmt.Sprintf("%s (<!subteam^%s>): %s", group.Name, group.ID, listResults(members, "no members")))
+	}
+	return listResults(teams, "no team matches "+team), nil
+}
+
+// findOwner describes the configured owners of the topics sharing the most words with topic
+func (d *directory) findOwner(topic string) string {
+	best, bestTopics := 0, []string(nil)
+	for owned := range d.owners {
+		shared := 0
+		for _, word := range strings.Fields(strings.ToLower(topic)) {
+			// leave out words like "of" that are part of many topics
+			if len(word) > 2 && strings.Contains(owned, word) {
+				shared++
+			}
+		}
+		if shared > 0 && shared >= best {
+			if shared > best {
+				best, bestTopics = shared, nil
+			}
+			bestTopics = append(bestTopics, owned)
+		}
+	}
+	sort.Strings(bestTopics)
+	owners := make([]string, len(bestTopics))
+	for i, owned := range bestTopics {
+		owners[i] = owned + ": " + d.owners[owned]
+	}
+	return listResults(owners, "no owner is configured for "+topic)
+}
+
+// listResults joins results one per line, at most maxDirectoryResults of them, or returns none when there are none
+func listResults(results []string, none string) string {
+	if len(results) == 0 {
+		return none
+	}
+	if len(results) > maxDirectoryResults {
+		results = append(results[:maxDirectoryResults:maxDirectoryResults], fmt.Sprintf("and %d more", len(results)-maxDirectoryResults))
+	}
+	return strings.Join(results, "\n")
+}
+
+// directoryTool is a tool taking a single string argument named param
+func directoryTool(name, description, param, paramDescription string, call func(ctx context.Context, arg string) (string, error)) chatgpt.Tool {
+	return chatgpt.Tool{
+		Definition: openai.FunctionDefinition{
+			Name:        name,
+			Description: description,
+			Parameters: map[string]any{
+				"type":       "object",
+				"properties": map[string]any{param: map[string]any{"type": "string", "description": paramDescription}},
+				"required":   []string{param},
+			},
+		},
+		Call: func(ctx context.Context, arguments string) (string, error) {
+			var args map[string]string
+			if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+				return "", fmt.Errorf("arguments must be a JSON object with a %s string: %w", param, err)
+			}
+			return call(ctx, args[param])
+		},
+	}
+}
+
+// tools returns the tools the model answers questions about people with, reading slack through api
+func (d *directory) tools(api *slack.Client) []chatgpt.Tool {
+	var tools []chatgpt.Tool
+	if d.lookup {
+		tools = append(tools,
+			directoryTool("find_people", "Finds people in the workspace whose name or job title contains every word of the query.",
+				"query", "words of a name or job title, e.g. \"data engineer\"",
+				func(ctx context.Context, query string) (string, error) { return d.findPeople(ctx, api, query) }),
+			directoryTool("team_members", "Lists the members of the workspace's teams (user groups) matching a team name or handle.",
+				"team", "a team name or handle, e.g. \"data team\" or \"@data\"",
+				func(ctx context.Context, team string) (string, error) { return d.teamMembers(ctx, api, team) }),
+		)
+	}
+	if len(d.owners) > 0 {
+		tools = append(tools, directoryTool("find_owner", "Finds who owns a service, system or area of responsibility.",
+			"topic", "what is owned, e.g. \"billing service\"",
+			func(_ context.Context, topic string) (string, error) { return d.findOwner(topic), nil }))
+	}
+	return tools
+}
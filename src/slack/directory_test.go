@@ -0,0 +1,80 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func newDirectorySlack(t *testing.T) (*slack.Client, *fake.Slack) {
+	slackServer := fake.NewSlack()
+	t.Cleanup(slackServer.Close)
+	slackServer.AddUser("U1", "Ada Lovelace", "Billing Engineer")
+	slackServer.AddUser("U2", "Grace Hopper", "Data Engineer")
+	slackServer.AddUser("U3", "Alan Turing", "Data Scientist")
+	slackServer.AddUserGroup("S1", "data", "Data", "U2", "U3")
+	slackServer.AddUserGroup("S2", "billing-oncall", "Billing on-call", "U1", "U9")
+	return slack.New("xoxb-test", slack.OptionAPIURL(slackServer.APIURL())), slackServer
+}
+
+func TestDirectoryTools(t *testing.T) {
+	api, _ := newDirectorySlack(t)
+	d := newDirectory(true, map[string]string{"Billing Service": "<@U1> in #billing", "Data warehouse": "<!subteam^S1>"})
+	tools := map[string]func(arguments string) (string, error){}
+	for _, tool := range d.tools(api) {
+		call := tool.Call
+		tools[tool.Definition.Name] = func(arguments string) (string, error) { return call(context.Background(), arguments) }
+	}
+	require.Len(t, tools, 3)
+
+	tests := []struct {
+		tool, arguments, want string
+	}{
+		{"find_people", `{"query": "data engineer"}`, "<@U2> Grace Hopper, Data Engineer"},
+		{"find_people", `{"query": "DATA"}`, "<@U2> Grace Hopper, Data Engineer\n<@U3> Alan Turing, Data Scientist"},
+		{"find_people", `{"query": "marketing"}`, "nobody matches marketing"},
+		{"team_members", `{"team": "the data team"}`, "Data (<!subteam^S1>): <@U2> Grace Hopper, Data Engineer\n<@U3> Alan Turing, Data Scientist"},
+		{"team_members", `{"team": "@billing-oncall"}`, "Billing on-call (<!subteam^S2>): <@U1> Ada Lovelace, Billing Engineer\n<@U9>"},
+		{"team_members", `{"team": "legal"}`, "no team matches legal"},
+		{"find_owner", `{"topic": "the billing service"}`, "billing service: <@U1> in #billing"},
+		{"find_owner", `{"topic": "payroll"}`, "no owner is configured for payroll"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tool+" "+tt.arguments, func(t *testing.T) {
+			got, err := tools[tt.tool](tt.arguments)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+	_, err := tools["find_people"]("data")
+	assert.ErrorContains(t, err, "arguments must be a JSON object with a query string")
+
+	assert.Len(t, newDirectory(false, map[string]string{"billing": "U1"}).tools(api), 1, "owners are answered without the slack directory")
+}
+
+// directoryModel looks up the data team before answering with what it found
+type directoryModel struct{}
+
+func (directoryModel) CreateChatCompletion(_ context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	last := req.Messages[len(req.Messages)-1]
+	message := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant}
+	if last.Role == openai.ChatMessageRoleTool {
+		message.Content = "The data team is:\n" + last.Content
+	} else {
+		message.ToolCalls = []openai.ToolCall{{ID: "call1", Type: openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: "team_members", Arguments: `{"team": "data"}`}}}
+	}
+	return openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{Message: message}}}, nil
+}
+
+func TestDirectoryAnswers(t *testing.T) {
+	api, _ := newDirectorySlack(t)
+	b := newBot(EventHandlerArgs{Logger: logger, GPTClient: directoryModel{}, DirectoryLookup: true})
+	resp, err := b.complete(context.Background(), api, "C1", "U1", []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "who's on the data team?"}})
+	require.NoError(t, err)
+	assert.Equal(t, "The data team is:\nData (<!subteam^S1>): <@U2> Grace Hopper, Data Engineer\n<@U3> Alan Turing, Data Scientist", resp.answer)
+}
@@ -0,0 +1,120 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// questionEdited regenerates the answer to a question the bot already answered once its text is edited,
+// then updates the original reply or posts a new one depending on b.onEdit
+func (b *bot) questionEdited(ctx context.Context, api *slack.Client, ev *slackevents.MessageEvent) {
+	if b.onEdit == EditIgnore || ev.Message == nil || ev.PreviousMessage == nil {
+		return
+	}
+	// unfurls and other attachment changes also arrive as edits, only a changed question matters
+	if ev.Message.BotID != "" || ev.Message.Text == ev.PreviousMessage.Text {
+		return
+	}
+	rep, ok := b.replies.Get(ev.Channel, ev.Message.TimeStamp)
+	if !ok {
+		return
+	}
+	if !b.withinEditWindow(ev) {
+		b.logger.Printf("question %s in %s was edited too late to answer again\n", ev.Message.TimeStamp, ev.Channel)
+		return
+	}
+	revised := b.prompt(ctx, api, ev.Message.Text)
+	// an edit is a new question, a harmless one may be edited into one that is refused
+	if !b.moderated(ctx, api, rep.Channel, rep.ThreadTS, ev.Message.User, revised) ||
+		!b.mayAnswer(ctx, api, rep.Channel, rep.ThreadTS, ev.Message.User) {
+		return
+	}
+	b.logger.Printf("question %s in %s was edited, regenerating answer\n", ev.Message.TimeStamp, ev.Channel)
+
+	history, ok := b.convo.ReviseQuestion(rep.ConvoKey, rep.Question, revised)
+	if !ok {
+		// the exchange was cleared or evicted, answer the edited question on its own
+		history = []string{revised}
+	}
+	resp, err := b.completeIn(ctx, api, rep.ConvoKey, rep.Channel, ev.Message.User, turns(history, openai.ChatMessageRoleUser))
+	if err != nil {
+		b.logger.Printf("Failed to get gpt3 response for edited question: %v\n", err)
+		return
+	}
+	answer := resp.stored()
+	b.convo.ReplaceMessage(rep.ConvoKey, rep.Answer, answer)
+
+	switch b.onEdit {
+	case EditUpdate:
+		_, _, _, err = api.UpdateMessage(rep.Channel, rep.ReplyTS, b.replyOptions(resp, rep.ConvoKey, ev.Message.User)...)
+	case EditReply:
+		options := b.replyOptions(resp, rep.ConvoKey, ev.Message.User)
+		if rep.ThreadTS != "" {
+			options = append(options, slack.MsgOptionTS(rep.ThreadTS))
+		}
+		_, rep.ReplyTS, err = api.PostMessage(rep.Channel, options...)
+	}
+	if err != nil {
+		b.logger.Printf("failed answering edited question: %v\n", err)
+		return
+	}
+	rep.Question, rep.Answer = revised, answer
+	b.replies.Record(ev.Message.TimeStamp, rep)
+}
+
+// questionDeleted cancels the answer to a deleted question still being answered, or forgets the exchange for a
+// deleted question the bot answered and, when b.deleteReplies is set, deletes the answer too
+func (b *bot) questionDeleted(ctx context.Context, api *slack.Client, ev *slackevents.MessageEvent) {
+	if ev.PreviousMessage == nil || ev.PreviousMessage.BotID != "" {
+		return
+	}
+	questionTS := ev.PreviousMessage.TimeStamp
+	if b.answering.cancel(ev.Channel, questionTS) {
+		b.logger.Printf("question %s in %s was deleted, cancelling its answer\n", questionTS, ev.Channel)
+		return
+	}
+	rep, ok := b.replies.Get(ev.Channel, questionTS)
+	if !ok {
+		return
+	}
+	b.logger.Printf("question %s in %s was deleted, forgetting its answer\n", questionTS, ev.Channel)
+	b.replies.Delete(ev.Channel, questionTS)
+	b.convo.RemoveExchange(rep.ConvoKey, rep.Question, rep.Answer)
+	if !b.deleteReplies {
+		return
+	}
+	if _, _, err := api.DeleteMessageContext(ctx, rep.Channel, rep.ReplyTS); err != nil {
+		b.logger.Printf("failed deleting answer to deleted question: %v\n", err)
+	}
+}
+
+// withinEditWindow reports whether the edit of ev came within b.editWindow of the question being asked. Edits
+// whose time is unknown are answered again.
+func (b *bot) withinEditWindow(ev *slackevents.MessageEvent) bool {
+	if b.editWindow <= 0 {
+		return true
+	}
+	editedTS := ev.EventTimeStamp
+	if ev.Message.Edited != nil {
+		editedTS = ev.Message.Edited.TimeStamp
+	}
+	asked, ok := slackTime(ev.Message.TimeStamp)
+	edited, editedOK := slackTime(editedTS)
+	return !ok || !editedOK || edited.Sub(asked) <= b.editWindow
+}
+
+// slackTime returns the time of a slack timestamp such as 1718000000.000100
+func slackTime(ts string) (time.Time, bool) {
+	seconds, fraction, _ := strings.Cut(ts, ".")
+	unix, err := strconv.ParseInt(seconds, 10, 64)
+	if err != nil || ts == "" {
+		return time.Time{}, false
+	}
+	micros, _ := strconv.ParseInt(fraction, 10, 64)
+	return time.Unix(unix, micros*int64(time.Microsecond)), true
+}
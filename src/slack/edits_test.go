@@ -0,0 +1,229 @@
+package slackhandler
+
+import (
+	"context"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// newFakeBot creates a bot and slack client talking to fake slack and openai servers
+func newFakeBot(t *testing.T, args EventHandlerArgs) (*bot, *slack.Client, *fake.Slack) {
+	slackServer := fake.NewSlack()
+	gptServer := fake.NewOpenAI(0)
+	t.Cleanup(slackServer.Close)
+	t.Cleanup(gptServer.Close)
+
+	gptConfig := openai.DefaultConfig("sk-test")
+	gptConfig.BaseURL = gptServer.URL()
+	args.Logger = logger
+	args.GPTClient = openai.NewClientWithConfig(gptConfig)
+	api := slack.New("xoxb-test", slack.OptionAPIURL(slackServer.APIURL()))
+	return newBot(args), api, slackServer
+}
+
+func editEvent(channel, ts, previous, text string) *slackevents.MessageEvent {
+	return &slackevents.MessageEvent{
+		Type:            string(slackevents.Message),
+		SubType:         "message_changed",
+		Channel:         channel,
+		Message:         &slackevents.MessageEvent{User: "U1", Text: text, TimeStamp: ts},
+		PreviousMessage: &slackevents.MessageEvent{User: "U1", Text: previous, TimeStamp: ts},
+	}
+}
+
+func TestQuestionEdited(t *testing.T) {
+	tests := []struct {
+		name         string
+		onEdit       EditAction
+		wantMessages []string
+	}{
+		{"ignore", EditIgnore, []string{"fake answer to: wat is go"}},
+		{"update", EditUpdate, []string{"fake answer to: what is go"}},
+		{"reply", EditReply, []string{"fake answer to: wat is go", "fake answer to: what is go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, api, slackServer := newFakeBot(t, EventHandlerArgs{OnQuestionEdit: tt.onEdit})
+			ctx := context.Background()
+			b.handleMessage(ctx, api, &slackevents.MessageEvent{
+				Type: string(slackevents.Message), User: "U1", Text: "wat is go", Channel: "D1", TimeStamp: "1.000001",
+			})
+			b.handleMessage(ctx, api, editEvent("D1", "1.000001", "wat is go", "what is go"))
+
+			var texts []string
+			for _, m := range slackServer.Messages() {
+				texts = append(texts, m.Text)
+			}
+			require.Len(t, texts, len(tt.wantMessages))
+			for i, want := range tt.wantMessages {
+				assert.Contains(t, texts[i], want)
+			}
+			if tt.onEdit != EditIgnore {
+				history, _ := b.convo.Get("D1")
+				assert.Equal(t, []string{"what is go", "fake answer to: what is go"}, history)
+			}
+		})
+	}
+}
+
+func TestQuestionEdited_UnansweredOrUnchanged(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{OnQuestionEdit: EditReply})
+	ctx := context.Background()
+	// a question the bot never answered
+	b.handleMessage(ctx, api, editEvent("D1", "9.000001", "old", "new"))
+	// an edit that leaves the text alone, e.g. a link unfurl
+	b.handleMessage(ctx, api, &slackevents.MessageEvent{
+		Type: string(slackevents.Message), User: "U1", Text: "hi", Channel: "D1", TimeStamp: "1.000001",
+	})
+	b.handleMessage(ctx, api, editEvent("D1", "1.000001", "hi", "hi"))
+	assert.Len(t, slackServer.Messages(), 1)
+}
+
+func TestQuestionEdited_Window(t *testing.T) {
+	tests := []struct {
+		name     string
+		edited   string
+		wantText string
+	}{
+		{"within the window", "1700000600.000200", "fake answer to: what is go"},
+		{"too late", "1700007200.000200", "fake answer to: wat is go"},
+		{"unknown edit time", "", "fake answer to: what is go"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, api, slackServer := newFakeBot(t, EventHandlerArgs{OnQuestionEdit: EditUpdate, QuestionEditWindow: time.Hour})
+			ctx := context.Background()
+			b.handleMessage(ctx, api, &slackevents.MessageEvent{
+				Type: string(slackevents.Message), User: "U1", Text: "wat is go", Channel: "D1", TimeStamp: "1700000000.000100",
+			})
+			ev := editEvent("D1", "1700000000.000100", "wat is go", "what is go")
+			if tt.edited != "" {
+				ev.Message.Edited = &slackevents.Edited{User: "U1", TimeStamp: tt.edited}
+			}
+			b.handleMessage(ctx, api, ev)
+
+			messages := slackServer.Messages()
+			require.Len(t, messages, 1)
+			assert.Contains(t, messages[0].Text, tt.wantText)
+		})
+	}
+}
+
+func TestConversation_ReviseQuestion(t *testing.T) {
+	c := newConversation(0, 0)
+	for _, m := range []string{"q1", "a1", "q2", "a2"} {
+		c.UpdateConversation("k", m)
+	}
+	before, _ := c.Get("k")
+
+	history, ok := c.ReviseQuestion("k", "q1", "q1 revised")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"q1 revised"}, history)
+	assert.True(t, c.ReplaceMessage("k", "a1", "a1 revised"))
+	after, _ := c.Get("k")
+	assert.Equal(t, []string{"q1 revised", "a1 revised", "q2", "a2"}, after)
+	// copies handed out earlier are never modified
+	assert.Equal(t, []string{"q1", "a1", "q2", "a2"}, before)
+
+	_, ok = c.ReviseQuestion("k", "missing", "x")
+	assert.False(t, ok)
+	_, ok = c.ReviseQuestion("other", "q1", "x")
+	assert.False(t, ok)
+	assert.Equal(t, 1, c.Len())
+}
+
+func deleteEvent(channel, ts, text string) *slackevents.MessageEvent {
+	return &slackevents.MessageEvent{
+		Type:            string(slackevents.Message),
+		SubType:         "message_deleted",
+		Channel:         channel,
+		PreviousMessage: &slackevents.MessageEvent{User: "U1", Text: text, TimeStamp: ts},
+	}
+}
+
+func TestQuestionDeleted(t *testing.T) {
+	for _, deleteReplies := range []bool{false, true} {
+		b, api, slackServer := newFakeBot(t, EventHandlerArgs{DeleteRepliesWithQuestion: deleteReplies})
+		ctx := context.Background()
+		for i, q := range []string{"first", "second"} {
+			b.handleMessage(ctx, api, &slackevents.MessageEvent{
+				Type: string(slackevents.Message), User: "U1", Text: q, Channel: "D1", TimeStamp: fmt.Sprintf("1.00000%d", i),
+			})
+		}
+		b.handleMessage(ctx, api, deleteEvent("D1", "1.000000", "first"))
+
+		history, _ := b.convo.Get("D1")
+		require.Len(t, history, 2)
+		assert.Equal(t, "second", history[0])
+		_, ok := b.replies.Get("D1", "1.000000")
+		assert.False(t, ok)
+		if deleteReplies {
+			assert.Len(t, slackServer.Messages(), 1)
+		} else {
+			assert.Len(t, slackServer.Messages(), 2)
+		}
+	}
+}
+
+// blockingModel answers nothing until the question is cancelled
+type blockingModel struct {
+	started chan struct{}
+}
+
+func (m blockingModel) CreateChatCompletion(ctx context.Context, _ openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	m.started <- struct{}{}
+	<-ctx.Done()
+	return openai.ChatCompletionResponse{}, ctx.Err()
+}
+
+func TestQuestionDeletedWhileAnswered(t *testing.T) {
+	slackServer := fake.NewSlack()
+	t.Cleanup(slackServer.Close)
+	api := slack.New("xoxb-test", slack.OptionAPIURL(slackServer.APIURL()))
+	model := blockingModel{started: make(chan struct{})}
+	b := newBot(EventHandlerArgs{Logger: logger, GPTClient: model, ThinkingMessage: DefaultThinkingMessage})
+	ctx := context.Background()
+
+	answered := make(chan struct{})
+	go func() {
+		defer close(answered)
+		b.handleMessage(ctx, api, &slackevents.MessageEvent{
+			Type: string(slackevents.Message), User: "U1", Text: "a long question", Channel: "D1", TimeStamp: "1.000001",
+		})
+	}()
+	<-model.started
+	require.Len(t, slackServer.Messages(), 1, "the placeholder")
+	b.handleMessage(ctx, api, deleteEvent("D1", "1.000001", "a long question"))
+	<-answered
+
+	assert.Empty(t, slackServer.Messages(), "neither the placeholder nor an answer is left")
+	_, ok := b.convo.Get("D1")
+	assert.False(t, ok)
+	_, ok = b.replies.Get("D1", "1.000001")
+	assert.False(t, ok)
+	assert.False(t, b.answering.cancel("D1", "1.000001"))
+}
+
+func TestConversation_RemoveExchange(t *testing.T) {
+	c := newConversation(0, 0)
+	for _, m := range []string{"q1", "a1", "q2", "a2"} {
+		c.UpdateConversation("k", m)
+	}
+	assert.True(t, c.RemoveExchange("k", "q2", "a2"))
+	history, _ := c.Get("k")
+	assert.Equal(t, []string{"q1", "a1"}, history)
+	assert.False(t, c.RemoveExchange("k", "missing", "a1"))
+	// an exchange whose answer was never stored only loses the question
+	assert.True(t, c.RemoveExchange("k", "q1", "other"))
+	history, _ = c.Get("k")
+	assert.Equal(t, []string{"a1"}, history)
+	assert.True(t, c.RemoveExchange("k", "a1", ""))
+	assert.Equal(t, 0, c.Len())
+}
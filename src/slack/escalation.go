@@ -0,0 +1,115 @@
+package slackhandler
+
+import (
+	"context"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+)
+
+// escalateActionID identifies the button on answers that hands the conversation over to a human
+const escalateActionID = "slackgpt_escalate"
+
+// escalation is where conversations are handed over to humans
+type escalation struct {
+	// group is the ID of the user group tagged on escalations
+	group string
+	// channel escalations are posted to with a link to the conversation, the conversation's thread when empty
+	channel string
+}
+
+// replyOptions posts resp as the answer to asker in the conversation stored under convoKey, with thumbs up and
+// down buttons when feedback is collected, regenerate, continue and delete buttons when answer buttons are on, an
+// escalate button when escalation is configured and a menu to try again differently when branch variants are
+func (b *bot) replyOptions(resp completion, convoKey, asker string) []slack.MsgOption {
+	var buttons []slack.BlockElement
+	if b.feedback != nil {
+		buttons = append(buttons, feedbackButtons(convoKey, resp.model)...)
+	}
+	if b.answerButtons {
+		buttons = append(buttons, answerButtons(convoKey, asker)...)
+	}
+	if b.escalation != nil {
+		buttons = append(buttons, slack.NewButtonBlockElement(escalateActionID, convoKey, slack.NewTextBlockObject(slack.PlainTextType, "Ask a human", false, false)))
+	}
+	if b.branches != nil {
+		buttons = append(buttons, b.branches.menu(convoKey))
+	}
+	return answerOptions(resp, buttons...)
+}
+
+// answerOptions posts resp, as blocks followed by buttons when it is rendered with Block Kit or there are buttons.
+// The text stays the answer in a code block, which notifications show and the conversation is recovered from.
+func answerOptions(resp completion, buttons ...slack.BlockElement) []slack.MsgOption {
+	options := []slack.MsgOption{slack.MsgOptionText(resp.text(), false)}
+	var blocks []slack.Block
+	if resp.blocks {
+		blocks = answerBlocks(resp)
+	}
+	if len(blocks) == 0 && len(buttons) > 0 {
+		if resp.note != "" {
+			blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, resp.note, false, false), nil, nil))
+		}
+		if resp.answer != "" {
+			for _, part := range splitResponse(resp.answer, maxSectionText) {
+				blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, formatResponse(part), false, false), nil, nil))
+			}
+		}
+		if resp.footer != "" {
+			blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, resp.footer, false, false)))
+		}
+	}
+	if len(buttons) > 0 {
+		blocks = append(blocks, slack.NewActionBlock("slackgpt_answer_actions", buttons...))
+	}
+	if len(blocks) == 0 {
+		return options
+	}
+	return append(options, slack.MsgOptionBlocks(blocks...))
+}
+
+// escalate tags the on-call group in the conversation of the answer whose escalate button was clicked,
+// with a summary of what the user needs
+func (b *bot) escalate(ctx context.Context, api *slack.Client, callback *slack.InteractionCallback, action *slack.BlockAction) {
+	if b.escalation == nil {
+		return
+	}
+	summary := "There is no conversation history left to summarize."
+	if history, ok := b.convo.Get(action.Value); ok && len(history) > 0 {
+		var err error
+		if summary, err = chatgpt.GetSummary(b.gptClient, ctx, turns(history, openai.ChatMessageRoleAssistant)); err != nil {
+			b.logger.Printf("failed summarizing conversation for escalation: %v\n", err)
+			summary = "The conversation could not be summarized."
+		}
+	}
+	channel, user := callback.Channel.ID, callback.User.ID
+	threadTS := callback.Message.ThreadTimestamp
+	if threadTS == "" {
+		threadTS = callback.Message.Timestamp
+	}
+	text := fmt.Sprintf("<!subteam^%s> <@%s> would like a human to take over.\n*Summary:* %s",
+		b.escalation.group, user, slackEscaper.Replace(summary))
+
+	target, options := channel, []slack.MsgOption{slack.MsgOptionTS(threadTS)}
+	if b.escalation.channel != "" {
+		link, err := api.GetPermalinkContext(ctx, &slack.PermalinkParameters{Channel: channel, Ts: callback.Message.Timestamp})
+		if err != nil {
+			b.logger.Printf("failed linking escalated conversation: %v\n", err)
+		} else {
+			text += "\n*Conversation:* " + link
+		}
+		target, options = b.escalation.channel, nil
+	}
+	if _, _, err := api.PostMessageContext(ctx, target, append(options, slack.MsgOptionText(text, false))...); err != nil {
+		b.logger.Printf("failed escalating conversation: %v\n", err)
+		return
+	}
+	b.logger.Printf("escalated conversation %v of %v to %v\n", action.Value, user, b.escalation.group)
+	_, err := api.PostEphemeralContext(ctx, channel, user,
+		slack.MsgOptionText(fmt.Sprintf("I've asked <!subteam^%s> to help, someone will follow up soon.", b.escalation.group), false),
+		slack.MsgOptionTS(threadTS))
+	if err != nil {
+		b.logger.Printf("failed confirming escalation: %v\n", err)
+	}
+}
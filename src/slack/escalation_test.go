@@ -0,0 +1,68 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// escalateCallback is a click on the escalate button of reply in channel
+func escalateCallback(channel string, reply slack.Msg, convoKey string) *slack.InteractionCallback {
+	callback := &slack.InteractionCallback{
+		Type:    slack.InteractionTypeBlockActions,
+		User:    slack.User{ID: "U1"},
+		Channel: slack.Channel{GroupConversation: slack.GroupConversation{Conversation: slack.Conversation{ID: channel}}},
+	}
+	callback.Message.Msg = reply
+	callback.ActionCallback.BlockActions = []*slack.BlockAction{{ActionID: escalateActionID, Value: convoKey}}
+	return callback
+}
+
+func TestEscalate(t *testing.T) {
+	tests := []struct {
+		name        string
+		channel     string
+		wantChannel string
+		wantThread  bool
+	}{
+		{"in thread", "", "C1", true},
+		{"in escalation channel", "C0ONCALL", "C0ONCALL", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, api, slackServer := newFakeBot(t, EventHandlerArgs{EscalationGroup: "S0ONCALL", EscalationChannel: tt.channel})
+			ctx := context.Background()
+			b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> my vpn is broken", Channel: "C1", TimeStamp: "1.000001"})
+			answers := slackServer.Messages()
+			require.Len(t, answers, 1)
+			assert.Contains(t, answers[0].Blocks, escalateActionID)
+
+			b.handleInteraction(ctx, api, escalateCallback("C1", slack.Msg{Timestamp: answers[0].TS, ThreadTimestamp: "1.000001"}, "1.000001C1"))
+			messages := slackServer.Messages()
+			require.Len(t, messages, 2)
+			escalation := messages[1]
+			assert.Equal(t, tt.wantChannel, escalation.Channel)
+			assert.Contains(t, escalation.Text, "<!subteam^S0ONCALL> <@U1>")
+			// the fake openai server echoes the conversation it was asked to summarize
+			assert.Contains(t, escalation.Text, "my vpn is broken")
+			if tt.wantThread {
+				assert.Equal(t, "1.000001", escalation.ThreadTS)
+			} else {
+				assert.Contains(t, escalation.Text, "https://fake.slack.com/archives/C1/p")
+			}
+			confirmations := slackServer.Ephemerals()
+			require.Len(t, confirmations, 1)
+			assert.Equal(t, "U1", confirmations[0].User)
+		})
+	}
+}
+
+func TestReplyOptions_WithoutEscalation(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{})
+	b.answerMention(context.Background(), api, &slackevents.AppMentionEvent{User: "U1", Text: "hi", Channel: "C1", TimeStamp: "1.000001"})
+	require.Len(t, slackServer.Messages(), 1)
+	assert.Empty(t, slackServer.Messages()[0].Blocks)
+}
@@ -3,19 +3,312 @@ package slackhandler
 
 import (
 	"context"
-	"github.com/sashabaranov/go-openai"
+	"github.com/chikamif/slackgpt/src/cache"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/chikamif/slackgpt/src/metrics"
+	"github.com/chikamif/slackgpt/src/tracing"
+	"github.com/chikamif/slackgpt/src/webhook"
 	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
 	"github.com/slack-go/slack/socketmode"
+	"io"
 	"log"
+	"time"
 )
 
+// EventHandlerArgs configures the handler. Only SlackClient and GPTClient are required, the zero value of every
+// other field turns its feature off or picks its default.
 type EventHandlerArgs struct {
+	// Logger receives the handler's logs, which are discarded when it is nil
 	Logger           *log.Logger
 	SlackClient      *slack.Client
 	SocketModeClient *socketmode.Client
-	GPTClient        *openai.Client
+	GPTClient        chatgpt.ChatProvider
 	Context          context.Context
+	// MaxConversations and MaxConversationBytes bound the in-memory conversation store, 0 disables a bound
+	MaxConversations     int
+	MaxConversationBytes int64
+	// Conversations keeps conversation histories so they survive restarts, the in-memory store caches it.
+	// Conversations are only kept in memory when it is nil.
+	Conversations ConversationStore
+	// Caches receives every in-memory cache the handler creates so their stats can be reported, may be nil
+	Caches *cache.Registry
+	// OnQuestionEdit is what happens to the answer when a question is edited, defaults to EditIgnore
+	OnQuestionEdit EditAction
+	// QuestionEditWindow is how long after a question is asked edits to it are answered again, 0 for any time
+	QuestionEditWindow time.Duration
+	// DeleteRepliesWithQuestion deletes the bot's answer when the question it answers is deleted.
+	// The exchange is removed from the conversation store either way.
+	DeleteRepliesWithQuestion bool
+	// IgnoredUsers are never answered, e.g. integrations that post as regular users. Bot IDs ignore bots.
+	IgnoredUsers []string
+	// AllowedChannels are the only channels questions are answered in, and direct messages, when there are any.
+	// RequiredUserGroup, when set, only answers its members; it needs the usergroups:read scope.
+	AllowedChannels   []string
+	RequiredUserGroup string
+	// NoRetentionChannels are channels nothing of the exchanges in is kept, e.g. #security: their conversations are
+	// not stored, recorded for edits, titled or logged, only counted in metrics and limits. A question asked
+	// "off the record:" is treated the same anywhere.
+	NoRetentionChannels []string
+	// AllowBots answers other bots, at most BotLoopLimit times in a row per conversation before a human
+	// takes part again. The bot never answers itself.
+	AllowBots    bool
+	BotLoopLimit int
+	// MentionMode is how user mentions in questions are turned into prompt text, defaults to MentionStrip.
+	// MentionResolve needs the users:read scope.
+	MentionMode MentionMode
+	// ExpandEmoji replaces emoji shortcodes in questions with the emoji they stand for
+	ExpandEmoji bool
+	// RequireConsent sends users an onboarding message they have to agree to before their first question is
+	// answered. Consents are kept in Consents, or in memory when it is nil. ConsentText replaces
+	// DefaultConsentText when set.
+	RequireConsent bool
+	Consents       *ConsentStore
+	ConsentText    string
+	// UsagePolicy, when set, has to be acknowledged in a modal before questions are answered, again whenever
+	// its text changes and once an acknowledgement is older than PolicyAckInterval, 0 never expires them.
+	// Acknowledgements are kept in PolicyAcks, or in memory when it is nil.
+	UsagePolicy       string
+	PolicyAckInterval time.Duration
+	PolicyAcks        *PolicyStore
+	// Hedge asks the model to rate its confidence in answers and caveats or refuses answers rated below
+	// ConfidenceThreshold (0-100), pointing users to HumanChannel, a channel ID, when set. It only applies in
+	// HedgeChannels, or everywhere when that is empty. Defaults to HedgeOff.
+	Hedge               HedgeAction
+	ConfidenceThreshold int
+	HedgeChannels       []string
+	HumanChannel        string
+	// EscalationGroup, a user group ID, adds an "Ask a human" button to answers that tags the group with a
+	// summary of the conversation, in EscalationChannel with a link to the conversation when set and in the
+	// conversation's thread otherwise
+	EscalationGroup   string
+	EscalationChannel string
+	// DeflectionChannels are support channels where every new question is answered from KnowledgeBase with
+	// buttons for the asker to mark it resolved or ask for the support team, the EscalationGroup. Outcomes
+	// are counted in DeflectionMetrics, which may be nil.
+	DeflectionChannels []string
+	KnowledgeBase      string
+	DeflectionMetrics  *DeflectionMetrics
+	// SystemPrompt sets the bot's persona and language, defaults to chatgpt.DefaultSystemPrompt.
+	// ChannelSystemPrompts override it by channel ID.
+	SystemPrompt         string
+	ChannelSystemPrompts map[string]string
+	// Channels change the model, temperature, answer length and system prompt of questions by channel ID
+	Channels map[string]ChannelSettings
+	// TitleThreads generates a short title for every thread after the bot's first answer in it, so past
+	// conversations can be listed and searched
+	TitleThreads bool
+	// Prompts keeps the versions of the system prompts, the configured prompts are recorded in it as they
+	// change. In memory when nil.
+	Prompts *PromptStore
+	// AdminUsers may list, set and roll back the system prompts with "prompt" commands
+	AdminUsers []string
+	// BranchVariants are offered in a "Try again differently" menu on answers, which forks the conversation
+	// into a new branch answered with the chosen variant. Needs Interactivity enabled.
+	BranchVariants []BranchVariant
+	// FAQs are answered directly when a new question's embedding is at least FAQThreshold similar to theirs,
+	// defaults to DefaultFAQThreshold. Admins register them with "faq" commands. In memory when nil. Needs a
+	// GPTClient that embeds text with EmbeddingModel, chatgpt.DefaultEmbeddingModel when empty.
+	FAQs           *FAQStore
+	FAQThreshold   float64
+	EmbeddingModel string
+	// Feedback keeps the thumbs up and down users give answers, with the question, the answer and the model,
+	// reported to admins with the /gpt-feedback-report command. Answers have no thumbs when nil.
+	Feedback *FeedbackStore
+	// Usage keeps the tokens every answer took and what they cost at ModelPrices, by month, user and channel,
+	// reported with the /gpt-usage command. Usage is not tracked when nil. ModelPrices default to
+	// DefaultModelPrices; models without a price cost nothing.
+	Usage       *UsageStore
+	ModelPrices map[string]ModelPrice
+	// MonthlyBudget and ChannelBudgets, by channel, limit the tokens and cost of answers per calendar month in
+	// UTC, as tracked in Usage. Once one is used up, questions it covers are declined until the next month and
+	// BudgetAlertChannel, when set, is told. TeamBudgets, by user group, limit what the members of a team spend
+	// together; they need the usergroups:read scope and admins can override them with the /gpt-budget command.
+	MonthlyBudget      Budget
+	ChannelBudgets     map[string]Budget
+	TeamBudgets        map[string]TeamBudget
+	BudgetAlertChannel string
+	// AdminChannel is told about model outages, authentication failures and repeated rate limits, each kind at
+	// most once every 15 minutes, with how often it happened in between. Errors are only logged when empty.
+	AdminChannel string
+	// SharedChannelPolicy applies to questions in channels shared with other organizations through Slack Connect,
+	// whose people see the answers. They are answered like any other when nil. Needs the channels:read,
+	// groups:read, im:read and mpim:read scopes.
+	SharedChannelPolicy *SharedChannelPolicy
+	// BookmarkChannels are channels whose bookmarked web pages ground answers to questions asked in them, the
+	// parts most similar to the question when GPTClient embeds text. Pages are fetched again after
+	// BookmarkRefresh, DefaultBookmarkRefresh when 0. Needs the bookmarks:read scope.
+	BookmarkChannels []string
+	BookmarkRefresh  time.Duration
+	// DirectoryLookup lets the model look up people and the members of user groups in the workspace to answer
+	// questions like "who's on the data team?". Needs the users:read and usergroups:read scopes. Owners, who owns
+	// what by topic, e.g. "billing service", answer questions like "who owns the billing service?".
+	DirectoryLookup bool
+	Owners          map[string]string
+	// BuiltinTools are the names of the built-in tools the model may call while answering: current_time,
+	// calculate and slack_user, which needs the users:read scope. Tools are Go functions of the embedding program
+	// it may call besides them. Both need a provider with tool calls.
+	BuiltinTools []string
+	Tools        []chatgpt.Tool
+	// MaxContextTokens is how many tokens a question, the conversation before it and the answer may take up
+	// together, the oldest messages of longer conversations are left out. 0 is the context window of the model.
+	// Tokens are counted with CountTokens, chatgpt.EstimateTokens when nil.
+	MaxContextTokens int
+	CountTokens      chatgpt.TokenCounter
+	// Clarify has the model check questions for ambiguity before answering them, asking what ambiguous ones
+	// mean with buttons offering their likely meanings
+	Clarify bool
+	// LowPriorityChannels are channels whose questions are queued and answered in batches during the
+	// OffPeakWindows, any time when empty, at the lower price of the provider's batches when it has them. Either
+	// also lets questions be queued with "/gpt --later". The queue is kept in BatchQueue, in memory when nil.
+	// Questions asked while the GPTClient is down for maintenance with no fallback, see chatgpt.WithMaintenance,
+	// are queued too, with a BatchQueue on its own when neither is set, and sent once it is over.
+	// Needs a long-running handler, EventHandler or HTTPEventHandler, to send and answer the queue.
+	LowPriorityChannels []string
+	OffPeakWindows      []OffPeakWindow
+	BatchQueue          *BatchQueue
+	// ThinkingMessage, e.g. DefaultThinkingMessage, is posted as soon as a question is to be answered and replaced
+	// by the answer, so users know they were heard. Answers are only posted once ready when empty.
+	ThinkingMessage string
+	// TriggerReaction, an emoji name such as robot_face without colons, asks about the message it is added to as if
+	// the user who added it mentioned the bot with the message's text, in its thread. Needs the reaction_added
+	// event and the reactions:read scope; reactions trigger nothing when empty.
+	TriggerReaction string
+	// BlockKit renders answers with Block Kit: their markdown converted to mrkdwn in sections, code blocks in
+	// sections of their own, and below a divider the model that answered and the tokens it took. Answers are
+	// posted in a code block otherwise.
+	BlockKit bool
+	// AnswerButtons adds buttons to answers to regenerate them, have the model continue them and, for the user who
+	// asked, delete them
+	AnswerButtons bool
+	// Images lets users draw pictures with the /imagine command and the draw command, with ImageModel and
+	// ImageSize or images.DefaultModel and images.DefaultSize when they are empty. Needs a GPTClient that
+	// creates images and the files:write scope.
+	Images     bool
+	ImageModel string
+	ImageSize  string
+	// Vision has VisionModel, chatgpt.DefaultVisionModel when empty, look at the images attached to questions.
+	// Needs the files:read scope.
+	Vision      bool
+	VisionModel string
+	// Transcribe lets users transcribe voice messages, videos and recordings with the transcribe command, with
+	// TranscriptionModel or audio.DefaultModel when it is empty. Needs a GPTClient that transcribes audio and
+	// the files:read and files:write scopes.
+	Transcribe         bool
+	TranscriptionModel string
+	// Forms are filled in with the model's help through modals, asked for by mentioning the bot with
+	// "form <name>". Needs Interactivity enabled.
+	Forms []Form
+	// Webhooks delivers the filled in forms to their Webhook in the background, retrying failed deliveries. One
+	// with the default retries, signing nothing, is used when it is nil.
+	Webhooks *webhook.Sender
+	// ApprovalChannels are broadcast channels whose answers are only posted once approved. The drafts are posted
+	// with approve, edit and reject buttons to ApprovalReviewChannel, or shown to their asker alone when it is
+	// empty. Needs Interactivity enabled.
+	ApprovalChannels      []string
+	ApprovalReviewChannel string
+	// Schedules keeps the posts users drafted with the schedule command and scheduled with chat.scheduleMessage,
+	// nil disables the command. Needs Interactivity enabled, and the channels:read and groups:read scopes to
+	// check users are members of the channels they post to.
+	Schedules *ScheduleStore
+	// ActionItems keeps the action items found in the summaries of transcripts and threads by channel, listed with
+	// "/gpt actions" and posted with buttons to mark them done or be reminded of them. nil disables them. Needs
+	// Interactivity enabled.
+	ActionItems *ActionItemStore
+	// UserSettings keeps what users chose in the App Home tab: the language they are answered in, their persona
+	// among the BranchVariants with a system prompt, and whether their questions are off the record or private.
+	// The tab also shows their spend this month when usage is tracked. nil disables the tab. Needs the
+	// app_home_opened event and Interactivity enabled.
+	UserSettings *UserSettingsStore
+	// UserRateLimit and ChannelRateLimit are how many questions a user and a channel may ask per RateLimitWindow,
+	// in bursts of up to as many, before being told when they can ask again. 0 disables a limit.
+	UserRateLimit    int
+	ChannelRateLimit int
+	RateLimitWindow  time.Duration
+	// Moderation checks questions with the moderation endpoint before answering them. Those flagged in a
+	// category of ModerationBlock, every category not in ModerationWarn when nil, are refused, those flagged
+	// in one of ModerationWarn are answered with a warning. The categories are chatgpt.ModerationCategories.
+	Moderation      bool
+	ModerationBlock []string
+	ModerationWarn  []string
+	// ModelRoutes pick the model questions are answered with by their task and the size of their prompt, the
+	// first matching route wins. Questions matching none are answered by the default model.
+	ModelRoutes []chatgpt.Route
+	// TriageModel, a small and cheap model, classifies questions as smalltalk, code, document, tools or chat
+	// questions before they are answered. Their task picks their route, and smalltalk and code are answered
+	// without grounding or tools. Questions are not triaged when empty.
+	TriageModel string
+	// OverrideTiers let their users change the model, temperature and answer length of a single question with
+	// inline parameters such as "[model=gpt-4o temp=0.9]", nobody may when empty
+	OverrideTiers []OverrideTier
+	// ModelAllowlist are the models AdminUsers may switch channels to at runtime with /gpt-model, kept in
+	// Conversations when set. Channels cannot be switched when empty.
+	ModelAllowlist []string
+	// Installations keeps the bot tokens of the workspaces the app was installed in through OAuth, whose events
+	// are answered with clients NewSlackClient creates for their token, slack.New when nil. Events from other
+	// workspaces are answered with SlackClient. With OAuth set, HTTPEventHandler serves the installation pages.
+	// Installations are kept in memory when nil. Socket mode only answers SlackClient's workspace.
+	Installations  *InstallationStore
+	NewSlackClient func(token string) *slack.Client
+	OAuth          OAuth
+	// DrainTimeout is how long events being handled when Context is cancelled may take to finish, their
+	// completions and replies, before they are cancelled too. 0 cancels them right away.
+	DrainTimeout time.Duration
+	// Status is updated with the handler's queue depth and in-flight events for diagnostics, may be nil
+	Status *HandlerStatus
+	// Metrics counts the events received and how long they took to handle, may be nil
+	Metrics *metrics.Metrics
+	// LoadStatusChannels get a status message showing whether the bot is idle, busy handling LoadBusyThreshold
+	// events or more, or paused for maintenance or shutdown, updated every LoadStatusInterval. LoadPresence also
+	// sets the bot away while it is paused. The load is measured with Status.
+	LoadStatusChannels []string
+	LoadPresence       bool
+	LoadBusyThreshold  int
+	LoadStatusInterval time.Duration
+	// Tracer traces the handling of every event, the model's requests and the replies posted under it, with
+	// SlackClient's requests traced by tracing.Transport. Nothing is traced when it is nil.
+	Tracer *tracing.Tracer
+	// Middlewares wrap the handling of every event after the built-in ones recovering from panics, recording the
+	// status and metrics, skipping duplicates, dropping the events of IgnoredUsers, tracing and logging
+	Middlewares []Middleware
+	// SeenEvents remembers the events handled for DedupTTL, an hour when 0, so that those slack delivers again
+	// are skipped. They are remembered in memory when it is nil.
+	SeenEvents SeenEvents
+	DedupTTL   time.Duration
+	// QualitySampleRate is the share of answers, from 0 to 1, a judge model scores on accuracy, tone and policy
+	// compliance in the background, recording the scores in Metrics. The judge is QualityJudgeModel, the default
+	// model when it is empty.
+	QualitySampleRate float64
+	QualityJudgeModel string
+	// MaxConcurrentRequests bounds the questions answered by the model at once, with up to RequestQueueSize more
+	// waiting for their turn and the rest answered that the bot is busy. 0 does not bound them.
+	MaxConcurrentRequests int
+	RequestQueueSize      int
+	// CommandAliases are other names for the keywords questions start with and the subcommands of slash
+	// commands, by the name they stand for, e.g. "要約": "summarize", so that workspaces can use them in their
+	// language
+	CommandAliases map[string]string
+}
+
+// withDefaults returns args with a Logger discarding logs, a background Context and a default webhook sender when
+// they are nil, and the default load status interval and dedup TTL when they are not set
+func (e EventHandlerArgs) withDefaults() EventHandlerArgs {
+	if e.Logger == nil {
+		e.Logger = log.New(io.Discard, "", 0)
+	}
+	if e.Context == nil {
+		e.Context = context.Background()
+	}
+	if e.LoadStatusInterval <= 0 {
+		e.LoadStatusInterval = defaultLoadStatusInterval
+	}
+	if e.DedupTTL <= 0 {
+		e.DedupTTL = defaultDedupTTL
+	}
+	if e.Webhooks == nil {
+		e.Webhooks = webhook.New(webhook.Options{Logger: e.Logger})
+	}
+	return e
 }
 
 // NewSocketmodeHandler returns a new instance of a socketmode.SocketmodeHandler
@@ -23,30 +316,86 @@ func (e *EventHandlerArgs) NewSocketmodeHandler() *socketmode.SocketmodeHandler
 	return socketmode.NewSocketmodeHandler(e.SocketModeClient)
 }
 
-// EventHandler handles slack events
+// EventHandler handles slack events until args.Context is cancelled or the socketmode connection
+// fails, then waits for every in-flight event handler to return, cancelling them after args.DrainTimeout
 func EventHandler(args EventHandlerArgs, handler *socketmode.SocketmodeHandler) error {
+	args = args.withDefaults()
+	ctx := args.Context
+	work, stopWork := drainContext(ctx, args.DrainTimeout, args.Logger)
+	defer stopWork()
 
-	convo := newConversation()
+	b := newBot(args)
 
-	// should be a primary middleware handler, and these handle more granular events
-	handler.Handle(socketmode.EventTypeConnecting, func(evt *socketmode.Event, client *socketmode.Client) {
-		middlewareConnecting(evt, client, args.Logger)
-	})
-	handler.Handle(socketmode.EventTypeConnectionError, func(evt *socketmode.Event, client *socketmode.Client) {
-		middlewareConnectionError(evt, client, args.Logger)
-	})
-	handler.Handle(socketmode.EventTypeConnected, func(evt *socketmode.Event, client *socketmode.Client) {
-		middlewareConnected(evt, client, args.Logger)
-	})
-	handler.Handle(socketmode.EventTypeHello, func(evt *socketmode.Event, client *socketmode.Client) {
-		middlewareHello(evt, client, args.Logger)
-	})
+	// socket mode events are acknowledged as soon as they are received, then go through the bot's pipeline
+	api := &handler.Client.Client
+	handle := func(h HandlerFunc) socketmode.SocketmodeHandlerFunc {
+		h = Chain(b.handler(h), b.acknowledge(handler.Client))
+		return func(evt *socketmode.Event, _ *socketmode.Client) {
+			h(work, api, evt)
+		}
+	}
+	handler.Handle(socketmode.EventTypeConnecting, handle(func(_ context.Context, _ *slack.Client, evt *socketmode.Event) {
+		middlewareConnecting(evt, handler.Client, args.Logger)
+	}))
+	handler.Handle(socketmode.EventTypeConnectionError, handle(func(_ context.Context, _ *slack.Client, evt *socketmode.Event) {
+		middlewareConnectionError(evt, handler.Client, args.Logger)
+	}))
+	handler.Handle(socketmode.EventTypeConnected, handle(func(_ context.Context, _ *slack.Client, evt *socketmode.Event) {
+		middlewareConnected(evt, handler.Client, args.Logger)
+	}))
+	handler.Handle(socketmode.EventTypeHello, handle(func(_ context.Context, _ *slack.Client, evt *socketmode.Event) {
+		middlewareHello(evt, handler.Client, args.Logger)
+	}))
+	handler.HandleEvents(slackevents.AppMention, handle(b.handleMentionEvent))
+	handler.HandleEvents(slackevents.Message, handle(b.handleMessageEvent))
+	handler.HandleEvents(slackevents.ReactionAdded, handle(b.handleReactionEvent))
+	handler.HandleEvents(slackevents.AppHomeOpened, handle(b.handleAppHomeEvent))
+	handler.HandleEvents(slackevents.WorkflowStepExecute, handle(b.handleWorkflowStepEvent))
+	handler.Handle(socketmode.EventTypeInteractive, handle(b.handleInteractiveEvent))
+	handler.Handle(socketmode.EventTypeSlashCommand, handle(b.handleSlashCommandEvent))
+	batches, stopBatches := context.WithCancel(work)
+	batchesDone := make(chan struct{})
+	go func() {
+		defer close(batchesDone)
+		b.runBatches(batches, args.SlackClient)
+	}()
+	load, stopLoad := context.WithCancel(ctx)
+	loadDone := make(chan struct{})
+	go func() {
+		defer close(loadDone)
+		b.runLoadStatus(load, args.SlackClient)
+	}()
+	quality, stopQuality := context.WithCancel(work)
+	qualityDone := make(chan struct{})
+	go func() {
+		defer close(qualityDone)
+		b.runQualitySampling(quality)
+	}()
+	err := runEventLoop(ctx, handler, args.Status, args.Metrics)
+	stopQuality()
+	<-qualityDone
+	stopLoad()
+	<-loadDone
+	stopBatches()
+	<-batchesDone
+	return err
+}
 
-	handler.HandleEvents(slackevents.AppMention, func(evt *socketmode.Event, client *socketmode.Client) {
-		middlewareAppMentionEvent(evt, client, args.GPTClient, args.Context, args.Logger, convo)
-	})
-	handler.HandleEvents(slackevents.Message, func(evt *socketmode.Event, client *socketmode.Client) {
-		middlewareMessageEvent(evt, client, args.GPTClient, args.Context, args.Logger, convo)
+// drainContext returns the context events are handled with. It outlives ctx so that cancelling ctx only stops
+// new events from being accepted, and is cancelled drainTimeout later or when the returned func is called.
+func drainContext(ctx context.Context, drainTimeout time.Duration, logger *log.Logger) (context.Context, func()) {
+	work, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	stopDrain := context.AfterFunc(ctx, func() {
+		if drainTimeout <= 0 {
+			cancelWork()
+			return
+		}
+		logger.Printf("draining in-flight events for up to %v\n", drainTimeout)
+		drain := time.AfterFunc(drainTimeout, cancelWork)
+		context.AfterFunc(work, func() { drain.Stop() })
 	})
-	return handler.RunEventLoop()
+	return work, func() {
+		stopDrain()
+		cancelWork()
+	}
 }
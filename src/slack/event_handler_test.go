@@ -3,7 +3,8 @@ package slackhandler
 import (
 	"context"
 	"encoding/json"
-	"github.com/sashabaranov/go-openai"
+	"github.com/chikamif/slackgpt/src/chatgpt/chatgptmock"
+	"github.com/chikamif/slackgpt/src/fake"
 	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
 	"github.com/slack-go/slack/socketmode"
@@ -50,12 +51,17 @@ func TestEventHandlerArgs_NewSocketmodeHandler(t *testing.T) {
 	appToken := "xapp-123"
 	botTok := "xoxb-test"
 	ctx := context.Background()
-	client := openai.NewClient("test-token")
+	client := &chatgptmock.Provider{}
+	// the fake server rejects the tokens the same way slack would, ending the event loop
+	slackServer := fake.NewSlack()
+	defer slackServer.Close()
+	slackServer.RejectConnections("invalid_auth")
 	slackClient := slack.New(
 		botTok,
 		slack.OptionDebug(false),
 		slack.OptionAppLevelToken(appToken),
 		slack.OptionLog(logger),
+		slack.OptionAPIURL(slackServer.APIURL()),
 	)
 
 	socketmodeClient := socketmode.New(
@@ -109,7 +115,7 @@ func TestEventHandlerArgs_NewSocketmodeHandler(t *testing.T) {
 		Request: &socketmode.Request{
 			Type:           "test",
 			NumConnections: 1,
-			ConnectionInfo: socketmode.ConnectionInfo{"test-app"},
+			ConnectionInfo: socketmode.ConnectionInfo{AppID: "test-app"},
 			Reason:         "test",
 			EnvelopeID:     "1",
 			Payload:        send,
@@ -126,7 +132,7 @@ func TestEventHandlerArgs_NewSocketmodeHandler(t *testing.T) {
 		Request: &socketmode.Request{
 			Type:           "test",
 			NumConnections: 1,
-			ConnectionInfo: socketmode.ConnectionInfo{"test-app"},
+			ConnectionInfo: socketmode.ConnectionInfo{AppID: "test-app"},
 			Reason:         "test",
 			EnvelopeID:     "1",
 			Payload:        send,
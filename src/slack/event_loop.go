@@ -0,0 +1,149 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/metrics"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/slack-go/slack/socketmode"
+	"sync"
+	"time"
+)
+
+// eventDrainGrace is how long events are discarded after the socketmode client stops, so its
+// internal goroutines are never left blocked sending a final error event
+const eventDrainGrace = time.Second
+
+// eventLoop dispatches socketmode events to the handlers registered on a SocketmodeHandler.
+// Unlike SocketmodeHandler.RunEventLoop, every goroutine it spawns is tracked so it can be
+// drained on shutdown.
+type eventLoop struct {
+	handler *socketmode.SocketmodeHandler
+	status  *HandlerStatus
+	metrics *metrics.Metrics
+	wg      sync.WaitGroup
+}
+
+// runEventLoop connects the socketmode client and dispatches events until ctx is cancelled or the
+// client fails, then waits for every in-flight handler to return. status and m may be nil.
+func runEventLoop(ctx context.Context, handler *socketmode.SocketmodeHandler, status *HandlerStatus, m *metrics.Metrics) error {
+	l := &eventLoop{handler: handler, status: status, metrics: m}
+	status.watchQueue(handler.Client.Events)
+	stop := make(chan struct{})
+	received := make(chan struct{})
+	go func() {
+		defer close(received)
+		l.receive(stop)
+	}()
+
+	err := handler.Client.RunContext(ctx)
+
+	close(stop)
+	<-received
+	go discardEvents(handler.Client.Events, eventDrainGrace)
+	l.wg.Wait()
+	if err == context.Canceled {
+		return nil
+	}
+	return err
+}
+
+// receive dispatches events until stop is closed or the events channel is closed
+func (l *eventLoop) receive(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case evt, ok := <-l.handler.Client.Events:
+			if !ok {
+				return
+			}
+			l.dispatch(evt)
+		}
+	}
+}
+
+// discardEvents empties events for the grace period so no sender stays blocked
+func discardEvents(events chan socketmode.Event, grace time.Duration) {
+	timeout := time.After(grace)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			return
+		}
+	}
+}
+
+// spawn runs f in a tracked goroutine, the status and metrics of the event are recorded by the bot's pipeline
+func (l *eventLoop) spawn(f socketmode.SocketmodeHandlerFunc, evt *socketmode.Event) {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		f(evt, l.handler.Client)
+	}()
+}
+
+// eventType names the type of evt for metrics, the inner event type for Events API events
+func eventType(evt *socketmode.Event) string {
+	if eventsAPIEvent, ok := evt.Data.(slackevents.EventsAPIEvent); ok && evt.Type == socketmode.EventTypeEventsAPI {
+		return eventsAPIEvent.InnerEvent.Type
+	}
+	return string(evt.Type)
+}
+
+// dispatch routes an event the same way socketmode.SocketmodeHandler does
+func (l *eventLoop) dispatch(evt socketmode.Event) {
+	h := l.handler
+	l.metrics.EventReceived(eventType(&evt))
+	if evt.Type == socketmode.EventTypeConnectionError || evt.Type == socketmode.EventTypeInvalidAuth {
+		l.metrics.Error("slack")
+	}
+	handled := l.dispatchEventType(&evt)
+
+	switch evt.Type {
+	case socketmode.EventTypeEventsAPI:
+		if eventsAPIEvent, ok := evt.Data.(slackevents.EventsAPIEvent); ok {
+			for _, f := range h.EventApiMap[slackevents.EventsAPIType(eventsAPIEvent.InnerEvent.Type)] {
+				l.spawn(f, &evt)
+				handled = true
+			}
+		}
+	case socketmode.EventTypeInteractive:
+		if interaction, ok := evt.Data.(slack.InteractionCallback); ok {
+			for _, f := range h.InteractionEventMap[interaction.Type] {
+				l.spawn(f, &evt)
+				handled = true
+			}
+			for _, action := range interaction.ActionCallback.BlockActions {
+				if f, ok := h.InteractionBlockActionEventMap[action.ActionID]; ok {
+					l.spawn(f, &evt)
+					handled = true
+				}
+			}
+		}
+	case socketmode.EventTypeSlashCommand:
+		if cmd, ok := evt.Data.(slack.SlashCommand); ok {
+			if f, ok := h.SlashCommandMap[cmd.Command]; ok {
+				l.spawn(f, &evt)
+				handled = true
+			}
+		}
+	}
+
+	if !handled && h.Default != nil {
+		l.spawn(h.Default, &evt)
+	}
+}
+
+// dispatchEventType runs the handlers registered for the event's socketmode type
+func (l *eventLoop) dispatchEventType(evt *socketmode.Event) bool {
+	handlers, ok := l.handler.EventMap[evt.Type]
+	for _, f := range handlers {
+		l.spawn(f, evt)
+	}
+	return ok
+}
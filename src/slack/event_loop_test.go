@@ -0,0 +1,143 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/chikamif/slackgpt/src/leakcheck"
+	"github.com/chikamif/slackgpt/src/metrics"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/slack-go/slack/socketmode"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(leakcheck.Main(m))
+}
+
+func TestEventHandler_DrainsInFlightHandlersOnShutdown(t *testing.T) {
+	before := leakcheck.Take()
+	slackServer := fake.NewSlack()
+	gptServer := fake.NewOpenAI(time.Minute)
+
+	gptConfig := openai.DefaultConfig("sk-test")
+	gptConfig.BaseURL = gptServer.URL()
+	slackClient := slack.New("xoxb-test", slack.OptionAppLevelToken("xapp-test"),
+		slack.OptionAPIURL(slackServer.APIURL()), slack.OptionLog(logger))
+	ctx, cancel := context.WithCancel(context.Background())
+	status := NewHandlerStatus()
+	m := metrics.New()
+	args := EventHandlerArgs{
+		Logger:           logger,
+		SlackClient:      slackClient,
+		SocketModeClient: socketmode.New(slackClient, socketmode.OptionLog(logger)),
+		GPTClient:        openai.NewClientWithConfig(gptConfig),
+		Context:          ctx,
+		Status:           status,
+		Metrics:          m,
+	}
+	handlerErr := make(chan error, 1)
+	go func() {
+		handlerErr <- EventHandler(args, args.NewSocketmodeHandler())
+	}()
+
+	connectCtx, connectCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer connectCancel()
+	require.NoError(t, slackServer.WaitConnected(connectCtx))
+	envelopeID, err := slackServer.SendEvent(slackevents.AppMentionEvent{
+		Type:      string(slackevents.AppMention),
+		Text:      "<@U0BOT> hello",
+		Channel:   "C1",
+		TimeStamp: "1.000001",
+	})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return gptServer.Requests() == 1 }, 5*time.Second, 10*time.Millisecond)
+	var activeIDs []string
+	for _, req := range status.Snapshot().ActiveRequests {
+		activeIDs = append(activeIDs, req.ID)
+	}
+	assert.Contains(t, activeIDs, envelopeID)
+
+	// the mention is still waiting on chat-gpt when shutdown starts, so returning proves it was drained
+	cancel()
+	select {
+	case err := <-handlerErr:
+		assert.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("event handler did not shut down")
+	}
+	assert.Len(t, slackServer.Messages(), 1)
+	assert.Empty(t, status.Snapshot().ActiveRequests)
+	var scrape strings.Builder
+	_, err = m.Registry.WriteTo(&scrape)
+	require.NoError(t, err)
+	assert.Contains(t, scrape.String(), `slackgpt_slack_events_total{type="app_mention"} 1`)
+	assert.Contains(t, scrape.String(), `slackgpt_slack_event_duration_seconds_count{type="app_mention"} 1`)
+
+	slackServer.Close()
+	gptServer.Close()
+	leakcheck.Verify(t, before)
+}
+
+func TestEventHandler_FinishesInFlightAnswersWithinDrainTimeout(t *testing.T) {
+	tests := []struct {
+		name         string
+		gptLatency   time.Duration
+		drainTimeout time.Duration
+		wantAnswer   string
+	}{
+		{"answered", 300 * time.Millisecond, time.Minute, "fake answer to: hello"},
+		{"timed out", time.Minute, 100 * time.Millisecond, troubleText},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slackServer := fake.NewSlack()
+			defer slackServer.Close()
+			gptServer := fake.NewOpenAI(tt.gptLatency)
+			defer gptServer.Close()
+			gptConfig := openai.DefaultConfig("sk-test")
+			gptConfig.BaseURL = gptServer.URL()
+			slackClient := slack.New("xoxb-test", slack.OptionAppLevelToken("xapp-test"),
+				slack.OptionAPIURL(slackServer.APIURL()), slack.OptionLog(logger))
+			ctx, cancel := context.WithCancel(context.Background())
+			args := EventHandlerArgs{
+				Logger:           logger,
+				SlackClient:      slackClient,
+				SocketModeClient: socketmode.New(slackClient, socketmode.OptionLog(logger)),
+				GPTClient:        openai.NewClientWithConfig(gptConfig),
+				Context:          ctx,
+				DrainTimeout:     tt.drainTimeout,
+			}
+			handlerErr := make(chan error, 1)
+			go func() {
+				handlerErr <- EventHandler(args, args.NewSocketmodeHandler())
+			}()
+
+			connectCtx, connectCancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer connectCancel()
+			require.NoError(t, slackServer.WaitConnected(connectCtx))
+			_, err := slackServer.SendEvent(slackevents.AppMentionEvent{
+				Type: string(slackevents.AppMention), Text: "<@U0BOT> hello", Channel: "C1", TimeStamp: "1.000001",
+			})
+			require.NoError(t, err)
+			require.Eventually(t, func() bool { return gptServer.Requests() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+			cancel()
+			select {
+			case err := <-handlerErr:
+				assert.NoError(t, err)
+			case <-time.After(10 * time.Second):
+				t.Fatal("event handler did not shut down")
+			}
+			messages := slackServer.Messages()
+			require.Len(t, messages, 1)
+			assert.Equal(t, tt.wantAnswer, unformatResponse(messages[0].Text))
+		})
+	}
+}
@@ -0,0 +1,372 @@
+package slackhandler
+
+import (
+	"context"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// faqHelpfulActionID and faqUnhelpfulActionID identify the buttons asking whether an FAQ answer helped
+	faqHelpfulActionID   = "slackgpt_faq_helpful"
+	faqUnhelpfulActionID = "slackgpt_faq_unhelpful"
+	// DefaultFAQThreshold is the similarity above which a question is answered from the FAQ
+	DefaultFAQThreshold = 0.9
+)
+
+// FAQ is a canonical question and the answer given to questions like it
+type FAQ struct {
+	ID       int
+	Question string
+	Answer   string
+	// Author is the ID of the admin who added the FAQ
+	Author string
+	At     time.Time
+	// Embedding of Question with EmbeddingModel, empty until it could be embedded
+	Embedding      []float32 `json:",omitempty"`
+	EmbeddingModel string    `json:",omitempty"`
+	// Helpful and Unhelpful count the answers users rated
+	Helpful   int
+	Unhelpful int
+}
+
+// FAQStore keeps the FAQs admins registered. With a path the FAQs are kept in a JSON file so they survive
+// restarts.
+type FAQStore struct {
+	mu   sync.Mutex
+	path string
+	faqs []FAQ
+}
+
+// NewFAQStore creates an FAQ store backed by the JSON file at path, which is created on the first change if it
+// does not exist. An empty path keeps FAQs in memory only.
+func NewFAQStore(path string) (*FAQStore, error) {
+	s := &FAQStore{path: path}
+	if path == "" {
+		return s, nil
+	}
+	if err := loadJSON(path, &s.faqs); err != nil {
+		return nil, fmt.Errorf("reading FAQs: %w", err)
+	}
+	return s, nil
+}
+
+// List returns every FAQ, oldest first
+func (s *FAQStore) List() []FAQ {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]FAQ(nil), s.faqs...)
+}
+
+// Add registers faq under a new ID. The FAQ is kept in memory even when saving fails.
+func (s *FAQStore) Add(faq FAQ) (FAQ, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	faq.ID = 1
+	if len(s.faqs) > 0 {
+		faq.ID = s.faqs[len(s.faqs)-1].ID + 1
+	}
+	faq.At = faq.At.UTC()
+	s.faqs = append(s.faqs, faq)
+	return faq, s.save()
+}
+
+// AddAll registers faqs under new IDs, in order, saving them once
+func (s *FAQStore) AddAll(faqs []FAQ) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := 1
+	if len(s.faqs) > 0 {
+		id = s.faqs[len(s.faqs)-1].ID + 1
+	}
+	for _, faq := range faqs {
+		faq.ID, faq.At = id, faq.At.UTC()
+		s.faqs = append(s.faqs, faq)
+		id++
+	}
+	return s.save()
+}
+
+// Remove deletes the FAQ with id, reporting whether there was one
+func (s *FAQStore) Remove(id int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, faq := range s.faqs {
+		if faq.ID == id {
+			s.faqs = append(s.faqs[:i], s.faqs[i+1:]...)
+			return true, s.save()
+		}
+	}
+	return false, nil
+}
+
+// update applies f to the FAQ with id, reporting whether there was one
+func (s *FAQStore) update(id int, f func(faq *FAQ)) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.faqs {
+		if s.faqs[i].ID == id {
+			f(&s.faqs[i])
+			return true, s.save()
+		}
+	}
+	return false, nil
+}
+
+// save writes the FAQs to the store's file, the caller must hold s.mu
+func (s *FAQStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	if err := saveJSON(s.path, s.faqs); err != nil {
+		return fmt.Errorf("saving FAQs: %w", err)
+	}
+	return nil
+}
+
+// faqs answers questions similar to a registered FAQ with its answer instead of asking the model
+type faqs struct {
+	store     *FAQStore
+	embedder  chatgpt.Embedder
+	model     string
+	threshold float64
+}
+
+// embed returns the embeddings of texts
+func (f *faqs) embed(ctx context.Context, texts ...string) ([][]float32, error) {
+	return chatgpt.Embed(ctx, f.embedder, f.model, texts)
+}
+
+// match returns the FAQ most similar to question when it is similar enough, embedding the FAQs that were not
+// embedded with the current model first
+func (f *faqs) match(ctx context.Context, question string) (FAQ, bool, error) {
+	registered := f.store.List()
+	if len(registered) == 0 {
+		return FAQ{}, false, nil
+	}
+	var stale []int
+	texts := []string{question}
+	for i, faq := range registered {
+		if len(faq.Embedding) == 0 || faq.EmbeddingModel != f.model {
+			stale = append(stale, i)
+			texts = append(texts, faq.Question)
+		}
+	}
+	embeddings, err := f.embed(ctx, texts...)
+	if err != nil {
+		return FAQ{}, false, err
+	}
+	for j, i := range stale {
+		registered[i].Embedding, registered[i].EmbeddingModel = embeddings[j+1], f.model
+		if _, err := f.store.update(registered[i].ID, func(faq *FAQ) {
+			faq.Embedding, faq.EmbeddingModel = embeddings[j+1], f.model
+		}); err != nil {
+			return FAQ{}, false, err
+		}
+	}
+	best, bestSimilarity := FAQ{}, 0.0
+	for _, faq := range registered {
+		if similarity := chatgpt.Similarity(embeddings[0], faq.Embedding); similarity > bestSimilarity {
+			best, bestSimilarity = faq, similarity
+		}
+	}
+	return best, bestSimilarity >= f.threshold, nil
+}
+
+// answerFromFAQ answers question in the thread threadTS of channel with the most similar FAQ, reporting
+// whether it was similar enough to one. The exchange is added to the conversation under convoKey so follow-ups
+// continue from it.
+func (b *bot) answerFromFAQ(ctx context.Context, api *slack.Client, channel, threadTS, convoKey, question string) bool {
+	if b.faqs == nil {
+		return false
+	}
+	if shared := b.sharedPolicy(ctx, api, channel); shared != nil && !shared.Grounding {
+		return false
+	}
+	faq, ok, err := b.faqs.match(ctx, question)
+	if err != nil {
+		b.logger.Printf("failed matching question to FAQs: %v\n", err)
+		return false
+	}
+	if !ok {
+		return false
+	}
+	resp := completion{answer: faq.Answer, note: fmt.Sprintf("_From the FAQ: %s_", slackEscaper.Replace(faq.Question))}
+	value := fmt.Sprintf("%d|%s", faq.ID, convoKey)
+	helpful := slack.NewButtonBlockElement(faqHelpfulActionID, value, slack.NewTextBlockObject(slack.PlainTextType, "Helpful", false, false))
+	helpful.Style = slack.StylePrimary
+	unhelpful := slack.NewButtonBlockElement(faqUnhelpfulActionID, value, slack.NewTextBlockObject(slack.PlainTextType, "Not helpful, ask ChatGPT", false, false))
+	options := answerOptions(resp, helpful, unhelpful)
+	if threadTS != "" {
+		options = append(options, slack.MsgOptionTS(threadTS))
+	}
+	if _, _, err := api.PostMessageContext(ctx, channel, options...); err != nil {
+		b.logger.Printf("failed posting FAQ answer: %v\n", err)
+		return true
+	}
+	b.logger.Printf("answered %v from FAQ %d\n", convoKey, faq.ID)
+	b.convo.UpdateConversation(convoKey, question)
+	b.convo.UpdateConversation(convoKey, faq.Answer)
+	return true
+}
+
+// faqFeedback records whether an FAQ answer was helpful, replacing its buttons with the rating. Unhelpful
+// answers are answered again by the model.
+func (b *bot) faqFeedback(ctx context.Context, api *slack.Client, callback *slack.InteractionCallback, action *slack.BlockAction) {
+	if b.faqs == nil {
+		return
+	}
+	index, convoKey, _ := strings.Cut(action.Value, "|")
+	id, err := strconv.Atoi(index)
+	if err != nil {
+		b.logger.Printf("ignored unknown FAQ %q\n", action.Value)
+		return
+	}
+	helpful := action.ActionID == faqHelpfulActionID
+	if _, err := b.faqs.store.update(id, func(faq *FAQ) {
+		if helpful {
+			faq.Helpful++
+		} else {
+			faq.Unhelpful++
+		}
+	}); err != nil {
+		b.logger.Printf("failed recording FAQ feedback: %v\n", err)
+	}
+
+	channel, user := callback.Channel.ID, callback.User.ID
+	note := fmt.Sprintf(":thumbsup: <@%s> found this helpful.", user)
+	if !helpful {
+		note = fmt.Sprintf(":thumbsdown: <@%s> did not find this helpful.", user)
+	}
+	var blocks []slack.Block
+	for _, block := range callback.Message.Blocks.BlockSet {
+		if block.BlockType() != slack.MBTAction {
+			blocks = append(blocks, block)
+		}
+	}
+	blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, note, false, false)))
+	_, _, _, err = api.UpdateMessageContext(ctx, channel, callback.Message.Timestamp,
+		slack.MsgOptionText(callback.Message.Text, false), slack.MsgOptionBlocks(blocks...))
+	if err != nil {
+		b.logger.Printf("failed updating FAQ answer: %v\n", err)
+	}
+	if helpful {
+		return
+	}
+
+	// answers to mentions are in threads, top level answers are in DMs and followed by the new answer
+	threadTS := callback.Message.ThreadTimestamp
+	if !b.mayAnswer(ctx, api, channel, threadTS, user) {
+		return
+	}
+	answer := unformatResponse(callback.Message.Text)
+	history, ok := b.convo.Before(convoKey, answer)
+	if !ok || len(history) == 0 {
+		b.logger.Printf("FAQ answer in %v is no longer in the conversation\n", convoKey)
+		return
+	}
+	resp, err := b.completeIn(ctx, api, convoKey, channel, user, turns(history, openai.ChatMessageRoleUser))
+	if err != nil {
+		b.logger.Printf("Failed to get gpt3 response for unhelpful FAQ answer: %v\n", err)
+		resp = completion{answer: troubleAnswer(err)}
+	} else {
+		b.convo.ReplaceMessage(convoKey, answer, resp.stored())
+	}
+	options := b.replyOptions(resp, convoKey, user)
+	if threadTS != "" {
+		options = append(options, slack.MsgOptionTS(threadTS))
+	}
+	if _, _, err := api.PostMessageContext(ctx, channel, options...); err != nil {
+		b.logger.Printf("failed posting answer to unhelpful FAQ answer: %v\n", err)
+	}
+}
+
+// faqCommandPattern matches the admin FAQ commands
+var faqCommandPattern = regexp.MustCompile(`(?s)^(?:<@[A-Z0-9]+>\s*)?faq\s+(list|add|remove)\b\s*(.*)$`)
+
+// faqCommand handles the FAQ commands of admins, reporting whether text was one:
+//
+//	faq list                       lists the FAQs with their ratings
+//	faq add <question> | <answer>  registers an FAQ
+//	faq remove <id>                deletes an FAQ
+func (b *bot) faqCommand(ctx context.Context, api *slack.Client, channel, threadTS, user, text string) bool {
+	if b.faqs == nil || !b.admins[user] {
+		return false
+	}
+	match := faqCommandPattern.FindStringSubmatch(strings.TrimSpace(text))
+	if match == nil {
+		return false
+	}
+	command, arg := match[1], strings.TrimSpace(match[2])
+	var reply string
+	switch command {
+	case "list":
+		reply = faqList(b.faqs.store.List())
+	case "add":
+		question, answer, ok := strings.Cut(entityUnescaper.Replace(arg), "|")
+		question, answer = strings.TrimSpace(question), strings.TrimSpace(answer)
+		if !ok || question == "" || answer == "" {
+			reply = "Usage: faq add <question> | <answer>"
+			break
+		}
+		faq := FAQ{Question: question, Answer: answer, Author: user, At: time.Now()}
+		if embeddings, err := b.faqs.embed(ctx, question); err == nil {
+			faq.Embedding, faq.EmbeddingModel = embeddings[0], b.faqs.model
+		} else {
+			// embedded again when the next question is matched
+			b.logger.Printf("failed embedding FAQ: %v\n", err)
+		}
+		faq, err := b.faqs.store.Add(faq)
+		reply = fmt.Sprintf("Added FAQ %d.", faq.ID)
+		if err != nil {
+			b.logger.Printf("failed saving FAQ: %v\n", err)
+			reply += " It could not be saved and will be lost on restart."
+		}
+	case "remove":
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			reply = "Usage: faq remove <id>"
+			break
+		}
+		removed, err := b.faqs.store.Remove(id)
+		switch {
+		case !removed:
+			reply = fmt.Sprintf("There is no FAQ %d.", id)
+		case err != nil:
+			b.logger.Printf("failed saving FAQs: %v\n", err)
+			reply = fmt.Sprintf("Removed FAQ %d. It could not be saved and will be back on restart.", id)
+		default:
+			reply = fmt.Sprintf("Removed FAQ %d.", id)
+		}
+	}
+	b.logger.Printf("%v ran faq %v\n", user, command)
+	if _, _, err := api.PostMessageContext(ctx, channel, slack.MsgOptionText(reply, false), slack.MsgOptionTS(threadTS)); err != nil {
+		b.logger.Printf("failed answering faq command: %v\n", err)
+	}
+	return true
+}
+
+// faqList lists faqs with how helpful their answers were
+func faqList(faqs []FAQ) string {
+	if len(faqs) == 0 {
+		return "There are no FAQs."
+	}
+	var b strings.Builder
+	b.WriteString("FAQs:")
+	for _, faq := range faqs {
+		fmt.Fprintf(&b, "\n*%d.* %s (:thumbsup: %d :thumbsdown: %d)", faq.ID, slackEscaper.Replace(faq.Question), faq.Helpful, faq.Unhelpful)
+		answer := faq.Answer
+		if runes := []rune(answer); len(runes) > 200 {
+			answer = string(runes[:200]) + "…"
+		}
+		b.WriteString("\n> " + strings.ReplaceAll(slackEscaper.Replace(answer), "\n", "\n> "))
+	}
+	return b.String()
+}
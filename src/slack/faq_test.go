@@ -0,0 +1,95 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFAQStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "faqs.json")
+	store, err := NewFAQStore(path)
+	require.NoError(t, err)
+	now := time.Now()
+	first, err := store.Add(FAQ{Question: "How do I reset my VPN?", Answer: "Click Reset.", Author: "U1", At: now})
+	require.NoError(t, err)
+	assert.Equal(t, 1, first.ID)
+	second, err := store.Add(FAQ{Question: "Where is the wiki?", Answer: "At wiki.example.com.", Author: "U1", At: now})
+	require.NoError(t, err)
+	assert.Equal(t, 2, second.ID)
+
+	removed, err := store.Remove(1)
+	require.NoError(t, err)
+	assert.True(t, removed)
+	removed, err = store.Remove(1)
+	require.NoError(t, err)
+	assert.False(t, removed)
+	third, err := store.Add(FAQ{Question: "Who do I ask about payroll?", Answer: "HR.", Author: "U1", At: now})
+	require.NoError(t, err)
+	assert.Equal(t, 3, third.ID, "IDs are not reused")
+
+	store, err = NewFAQStore(path)
+	require.NoError(t, err)
+	assert.Equal(t, []FAQ{second, third}, store.List())
+}
+
+func faqCallback(channel string, reply slack.Msg, actionID, value string) *slack.InteractionCallback {
+	callback := escalateCallback(channel, reply, "")
+	callback.ActionCallback.BlockActions[0] = &slack.BlockAction{ActionID: actionID, Value: value}
+	return callback
+}
+
+func TestFAQ(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{AdminUsers: []string{"UADMIN"}})
+	ctx := context.Background()
+	mention := func(user, ts, text string) {
+		b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: user, Channel: "C1", Text: text, TimeStamp: ts})
+	}
+
+	mention("U1", "1.000001", "<@U0BOT> faq add How do I reset my VPN? | Click Reset.")
+	mention("UADMIN", "1.000002", "<@U0BOT> faq add How do I reset my VPN?")
+	mention("UADMIN", "1.000003", "<@U0BOT> faq add How do I reset my VPN? | Open vpn.example.com and click Reset.")
+	messages := slackServer.Messages()
+	require.Len(t, messages, 3)
+	assert.Equal(t, "fake answer to: faq add How do I reset my VPN? | Click Reset.", unformatResponse(messages[0].Text), "only admins manage FAQs")
+	assert.Equal(t, "Usage: faq add <question> | <answer>", messages[1].Text)
+	assert.Equal(t, "Added FAQ 1.", messages[2].Text)
+	require.Len(t, b.faqs.store.List(), 1)
+	assert.NotEmpty(t, b.faqs.store.List()[0].Embedding)
+
+	mention("U1", "1.000004", "<@U0BOT> how do I reset my vpn")
+	messages = slackServer.Messages()
+	require.Len(t, messages, 4)
+	answer := messages[3]
+	assert.Equal(t, "_From the FAQ: How do I reset my VPN?_\n"+formatResponse("Open vpn.example.com and click Reset."), answer.Text)
+	assert.Contains(t, answer.Blocks, faqUnhelpfulActionID)
+	history, _ := b.convo.Get("1.000004C1")
+	assert.Equal(t, []string{"how do I reset my vpn", "Open vpn.example.com and click Reset."}, history)
+
+	mention("U1", "1.000005", "<@U0BOT> what is go")
+	assert.Equal(t, "fake answer to: what is go", unformatResponse(slackServer.Messages()[4].Text), "other questions are asked")
+
+	// an unhelpful answer is replaced by the model's
+	reply := slack.Msg{Timestamp: answer.TS, ThreadTimestamp: "1.000004", Text: answer.Text}
+	b.handleInteraction(ctx, api, faqCallback("C1", reply, faqUnhelpfulActionID, "1|1.000004C1"))
+	messages = slackServer.Messages()
+	require.Len(t, messages, 6)
+	assert.Contains(t, messages[3].Blocks, "did not find this helpful")
+	assert.NotContains(t, messages[3].Blocks, faqUnhelpfulActionID)
+	assert.Equal(t, "1.000004", messages[5].ThreadTS)
+	history, _ = b.convo.Get("1.000004C1")
+	assert.Equal(t, []string{"how do I reset my vpn", "fake answer to: how do I reset my vpn"}, history)
+	b.handleInteraction(ctx, api, faqCallback("C1", reply, faqHelpfulActionID, "1|1.000004C1"))
+	faq := b.faqs.store.List()[0]
+	assert.Equal(t, 1, faq.Helpful)
+	assert.Equal(t, 1, faq.Unhelpful)
+
+	mention("UADMIN", "1.000006", "<@U0BOT> faq remove 1")
+	assert.Equal(t, "Removed FAQ 1.", slackServer.Messages()[6].Text)
+	assert.Empty(t, b.faqs.store.List())
+}
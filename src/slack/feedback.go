@@ -0,0 +1,232 @@
+package slackhandler
+
+import (
+	"context"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/command"
+	"github.com/slack-go/slack"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// feedbackUpActionID and feedbackDownActionID identify the thumbs up and down buttons on answers
+	feedbackUpActionID   = "slackgpt_feedback_up"
+	feedbackDownActionID = "slackgpt_feedback_down"
+	// feedbackReportCommand reports the feedback on answers to admins
+	feedbackReportCommand = "/gpt-feedback-report"
+	// maxReportedDownvotes is how many of the latest thumbs down the report quotes
+	maxReportedDownvotes = 5
+	// maxQuoteLength is the length quoted prompts are cut to in the report
+	maxQuoteLength = 100
+)
+
+// feedbackReportSpec is the syntax of feedbackReportCommand
+var feedbackReportSpec = &command.Command{
+	Name:    feedbackReportCommand,
+	Summary: "Report how users rated answers, overall and by model, with the latest thumbs down (admins only).",
+	Flags: []command.Flag{
+		{Name: "days", Short: "d", Value: "days", Usage: "only feedback from the last days, all of it when not given"},
+	},
+}
+
+// Feedback is a user's thumbs up or down on an answer, with the exchange it rated
+type Feedback struct {
+	// Channel and MessageTS are the answer's message, a user has one rating per answer
+	Channel   string
+	MessageTS string
+	User      string
+	Positive  bool
+	Model     string
+	Prompt    string
+	Response  string
+	At        time.Time
+}
+
+// FeedbackStore keeps the ratings users gave answers. With a path the feedback is kept in a JSON file so it
+// survives restarts.
+type FeedbackStore struct {
+	mu       sync.Mutex
+	path     string
+	feedback []Feedback
+}
+
+// NewFeedbackStore creates a feedback store backed by the JSON file at path, which is created on the first rating
+// if it does not exist. An empty path keeps feedback in memory only.
+func NewFeedbackStore(path string) (*FeedbackStore, error) {
+	s := &FeedbackStore{path: path}
+	if path == "" {
+		return s, nil
+	}
+	if err := loadJSON(path, &s.feedback); err != nil {
+		return nil, fmt.Errorf("reading feedback: %w", err)
+	}
+	return s, nil
+}
+
+// List returns all feedback, oldest first
+func (s *FeedbackStore) List() []Feedback {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Feedback(nil), s.feedback...)
+}
+
+// Record keeps f, replacing the user's earlier rating of the same answer. The feedback is kept in memory even
+// when saving fails.
+func (s *FeedbackStore) Record(f Feedback) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f.At = f.At.UTC()
+	for i, existing := range s.feedback {
+		if existing.Channel == f.Channel && existing.MessageTS == f.MessageTS && existing.User == f.User {
+			s.feedback = append(s.feedback[:i], s.feedback[i+1:]...)
+			break
+		}
+	}
+	s.feedback = append(s.feedback, f)
+	if s.path == "" {
+		return nil
+	}
+	if err := saveJSON(s.path, s.feedback); err != nil {
+		return fmt.Errorf("saving feedback: %w", err)
+	}
+	return nil
+}
+
+// feedbackButtons are the thumbs up and down buttons of an answer by model in the conversation under convoKey
+func feedbackButtons(convoKey, model string) []slack.BlockElement {
+	value := model + "|" + convoKey
+	return []slack.BlockElement{
+		slack.NewButtonBlockElement(feedbackUpActionID, value, slack.NewTextBlockObject(slack.PlainTextType, ":+1:", true, false)),
+		slack.NewButtonBlockElement(feedbackDownActionID, value, slack.NewTextBlockObject(slack.PlainTextType, ":-1:", true, false)),
+	}
+}
+
+// recordFeedback keeps the rating of the answer whose thumbs up or down button was clicked, with the question
+// it answered when that is still in the conversation
+func (b *bot) recordFeedback(ctx context.Context, api *slack.Client, callback *slack.InteractionCallback, action *slack.BlockAction) {
+	if b.feedback == nil {
+		return
+	}
+	model, convoKey, _ := strings.Cut(action.Value, "|")
+	channel, threadTS, user := callback.Channel.ID, callback.Message.ThreadTimestamp, callback.User.ID
+	f := Feedback{
+		Channel:   channel,
+		MessageTS: callback.Message.Timestamp,
+		User:      user,
+		Positive:  action.ActionID == feedbackUpActionID,
+		Model:     model,
+		Response:  unformatResponse(callback.Message.Text),
+		At:        time.Now(),
+	}
+	if answer, before, ok := b.convo.Answer(convoKey, f.Response); ok {
+		f.Response = answer
+		if len(before) > 0 {
+			f.Prompt = before[len(before)-1]
+		}
+	}
+	if err := b.feedback.Record(f); err != nil {
+		b.logger.Printf("failed recording feedback: %v\n", err)
+	}
+	b.tell(ctx, api, channel, threadTS, user, "Thanks for your feedback!")
+}
+
+// answerFeedbackReportCommand reports the feedback on answers to an admin, only to them
+func (b *bot) answerFeedbackReportCommand(ctx context.Context, cmd *slack.SlashCommand) {
+	if b.feedback == nil || !b.admins[cmd.UserID] {
+		b.respond(ctx, cmd, completion{note: "Only admins can see the feedback report, when feedback is enabled."}, slack.ResponseTypeEphemeral)
+		return
+	}
+	inv, err := b.aliases.Parse(feedbackReportSpec, cmd.Text)
+	if err == nil && inv.Has("days") {
+		if days, convErr := strconv.Atoi(inv.Value("days")); convErr != nil || days < 1 {
+			err = fmt.Errorf("--days must be a positive number of days, got %s", inv.Value("days"))
+		}
+	}
+	if err != nil {
+		b.respond(ctx, cmd, completion{note: err.Error() + "\n" + inv.UsageText()}, slack.ResponseTypeEphemeral)
+		return
+	}
+	if inv.Help {
+		b.respond(ctx, cmd, completion{note: feedbackReportSpec.Help()}, slack.ResponseTypeEphemeral)
+		return
+	}
+	var since time.Time
+	if inv.Has("days") {
+		days, _ := strconv.Atoi(inv.Value("days"))
+		since = time.Now().AddDate(0, 0, -days)
+	}
+	b.respond(ctx, cmd, completion{note: feedbackReport(b.feedback.List(), since)}, slack.ResponseTypeEphemeral)
+}
+
+// feedbackTally counts the thumbs up and down of some answers
+type feedbackTally struct {
+	up, down int
+}
+
+func (t feedbackTally) String() string {
+	return fmt.Sprintf("%d :+1: / %d :-1: (%d%% positive)", t.up, t.down, t.up*100/(t.up+t.down))
+}
+
+// feedbackReport summarizes the feedback given since, all of it when since is zero: the totals, the totals by
+// model and the latest thumbs down with their prompts
+func feedbackReport(feedback []Feedback, since time.Time) string {
+	var total feedbackTally
+	byModel := map[string]*feedbackTally{}
+	var downs []Feedback
+	for _, f := range feedback {
+		if f.At.Before(since) {
+			continue
+		}
+		model := f.Model
+		if model == "" {
+			model = "unknown model"
+		}
+		if byModel[model] == nil {
+			byModel[model] = &feedbackTally{}
+		}
+		if f.Positive {
+			total.up++
+			byModel[model].up++
+		} else {
+			total.down++
+			byModel[model].down++
+			downs = append(downs, f)
+		}
+	}
+	period := "all time"
+	if !since.IsZero() {
+		period = "since " + since.UTC().Format(utcDate)
+	}
+	if total.up+total.down == 0 {
+		return fmt.Sprintf("*Answer feedback, %s*\nNo answers were rated.", period)
+	}
+	lines := []string{fmt.Sprintf("*Answer feedback, %s*: %v", period, total), "*By model*"}
+	models := make([]string, 0, len(byModel))
+	for model := range byModel {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	for _, model := range models {
+		lines = append(lines, fmt.Sprintf("• %s: %v", slackEscaper.Replace(model), *byModel[model]))
+	}
+	if len(downs) > 0 {
+		lines = append(lines, "*Latest :-1:*")
+	}
+	for i := len(downs) - 1; i >= 0 && i >= len(downs)-maxReportedDownvotes; i-- {
+		f := downs[i]
+		prompt := "(question no longer known)"
+		if f.Prompt != "" {
+			prompt = strings.Join(strings.Fields(f.Prompt), " ")
+			if runes := []rune(prompt); len(runes) > maxQuoteLength {
+				prompt = string(runes[:maxQuoteLength-1]) + "…"
+			}
+			prompt = "“" + slackEscaper.Replace(prompt) + "”"
+		}
+		lines = append(lines, fmt.Sprintf("• <@%s>, %s: %s", f.User, f.At.UTC().Format(utcDate), prompt))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,108 @@
+package slackhandler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFeedbackStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feedback.json")
+	store, err := NewFeedbackStore(path)
+	require.NoError(t, err)
+	at := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, store.Record(Feedback{Channel: "C1", MessageTS: "1.000002", User: "U1", Positive: true, At: at}))
+	require.NoError(t, store.Record(Feedback{Channel: "C1", MessageTS: "1.000002", User: "U2", Positive: true, At: at}))
+	require.NoError(t, store.Record(Feedback{Channel: "C1", MessageTS: "1.000002", User: "U1", Positive: false, At: at}))
+
+	store, err = NewFeedbackStore(path)
+	require.NoError(t, err)
+	feedback := store.List()
+	require.Len(t, feedback, 2, "a user has one rating per answer")
+	assert.Equal(t, "U2", feedback[0].User)
+	assert.False(t, feedback[1].Positive)
+}
+
+func TestRecordFeedback(t *testing.T) {
+	store, _ := NewFeedbackStore("")
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{Feedback: store})
+	ctx := context.Background()
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: "C1", TimeStamp: "1.000001"})
+	answers := slackServer.Messages()
+	require.Len(t, answers, 1)
+	assert.Contains(t, answers[0].Blocks, feedbackUpActionID)
+	assert.Contains(t, answers[0].Blocks, feedbackDownActionID)
+
+	var value string
+	var blocks slack.Blocks
+	require.NoError(t, json.Unmarshal([]byte(answers[0].Blocks), &blocks))
+	for _, block := range blocks.BlockSet {
+		if actions, ok := block.(*slack.ActionBlock); ok {
+			value = actions.Elements.ElementSet[0].(*slack.ButtonBlockElement).Value
+		}
+	}
+	callback := faqCallback("C1", slack.Msg{Text: answers[0].Text, Timestamp: answers[0].TS, ThreadTimestamp: "1.000001"}, feedbackDownActionID, value)
+	b.handleInteraction(ctx, api, callback)
+
+	feedback := store.List()
+	require.Len(t, feedback, 1)
+	assert.False(t, feedback[0].Positive)
+	assert.Equal(t, "U1", feedback[0].User)
+	assert.Equal(t, "what is go", feedback[0].Prompt)
+	assert.Equal(t, "fake answer to: what is go", feedback[0].Response)
+	assert.NotEmpty(t, feedback[0].Model)
+	require.Len(t, slackServer.Ephemerals(), 1)
+}
+
+func TestFeedbackReport(t *testing.T) {
+	at := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	feedback := []Feedback{
+		{User: "U1", Positive: true, Model: "gpt-4o", At: at.AddDate(0, 0, -10)},
+		{User: "U1", Positive: true, Model: "gpt-4o", At: at},
+		{User: "U2", Positive: false, Model: "gpt-4o-mini", Prompt: "what is\n<go>", At: at},
+		{User: "U3", Positive: false, At: at},
+	}
+	assert.Equal(t, "*Answer feedback, since Jun 1 00:00 UTC*: 1 :+1: / 2 :-1: (33% positive)\n"+
+		"*By model*\n"+
+		"• gpt-4o: 1 :+1: / 0 :-1: (100% positive)\n"+
+		"• gpt-4o-mini: 0 :+1: / 1 :-1: (0% positive)\n"+
+		"• unknown model: 0 :+1: / 1 :-1: (0% positive)\n"+
+		"*Latest :-1:*\n"+
+		"• <@U3>, Jun 1 12:00 UTC: (question no longer known)\n"+
+		"• <@U2>, Jun 1 12:00 UTC: “what is &lt;go&gt;”",
+		feedbackReport(feedback, at.Truncate(24*time.Hour)))
+	assert.Contains(t, feedbackReport(feedback, time.Time{}), "all time*: 2 :+1: / 2 :-1:")
+	assert.Contains(t, feedbackReport(nil, time.Time{}), "No answers were rated.")
+}
+
+func TestFeedbackReportCommand(t *testing.T) {
+	store, _ := NewFeedbackStore("")
+	b, api, _ := newFakeBot(t, EventHandlerArgs{Feedback: store, AdminUsers: []string{"U0ADMIN"}})
+	var responses []slack.WebhookMessage
+	responseServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg slack.WebhookMessage
+		_ = json.NewDecoder(r.Body).Decode(&msg)
+		responses = append(responses, msg)
+	}))
+	defer responseServer.Close()
+	report := func(user, text string) string {
+		b.handleSlashCommand(context.Background(), api, &slack.SlashCommand{
+			Command: feedbackReportCommand, Text: text, UserID: user, ChannelID: "C1", ResponseURL: responseServer.URL,
+		})
+		require.NotEmpty(t, responses)
+		assert.Equal(t, slack.ResponseTypeEphemeral, responses[len(responses)-1].ResponseType)
+		return responses[len(responses)-1].Text
+	}
+	assert.Contains(t, report("U1", ""), "Only admins")
+	assert.Contains(t, report("U0ADMIN", ""), "No answers were rated.")
+	assert.Contains(t, report("U0ADMIN", "--days 7"), "since")
+	assert.Contains(t, report("U0ADMIN", "--days soon"), "--days must be a positive number")
+}
@@ -0,0 +1,87 @@
+package slackhandler
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// zeroWidthSpace is used to break up backtick runs so they cannot close a code block early
+const zeroWidthSpace = "\u200b"
+
+// mentionPattern matches user mentions such as <@U123ABC> or <@U123ABC|name>
+var mentionPattern = regexp.MustCompile(`<@[^<>]*>`)
+
+// slackEscaper escapes the control characters slack uses for mentions, links and commands
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// stripMentions removes user mentions from a slack message so they are not sent to chat-gpt
+func stripMentions(text string) string {
+	// nested mentions such as <@<@U1>> leave a new mention behind after one pass
+	for mentionPattern.MatchString(text) {
+		text = mentionPattern.ReplaceAllString(text, " ")
+	}
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// formatResponse wraps a chat-gpt response in a code block that is safe to post to slack.
+// Slack control characters are escaped so the response cannot ping @channel or users,
+// and backtick runs are broken up so the response cannot break out of the code block.
+func formatResponse(resp string) string {
+	escaped := slackEscaper.Replace(resp)
+	var b strings.Builder
+	b.WriteString("```")
+	if strings.HasPrefix(escaped, "`") {
+		b.WriteString(zeroWidthSpace)
+	}
+	var prev rune
+	for _, r := range escaped {
+		if r == '`' && prev == '`' {
+			b.WriteString(zeroWidthSpace)
+		}
+		b.WriteRune(r)
+		prev = r
+	}
+	if strings.HasSuffix(escaped, "`") {
+		b.WriteString(zeroWidthSpace)
+	}
+	b.WriteString("```")
+	return b.String()
+}
+
+// splitResponse splits a chat-gpt response into parts that are each at most max bytes once formatted
+// with formatResponse, preferring to split after a newline
+func splitResponse(resp string, max int) []string {
+	var parts []string
+	start, size, lastNewline := 0, fenceOverhead, -1
+	for i, r := range resp {
+		cost := utf8.RuneLen(r)
+		switch r {
+		case '&':
+			cost = len("&amp;")
+		case '<', '>':
+			cost = len("&lt;")
+		case '`':
+			cost += len(zeroWidthSpace)
+		}
+		if size+cost > max && i > start {
+			cut := i
+			if lastNewline > start {
+				cut = lastNewline
+			}
+			parts = append(parts, resp[start:cut])
+			start, lastNewline = cut, -1
+			size = fenceOverhead + formattedLen(resp[start:i])
+		}
+		size += cost
+		if r == '\n' {
+			lastNewline = i + 1
+		}
+	}
+	return append(parts, resp[start:])
+}
+
+// formattedLen is an upper bound of the length of s once escaped for formatResponse, without the fences
+func formattedLen(s string) int {
+	return len(formatResponse(s)) - 6
+}
@@ -0,0 +1,99 @@
+package slackhandler
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestStripMentions(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"no mention", "hello there", "hello there"},
+		{"leading mention", "<@U123ABC> hello", "hello"},
+		{"mention with label", "<@U123ABC|slackgpt> what is go?", "what is go?"},
+		{"multiple mentions", "ask <@U1> and <@U2> about it", "ask and about it"},
+		{"unterminated mention", "<@U123 hello", "<@U123 hello"},
+		{"only mention", "<@U123ABC>", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, stripMentions(tt.text))
+		})
+	}
+}
+
+func TestFormatResponse(t *testing.T) {
+	tests := []struct {
+		name string
+		resp string
+		want string
+	}{
+		{"plain", "hello", "```hello```"},
+		{"escapes control characters", "<!channel> & <@U1>", "```&lt;!channel&gt; &amp; &lt;@U1&gt;```"},
+		{"breaks inner fence", "a```b", "```a`\u200b`\u200b`b```"},
+		{"pads leading and trailing backticks", "`x`", "```\u200b`x`\u200b```"},
+		{"empty", "", "``````"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, formatResponse(tt.resp))
+		})
+	}
+}
+
+func FuzzStripMentions(f *testing.F) {
+	for _, seed := range []string{"", "<@U123> hi", "<@U1|bot><@U2>", "<@<@U1>>", "<@", "a\t<@U1>\nb"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, text string) {
+		out := stripMentions(text)
+		if mentionPattern.MatchString(out) {
+			t.Errorf("mention survived stripping: %q -> %q", text, out)
+		}
+		if out != strings.TrimSpace(out) {
+			t.Errorf("output not trimmed: %q", out)
+		}
+	})
+}
+
+func FuzzFormatResponse(f *testing.F) {
+	for _, seed := range []string{"", "```", "````", "`", "<!here>", "&lt;", "a```b```c", "\x00`"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, resp string) {
+		out := formatResponse(resp)
+		if !strings.HasPrefix(out, "```") || !strings.HasSuffix(out, "```") {
+			t.Fatalf("response not wrapped in a code block: %q", out)
+		}
+		if n := strings.Count(out, "```"); n != 2 {
+			t.Errorf("expected exactly one code block, found %d fences in %q", n, out)
+		}
+		if strings.ContainsAny(out, "<>") {
+			t.Errorf("unescaped control character in %q", out)
+		}
+	})
+}
+
+func FuzzSplitResponse(f *testing.F) {
+	for _, seed := range []string{"", "hello\nworld", strings.Repeat("&<>`", 20), strings.Repeat("line\n", 30), "é```é"} {
+		f.Add(seed, 40)
+	}
+	f.Fuzz(func(t *testing.T, resp string, max int) {
+		if max < 40 || max > 4000 {
+			t.Skip()
+		}
+		parts := splitResponse(resp, max)
+		if joined := strings.Join(parts, ""); joined != resp {
+			t.Fatalf("parts %q do not add up to %q", parts, resp)
+		}
+		for _, part := range parts {
+			if n := len(formatResponse(part)); n > max {
+				t.Errorf("part %q is %d bytes formatted, more than %d", part, n, max)
+			}
+		}
+	})
+}
@@ -0,0 +1,378 @@
+package slackhandler
+
+import (
+	"context"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/cache"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/chikamif/slackgpt/src/webhook"
+	"github.com/slack-go/slack"
+	"regexp"
+	"strings"
+)
+
+const (
+	// formActionID identifies the button opening the modal a form is filled in with
+	formActionID = "slackgpt_form"
+	// formCallbackID identifies submissions of form modals
+	formCallbackID = "slackgpt_form"
+	// formValueActionID identifies the input of every field in a form modal
+	formValueActionID = "value"
+	// maxFormRounds is how many times a form modal is submitted before the form is delivered as it is
+	maxFormRounds = 3
+	// maxViewTitle is the longest title slack shows on a modal
+	maxViewTitle = 24
+)
+
+// formCommandPattern matches the form command, with the name of the form and what the user says about it
+var formCommandPattern = regexp.MustCompile(`(?s)^(?:<@[A-Z0-9]+>\s*)?form\b\s*(.*)$`)
+
+// Form is a structured task, such as a bug report or an access request, the model helps users fill in
+// through a modal. Filled in forms are posted to Channel, or in the conversation the form was asked for in
+// when it is empty, and sent to Webhook as a FilledForm when it is set.
+type Form struct {
+	Name string
+	// Description tells the model what the form is for
+	Description string
+	Fields      []FormField
+	Channel     string
+	Webhook     string
+}
+
+// FormField is a field of a Form, Name is its key in a FilledForm and Description tells the model what goes
+// in it
+type FormField struct {
+	Name        string
+	Label       string
+	Description string
+	Multiline   bool
+}
+
+// FormFilledEvent is the webhook event a FilledForm is delivered as
+const FormFilledEvent = "form.filled"
+
+// FilledForm is a filled in form as it is sent to webhooks
+type FilledForm struct {
+	Form    string            `json:"form"`
+	User    string            `json:"user"`
+	Values  map[string]string `json:"values"`
+	Summary string            `json:"summary"`
+}
+
+// formSession is a form being filled in by user, asked for in channel and threadTS with said
+type formSession struct {
+	form     int
+	user     string
+	channel  string
+	threadTS string
+	said     string
+	step     chatgpt.FormStep
+	round    int
+}
+
+// forms holds the forms users can fill in and the sessions filling them in by session ID
+type forms struct {
+	forms    []Form
+	sessions *cache.LRU[formSession]
+	webhooks *webhook.Sender
+}
+
+// newForms creates the form sessions of forms, holding at most maxEntries sessions, 0 disables the bound, and
+// delivering the filled in forms with webhooks
+func newForms(defined []Form, maxEntries int, webhooks *webhook.Sender) *forms {
+	return &forms{
+		forms:    defined,
+		sessions: cache.NewLRU[formSession]("form_sessions", maxEntries, 0, nil),
+		webhooks: webhooks,
+	}
+}
+
+// Stats returns the form session cache stats
+func (f *forms) Stats() cache.Stats {
+	return f.sessions.Stats()
+}
+
+// find returns the index of the form text starts with the name of and the rest of text, -1 when it starts
+// with none. The longest matching name wins.
+func (f *forms) find(text string) (int, string) {
+	found, rest := -1, text
+	for i, form := range f.forms {
+		name := form.Name
+		if len(text) < len(name) || !strings.EqualFold(text[:len(name)], name) || (found >= 0 && len(name) <= len(f.forms[found].Name)) {
+			continue
+		}
+		found, rest = i, strings.TrimLeft(text[len(name):], " :-\n")
+	}
+	return found, rest
+}
+
+// fields returns the fields of form as the model knows them
+func (form Form) fields() []chatgpt.FormField {
+	fields := make([]chatgpt.FormField, len(form.Fields))
+	for i, field := range form.Fields {
+		description := field.Description
+		if description == "" {
+			description = field.Label
+		}
+		fields[i] = chatgpt.FormField{Name: field.Name, Description: description}
+	}
+	return fields
+}
+
+// purpose returns what form is for, as the model is told
+func (form Form) purpose() string {
+	if form.Description == "" {
+		return form.Name
+	}
+	return form.Name + " (" + form.Description + ")"
+}
+
+// formCommand starts filling in the form a mention or direct message asks for with the form command,
+// reporting whether text was the command. What the user said about the form fills in what it can, the rest
+// is filled in through a modal opened with a button.
+func (b *bot) formCommand(ctx context.Context, api *slack.Client, channel, threadTS, user, text string) bool {
+	if b.forms == nil {
+		return false
+	}
+	match := formCommandPattern.FindStringSubmatch(strings.TrimSpace(text))
+	if match == nil {
+		return false
+	}
+	var blocks []slack.Block
+	i, said := b.forms.find(strings.TrimSpace(b.prompt(ctx, api, match[1])))
+	reply := b.forms.usage()
+	if i >= 0 {
+		if !b.withinRateLimit(ctx, api, channel, threadTS, user) {
+			return true
+		}
+		form := b.forms.forms[i]
+		step, err := chatgpt.GetFormStep(b.gptClient, ctx, form.purpose(), form.fields(), said, nil)
+		if err != nil {
+			// the user fills in every field themselves
+			b.logger.Printf("failed pre-filling %v for %v: %v\n", form.Name, user, err)
+		}
+		id := newBranchID()
+		b.forms.sessions.Set(id, formSession{form: i, user: user, channel: channel, threadTS: threadTS, said: said, step: step})
+		reply = fmt.Sprintf("Let's fill in the *%s*. I filled in what I could from what you said, open it to check and complete it.", slackEscaper.Replace(form.Name))
+		open := slack.NewButtonBlockElement(formActionID, id, slack.NewTextBlockObject(slack.PlainTextType, "Fill in "+form.Name, false, false))
+		open.Style = slack.StylePrimary
+		blocks = []slack.Block{
+			slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, reply, false, false), nil, nil),
+			slack.NewActionBlock(formActionID, open),
+		}
+	}
+	options := []slack.MsgOption{slack.MsgOptionText(reply, false)}
+	if blocks != nil {
+		options = append(options, slack.MsgOptionBlocks(blocks...))
+	}
+	if threadTS != "" {
+		options = append(options, slack.MsgOptionTS(threadTS))
+	}
+	if _, _, err := api.PostMessageContext(ctx, channel, options...); err != nil {
+		b.logger.Printf("failed answering form command: %v\n", err)
+	}
+	return true
+}
+
+// usage lists the forms and how to ask for one
+func (f *forms) usage() string {
+	names := make([]string, len(f.forms))
+	for i, form := range f.forms {
+		names[i] = "`" + form.Name + "`"
+	}
+	return "Usage: mention me with `form <name>: <what it is about>`. Forms: " + strings.Join(names, ", ") + "."
+}
+
+// openForm opens the modal filling in the form of the session whose button was clicked, for the user who
+// asked for the form only
+func (b *bot) openForm(ctx context.Context, api *slack.Client, callback *slack.InteractionCallback, action *slack.BlockAction) {
+	if b.forms == nil {
+		return
+	}
+	session, ok := b.forms.sessions.Get(action.Value)
+	note := ""
+	switch {
+	case !ok:
+		note = "This form has expired, please ask for it again."
+	case session.user != callback.User.ID:
+		note = fmt.Sprintf("Only <@%s> can fill in this form.", session.user)
+	default:
+		if _, err := api.OpenViewContext(ctx, callback.TriggerID, b.forms.modal(action.Value, session)); err != nil {
+			b.logger.Printf("failed opening form modal: %v\n", err)
+		}
+		return
+	}
+	if _, err := api.PostEphemeralContext(ctx, callback.Channel.ID, callback.User.ID, slack.MsgOptionText(note, false)); err != nil {
+		b.logger.Printf("failed sending form notice to %v: %v\n", callback.User.ID, err)
+	}
+}
+
+// formBlockID identifies the input of field i in the modal of round, every round has its own block IDs so
+// the values the model filled in replace what the modal showed before
+func formBlockID(i, round int) string {
+	return fmt.Sprintf("field_%d_%d", i, round)
+}
+
+// modal is the modal filling in the form of session id, showing the values filled in so far and the model's
+// questions about the others
+func (f *forms) modal(id string, session formSession) slack.ModalViewRequest {
+	form := f.forms[session.form]
+	var blocks []slack.Block
+	if len(session.step.Questions) > 0 {
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.PlainTextType, "A few details are still missing or unclear.", false, false), nil, nil))
+	}
+	for i, field := range form.Fields {
+		label := field.Label
+		if label == "" {
+			label = field.Name
+		}
+		input := slack.NewPlainTextInputBlockElement(nil, formValueActionID)
+		input.InitialValue = session.step.Values[field.Name]
+		input.Multiline = field.Multiline
+		hint := session.step.Questions[field.Name]
+		if hint == "" {
+			hint = field.Description
+		}
+		var hintText *slack.TextBlockObject
+		if hint != "" {
+			hintText = slack.NewTextBlockObject(slack.PlainTextType, hint, false, false)
+		}
+		block := slack.NewInputBlock(formBlockID(i, session.round), slack.NewTextBlockObject(slack.PlainTextType, label, false, false), hintText, input)
+		// the model decides when the form is complete
+		block.Optional = true
+		blocks = append(blocks, block)
+	}
+	view := formView(form, blocks...)
+	view.PrivateMetadata = id
+	view.Submit = slack.NewTextBlockObject(slack.PlainTextType, "Submit", false, false)
+	view.Close = slack.NewTextBlockObject(slack.PlainTextType, "Cancel", false, false)
+	return view
+}
+
+// formView is a modal of form showing blocks
+func formView(form Form, blocks ...slack.Block) slack.ModalViewRequest {
+	title := form.Name
+	if runes := []rune(title); len(runes) > maxViewTitle {
+		title = string(runes[:maxViewTitle-1]) + "…"
+	}
+	return slack.ModalViewRequest{
+		Type:       slack.VTModal,
+		CallbackID: formCallbackID,
+		Title:      slack.NewTextBlockObject(slack.PlainTextType, title, false, false),
+		Blocks:     slack.Blocks{BlockSet: blocks},
+	}
+}
+
+// formNoticeView is a modal of form telling the user text, with a button closing it
+func formNoticeView(form Form, text string) slack.ModalViewRequest {
+	view := formView(form, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil))
+	view.Close = slack.NewTextBlockObject(slack.PlainTextType, "Close", false, false)
+	return view
+}
+
+// formSubmissionResponse replaces a form modal while its values are checked, it is nil for other interactions
+func (b *bot) formSubmissionResponse(callback *slack.InteractionCallback) *slack.ViewSubmissionResponse {
+	if b.forms == nil || callback.Type != slack.InteractionTypeViewSubmission || callback.View.CallbackID != formCallbackID {
+		return nil
+	}
+	session, ok := b.forms.sessions.Get(callback.View.PrivateMetadata)
+	if !ok {
+		return nil
+	}
+	view := formNoticeView(b.forms.forms[session.form], ":hourglass_flowing_sand: Checking your answers…")
+	return slack.NewUpdateViewSubmissionResponse(&view)
+}
+
+// formSubmitted has the model check the values submitted through a form modal, asking about what is still
+// missing in the modal again or delivering the form when it is complete or has been submitted
+// maxFormRounds times
+func (b *bot) formSubmitted(ctx context.Context, api *slack.Client, callback *slack.InteractionCallback) {
+	if b.forms == nil {
+		return
+	}
+	id := callback.View.PrivateMetadata
+	session, ok := b.forms.sessions.Get(id)
+	if !ok {
+		b.logger.Printf("ignored submission of expired form %q\n", id)
+		return
+	}
+	form := b.forms.forms[session.form]
+	entered := make(map[string]string, len(form.Fields))
+	for i, field := range form.Fields {
+		value := strings.TrimSpace(callback.View.State.Values[formBlockID(i, session.round)][formValueActionID].Value)
+		if value != "" {
+			entered[field.Name] = value
+		}
+	}
+	session.round++
+	step, err := chatgpt.GetFormStep(b.gptClient, ctx, form.purpose(), form.fields(), session.said, entered)
+	if err != nil {
+		// what the user entered is delivered as it is
+		b.logger.Printf("failed checking %v of %v: %v\n", form.Name, session.user, err)
+		step = chatgpt.FormStep{Complete: true}
+	}
+	if step.Values == nil {
+		step.Values = make(map[string]string, len(entered))
+	}
+	// the user has the last word on the values they entered
+	for name, value := range entered {
+		step.Values[name] = value
+	}
+	session.step = step
+	if !step.Complete && session.round < maxFormRounds {
+		b.forms.sessions.Set(id, session)
+		if _, err := api.UpdateViewContext(ctx, b.forms.modal(id, session), "", "", callback.View.ID); err != nil {
+			b.logger.Printf("failed updating form modal: %v\n", err)
+		}
+		return
+	}
+	b.forms.sessions.Delete(id)
+	done := fmt.Sprintf(":white_check_mark: Thanks, your %s was sent.", slackEscaper.Replace(form.Name))
+	if err := b.deliverForm(ctx, api, form, session); err != nil {
+		b.logger.Printf("failed delivering %v of %v: %v\n", form.Name, session.user, err)
+		done = fmt.Sprintf(":warning: Your %s could not be sent. Please try again later.", slackEscaper.Replace(form.Name))
+	}
+	if _, err := api.UpdateViewContext(ctx, formNoticeView(form, done), "", "", callback.View.ID); err != nil {
+		b.logger.Printf("failed updating form modal: %v\n", err)
+	}
+}
+
+// deliverForm posts the form filled in in session to the form's channel, or the conversation it was asked
+// for in, and delivers it to the form's webhook
+func (b *bot) deliverForm(ctx context.Context, api *slack.Client, form Form, session formSession) error {
+	filled := FilledForm{Form: form.Name, User: session.user, Values: session.step.Values, Summary: session.step.Summary}
+	var text strings.Builder
+	fmt.Fprintf(&text, "*%s* from <@%s>\n", slackEscaper.Replace(form.Name), session.user)
+	if filled.Summary != "" {
+		fmt.Fprintf(&text, "_%s_\n", slackEscaper.Replace(filled.Summary))
+	}
+	for _, field := range form.Fields {
+		label := field.Label
+		if label == "" {
+			label = field.Name
+		}
+		value := filled.Values[field.Name]
+		if value == "" {
+			value = "_not given_"
+		} else {
+			value = slackEscaper.Replace(value)
+		}
+		fmt.Fprintf(&text, "*%s:* %s\n", slackEscaper.Replace(label), value)
+	}
+	channel, threadTS := form.Channel, ""
+	if channel == "" {
+		channel, threadTS = session.channel, session.threadTS
+	}
+	options := []slack.MsgOption{slack.MsgOptionText(text.String(), false)}
+	if threadTS != "" {
+		options = append(options, slack.MsgOptionTS(threadTS))
+	}
+	if _, _, err := api.PostMessageContext(ctx, channel, options...); err != nil {
+		return fmt.Errorf("posting form: %w", err)
+	}
+	if form.Webhook != "" {
+		// the webhook is retried in the background, the form is dead-lettered when it cannot be delivered
+		b.forms.webhooks.Deliver(form.Webhook, FormFilledEvent, filled)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package slackhandler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// formModel fills in the summary of a bug report from what the user said, and asks for the steps until
+// they are entered
+type formModel struct{}
+
+func (formModel) CreateChatCompletion(_ context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	content := `{"values": {"summary": "Export does nothing"}, "questions": {"steps": "What did you click?"}, "complete": false}`
+	if strings.Contains(req.Messages[1].Content, `"steps"`) {
+		content = `{"values": {"summary": "Export does nothing in Safari"}, "complete": true, "summary": "Export is broken in Safari."}`
+	}
+	message := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content}
+	return openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{Message: message}}}, nil
+}
+
+func TestForms(t *testing.T) {
+	ctx := context.Background()
+	slackServer := fake.NewSlack()
+	t.Cleanup(slackServer.Close)
+	deliveries := make(chan FilledForm, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var delivered FilledForm
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&delivered))
+		assert.Equal(t, FormFilledEvent, r.Header.Get("X-Slackgpt-Event"))
+		deliveries <- delivered
+	}))
+	t.Cleanup(webhook.Close)
+	api := slack.New("xoxb-test", slack.OptionAPIURL(slackServer.APIURL()))
+	b := newBot(EventHandlerArgs{Logger: logger, GPTClient: formModel{}, Forms: []Form{{
+		Name:    "bug report",
+		Channel: "C0BUGS",
+		Webhook: webhook.URL,
+		Fields: []FormField{
+			{Name: "summary", Label: "Summary"},
+			{Name: "steps", Label: "Steps to reproduce", Multiline: true},
+		},
+	}}})
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> form", Channel: "C1", TimeStamp: "1.000001"})
+	messages := slackServer.Messages()
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0].Text, "`bug report`", "the forms are listed when none is named")
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> form Bug Report: export does nothing", Channel: "C1", TimeStamp: "2.000001"})
+	messages = slackServer.Messages()
+	require.Len(t, messages, 2)
+	var id string
+	for key, session := range sessions(b) {
+		id = key
+		assert.Equal(t, "export does nothing", session.said)
+	}
+	require.NotEmpty(t, id)
+	assert.Contains(t, messages[1].Blocks, `"value":"`+id+`"`)
+
+	click := &slack.InteractionCallback{Type: slack.InteractionTypeBlockActions, TriggerID: "T1"}
+	click.Channel.ID, click.User.ID = "C1", "U2"
+	click.ActionCallback.BlockActions = []*slack.BlockAction{{ActionID: formActionID, Value: id}}
+	b.handleInteraction(ctx, api, click)
+	assert.Empty(t, slackServer.Views(), "only the user who asked for the form fills it in")
+	require.Len(t, slackServer.Ephemerals(), 1)
+
+	click.User.ID = "U1"
+	b.handleInteraction(ctx, api, click)
+	views := slackServer.Views()
+	require.Len(t, views, 1)
+	assert.Contains(t, views[0].View, `"initial_value":"Export does nothing"`)
+	assert.Contains(t, views[0].View, "What did you click?")
+
+	submission := &slack.InteractionCallback{Type: slack.InteractionTypeViewSubmission}
+	submission.User.ID = "U1"
+	submission.View.ID, submission.View.CallbackID, submission.View.PrivateMetadata = "V1", formCallbackID, id
+	submission.View.State = &slack.ViewState{Values: map[string]map[string]slack.BlockAction{
+		formBlockID(0, 0): {formValueActionID: {Value: "Export does nothing"}},
+	}}
+	require.NotNil(t, b.formSubmissionResponse(submission))
+	b.handleInteraction(ctx, api, submission)
+	views = slackServer.Views()
+	require.Len(t, views, 2)
+	assert.Equal(t, "V1", views[1].ViewID)
+	assert.Contains(t, views[1].View, formBlockID(1, 1), "the form is asked for again while it is not complete")
+	assert.Len(t, slackServer.Messages(), 2)
+
+	submission.View.State.Values = map[string]map[string]slack.BlockAction{
+		formBlockID(0, 1): {formValueActionID: {Value: "Export does nothing"}},
+		formBlockID(1, 1): {formValueActionID: {Value: "Click export in Safari"}},
+	}
+	b.handleInteraction(ctx, api, submission)
+	views = slackServer.Views()
+	require.Len(t, views, 3)
+	assert.Contains(t, views[2].View, "was sent")
+	messages = slackServer.Messages()
+	require.Len(t, messages, 3)
+	assert.Equal(t, "C0BUGS", messages[2].Channel)
+	assert.Contains(t, messages[2].Text, "*Steps to reproduce:* Click export in Safari")
+	assert.Equal(t, FilledForm{
+		Form:    "bug report",
+		User:    "U1",
+		Values:  map[string]string{"summary": "Export does nothing", "steps": "Click export in Safari"},
+		Summary: "Export is broken in Safari.",
+	}, <-deliveries, "the values the user entered win over the model's")
+	assert.Empty(t, sessions(b), "delivered forms are forgotten")
+}
+
+// sessions returns the forms being filled in by session ID
+func sessions(b *bot) map[string]formSession {
+	all := map[string]formSession{}
+	b.forms.sessions.Range(func(key string, session formSession) {
+		all[key] = session
+	})
+	return all
+}
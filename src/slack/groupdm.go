@@ -0,0 +1,98 @@
+package slackhandler
+
+import (
+	"context"
+	"fmt"
+	"github.com/slack-go/slack"
+	"strings"
+	"sync"
+)
+
+// groupDMs remembers which channels are multi-person direct messages and who is in them. Members cannot be added
+// to a group DM, adding someone starts a new one, so what is looked up never goes stale.
+type groupDMs struct {
+	mu sync.Mutex
+	// members of the group DMs other than the bot, nil for channels that are not group DMs
+	members map[string][]string
+}
+
+// groupDM returns the members of channel other than the bot, reporting false when it is not a group DM. Mentions
+// do not say where they were made, so the channel is looked up the first time, which needs the mpim:read scope,
+// and channels:read or groups:read for other channels. A channel that cannot be looked up is taken for a channel.
+func (b *bot) groupDM(ctx context.Context, api *slack.Client, channel string) ([]string, bool) {
+	// one to one DMs are the only channels starting with D
+	if strings.HasPrefix(channel, "D") {
+		return nil, false
+	}
+	b.groupDMs.mu.Lock()
+	members, known := b.groupDMs.members[channel]
+	b.groupDMs.mu.Unlock()
+	if known {
+		return members, members != nil
+	}
+	members, err := b.lookUpGroupDM(ctx, api, channel)
+	if err != nil {
+		b.logger.Printf("failed looking up channel %v, answering as in a channel: %v\n", channel, err)
+		members = nil
+	}
+	b.groupDMs.mu.Lock()
+	defer b.groupDMs.mu.Unlock()
+	if b.groupDMs.members == nil {
+		b.groupDMs.members = map[string][]string{}
+	}
+	b.groupDMs.members[channel] = members
+	return members, members != nil
+}
+
+// lookUpGroupDM returns the members of channel other than the bot, nil when it is not a group DM
+func (b *bot) lookUpGroupDM(ctx context.Context, api *slack.Client, channel string) ([]string, error) {
+	info, err := api.GetConversationInfoContext(ctx, &slack.GetConversationInfoInput{ChannelID: channel})
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsMpIM {
+		return nil, nil
+	}
+	self, _, err := b.self.get(ctx, api)
+	if err != nil {
+		return nil, err
+	}
+	members := []string{}
+	params := &slack.GetUsersInConversationParameters{ChannelID: channel}
+	for {
+		page, cursor, err := api.GetUsersInConversationContext(ctx, params)
+		if err != nil {
+			return nil, fmt.Errorf("listing members: %w", err)
+		}
+		for _, member := range page {
+			if member != self {
+				members = append(members, member)
+			}
+		}
+		if cursor == "" {
+			return members, nil
+		}
+		params.Cursor = cursor
+	}
+}
+
+// membersAgreed checks that every member of a group DM other than user, who was checked already, consented and
+// acknowledged the usage policy: they all see the answer and their messages are part of the shared conversation.
+// Members who have not are asked to, and user is told the question waits for them.
+func (b *bot) membersAgreed(ctx context.Context, api *slack.Client, channel, threadTS, user string, members []string) bool {
+	var waiting []string
+	for _, member := range members {
+		if member == user || b.ignoredUsers[member] {
+			continue
+		}
+		if !b.consented(ctx, api, channel, threadTS, member, "") || !b.policyAcknowledged(ctx, api, channel, threadTS, member, "") {
+			waiting = append(waiting, "<@"+member+">")
+		}
+	}
+	if len(waiting) == 0 {
+		return true
+	}
+	b.tell(ctx, api, channel, threadTS, user, "Everyone in this conversation sees my answers, so I answer once "+
+		strings.Join(waiting, ", ")+" agreed to how questions are used here. I asked them to. Please ask again then.")
+	return false
+}
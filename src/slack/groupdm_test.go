@@ -0,0 +1,53 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestGroupDM(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{})
+	slackServer.AddGroupDM("G1", "U0BOT", "U1", "U2")
+	ctx := context.Background()
+
+	members, ok := b.groupDM(ctx, api, "G1")
+	require.True(t, ok)
+	assert.Equal(t, []string{"U1", "U2"}, members, "the bot is no member to check")
+	_, ok = b.groupDM(ctx, api, "C1")
+	assert.False(t, ok)
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: "G1", TimeStamp: "1.000001"})
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U2", Text: "<@U0BOT> and rust?", Channel: "G1", TimeStamp: "2.000001"})
+	messages := slackServer.Messages()
+	require.Len(t, messages, 2)
+	assert.Empty(t, messages[0].ThreadTS, "group DMs are answered at the top level")
+	history, _ := b.convo.Get(ConversationKey("G1", ""))
+	assert.Equal(t, []string{"what is go", "fake answer to: what is go", "and rust?", "fake answer to: and rust?"}, history,
+		"the group shares one conversation")
+
+	b.handleMessage(ctx, api, &slackevents.MessageEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: "G1", ChannelType: "mpim", TimeStamp: "3.000001"})
+	assert.Len(t, slackServer.Messages(), 2, "questions in group DMs arrive as mentions")
+}
+
+func TestGroupDMConsent(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{RequireConsent: true})
+	slackServer.AddGroupDM("G1", "U0BOT", "U1", "U2")
+	require.NoError(t, b.consents.Record("U1", time.Now()))
+	ctx := context.Background()
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: "G1", TimeStamp: "1.000001"})
+	assert.Empty(t, slackServer.Messages(), "every member has to agree first")
+	ephemerals := slackServer.Ephemerals()
+	require.Len(t, ephemerals, 2)
+	assert.Equal(t, "U2", ephemerals[0].User, "the member who has not agreed is asked to")
+	assert.Equal(t, "U1", ephemerals[1].User)
+	assert.Contains(t, ephemerals[1].Text, "<@U2>")
+
+	require.NoError(t, b.consents.Record("U2", time.Now()))
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: "G1", TimeStamp: "2.000001"})
+	assert.Len(t, slackServer.Messages(), 1)
+}
@@ -0,0 +1,230 @@
+package slackhandler
+
+import (
+	"context"
+	"fmt"
+	"github.com/slack-go/slack"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxHelpPersona is the most characters of the system prompt shown in help
+const maxHelpPersona = 500
+
+// helpCommandPattern matches the help command, only "help" alone so that questions about help are answered
+var helpCommandPattern = regexp.MustCompile(`(?is)^(?:<@[A-Z0-9]+>\s*)?help\s*$`)
+
+// helpCommand answers the help command of a mention or direct message with the help card, reporting whether
+// text was the command. /gpt help is answered with respondHelp.
+func (b *bot) helpCommand(ctx context.Context, api *slack.Client, channel, threadTS, user, text string) bool {
+	if !helpCommandPattern.MatchString(strings.TrimSpace(text)) {
+		return false
+	}
+	fallback, blocks := b.helpCard(channel, user)
+	options := []slack.MsgOption{slack.MsgOptionText(fallback, false), slack.MsgOptionBlocks(blocks...)}
+	if threadTS != "" {
+		options = append(options, slack.MsgOptionTS(threadTS))
+	}
+	if _, _, err := api.PostMessageContext(ctx, channel, options...); err != nil {
+		b.logger.Printf("failed answering help command: %v\n", err)
+	}
+	return true
+}
+
+// respondHelp answers the help command sent as a slash command with the help card, only to its user
+func (b *bot) respondHelp(ctx context.Context, cmd *slack.SlashCommand) {
+	text, blocks := b.helpCard(cmd.ChannelID, cmd.UserID)
+	msg := &slack.WebhookMessage{Text: text, Blocks: &slack.Blocks{BlockSet: blocks}, ResponseType: slack.ResponseTypeEphemeral}
+	if err := slack.PostWebhookContext(ctx, cmd.ResponseURL, msg); err != nil {
+		b.logger.Printf("failed responding to help command: %v\n", err)
+	}
+}
+
+// helpCard returns the help for user in channel as a text fallback and blocks. It is generated from what is
+// enabled: the commands user can use, the tools the model answers with, its persona in channel and the
+// policies that apply there.
+func (b *bot) helpCard(channel, user string) (string, []slack.Block) {
+	sections := []struct {
+		title string
+		lines []string
+	}{
+		{"Commands", b.helpCommands(user)},
+		{"Tools", b.helpTools(channel)},
+		{"Persona", b.helpPersona(channel)},
+		{"Channel policy", b.helpPolicy(channel)},
+	}
+	blocks := []slack.Block{slack.NewHeaderBlock(slack.NewTextBlockObject(slack.PlainTextType, "What I can do", false, false))}
+	for _, section := range sections {
+		text := "*" + section.title + "*\n" + strings.Join(section.lines, "\n")
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, nil))
+	}
+	return "Here is what I can do.", blocks
+}
+
+// helpCommands lists the commands user can use, the admin commands only for admins
+func (b *bot) helpCommands(user string) []string {
+	lines := []string{
+		"• Mention me with a question, or send it to me directly: I answer in a thread, where follow-ups continue the conversation",
+		"• `" + gptSpec.Usage() + "`: " + gptSpec.Summary,
+		"• `privately: <question>` when you mention me: only you see the answer, and only your private questions continue it",
+		"• `off the record: <question>` when you mention me or in a direct message: nothing of the exchange is kept",
+		"• `reset` in a thread or direct message, or `" + resetSpec.Usage() + "` in a direct message: forget the conversation so far",
+		"• `system: <prompt>` in a thread you started, or `" + systemSpec.Usage() + "` in a direct message: answer with your own system prompt there, `system` shows it",
+		"• `reactions [message link]`: summarize how a message was received",
+		"• `pin this as context` in a thread, or `pin <message link>`: keep the message before, or the one linked, in mind for the rest of the thread; `unpin` forgets the pinned messages",
+	}
+	if b.imaging != nil {
+		lines = append(lines, "• `"+imagineSpec.Usage()+"`: "+imagineSpec.Summary)
+	}
+	if b.transcription != nil {
+		lines = append(lines, "• `"+transcribeSpec.Usage()+"`: "+transcribeSpec.Summary)
+	}
+	if b.forms != nil {
+		names := make([]string, len(b.forms.forms))
+		for i, form := range b.forms.forms {
+			names[i] = "`" + form.Name + "`"
+		}
+		lines = append(lines, "• `form <name>: <what it is about>`: fill in a form with my help, one of "+strings.Join(names, ", "))
+	}
+	if b.scheduling != nil {
+		lines = append(lines, "• `schedule <what to post> to #channel <when>`: draft a post and schedule it once you confirm, `schedule list` and `schedule cancel <id>` manage your scheduled posts")
+	}
+	if b.actionItems != nil {
+		lines = append(lines, "• `/gpt actions`: list the open action items of the channel, found in the summaries I posted, to mark them done or be reminded of them")
+	}
+	if tier := b.overrides.tier(user); tier != nil {
+		lines = append(lines, "• `[model=… temp=… max_tokens=…] <question>`: answer one question differently, "+tierLimits(tier))
+	}
+	if b.usage != nil {
+		lines = append(lines, "• `"+usageSpec.Usage()+"`: "+usageSpec.Summary)
+	}
+	lines = append(lines, "• `"+statusSpec.Usage()+"`: "+statusSpec.Summary)
+	if b.models != nil {
+		lines = append(lines, "• `"+modelSpec.Usage()+"`: "+modelSpec.Summary)
+	}
+	if b.admins[user] {
+		lines = append(lines, "• `prompt history|set|rollback [#channel]`: manage the system prompts (admins only)")
+		if b.faqs != nil {
+			lines = append(lines, "• `faq list|add|remove`: manage the FAQs (admins only)")
+		}
+		if b.feedback != nil {
+			lines = append(lines, "• `"+feedbackReportSpec.Usage()+"`: "+feedbackReportSpec.Summary)
+		}
+	}
+	return append(lines, "• `help`: show this help")
+}
+
+// helpTools lists what the model answers with in channel besides the conversation
+func (b *bot) helpTools(channel string) []string {
+	var lines []string
+	if b.directory != nil && b.directory.lookup {
+		lines = append(lines, "• The directory, to answer who is who and who is in which user group")
+	}
+	if b.directory != nil && len(b.directory.owners) > 0 {
+		topics := make([]string, 0, len(b.directory.owners))
+		for topic := range b.directory.owners {
+			topics = append(topics, topic)
+		}
+		sort.Strings(topics)
+		lines = append(lines, "• Who owns "+strings.Join(topics, ", "))
+	}
+	if b.tools != nil {
+		if names := b.tools.names(); len(names) > 0 {
+			lines = append(lines, "• Tools I may call while answering: `"+strings.Join(names, "`, `")+"`")
+		}
+	}
+	if b.bookmarks != nil && b.bookmarks.channels[channel] {
+		lines = append(lines, "• The pages bookmarked in this channel")
+	}
+	if b.deflection.appliesTo(channel) && b.deflection.knowledge != "" {
+		lines = append(lines, "• The support knowledge base")
+	}
+	if b.faqs != nil {
+		if n := len(b.faqs.store.List()); n > 0 {
+			lines = append(lines, fmt.Sprintf("• %d FAQs, new questions like them are answered with their answers", n))
+		}
+	}
+	if b.vision != nil {
+		lines = append(lines, "• The images attached to questions, looked at with `"+b.vision.model+"`")
+	}
+	if b.clarify {
+		lines = append(lines, "• Buttons asking what ambiguous questions mean before answering them")
+	}
+	if b.branches != nil {
+		names := make([]string, len(b.branches.variants))
+		for i, variant := range b.branches.variants {
+			names[i] = variant.Name
+		}
+		lines = append(lines, "• A *Try again differently* menu on answers: "+strings.Join(names, ", "))
+	}
+	if b.escalation != nil {
+		lines = append(lines, "• An *Ask a human* button on answers, tagging <!subteam^"+b.escalation.group+">")
+	}
+	if len(lines) == 0 {
+		return []string{"_None, I answer from the conversation alone._"}
+	}
+	return lines
+}
+
+// helpPersona describes the system prompt in use in channel
+func (b *bot) helpPersona(channel string) []string {
+	persona := b.systemPrompt(channel)
+	if runes := []rune(persona); len(runes) > maxHelpPersona {
+		persona = string(runes[:maxHelpPersona]) + "…"
+	}
+	scope := "the default one"
+	if v, ok := b.prompts.Current(channel); ok && v.Prompt != "" {
+		scope = fmt.Sprintf("version %d of this channel's", v.Version)
+	} else if v, ok := b.prompts.Current(defaultPromptScope); ok && v.Prompt != "" {
+		scope = fmt.Sprintf("version %d of the default one", v.Version)
+	}
+	lines := []string{
+		"> " + strings.ReplaceAll(slackEscaper.Replace(persona), "\n", "\n> "),
+		"_This system prompt is " + scope + "._",
+	}
+	if model := b.channels[channel].Model; model != "" {
+		lines = append(lines, "_Questions here are answered with "+model+"._")
+	}
+	return lines
+}
+
+// helpPolicy lists the limits and policies that apply to questions asked in channel
+func (b *bot) helpPolicy(channel string) []string {
+	var lines []string
+	if b.consents != nil {
+		lines = append(lines, "• You agree to how your questions are used before your first one is answered")
+	}
+	if b.policy != nil {
+		lines = append(lines, "• The usage policy has to be acknowledged before questions are answered")
+	}
+	if b.moderation != nil {
+		lines = append(lines, "• Questions are checked against the content policy, flagged ones may be refused")
+	}
+	if b.limits != nil && b.limits.users != nil {
+		lines = append(lines, fmt.Sprintf("• Each person may ask %d questions per %v", b.limits.users.limit, b.limits.users.window))
+	}
+	if b.limits != nil && b.limits.channels != nil {
+		lines = append(lines, fmt.Sprintf("• This channel may ask %d questions per %v", b.limits.channels.limit, b.limits.channels.window))
+	}
+	if b.hedge.appliesTo(channel) {
+		action := "caveated"
+		if b.hedge.action == HedgeRefuse {
+			action = "withheld"
+		}
+		lines = append(lines, fmt.Sprintf("• Answers I'm less than %d%% confident in are %s. %s", b.hedge.threshold, action, b.hedge.askHuman()))
+	}
+	if b.deflection.appliesTo(channel) {
+		lines = append(lines, "• This is a support channel: new questions get buttons to mark them resolved or ask the support team")
+	}
+	if !b.retains(channel) {
+		lines = append(lines, "• Nothing of the exchanges here is kept: no conversation history, only counts")
+	}
+	if b.batching.lowPriority(channel) {
+		lines = append(lines, "• Questions here are low priority: they're queued and answered "+b.batching.when()+" at a lower cost")
+	}
+	if len(lines) == 0 {
+		return []string{"_No limits or policies apply here._"}
+	}
+	return lines
+}
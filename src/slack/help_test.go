@@ -0,0 +1,130 @@
+package slackhandler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// cardText returns the text of the sections of a help card
+func cardText(blocks []slack.Block) string {
+	var texts []string
+	for _, block := range blocks {
+		if section, ok := block.(*slack.SectionBlock); ok {
+			texts = append(texts, section.Text.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+func TestHelpCard(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    EventHandlerArgs
+		channel string
+		user    string
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "nothing enabled",
+			channel: "C1",
+			user:    "U1",
+			want: []string{
+				"`/gpt [flags] <question>`", "`help`: show this help", "_None, I answer from the conversation alone._",
+				"_No limits or policies apply here._", "_This system prompt is the default one._",
+			},
+			notWant: []string{"/imagine", "transcribe", "temp=", "content policy", "form <name>", "prompt history", "Each person"},
+		},
+		{
+			name: "everything enabled",
+			args: EventHandlerArgs{
+				AdminUsers: []string{"U1"}, Images: true, Transcribe: true, Vision: true, Clarify: true,
+				Forms:                []Form{{Name: "bug report", Fields: []FormField{{Name: "summary"}}}},
+				DirectoryLookup:      true,
+				Owners:               map[string]string{"billing": "<@U2>"},
+				EscalationGroup:      "S0ONCALL",
+				BranchVariants:       []BranchVariant{{Name: "More detail"}},
+				UserRateLimit:        5,
+				RateLimitWindow:      time.Hour,
+				Hedge:                HedgeRefuse,
+				ConfidenceThreshold:  70,
+				HumanChannel:         "C0HUMANS",
+				ChannelSystemPrompts: map[string]string{"C1": "Answer like a pirate."},
+				OverrideTiers:        testOverrideTiers,
+				Moderation:           true,
+			},
+			channel: "C1",
+			user:    "U1",
+			want: []string{
+				"answer one question differently, the power tier may choose one of gpt-4o, gpt-3.5-turbo, temp up to 2, max_tokens up to 4000",
+				"`/imagine <what to draw>`", "`transcribe [flags] [message link]`", "`bug report`",
+				"prompt history|set|rollback", "who is in which user group", "Who owns billing", "looked at with `gpt-4o`",
+				"ambiguous questions", "More detail", "<!subteam^S0ONCALL>", "Each person may ask 5 questions per 1h0m0s",
+				"less than 70% confident in are withheld. You can also ask in <#C0HUMANS>.",
+				"> Answer like a pirate.", "_This system prompt is version 1 of this channel's._", "content policy",
+			},
+		},
+		{
+			name: "not an admin, in another channel",
+			args: EventHandlerArgs{
+				AdminUsers: []string{"U1"}, Hedge: HedgeCaveat, HedgeChannels: []string{"C1"},
+				ChannelSystemPrompts: map[string]string{"C1": "Answer like a pirate."},
+			},
+			channel: "C2",
+			user:    "U2",
+			notWant: []string{"prompt history", "confident", "pirate"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _, _ := newFakeBot(t, tt.args)
+			fallback, blocks := b.helpCard(tt.channel, tt.user)
+			assert.NotEmpty(t, fallback)
+			text := cardText(blocks)
+			for _, want := range tt.want {
+				assert.Contains(t, text, want)
+			}
+			for _, notWant := range tt.notWant {
+				assert.NotContains(t, text, notWant)
+			}
+		})
+	}
+}
+
+func TestHelpCommand(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{})
+	ctx := context.Background()
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> help", Channel: "C1", TimeStamp: "1.000001"})
+	messages := slackServer.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, "1.000001", messages[0].ThreadTS)
+	assert.Contains(t, messages[0].Blocks, "What I can do")
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> help me with go", Channel: "C1", TimeStamp: "2.000001"})
+	messages = slackServer.Messages()
+	require.Len(t, messages, 2)
+	assert.Equal(t, "```fake answer to: help me with go```", messages[1].Text, "questions about help are answered")
+
+	var responses []slack.WebhookMessage
+	responseServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg slack.WebhookMessage
+		_ = json.NewDecoder(r.Body).Decode(&msg)
+		responses = append(responses, msg)
+	}))
+	defer responseServer.Close()
+	b.handleSlashCommand(ctx, api, &slack.SlashCommand{Command: gptCommand, Text: "help", UserID: "U1", ChannelID: "C1", ResponseURL: responseServer.URL})
+	require.Len(t, responses, 1)
+	assert.Equal(t, slack.ResponseTypeEphemeral, responses[0].ResponseType)
+	require.NotNil(t, responses[0].Blocks)
+	assert.Contains(t, cardText(responses[0].Blocks.BlockSet), "`/gpt [flags] <question>`")
+	assert.Len(t, slackServer.Messages(), 2)
+}
@@ -0,0 +1,252 @@
+package slackhandler
+
+import (
+	"context"
+	"fmt"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/slack-go/slack/socketmode"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// homeSaveActionID saves the settings entered in the App Home tab
+	homeSaveActionID = "slackgpt_home_save"
+	// homeLanguageBlockID, homePersonaBlockID and homePrivacyBlockID are the inputs of the App Home tab, each with
+	// a single element of the same ID
+	homeLanguageBlockID = "slackgpt_home_language"
+	homePersonaBlockID  = "slackgpt_home_persona"
+	homePrivacyBlockID  = "slackgpt_home_privacy"
+	// homeDefaultPersona is the persona option keeping the channel's system prompt
+	homeDefaultPersona = "default"
+	// homeOffRecord and homePrivate are the privacy checkboxes of the App Home tab
+	homeOffRecord = "off_record"
+	homePrivate   = "private"
+	// maxLanguage is the most characters of a preferred language
+	maxLanguage = 50
+)
+
+// UserSettings are what a user chose in the bot's App Home tab
+type UserSettings struct {
+	// Language is the language answers are written in, e.g. Japanese, that of the question when empty
+	Language string
+	// Persona is the name of the branch variant whose system prompt answers the user, the channel's when empty
+	Persona string
+	// OffRecord keeps nothing of the user's exchanges, as if they asked every question off the record
+	OffRecord bool
+	// Private answers the user's mentions only to them, as if they asked every question privately
+	Private bool
+}
+
+// UserSettingsStore keeps the settings of users by user ID. With a path the settings are kept in a JSON file so
+// they survive restarts.
+type UserSettingsStore struct {
+	mu       sync.Mutex
+	path     string
+	settings map[string]UserSettings
+}
+
+// NewUserSettingsStore creates a user settings store backed by the JSON file at path, which is created on the
+// first settings saved if it does not exist. An empty path keeps them in memory only.
+func NewUserSettingsStore(path string) (*UserSettingsStore, error) {
+	s := &UserSettingsStore{path: path, settings: map[string]UserSettings{}}
+	if path == "" {
+		return s, nil
+	}
+	if err := loadJSON(path, &s.settings); err != nil {
+		return nil, fmt.Errorf("reading user settings: %w", err)
+	}
+	if s.settings == nil {
+		s.settings = map[string]UserSettings{}
+	}
+	return s, nil
+}
+
+// Get returns the settings of user, the defaults when they saved none
+func (s *UserSettingsStore) Get(user string) UserSettings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.settings[user]
+}
+
+// Set saves the settings of user. They are kept in memory even when saving fails.
+func (s *UserSettingsStore) Set(user string, settings UserSettings) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settings[user] = settings
+	if s.path == "" {
+		return nil
+	}
+	if err := saveJSON(s.path, s.settings); err != nil {
+		return fmt.Errorf("saving user settings: %w", err)
+	}
+	return nil
+}
+
+// userSettings returns the settings of user, the defaults when they are not kept
+func (b *bot) userSettings(user string) UserSettings {
+	if b.settings == nil {
+		return UserSettings{}
+	}
+	return b.settings.Get(user)
+}
+
+// personaFor returns the system prompt answering user in channel: that of the persona they chose, else the
+// channel's, asking for their preferred language
+func (b *bot) personaFor(channel, user string) string {
+	settings := b.userSettings(user)
+	persona := b.systemPrompt(channel)
+	for _, variant := range b.personas() {
+		if variant.Name == settings.Persona {
+			persona = variant.SystemPrompt
+		}
+	}
+	return answerIn(persona, settings.Language)
+}
+
+// answerIn asks persona to always answer in language, when one is set
+func answerIn(persona, language string) string {
+	if language == "" {
+		return persona
+	}
+	return persona + "\n\nAlways answer in " + language + "."
+}
+
+// personas are the branch variants with a system prompt, which users can choose as their persona
+func (b *bot) personas() []BranchVariant {
+	if b.branches == nil {
+		return nil
+	}
+	var personas []BranchVariant
+	for _, variant := range b.branches.variants {
+		if variant.SystemPrompt != "" {
+			personas = append(personas, variant)
+		}
+	}
+	return personas
+}
+
+// handleAppHomeEvent publishes the App Home tab of the user who opened it
+func (b *bot) handleAppHomeEvent(ctx context.Context, api *slack.Client, evt *socketmode.Event) {
+	eventsAPIEvent, ok := evt.Data.(slackevents.EventsAPIEvent)
+	if !ok {
+		b.logger.Printf("Ignored %+v\n", evt)
+		return
+	}
+	ev, ok := eventsAPIEvent.InnerEvent.Data.(*slackevents.AppHomeOpenedEvent)
+	if !ok {
+		b.logger.Printf("Ignored %+v\n", evt)
+		return
+	}
+	b.appHomeOpened(ctx, api, ev)
+}
+
+// appHomeOpened publishes the App Home tab of the user who opened it, other tabs are ignored
+func (b *bot) appHomeOpened(ctx context.Context, api *slack.Client, ev *slackevents.AppHomeOpenedEvent) {
+	if b.settings == nil || ev.Tab != "home" || b.ignoredUsers[ev.User] {
+		return
+	}
+	b.publishHome(ctx, api, ev.User, "")
+}
+
+// publishHome publishes the App Home tab of user with notice, if any, above their settings
+func (b *bot) publishHome(ctx context.Context, api *slack.Client, user, notice string) {
+	if _, err := api.PublishViewContext(ctx, user, b.homeView(user, notice), ""); err != nil {
+		b.logger.Printf("failed publishing the App Home of %v: %v\n", user, err)
+	}
+}
+
+// homeView is the App Home tab of user: their spend this month when usage is tracked, and their settings
+func (b *bot) homeView(user, notice string) slack.HomeTabViewRequest {
+	settings := b.userSettings(user)
+	var blocks []slack.Block
+	if b.usage != nil {
+		month := time.Now().UTC().Format(usageMonth)
+		own := b.usage.store.Month(month)[:0:0]
+		for _, t := range b.usage.store.Month(month) {
+			if t.User == user {
+				own = append(own, t)
+			}
+		}
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, usageReport(own, month, false, b.usage), false, false), nil, nil), slack.NewDividerBlock())
+	}
+	blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, "*Your settings*", false, false), nil, nil))
+	if notice != "" {
+		blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, notice, false, false)))
+	}
+
+	language := slack.NewPlainTextInputBlockElement(slack.NewTextBlockObject(slack.PlainTextType, "e.g. Japanese", false, false), homeLanguageBlockID)
+	language.InitialValue = settings.Language
+	language.MaxLength = maxLanguage
+	languageBlock := slack.NewInputBlock(homeLanguageBlockID, slack.NewTextBlockObject(slack.PlainTextType, "Answer me in", false, false),
+		slack.NewTextBlockObject(slack.PlainTextType, "Leave empty to be answered in the language you ask in", false, false), language)
+	languageBlock.Optional = true
+	blocks = append(blocks, languageBlock)
+
+	if personas := b.personas(); len(personas) > 0 {
+		options := []*slack.OptionBlockObject{plainOption(homeDefaultPersona, "The channel's")}
+		initial := options[0]
+		for _, variant := range personas {
+			options = append(options, plainOption(variant.Name, variant.Name))
+			if variant.Name == settings.Persona {
+				initial = options[len(options)-1]
+			}
+		}
+		persona := slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, nil, homePersonaBlockID, options...)
+		persona.InitialOption = initial
+		personaBlock := slack.NewInputBlock(homePersonaBlockID, slack.NewTextBlockObject(slack.PlainTextType, "Default persona", false, false), nil, persona)
+		personaBlock.Optional = true
+		blocks = append(blocks, personaBlock)
+	}
+
+	offRecord := plainOption(homeOffRecord, "Keep my questions off the record: nothing of them is kept")
+	private := plainOption(homePrivate, "Answer my mentions only to me")
+	privacy := slack.NewCheckboxGroupsBlockElement(homePrivacyBlockID, offRecord, private)
+	if settings.OffRecord {
+		privacy.InitialOptions = append(privacy.InitialOptions, offRecord)
+	}
+	if settings.Private {
+		privacy.InitialOptions = append(privacy.InitialOptions, private)
+	}
+	privacyBlock := slack.NewInputBlock(homePrivacyBlockID, slack.NewTextBlockObject(slack.PlainTextType, "Privacy", false, false), nil, privacy)
+	privacyBlock.Optional = true
+	save := slack.NewButtonBlockElement(homeSaveActionID, "save", slack.NewTextBlockObject(slack.PlainTextType, "Save", false, false))
+	save.Style = slack.StylePrimary
+	blocks = append(blocks, privacyBlock, slack.NewActionBlock("slackgpt_home_actions", save))
+	return slack.HomeTabViewRequest{Type: slack.VTHomeTab, Blocks: slack.Blocks{BlockSet: blocks}}
+}
+
+// saveHomeSettings saves the settings entered in the App Home tab of who clicked Save, and publishes it again
+// saying so
+func (b *bot) saveHomeSettings(ctx context.Context, api *slack.Client, callback *slack.InteractionCallback) {
+	if b.settings == nil || callback.View.State == nil {
+		return
+	}
+	user, values := callback.User.ID, callback.View.State.Values
+	settings := b.userSettings(user)
+	settings.Language = strings.TrimSpace(values[homeLanguageBlockID][homeLanguageBlockID].Value)
+	if persona, ok := values[homePersonaBlockID][homePersonaBlockID]; ok {
+		settings.Persona = persona.SelectedOption.Value
+		if settings.Persona == homeDefaultPersona {
+			settings.Persona = ""
+		}
+	}
+	settings.OffRecord, settings.Private = false, false
+	for _, option := range values[homePrivacyBlockID][homePrivacyBlockID].SelectedOptions {
+		switch option.Value {
+		case homeOffRecord:
+			settings.OffRecord = true
+		case homePrivate:
+			settings.Private = true
+		}
+	}
+	notice := ":white_check_mark: Saved, your next questions are answered this way."
+	if err := b.settings.Set(user, settings); err != nil {
+		b.logger.Printf("failed saving the settings of %v: %v\n", user, err)
+		notice = ":warning: Saved until I restart, I could not keep them for longer."
+	}
+	b.logger.Printf("%s saved their settings\n", user)
+	b.publishHome(ctx, api, user, notice)
+}
@@ -0,0 +1,69 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+)
+
+func TestUserSettingsStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.json")
+	store, err := NewUserSettingsStore(path)
+	require.NoError(t, err)
+	assert.Equal(t, UserSettings{}, store.Get("U1"))
+	require.NoError(t, store.Set("U1", UserSettings{Language: "Japanese", Private: true}))
+
+	reloaded, err := NewUserSettingsStore(path)
+	require.NoError(t, err)
+	assert.Equal(t, UserSettings{Language: "Japanese", Private: true}, reloaded.Get("U1"))
+	assert.Equal(t, UserSettings{}, reloaded.Get("U2"))
+}
+
+func TestAppHome(t *testing.T) {
+	store, _ := NewUserSettingsStore("")
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{
+		UserSettings:   store,
+		BranchVariants: []BranchVariant{{Name: "Pirate", SystemPrompt: "Answer like a pirate."}, {Name: "Bigger model", Model: "gpt-4o"}},
+	})
+	model := &paramsModel{}
+	b.gptClient = model
+	ctx := context.Background()
+
+	b.appHomeOpened(ctx, api, &slackevents.AppHomeOpenedEvent{User: "U1", Channel: "D1", Tab: "messages"})
+	assert.Empty(t, slackServer.Views(), "only the Home tab is published")
+	b.appHomeOpened(ctx, api, &slackevents.AppHomeOpenedEvent{User: "U1", Channel: "D1", Tab: "home"})
+	views := slackServer.Views()
+	require.Len(t, views, 1)
+	assert.Equal(t, "U1", views[0].UserID)
+	assert.Contains(t, views[0].View, "Your settings")
+	assert.Contains(t, views[0].View, "Pirate")
+	assert.NotContains(t, views[0].View, "Bigger model", "only variants with a system prompt are personas")
+
+	callback := &slack.InteractionCallback{Type: slack.InteractionTypeBlockActions, User: slack.User{ID: "U1"}}
+	callback.ActionCallback.BlockActions = []*slack.BlockAction{{ActionID: homeSaveActionID, Value: "save"}}
+	callback.View.State = &slack.ViewState{Values: map[string]map[string]slack.BlockAction{
+		homeLanguageBlockID: {homeLanguageBlockID: {Value: " Japanese "}},
+		homePersonaBlockID:  {homePersonaBlockID: {SelectedOption: slack.OptionBlockObject{Value: "Pirate"}}},
+		homePrivacyBlockID:  {homePrivacyBlockID: {SelectedOptions: []slack.OptionBlockObject{{Value: homeOffRecord}}}},
+	}}
+	b.handleInteraction(ctx, api, callback)
+	assert.Equal(t, UserSettings{Language: "Japanese", Persona: "Pirate", OffRecord: true}, store.Get("U1"))
+	views = slackServer.Views()
+	require.Len(t, views, 2)
+	assert.Contains(t, views[1].View, "Saved")
+	assert.Contains(t, views[1].View, `"initial_value":"Japanese"`)
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go?", Channel: "C1", TimeStamp: "1.000001"})
+	system := model.last().Messages[0].Content
+	assert.Contains(t, system, "Answer like a pirate.")
+	assert.Contains(t, system, "Always answer in Japanese.")
+	_, kept := b.convo.Get(ConversationKey("C1", "1.000001"))
+	assert.False(t, kept, "the user's questions are off the record")
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U2", Text: "<@U0BOT> what is go?", Channel: "C1", TimeStamp: "2.000001"})
+	assert.Equal(t, b.systemPrompt("C1"), model.last().Messages[0].Content, "other users keep the channel's persona")
+}
@@ -0,0 +1,223 @@
+package slackhandler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/chikamif/slackgpt/src/metrics"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/slack-go/slack/socketmode"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxRequestBytes bounds the size of a request from slack, its payloads are far smaller
+	maxRequestBytes = 1 << 20
+	// httpShutdownTimeout is how long requests being read at shutdown may take before their connections are closed
+	httpShutdownTimeout = 5 * time.Second
+)
+
+// httpHandler answers the Events API, interactivity and slash command requests slack sends over HTTP. Each
+// request is verified with the app's signing secret and acknowledged right away, within slack's 3 second
+// deadline, then handled in a tracked goroutine the same way socket mode events are.
+type httpHandler struct {
+	signingSecret string
+	processor     *EventProcessor
+	// installer is nil when the app is not installed through OAuth
+	installer *installer
+	work      context.Context
+	metrics   *metrics.Metrics
+	wg        sync.WaitGroup
+}
+
+// HTTPEventHandler handles slack events, interactions and slash commands sent to addr over HTTP instead of
+// through socket mode, so no app-level token is needed and the bot can run behind a load balancer. The Events
+// API, Interactivity and Slash Commands request URLs of the app may all point to any path of addr but those of
+// the installation pages, which are served when args.OAuth has a client ID. It serves until args.Context is
+// cancelled or the server fails, then drains in-flight events like EventHandler.
+func HTTPEventHandler(args EventHandlerArgs, addr, signingSecret string) error {
+	args = args.withDefaults()
+	ctx := args.Context
+	work, stopWork := drainContext(ctx, args.DrainTimeout, args.Logger)
+	defer stopWork()
+
+	if args.OAuth.ClientID != "" && args.Installations == nil {
+		args.Installations, _ = NewInstallationStore("")
+	}
+	h := &httpHandler{
+		signingSecret: signingSecret,
+		processor:     NewEventProcessor(args),
+		work:          work,
+		metrics:       args.Metrics,
+	}
+	if args.OAuth.ClientID != "" {
+		h.installer = newInstaller(args.OAuth, args.Installations, args.Logger)
+	}
+	batches, stopBatches := context.WithCancel(work)
+	batchesDone := make(chan struct{})
+	go func() {
+		defer close(batchesDone)
+		h.processor.bot.runBatches(batches, args.SlackClient)
+	}()
+	load, stopLoad := context.WithCancel(ctx)
+	loadDone := make(chan struct{})
+	go func() {
+		defer close(loadDone)
+		h.processor.bot.runLoadStatus(load, args.SlackClient)
+	}()
+	quality, stopQuality := context.WithCancel(work)
+	qualityDone := make(chan struct{})
+	go func() {
+		defer close(qualityDone)
+		h.processor.bot.runQualitySampling(quality)
+	}()
+	defer func() {
+		stopQuality()
+		<-qualityDone
+		stopLoad()
+		<-loadDone
+		stopBatches()
+		<-batchesDone
+	}()
+	server := &http.Server{Addr: addr, Handler: h, ReadHeaderTimeout: 10 * time.Second}
+	serverErrors := make(chan error, 1)
+	go func() {
+		serverErrors <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErrors:
+		h.wg.Wait()
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), httpShutdownTimeout)
+	defer cancel()
+	err := server.Shutdown(shutdownCtx)
+	if serveErr := <-serverErrors; !errors.Is(serveErr, http.ErrServerClosed) {
+		err = serveErr
+	}
+	h.wg.Wait()
+	return err
+}
+
+// ServeHTTP verifies a request from slack and acknowledges it, answering url verification challenges and
+// replacing submitted form modals with a notice while they are checked. The installation pages are visited by
+// users rather than sent by slack, so they are not signed.
+func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.installer != nil && r.Method == http.MethodGet {
+		switch r.URL.Path {
+		case installPath:
+			h.installer.install(w, r)
+			return
+		case oauthCallbackPath:
+			h.installer.callback(w, r)
+			return
+		}
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBytes))
+	if err != nil {
+		http.Error(w, "failed reading body", http.StatusBadRequest)
+		return
+	}
+	verifier, err := slack.NewSecretsVerifier(r.Header, h.signingSecret)
+	if err != nil {
+		http.Error(w, "missing or stale signature", http.StatusUnauthorized)
+		return
+	}
+	verifier.Write(body)
+	if err := verifier.Ensure(); err != nil {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		h.serveEvent(w, r, body)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	if payload := r.PostForm.Get("payload"); payload != "" {
+		h.serveInteraction(w, payload)
+		return
+	}
+	cmd, err := slack.SlashCommandParse(r)
+	if err != nil || cmd.Command == "" {
+		http.Error(w, "unknown request", http.StatusBadRequest)
+		return
+	}
+	h.spawn(socketmode.Event{Type: socketmode.EventTypeSlashCommand, Data: cmd}, cmd.TeamID, h.processor.bot.handleSlashCommandEvent)
+	w.WriteHeader(http.StatusOK)
+}
+
+// serveEvent answers url verification challenges and handles event callbacks. Retries of events that took too
+// long to acknowledge are acknowledged again without being handled, so questions are not answered twice.
+func (h *httpHandler) serveEvent(w http.ResponseWriter, r *http.Request, body []byte) {
+	event, err := slackevents.ParseEvent(json.RawMessage(body), slackevents.OptionNoVerifyToken())
+	if err != nil {
+		http.Error(w, "invalid event", http.StatusBadRequest)
+		return
+	}
+	switch event.Type {
+	case slackevents.URLVerification:
+		var challenge slackevents.ChallengeResponse
+		if err := json.Unmarshal(body, &challenge); err != nil {
+			http.Error(w, "invalid challenge", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, challenge.Challenge)
+		return
+	case slackevents.CallbackEvent:
+		if r.Header.Get("X-Slack-Retry-Reason") == "http_timeout" {
+			break
+		}
+		evt := socketmode.Event{Type: socketmode.EventTypeEventsAPI, Data: event}
+		if callback, ok := event.Data.(*slackevents.EventsAPICallbackEvent); ok {
+			evt.Request = &socketmode.Request{EnvelopeID: callback.EventID}
+		}
+		h.spawn(evt, event.TeamID, func(ctx context.Context, _ *slack.Client, _ *socketmode.Event) {
+			h.processor.Process(ctx, event)
+		})
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// serveInteraction handles the interaction payload, acknowledging view submissions with their response, such as
+// the view a form is replaced with
+func (h *httpHandler) serveInteraction(w http.ResponseWriter, payload string) {
+	var callback slack.InteractionCallback
+	if err := json.Unmarshal([]byte(payload), &callback); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	resp := h.processor.bot.submissionResponse(&callback)
+	h.spawn(socketmode.Event{Type: socketmode.EventTypeInteractive, Data: callback}, callback.Team.ID, h.processor.bot.handleInteractiveEvent)
+	if resp == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// spawn handles evt, sent from the workspace teamID, with f through the bot's pipeline in a tracked goroutine
+// with the handler's work context. The event was acknowledged by answering its request.
+func (h *httpHandler) spawn(evt socketmode.Event, teamID string, f HandlerFunc) {
+	h.metrics.EventReceived(eventType(&evt))
+	h.wg.Add(1)
+	handle, api := h.processor.bot.handler(f), h.processor.workspaces.client(teamID)
+	go func() {
+		defer h.wg.Done()
+		handle(h.work, api, &evt)
+	}()
+}
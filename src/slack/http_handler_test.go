@@ -0,0 +1,139 @@
+package slackhandler
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSigningSecret = "signing-secret"
+
+// signedRequest builds a request signed the way slack signs them
+func signedRequest(secret, contentType, body string) *http.Request {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", ts, body)
+	r := httptest.NewRequest(http.MethodPost, "/slack/events", strings.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	r.Header.Set("X-Slack-Request-Timestamp", ts)
+	r.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return r
+}
+
+const httpMentionBody = `{"type":"event_callback","team_id":"T1","api_app_id":"A1","event_id":"Ev1",` +
+	`"event":{"type":"app_mention","user":"U1","text":"<@U0BOT> what is go","ts":"1.000001","channel":"C1"}}`
+
+func TestHTTPHandler(t *testing.T) {
+	slash := url.Values{
+		"command": {gptCommand}, "text": {"what is go"}, "user_id": {"U1"}, "channel_id": {"C1"},
+		"response_url": {"http://127.0.0.1:0"},
+	}.Encode()
+	retried := signedRequest(testSigningSecret, "application/json", httpMentionBody)
+	retried.Header.Set("X-Slack-Retry-Num", "1")
+	retried.Header.Set("X-Slack-Retry-Reason", "http_timeout")
+	tests := []struct {
+		name         string
+		request      *http.Request
+		wantStatus   int
+		wantBody     string
+		wantMessages []string
+	}{
+		{
+			name:       "unsigned",
+			request:    httptest.NewRequest(http.MethodPost, "/slack/events", strings.NewReader(httpMentionBody)),
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   "missing or stale signature\n",
+		},
+		{
+			name:       "wrong secret",
+			request:    signedRequest("other-secret", "application/json", httpMentionBody),
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   "invalid signature\n",
+		},
+		{
+			name:       "url verification",
+			request:    signedRequest(testSigningSecret, "application/json", `{"type":"url_verification","challenge":"c0ffee"}`),
+			wantStatus: http.StatusOK,
+			wantBody:   "c0ffee",
+		},
+		{
+			name:         "mention",
+			request:      signedRequest(testSigningSecret, "application/json", httpMentionBody),
+			wantStatus:   http.StatusOK,
+			wantMessages: []string{"```fake answer to: what is go```"},
+		},
+		{
+			name:       "retried after a timeout",
+			request:    retried,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:         "slash command",
+			request:      signedRequest(testSigningSecret, "application/x-www-form-urlencoded", slash),
+			wantStatus:   http.StatusOK,
+			wantMessages: []string{"*<@U1> asked:* what is go\n```fake answer to: what is go```"},
+		},
+		{
+			name:       "interaction",
+			request:    signedRequest(testSigningSecret, "application/x-www-form-urlencoded", url.Values{"payload": {`{"type":"block_actions","actions":[{"action_id":"unknown"}]}`}}.Encode()),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "invalid interaction",
+			request:    signedRequest(testSigningSecret, "application/x-www-form-urlencoded", url.Values{"payload": {"{"}}.Encode()),
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "invalid payload\n",
+		},
+		{
+			name:       "unknown form",
+			request:    signedRequest(testSigningSecret, "application/x-www-form-urlencoded", "ssl_check=1"),
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "unknown request\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, api, slackServer := newFakeBot(t, EventHandlerArgs{})
+			h := &httpHandler{signingSecret: testSigningSecret, processor: &EventProcessor{workspaces: newWorkspaces(api, nil, nil), bot: b}, work: context.Background()}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, tt.request)
+			h.wg.Wait()
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+			var texts []string
+			for _, message := range slackServer.Messages() {
+				texts = append(texts, message.Text)
+			}
+			assert.Equal(t, tt.wantMessages, texts)
+		})
+	}
+}
+
+func TestHTTPEventHandlerStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- HTTPEventHandler(EventHandlerArgs{Logger: logger, Context: ctx}, "127.0.0.1:0", testSigningSecret)
+	}()
+	cancel()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the handler did not stop")
+	}
+}
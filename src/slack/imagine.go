@@ -0,0 +1,137 @@
+package slackhandler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/command"
+	"github.com/chikamif/slackgpt/src/images"
+	"github.com/slack-go/slack"
+	"regexp"
+	"strings"
+)
+
+// imagineCommand draws a picture of its text
+const imagineCommand = "/imagine"
+
+// imagineSpec is the syntax of imagineCommand
+var imagineSpec = &command.Command{
+	Name:    imagineCommand,
+	Args:    "<what to draw>",
+	Summary: "Draw a picture and post it here, or mention me with `draw <what to draw>` to get it in a thread.",
+}
+
+// imagineUsage explains imagineCommand and the draw command to users who sent them without a prompt
+var imagineUsage = imagineSpec.Help()
+
+// drawCommandPattern matches the draw command, with what to draw
+var drawCommandPattern = regexp.MustCompile(`(?s)^(?:<@[A-Z0-9]+>\s*)?draw\b\s*(.*)$`)
+
+// imaging draws the pictures asked for with imagineCommand and the draw command
+type imaging struct {
+	generator images.Generator
+	// model and size are the image model and size, images.DefaultModel and images.DefaultSize when empty
+	model string
+	size  string
+}
+
+// draw draws prompt and uploads the image to channel, in the thread threadTS when it is not empty, with a
+// comment saying who asked for it
+func (b *bot) draw(ctx context.Context, api *slack.Client, channel, threadTS, user, prompt string) error {
+	image, err := images.Draw(ctx, b.imaging.generator, b.imaging.model, b.imaging.size, prompt)
+	if err != nil {
+		b.reportIncident(ctx, api, channel, err)
+		return fmt.Errorf("drawing: %w", err)
+	}
+	title := image.Prompt
+	if runes := []rune(title); len(runes) > 100 {
+		title = string(runes[:99]) + "…"
+	}
+	_, err = api.UploadFileContext(ctx, slack.FileUploadParameters{
+		Reader:          bytes.NewReader(image.PNG),
+		Filename:        "image.png",
+		Filetype:        "png",
+		Title:           title,
+		InitialComment:  fmt.Sprintf("*<@%s> asked for:* %s", user, slackEscaper.Replace(prompt)),
+		Channels:        []string{channel},
+		ThreadTimestamp: threadTS,
+	})
+	if err != nil {
+		return fmt.Errorf("uploading image: %w", err)
+	}
+	return nil
+}
+
+// drawCommand draws what a mention or direct message asks for with the draw command, reporting whether
+// text was the command
+func (b *bot) drawCommand(ctx context.Context, api *slack.Client, channel, threadTS, user, text string) bool {
+	if b.imaging == nil {
+		return false
+	}
+	match := drawCommandPattern.FindStringSubmatch(strings.TrimSpace(text))
+	if match == nil {
+		return false
+	}
+	var reply string
+	switch prompt := b.prompt(ctx, api, match[1]); {
+	case prompt == "":
+		reply = imagineUsage
+	case !b.withinRateLimit(ctx, api, channel, threadTS, user):
+		return true
+	default:
+		err := b.draw(ctx, api, channel, threadTS, user, prompt)
+		if err == nil {
+			return true
+		}
+		b.logger.Printf("failed drawing for %v: %v\n", user, err)
+		reply = "I could not draw that. Please try again, or ask for something else."
+	}
+	options := []slack.MsgOption{slack.MsgOptionText(reply, false)}
+	if threadTS != "" {
+		options = append(options, slack.MsgOptionTS(threadTS))
+	}
+	if _, _, err := api.PostMessageContext(ctx, channel, options...); err != nil {
+		b.logger.Printf("failed answering draw command: %v\n", err)
+	}
+	return true
+}
+
+// answerImagineCommand draws what imagineCommand asks for in the channel it was sent in, telling only the
+// user when it cannot
+func (b *bot) answerImagineCommand(ctx context.Context, api *slack.Client, cmd *slack.SlashCommand) {
+	if b.ignoredUsers[cmd.UserID] {
+		b.logger.Printf("Ignored slash command from ignored user %s\n", cmd.UserID)
+		return
+	}
+	if notice := b.accessNotice(ctx, api, cmd.ChannelID, cmd.UserID); notice != "" {
+		b.respond(ctx, cmd, completion{note: notice}, slack.ResponseTypeEphemeral)
+		return
+	}
+	if b.imaging == nil {
+		b.respond(ctx, cmd, completion{note: "Drawing pictures is not enabled."}, slack.ResponseTypeEphemeral)
+		return
+	}
+	inv, err := b.aliases.Parse(imagineSpec, cmd.Text)
+	if err != nil {
+		b.respond(ctx, cmd, completion{note: err.Error() + "\n" + inv.UsageText()}, slack.ResponseTypeEphemeral)
+		return
+	}
+	prompt := b.prompt(ctx, api, inv.Rest)
+	if inv.Help || prompt == "" {
+		b.respond(ctx, cmd, completion{note: imagineUsage}, slack.ResponseTypeEphemeral)
+		return
+	}
+	if !b.consented(ctx, api, cmd.ChannelID, "", cmd.UserID, "") ||
+		!b.policyAcknowledged(ctx, api, cmd.ChannelID, "", cmd.UserID, "") {
+		return
+	}
+	if notice := b.rateLimitNotice(ctx, api, cmd.UserID, cmd.ChannelID); notice != "" {
+		b.respond(ctx, cmd, completion{note: notice}, slack.ResponseTypeEphemeral)
+		return
+	}
+	if err := b.draw(ctx, api, cmd.ChannelID, "", cmd.UserID, prompt); err != nil {
+		b.logger.Printf("failed drawing for %v: %v\n", cmd.UserID, err)
+		// uploading fails in channels the bot is not a member of
+		b.respond(ctx, cmd, completion{note: "I could not draw that here. Please try again, or invite me to the channel first."}, slack.ResponseTypeEphemeral)
+	}
+}
@@ -0,0 +1,65 @@
+package slackhandler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDrawCommand(t *testing.T) {
+	ctx := context.Background()
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{Images: true})
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> draw a gopher on a <b>bike</b>", Channel: "C1", TimeStamp: "1.000001"})
+	files := slackServer.Files()
+	require.Len(t, files, 1)
+	assert.Equal(t, "C1", files[0].Channels)
+	assert.Equal(t, "1.000001", files[0].ThreadTS)
+	assert.Equal(t, "a drawing of a gopher on a <b>bike</b>", files[0].Title)
+	assert.Equal(t, "*<@U1> asked for:* a gopher on a &lt;b&gt;bike&lt;/b&gt;", files[0].InitialComment)
+	assert.Equal(t, []byte("\x89PNG"), files[0].Content[:4])
+	assert.Empty(t, slackServer.Messages())
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> draw", Channel: "C1", TimeStamp: "2.000001"})
+	messages := slackServer.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, imagineUsage, messages[0].Text)
+
+	b, api, slackServer = newFakeBot(t, EventHandlerArgs{})
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> draw a gopher", Channel: "C1", TimeStamp: "1.000001"})
+	assert.Empty(t, slackServer.Files(), "drawing is off unless enabled")
+	assert.Len(t, slackServer.Messages(), 1, "draw is answered as a question")
+}
+
+func TestImagineCommand(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{Images: true})
+	var responses []slack.WebhookMessage
+	responseServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg slack.WebhookMessage
+		_ = json.NewDecoder(r.Body).Decode(&msg)
+		responses = append(responses, msg)
+	}))
+	defer responseServer.Close()
+
+	imagine := func(text string) {
+		b.handleSlashCommand(context.Background(), api, &slack.SlashCommand{
+			Command: imagineCommand, Text: text, UserID: "U1", ChannelID: "C1", ResponseURL: responseServer.URL,
+		})
+	}
+	imagine("a gopher")
+	files := slackServer.Files()
+	require.Len(t, files, 1)
+	assert.Equal(t, "C1", files[0].Channels)
+	assert.Equal(t, "", files[0].ThreadTS)
+	assert.Empty(t, responses)
+
+	imagine(" ")
+	require.Len(t, responses, 1)
+	assert.Equal(t, imagineUsage, responses[0].Text)
+	assert.Equal(t, slack.ResponseTypeEphemeral, responses[0].ResponseType)
+}
@@ -0,0 +1,168 @@
+package slackhandler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"io"
+	"strings"
+	"time"
+)
+
+// importEmbedBatch is how many imported questions are embedded per request
+const importEmbedBatch = 100
+
+// ImportRecord is a question asked of another bot and its answer, a line of the JSONL export imported
+type ImportRecord struct {
+	Channel string `json:"channel"`
+	// ThreadTS is the timestamp of the thread the question was asked in, or of the question itself when it
+	// started the conversation. It is empty for questions asked in a DM outside of a thread.
+	ThreadTS string `json:"thread_ts"`
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+}
+
+// ReadImport reads the records of a JSONL export, oldest first. Blank lines are skipped.
+func ReadImport(r io.Reader) ([]ImportRecord, error) {
+	var records []ImportRecord
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<24)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var record ImportRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		switch {
+		case record.Channel == "":
+			return nil, fmt.Errorf("line %d: missing channel", line)
+		case strings.TrimSpace(record.Question) == "" || strings.TrimSpace(record.Answer) == "":
+			return nil, fmt.Errorf("line %d: missing question or answer", line)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// ImportOptions are where records are imported into
+type ImportOptions struct {
+	// Conversations get the questions and answers of their thread appended, as when they are asked, none when nil
+	Conversations ConversationStore
+	// FAQs get every question not registered yet with its answer, so similar questions are answered without the
+	// model, none when nil. Author is who they are registered by.
+	FAQs   *FAQStore
+	Author string
+	// Embedder embeds the imported questions with EmbeddingModel, the model FAQs are matched with. When nil they
+	// are embedded the first time a question is matched.
+	Embedder       chatgpt.Embedder
+	EmbeddingModel string
+}
+
+// ImportResult counts what an import changed
+type ImportResult struct {
+	Conversations int
+	Messages      int
+	FAQs          int
+	// DuplicateFAQs are questions skipped because they were registered already
+	DuplicateFAQs int
+}
+
+// Import imports records into the stores of opts
+func Import(ctx context.Context, records []ImportRecord, opts ImportOptions) (ImportResult, error) {
+	var result ImportResult
+	if opts.Conversations != nil {
+		if err := importConversations(ctx, records, opts.Conversations, &result); err != nil {
+			return result, err
+		}
+	}
+	if opts.FAQs != nil {
+		if err := importFAQs(ctx, records, opts, &result); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// importConversations appends the questions and answers of records to the conversations of their threads,
+// keeping as much of each conversation as the bot does
+func importConversations(ctx context.Context, records []ImportRecord, store ConversationStore, result *ImportResult) error {
+	var keys []string
+	histories := map[string][]string{}
+	for _, record := range records {
+		key := ConversationKey(record.Channel, record.ThreadTS)
+		history, ok := histories[key]
+		if !ok {
+			existing, _, err := store.Load(ctx, key)
+			if err != nil {
+				return fmt.Errorf("loading conversation %s: %w", key, err)
+			}
+			keys, history = append(keys, key), existing
+		}
+		history = appendToConversation(history, record.Question)
+		histories[key] = appendToConversation(history, record.Answer)
+		result.Messages += 2
+	}
+	for _, key := range keys {
+		if err := store.Save(ctx, key, histories[key]); err != nil {
+			return fmt.Errorf("saving conversation %s: %w", key, err)
+		}
+		result.Conversations++
+	}
+	return nil
+}
+
+// importFAQs registers the questions of records that are not registered yet, the latest answer to a question
+// asked several times winning
+func importFAQs(ctx context.Context, records []ImportRecord, opts ImportOptions, result *ImportResult) error {
+	registered := map[string]bool{}
+	for _, faq := range opts.FAQs.List() {
+		registered[normalizeQuestion(faq.Question)] = true
+	}
+	var faqs []FAQ
+	imported := map[string]int{}
+	now := time.Now()
+	for _, record := range records {
+		question := normalizeQuestion(record.Question)
+		if registered[question] {
+			result.DuplicateFAQs++
+			continue
+		}
+		if i, ok := imported[question]; ok {
+			faqs[i].Answer = strings.TrimSpace(record.Answer)
+			result.DuplicateFAQs++
+			continue
+		}
+		imported[question] = len(faqs)
+		faqs = append(faqs, FAQ{Question: strings.TrimSpace(record.Question), Answer: strings.TrimSpace(record.Answer), Author: opts.Author, At: now})
+	}
+	if opts.Embedder != nil {
+		for start := 0; start < len(faqs); start += importEmbedBatch {
+			batch := faqs[start:min(start+importEmbedBatch, len(faqs))]
+			texts := make([]string, len(batch))
+			for i, faq := range batch {
+				texts[i] = faq.Question
+			}
+			embeddings, err := chatgpt.Embed(ctx, opts.Embedder, opts.EmbeddingModel, texts)
+			if err != nil {
+				return fmt.Errorf("embedding imported questions: %w", err)
+			}
+			for i := range batch {
+				batch[i].Embedding, batch[i].EmbeddingModel = embeddings[i], opts.EmbeddingModel
+			}
+		}
+	}
+	if err := opts.FAQs.AddAll(faqs); err != nil {
+		return err
+	}
+	result.FAQs = len(faqs)
+	return nil
+}
+
+// normalizeQuestion returns question as compared to tell duplicates apart, ignoring case and spacing
+func normalizeQuestion(question string) string {
+	return strings.Join(strings.Fields(strings.ToLower(question)), " ")
+}
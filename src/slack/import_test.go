@@ -0,0 +1,80 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadImport(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []ImportRecord
+		wantErr string
+	}{
+		{"records", `{"channel": "C1", "thread_ts": "1.000001", "user": "U1", "question": "what is go", "answer": "a language"}` + "\n\n" +
+			`{"channel": "D1", "question": "and rust?", "answer": "another one"}`,
+			[]ImportRecord{{Channel: "C1", ThreadTS: "1.000001", Question: "what is go", Answer: "a language"}, {Channel: "D1", Question: "and rust?", Answer: "another one"}}, ""},
+		{"not JSON", `{"channel": "C1"` + "\n", nil, "line 1: "},
+		{"no channel", `{"question": "what is go", "answer": "a language"}`, nil, "line 1: missing channel"},
+		{"no answer", "\n" + `{"channel": "C1", "question": "what is go", "answer": " "}`, nil, "line 2: missing question or answer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := ReadImport(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, records)
+		})
+	}
+}
+
+func TestImport(t *testing.T) {
+	ctx := context.Background()
+	conversations := &memoryStore{data: map[string][]string{"1.000001C1": {"hi", "hello"}}}
+	faqs, err := NewFAQStore(filepath.Join(t.TempDir(), "faqs.json"))
+	require.NoError(t, err)
+	_, err = faqs.Add(FAQ{Question: "How do I reset my VPN?", Answer: "Click Reset."})
+	require.NoError(t, err)
+	gptServer := fake.NewOpenAI(0)
+	t.Cleanup(gptServer.Close)
+	gptConfig := openai.DefaultConfig("sk-test")
+	gptConfig.BaseURL = gptServer.URL()
+
+	records := []ImportRecord{
+		{Channel: "C1", ThreadTS: "1.000001", Question: "where is the wiki?", Answer: "At wiki.example.com."},
+		{Channel: "C1", ThreadTS: "1.000001", Question: "how do I  reset my vpn?", Answer: "Ask IT."},
+		{Channel: "D1", Question: "Who runs payroll?", Answer: "HR."},
+		{Channel: "D1", Question: "who runs payroll?", Answer: "HR, ask in #payroll."},
+	}
+	result, err := Import(ctx, records, ImportOptions{Conversations: conversations, FAQs: faqs, Author: "import", Embedder: openai.NewClientWithConfig(gptConfig)})
+	require.NoError(t, err)
+	assert.Equal(t, ImportResult{Conversations: 2, Messages: 8, FAQs: 2, DuplicateFAQs: 2}, result)
+	assert.Equal(t, []string{"hi", "hello", "where is the wiki?", "At wiki.example.com.", "how do I  reset my vpn?", "Ask IT."},
+		conversations.data["1.000001C1"], "imported messages continue the stored conversation")
+	assert.Equal(t, []string{"Who runs payroll?", "HR.", "who runs payroll?", "HR, ask in #payroll."}, conversations.data["D1"])
+
+	list := faqs.List()
+	require.Len(t, list, 3)
+	assert.Equal(t, "Click Reset.", list[0].Answer, "registered questions are kept")
+	assert.Equal(t, FAQ{ID: 3, Question: "Who runs payroll?", Answer: "HR, ask in #payroll.", Author: "import", At: list[2].At, Embedding: list[2].Embedding}, list[2])
+	assert.NotEmpty(t, list[2].Embedding)
+
+	// the imported questions are answered from the FAQs without the model
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{FAQs: faqs})
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Channel: "C2", Text: "<@U0BOT> where is the wiki?", TimeStamp: "2.000001"})
+	messages := slackServer.Messages()
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0].Text, "At wiki.example.com.")
+	assert.Contains(t, messages[0].Text, "From the FAQ")
+}
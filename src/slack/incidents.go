@@ -0,0 +1,173 @@
+package slackhandler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/chikamif/slackgpt/src/tracing"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// incidentInterval is how often an incident of a kind is reported, those in between are counted in the next
+	// report
+	incidentInterval = 15 * time.Minute
+	// rateLimitIncidents is how many times the model has to turn questions away within incidentInterval before
+	// its rate limit is reported, a single one is the odd busy minute
+	rateLimitIncidents = 3
+)
+
+// incidentKind is what went wrong in an incident
+type incidentKind string
+
+const (
+	incidentOutage    incidentKind = "Model outage"
+	incidentAuth      incidentKind = "Model authentication failure"
+	incidentRateLimit incidentKind = "Model rate limited"
+)
+
+// incident is an error operators should know about
+type incident struct {
+	kind incidentKind
+	// detail is the status and message the model's API answered with
+	detail string
+}
+
+// classifyIncident returns the incident err is, false when it is an error operators need not be told about,
+// such as planned maintenance
+func classifyIncident(err error) (incident, bool) {
+	var maintenance *chatgpt.MaintenanceError
+	if err == nil || errors.As(err, &maintenance) {
+		return incident{}, false
+	}
+	var retry *chatgpt.RetryError
+	if errors.As(err, &retry) {
+		detail := fmt.Sprintf("%d %s after %d tries: %s", retry.StatusCode, http.StatusText(retry.StatusCode), retry.Attempts, retry.Message)
+		if retry.RateLimited() {
+			return incident{incidentRateLimit, detail}, true
+		}
+		return incident{incidentOutage, detail}, true
+	}
+	status, message := 0, ""
+	var apiErr *openai.APIError
+	var requestErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		status, message = apiErr.HTTPStatusCode, apiErr.Message
+	case errors.As(err, &requestErr):
+		status, message = requestErr.HTTPStatusCode, requestErr.Error()
+	default:
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) && !errors.Is(err, context.Canceled) {
+			return incident{incidentOutage, urlErr.Error()}, true
+		}
+		return incident{}, false
+	}
+	detail := fmt.Sprintf("%d %s: %s", status, http.StatusText(status), message)
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return incident{incidentAuth, detail}, true
+	case status == http.StatusTooManyRequests:
+		return incident{incidentRateLimit, detail}, true
+	case status >= http.StatusInternalServerError:
+		return incident{incidentOutage, detail}, true
+	}
+	return incident{}, false
+}
+
+// incidentCount is how often an incident of a kind happened since it was last reported
+type incidentCount struct {
+	count    int
+	first    time.Time
+	reported time.Time
+}
+
+// incidents reports errors operators should know about to the admin channel, each kind at most once per
+// incidentInterval
+type incidents struct {
+	channel string
+
+	mu     sync.Mutex
+	counts map[incidentKind]*incidentCount
+}
+
+// newIncidents creates the incident reports posted to channel, nil when there is none
+func newIncidents(channel string) *incidents {
+	if channel == "" {
+		return nil
+	}
+	return &incidents{channel: channel, counts: map[incidentKind]*incidentCount{}}
+}
+
+// happened counts an incident of kind at now, returning how many there were since the first one not reported
+// and when that was when it is to be reported, 0 otherwise
+func (in *incidents) happened(kind incidentKind, now time.Time) (int, time.Time) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	c := in.counts[kind]
+	if c == nil {
+		c = &incidentCount{}
+		in.counts[kind] = c
+	}
+	// rate limits long apart are not repeated
+	if kind == incidentRateLimit && c.count > 0 && now.Sub(c.first) > incidentInterval {
+		c.count = 0
+	}
+	if c.count == 0 {
+		c.first = now
+	}
+	c.count++
+	threshold := 1
+	if kind == incidentRateLimit {
+		threshold = rateLimitIncidents
+	}
+	if c.count < threshold || (!c.reported.IsZero() && now.Sub(c.reported) < incidentInterval) {
+		return 0, time.Time{}
+	}
+	count, first := c.count, c.first
+	c.count, c.reported = 0, now
+	return count, first
+}
+
+// reportIncident tells the admin channel, when there is one, about err answering in channel when it is an
+// incident operators should know about
+func (b *bot) reportIncident(ctx context.Context, api *slack.Client, channel string, err error) {
+	if b.incidents == nil {
+		return
+	}
+	in, ok := classifyIncident(err)
+	if !ok {
+		return
+	}
+	count, first := b.incidents.happened(in.kind, time.Now())
+	if count == 0 {
+		return
+	}
+	where := "<#" + channel + ">"
+	times := "once"
+	if count > 1 {
+		times = fmt.Sprintf("%d times since %s", count, slackDate(first))
+	}
+	text := fmt.Sprintf(":rotating_light: %s in %s, %s: %s", in.kind, where, times, in.detail)
+	fields := []*slack.TextBlockObject{
+		slack.NewTextBlockObject(slack.MarkdownType, "*Where*\n"+where, false, false),
+		slack.NewTextBlockObject(slack.MarkdownType, "*How often*\n"+times, false, false),
+	}
+	if trace := tracing.TraceID(ctx); trace != "" {
+		fields = append(fields, slack.NewTextBlockObject(slack.MarkdownType, "*Trace*\n`"+trace+"`", false, false))
+	}
+	blocks := []slack.Block{
+		slack.NewHeaderBlock(slack.NewTextBlockObject(slack.PlainTextType, ":rotating_light: "+string(in.kind), true, false)),
+		slack.NewSectionBlock(nil, fields, nil),
+		slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, "```"+in.detail+"```", false, false), nil, nil),
+	}
+	if _, _, err := api.PostMessageContext(ctx, b.incidents.channel, slack.MsgOptionText(text, false), slack.MsgOptionBlocks(blocks...)); err != nil {
+		b.logger.Printf("failed reporting %v to the admin channel: %v\n", in.kind, err)
+	}
+}
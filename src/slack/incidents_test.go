@@ -0,0 +1,91 @@
+package slackhandler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClassifyIncident(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want incidentKind
+	}{
+		{"maintenance", &chatgpt.MaintenanceError{Until: time.Now()}, ""},
+		{"server errors", &chatgpt.RetryError{StatusCode: 503, Attempts: 3}, incidentOutage},
+		{"retried rate limits", fmt.Errorf("completing: %w", &chatgpt.RetryError{StatusCode: 429, Attempts: 3}), incidentRateLimit},
+		{"invalid key", &openai.APIError{HTTPStatusCode: 401, Message: "Incorrect API key provided"}, incidentAuth},
+		{"rate limit", &openai.APIError{HTTPStatusCode: 429}, incidentRateLimit},
+		{"bad request", &openai.APIError{HTTPStatusCode: 400, Message: "context too long"}, ""},
+		{"other errors", errors.New("empty answer"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in, ok := classifyIncident(tt.err)
+			assert.Equal(t, tt.want != "", ok)
+			assert.Equal(t, tt.want, in.kind)
+		})
+	}
+}
+
+func TestIncidentsHappened(t *testing.T) {
+	in := newIncidents("C0OPS")
+	start := time.Now()
+	count, _ := in.happened(incidentAuth, start)
+	assert.Equal(t, 1, count, "outages and authentication failures are reported at once")
+	count, _ = in.happened(incidentAuth, start.Add(time.Minute))
+	assert.Zero(t, count)
+	in.happened(incidentAuth, start.Add(2*time.Minute))
+	count, first := in.happened(incidentAuth, start.Add(incidentInterval))
+	assert.Equal(t, 3, count, "those in between are counted in the next report")
+	assert.Equal(t, start.Add(time.Minute), first)
+
+	for i := 0; i < rateLimitIncidents; i++ {
+		count, _ = in.happened(incidentRateLimit, start.Add(time.Duration(i)*2*incidentInterval))
+		assert.Zero(t, count, "rate limits long apart are not repeated")
+	}
+	later := start.Add(time.Duration(rateLimitIncidents) * 2 * incidentInterval)
+	for i := 1; i < rateLimitIncidents; i++ {
+		count, _ = in.happened(incidentRateLimit, later)
+		assert.Zero(t, count)
+	}
+	count, _ = in.happened(incidentRateLimit, later.Add(time.Second))
+	assert.Equal(t, rateLimitIncidents, count)
+
+	assert.Nil(t, newIncidents(""))
+}
+
+func TestReportIncident(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{AdminChannel: "C0OPS"})
+	unauthorized := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error": {"message": "Incorrect API key provided", "type": "invalid_request_error", "code": "invalid_api_key"}}`))
+	}))
+	defer unauthorized.Close()
+	config := openai.DefaultConfig("sk-revoked")
+	config.BaseURL = unauthorized.URL
+	b.gptClient = openai.NewClientWithConfig(config)
+	ctx := context.Background()
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: "C1", TimeStamp: "1.000001"})
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: "C1", TimeStamp: "2.000001"})
+	var reports []string
+	for _, msg := range slackServer.Messages() {
+		if msg.Channel == "C0OPS" {
+			reports = append(reports, msg.Text)
+		}
+	}
+	require.Len(t, reports, 1, "the second failure is counted in the next report")
+	assert.Contains(t, reports[0], "Model authentication failure in <#C1>, once: 401 Unauthorized: Incorrect API key provided")
+}
@@ -0,0 +1,68 @@
+package slackhandler
+
+import (
+	"context"
+	"errors"
+	"github.com/slack-go/slack"
+	"sync"
+)
+
+// errQuestionDeleted is the cause of the cancellation of answers to questions deleted before they were posted
+var errQuestionDeleted = errors.New("question deleted")
+
+// inflight cancels the answers being generated to questions that are deleted meanwhile, so that no tokens are
+// spent on and no reply is posted to a question nobody sees any more
+type inflight struct {
+	mu      sync.Mutex
+	answers map[string]context.CancelCauseFunc
+}
+
+func newInflight() *inflight {
+	return &inflight{answers: map[string]context.CancelCauseFunc{}}
+}
+
+// start returns a context for answering the question posted at questionTS in channel, cancelled when the question
+// is deleted, and a func to call once the answer is posted
+func (f *inflight) start(ctx context.Context, channel, questionTS string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	key := replyKey(channel, questionTS)
+	f.mu.Lock()
+	f.answers[key] = cancel
+	f.mu.Unlock()
+	return ctx, func() {
+		f.mu.Lock()
+		delete(f.answers, key)
+		f.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// cancel cancels the answer to the question posted at questionTS in channel, reporting whether one was in flight
+func (f *inflight) cancel(channel, questionTS string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := replyKey(channel, questionTS)
+	cancel, ok := f.answers[key]
+	if ok {
+		delete(f.answers, key)
+		cancel(errQuestionDeleted)
+	}
+	return ok
+}
+
+// answerDeleted reports whether ctx, one of start, was cancelled because the question was deleted
+func answerDeleted(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errQuestionDeleted)
+}
+
+// dropAnswer forgets the question of a deleted question's in-flight answer and deletes its placeholder
+func (b *bot) dropAnswer(api *slack.Client, channel, placeholderTS, convoKey, question string) {
+	b.logger.Printf("question in %s was deleted before it was answered, dropping the answer\n", channel)
+	b.convo.RemoveExchange(convoKey, question, "")
+	if placeholderTS == "" {
+		return
+	}
+	if _, _, err := api.DeleteMessage(channel, placeholderTS); err != nil {
+		b.logger.Printf("failed deleting placeholder in %v: %v\n", channel, err)
+	}
+}
@@ -0,0 +1,134 @@
+package slackhandler
+
+import (
+	"fmt"
+	"github.com/slack-go/slack"
+	"sync"
+	"time"
+)
+
+// Installation is the app installed in a workspace through OAuth
+type Installation struct {
+	TeamID      string    `json:"team_id"`
+	TeamName    string    `json:"team_name"`
+	BotToken    string    `json:"bot_token"`
+	BotUserID   string    `json:"bot_user_id"`
+	InstalledBy string    `json:"installed_by"`
+	At          time.Time `json:"at"`
+}
+
+// InstallationStore keeps the bot tokens of the workspaces the app is installed in by team ID. With a path they
+// are kept in a JSON file, readable by its owner only, so they survive restarts.
+type InstallationStore struct {
+	mu    sync.Mutex
+	path  string
+	teams map[string]Installation
+}
+
+// NewInstallationStore creates an installation store backed by the JSON file at path, which is created on the
+// first installation if it does not exist. An empty path keeps installations in memory only.
+func NewInstallationStore(path string) (*InstallationStore, error) {
+	s := &InstallationStore{path: path, teams: map[string]Installation{}}
+	if path == "" {
+		return s, nil
+	}
+	if err := loadJSON(path, &s.teams); err != nil {
+		return nil, fmt.Errorf("reading installations: %w", err)
+	}
+	return s, nil
+}
+
+// Get returns the installation in the workspace teamID
+func (s *InstallationStore) Get(teamID string) (Installation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	installation, ok := s.teams[teamID]
+	return installation, ok
+}
+
+// Save stores installation, replacing an earlier one in its workspace. It is kept in memory even when saving
+// fails.
+func (s *InstallationStore) Save(installation Installation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.teams[installation.TeamID] = installation
+	return s.save()
+}
+
+// Remove forgets the installation in the workspace teamID, reporting whether there was one
+func (s *InstallationStore) Remove(teamID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.teams[teamID]; !ok {
+		return false, nil
+	}
+	delete(s.teams, teamID)
+	return true, s.save()
+}
+
+// save replaces the installation file with the current installations, the caller must hold s.mu
+func (s *InstallationStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	if err := saveJSON(s.path, s.teams); err != nil {
+		return fmt.Errorf("saving installations: %w", err)
+	}
+	return nil
+}
+
+// workspaces picks the slack client events are answered with by the workspace they come from: the client of
+// its installation, or the configured client for workspaces installed without OAuth
+type workspaces struct {
+	fallback *slack.Client
+	// store is nil when the app is only installed in the fallback's workspace
+	store     *InstallationStore
+	newClient func(token string) *slack.Client
+
+	mu sync.Mutex
+	// clients are the clients created by token, a workspace installed again gets a new one
+	clients map[string]*slack.Client
+}
+
+// newWorkspaces creates workspaces answering with the clients newClient creates for the installations in
+// store, with fallback in the others
+func newWorkspaces(fallback *slack.Client, store *InstallationStore, newClient func(token string) *slack.Client) *workspaces {
+	if newClient == nil {
+		newClient = func(token string) *slack.Client { return slack.New(token) }
+	}
+	return &workspaces{fallback: fallback, store: store, newClient: newClient, clients: map[string]*slack.Client{}}
+}
+
+// client returns the client of the workspace teamID
+func (w *workspaces) client(teamID string) *slack.Client {
+	if w.store == nil || teamID == "" {
+		return w.fallback
+	}
+	installation, ok := w.store.Get(teamID)
+	if !ok {
+		return w.fallback
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	api, ok := w.clients[installation.BotToken]
+	if !ok {
+		api = w.newClient(installation.BotToken)
+		w.clients[installation.BotToken] = api
+	}
+	return api
+}
+
+// uninstalled forgets the installation in the workspace teamID, whose tokens no longer work
+func (w *workspaces) uninstalled(teamID string) error {
+	if w.store == nil {
+		return nil
+	}
+	installation, _ := w.store.Get(teamID)
+	if _, err := w.store.Remove(teamID); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.clients, installation.BotToken)
+	return nil
+}
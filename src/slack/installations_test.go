@@ -0,0 +1,114 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInstallationStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "installations.json")
+	s, err := NewInstallationStore(path)
+	require.NoError(t, err)
+	_, ok := s.Get("T1")
+	assert.False(t, ok)
+
+	installation := Installation{TeamID: "T1", TeamName: "Acme", BotToken: "xoxb-acme", BotUserID: "U0ACME", InstalledBy: "U1", At: time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)}
+	require.NoError(t, s.Save(installation))
+
+	// installations survive a restart, in a file only their owner reads
+	reloaded, err := NewInstallationStore(path)
+	require.NoError(t, err)
+	got, ok := reloaded.Get("T1")
+	require.True(t, ok)
+	assert.Equal(t, installation, got)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	removed, err := reloaded.Remove("T1")
+	require.NoError(t, err)
+	assert.True(t, removed)
+	removed, err = reloaded.Remove("T1")
+	require.NoError(t, err)
+	assert.False(t, removed)
+	reloaded, err = NewInstallationStore(path)
+	require.NoError(t, err)
+	_, ok = reloaded.Get("T1")
+	assert.False(t, ok)
+
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+	_, err = NewInstallationStore(path)
+	assert.Error(t, err)
+}
+
+func TestWorkspaces(t *testing.T) {
+	fallback := slack.New("xoxb-fallback")
+	store, err := NewInstallationStore("")
+	require.NoError(t, err)
+	require.NoError(t, store.Save(Installation{TeamID: "T1", BotToken: "xoxb-acme"}))
+	var created []string
+	w := newWorkspaces(fallback, store, func(token string) *slack.Client {
+		created = append(created, token)
+		return slack.New(token)
+	})
+
+	acme := w.client("T1")
+	assert.NotSame(t, fallback, acme)
+	assert.Same(t, acme, w.client("T1"), "clients are reused")
+	assert.Same(t, fallback, w.client("T2"))
+	assert.Same(t, fallback, w.client(""))
+
+	require.NoError(t, store.Save(Installation{TeamID: "T1", BotToken: "xoxb-acme-2"}))
+	assert.NotSame(t, acme, w.client("T1"), "installing again replaces the token")
+	assert.Equal(t, []string{"xoxb-acme", "xoxb-acme-2"}, created)
+
+	require.NoError(t, w.uninstalled("T1"))
+	assert.Same(t, fallback, w.client("T1"))
+	assert.Same(t, fallback, newWorkspaces(fallback, nil, nil).client("T1"))
+}
+
+func TestProcessInstalledWorkspace(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{})
+	installedServer := fake.NewSlack()
+	t.Cleanup(installedServer.Close)
+	store, err := NewInstallationStore("")
+	require.NoError(t, err)
+	require.NoError(t, store.Save(Installation{TeamID: "T1", BotToken: "xoxb-acme"}))
+	p := &EventProcessor{
+		workspaces: newWorkspaces(api, store, func(token string) *slack.Client {
+			return slack.New(token, slack.OptionAPIURL(installedServer.APIURL()))
+		}),
+		bot: b,
+	}
+	mention := func(teamID, ts string) slackevents.EventsAPIEvent {
+		return slackevents.EventsAPIEvent{TeamID: teamID, InnerEvent: slackevents.EventsAPIInnerEvent{
+			Data: &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: "C1", TimeStamp: ts},
+		}}
+	}
+	ctx := context.Background()
+
+	p.Process(ctx, mention("T1", "1.000001"))
+	assert.Len(t, installedServer.Messages(), 1, "answered with the workspace's token")
+	assert.Empty(t, slackServer.Messages())
+
+	p.Process(ctx, mention("T0FAKE", "2.000001"))
+	assert.Len(t, slackServer.Messages(), 1, "other workspaces are answered with the configured token")
+
+	// revoking user tokens keeps the installation, uninstalling forgets it
+	revoked := &slackevents.TokensRevokedEvent{}
+	revoked.Tokens.Oauth = []string{"U1"}
+	p.Process(ctx, slackevents.EventsAPIEvent{TeamID: "T1", InnerEvent: slackevents.EventsAPIInnerEvent{Data: revoked}})
+	_, ok := store.Get("T1")
+	assert.True(t, ok)
+	p.Process(ctx, slackevents.EventsAPIEvent{TeamID: "T1", InnerEvent: slackevents.EventsAPIInnerEvent{Data: &slackevents.AppUninstalledEvent{}}})
+	_, ok = store.Get("T1")
+	assert.False(t, ok)
+}
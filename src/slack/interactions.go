@@ -0,0 +1,110 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/socketmode"
+	"strings"
+)
+
+// handleInteractiveEvent handles clicks on the buttons the bot attaches to its messages
+func (b *bot) handleInteractiveEvent(ctx context.Context, api *slack.Client, evt *socketmode.Event) {
+	callback, ok := evt.Data.(slack.InteractionCallback)
+	if !ok {
+		b.logger.Printf("Ignored %+v\n", evt)
+		return
+	}
+	b.handleInteraction(ctx, api, &callback)
+}
+
+// handleInteraction dispatches block actions by action ID and shortcuts, workflow step edits and view
+// submissions by callback ID, other interactions are ignored
+func (b *bot) handleInteraction(ctx context.Context, api *slack.Client, callback *slack.InteractionCallback) {
+	switch callback.Type {
+	case slack.InteractionTypeBlockActions:
+		for _, action := range callback.ActionCallback.BlockActions {
+			switch action.ActionID {
+			case consentActionID:
+				b.recordConsent(ctx, callback)
+			case policyReviewActionID:
+				b.openPolicyModal(ctx, api, callback)
+			case escalateActionID:
+				b.escalate(ctx, api, callback, action)
+			case branchActionID:
+				b.branch(ctx, api, callback, action)
+			case resolvedActionID, needHelpActionID:
+				b.decideDeflection(ctx, api, callback, action)
+			case faqHelpfulActionID, faqUnhelpfulActionID:
+				b.faqFeedback(ctx, api, callback, action)
+			case formActionID:
+				b.openForm(ctx, api, callback, action)
+			case scheduleConfirmActionID, scheduleDiscardActionID:
+				b.confirmScheduled(ctx, api, callback, action)
+			case actionDoneActionID, actionRemindActionID:
+				b.actionItemClicked(ctx, api, callback, action)
+			case homeSaveActionID:
+				b.saveHomeSettings(ctx, api, callback)
+			case approveActionID, editApprovalActionID, rejectActionID:
+				b.decideApproval(ctx, api, callback, action)
+			case regenerateActionID:
+				b.regenerate(ctx, api, callback, action)
+			case continueActionID:
+				b.continueAnswer(ctx, api, callback, action)
+			case deleteActionID:
+				b.deleteAnswer(ctx, api, callback, action)
+			case feedbackUpActionID, feedbackDownActionID:
+				b.recordFeedback(ctx, api, callback, action)
+			default:
+				// each option of a clarification has its own action ID
+				if strings.HasPrefix(action.ActionID, clarifyActionID) {
+					b.clarified(ctx, api, callback, action)
+				}
+			}
+		}
+	case slack.InteractionTypeShortcut:
+		switch callback.CallbackID {
+		case composeShortcutID:
+			b.openComposer(ctx, api, callback)
+		}
+	case slack.InteractionTypeWorkflowStepEdit:
+		switch callback.CallbackID {
+		case workflowStepCallbackID:
+			b.openWorkflowStep(ctx, api, callback)
+		}
+	case slack.InteractionTypeMessageAction:
+		switch callback.CallbackID {
+		case summarizeCallbackID:
+			b.summarizeThread(ctx, api, callback)
+		}
+	case slack.InteractionTypeViewSubmission:
+		switch callback.View.CallbackID {
+		case policyCallbackID:
+			b.recordPolicyAck(callback)
+		case formCallbackID:
+			b.formSubmitted(ctx, api, callback)
+		case approvalCallbackID:
+			b.approvalEdited(ctx, api, callback)
+		case composerCallbackID:
+			b.composerSubmitted(ctx, api, callback)
+		case workflowStepCallbackID:
+			b.saveWorkflowStep(ctx, api, callback)
+		}
+	default:
+		b.logger.Printf("Ignored interaction %v\n", callback.Type)
+	}
+}
+
+// submissionResponse is what the view submitted in callback is acknowledged with: a notice replacing a form while
+// it is checked, or the problems keeping the prompt composer open. It is nil for other interactions.
+func (b *bot) submissionResponse(callback *slack.InteractionCallback) *slack.ViewSubmissionResponse {
+	if callback.Type != slack.InteractionTypeViewSubmission {
+		return nil
+	}
+	switch callback.View.CallbackID {
+	case formCallbackID:
+		return b.formSubmissionResponse(callback)
+	case composerCallbackID:
+		return b.composerSubmissionResponse(callback)
+	}
+	return nil
+}
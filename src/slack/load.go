@@ -0,0 +1,122 @@
+package slackhandler
+
+import (
+	"context"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/slack-go/slack"
+	"time"
+)
+
+const (
+	// defaultLoadStatusInterval is how often the load status is updated unless told otherwise
+	defaultLoadStatusInterval = 30 * time.Second
+	// loadShutdownTimeout is how long showing the bot paused may take when it stops
+	loadShutdownTimeout = 5 * time.Second
+)
+
+// loadLevel is how loaded the bot is
+type loadLevel int
+
+const (
+	loadIdle loadLevel = iota
+	loadBusy
+	loadPaused
+)
+
+// loadStatus shows how loaded the bot is in a status message it keeps up to date in each of its channels and,
+// with presence, by being away while it is paused. It is only used by the goroutine running it.
+type loadStatus struct {
+	channels []string
+	presence bool
+	// busy is how many events being handled or waiting to be make the bot busy
+	busy     int
+	interval time.Duration
+	status   *HandlerStatus
+
+	// shown is the status last shown, messages the status message of each channel
+	shown    string
+	messages map[string]string
+	away     *bool
+}
+
+// newLoadStatus creates the load status shown in channels and, with presence, by the bot's presence, measuring
+// the load with status. It is nil when it is shown nowhere.
+func newLoadStatus(channels []string, presence bool, busy int, interval time.Duration, status *HandlerStatus) *loadStatus {
+	if len(channels) == 0 && !presence {
+		return nil
+	}
+	return &loadStatus{channels: channels, presence: presence, busy: busy, interval: interval, status: status, messages: map[string]string{}}
+}
+
+// describe returns how loaded the bot answering with provider is at now, and the status message saying so
+func (l *loadStatus) describe(provider chatgpt.ChatProvider, now time.Time) (loadLevel, string) {
+	if until, fallback, ok := chatgpt.Maintenance(provider, now); ok && !fallback {
+		return loadPaused, ":red_circle: *Paused* for maintenance until " + slackDate(until) + ", questions are answered once it is over."
+	}
+	snapshot := l.status.Snapshot()
+	if handling := len(snapshot.ActiveRequests) + snapshot.QueuedEvents; l.busy > 0 && handling >= l.busy {
+		return loadBusy, fmt.Sprintf(":large_yellow_circle: *Busy* with %d requests, answers may take longer.", handling)
+	}
+	return loadIdle, ":large_green_circle: *Idle*, questions are answered right away."
+}
+
+// showLoad shows text as the status in the channels, updating the status messages already posted, and sets the
+// presence away when level is paused
+func (b *bot) showLoad(ctx context.Context, api *slack.Client, level loadLevel, text string) {
+	l := b.load
+	if l.presence && (l.away == nil || *l.away != (level == loadPaused)) {
+		away, presence := level == loadPaused, "auto"
+		if away {
+			presence = "away"
+		}
+		if err := api.SetUserPresenceContext(ctx, presence); err != nil {
+			b.logger.Printf("failed setting the presence %v: %v\n", presence, err)
+		} else {
+			l.away = &away
+		}
+	}
+	if text == l.shown {
+		return
+	}
+	shown := true
+	for _, channel := range l.channels {
+		if ts := l.messages[channel]; ts != "" {
+			if _, _, _, err := api.UpdateMessageContext(ctx, channel, ts, slack.MsgOptionText(text, false)); err == nil {
+				continue
+			}
+		}
+		// the status message is posted again when it was deleted
+		_, ts, err := api.PostMessageContext(ctx, channel, slack.MsgOptionText(text, false))
+		if err != nil {
+			b.logger.Printf("failed showing the load status in %v: %v\n", channel, err)
+			shown = false
+			continue
+		}
+		l.messages[channel] = ts
+	}
+	if shown {
+		l.shown = text
+	}
+}
+
+// runLoadStatus keeps the load status up to date until ctx is done, then shows the bot paused until it is back
+func (b *bot) runLoadStatus(ctx context.Context, api *slack.Client) {
+	if b.load == nil {
+		return
+	}
+	ticker := time.NewTicker(b.load.interval)
+	defer ticker.Stop()
+	for {
+		level, text := b.load.describe(b.gptClient, time.Now())
+		b.showLoad(ctx, api, level, text)
+		select {
+		case <-ctx.Done():
+			stopping, cancel := context.WithTimeout(context.WithoutCancel(ctx), loadShutdownTimeout)
+			defer cancel()
+			b.showLoad(stopping, api, loadPaused, ":red_circle: *Paused*, I am not answering questions until I am back.")
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/slack-go/slack/socketmode"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLoadStatus(t *testing.T) {
+	status := NewHandlerStatus()
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{LoadStatusChannels: []string{"C0STATUS"}, LoadPresence: true, LoadBusyThreshold: 2, Status: status})
+	ctx := context.Background()
+	statusText := func() string {
+		messages := messagesIn(slackServer, "C0STATUS")
+		require.Len(t, messages, 1, "the status message is updated in place")
+		return messages[0].Text
+	}
+
+	level, text := b.load.describe(b.gptClient, time.Now())
+	assert.Equal(t, loadIdle, level)
+	b.showLoad(ctx, api, level, text)
+	assert.Contains(t, statusText(), ":large_green_circle: *Idle*")
+	assert.Equal(t, "auto", slackServer.Presence())
+
+	first := status.start(&socketmode.Event{Type: socketmode.EventTypeEventsAPI, Request: &socketmode.Request{EnvelopeID: "1"}})
+	status.start(&socketmode.Event{Type: socketmode.EventTypeEventsAPI, Request: &socketmode.Request{EnvelopeID: "2"}})
+	level, text = b.load.describe(b.gptClient, time.Now())
+	assert.Equal(t, loadBusy, level)
+	b.showLoad(ctx, api, level, text)
+	assert.Equal(t, ":large_yellow_circle: *Busy* with 2 requests, answers may take longer.", statusText())
+	status.done(first)
+	level, _ = b.load.describe(b.gptClient, time.Now())
+	assert.Equal(t, loadIdle, level, "below the threshold")
+
+	window := chatgpt.MaintenanceWindow{Start: time.Now().Add(-time.Hour), End: time.Now().Add(time.Hour)}
+	level, text = b.load.describe(chatgpt.WithMaintenance(b.gptClient, nil, []chatgpt.MaintenanceWindow{window}), time.Now())
+	assert.Equal(t, loadPaused, level)
+	b.showLoad(ctx, api, level, text)
+	assert.Contains(t, statusText(), ":red_circle: *Paused* for maintenance until")
+	assert.Equal(t, "away", slackServer.Presence())
+
+	level, _ = b.load.describe(chatgpt.WithMaintenance(b.gptClient, b.gptClient, []chatgpt.MaintenanceWindow{window}), time.Now())
+	assert.Equal(t, loadIdle, level, "a fallback keeps answering")
+}
+
+func TestRunLoadStatus(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{LoadStatusChannels: []string{"C0STATUS", "C0OPS"}})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.runLoadStatus(ctx, api)
+	}()
+	require.Eventually(t, func() bool { return len(slackServer.Messages()) == 2 }, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+
+	for _, channel := range []string{"C0STATUS", "C0OPS"} {
+		messages := messagesIn(slackServer, channel)
+		require.Len(t, messages, 1)
+		assert.Equal(t, ":red_circle: *Paused*, I am not answering questions until I am back.", messages[0].Text)
+	}
+	assert.Empty(t, slackServer.Presence(), "the presence is left alone unless asked to")
+
+	b, api, _ = newFakeBot(t, EventHandlerArgs{})
+	b.runLoadStatus(ctx, api)
+	assert.Nil(t, b.load, "the load is shown nowhere")
+}
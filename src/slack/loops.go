@@ -0,0 +1,95 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/cache"
+	"github.com/slack-go/slack"
+	"sync"
+)
+
+// loopGuard stops the bot answering other bots once a conversation has gone back and forth with them
+// limit times in a row without a human joining in
+type loopGuard struct {
+	limit   int
+	streaks *cache.LRU[int]
+}
+
+// newLoopGuard creates a loopGuard tracking at most maxEntries conversations, 0 disables the bound
+func newLoopGuard(limit, maxEntries int) *loopGuard {
+	return &loopGuard{limit: limit, streaks: cache.NewLRU[int]("bot_loops", maxEntries, 0, nil)}
+}
+
+// allow records a question in the conversation key and reports whether it may be answered
+func (g *loopGuard) allow(key string, fromBot bool) bool {
+	if !fromBot {
+		g.streaks.Delete(key)
+		return true
+	}
+	var streak int
+	g.streaks.Update(key, func(value int, _ bool) int {
+		streak = value + 1
+		return streak
+	})
+	return streak <= g.limit
+}
+
+// Stats reports the size and effectiveness of the loop guard
+func (g *loopGuard) Stats() cache.Stats {
+	return g.streaks.Stats()
+}
+
+// identity is the bot's own slack user and bot ID, looked up once per client through auth.test. They differ
+// between the workspaces the app is installed in, each of which has its own client.
+type identity struct {
+	mu  sync.Mutex
+	ids map[*slack.Client]botIdentity
+}
+
+// botIdentity is the bot's user and bot ID in a workspace
+type botIdentity struct {
+	userID string
+	botID  string
+}
+
+// get returns the bot's user and bot IDs in the workspace of api, retrying the lookup on later calls if it fails
+func (id *identity) get(ctx context.Context, api *slack.Client) (userID, botID string, err error) {
+	id.mu.Lock()
+	defer id.mu.Unlock()
+	known, ok := id.ids[api]
+	if !ok {
+		resp, err := api.AuthTestContext(ctx)
+		if err != nil {
+			return "", "", err
+		}
+		if id.ids == nil {
+			id.ids = map[*slack.Client]botIdentity{}
+		}
+		known = botIdentity{userID: resp.UserID, botID: resp.BotID}
+		id.ids[api] = known
+	}
+	return known.userID, known.botID, nil
+}
+
+// accept reports whether a question posted by user (or by the bot botID) in the conversation key
+// should be answered. The bot never answers itself or ignored users and bots, and only answers other bots
+// when allowed, until the loop guard trips.
+func (b *bot) accept(ctx context.Context, api *slack.Client, key, user, botID string) bool {
+	selfUser, selfBot, err := b.self.get(ctx, api)
+	if err != nil {
+		b.logger.Printf("failed looking up own identity: %v\n", err)
+	}
+	switch {
+	case user != "" && user == selfUser, botID != "" && botID == selfBot:
+		return false
+	case b.ignoredUsers[user], botID != "" && b.ignoredUsers[botID]:
+		b.logger.Printf("Ignored message from ignored user %s\n", user+botID)
+		return false
+	case botID != "" && !b.allowBots:
+		return false
+	}
+	if !b.loops.allow(key, botID != "") {
+		b.logger.Printf("Ignored message from bot %s in %s, bot loop limit reached\n", botID, key)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,56 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLoopGuard(t *testing.T) {
+	g := newLoopGuard(2, 0)
+	assert.True(t, g.allow("k", true))
+	assert.True(t, g.allow("k", true))
+	assert.False(t, g.allow("k", true))
+	// other conversations are counted separately
+	assert.True(t, g.allow("other", true))
+	// a human taking part resets the streak
+	assert.True(t, g.allow("k", false))
+	assert.True(t, g.allow("k", true))
+}
+
+func TestAccept(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   EventHandlerArgs
+		user   string
+		botID  string
+		answer bool
+	}{
+		{"human", EventHandlerArgs{}, "U1", "", true},
+		// the fake slack server's auth.test identifies the bot as U0BOT/B0BOT
+		{"own user", EventHandlerArgs{AllowBots: true, BotLoopLimit: 5}, "U0BOT", "", false},
+		{"own bot", EventHandlerArgs{AllowBots: true, BotLoopLimit: 5}, "", "B0BOT", false},
+		{"ignored user", EventHandlerArgs{IgnoredUsers: []string{"U2"}}, "U2", "", false},
+		{"other bot", EventHandlerArgs{}, "U3", "B3", false},
+		{"allowed bot", EventHandlerArgs{AllowBots: true, BotLoopLimit: 1}, "U3", "B3", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, api, _ := newFakeBot(t, tt.args)
+			assert.Equal(t, tt.answer, b.accept(context.Background(), api, "k", tt.user, tt.botID))
+		})
+	}
+}
+
+func TestBotLoopIsBroken(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{AllowBots: true, BotLoopLimit: 3})
+	ctx := context.Background()
+	// another bot keeps replying to every answer in the same DM
+	for i := 0; i < 10; i++ {
+		b.handleMessage(ctx, api, &slackevents.MessageEvent{
+			Type: string(slackevents.Message), User: "U3", BotID: "B3", Text: "ping", Channel: "D1",
+		})
+	}
+	assert.Len(t, slackServer.Messages(), 3)
+}
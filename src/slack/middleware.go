@@ -2,7 +2,6 @@ package slackhandler
 
 import (
 	"context"
-	"github.com/chikamif/slackgpt/src/chatgpt"
 	"github.com/sashabaranov/go-openai"
 	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
@@ -11,8 +10,6 @@ import (
 	"strings"
 )
 
-// TODO: implement middleware wrapper that handles everything through inner event data
-
 func middlewareConnecting(evt *socketmode.Event, client *socketmode.Client, logger *log.Logger) {
 	logger.Println("Connecting")
 }
@@ -29,91 +26,341 @@ func middlewareHello(evt *socketmode.Event, client *socketmode.Client, logger *l
 	logger.Println("Hello received from hello handler")
 }
 
-// TODO: debug through here to test out clear convo
-// TODO: we have to org this in such a way that this part does the chatGPT stuff but it needs the tokens from the environment
-func middlewareAppMentionEvent(evt *socketmode.Event, client *socketmode.Client, gptClient *openai.Client, ctx context.Context, logger *log.Logger, convo *conversation) {
-	logger.Println("Hello from AppMention middleware")
+// handleMentionEvent answers the app mention of evt
+func (b *bot) handleMentionEvent(ctx context.Context, api *slack.Client, evt *socketmode.Event) {
+	logger := b.logger
 	eventsAPIEvent, ok := evt.Data.(slackevents.EventsAPIEvent)
 	if !ok {
 		logger.Printf("Ignored %+v\n", evt)
 		return
 	}
-
-	client.Ack(*evt.Request)
 	ev, ok := eventsAPIEvent.InnerEvent.Data.(*slackevents.AppMentionEvent)
 	if !ok {
 		logger.Printf("Ignored %+v\n", ev)
 		return
 	}
+	b.answerMention(ctx, api, ev)
+}
+
+// answerMention replies in thread to an app mention with the chat-gpt response to the thread's conversation
+func (b *bot) answerMention(ctx context.Context, api *slack.Client, ev *slackevents.AppMentionEvent) {
+	logger, convo := b.logger, b.convo
 	logger.Printf("we have been mentioned in %v\n", ev.Channel)
-	logger.Println(ev)
-	if ev.ThreadTimeStamp == "" {
+	// the modifiers come in either order
+	text, offRecord := offRecordQuestion(ev.Text)
+	text, private := privateQuestion(text)
+	if !offRecord {
+		text, offRecord = offRecordQuestion(text)
+	}
+	// users may have asked for every question to be off the record or private in the App Home tab
+	settings := b.userSettings(ev.User)
+	offRecord, private = offRecord || settings.OffRecord, private || settings.Private
+	ev.Text = b.localize(text)
+	retain := b.retains(ev.Channel) && !offRecord
+	if retain {
+		logger.Println(ev)
+	}
+	threaded := ev.ThreadTimeStamp != "" && ev.ThreadTimeStamp != ev.TimeStamp
+	members, groupDM := b.groupDM(ctx, api, ev.Channel)
+	// questions at the top level of group DMs continue the group's shared conversation there, as in DMs,
+	// elsewhere they start a thread
+	if ev.ThreadTimeStamp == "" && !groupDM {
 		ev.ThreadTimeStamp = ev.TimeStamp
 	}
 	// found a unique way to identify a thread
-	userChannelThreadKey := ev.ThreadTimeStamp + ev.Channel
+	userChannelThreadKey := ConversationKey(ev.Channel, ev.ThreadTimeStamp)
+	if !b.accept(ctx, api, userChannelThreadKey, ev.User, ev.BotID) || !b.permitted(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.User) {
+		return
+	}
+	if b.helpCommand(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.User, ev.Text) ||
+		b.promptCommand(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.User, ev.Text) ||
+		b.faqCommand(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.User, ev.Text) ||
+		b.resetCommand(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.TimeStamp, ev.User, ev.Text) ||
+		b.systemCommand(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.TimeStamp, ev.User, ev.Text) {
+		return
+	}
+	if !b.consented(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.User, ev.BotID) ||
+		!b.policyAcknowledged(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.User, ev.BotID) ||
+		groupDM && !b.membersAgreed(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.User, members) ||
+		b.reactionsCommand(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.TimeStamp, ev.User, ev.Text) ||
+		b.pinCommand(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.TimeStamp, ev.User, ev.Text) ||
+		b.drawCommand(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.User, ev.Text) ||
+		b.scheduleCommand(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.User, ev.Text) ||
+		b.formCommand(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.User, ev.Text) ||
+		b.transcribeCommand(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.TimeStamp, ev.User, ev.Text, nil) {
+		return
+	}
 
-	log.Printf("timestamp: %v\n", ev.TimeStamp)
-	log.Printf("thread_timestamp: %v\n", ev.ThreadTimeStamp)
-	convo.UpdateConversation(userChannelThreadKey, ev.Text)
+	logger.Printf("timestamp: %v\n", ev.TimeStamp)
+	logger.Printf("thread_timestamp: %v\n", ev.ThreadTimeStamp)
+	overrides, ok := b.questionOverrides(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.User, ev.Text)
+	if !ok {
+		return
+	}
+	question := b.prompt(ctx, api, ev.Text)
+	if !b.moderated(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.User, question) {
+		return
+	}
+	if !retain {
+		opts := append(overrides, b.lookAtMessage(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.TimeStamp)...)
+		b.answerOffRecord(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.TimeStamp, ev.User, question, private, opts)
+		return
+	}
+	if private {
+		if b.withinRateLimit(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.User) {
+			opts := append(overrides, b.lookAtMessage(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.TimeStamp)...)
+			b.answerPrivately(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.User, question, opts)
+		}
+		return
+	}
+	// FAQ answers cost no completion, so they are not rate limited
+	if !threaded && b.answerFromFAQ(ctx, api, ev.Channel, ev.ThreadTimeStamp, userChannelThreadKey, question) {
+		return
+	}
+	if !b.withinRateLimit(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.User) {
+		return
+	}
+	convo.UpdateConversation(userChannelThreadKey, question)
 
-	gpt3Resp, err := chatgpt.GetStringResponse(gptClient, ctx, convo.data[userChannelThreadKey])
-	if strings.Contains(strings.ToLower(ev.Text), "clear convo") {
-		log.Println("Preparing to clear various conversation history.")
+	// the thread itself is the conversation when it can be read, the store only knows what the bot took part in
+	history, ok := []openai.ChatCompletionMessage(nil), false
+	if threaded {
+		history, ok = b.threadHistory(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.TimeStamp)
+	}
+	if !ok {
+		stored, _ := convo.Get(userChannelThreadKey)
+		history = turns(stored, openai.ChatMessageRoleUser)
+	}
+	history = b.withPins(userChannelThreadKey, history)
+	clearing := strings.Contains(strings.ToLower(ev.Text), "clear convo")
+	_, maintenance := b.batching.maintenance(b.gptClient)
+	if !clearing && (b.batching.lowPriority(ev.Channel) || maintenance) {
+		b.queueMention(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.TimeStamp, ev.User, userChannelThreadKey, question, history, overrides)
+		return
+	}
+	if !clearing && b.askToClarify(ctx, api, ev.Channel, ev.ThreadTimeStamp, userChannelThreadKey, history) {
+		return
+	}
+	ctx, done := b.answering.start(ctx, ev.Channel, ev.TimeStamp)
+	defer done()
+	placeholderTS := b.postThinking(ctx, api, ev.Channel, ev.ThreadTimeStamp)
+	// the vision model comes last, the images could not be looked at with another model
+	opts := append(overrides, b.lookAtMessage(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.TimeStamp)...)
+	gpt3Resp, err := b.completeIn(ctx, api, userChannelThreadKey, ev.Channel, ev.User, history, opts...)
+	if answerDeleted(ctx) {
+		b.dropAnswer(api, ev.Channel, placeholderTS, userChannelThreadKey, question)
+		return
+	}
+	if clearing {
+		logger.Println("Preparing to clear various conversation history.")
 		convo.LogConversationHistoryKvPairs()
 		if convo.ClearConversation(userChannelThreadKey) {
-			gpt3Resp = "Done. Conversation history cleared."
+			gpt3Resp = completion{answer: "Done. Conversation history cleared."}
 		} else {
-			gpt3Resp = "Encountered issue when clearing conversation history."
+			gpt3Resp = completion{answer: "Encountered issue when clearing conversation history."}
 		}
-		log.Println("Various conversation history cleared.")
+		logger.Println("Various conversation history cleared.")
 		convo.LogConversationHistoryKvPairs()
 	}
 
-	convo.UpdateConversation(userChannelThreadKey, gpt3Resp)
+	answer := gpt3Resp.stored()
+	convo.UpdateConversation(userChannelThreadKey, answer)
 	if err != nil {
 		logger.Printf("Failed to get gpt3 response: %v\n", err)
-		gpt3Resp = "I'm having some trouble communicating with our servers (my brain). Please try again in a little bit and hopefully the fuzz clears up."
+		gpt3Resp = completion{answer: troubleAnswer(err)}
+	}
+	answered := err == nil && !clearing
+	// answers in broadcast channels are only posted once approved
+	if answered && b.approvals.appliesTo(ev.Channel) {
+		if placeholderTS != "" {
+			if _, _, err := api.DeleteMessageContext(ctx, ev.Channel, placeholderTS); err != nil {
+				logger.Printf("failed deleting placeholder in %v: %v\n", ev.Channel, err)
+			}
+		}
+		b.holdForApproval(ctx, api, pendingApproval{
+			Channel:    ev.Channel,
+			ThreadTS:   ev.ThreadTimeStamp,
+			QuestionTS: ev.TimeStamp,
+			User:       ev.User,
+			ConvoKey:   userChannelThreadKey,
+			Question:   question,
+			Text:       gpt3Resp.text(),
+		})
+		return
 	}
-	_, _, err = client.Client.PostMessage(ev.Channel,
-		slack.MsgOptionText(strings.Join([]string{"```", gpt3Resp, "```"}, ""), false),
-		slack.MsgOptionTS(ev.ThreadTimeStamp))
+	// new questions in support channels can be marked resolved or handed to the support team
+	deflecting := !threaded && answered && b.deflection.appliesTo(ev.Channel)
+	parts := gpt3Resp.split(maxAnswerText)
+	options := b.replyOptions(parts[0], userChannelThreadKey, ev.User)
+	if deflecting {
+		options = deflectionOptions(parts[0], userChannelThreadKey)
+	}
+	replyTS, err := b.postAnswer(ctx, api, ev.Channel, ev.ThreadTimeStamp, placeholderTS, options)
 	if err != nil {
 		logger.Printf("failed posting message: %v", err)
 		return
 	}
+	b.postRest(ctx, api, ev.Channel, ev.ThreadTimeStamp, replyTS, parts[1:])
+	if deflecting {
+		b.deflection.track(userChannelThreadKey, ev.User)
+	}
+	b.replies.Record(ev.TimeStamp, reply{
+		Channel:  ev.Channel,
+		ThreadTS: ev.ThreadTimeStamp,
+		ReplyTS:  replyTS,
+		ConvoKey: userChannelThreadKey,
+		Question: question,
+		Answer:   answer,
+	})
+	// the shared conversation of a group DM is no thread to title
+	if answered && ev.ThreadTimeStamp != "" {
+		b.titleThread(ctx, userChannelThreadKey, ev.Channel, ev.ThreadTimeStamp, ev.User, history, answer)
+	}
 }
 
-func middlewareMessageEvent(evt *socketmode.Event, client *socketmode.Client, gptClient *openai.Client, ctx context.Context, logger *log.Logger, convo *conversation) {
-	logger.Println("Hello from Message middleware")
+// handleMessageEvent handles the message of evt
+func (b *bot) handleMessageEvent(ctx context.Context, api *slack.Client, evt *socketmode.Event) {
+	logger := b.logger
 	eventsAPIEvent, ok := evt.Data.(slackevents.EventsAPIEvent)
-	// only handle non-bot-id-events
 	if !ok {
 		logger.Printf("Ignored %+v\n", evt)
 		return
 	}
-
-	client.Ack(*evt.Request)
 	ev, ok := eventsAPIEvent.InnerEvent.Data.(*slackevents.MessageEvent)
-	logger.Println(ev)
 	if !ok {
 		logger.Printf("Ignored %+v\n", evt)
 		return
 	}
-	if ev.BotID != "" {
+	if _, offRecord := offRecordQuestion(ev.Text); b.retains(ev.Channel) && !offRecord && !b.userSettings(ev.User).OffRecord {
+		logger.Println(ev)
+	}
+	b.handleMessage(ctx, api, ev)
+}
+
+// handleMessage answers new messages from users and applies edits and deletions to questions the bot already answered
+func (b *bot) handleMessage(ctx context.Context, api *slack.Client, ev *slackevents.MessageEvent) {
+	switch ev.SubType {
+	case "message_changed":
+		b.questionEdited(ctx, api, ev)
+	case "message_deleted":
+		b.questionDeleted(ctx, api, ev)
+	default:
+		// channel and group DM messages are only delivered to pick up edits, questions there arrive as app
+		// mentions, except for new questions in support channels which are answered without a mention
+		if ev.ChannelType == "channel" || ev.ChannelType == "group" || ev.ChannelType == "mpim" {
+			if b.supportQuestion(ctx, api, ev) {
+				b.answerMention(ctx, api, &slackevents.AppMentionEvent{
+					Type: string(slackevents.AppMention), User: ev.User, Text: ev.Text, TimeStamp: ev.TimeStamp,
+					Channel: ev.Channel, BotID: ev.BotID,
+				})
+			}
+			return
+		}
+		b.answerMessage(ctx, api, ev)
+	}
+}
+
+// answeredSubTypes are the message subtypes answered in direct messages, others such as joins and thread
+// notifications are not questions
+var answeredSubTypes = map[string]bool{"": true, "bot_message": true, "file_share": true, "thread_broadcast": true}
+
+// answerMessage replies to a direct message with the chat-gpt response to the conversation of the DM, or of
+// the thread in the DM the message was sent in
+func (b *bot) answerMessage(ctx context.Context, api *slack.Client, ev *slackevents.MessageEvent) {
+	logger, convo := b.logger, b.convo
+	if !answeredSubTypes[ev.SubType] || strings.TrimSpace(ev.Text) == "" {
+		return
+	}
+	ev.Text = b.localize(ev.Text)
+	dmKey := ConversationKey(ev.Channel, ev.ThreadTimeStamp)
+	if !b.accept(ctx, api, dmKey, ev.User, ev.BotID) || !b.permitted(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.User) {
+		return
+	}
+	if b.helpCommand(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.User, ev.Text) ||
+		b.promptCommand(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.User, ev.Text) ||
+		b.faqCommand(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.User, ev.Text) ||
+		b.resetCommand(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.TimeStamp, ev.User, ev.Text) ||
+		b.systemCommand(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.TimeStamp, ev.User, ev.Text) {
+		return
+	}
+	if !b.consented(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.User, ev.BotID) ||
+		!b.policyAcknowledged(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.User, ev.BotID) ||
+		b.reactionsCommand(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.TimeStamp, ev.User, ev.Text) ||
+		b.pinCommand(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.TimeStamp, ev.User, ev.Text) ||
+		b.drawCommand(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.User, ev.Text) ||
+		b.scheduleCommand(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.User, ev.Text) ||
+		b.formCommand(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.User, ev.Text) ||
+		b.transcribeCommand(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.TimeStamp, ev.User, ev.Text, eventFiles(ev.Files)) {
+		return
+	}
+	var options []slack.MsgOption
+	if ev.ThreadTimeStamp != "" {
+		options = append(options, slack.MsgOptionTS(ev.ThreadTimeStamp))
+	}
+	if strings.EqualFold(strings.TrimSpace(ev.Text), "clear convo") {
+		text := "Done. Conversation history cleared."
+		if !convo.ClearConversation(dmKey) {
+			text = "There was no conversation history to clear."
+		}
+		if _, _, err := api.PostMessage(ev.Channel, append(options, slack.MsgOptionText(text, false))...); err != nil {
+			logger.Printf("failed posting message: %v\n", err)
+		}
+		return
+	}
+	text, offRecord := offRecordQuestion(ev.Text)
+	offRecord = offRecord || b.userSettings(ev.User).OffRecord
+	overrides, ok := b.questionOverrides(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.User, text)
+	if !ok {
+		return
+	}
+	question := b.prompt(ctx, api, text)
+	if !b.moderated(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.User, question) {
+		return
+	}
+	if offRecord || !b.retains(ev.Channel) {
+		opts := append(overrides, b.look(ctx, api, eventFiles(ev.Files))...)
+		b.answerOffRecord(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.TimeStamp, ev.User, question, false, opts)
+		return
+	}
+	if ev.ThreadTimeStamp == "" && b.answerFromFAQ(ctx, api, ev.Channel, "", dmKey, question) {
+		return
+	}
+	if !b.withinRateLimit(ctx, api, ev.Channel, ev.ThreadTimeStamp, ev.User) {
+		return
+	}
+	convo.UpdateConversation(dmKey, question)
+	history, _ := convo.Get(dmKey)
+	if b.askToClarify(ctx, api, ev.Channel, ev.ThreadTimeStamp, dmKey, turns(history, openai.ChatMessageRoleUser)) {
+		return
+	}
+	ctx, done := b.answering.start(ctx, ev.Channel, ev.TimeStamp)
+	defer done()
+	placeholderTS := b.postThinking(ctx, api, ev.Channel, ev.ThreadTimeStamp)
+	opts := append(overrides, b.look(ctx, api, eventFiles(ev.Files))...)
+	gpt3Resp, err := b.completeIn(ctx, api, dmKey, ev.Channel, ev.User, b.withPins(dmKey, turns(history, openai.ChatMessageRoleUser)), opts...)
+	if answerDeleted(ctx) {
+		b.dropAnswer(api, ev.Channel, placeholderTS, dmKey, question)
 		return
 	}
-	userChannel := ev.Username + ev.Channel
-	convo.UpdateConversation(userChannel, ev.Text)
-	gpt3Resp, err := chatgpt.GetStringResponse(gptClient, ctx, convo.data[userChannel])
 	if err != nil {
 		logger.Printf("Failed to get gpt3 response: %v\n", err)
-		gpt3Resp = "I'm having some trouble communicating with our servers (my brain). Please try again in a little bit and hopefully the fuzz clears up."
+		gpt3Resp = completion{answer: troubleAnswer(err)}
 	}
-	convo.UpdateConversation(userChannel, gpt3Resp)
-	_, _, err = client.Client.PostMessage(ev.Channel, slack.MsgOptionText(strings.Join([]string{"```", gpt3Resp, "```"}, ""), false))
+	answer := gpt3Resp.stored()
+	convo.UpdateConversation(dmKey, answer)
+	parts := gpt3Resp.split(maxAnswerText)
+	replyTS, err := b.postAnswer(ctx, api, ev.Channel, ev.ThreadTimeStamp, placeholderTS, b.replyOptions(parts[0], dmKey, ev.User))
 	if err != nil {
 		logger.Printf("failed posting message: %v\n", err)
 		return
 	}
+	b.postRest(ctx, api, ev.Channel, ev.ThreadTimeStamp, replyTS, parts[1:])
+	b.replies.Record(ev.TimeStamp, reply{
+		Channel:  ev.Channel,
+		ThreadTS: ev.ThreadTimeStamp,
+		ReplyTS:  replyTS,
+		ConvoKey: dmKey,
+		Question: question,
+		Answer:   answer,
+	})
 }
@@ -4,11 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"github.com/chikamif/slackgpt/src/chatgpt/chatgptmock"
+	"github.com/chikamif/slackgpt/src/fake"
 	"github.com/sashabaranov/go-openai"
 	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
 	"github.com/slack-go/slack/socketmode"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"log"
 	"os"
 	"testing"
@@ -51,7 +55,7 @@ func TestMiddlewareHello(t *testing.T) {
 // Test1: Change the Data in socketmode.Event so that it isn't EventsAPIEvent
 // Test2: Change the InnerEvent type so that it isn't AppMentionEvent
 // See if we can mock the chat gpt response??
-func TestMiddlewareAppMentionEvent(t *testing.T) {
+func TestHandleMentionEvent(t *testing.T) {
 	type payload struct {
 		Text string `json:"text"`
 	}
@@ -95,7 +99,7 @@ func TestMiddlewareAppMentionEvent(t *testing.T) {
 					Request: &socketmode.Request{
 						Type:           "test",
 						NumConnections: 1,
-						ConnectionInfo: socketmode.ConnectionInfo{"test-app"},
+						ConnectionInfo: socketmode.ConnectionInfo{AppID: "test-app"},
 						Reason:         "test",
 						EnvelopeID:     "1",
 						Payload:        send,
@@ -126,7 +130,7 @@ func TestMiddlewareAppMentionEvent(t *testing.T) {
 					Request: &socketmode.Request{
 						Type:           "test",
 						NumConnections: 1,
-						ConnectionInfo: socketmode.ConnectionInfo{"test-app"},
+						ConnectionInfo: socketmode.ConnectionInfo{AppID: "test-app"},
 						Reason:         "test",
 						EnvelopeID:     "1",
 						Payload:        send,
@@ -141,17 +145,18 @@ func TestMiddlewareAppMentionEvent(t *testing.T) {
 
 	slackClient := slack.New("test")
 	client := socketmode.New(slackClient)
-	gptClient := openai.NewClient("test")
-	convo := newConversation()
+	gptClient := &chatgptmock.Provider{}
+	gptClient.On("CreateChatCompletion", mock.Anything, mock.Anything).Return(chatgptmock.Answer("Hello!"), nil).Maybe()
+	b := newBot(EventHandlerArgs{Logger: logger, GPTClient: gptClient})
 	ctx := context.Background()
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			middlewareAppMentionEvent(tt.arg.event, client, gptClient, ctx, logger, convo)
+			b.handleMentionEvent(ctx, &client.Client, tt.arg.event)
 		})
 	}
 }
 
-func TestMiddlewareMessageEvent(t *testing.T) {
+func TestHandleMessageEvent(t *testing.T) {
 	type payload struct {
 		Text string `json:"text"`
 	}
@@ -195,7 +200,7 @@ func TestMiddlewareMessageEvent(t *testing.T) {
 					Request: &socketmode.Request{
 						Type:           "test",
 						NumConnections: 1,
-						ConnectionInfo: socketmode.ConnectionInfo{"test-app"},
+						ConnectionInfo: socketmode.ConnectionInfo{AppID: "test-app"},
 						Reason:         "test",
 						EnvelopeID:     "1",
 						Payload:        send,
@@ -226,7 +231,7 @@ func TestMiddlewareMessageEvent(t *testing.T) {
 					Request: &socketmode.Request{
 						Type:           "test",
 						NumConnections: 1,
-						ConnectionInfo: socketmode.ConnectionInfo{"test-app"},
+						ConnectionInfo: socketmode.ConnectionInfo{AppID: "test-app"},
 						Reason:         "test",
 						EnvelopeID:     "1",
 						Payload:        send,
@@ -258,7 +263,7 @@ func TestMiddlewareMessageEvent(t *testing.T) {
 					Request: &socketmode.Request{
 						Type:           "test",
 						NumConnections: 1,
-						ConnectionInfo: socketmode.ConnectionInfo{"test-app"},
+						ConnectionInfo: socketmode.ConnectionInfo{AppID: "test-app"},
 						Reason:         "test",
 						EnvelopeID:     "1",
 						Payload:        send,
@@ -273,12 +278,73 @@ func TestMiddlewareMessageEvent(t *testing.T) {
 
 	slackClient := slack.New("test")
 	client := socketmode.New(slackClient)
-	convo := newConversation()
-	gptClient := openai.NewClient("test")
+	gptClient := &chatgptmock.Provider{}
+	gptClient.On("CreateChatCompletion", mock.Anything, mock.Anything).Return(chatgptmock.Answer("Hello!"), nil).Maybe()
+	b := newBot(EventHandlerArgs{Logger: logger, GPTClient: gptClient})
 	ctx := context.Background()
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			middlewareMessageEvent(tt.arg.event, client, gptClient, ctx, logger, convo)
+			b.handleMessageEvent(ctx, &client.Client, tt.arg.event)
 		})
 	}
 }
+
+func TestAnswerMentionAsksTheModel(t *testing.T) {
+	slackServer := fake.NewSlack()
+	t.Cleanup(slackServer.Close)
+	provider := &chatgptmock.Provider{}
+	provider.On("CreateChatCompletion", mock.Anything, chatgptmock.Asking("what is go")).
+		Return(chatgptmock.Answer("Go is a programming language."), nil).Once()
+	b := newBot(EventHandlerArgs{Logger: logger, GPTClient: provider, SystemPrompt: "You answer in one sentence."})
+	api := slack.New("xoxb-test", slack.OptionAPIURL(slackServer.APIURL()))
+
+	b.answerMention(context.Background(), api, &slackevents.AppMentionEvent{
+		Type: string(slackevents.AppMention), User: "U1", Text: "<@U0BOT> what is go", Channel: "C1", TimeStamp: "1.000001",
+	})
+	provider.AssertExpectations(t)
+	req := provider.Calls[0].Arguments.Get(1).(openai.ChatCompletionRequest)
+	assert.Equal(t, openai.ChatMessageRoleSystem, req.Messages[0].Role)
+	assert.Contains(t, req.Messages[0].Content, "You answer in one sentence.")
+	messages := slackServer.Messages()
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0].Text, "Go is a programming language.")
+	assert.Equal(t, "1.000001", messages[0].ThreadTS)
+}
+
+func TestAnswerMessage(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{})
+	ctx := context.Background()
+	dm := func(channel, ts, threadTS, subType, text string) {
+		b.handleMessage(ctx, api, &slackevents.MessageEvent{
+			Type: string(slackevents.Message), SubType: subType, ChannelType: "im", User: "U1", Text: text,
+			Channel: channel, TimeStamp: ts, ThreadTimeStamp: threadTS,
+		})
+	}
+
+	dm("D1", "1.000001", "", "", "what is go")
+	dm("D2", "1.000002", "", "", "what is rust")
+	dm("D1", "1.000003", "", "", "who made it")
+	dm("D1", "1.000004", "1.000001", "", "in a thread")
+	history, _ := b.convo.Get("D1")
+	assert.Equal(t, []string{"what is go", "fake answer to: what is go", "who made it", "fake answer to: who made it"}, history)
+	history, _ = b.convo.Get("D2")
+	assert.Len(t, history, 2, "every DM is its own conversation")
+	history, _ = b.convo.Get("1.000001D1")
+	assert.Equal(t, []string{"in a thread", "fake answer to: in a thread"}, history)
+	messages := slackServer.Messages()
+	assert.Len(t, messages, 4)
+	assert.Equal(t, "1.000001", messages[3].ThreadTS)
+
+	// joins, thread notifications and empty messages are not questions
+	dm("D1", "1.000005", "", "channel_join", "<@U1> has joined")
+	dm("D1", "1.000006", "", "message_replied", "what is go")
+	dm("D1", "1.000007", "", "", " ")
+	assert.Len(t, slackServer.Messages(), 4)
+
+	dm("D1", "1.000008", "", "", "Clear convo")
+	_, ok := b.convo.Get("D1")
+	assert.False(t, ok)
+	_, ok = b.convo.Get("1.000001D1")
+	assert.True(t, ok, "threads are cleared on their own")
+	assert.Equal(t, "Done. Conversation history cleared.", slackServer.Messages()[4].Text)
+}
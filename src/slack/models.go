@@ -0,0 +1,203 @@
+package slackhandler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/chikamif/slackgpt/src/command"
+	"github.com/slack-go/slack"
+	"strings"
+	"sync"
+)
+
+const (
+	// modelCommand shows the model of the channel it is sent in, or switches it
+	modelCommand = "/gpt-model"
+	// statusCommand shows how questions are answered in the channel it is sent in
+	statusCommand = "/gpt-status"
+	// modelDefault goes back to the configured model with modelCommand
+	modelDefault = "default"
+	// modelKeyPrefix prefixes the channel IDs the switched models are kept under in the conversation store
+	modelKeyPrefix = "model/"
+)
+
+// modelSpec is the syntax of modelCommand
+var modelSpec = &command.Command{
+	Name:    modelCommand,
+	Args:    "[model|" + modelDefault + "]",
+	Summary: "Show the model answering in this channel, or switch it to another allowed model (admins only); `" + modelDefault + "` goes back to the configured one.",
+}
+
+// statusSpec is the syntax of statusCommand
+var statusSpec = &command.Command{
+	Name:    statusCommand,
+	Summary: "Show how questions are answered in this channel: the model and whether conversations are kept.",
+}
+
+// modelSwitch is the model a channel was switched to with modelCommand and who switched it
+type modelSwitch struct {
+	Model string
+	User  string
+}
+
+// channelModels keeps the models channels were switched to at runtime, by channel ID. With a conversation store
+// they are kept in it so they survive restarts, and loaded from it the first time a channel is asked about.
+type channelModels struct {
+	// allowed are the models channels may be switched to
+	allowed []string
+	store   ConversationStore
+
+	mu       sync.Mutex
+	switched map[string]modelSwitch
+}
+
+// newChannelModels creates the runtime models of channels, switching only to allowed models
+func newChannelModels(allowed []string, store ConversationStore) *channelModels {
+	return &channelModels{allowed: allowed, store: store, switched: map[string]modelSwitch{}}
+}
+
+// allows reports whether channels may be switched to model
+func (m *channelModels) allows(model string) bool {
+	for _, allowed := range m.allowed {
+		if allowed == model {
+			return true
+		}
+	}
+	return false
+}
+
+// get returns the model channel was switched to, reporting false when it was not
+func (m *channelModels) get(channel string) (modelSwitch, bool) {
+	m.mu.Lock()
+	sw, known := m.switched[channel]
+	m.mu.Unlock()
+	if known || m.store == nil {
+		return sw, sw.Model != ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), conversationStoreTimeout)
+	defer cancel()
+	stored, ok, err := m.store.Load(ctx, modelKeyPrefix+channel)
+	if err != nil {
+		// tried again on the next question
+		return modelSwitch{}, false
+	}
+	if ok && len(stored) == 2 {
+		sw = modelSwitch{Model: stored[0], User: stored[1]}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// a concurrent switch was made to what is in the store already
+	if existing, ok := m.switched[channel]; ok {
+		sw = existing
+	}
+	m.switched[channel] = sw
+	return sw, sw.Model != ""
+}
+
+// set switches channel to sw.Model, back to the configured model when it is empty. The switch is kept in
+// memory even when saving it fails.
+func (m *channelModels) set(channel string, sw modelSwitch) error {
+	m.mu.Lock()
+	m.switched[channel] = sw
+	m.mu.Unlock()
+	if m.store == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), conversationStoreTimeout)
+	defer cancel()
+	var err error
+	if sw.Model == "" {
+		err = m.store.Delete(ctx, modelKeyPrefix+channel)
+	} else {
+		err = m.store.Save(ctx, modelKeyPrefix+channel, []string{sw.Model, sw.User})
+	}
+	if err != nil {
+		return fmt.Errorf("saving the model of %v: %w", channel, err)
+	}
+	return nil
+}
+
+// channelModel returns the model answering in channel unless a question asks for another, and where it comes
+// from
+func (b *bot) channelModel(channel string) (model, source string) {
+	if b.models != nil {
+		if sw, ok := b.models.get(channel); ok {
+			return sw.Model, fmt.Sprintf("switched by <@%s>", sw.User)
+		}
+	}
+	if settings, ok := b.channels[channel]; ok && settings.Model != "" {
+		return settings.Model, "configured for this channel"
+	}
+	if b.routing != nil {
+		return chatgpt.ModelOf(b.gptClient), "the default, questions may be routed to other models by their task"
+	}
+	return chatgpt.ModelOf(b.gptClient), "the default"
+}
+
+// answerModelCommand shows the model of the channel modelCommand was sent in to the user, or switches it to
+// the model given when they are an admin and it is allowed. Switches are announced in the channel.
+func (b *bot) answerModelCommand(ctx context.Context, cmd *slack.SlashCommand) {
+	if b.models == nil {
+		b.respond(ctx, cmd, completion{note: "Models cannot be switched, no model is allowed."}, slack.ResponseTypeEphemeral)
+		return
+	}
+	inv, err := b.aliases.Parse(modelSpec, cmd.Text)
+	if err == nil && len(inv.Args) > 1 {
+		err = errors.New("give a single model")
+	}
+	if err != nil {
+		b.respond(ctx, cmd, completion{note: err.Error() + "\n" + inv.UsageText()}, slack.ResponseTypeEphemeral)
+		return
+	}
+	if inv.Help {
+		b.respond(ctx, cmd, completion{note: modelSpec.Help()}, slack.ResponseTypeEphemeral)
+		return
+	}
+	allowed := "`" + strings.Join(b.models.allowed, "`, `") + "`"
+	if len(inv.Args) == 0 {
+		model, source := b.channelModel(cmd.ChannelID)
+		b.respond(ctx, cmd, completion{note: fmt.Sprintf("This channel is answered by `%s`, %s. Admins can switch it to %s.", model, source, allowed)}, slack.ResponseTypeEphemeral)
+		return
+	}
+	if !b.admins[cmd.UserID] {
+		b.respond(ctx, cmd, completion{note: "Only admins can switch the model."}, slack.ResponseTypeEphemeral)
+		return
+	}
+	model := inv.Args[0]
+	if model != modelDefault && !b.models.allows(model) {
+		b.respond(ctx, cmd, completion{note: fmt.Sprintf("`%s` is not allowed, pick one of %s.", model, allowed)}, slack.ResponseTypeEphemeral)
+		return
+	}
+	sw := modelSwitch{Model: model, User: cmd.UserID}
+	if model == modelDefault {
+		sw = modelSwitch{}
+	}
+	if err := b.models.set(cmd.ChannelID, sw); err != nil {
+		b.logger.Printf("failed keeping a model switch: %v\n", err)
+	}
+	b.logger.Printf("%s switched the model of %v to %v\n", cmd.UserID, cmd.ChannelID, model)
+	model, _ = b.channelModel(cmd.ChannelID)
+	b.respond(ctx, cmd, completion{note: fmt.Sprintf("<@%s> switched this channel to `%s`.", cmd.UserID, model)}, slack.ResponseTypeInChannel)
+}
+
+// answerStatusCommand shows the user how questions are answered in the channel statusCommand was sent in
+func (b *bot) answerStatusCommand(ctx context.Context, cmd *slack.SlashCommand) {
+	inv, err := b.aliases.Parse(statusSpec, cmd.Text)
+	if err != nil {
+		b.respond(ctx, cmd, completion{note: err.Error() + "\n" + inv.UsageText()}, slack.ResponseTypeEphemeral)
+		return
+	}
+	if inv.Help {
+		b.respond(ctx, cmd, completion{note: statusSpec.Help()}, slack.ResponseTypeEphemeral)
+		return
+	}
+	model, source := b.channelModel(cmd.ChannelID)
+	lines := []string{fmt.Sprintf("• Model: `%s`, %s", model, source)}
+	if b.retains(cmd.ChannelID) {
+		lines = append(lines, "• Conversations are kept for follow-up questions")
+	} else {
+		lines = append(lines, "• Nothing is kept of the conversations")
+	}
+	b.respond(ctx, cmd, completion{note: "*Status of this channel*\n" + strings.Join(lines, "\n")}, slack.ResponseTypeEphemeral)
+}
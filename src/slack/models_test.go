@@ -0,0 +1,60 @@
+package slackhandler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestModelCommand(t *testing.T) {
+	store := &memoryStore{data: map[string][]string{}}
+	args := EventHandlerArgs{
+		AdminUsers:     []string{"U1"},
+		ModelAllowlist: []string{"gpt-4o", "gpt-4o-mini"},
+		Conversations:  store,
+		Channels:       map[string]ChannelSettings{"C1": {Model: "gpt-3.5-turbo"}},
+	}
+	b, api, _ := newFakeBot(t, args)
+	model := &paramsModel{}
+	b.gptClient = model
+	var responses []slack.WebhookMessage
+	responseServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg slack.WebhookMessage
+		_ = json.NewDecoder(r.Body).Decode(&msg)
+		responses = append(responses, msg)
+	}))
+	defer responseServer.Close()
+	ctx := context.Background()
+	command := func(name, user, text string) slack.WebhookMessage {
+		b.handleSlashCommand(ctx, api, &slack.SlashCommand{Command: name, Text: text, UserID: user, ChannelID: "C1", ResponseURL: responseServer.URL})
+		require.NotEmpty(t, responses)
+		return responses[len(responses)-1]
+	}
+
+	assert.Contains(t, command(modelCommand, "U2", "").Text, "answered by `gpt-3.5-turbo`, configured for this channel")
+	assert.Equal(t, "Only admins can switch the model.", command(modelCommand, "U2", "gpt-4o").Text)
+	assert.Contains(t, command(modelCommand, "U1", "gpt-5").Text, "`gpt-5` is not allowed")
+	switched := command(modelCommand, "U1", "gpt-4o")
+	assert.Equal(t, slack.ResponseTypeInChannel, switched.ResponseType)
+	assert.Equal(t, "<@U1> switched this channel to `gpt-4o`.", switched.Text)
+	assert.Equal(t, []string{"gpt-4o", "U1"}, store.data[modelKeyPrefix+"C1"])
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U2", Text: "<@U0BOT> what is go?", Channel: "C1", TimeStamp: "1.000001"})
+	assert.Equal(t, "gpt-4o", model.last().Model)
+	assert.Contains(t, command(statusCommand, "U2", "").Text, "Model: `gpt-4o`, switched by <@U1>")
+
+	// the switch survives a restart
+	restarted := newBot(EventHandlerArgs{Logger: logger, ModelAllowlist: args.ModelAllowlist, Conversations: store})
+	switchedModel, source := restarted.channelModel("C1")
+	assert.Equal(t, "gpt-4o", switchedModel)
+	assert.Equal(t, "switched by <@U1>", source)
+
+	assert.Equal(t, "<@U1> switched this channel to `gpt-3.5-turbo`.", command(modelCommand, "U1", modelDefault).Text)
+	assert.NotContains(t, store.data, modelKeyPrefix+"C1")
+}
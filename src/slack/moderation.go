@@ -0,0 +1,86 @@
+package slackhandler
+
+import (
+	"context"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/slack-go/slack"
+	"strings"
+)
+
+const (
+	// moderationRefusal is sent instead of answering a question flagged in a blocking category
+	moderationRefusal = "Sorry, I can't help with that one: it was flagged as %s by the content policy. " +
+		"If you think that's a mistake, try rephrasing it."
+	// moderationWarning is sent along with the answer to a question flagged in a warning category
+	moderationWarning = "Heads up: your question was flagged as %s by the content policy. I've answered it, but please " +
+		"keep questions within the usage guidelines."
+)
+
+// moderation checks questions with the moderation endpoint before they are answered
+type moderation struct {
+	moderator chatgpt.Moderator
+	// block are the categories questions are refused in, warn those they are answered with a warning in
+	block map[string]bool
+	warn  map[string]bool
+}
+
+// newModeration creates the moderation of questions, refusing those flagged in block and warning about those
+// flagged in warn. Flags in other categories are ignored.
+func newModeration(moderator chatgpt.Moderator, block, warn []string) *moderation {
+	m := &moderation{moderator: moderator, block: make(map[string]bool, len(block)), warn: make(map[string]bool, len(warn))}
+	for _, category := range block {
+		m.block[category] = true
+	}
+	for _, category := range warn {
+		m.warn[category] = true
+	}
+	return m
+}
+
+// moderationNotice returns the refusal of a question flagged in a blocking category, or the warning to send
+// along with the answer of one flagged in a warning category. Questions that could not be checked are answered.
+func (b *bot) moderationNotice(ctx context.Context, question string) (refusal, warning string) {
+	if b.moderation == nil {
+		return "", ""
+	}
+	flagged, err := chatgpt.Moderate(ctx, b.moderation.moderator, question)
+	if err != nil {
+		b.logger.Printf("failed moderating question, answering it: %v\n", err)
+		return "", ""
+	}
+	var blocked, warned []string
+	for _, category := range flagged {
+		switch {
+		case b.moderation.block[category]:
+			blocked = append(blocked, category)
+		case b.moderation.warn[category]:
+			warned = append(warned, category)
+		}
+	}
+	if len(blocked) > 0 {
+		return fmt.Sprintf(moderationRefusal, strings.Join(blocked, ", ")), ""
+	}
+	if len(warned) > 0 {
+		return "", fmt.Sprintf(moderationWarning, strings.Join(warned, ", "))
+	}
+	return "", ""
+}
+
+// moderated reports whether question may be answered, telling user why not when it is refused and warning them
+// when it is answered despite being flagged
+func (b *bot) moderated(ctx context.Context, api *slack.Client, channel, threadTS, user, question string) bool {
+	refusal, warning := b.moderationNotice(ctx, question)
+	notice := refusal + warning
+	if notice == "" {
+		return true
+	}
+	options := []slack.MsgOption{slack.MsgOptionText(notice, false)}
+	if threadTS != "" {
+		options = append(options, slack.MsgOptionTS(threadTS))
+	}
+	if _, err := api.PostEphemeralContext(ctx, channel, user, options...); err != nil {
+		b.logger.Printf("failed sending moderation notice to %v: %v\n", user, err)
+	}
+	return refusal == ""
+}
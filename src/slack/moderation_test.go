@@ -0,0 +1,82 @@
+package slackhandler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestModeration(t *testing.T) {
+	tests := []struct {
+		name          string
+		args          EventHandlerArgs
+		question      string
+		wantAnswered  bool
+		wantEphemeral string
+	}{
+		{"clean", EventHandlerArgs{Moderation: true}, "what is go", true, ""},
+		{"blocked by default", EventHandlerArgs{Moderation: true}, "a violent question", false, "Sorry, I can't help with that one: it was flagged as violence by the content policy."},
+		{"warned", EventHandlerArgs{Moderation: true, ModerationWarn: []string{"violence"}}, "a violent question", true, "Heads up: your question was flagged as violence by the content policy."},
+		{"neither", EventHandlerArgs{Moderation: true, ModerationBlock: []string{"hate"}}, "a violent question", true, ""},
+		{"blocking wins", EventHandlerArgs{Moderation: true, ModerationWarn: []string{"violence"}}, "a violent and hateful question", false, "flagged as hate by"},
+		{"disabled", EventHandlerArgs{}, "a violent question", true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, api, slackServer := newFakeBot(t, tt.args)
+			b.answerMention(context.Background(), api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> " + tt.question, Channel: "C1", TimeStamp: "1.000001"})
+			if tt.wantAnswered {
+				assert.Len(t, slackServer.Messages(), 1)
+			} else {
+				assert.Empty(t, slackServer.Messages())
+			}
+			ephemerals := slackServer.Ephemerals()
+			if tt.wantEphemeral == "" {
+				assert.Empty(t, ephemerals)
+				return
+			}
+			require.Len(t, ephemerals, 1)
+			assert.Contains(t, ephemerals[0].Text, tt.wantEphemeral)
+			assert.Equal(t, "1.000001", ephemerals[0].ThreadTS)
+		})
+	}
+}
+
+func TestModerationSlashCommand(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{Moderation: true})
+	var responses []slack.WebhookMessage
+	responseServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg slack.WebhookMessage
+		_ = json.NewDecoder(r.Body).Decode(&msg)
+		responses = append(responses, msg)
+	}))
+	defer responseServer.Close()
+
+	b.handleSlashCommand(context.Background(), api, &slack.SlashCommand{Command: gptCommand, Text: "a violent question", UserID: "U1", ChannelID: "C1", ResponseURL: responseServer.URL})
+	require.Len(t, responses, 1)
+	assert.Equal(t, slack.ResponseTypeEphemeral, responses[0].ResponseType)
+	assert.Contains(t, responses[0].Text, "flagged as violence")
+	assert.Empty(t, slackServer.Messages())
+}
+
+func TestModerationEditedQuestion(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{Moderation: true, OnQuestionEdit: EditUpdate})
+	ctx := context.Background()
+	b.handleMessage(ctx, api, &slackevents.MessageEvent{Type: string(slackevents.Message), User: "U1", Text: "what is go", Channel: "D1", TimeStamp: "1.000001"})
+	b.handleMessage(ctx, api, editEvent("D1", "1.000001", "what is go", "a violent question"))
+
+	messages := slackServer.Messages()
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0].Text, "fake answer to: what is go", "the answer is not regenerated")
+	ephemerals := slackServer.Ephemerals()
+	require.Len(t, ephemerals, 1)
+	assert.Contains(t, ephemerals[0].Text, "flagged as violence")
+	history, _ := b.convo.Get("D1")
+	assert.Equal(t, []string{"what is go", "fake answer to: what is go"}, history)
+}
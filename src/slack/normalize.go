@@ -0,0 +1,177 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/cache"
+	"github.com/kyokomi/emoji/v2"
+	"github.com/slack-go/slack"
+	"regexp"
+	"strings"
+)
+
+// MentionMode is how user mentions in a question are turned into prompt text
+type MentionMode string
+
+const (
+	// MentionStrip removes every user mention
+	MentionStrip MentionMode = "strip"
+	// MentionResolve removes the bot's own mention and replaces the others with display names
+	MentionResolve MentionMode = "resolve"
+)
+
+// normalizeRule rewrites message text on the way to becoming a prompt
+type normalizeRule func(text string) string
+
+var (
+	// userMentionPattern captures the user ID and optional label of a mention such as <@U123|name>
+	userMentionPattern = regexp.MustCompile(`<@([A-Z0-9]+)(?:\|([^<>]*))?>`)
+	// channelPattern captures the ID and optional name of a channel reference such as <#C123|general>
+	channelPattern = regexp.MustCompile(`<#([A-Z0-9]+)(?:\|([^<>]*))?>`)
+	// specialPattern captures special mentions such as <!here> or <!subteam^S123|@team>
+	specialPattern = regexp.MustCompile(`<!([^<>|]+)(?:\|([^<>]*))?>`)
+	// linkPattern captures the url and optional label of a link such as <https://example.com|example>
+	linkPattern = regexp.MustCompile(`<([a-z][a-z0-9+.\-]*:[^<>|]*)(?:\|([^<>]*))?>`)
+	// emojiPattern matches emoji shortcodes such as :smile: or :+1:
+	emojiPattern = regexp.MustCompile(`:[a-z0-9_+'\-]+:`)
+)
+
+// entityUnescaper reverses the escaping slack applies to &, < and > in message text
+var entityUnescaper = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&")
+
+// normalize applies rules to text in order and collapses whitespace
+func normalize(text string, rules ...normalizeRule) string {
+	for _, rule := range rules {
+		text = rule(text)
+	}
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// stripUserMention removes mentions of userID
+func stripUserMention(userID string) normalizeRule {
+	return func(text string) string {
+		return userMentionPattern.ReplaceAllStringFunc(text, func(m string) string {
+			if userMentionPattern.FindStringSubmatch(m)[1] == userID {
+				return " "
+			}
+			return m
+		})
+	}
+}
+
+// resolveMentions replaces user mentions with @ and the name returned by name, falling back to the
+// mention's label and then the user ID when the name is unknown
+func resolveMentions(name func(userID string) string) normalizeRule {
+	return func(text string) string {
+		return userMentionPattern.ReplaceAllStringFunc(text, func(m string) string {
+			sub := userMentionPattern.FindStringSubmatch(m)
+			if n := name(sub[1]); n != "" {
+				return "@" + n
+			}
+			if sub[2] != "" {
+				return "@" + strings.TrimPrefix(sub[2], "@")
+			}
+			return "@" + sub[1]
+		})
+	}
+}
+
+// formatReferences replaces channel references, special mentions and links with their readable text
+func formatReferences(text string) string {
+	text = channelPattern.ReplaceAllStringFunc(text, func(m string) string {
+		sub := channelPattern.FindStringSubmatch(m)
+		if sub[2] != "" {
+			return "#" + sub[2]
+		}
+		return "#" + sub[1]
+	})
+	text = specialPattern.ReplaceAllStringFunc(text, func(m string) string {
+		sub := specialPattern.FindStringSubmatch(m)
+		if sub[2] != "" {
+			return sub[2]
+		}
+		return "@" + sub[1]
+	})
+	return linkPattern.ReplaceAllStringFunc(text, func(m string) string {
+		sub := linkPattern.FindStringSubmatch(m)
+		url := strings.TrimPrefix(sub[1], "mailto:")
+		if sub[2] == "" || sub[2] == url {
+			return url
+		}
+		return sub[2] + " (" + url + ")"
+	})
+}
+
+// expandEmoji replaces emoji shortcodes with the emoji they stand for, unknown shortcodes such as
+// custom workspace emoji are left as they are
+func expandEmoji(text string) string {
+	codes := emoji.CodeMap()
+	return emojiPattern.ReplaceAllStringFunc(text, func(m string) string {
+		if e, ok := codes[m]; ok {
+			return e
+		}
+		return m
+	})
+}
+
+// unescapeEntities reverses slack's escaping of &, < and >. It must run last so escaped text is
+// never mistaken for a mention or link.
+func unescapeEntities(text string) string {
+	return entityUnescaper.Replace(text)
+}
+
+// userNames caches the display names of users mentioned in questions
+type userNames struct {
+	data *cache.LRU[string]
+}
+
+// newUserNames creates a name cache holding at most maxEntries users, 0 disables the bound
+func newUserNames(maxEntries int) *userNames {
+	return &userNames{data: cache.NewLRU[string]("user_names", maxEntries, 0, nil)}
+}
+
+// get returns the display name of userID, or "" when it cannot be looked up
+func (u *userNames) get(ctx context.Context, api *slack.Client, userID string) string {
+	if name, ok := u.data.Get(userID); ok {
+		return name
+	}
+	user, err := api.GetUserInfoContext(ctx, userID)
+	if err != nil {
+		return ""
+	}
+	name := user.Profile.DisplayName
+	if name == "" {
+		name = user.RealName
+	}
+	if name == "" {
+		name = user.Name
+	}
+	u.data.Set(userID, name)
+	return name
+}
+
+// Stats reports the size and effectiveness of the name cache
+func (u *userNames) Stats() cache.Stats {
+	return u.data.Stats()
+}
+
+// prompt normalizes the text of a question before it is added to the conversation
+func (b *bot) prompt(ctx context.Context, api *slack.Client, text string) string {
+	var rules []normalizeRule
+	if b.overrides != nil {
+		rules = append(rules, stripOverrides)
+	}
+	if b.mentionMode == MentionStrip {
+		rules = append(rules, stripMentions)
+	} else {
+		selfUser, _, _ := b.self.get(ctx, api)
+		rules = append(rules,
+			stripUserMention(selfUser),
+			resolveMentions(func(userID string) string { return b.userNames.get(ctx, api, userID) }),
+		)
+	}
+	rules = append(rules, formatReferences)
+	if b.expandEmoji {
+		rules = append(rules, expandEmoji)
+	}
+	return normalize(text, append(rules, unescapeEntities)...)
+}
@@ -0,0 +1,66 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNormalizeRules(t *testing.T) {
+	names := map[string]string{"U1": "alice"}
+	resolve := resolveMentions(func(userID string) string { return names[userID] })
+	tests := []struct {
+		name string
+		rule normalizeRule
+		text string
+		want string
+	}{
+		{"strip bot mention", stripUserMention("UBOT"), "<@UBOT> hi <@U1>", "hi <@U1>"},
+		{"strip labelled bot mention", stripUserMention("UBOT"), "<@UBOT|bot> hi", "hi"},
+		{"resolve known user", resolve, "ask <@U1> about it", "ask @alice about it"},
+		{"resolve falls back to label", resolve, "ask <@U2|bob>", "ask @bob"},
+		{"resolve falls back to ID", resolve, "ask <@U2>", "ask @U2"},
+		{"channel with name", formatReferences, "see <#C1|general>", "see #general"},
+		{"channel without name", formatReferences, "see <#C1>", "see #C1"},
+		{"here", formatReferences, "<!here> look", "@here look"},
+		{"user group", formatReferences, "<!subteam^S1|@oncall> help", "@oncall help"},
+		{"bare link", formatReferences, "read <https://go.dev>", "read https://go.dev"},
+		{"labelled link", formatReferences, "read <https://go.dev|the docs>", "read the docs (https://go.dev)"},
+		{"mailto", formatReferences, "mail <mailto:a@b.c|a@b.c>", "mail a@b.c"},
+		{"emoji", expandEmoji, "nice :+1: :smile:", "nice \U0001f44d \U0001f604"},
+		{"skin tone", expandEmoji, ":wave::skin-tone-2:", "\U0001f44b\U0001f3fb"},
+		{"custom emoji", expandEmoji, ":party-parrot-custom:", ":party-parrot-custom:"},
+		{"time is not emoji", expandEmoji, "at 10:30:00", "at 10:30:00"},
+		{"entities", unescapeEntities, "a &lt;b&gt; &amp;amp;", "a <b> &amp;"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, normalize(tt.text, tt.rule))
+		})
+	}
+}
+
+func TestNormalize_EscapedTextIsNotAMention(t *testing.T) {
+	// a user typing "<@U1>" literally arrives escaped and must not be resolved
+	text := normalize("&lt;@U1&gt; <@U1>", resolveMentions(func(string) string { return "alice" }), unescapeEntities)
+	assert.Equal(t, "<@U1> @alice", text)
+}
+
+func TestPrompt(t *testing.T) {
+	tests := []struct {
+		name string
+		args EventHandlerArgs
+		want string
+	}{
+		// the fake slack server identifies the bot as U0BOT and names users "name-" + ID
+		{"strip", EventHandlerArgs{MentionMode: MentionStrip}, "ask about :tada: &amp; #general"},
+		{"resolve", EventHandlerArgs{MentionMode: MentionResolve, ExpandEmoji: true}, "ask @name-U1 about \U0001f389 &amp; #general"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, api, _ := newFakeBot(t, tt.args)
+			got := b.prompt(context.Background(), api, "<@U0BOT> ask <@U1> about :tada: &amp;amp; <#C1|general>")
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
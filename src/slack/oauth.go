@@ -0,0 +1,145 @@
+package slackhandler
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/slack-go/slack"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// installPath starts an installation in a workspace, oauthCallbackPath finishes it
+	installPath       = "/slack/install"
+	oauthCallbackPath = "/slack/oauth/callback"
+	// oauthStateTTL is how long an installation may take between its start and slack's callback
+	oauthStateTTL = 10 * time.Minute
+	// authorizeURL is where users approve the installation
+	authorizeURL = "https://slack.com/oauth/v2/authorize"
+)
+
+// DefaultBotScopes are the bot scopes asked for when installing the app, those of the setup walkthrough with
+// the slash commands and threads in channels. Features needing more scopes need them added.
+var DefaultBotScopes = []string{
+	"app_mentions:read", "channels:history", "chat:write", "commands", "im:history", "im:read", "im:write", "users:read",
+}
+
+// OAuth lets the app be installed in more workspaces through slack's OAuth flow, with the app's ClientID and
+// ClientSecret. Installations ask for Scopes, DefaultBotScopes when empty, and come back to RedirectURL, which
+// must be the https URL of oauthCallbackPath on the bot as registered in the app's settings.
+type OAuth struct {
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	RedirectURL  string
+}
+
+// installer serves the installation pages, saving the bot token of every workspace the app is installed in
+type installer struct {
+	oauth  OAuth
+	store  *InstallationStore
+	logger *log.Logger
+	// exchange trades the code of a finished installation for its tokens
+	exchange func(ctx context.Context, code string) (*slack.OAuthV2Response, error)
+	now      func() time.Time
+}
+
+// newInstaller creates an installer saving installations in store
+func newInstaller(oauth OAuth, store *InstallationStore, logger *log.Logger) *installer {
+	if len(oauth.Scopes) == 0 {
+		oauth.Scopes = DefaultBotScopes
+	}
+	i := &installer{oauth: oauth, store: store, logger: logger, now: time.Now}
+	client := &http.Client{Timeout: 10 * time.Second}
+	i.exchange = func(ctx context.Context, code string) (*slack.OAuthV2Response, error) {
+		return slack.GetOAuthV2ResponseContext(ctx, client, oauth.ClientID, oauth.ClientSecret, code, oauth.RedirectURL)
+	}
+	return i
+}
+
+// install sends the user to slack to approve installing the app in their workspace
+func (i *installer) install(w http.ResponseWriter, r *http.Request) {
+	query := url.Values{
+		"client_id":    {i.oauth.ClientID},
+		"scope":        {strings.Join(i.oauth.Scopes, ",")},
+		"redirect_uri": {i.oauth.RedirectURL},
+		"state":        {i.state(i.now())},
+	}
+	http.Redirect(w, r, authorizeURL+"?"+query.Encode(), http.StatusFound)
+}
+
+// callback finishes an installation approved in slack, saving the workspace's bot token
+func (i *installer) callback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if reason := query.Get("error"); reason != "" {
+		i.page(w, http.StatusOK, "The app was not installed: "+reason+".")
+		return
+	}
+	if !i.validState(query.Get("state")) {
+		i.page(w, http.StatusBadRequest, "This installation link has expired, please start again.")
+		return
+	}
+	resp, err := i.exchange(r.Context(), query.Get("code"))
+	if err != nil {
+		i.logger.Printf("failed finishing installation: %v\n", err)
+		i.page(w, http.StatusBadGateway, "The app could not be installed, please try again.")
+		return
+	}
+	installation := Installation{
+		TeamID:      resp.Team.ID,
+		TeamName:    resp.Team.Name,
+		BotToken:    resp.AccessToken,
+		BotUserID:   resp.BotUserID,
+		InstalledBy: resp.AuthedUser.ID,
+		At:          i.now().UTC(),
+	}
+	if err := i.store.Save(installation); err != nil {
+		// the installation is kept in memory until the next restart
+		i.logger.Printf("failed saving installation in %v: %v\n", installation.TeamID, err)
+	}
+	i.logger.Printf("installed in %v (%v) by %v\n", installation.TeamName, installation.TeamID, installation.InstalledBy)
+	i.page(w, http.StatusOK, "The app is installed in "+installation.TeamName+". Mention it in a channel to ask it something.")
+}
+
+// state returns the state of an installation started at now, which proves the callback comes from it. It is
+// signed rather than remembered so that any instance of the bot can finish the installation.
+func (i *installer) state(now time.Time) string {
+	ts := strconv.FormatInt(now.Unix(), 10)
+	return ts + "." + i.sign(ts)
+}
+
+// validState reports whether state was made by state within oauthStateTTL
+func (i *installer) validState(state string) bool {
+	ts, signature, ok := strings.Cut(state, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(i.sign(ts))) {
+		return false
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return false
+	}
+	age := i.now().Sub(time.Unix(unix, 0))
+	return age >= 0 && age <= oauthStateTTL
+}
+
+// sign returns the signature of ts with the client secret
+func (i *installer) sign(ts string) string {
+	mac := hmac.New(sha256.New, []byte(i.oauth.ClientSecret))
+	mac.Write([]byte("install:" + ts))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// page answers with a minimal HTML page saying message
+func (i *installer) page(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<!doctype html><title>slackgpt</title><p>%s</p>\n", html.EscapeString(message))
+}
@@ -0,0 +1,102 @@
+package slackhandler
+
+import (
+	"context"
+	"errors"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// newTestInstaller creates an installer whose code exchange answers for the workspace T1
+func newTestInstaller(t *testing.T, now time.Time) (*installer, *InstallationStore) {
+	store, err := NewInstallationStore("")
+	require.NoError(t, err)
+	i := newInstaller(OAuth{ClientID: "1.2", ClientSecret: "client-secret", RedirectURL: "https://bot.example.com/slack/oauth/callback"}, store, logger)
+	i.now = func() time.Time { return now }
+	i.exchange = func(_ context.Context, code string) (*slack.OAuthV2Response, error) {
+		if code != "good-code" {
+			return nil, errors.New("invalid_code")
+		}
+		resp := &slack.OAuthV2Response{AccessToken: "xoxb-acme", BotUserID: "U0ACME"}
+		resp.Team.ID, resp.Team.Name = "T1", "Acme"
+		resp.AuthedUser.ID = "U1"
+		return resp, nil
+	}
+	return i, store
+}
+
+func TestInstall(t *testing.T) {
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	i, _ := newTestInstaller(t, now)
+	w := httptest.NewRecorder()
+	i.install(w, httptest.NewRequest(http.MethodGet, installPath, nil))
+
+	require.Equal(t, http.StatusFound, w.Code)
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, authorizeURL, location.Scheme+"://"+location.Host+location.Path)
+	query := location.Query()
+	assert.Equal(t, "1.2", query.Get("client_id"))
+	assert.Equal(t, "app_mentions:read,channels:history,chat:write,commands,im:history,im:read,im:write,users:read", query.Get("scope"))
+	assert.Equal(t, "https://bot.example.com/slack/oauth/callback", query.Get("redirect_uri"))
+	assert.True(t, i.validState(query.Get("state")))
+}
+
+func TestOAuthCallback(t *testing.T) {
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		query         url.Values
+		wantStatus    int
+		wantBody      string
+		wantInstalled bool
+	}{
+		{"installed", url.Values{"code": {"good-code"}, "state": {"started"}}, http.StatusOK, "The app is installed in Acme.", true},
+		{"denied", url.Values{"error": {"access_denied"}, "state": {"started"}}, http.StatusOK, "The app was not installed: access_denied.", false},
+		{"forged state", url.Values{"code": {"good-code"}, "state": {"1677672000.c0ffee"}}, http.StatusBadRequest, "expired", false},
+		{"expired state", url.Values{"code": {"good-code"}, "state": {"stale"}}, http.StatusBadRequest, "expired", false},
+		{"no state", url.Values{"code": {"good-code"}}, http.StatusBadRequest, "expired", false},
+		{"bad code", url.Values{"code": {"bad-code"}, "state": {"started"}}, http.StatusBadGateway, "could not be installed", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i, store := newTestInstaller(t, now)
+			switch tt.query.Get("state") {
+			case "started":
+				tt.query.Set("state", i.state(now.Add(-time.Minute)))
+			case "stale":
+				tt.query.Set("state", i.state(now.Add(-oauthStateTTL-time.Second)))
+			}
+			w := httptest.NewRecorder()
+			i.callback(w, httptest.NewRequest(http.MethodGet, oauthCallbackPath+"?"+tt.query.Encode(), nil))
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantBody)
+			installation, ok := store.Get("T1")
+			require.Equal(t, tt.wantInstalled, ok)
+			if ok {
+				assert.Equal(t, Installation{TeamID: "T1", TeamName: "Acme", BotToken: "xoxb-acme", BotUserID: "U0ACME", InstalledBy: "U1", At: now}, installation)
+			}
+		})
+	}
+}
+
+func TestHTTPHandlerServesInstallation(t *testing.T) {
+	i, _ := newTestInstaller(t, time.Now())
+	h := &httpHandler{signingSecret: testSigningSecret, installer: i, work: context.Background()}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, installPath, nil))
+	assert.Equal(t, http.StatusFound, w.Code, "installation pages are not signed")
+
+	// without OAuth, they are requests from slack like any other
+	h.installer = nil
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, installPath, nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,175 @@
+package slackhandler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/slack-go/slack"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxTemperature is the highest temperature the chat API accepts
+const maxTemperature = 2
+
+// OverrideTier is what its users may change about the answer to a single question with inline parameters,
+// e.g. "@slackgpt [model=gpt-4o temp=0.9] what is go"
+type OverrideTier struct {
+	Name string
+	// Users are in the tier, a tier without users is that of everyone in no other tier
+	Users []string
+	// Models may be asked for with model=
+	Models []string
+	// MaxTemperature is the highest temp= allowed, 0 does not allow changing the temperature
+	MaxTemperature float32
+	// MaxTokens is the highest max_tokens= allowed, 0 does not allow changing it
+	MaxTokens int
+}
+
+// overridesPattern captures the inline parameters at the start of a question, after the bot's mention
+var overridesPattern = regexp.MustCompile(`^(\s*(?:<@[A-Z0-9]+>\s*)?)\[((?:\s*[a-z_]+=[^\s\]]+)+)\s*\]\s*`)
+
+// overrides are the inline parameters of a question
+type overrides struct {
+	model       string
+	temperature *float32
+	maxTokens   int
+}
+
+// options returns the completion options applying o
+func (o overrides) options() []chatgpt.Option {
+	opts := []chatgpt.Option{chatgpt.WithModel(o.model), chatgpt.WithMaxTokens(o.maxTokens)}
+	if o.temperature != nil {
+		opts = append(opts, chatgpt.WithTemperature(*o.temperature))
+	}
+	return opts
+}
+
+// overrideTiers finds the tier of a user
+type overrideTiers struct {
+	tiers map[string]*OverrideTier
+	// fallback is nil when users in no tier may not override anything
+	fallback *OverrideTier
+}
+
+// newOverrideTiers creates the lookup of the tiers, a user in several tiers is in the first
+func newOverrideTiers(tiers []OverrideTier) *overrideTiers {
+	o := &overrideTiers{tiers: map[string]*OverrideTier{}}
+	for i := range tiers {
+		tier := &tiers[i]
+		if len(tier.Users) == 0 && o.fallback == nil {
+			o.fallback = tier
+		}
+		for _, user := range tier.Users {
+			if _, ok := o.tiers[user]; !ok {
+				o.tiers[user] = tier
+			}
+		}
+	}
+	return o
+}
+
+// tier returns the tier of user, nil when they are in none or o is nil
+func (o *overrideTiers) tier(user string) *OverrideTier {
+	if o == nil {
+		return nil
+	}
+	if tier, ok := o.tiers[user]; ok {
+		return tier
+	}
+	return o.fallback
+}
+
+// stripOverrides removes the inline parameters from the start of text
+func stripOverrides(text string) string {
+	return overridesPattern.ReplaceAllString(text, "$1")
+}
+
+// parse returns the inline parameters at the start of text once checked against the tier of user. An error
+// says why they cannot be applied.
+func (o *overrideTiers) parse(text, user string) (overrides, error) {
+	var parsed overrides
+	m := overridesPattern.FindStringSubmatch(text)
+	if m == nil {
+		return parsed, nil
+	}
+	tier := o.tier(user)
+	if tier == nil {
+		return parsed, errors.New("you may not change how questions are answered")
+	}
+	for _, param := range strings.Fields(m[2]) {
+		key, value, _ := strings.Cut(param, "=")
+		switch key {
+		case "model":
+			if !slices.Contains(tier.Models, value) {
+				return parsed, fmt.Errorf("model %s is not allowed in the %s tier, %s", value, tier.Name, allowedModels(tier.Models))
+			}
+			parsed.model = value
+		case "temp", "temperature":
+			temperature, err := strconv.ParseFloat(value, 32)
+			if err != nil || temperature < 0 || temperature > maxTemperature {
+				return parsed, fmt.Errorf("temp must be a number from 0 to %d, got %s", maxTemperature, value)
+			}
+			if float32(temperature) > tier.MaxTemperature {
+				return parsed, fmt.Errorf("temp %s is above the %v allowed in the %s tier", value, tier.MaxTemperature, tier.Name)
+			}
+			t := float32(temperature)
+			parsed.temperature = &t
+		case "max_tokens":
+			maxTokens, err := strconv.Atoi(value)
+			if err != nil || maxTokens < 1 {
+				return parsed, fmt.Errorf("max_tokens must be a positive number, got %s", value)
+			}
+			if maxTokens > tier.MaxTokens {
+				return parsed, fmt.Errorf("max_tokens %d is above the %d allowed in the %s tier", maxTokens, tier.MaxTokens, tier.Name)
+			}
+			parsed.maxTokens = maxTokens
+		default:
+			return parsed, fmt.Errorf("unknown parameter %s, use model, temp or max_tokens", key)
+		}
+	}
+	return parsed, nil
+}
+
+// allowedModels describes the models a tier may ask for
+func allowedModels(models []string) string {
+	if len(models) == 0 {
+		return "which may not choose a model"
+	}
+	return "choose one of " + strings.Join(models, ", ")
+}
+
+// tierLimits describes what the users of tier may change
+func tierLimits(tier *OverrideTier) string {
+	limits := []string{"the " + tier.Name + " tier may " + strings.TrimPrefix(allowedModels(tier.Models), "which ")}
+	if tier.MaxTemperature > 0 {
+		limits = append(limits, fmt.Sprintf("temp up to %v", tier.MaxTemperature))
+	}
+	if tier.MaxTokens > 0 {
+		limits = append(limits, fmt.Sprintf("max_tokens up to %d", tier.MaxTokens))
+	}
+	return strings.Join(limits, ", ")
+}
+
+// questionOverrides returns the completion options of the inline parameters of a question from user, telling
+// them why when they cannot be applied and the question is not answered
+func (b *bot) questionOverrides(ctx context.Context, api *slack.Client, channel, threadTS, user, text string) ([]chatgpt.Option, bool) {
+	if b.overrides == nil {
+		return nil, true
+	}
+	parsed, err := b.overrides.parse(text, user)
+	if err == nil {
+		return parsed.options(), true
+	}
+	options := []slack.MsgOption{slack.MsgOptionText("Your question was not answered: "+err.Error()+".", false)}
+	if threadTS != "" {
+		options = append(options, slack.MsgOptionTS(threadTS))
+	}
+	if _, err := api.PostEphemeralContext(ctx, channel, user, options...); err != nil {
+		b.logger.Printf("failed telling %v about their parameters: %v\n", user, err)
+	}
+	return nil, false
+}
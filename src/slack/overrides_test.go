@@ -0,0 +1,108 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+var testOverrideTiers = []OverrideTier{
+	{Name: "power", Users: []string{"U1"}, Models: []string{"gpt-4o", "gpt-3.5-turbo"}, MaxTemperature: 2, MaxTokens: 4000},
+	{Name: "standard", Models: []string{"gpt-3.5-turbo"}, MaxTemperature: 1},
+}
+
+func TestParseOverrides(t *testing.T) {
+	temperature := func(t float32) *float32 { return &t }
+	tests := []struct {
+		name    string
+		text    string
+		user    string
+		want    overrides
+		wantErr string
+	}{
+		{"no parameters", "<@U0BOT> what is go", "U1", overrides{}, ""},
+		{"all", "<@U0BOT> [model=gpt-4o temp=0.9 max_tokens=2000] what is go", "U1", overrides{model: "gpt-4o", temperature: temperature(0.9), maxTokens: 2000}, ""},
+		{"without a mention", "[temperature=0] what is go", "U1", overrides{temperature: temperature(0)}, ""},
+		{"not parameters", "<@U0BOT> [draft] what is go", "U1", overrides{}, ""},
+		{"not at the start", "what is [model=gpt-4o]", "U1", overrides{}, ""},
+		{"model outside the tier", "[model=gpt-4o] what is go", "U2", overrides{}, "model gpt-4o is not allowed in the standard tier, choose one of gpt-3.5-turbo"},
+		{"temperature above the tier's", "[temp=1.5] what is go", "U2", overrides{}, "temp 1.5 is above the 1 allowed in the standard tier"},
+		{"temperature out of range", "[temp=3] what is go", "U1", overrides{}, "temp must be a number from 0 to 2, got 3"},
+		{"max tokens not allowed", "[max_tokens=100] what is go", "U2", overrides{}, "max_tokens 100 is above the 0 allowed in the standard tier"},
+		{"bad max tokens", "[max_tokens=lots] what is go", "U1", overrides{}, "max_tokens must be a positive number, got lots"},
+		{"unknown", "[top_p=0.1] what is go", "U1", overrides{}, "unknown parameter top_p, use model, temp or max_tokens"},
+	}
+	tiers := newOverrideTiers(testOverrideTiers)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tiers.parse(tt.text, tt.user)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := newOverrideTiers(testOverrideTiers[:1]).parse("[model=gpt-4o] what is go", "U2")
+	assert.EqualError(t, err, "you may not change how questions are answered", "users in no tier may not override")
+}
+
+func TestStripOverrides(t *testing.T) {
+	assert.Equal(t, "<@U0BOT> what is go", stripOverrides("<@U0BOT> [model=gpt-4o temp=0.9] what is go"))
+	assert.Equal(t, "<@U0BOT> [draft] what is go", stripOverrides("<@U0BOT> [draft] what is go"))
+}
+
+// paramsModel records the parameters it was asked to answer with
+type paramsModel struct {
+	mu  sync.Mutex
+	req openai.ChatCompletionRequest
+}
+
+func (m *paramsModel) CreateChatCompletion(_ context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	m.mu.Lock()
+	m.req = req
+	m.mu.Unlock()
+	message := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "go is a language"}
+	return openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{Message: message}}}, nil
+}
+
+func (m *paramsModel) last() openai.ChatCompletionRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.req
+}
+
+func TestOverrides(t *testing.T) {
+	ctx := context.Background()
+	slackServer := fake.NewSlack()
+	t.Cleanup(slackServer.Close)
+	api := slack.New("xoxb-test", slack.OptionAPIURL(slackServer.APIURL()))
+	model := &paramsModel{}
+	b := newBot(EventHandlerArgs{Logger: logger, GPTClient: model, OverrideTiers: testOverrideTiers})
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> [model=gpt-4o temp=0.9] what is go", Channel: "C1", TimeStamp: "1.000001"})
+	req := model.last()
+	assert.Equal(t, "gpt-4o", req.Model)
+	assert.Equal(t, float32(0.9), req.Temperature)
+	assert.Equal(t, "what is go", req.Messages[len(req.Messages)-1].Content, "parameters are not part of the question")
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> and rust?", Channel: "C1", TimeStamp: "1.000002", ThreadTimeStamp: "1.000001"})
+	req = model.last()
+	assert.Equal(t, string(chatgpt.DefaultModel), req.Model, "parameters only apply to their question")
+	assert.Equal(t, float32(0.5), req.Temperature)
+
+	b.answerMessage(ctx, api, &slackevents.MessageEvent{User: "U2", Text: "[model=gpt-4o] what is go", Channel: "D1", ChannelType: "im", TimeStamp: "2.000001"})
+	assert.Len(t, slackServer.Messages(), 2, "questions with parameters outside the tier are not answered")
+	ephemerals := slackServer.Ephemerals()
+	require.Len(t, ephemerals, 1)
+	assert.Equal(t, "Your question was not answered: model gpt-4o is not allowed in the standard tier, choose one of gpt-3.5-turbo.", ephemerals[0].Text)
+}
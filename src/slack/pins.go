@@ -0,0 +1,191 @@
+package slackhandler
+
+import (
+	"context"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/cache"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"regexp"
+	"strings"
+)
+
+const (
+	// maxPins is the most messages pinned as context of a thread
+	maxPins = 10
+	// maxPinnedText is the most characters kept of a pinned message, so a huge log does not crowd out the thread
+	maxPinnedText = 8000
+)
+
+var (
+	// pinCommandPattern matches pinning a message as context of the thread: the one linked, or the one before the
+	// command in the thread
+	pinCommandPattern = regexp.MustCompile(`(?i)^(?:<@[A-Z0-9]+>\s*)?pin(?:\s+this)?(?:\s+as\s+context)?(?:\s+<?(https?://[^\s>|]+)[^\s>]*>?)?\s*$`)
+	// unpinCommandPattern matches unpinning the message linked, or every message pinned in the thread
+	unpinCommandPattern = regexp.MustCompile(`(?i)^(?:<@[A-Z0-9]+>\s*)?unpin(?:\s+all|\s+<?(https?://[^\s>|]+)[^\s>]*>?)?\s*$`)
+)
+
+// pinnedMessage is a message pinned as context of a thread, always sent to chat-gpt with the thread's conversation
+type pinnedMessage struct {
+	TS   string
+	User string
+	Text string
+}
+
+// pins stores the messages pinned in threads by conversation key
+type pins struct {
+	data *cache.LRU[[]pinnedMessage]
+}
+
+// newPins creates a pin store holding the pins of at most maxEntries threads, 0 disables the bound
+func newPins(maxEntries int) *pins {
+	return &pins{data: cache.NewLRU[[]pinnedMessage]("pins", maxEntries, 0, nil)}
+}
+
+// Get returns the messages pinned in the thread with conversation key, oldest pin first
+func (p *pins) Get(key string) []pinnedMessage {
+	pinned, _ := p.data.Get(key)
+	return pinned
+}
+
+// Pin pins msg in the thread with conversation key, reporting false when it already is or the thread has maxPins
+func (p *pins) Pin(key string, msg pinnedMessage) bool {
+	pinned := false
+	p.data.Update(key, func(existing []pinnedMessage, _ bool) []pinnedMessage {
+		if len(existing) >= maxPins {
+			return existing
+		}
+		for _, m := range existing {
+			if m.TS == msg.TS {
+				return existing
+			}
+		}
+		pinned = true
+		return append(existing[:len(existing):len(existing)], msg)
+	})
+	return pinned
+}
+
+// Unpin unpins the message posted at ts in the thread with conversation key, every message when ts is empty, and
+// returns how many were unpinned
+func (p *pins) Unpin(key, ts string) int {
+	existing := p.Get(key)
+	var kept []pinnedMessage
+	for _, m := range existing {
+		if ts != "" && m.TS != ts {
+			kept = append(kept, m)
+		}
+	}
+	if len(kept) == 0 {
+		p.data.Delete(key)
+	} else {
+		p.data.Set(key, kept)
+	}
+	return len(existing) - len(kept)
+}
+
+// Stats reports the size and effectiveness of the pin store
+func (p *pins) Stats() cache.Stats {
+	return p.data.Stats()
+}
+
+// withPins returns history preceded by the messages pinned in the thread with conversation key, if any
+func (b *bot) withPins(key string, history []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	pinned := b.pins.Get(key)
+	if len(pinned) == 0 {
+		return history
+	}
+	parts := []string{"These messages are pinned as context of this conversation, keep them in mind when answering:"}
+	for _, m := range pinned {
+		parts = append(parts, fmt.Sprintf("<@%s> wrote:\n%s", m.User, m.Text))
+	}
+	pinnedContext := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: strings.Join(parts, "\n\n")}
+	return append([]openai.ChatCompletionMessage{pinnedContext}, history...)
+}
+
+// pinCommand pins a message as context of the thread messageTS was posted in, or unpins messages, reporting
+// whether text was the command. The message pinned is the one linked in text, or the one before the command in
+// the thread.
+func (b *bot) pinCommand(ctx context.Context, api *slack.Client, channel, threadTS, messageTS, user, text string) bool {
+	text = strings.TrimSpace(text)
+	pin, unpin := pinCommandPattern.FindStringSubmatch(text), unpinCommandPattern.FindStringSubmatch(text)
+	if pin == nil && unpin == nil {
+		return false
+	}
+	key := ConversationKey(channel, threadTS)
+	var reply string
+	switch {
+	case !b.retains(channel):
+		reply = "Nothing is kept in this channel, so I cannot pin messages here."
+	case unpin != nil:
+		ts := ""
+		if link := messageLinkPattern.FindStringSubmatch(unpin[1]); link != nil {
+			ts = link[2] + "." + link[3]
+		}
+		switch n := b.pins.Unpin(key, ts); n {
+		case 0:
+			reply = "Nothing like that is pinned in this thread."
+		case 1:
+			reply = "Unpinned, I'll no longer keep it in mind here."
+		default:
+			reply = fmt.Sprintf("Unpinned %d messages, I'll no longer keep them in mind here.", n)
+		}
+	default:
+		reply = b.pinMessage(ctx, api, channel, threadTS, messageTS, user, key, pin[1])
+	}
+	b.logger.Printf("pin command in %v: %s\n", channel, reply)
+	options := []slack.MsgOption{slack.MsgOptionText(reply, false)}
+	if threadTS != "" {
+		options = append(options, slack.MsgOptionTS(threadTS))
+	}
+	if _, _, err := api.PostMessageContext(ctx, channel, options...); err != nil {
+		b.logger.Printf("failed answering pin command: %v\n", err)
+	}
+	return true
+}
+
+// pinMessage pins the message linked, or the one before messageTS in the thread of threadTS, in the thread with
+// conversation key, and returns the reply telling user how it went
+func (b *bot) pinMessage(ctx context.Context, api *slack.Client, channel, threadTS, messageTS, user, key, linked string) string {
+	targetChannel, targetTS := channel, ""
+	if link := messageLinkPattern.FindStringSubmatch(linked); link != nil {
+		targetChannel, targetTS = link[1], link[2]+"."+link[3]
+	} else if threadTS == "" || threadTS == messageTS {
+		return "Usage: pin this as context, in a thread after the message to pin, or pin <message link>"
+	}
+	params := &slack.GetConversationRepliesParameters{ChannelID: targetChannel, Timestamp: targetTS, Limit: 200}
+	if targetTS == "" {
+		params.Timestamp, params.Latest = threadTS, messageTS
+	}
+	messages, _, _, err := api.GetConversationRepliesContext(ctx, params)
+	if err != nil {
+		b.logger.Printf("failed reading the message to pin in %v: %v\n", targetChannel, err)
+		return "I could not read that message. Is it in a channel I am a member of?"
+	}
+	selfUser, selfBot, _ := b.self.get(ctx, api)
+	var found *slack.Message
+	for i := range messages {
+		m := &messages[i]
+		switch {
+		case targetTS != "":
+			if m.Timestamp == targetTS {
+				found = m
+			}
+		case m.Timestamp != messageTS && (selfUser == "" || m.User != selfUser) && (selfBot == "" || m.BotID != selfBot):
+			found = m
+		}
+	}
+	if found == nil {
+		return "I could not find the message to pin."
+	}
+	pinned := truncateRunes(b.prompt(ctx, api, found.Text), maxPinnedText)
+	author := found.User
+	if author == "" {
+		author = found.BotID
+	}
+	if !b.pins.Pin(key, pinnedMessage{TS: found.Timestamp, User: author, Text: pinned}) {
+		return fmt.Sprintf("It is already pinned, or %d messages are pinned in this thread already.", maxPins)
+	}
+	b.logger.Printf("%s pinned %s as context in %v\n", user, found.Timestamp, channel)
+	return "Pinned, I'll keep it in mind for the rest of this thread. `unpin` forgets it."
+}
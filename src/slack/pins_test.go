@@ -0,0 +1,69 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestPins(t *testing.T) {
+	p := newPins(0)
+	assert.True(t, p.Pin("k", pinnedMessage{TS: "1.000001", User: "U1", Text: "spec"}))
+	assert.False(t, p.Pin("k", pinnedMessage{TS: "1.000001", User: "U1", Text: "spec"}), "already pinned")
+	assert.True(t, p.Pin("k", pinnedMessage{TS: "1.000002", User: "U2", Text: "log"}))
+	assert.Len(t, p.Get("k"), 2)
+	assert.Empty(t, p.Get("other"))
+
+	assert.Equal(t, 1, p.Unpin("k", "1.000001"))
+	assert.Equal(t, []pinnedMessage{{TS: "1.000002", User: "U2", Text: "log"}}, p.Get("k"))
+	assert.Equal(t, 0, p.Unpin("k", "9.000001"))
+	assert.Equal(t, 1, p.Unpin("k", ""))
+	assert.Empty(t, p.Get("k"))
+}
+
+func TestPinCommand(t *testing.T) {
+	ctx := context.Background()
+	slackServer := fake.NewSlack()
+	t.Cleanup(slackServer.Close)
+	api := slack.New("xoxb-test", slack.OptionAPIURL(slackServer.APIURL()))
+	model := &paramsModel{}
+	b := newBot(EventHandlerArgs{Logger: logger, GPTClient: model})
+
+	parent := slackServer.AddMessage(fake.Message{Channel: "C1", User: "U1", Text: "the login page is down"})
+	log := slackServer.AddMessage(fake.Message{Channel: "C1", User: "U2", Text: "panic: nil map in session.go:42", ThreadTS: parent.TS})
+	mention := func(text string) {
+		msg := slackServer.AddMessage(fake.Message{Channel: "C1", User: "U1", Text: text, ThreadTS: parent.TS})
+		b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: text, Channel: "C1", TimeStamp: msg.TS, ThreadTimeStamp: parent.TS})
+	}
+
+	mention("<@U0BOT> pin this as context")
+	messages := slackServer.Messages()
+	assert.Contains(t, messages[len(messages)-1].Text, "Pinned")
+	require.Len(t, b.pins.Get(ConversationKey("C1", parent.TS)), 1)
+	assert.Equal(t, log.TS, b.pins.Get(ConversationKey("C1", parent.TS))[0].TS)
+
+	mention("<@U0BOT> what causes it?")
+	req := model.last()
+	require.True(t, len(req.Messages) > 2)
+	assert.Equal(t, openai.ChatMessageRoleSystem, req.Messages[1].Role, "the pinned messages follow the system prompt")
+	assert.Contains(t, req.Messages[1].Content, "<@U2> wrote:\npanic: nil map in session.go:42")
+
+	mention("<@U0BOT> unpin")
+	messages = slackServer.Messages()
+	assert.Contains(t, messages[len(messages)-1].Text, "Unpinned")
+	assert.Empty(t, b.pins.Get(ConversationKey("C1", parent.TS)))
+
+	mention("<@U0BOT> pin <https://acme.slack.com/archives/C1/p" + strings.Replace(parent.TS, ".", "", 1) + ">")
+	require.Len(t, b.pins.Get(ConversationKey("C1", parent.TS)), 1)
+	assert.Equal(t, "the login page is down", b.pins.Get(ConversationKey("C1", parent.TS))[0].Text, "the message linked")
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> pin this", Channel: "C1", TimeStamp: "9.000001"})
+	messages = slackServer.Messages()
+	assert.Contains(t, messages[len(messages)-1].Text, "Usage: pin this as context", "a new thread has nothing before the command")
+}
@@ -0,0 +1,157 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/metrics"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/slack-go/slack/socketmode"
+	"log"
+	"runtime/debug"
+	"time"
+)
+
+// HandlerFunc handles an event slack sent, answering it with api, the client of the workspace it was sent from
+type HandlerFunc func(ctx context.Context, api *slack.Client, evt *socketmode.Event)
+
+// Middleware wraps the handling of every event with a concern they share, such as logging, metrics or access
+// control. It calls next to go on handling the event, or returns without calling it to drop the event.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Chain returns h wrapped in middlewares, the first one outermost
+func Chain(h HandlerFunc, middlewares ...Middleware) HandlerFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// newPipeline returns the middlewares every event goes through, in order: panic recovery, status and metrics,
+// duplicates, ignored users, tracing and logging, then those of args. Rate limits and access control are not
+// stages: only questions are limited, and an event is only known to be one once commands and FAQ answers have
+// been ruled out, so every path answering one checks them itself, see mayAnswer.
+func (b *bot) newPipeline(args EventHandlerArgs) []Middleware {
+	return append([]Middleware{
+		recoverPanics(b.logger, args.Metrics),
+		instrument(args.Status, args.Metrics),
+		b.skipDuplicates,
+		b.ignoreUsers,
+		b.traceEvents,
+		logEvents(b.logger),
+	}, args.Middlewares...)
+}
+
+// handler returns h wrapped in the bot's pipeline
+func (b *bot) handler(h HandlerFunc) HandlerFunc {
+	return Chain(h, b.pipeline...)
+}
+
+// recoverPanics logs the events whose handling panicked and counts them in m, so that one bad event does not take
+// the bot down
+func recoverPanics(logger *log.Logger, m *metrics.Metrics) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, api *slack.Client, evt *socketmode.Event) {
+			defer func() {
+				if v := recover(); v != nil {
+					m.Error("panic")
+					logger.Printf("panic handling %s event: %v\n%s", eventType(evt), v, debug.Stack())
+				}
+			}()
+			next(ctx, api, evt)
+		}
+	}
+}
+
+// instrument records the events being handled in status and how long they took in m
+func instrument(status *HandlerStatus, m *metrics.Metrics) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, api *slack.Client, evt *socketmode.Event) {
+			token := status.start(evt)
+			defer status.done(token)
+			start := time.Now()
+			defer func() { m.EventHandled(eventType(evt), time.Since(start)) }()
+			next(ctx, api, evt)
+		}
+	}
+}
+
+// ignoreUsers drops the events of the ignored users and bots, whatever they are: questions, commands or clicks
+func (b *bot) ignoreUsers(next HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, api *slack.Client, evt *socketmode.Event) {
+		if _, user, botID := eventOrigin(evt); b.ignoredUsers[user] || botID != "" && b.ignoredUsers[botID] {
+			b.logger.Printf("Ignored %s event from ignored user %s\n", eventType(evt), user+botID)
+			return
+		}
+		next(ctx, api, evt)
+	}
+}
+
+// traceEvents traces the handling of the events users sent, see traceEvent
+func (b *bot) traceEvents(next HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, api *slack.Client, evt *socketmode.Event) {
+		switch evt.Type {
+		case socketmode.EventTypeEventsAPI, socketmode.EventTypeInteractive, socketmode.EventTypeSlashCommand:
+			ctx, span := b.traceEvent(ctx, evt)
+			defer span.End()
+			next(ctx, api, evt)
+		default:
+			next(ctx, api, evt)
+		}
+	}
+}
+
+// logEvents logs how long the events slack sent took to handle
+func logEvents(logger *log.Logger) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, api *slack.Client, evt *socketmode.Event) {
+			start := time.Now()
+			next(ctx, api, evt)
+			if evt.Request != nil && evt.Request.EnvelopeID != "" {
+				logger.Printf("handled %s event %s in %v\n", eventType(evt), evt.Request.EnvelopeID, time.Since(start).Round(time.Millisecond))
+			}
+		}
+	}
+}
+
+// acknowledge acknowledges the events slack sent through client before they are handled, so slack does not send
+// them again however long they take. Hello events come with a request but no envelope, there is nothing to
+// acknowledge. Submitted forms are replaced with a notice while they are checked, and the prompt composer is kept
+// open with its problems, the ack is the only way to do so.
+func (b *bot) acknowledge(client *socketmode.Client) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, api *slack.Client, evt *socketmode.Event) {
+			if evt.Request != nil && evt.Request.EnvelopeID != "" {
+				var payload []any
+				if callback, ok := evt.Data.(slack.InteractionCallback); ok {
+					if resp := b.submissionResponse(&callback); resp != nil {
+						payload = append(payload, resp)
+					}
+				}
+				client.Ack(*evt.Request, payload...)
+			}
+			next(ctx, api, evt)
+		}
+	}
+}
+
+// eventOrigin returns the channel, user and bot evt was sent from, those it has
+func eventOrigin(evt *socketmode.Event) (channel, user, botID string) {
+	switch data := evt.Data.(type) {
+	case slackevents.EventsAPIEvent:
+		switch ev := data.InnerEvent.Data.(type) {
+		case *slackevents.AppMentionEvent:
+			return ev.Channel, ev.User, ev.BotID
+		case *slackevents.MessageEvent:
+			return ev.Channel, ev.User, ev.BotID
+		case *slackevents.ReactionAddedEvent:
+			return ev.Item.Channel, ev.User, ""
+		case *slackevents.AppHomeOpenedEvent:
+			return ev.Channel, ev.User, ""
+		}
+	case slack.InteractionCallback:
+		return data.Channel.ID, data.User.ID, ""
+	case slack.SlashCommand:
+		return data.ChannelID, data.UserID, ""
+	}
+	return "", "", ""
+}
@@ -0,0 +1,268 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/chikamif/slackgpt/src/metrics"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/slack-go/slack/socketmode"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// recording returns a middleware appending name to calls when it is called and when it returns
+func recording(calls *[]string, name string) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, api *slack.Client, evt *socketmode.Event) {
+			*calls = append(*calls, name)
+			next(ctx, api, evt)
+			*calls = append(*calls, "/"+name)
+		}
+	}
+}
+
+func TestChain(t *testing.T) {
+	var calls []string
+	h := Chain(func(context.Context, *slack.Client, *socketmode.Event) {
+		calls = append(calls, "handler")
+	}, recording(&calls, "outer"), recording(&calls, "inner"))
+	h(context.Background(), nil, &socketmode.Event{})
+	assert.Equal(t, []string{"outer", "inner", "handler", "/inner", "/outer"}, calls)
+}
+
+func TestPipeline(t *testing.T) {
+	var calls []string
+	status, m := NewHandlerStatus(), metrics.New()
+	b := newBot(EventHandlerArgs{
+		Logger:       logger,
+		IgnoredUsers: []string{"U0IGNORED"},
+		Status:       status,
+		Metrics:      m,
+		Middlewares:  []Middleware{recording(&calls, "custom")},
+	})
+	var handled []string
+	h := b.handler(func(_ context.Context, _ *slack.Client, evt *socketmode.Event) {
+		cmd := evt.Data.(slack.SlashCommand)
+		assert.Len(t, status.Snapshot().ActiveRequests, 1, "the event is recorded while it is handled")
+		if cmd.Text == "panic" {
+			panic("bad command")
+		}
+		handled = append(handled, cmd.UserID)
+	})
+	command := func(user, text string) *socketmode.Event {
+		return &socketmode.Event{Type: socketmode.EventTypeSlashCommand, Data: slack.SlashCommand{Command: "/gpt", UserID: user, Text: text}}
+	}
+
+	h(context.Background(), nil, command("U1", "what is go"))
+	h(context.Background(), nil, command("U0IGNORED", "what is go"))
+	assert.NotPanics(t, func() { h(context.Background(), nil, command("U2", "panic")) })
+	assert.Equal(t, []string{"U1"}, handled)
+	assert.Equal(t, []string{"custom", "/custom", "custom"}, calls, "the events of ignored users are dropped before the custom middlewares")
+	assert.Empty(t, status.Snapshot().ActiveRequests)
+	var scrape strings.Builder
+	_, err := m.Registry.WriteTo(&scrape)
+	require.NoError(t, err)
+	assert.Contains(t, scrape.String(), `slackgpt_errors_total{source="panic"} 1`)
+	assert.Contains(t, scrape.String(), `slackgpt_slack_event_duration_seconds_count{type="slash_commands"} 3`)
+}
+
+// countingModel counts the completions asked of the provider it wraps
+type countingModel struct {
+	chatgpt.ChatProvider
+	completions atomic.Int64
+}
+
+func (m *countingModel) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	m.completions.Add(1)
+	return m.ChatProvider.CreateChatCompletion(ctx, req)
+}
+
+func (m *countingModel) Unwrap() chatgpt.ChatProvider {
+	return m.ChatProvider
+}
+
+// TestCompletionPathsLimited asks for a completion down every path that answers a question, once the question it
+// follows up on is answered: none is asked for when the user is out of their rate limit or not allowed to ask.
+// Rate limits and access control are not stages of the pipeline, every path checks them itself.
+func TestCompletionPathsLimited(t *testing.T) {
+	responses := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	t.Cleanup(responses.Close)
+	mention := func(b *bot, api *slack.Client, ts, text string) {
+		b.answerMention(context.Background(), api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> " + text, Channel: "C1", TimeStamp: ts})
+	}
+	// answered mentions "what is go" in thread 1.000001 of C1 and returns its answer
+	answered := func(t *testing.T, b *bot, api *slack.Client, slackServer *fake.Slack) slack.Msg {
+		mention(b, api, "1.000001", "what is go")
+		messages := slackServer.Messages()
+		require.Len(t, messages, 1)
+		return slack.Msg{Text: messages[0].Text, Timestamp: messages[0].TS, ThreadTimestamp: "1.000001"}
+	}
+	tests := []struct {
+		name  string
+		args  EventHandlerArgs
+		model chatgpt.ChatProvider
+		// setup answers what the path follows up on and returns the event taking it
+		setup func(t *testing.T, b *bot, api *slack.Client, slackServer *fake.Slack) func(context.Context)
+	}{
+		{"mention", EventHandlerArgs{}, nil, func(t *testing.T, b *bot, api *slack.Client, _ *fake.Slack) func(context.Context) {
+			return func(context.Context) { mention(b, api, "1.000001", "what is go") }
+		}},
+		{"direct message", EventHandlerArgs{}, nil, func(t *testing.T, b *bot, api *slack.Client, _ *fake.Slack) func(context.Context) {
+			return func(ctx context.Context) {
+				b.handleMessage(ctx, api, &slackevents.MessageEvent{User: "U1", Text: "what is go", Channel: "D1", ChannelType: "im", TimeStamp: "1.000001"})
+			}
+		}},
+		{"private", EventHandlerArgs{}, nil, func(t *testing.T, b *bot, api *slack.Client, _ *fake.Slack) func(context.Context) {
+			return func(context.Context) { mention(b, api, "1.000001", "privately: what is go") }
+		}},
+		{"off the record", EventHandlerArgs{}, nil, func(t *testing.T, b *bot, api *slack.Client, _ *fake.Slack) func(context.Context) {
+			return func(context.Context) { mention(b, api, "1.000001", "off the record: what is go") }
+		}},
+		{"slash command", EventHandlerArgs{}, nil, func(t *testing.T, b *bot, api *slack.Client, _ *fake.Slack) func(context.Context) {
+			return func(ctx context.Context) {
+				b.handleSlashCommand(ctx, api, &slack.SlashCommand{Command: gptCommand, Text: "what is go", UserID: "U1", ChannelID: "C1", ResponseURL: responses.URL})
+			}
+		}},
+		{"composer", EventHandlerArgs{}, nil, func(t *testing.T, b *bot, api *slack.Client, slackServer *fake.Slack) func(context.Context) {
+			slackServer.AddMembers("C1", "U1")
+			return func(ctx context.Context) {
+				b.handleInteraction(ctx, api, composerCallback("U1", "what is go?", "", "", composerPublic, "C1"))
+			}
+		}},
+		{"regenerate", EventHandlerArgs{AnswerButtons: true}, nil, func(t *testing.T, b *bot, api *slack.Client, slackServer *fake.Slack) func(context.Context) {
+			answer := answered(t, b, api, slackServer)
+			return func(ctx context.Context) {
+				b.handleInteraction(ctx, api, answerCallback("U1", regenerateActionID, "U1", answer))
+			}
+		}},
+		{"continue", EventHandlerArgs{AnswerButtons: true}, nil, func(t *testing.T, b *bot, api *slack.Client, slackServer *fake.Slack) func(context.Context) {
+			answer := answered(t, b, api, slackServer)
+			return func(ctx context.Context) {
+				b.handleInteraction(ctx, api, answerCallback("U1", continueActionID, "U1", answer))
+			}
+		}},
+		{"branch", EventHandlerArgs{BranchVariants: []BranchVariant{{Name: "Pirate", SystemPrompt: "Answer like a pirate."}}}, nil,
+			func(t *testing.T, b *bot, api *slack.Client, slackServer *fake.Slack) func(context.Context) {
+				answer := answered(t, b, api, slackServer)
+				return func(ctx context.Context) { b.handleInteraction(ctx, api, branchCallback("C1", answer, "0|1.000001C1")) }
+			}},
+		{"clarify", EventHandlerArgs{Clarify: true}, clarifyingModel{}, func(t *testing.T, b *bot, api *slack.Client, slackServer *fake.Slack) func(context.Context) {
+			mention(b, api, "1.000001", "how far is the bank?")
+			messages := slackServer.Messages()
+			require.Len(t, messages, 1)
+			callback := &slack.InteractionCallback{Type: slack.InteractionTypeBlockActions}
+			callback.Channel.ID, callback.User.ID = "C1", "U1"
+			callback.Message.Msg = slack.Msg{Timestamp: messages[0].TS, ThreadTimestamp: messages[0].ThreadTS, Text: messages[0].Text}
+			callback.ActionCallback.BlockActions = []*slack.BlockAction{{ActionID: clarifyActionID + "_1", Value: "1.000001C1|The savings bank"}}
+			return func(ctx context.Context) { b.handleInteraction(ctx, api, callback) }
+		}},
+		{"unhelpful faq", EventHandlerArgs{AdminUsers: []string{"UADMIN"}}, nil, func(t *testing.T, b *bot, api *slack.Client, slackServer *fake.Slack) func(context.Context) {
+			b.answerMention(context.Background(), api, &slackevents.AppMentionEvent{User: "UADMIN", Text: "<@U0BOT> faq add How do I reset my VPN? | Click Reset.", Channel: "C1", TimeStamp: "1.000001"})
+			mention(b, api, "2.000001", "how do I reset my vpn")
+			messages := slackServer.Messages()
+			require.Len(t, messages, 2)
+			reply := slack.Msg{Timestamp: messages[1].TS, ThreadTimestamp: "2.000001", Text: messages[1].Text}
+			return func(ctx context.Context) {
+				b.handleInteraction(ctx, api, faqCallback("C1", reply, faqUnhelpfulActionID, "1|2.000001C1"))
+			}
+		}},
+		{"edit", EventHandlerArgs{OnQuestionEdit: EditReply}, nil, func(t *testing.T, b *bot, api *slack.Client, slackServer *fake.Slack) func(context.Context) {
+			b.handleMessage(context.Background(), api, &slackevents.MessageEvent{Type: string(slackevents.Message), User: "U1", Text: "wat is go", Channel: "D1", TimeStamp: "1.000001"})
+			require.Len(t, slackServer.Messages(), 1)
+			return func(ctx context.Context) {
+				b.handleMessage(ctx, api, editEvent("D1", "1.000001", "wat is go", "what is go"))
+			}
+		}},
+	}
+	limits := []struct {
+		name  string
+		limit func(b *bot, slackServer *fake.Slack)
+	}{
+		{"none", func(*bot, *fake.Slack) {}},
+		{"rate limited", func(b *bot, _ *fake.Slack) {
+			b.limits = &rateLimits{users: newTokenBuckets("users", 1, time.Hour, 0)}
+			b.limits.allow("U1", "", time.Now())
+		}},
+		{"not allowed", func(b *bot, slackServer *fake.Slack) {
+			slackServer.AddUserGroup("S0STAFF", "staff", "Staff", "U2")
+			b.access = newAccess(nil, "S0STAFF")
+		}},
+	}
+	for _, tt := range tests {
+		for _, l := range limits {
+			t.Run(tt.name+"/"+l.name, func(t *testing.T) {
+				b, api, slackServer := newFakeBot(t, tt.args)
+				if tt.model != nil {
+					b.gptClient = tt.model
+				}
+				model := &countingModel{ChatProvider: b.gptClient}
+				b.gptClient = model
+				take := tt.setup(t, b, api, slackServer)
+				l.limit(b, slackServer)
+				model.completions.Store(0)
+				take(context.Background())
+				if l.name == "none" {
+					assert.NotZero(t, model.completions.Load())
+					return
+				}
+				assert.Zero(t, model.completions.Load())
+			})
+		}
+	}
+}
+
+func TestAcknowledge(t *testing.T) {
+	slackServer := fake.NewSlack()
+	t.Cleanup(slackServer.Close)
+	gptServer := fake.NewOpenAI(0)
+	t.Cleanup(gptServer.Close)
+	var mu sync.Mutex
+	var acked []string
+	slackServer.OnAck(func(envelopeID string) {
+		mu.Lock()
+		defer mu.Unlock()
+		acked = append(acked, envelopeID)
+	})
+	gptConfig := openai.DefaultConfig("sk-test")
+	gptConfig.BaseURL = gptServer.URL()
+	slackClient := slack.New("xoxb-test", slack.OptionAppLevelToken("xapp-test"), slack.OptionAPIURL(slackServer.APIURL()))
+	ctx, cancel := context.WithCancel(context.Background())
+	args := EventHandlerArgs{
+		Logger:           logger,
+		SlackClient:      slackClient,
+		SocketModeClient: socketmode.New(slackClient),
+		GPTClient:        openai.NewClientWithConfig(gptConfig),
+		Context:          ctx,
+	}
+	handlerErr := make(chan error, 1)
+	go func() {
+		handlerErr <- EventHandler(args, args.NewSocketmodeHandler())
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-handlerErr
+	})
+
+	connectCtx, connectCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer connectCancel()
+	require.NoError(t, slackServer.WaitConnected(connectCtx))
+	envelopeID, err := slackServer.SendEvent(slackevents.AppMentionEvent{
+		Type: string(slackevents.AppMention), User: "U1", Text: "<@U0BOT> hello", Channel: "C1", TimeStamp: "1.000001",
+	})
+	require.NoError(t, err)
+	// the hello and connection events came before the mention, which is answered once it is acknowledged
+	require.Eventually(t, func() bool { return len(slackServer.Messages()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{envelopeID}, acked, "only envelopes are acknowledged")
+}
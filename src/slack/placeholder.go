@@ -0,0 +1,49 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/slack-go/slack"
+)
+
+// DefaultThinkingMessage is the placeholder posted while a question is answered
+const DefaultThinkingMessage = ":hourglass_flowing_sand: thinking…"
+
+// postThinking posts the placeholder acknowledging a question about to be answered in the thread of threadTS,
+// the channel itself when empty. It returns the placeholder's timestamp, empty when none was posted.
+func (b *bot) postThinking(ctx context.Context, api *slack.Client, channel, threadTS string) string {
+	if b.thinkingMessage == "" {
+		return ""
+	}
+	options := []slack.MsgOption{slack.MsgOptionText(b.thinkingMessage, false)}
+	if threadTS != "" {
+		options = append(options, slack.MsgOptionTS(threadTS))
+	}
+	_, ts, err := api.PostMessageContext(ctx, channel, options...)
+	if err != nil {
+		b.logger.Printf("failed posting placeholder in %v: %v\n", channel, err)
+		return ""
+	}
+	return ts
+}
+
+// postAnswer replaces the placeholder at placeholderTS with the answer of options, posting it in the thread of
+// threadTS instead when there is no placeholder or it cannot be replaced. It returns the answer's timestamp.
+// Answers are posted even once the work context ctx is done, so those finished while draining are not lost.
+func (b *bot) postAnswer(ctx context.Context, api *slack.Client, channel, threadTS, placeholderTS string, options []slack.MsgOption) (string, error) {
+	ctx = context.WithoutCancel(ctx)
+	if placeholderTS != "" {
+		_, _, _, err := api.UpdateMessageContext(ctx, channel, placeholderTS, options...)
+		if err == nil {
+			return placeholderTS, nil
+		}
+		b.logger.Printf("failed replacing placeholder in %v, posting the answer instead: %v\n", channel, err)
+		if _, _, err := api.DeleteMessageContext(ctx, channel, placeholderTS); err != nil {
+			b.logger.Printf("failed deleting placeholder in %v: %v\n", channel, err)
+		}
+	}
+	if threadTS != "" {
+		options = append(options[:len(options):len(options)], slack.MsgOptionTS(threadTS))
+	}
+	_, ts, err := api.PostMessageContext(ctx, channel, options...)
+	return ts, err
+}
@@ -0,0 +1,36 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestThinkingPlaceholder(t *testing.T) {
+	ctx := context.Background()
+	slackServer := fake.NewSlack()
+	t.Cleanup(slackServer.Close)
+	api := slack.New("xoxb-test", slack.OptionAPIURL(slackServer.APIURL()))
+	var posted []string
+	slackServer.OnPost(func(msg fake.Message) { posted = append(posted, msg.Text) })
+	b := newBot(EventHandlerArgs{Logger: logger, GPTClient: &paramsModel{}, ThinkingMessage: DefaultThinkingMessage})
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: "C1", TimeStamp: "1.000001"})
+	b.answerMessage(ctx, api, &slackevents.MessageEvent{User: "U1", Text: "what is go", Channel: "D1", ChannelType: "im", TimeStamp: "2.000001"})
+	assert.Equal(t, []string{DefaultThinkingMessage, DefaultThinkingMessage}, posted, "the placeholders are posted first")
+	messages := slackServer.Messages()
+	require.Len(t, messages, 2, "the placeholders are replaced by the answers")
+	assert.Equal(t, "C1", messages[0].Channel)
+	assert.Equal(t, "1.000001", messages[0].ThreadTS)
+	assert.Contains(t, messages[0].Text, "go is a language")
+	assert.Equal(t, "D1", messages[1].Channel)
+	assert.Contains(t, messages[1].Text, "go is a language")
+
+	rep, ok := b.replies.Get("C1", "1.000001")
+	require.True(t, ok)
+	assert.Equal(t, messages[0].TS, rep.ReplyTS, "edits update the answer in the placeholder")
+}
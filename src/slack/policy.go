@@ -0,0 +1,172 @@
+package slackhandler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/slack-go/slack"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// policyReviewActionID identifies the button that opens the usage policy modal
+	policyReviewActionID = "slackgpt_policy_review"
+	// policyCallbackID identifies submissions of the usage policy modal
+	policyCallbackID = "slackgpt_policy"
+	// policyNoticeText is sent to users who have to acknowledge the usage policy before being answered
+	policyNoticeText = "Please review and acknowledge the usage policy before asking questions."
+	// maxSectionText is the most text slack accepts in a single section block
+	maxSectionText = 3000
+)
+
+// PolicyAck is a user's acknowledgement of a version of the usage policy
+type PolicyAck struct {
+	Version string    `json:"version"`
+	At      time.Time `json:"at"`
+}
+
+// PolicyStore records which version of the usage policy each user acknowledged and when. With a path the
+// acknowledgements are kept in a JSON file so they survive restarts.
+type PolicyStore struct {
+	mu   sync.Mutex
+	path string
+	acks map[string]PolicyAck
+}
+
+// NewPolicyStore creates a policy store backed by the JSON file at path, which is created on the first
+// acknowledgement if it does not exist. An empty path keeps acknowledgements in memory only.
+func NewPolicyStore(path string) (*PolicyStore, error) {
+	p := &PolicyStore{path: path, acks: map[string]PolicyAck{}}
+	if path == "" {
+		return p, nil
+	}
+	if err := loadJSON(path, &p.acks); err != nil {
+		return nil, fmt.Errorf("reading policy acknowledgements: %w", err)
+	}
+	return p, nil
+}
+
+// Get returns the latest acknowledgement of userID
+func (p *PolicyStore) Get(userID string) (PolicyAck, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ack, ok := p.acks[userID]
+	return ack, ok
+}
+
+// Record stores that userID acknowledged version at the given time, the acknowledgement is kept in memory
+// even when saving fails
+func (p *PolicyStore) Record(userID, version string, at time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.acks[userID] = PolicyAck{Version: version, At: at.UTC()}
+	if p.path == "" {
+		return nil
+	}
+	if err := saveJSON(p.path, p.acks); err != nil {
+		return fmt.Errorf("saving policy acknowledgements: %w", err)
+	}
+	return nil
+}
+
+// usagePolicy is the policy users have to acknowledge, again after every change of its text and once
+// their acknowledgement is older than interval
+type usagePolicy struct {
+	text     string
+	version  string
+	interval time.Duration
+	acks     *PolicyStore
+}
+
+// newUsagePolicy creates a usage policy for text, its version is derived from the text
+func newUsagePolicy(text string, interval time.Duration, acks *PolicyStore) *usagePolicy {
+	sum := sha256.Sum256([]byte(text))
+	return &usagePolicy{text: text, version: hex.EncodeToString(sum[:8]), interval: interval, acks: acks}
+}
+
+// acknowledged reports whether userID acknowledged the current policy within the interval
+func (p *usagePolicy) acknowledged(userID string, now time.Time) bool {
+	ack, ok := p.acks.Get(userID)
+	if !ok || ack.Version != p.version {
+		return false
+	}
+	return p.interval <= 0 || now.Sub(ack.At) < p.interval
+}
+
+// modal is the view showing the policy, its private metadata carries the version being acknowledged
+func (p *usagePolicy) modal() slack.ModalViewRequest {
+	var blocks []slack.Block
+	for _, chunk := range splitText(p.text, maxSectionText) {
+		blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, chunk, false, false), nil, nil))
+	}
+	return slack.ModalViewRequest{
+		Type:            slack.VTModal,
+		CallbackID:      policyCallbackID,
+		PrivateMetadata: p.version,
+		Title:           slack.NewTextBlockObject(slack.PlainTextType, "Usage policy", false, false),
+		Submit:          slack.NewTextBlockObject(slack.PlainTextType, "I acknowledge", false, false),
+		Close:           slack.NewTextBlockObject(slack.PlainTextType, "Cancel", false, false),
+		Blocks:          slack.Blocks{BlockSet: blocks},
+	}
+}
+
+// splitText splits text into chunks of at most max bytes without breaking up a character
+func splitText(text string, max int) []string {
+	var chunks []string
+	for len(text) > max {
+		cut := max
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		chunks = append(chunks, text[:cut])
+		text = text[cut:]
+	}
+	return append(chunks, text)
+}
+
+// policyAcknowledged reports whether user may be answered, sending them a button to review the usage policy
+// in channel when they have not acknowledged it. Bots are never asked.
+func (b *bot) policyAcknowledged(ctx context.Context, api *slack.Client, channel, threadTS, user, botID string) bool {
+	if b.policy == nil || botID != "" || b.policy.acknowledged(user, time.Now()) {
+		return true
+	}
+	review := slack.NewButtonBlockElement(policyReviewActionID, "review", slack.NewTextBlockObject(slack.PlainTextType, "Review policy", false, false))
+	review.Style = slack.StylePrimary
+	options := []slack.MsgOption{
+		slack.MsgOptionText(policyNoticeText, false),
+		slack.MsgOptionBlocks(
+			slack.NewSectionBlock(slack.NewTextBlockObject(slack.PlainTextType, policyNoticeText, false, false), nil, nil),
+			slack.NewActionBlock("slackgpt_policy_notice", review),
+		),
+	}
+	if threadTS != "" {
+		options = append(options, slack.MsgOptionTS(threadTS))
+	}
+	if _, err := api.PostEphemeralContext(ctx, channel, user, options...); err != nil {
+		b.logger.Printf("failed sending policy notice to %v: %v\n", user, err)
+	}
+	return false
+}
+
+// openPolicyModal shows the usage policy to the user who clicked the review button
+func (b *bot) openPolicyModal(ctx context.Context, api *slack.Client, callback *slack.InteractionCallback) {
+	if b.policy == nil {
+		return
+	}
+	if _, err := api.OpenViewContext(ctx, callback.TriggerID, b.policy.modal()); err != nil {
+		b.logger.Printf("failed opening policy modal: %v\n", err)
+	}
+}
+
+// recordPolicyAck stores the acknowledgement submitted through the policy modal
+func (b *bot) recordPolicyAck(callback *slack.InteractionCallback) {
+	if b.policy == nil {
+		return
+	}
+	if err := b.policy.acks.Record(callback.User.ID, callback.View.PrivateMetadata, time.Now()); err != nil {
+		b.logger.Printf("failed recording policy acknowledgement of %v: %v\n", callback.User.ID, err)
+	}
+}
@@ -0,0 +1,83 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUsagePolicy_Acknowledged(t *testing.T) {
+	now := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	acks, _ := NewPolicyStore("")
+	policy := newUsagePolicy("be nice", 24*time.Hour, acks)
+	assert.False(t, policy.acknowledged("U1", now))
+
+	require.NoError(t, acks.Record("U1", policy.version, now.Add(-time.Hour)))
+	assert.True(t, policy.acknowledged("U1", now))
+	// acknowledgements expire after the interval
+	assert.False(t, policy.acknowledged("U1", now.Add(24*time.Hour)))
+	// and whenever the policy changes
+	assert.False(t, newUsagePolicy("be very nice", 24*time.Hour, acks).acknowledged("U1", now))
+	// unless they never expire
+	assert.True(t, newUsagePolicy("be nice", 0, acks).acknowledged("U1", now.Add(1000*time.Hour)))
+}
+
+func TestPolicyStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "acks.json")
+	acks, err := NewPolicyStore(path)
+	require.NoError(t, err)
+	at := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, acks.Record("U1", "v1", at))
+
+	reloaded, err := NewPolicyStore(path)
+	require.NoError(t, err)
+	ack, ok := reloaded.Get("U1")
+	assert.True(t, ok)
+	assert.Equal(t, PolicyAck{Version: "v1", At: at}, ack)
+}
+
+func TestSplitText(t *testing.T) {
+	assert.Equal(t, []string{"abc"}, splitText("abc", 3))
+	assert.Equal(t, []string{"abc", "de"}, splitText("abcde", 3))
+	// multi-byte characters are never split
+	assert.Equal(t, []string{"a", "é", "é"}, splitText("aéé", 2))
+	long := strings.Repeat("x", 2*maxSectionText+1)
+	assert.Len(t, newUsagePolicy(long, 0, nil).modal().Blocks.BlockSet, 3)
+}
+
+func TestPolicyGate(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{UsagePolicy: "be nice", PolicyAckInterval: time.Hour})
+	ctx := context.Background()
+	question := &slackevents.MessageEvent{
+		Type: string(slackevents.Message), User: "U1", Text: "what is go", Channel: "D1", TimeStamp: "1.000001",
+	}
+
+	b.handleMessage(ctx, api, question)
+	assert.Empty(t, slackServer.Messages())
+	notices := slackServer.Ephemerals()
+	require.Len(t, notices, 1)
+	assert.Contains(t, notices[0].Blocks, policyReviewActionID)
+
+	review := &slack.InteractionCallback{Type: slack.InteractionTypeBlockActions, User: slack.User{ID: "U1"}, TriggerID: "trigger-1"}
+	review.ActionCallback.BlockActions = []*slack.BlockAction{{ActionID: policyReviewActionID}}
+	b.handleInteraction(ctx, api, review)
+	views := slackServer.Views()
+	require.Len(t, views, 1)
+	assert.Equal(t, "trigger-1", views[0].TriggerID)
+	assert.Contains(t, views[0].View, "be nice")
+
+	submission := &slack.InteractionCallback{Type: slack.InteractionTypeViewSubmission, User: slack.User{ID: "U1"}}
+	submission.View.CallbackID = policyCallbackID
+	submission.View.PrivateMetadata = b.policy.version
+	b.handleInteraction(ctx, api, submission)
+
+	b.handleMessage(ctx, api, question)
+	assert.Len(t, slackServer.Messages(), 1)
+	assert.Len(t, slackServer.Ephemerals(), 1)
+}
@@ -0,0 +1,57 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"regexp"
+)
+
+// privateNote is posted above private answers
+const privateNote = "_Only you can see this answer._"
+
+// privatePattern matches the modifier asking for a private answer, "privately:", after the mentions starting a question
+var privatePattern = regexp.MustCompile(`(?i)^((?:\s*<@[^<>]*>)*)\s*privately\s*:\s*`)
+
+// privateQuestion removes the private modifier from text, reporting whether it asked for a private answer
+func privateQuestion(text string) (string, bool) {
+	if !privatePattern.MatchString(text) {
+		return text, false
+	}
+	return privatePattern.ReplaceAllString(text, "$1 "), true
+}
+
+// privateKey is the conversation of the private questions user asked in the thread of threadTS, kept apart from
+// the thread's so no one else's questions continue it
+func privateKey(channel, threadTS, user string) string {
+	return ConversationKey(channel, threadTS) + "/" + user
+}
+
+// answerPrivately answers a question user asked privately in the thread of threadTS with an ephemeral message only
+// they see, continuing the conversation of their earlier private questions in the thread. The exchange is only
+// stored in that conversation.
+func (b *bot) answerPrivately(ctx context.Context, api *slack.Client, channel, threadTS, user, question string, opts []chatgpt.Option) {
+	key := privateKey(channel, threadTS, user)
+	b.convo.UpdateConversation(key, question)
+	history, _ := b.convo.Get(key)
+	resp, err := b.completeIn(ctx, api, key, channel, user, turns(history, openai.ChatMessageRoleUser), opts...)
+	if err != nil {
+		b.logger.Printf("Failed to get gpt3 response for private question: %v\n", err)
+		resp = completion{answer: troubleAnswer(err)}
+	} else {
+		b.convo.UpdateConversation(key, resp.stored())
+	}
+	if resp.note != "" {
+		resp.note = privateNote + "\n" + resp.note
+	} else {
+		resp.note = privateNote
+	}
+	for _, part := range resp.split(maxAnswerText) {
+		options := append(answerOptions(part), slack.MsgOptionTS(threadTS))
+		if _, err := api.PostEphemeralContext(ctx, channel, user, options...); err != nil {
+			b.logger.Printf("failed sending private answer to %v: %v\n", user, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestPrivateQuestion(t *testing.T) {
+	tests := []struct {
+		text        string
+		want        string
+		wantPrivate bool
+	}{
+		{"<@U0BOT> privately: what is go", "<@U0BOT> what is go", true},
+		{"<@U0BOT>   Privately : what is go", "<@U0BOT> what is go", true},
+		{"privately: what is go", " what is go", true},
+		{"<@U0BOT> what is go privately: asked", "<@U0BOT> what is go privately: asked", false},
+		{"<@U0BOT> privately what is go", "<@U0BOT> privately what is go", false},
+	}
+	for _, tt := range tests {
+		text, private := privateQuestion(tt.text)
+		assert.Equal(t, tt.want, text, tt.text)
+		assert.Equal(t, tt.wantPrivate, private, tt.text)
+	}
+}
+
+func TestAnswerPrivately(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{})
+	ctx := context.Background()
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> privately: what is go", Channel: "C1", TimeStamp: "1.000001"})
+	assert.Empty(t, slackServer.Messages(), "nothing is posted for everyone")
+	ephemerals := slackServer.Ephemerals()
+	require.Len(t, ephemerals, 1)
+	assert.Equal(t, "U1", ephemerals[0].User)
+	assert.Equal(t, "1.000001", ephemerals[0].ThreadTS)
+	assert.Equal(t, privateNote+"\n"+formatResponse("fake answer to: what is go"), ephemerals[0].Text)
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U2", Text: "<@U0BOT> what is rust", Channel: "C1", TimeStamp: "2.000001", ThreadTimeStamp: "1.000001"})
+	history, _ := b.convo.Get(ConversationKey("C1", "1.000001"))
+	assert.Equal(t, []string{"what is rust", "fake answer to: what is rust"}, history, "the thread doesn't know of the private exchange")
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> privately: and rust?", Channel: "C1", TimeStamp: "3.000001", ThreadTimeStamp: "1.000001"})
+	history, _ = b.convo.Get(privateKey("C1", "1.000001", "U1"))
+	assert.Equal(t, []string{"what is go", "fake answer to: what is go", "and rust?", "fake answer to: and rust?"}, history,
+		"private questions continue the user's own conversation")
+	assert.Len(t, slackServer.Ephemerals(), 2)
+	assert.Len(t, slackServer.Messages(), 1)
+}
@@ -0,0 +1,54 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// EventProcessor answers Events API events delivered outside of socket mode, e.g. through a queue.
+// It keeps its own conversation store, so history only spans the events one processor has seen.
+type EventProcessor struct {
+	workspaces *workspaces
+	bot        *bot
+}
+
+// NewEventProcessor creates an EventProcessor, SocketModeClient and Context in args are unused. Events from
+// the workspaces in args.Installations are answered with their own token.
+func NewEventProcessor(args EventHandlerArgs) *EventProcessor {
+	return &EventProcessor{workspaces: newWorkspaces(args.SlackClient, args.Installations, args.NewSlackClient), bot: newBot(args)}
+}
+
+// Process answers app mentions, messages and trigger reactions from users, publishes App Home tabs and runs
+// workflow steps the same way EventHandler does, and forgets the installations of workspaces the app was
+// uninstalled from. Other events are ignored.
+func (p *EventProcessor) Process(ctx context.Context, event slackevents.EventsAPIEvent) {
+	api := p.workspaces.client(event.TeamID)
+	switch ev := event.InnerEvent.Data.(type) {
+	case *slackevents.AppMentionEvent:
+		p.bot.answerMention(ctx, api, ev)
+	case *slackevents.MessageEvent:
+		p.bot.handleMessage(ctx, api, ev)
+	case *slackevents.ReactionAddedEvent:
+		p.bot.answerReaction(ctx, api, ev)
+	case *slackevents.AppHomeOpenedEvent:
+		p.bot.appHomeOpened(ctx, api, ev)
+	case *slackevents.WorkflowStepExecuteEvent:
+		p.bot.runWorkflowStep(ctx, api, ev)
+	case *slackevents.AppUninstalledEvent:
+		p.uninstalled(event.TeamID)
+	case *slackevents.TokensRevokedEvent:
+		// revoked user tokens leave the bot's token working
+		if len(ev.Tokens.Bot) > 0 {
+			p.uninstalled(event.TeamID)
+		}
+	default:
+		p.bot.logger.Printf("Ignored %+v\n", event.InnerEvent)
+	}
+}
+
+// uninstalled forgets the installation in the workspace teamID
+func (p *EventProcessor) uninstalled(teamID string) {
+	if err := p.workspaces.uninstalled(teamID); err != nil {
+		p.bot.logger.Printf("failed forgetting the installation in %v: %v\n", teamID, err)
+	}
+}
@@ -0,0 +1,250 @@
+package slackhandler
+
+import (
+	"context"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/slack-go/slack"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultPromptScope is the scope of the system prompt used in channels without their own
+const defaultPromptScope = ""
+
+// configAuthor is the author of prompt versions read from the config
+const configAuthor = "config"
+
+// PromptVersion is one version of a system prompt
+type PromptVersion struct {
+	Version int
+	// Prompt is empty when a channel has no prompt of its own
+	Prompt string
+	// Author is the ID of the user who set the prompt, or "config"
+	Author string
+	At     time.Time
+	// RollbackOf is the version this version restored, 0 when it was not a rollback
+	RollbackOf int `json:",omitempty"`
+}
+
+// PromptStore keeps every version of the default system prompt and of the channel system prompts. With a path
+// the versions are kept in a JSON file so they survive restarts.
+type PromptStore struct {
+	mu   sync.Mutex
+	path string
+	// versions by channel ID, defaultPromptScope for the default system prompt, oldest first
+	versions map[string][]PromptVersion
+}
+
+// NewPromptStore creates a prompt store backed by the JSON file at path, which is created on the first change
+// if it does not exist. An empty path keeps versions in memory only.
+func NewPromptStore(path string) (*PromptStore, error) {
+	s := &PromptStore{path: path, versions: map[string][]PromptVersion{}}
+	if path == "" {
+		return s, nil
+	}
+	if err := loadJSON(path, &s.versions); err != nil {
+		return nil, fmt.Errorf("reading prompt versions: %w", err)
+	}
+	return s, nil
+}
+
+// Current returns the version of the prompt for scope in use
+func (s *PromptStore) Current(scope string) (PromptVersion, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	versions := s.versions[scope]
+	if len(versions) == 0 {
+		return PromptVersion{}, false
+	}
+	return versions[len(versions)-1], true
+}
+
+// History returns every version of the prompt for scope, oldest first
+func (s *PromptStore) History(scope string) []PromptVersion {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]PromptVersion(nil), s.versions[scope]...)
+}
+
+// Set makes prompt the current prompt for scope as a new version by author, unless it already is. The version
+// is kept in memory even when saving fails.
+func (s *PromptStore) Set(scope, prompt, author string, at time.Time) (PromptVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.set(scope, PromptVersion{Prompt: prompt, Author: author, At: at.UTC()})
+}
+
+// Rollback makes the prompt of version the current prompt for scope as a new version by author
+func (s *PromptStore) Rollback(scope string, version int, author string, at time.Time) (PromptVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	versions := s.versions[scope]
+	if version < 1 || version > len(versions) {
+		return PromptVersion{}, fmt.Errorf("there is no version %d", version)
+	}
+	return s.set(scope, PromptVersion{Prompt: versions[version-1].Prompt, Author: author, At: at.UTC(), RollbackOf: version})
+}
+
+// Configure records the prompts read from the config, by scope, as new versions where they changed since the
+// config was last read, so changes made at runtime survive restarts with an unchanged config. Scopes the
+// config no longer sets get an empty version.
+func (s *PromptStore) Configure(prompts map[string]string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	scopes := make(map[string]bool, len(prompts)+len(s.versions))
+	for scope := range prompts {
+		scopes[scope] = true
+	}
+	for scope := range s.versions {
+		scopes[scope] = true
+	}
+	var err error
+	for scope := range scopes {
+		var configured PromptVersion
+		versions := s.versions[scope]
+		for i := len(versions) - 1; i >= 0; i-- {
+			if versions[i].Author == configAuthor {
+				configured = versions[i]
+				break
+			}
+		}
+		if prompts[scope] == configured.Prompt {
+			continue
+		}
+		if _, setErr := s.set(scope, PromptVersion{Prompt: prompts[scope], Author: configAuthor, At: at.UTC()}); setErr != nil {
+			err = setErr
+		}
+	}
+	return err
+}
+
+// set appends v to the versions of scope unless its prompt is already current, the caller must hold s.mu
+func (s *PromptStore) set(scope string, v PromptVersion) (PromptVersion, error) {
+	versions := s.versions[scope]
+	if len(versions) > 0 && versions[len(versions)-1].Prompt == v.Prompt {
+		return versions[len(versions)-1], nil
+	}
+	v.Version = len(versions) + 1
+	s.versions[scope] = append(versions, v)
+	if s.path == "" {
+		return v, nil
+	}
+	if err := saveJSON(s.path, s.versions); err != nil {
+		return v, fmt.Errorf("saving prompt versions: %w", err)
+	}
+	return v, nil
+}
+
+// systemPrompt returns the system prompt that sets the bot's persona in channel
+func (b *bot) systemPrompt(channel string) string {
+	if v, ok := b.prompts.Current(channel); ok && v.Prompt != "" {
+		return v.Prompt
+	}
+	if v, ok := b.prompts.Current(defaultPromptScope); ok && v.Prompt != "" {
+		return v.Prompt
+	}
+	return chatgpt.DefaultSystemPrompt
+}
+
+// promptCommandPattern matches the admin prompt commands, with an optional channel reference
+var promptCommandPattern = regexp.MustCompile(`(?s)^(?:<@[A-Z0-9]+>\s*)?prompt\s+(history|set|rollback)(?:\s+<#([A-Z0-9]+)(?:\|[^>]*)?>)?\s*(.*)$`)
+
+// promptCommand handles the prompt commands of admins, reporting whether text was one:
+//
+//	prompt history [#channel]             lists the versions of the prompt
+//	prompt set [#channel] <prompt>        sets a new version
+//	prompt rollback [#channel] <version>  restores an earlier version
+//
+// Without a channel the commands apply to the default system prompt.
+func (b *bot) promptCommand(ctx context.Context, api *slack.Client, channel, threadTS, user, text string) bool {
+	if !b.admins[user] {
+		return false
+	}
+	match := promptCommandPattern.FindStringSubmatch(strings.TrimSpace(text))
+	if match == nil {
+		return false
+	}
+	command, scope, arg := match[1], match[2], strings.TrimSpace(match[3])
+	var reply string
+	switch command {
+	case "history":
+		reply = promptHistory(scope, b.prompts.History(scope))
+	case "set":
+		if arg == "" {
+			reply = "Usage: prompt set [#channel] <prompt>"
+			break
+		}
+		v, err := b.prompts.Set(scope, entityUnescaper.Replace(arg), user, time.Now())
+		reply = fmt.Sprintf("The %s is now version %d.", promptName(scope), v.Version)
+		if err != nil {
+			b.logger.Printf("failed saving prompt: %v\n", err)
+			reply += " It could not be saved and will be lost on restart."
+		}
+	case "rollback":
+		version, err := strconv.Atoi(strings.TrimPrefix(arg, "v"))
+		if err != nil {
+			reply = "Usage: prompt rollback [#channel] <version>"
+			break
+		}
+		v, err := b.prompts.Rollback(scope, version, user, time.Now())
+		switch {
+		case v.Version == 0:
+			reply = fmt.Sprintf("The %s has no version %d.", promptName(scope), version)
+		case err != nil:
+			b.logger.Printf("failed saving prompt: %v\n", err)
+			reply = fmt.Sprintf("Rolled the %s back to version %d as version %d. It could not be saved and will be lost on restart.", promptName(scope), version, v.Version)
+		default:
+			reply = fmt.Sprintf("Rolled the %s back to version %d as version %d.", promptName(scope), version, v.Version)
+		}
+	}
+	b.logger.Printf("%v ran prompt %v for %q\n", user, command, scope)
+	if _, _, err := api.PostMessageContext(ctx, channel, slack.MsgOptionText(reply, false), slack.MsgOptionTS(threadTS)); err != nil {
+		b.logger.Printf("failed answering prompt command: %v\n", err)
+	}
+	return true
+}
+
+// promptName describes the prompt of scope
+func promptName(scope string) string {
+	if scope == defaultPromptScope {
+		return "default system prompt"
+	}
+	return fmt.Sprintf("system prompt of <#%s>", scope)
+}
+
+// promptHistory lists versions, newest first
+func promptHistory(scope string, versions []PromptVersion) string {
+	if len(versions) == 0 {
+		return fmt.Sprintf("The %s has no versions.", promptName(scope))
+	}
+	sort.SliceStable(versions, func(i, j int) bool { return versions[i].Version > versions[j].Version })
+	var b strings.Builder
+	fmt.Fprintf(&b, "Versions of the %s:", promptName(scope))
+	for i, v := range versions {
+		author := v.Author
+		if author != configAuthor {
+			author = "<@" + author + ">"
+		}
+		fmt.Fprintf(&b, "\n*v%d* by %s on %s", v.Version, author, v.At.Format("2006-01-02 15:04 MST"))
+		if v.RollbackOf != 0 {
+			fmt.Fprintf(&b, ", rollback to v%d", v.RollbackOf)
+		}
+		if i == 0 {
+			b.WriteString(" (current)")
+		}
+		prompt := v.Prompt
+		if prompt == "" {
+			prompt = "(none)"
+		}
+		if runes := []rune(prompt); len(runes) > 200 {
+			prompt = string(runes[:200]) + "…"
+		}
+		b.WriteString("\n> " + strings.ReplaceAll(slackEscaper.Replace(prompt), "\n", "\n> "))
+	}
+	return b.String()
+}
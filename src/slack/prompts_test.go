@@ -0,0 +1,71 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPromptStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prompts.json")
+	store, err := NewPromptStore(path)
+	require.NoError(t, err)
+	now := time.Now()
+	require.NoError(t, store.Configure(map[string]string{"": "answer in French", "C1": "answer like a pirate"}, now))
+	v, err := store.Set("", "answer in German", "U1", now)
+	require.NoError(t, err)
+	assert.Equal(t, 2, v.Version)
+	again, err := store.Set("", "answer in German", "U1", now)
+	require.NoError(t, err)
+	assert.Equal(t, v, again, "setting the current prompt adds no version")
+
+	v, err = store.Rollback("", 1, "U2", now)
+	require.NoError(t, err)
+	assert.Equal(t, PromptVersion{Version: 3, Prompt: "answer in French", Author: "U2", At: now.UTC(), RollbackOf: 1}, v)
+	_, err = store.Rollback("", 9, "U2", now)
+	assert.EqualError(t, err, "there is no version 9")
+
+	// an unchanged config keeps runtime changes across restarts, a changed one is recorded
+	store, err = NewPromptStore(path)
+	require.NoError(t, err)
+	assert.Len(t, store.History(""), 3)
+	require.NoError(t, store.Configure(map[string]string{"": "answer in French", "C1": "answer like a pirate"}, now))
+	current, _ := store.Current("")
+	assert.Equal(t, 3, current.Version)
+	require.NoError(t, store.Configure(map[string]string{"": "answer in Spanish"}, now))
+	current, _ = store.Current("")
+	assert.Equal(t, PromptVersion{Version: 4, Prompt: "answer in Spanish", Author: configAuthor, At: now.UTC()}, current)
+	current, _ = store.Current("C1")
+	assert.Equal(t, "", current.Prompt, "channels removed from the config lose their prompt")
+}
+
+func TestPromptCommand(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{SystemPrompt: "answer in French", AdminUsers: []string{"UADMIN"}})
+	ctx := context.Background()
+	mention := func(user, text string) string {
+		b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: user, Text: text, Channel: "C1", TimeStamp: "1.000001"})
+		messages := slackServer.Messages()
+		return messages[len(messages)-1].Text
+	}
+
+	assert.Equal(t, "The system prompt of <#C1> is now version 1.", mention("UADMIN", "<@U0BOT> prompt set <#C1|general> answer like a pirate &amp; be brief"))
+	assert.Equal(t, "answer like a pirate & be brief", b.systemPrompt("C1"))
+	assert.Equal(t, "The default system prompt is now version 2.", mention("UADMIN", "<@U0BOT> prompt set answer in German"))
+	assert.Equal(t, "answer in German", b.systemPrompt("D1"))
+	assert.Equal(t, "Rolled the default system prompt back to version 1 as version 3.", mention("UADMIN", "<@U0BOT> prompt rollback v1"))
+	assert.Equal(t, "answer in French", b.systemPrompt("D1"))
+	assert.Equal(t, "The default system prompt has no version 7.", mention("UADMIN", "<@U0BOT> prompt rollback 7"))
+
+	history := mention("UADMIN", "<@U0BOT> prompt history")
+	assert.Contains(t, history, "*v3* by <@UADMIN>")
+	assert.Contains(t, history, ", rollback to v1 (current)\n> answer in French")
+	assert.Contains(t, history, "*v1* by config")
+
+	// anyone else is answered as usual
+	assert.Contains(t, mention("U1", "<@U0BOT> prompt set answer in Klingon"), "fake answer to")
+	assert.Equal(t, "answer in French", b.systemPrompt("D1"))
+}
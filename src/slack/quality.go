@@ -0,0 +1,85 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/chikamif/slackgpt/src/metrics"
+	"github.com/sashabaranov/go-openai"
+	"math/rand"
+	"time"
+)
+
+const (
+	// maxQualitySamples bounds the sampled answers waiting for the judge, more are not sampled
+	maxQualitySamples = 100
+	// judgeTimeout bounds how long the judge may take to score an answer
+	judgeTimeout = 30 * time.Second
+)
+
+// qualitySampling has a judge model score a share of the answers on accuracy, tone and policy compliance, in
+// the background, recording the scores in metrics so that regressions after prompt or model changes show
+type qualitySampling struct {
+	rate    float64
+	model   string
+	metrics *metrics.Metrics
+	samples chan qualitySample
+	random  func() float64
+}
+
+// qualitySample is an answer by model to history, given the instructions of its system prompt
+type qualitySample struct {
+	instructions string
+	history      []openai.ChatCompletionMessage
+	answer       string
+	model        string
+}
+
+func newQualitySampling(rate float64, model string, m *metrics.Metrics) *qualitySampling {
+	return &qualitySampling{rate: rate, model: model, metrics: m, samples: make(chan qualitySample, maxQualitySamples), random: rand.Float64}
+}
+
+// sampleQuality queues the answer by model to history for the judge, rate of the time. Answers in channels
+// nothing is kept of are not sent to the judge.
+func (b *bot) sampleQuality(channel, instructions string, history []openai.ChatCompletionMessage, answer, model string) {
+	q := b.quality
+	if q == nil || answer == "" || b.noRetention[channel] || q.random() >= q.rate {
+		return
+	}
+	select {
+	case q.samples <- qualitySample{instructions: instructions, history: history, answer: answer, model: model}:
+	default:
+		b.logger.Printf("answer in %v not sampled, the judge is behind\n", channel)
+	}
+}
+
+// runQualitySampling scores the sampled answers until ctx is done
+func (b *bot) runQualitySampling(ctx context.Context) {
+	if b.quality == nil {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case s := <-b.quality.samples:
+			b.judge(ctx, s)
+		}
+	}
+}
+
+// judge has the judge model score s and records its scores
+func (b *bot) judge(ctx context.Context, s qualitySample) {
+	ctx, cancel := context.WithTimeout(ctx, judgeTimeout)
+	defer cancel()
+	var opts []chatgpt.Option
+	if b.quality.model != "" {
+		opts = append(opts, chatgpt.WithModel(b.quality.model))
+	}
+	j, err := chatgpt.GetJudgement(b.gptClient, ctx, s.instructions, s.history, s.answer, opts...)
+	b.quality.metrics.ObserveQuality(s.model, j.Scores(), err)
+	if err != nil {
+		b.logger.Printf("failed judging an answer by %s: %v\n", s.model, err)
+		return
+	}
+	b.logger.Printf("answer by %s scored %d for accuracy, %d for tone and %d for policy\n", s.model, j.Accuracy, j.Tone, j.Policy)
+}
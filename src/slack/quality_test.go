@@ -0,0 +1,85 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/chikamif/slackgpt/src/metrics"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// judgedModel answers questions and scores answers when asked by the judge model, counting the answers scored
+type judgedModel struct {
+	mu     sync.Mutex
+	judged int
+}
+
+func (m *judgedModel) CreateChatCompletion(_ context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	reply := "an answer"
+	if req.Model == "gpt-4o" {
+		m.mu.Lock()
+		m.judged++
+		m.mu.Unlock()
+		reply = `{"accuracy": 4, "tone": 5, "policy": 2}`
+	}
+	message := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: reply}
+	return openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{Message: message}}}, nil
+}
+
+func (m *judgedModel) count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.judged
+}
+
+func TestQualitySampling(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	slackServer := fake.NewSlack()
+	t.Cleanup(slackServer.Close)
+	api := slack.New("xoxb-test", slack.OptionAPIURL(slackServer.APIURL()))
+	model, m := &judgedModel{}, metrics.New()
+	b := newBot(EventHandlerArgs{
+		Logger: logger, GPTClient: model, Metrics: m, NoRetentionChannels: []string{"C0PRIVATE"},
+		QualitySampleRate: 0.5, QualityJudgeModel: "gpt-4o",
+	})
+	draws := []float64{0.1, 0.9, 0.2}
+	b.quality.random = func() float64 {
+		draw := draws[0]
+		draws = draws[1:]
+		return draw
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.runQualitySampling(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> sampled", Channel: "C1", TimeStamp: "1.000001"})
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> not sampled", Channel: "C1", TimeStamp: "2.000001"})
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> kept nowhere", Channel: "C0PRIVATE", TimeStamp: "3.000001"})
+	scrape := func() string {
+		var b strings.Builder
+		_, err := m.Registry.WriteTo(&b)
+		require.NoError(t, err)
+		return b.String()
+	}
+	answeredBy := `model="` + string(chatgpt.DefaultModel) + `"`
+	require.Eventually(t, func() bool {
+		return strings.Contains(scrape(), `slackgpt_quality_samples_total{`+answeredBy+`,outcome="ok"} 1`)
+	}, time.Second, time.Millisecond)
+	assert.Contains(t, scrape(), `slackgpt_quality_score_sum{criterion="policy",`+answeredBy+`} 2`)
+	assert.Equal(t, 1, model.count())
+	assert.Len(t, draws, 1, "answers in channels nothing is kept of are not drawn")
+}
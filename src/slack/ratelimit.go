@@ -0,0 +1,134 @@
+package slackhandler
+
+import (
+	"context"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/cache"
+	"github.com/slack-go/slack"
+	"sync"
+	"time"
+)
+
+// bucket is the tokens left in a token bucket at a point in time, keys without one have a full bucket
+type bucket struct {
+	tokens float64
+	at     time.Time
+}
+
+// tokenBuckets gives every key limit questions per window, refilling continuously so a full bucket allows a
+// burst of limit questions
+type tokenBuckets struct {
+	limit   int
+	window  time.Duration
+	buckets *cache.LRU[bucket]
+}
+
+// newTokenBuckets creates token buckets tracking at most maxEntries keys, evicted keys start with a full bucket
+func newTokenBuckets(name string, limit int, window time.Duration, maxEntries int) *tokenBuckets {
+	return &tokenBuckets{limit: limit, window: window, buckets: cache.NewLRU[bucket](name, maxEntries, 0, nil)}
+}
+
+// tokens returns the tokens of key's bucket at now
+func (t *tokenBuckets) tokens(key string, now time.Time) float64 {
+	b, ok := t.buckets.Get(key)
+	if !ok {
+		return float64(t.limit)
+	}
+	refilled := b.tokens + float64(now.Sub(b.at))/float64(t.window)*float64(t.limit)
+	return min(refilled, float64(t.limit))
+}
+
+// wait returns how long key has to wait at now for a token, 0 when it has one
+func (t *tokenBuckets) wait(key string, now time.Time) time.Duration {
+	missing := 1 - t.tokens(key, now)
+	if missing <= 0 {
+		return 0
+	}
+	return time.Duration(missing / float64(t.limit) * float64(t.window))
+}
+
+// take removes a token from key's bucket at now
+func (t *tokenBuckets) take(key string, now time.Time) {
+	t.buckets.Set(key, bucket{tokens: t.tokens(key, now) - 1, at: now})
+}
+
+// Stats reports the size and effectiveness of the bucket cache
+func (t *tokenBuckets) Stats() cache.Stats {
+	return t.buckets.Stats()
+}
+
+// rateLimits keeps one user or one channel from spending the whole model budget, a nil limit does not apply
+type rateLimits struct {
+	mu       sync.Mutex
+	users    *tokenBuckets
+	channels *tokenBuckets
+}
+
+// allow takes a token for a question by user in channel at now, unless either has to wait. It returns how
+// long to wait and whether it is the channel's limit that was reached.
+func (r *rateLimits) allow(user, channel string, now time.Time) (wait time.Duration, channelLimited bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.users != nil && user != "" {
+		wait = r.users.wait(user, now)
+	}
+	if r.channels != nil {
+		if channelWait := r.channels.wait(channel, now); channelWait > wait {
+			wait, channelLimited = channelWait, true
+		}
+	}
+	if wait > 0 {
+		return wait, channelLimited
+	}
+	if r.users != nil && user != "" {
+		r.users.take(user, now)
+	}
+	if r.channels != nil {
+		r.channels.take(channel, now)
+	}
+	return 0, false
+}
+
+// rateLimitNotice returns the message telling user when they can ask again in channel, because of the rate
+// limits or the monthly budgets, empty when the question may be answered
+func (b *bot) rateLimitNotice(ctx context.Context, api *slack.Client, user, channel string) string {
+	if notice := b.budgetNotice(ctx, api, channel, user); notice != "" {
+		return notice
+	}
+	if b.limits == nil {
+		return ""
+	}
+	now := time.Now()
+	wait, channelLimited := b.limits.allow(user, channel, now)
+	if wait <= 0 {
+		return ""
+	}
+	b.logger.Printf("rate limited %v in %v for %v\n", user, channel, wait)
+	// rounded up, a wait of 0s would read as if asking right away works
+	if rounded := wait.Truncate(time.Second); rounded < wait {
+		wait = rounded + time.Second
+	}
+	again := now.Add(wait)
+	when := fmt.Sprintf("in %v (<!date^%d^{time}|%s>)", wait, again.Unix(), again.UTC().Format("15:04 MST"))
+	if channelLimited {
+		return fmt.Sprintf("Sorry, this channel has asked me a lot of questions recently. Please ask again %s.", when)
+	}
+	return fmt.Sprintf("Sorry, you've asked me a lot of questions recently. Please ask again %s.", when)
+}
+
+// withinRateLimit reports whether user may be answered in channel, telling them when they can ask again when
+// they may not
+func (b *bot) withinRateLimit(ctx context.Context, api *slack.Client, channel, threadTS, user string) bool {
+	notice := b.rateLimitNotice(ctx, api, user, channel)
+	if notice == "" {
+		return true
+	}
+	options := []slack.MsgOption{slack.MsgOptionText(notice, false)}
+	if threadTS != "" {
+		options = append(options, slack.MsgOptionTS(threadTS))
+	}
+	if _, err := api.PostEphemeralContext(ctx, channel, user, options...); err != nil {
+		b.logger.Printf("failed sending rate limit notice to %v: %v\n", user, err)
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestTokenBuckets(t *testing.T) {
+	buckets := newTokenBuckets("test", 2, time.Minute, 0)
+	now := time.Unix(1700000000, 0)
+	assert.Equal(t, time.Duration(0), buckets.wait("U1", now))
+	buckets.take("U1", now)
+	buckets.take("U1", now)
+	assert.Equal(t, 30*time.Second, buckets.wait("U1", now), "one token refills every half minute")
+	assert.Equal(t, 20*time.Second, buckets.wait("U1", now.Add(10*time.Second)))
+	assert.Equal(t, time.Duration(0), buckets.wait("U1", now.Add(30*time.Second)))
+	assert.Equal(t, time.Duration(0), buckets.wait("U2", now), "every key has its own bucket")
+	assert.Equal(t, 2.0, buckets.tokens("U1", now.Add(time.Hour)), "buckets refill up to the limit")
+}
+
+func TestRateLimits(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limits := &rateLimits{
+		users:    newTokenBuckets("users", 1, time.Minute, 0),
+		channels: newTokenBuckets("channels", 2, time.Minute, 0),
+	}
+	wait, _ := limits.allow("U1", "C1", now)
+	assert.Equal(t, time.Duration(0), wait)
+	wait, channelLimited := limits.allow("U1", "C1", now)
+	assert.Equal(t, time.Minute, wait)
+	assert.False(t, channelLimited)
+
+	wait, _ = limits.allow("U2", "C1", now)
+	assert.Equal(t, time.Duration(0), wait)
+	wait, channelLimited = limits.allow("U3", "C1", now)
+	assert.Equal(t, 30*time.Second, wait)
+	assert.True(t, channelLimited)
+	wait, _ = limits.allow("U3", "C2", now)
+	assert.Equal(t, time.Duration(0), wait, "refused questions don't use up the user's limit")
+}
+
+func TestWithinRateLimit(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{UserRateLimit: 1, RateLimitWindow: time.Hour})
+	ctx := context.Background()
+	mention := func(ts, text string) {
+		b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Channel: "C1", Text: text, TimeStamp: ts})
+	}
+
+	mention("1.000001", "what is go")
+	mention("1.000002", "what is rust")
+	assert.Len(t, slackServer.Messages(), 1)
+	ephemerals := slackServer.Ephemerals()
+	if assert.Len(t, ephemerals, 1) {
+		assert.Contains(t, ephemerals[0].Text, "Sorry, you've asked me a lot of questions recently. Please ask again in 1h0m0s (<!date^")
+		assert.Equal(t, "1.000002", ephemerals[0].ThreadTS)
+	}
+	_, ok := b.convo.Get("1.000002C1")
+	assert.False(t, ok, "limited questions are not stored")
+}
+
+func TestWithinRateLimitEditedQuestion(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{UserRateLimit: 1, RateLimitWindow: time.Hour, OnQuestionEdit: EditReply})
+	ctx := context.Background()
+	b.handleMessage(ctx, api, &slackevents.MessageEvent{Type: string(slackevents.Message), User: "U1", Text: "wat is go", Channel: "D1", TimeStamp: "1.000001"})
+	b.handleMessage(ctx, api, editEvent("D1", "1.000001", "wat is go", "what is go"))
+
+	assert.Len(t, slackServer.Messages(), 1, "the edit is not answered again")
+	ephemerals := slackServer.Ephemerals()
+	if assert.Len(t, ephemerals, 1) {
+		assert.Contains(t, ephemerals[0].Text, "Sorry, you've asked me a lot of questions recently.")
+	}
+}
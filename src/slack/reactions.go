@@ -0,0 +1,102 @@
+package slackhandler
+
+import (
+	"context"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/slack-go/slack"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxReceptionReplies is the most replies to an announcement sent to chat-gpt, later ones are left out
+const maxReceptionReplies = 200
+
+// reactionsCommandPattern matches the reactions command, with an optional message link
+var reactionsCommandPattern = regexp.MustCompile(`(?s)^(?:<@[A-Z0-9]+>\s*)?reactions\b\s*(.*)$`)
+
+// messageLinkPattern matches a slack message link, the channel and the timestamp's seconds and microseconds
+var messageLinkPattern = regexp.MustCompile(`/archives/([A-Z0-9]+)/p(\d+)(\d{6})\b`)
+
+// reactionsCommand summarizes how a message was received from its reactions and the replies in its thread,
+// reporting whether text was the command. The message is the one linked in text, or the parent of the thread
+// the command is sent in.
+func (b *bot) reactionsCommand(ctx context.Context, api *slack.Client, channel, threadTS, messageTS, user, text string) bool {
+	match := reactionsCommandPattern.FindStringSubmatch(strings.TrimSpace(text))
+	if match == nil {
+		return false
+	}
+	var options []slack.MsgOption
+	if threadTS != "" {
+		options = append(options, slack.MsgOptionTS(threadTS))
+	}
+	targetChannel, targetTS := channel, ""
+	if link := messageLinkPattern.FindStringSubmatch(match[1]); link != nil {
+		targetChannel, targetTS = link[1], link[2]+"."+link[3]
+	} else if threadTS != "" && threadTS != messageTS {
+		targetTS = threadTS
+	}
+	var reply string
+	switch {
+	case targetTS == "":
+		reply = "Usage: reactions <message link>, or reactions in the thread of the message"
+	case !b.withinRateLimit(ctx, api, channel, threadTS, user):
+		return true
+	default:
+		reply = b.reception(ctx, api, targetChannel, targetTS)
+	}
+	if _, _, err := api.PostMessageContext(ctx, channel, append(options, slack.MsgOptionText(reply, false))...); err != nil {
+		b.logger.Printf("failed answering reactions command: %v\n", err)
+	}
+	return true
+}
+
+// reception describes the reactions to the message ts in channel and has chat-gpt summarize the sentiment and
+// the questions of the replies in its thread, leaving out the bot's messages and reactions commands
+func (b *bot) reception(ctx context.Context, api *slack.Client, channel, ts string) string {
+	thread, err := fetchThread(ctx, api, &slack.GetConversationRepliesParameters{ChannelID: channel, Timestamp: ts, Limit: 200})
+	if err != nil {
+		b.logger.Printf("failed reading thread %v in %v: %v\n", ts, channel, err)
+		return "I could not read that message. Is it in a channel I am a member of?"
+	}
+	if len(thread) == 0 || thread[0].Timestamp != ts {
+		return "I could not find that message."
+	}
+
+	selfUser, selfBot, _ := b.self.get(ctx, api)
+	var replies []string
+	for _, m := range thread[1:] {
+		if m.User == selfUser && selfUser != "" || m.BotID == selfBot && selfBot != "" || reactionsCommandPattern.MatchString(m.Text) {
+			continue
+		}
+		if reply := b.prompt(ctx, api, m.Text); reply != "" {
+			replies = append(replies, reply)
+		}
+	}
+	reactions := describeReactions(thread[0].Reactions)
+	summary := fmt.Sprintf("*Reactions:* %s\n*Replies:* %d", reactions, len(replies))
+	if len(replies) > maxReceptionReplies {
+		replies = replies[:maxReceptionReplies]
+	}
+	answer, err := chatgpt.GetReception(b.gptClient, ctx, b.prompt(ctx, api, thread[0].Text), reactions, replies)
+	if err != nil {
+		b.logger.Printf("failed summarizing reception of %v in %v: %v\n", ts, channel, err)
+		return summary + "\nI could not summarize the replies."
+	}
+	return summary + "\n" + formatResponse(answer)
+}
+
+// describeReactions lists reactions with their counts, the most used first
+func describeReactions(reactions []slack.ItemReaction) string {
+	if len(reactions) == 0 {
+		return "none"
+	}
+	sorted := append([]slack.ItemReaction(nil), reactions...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Count > sorted[j].Count })
+	described := make([]string, len(sorted))
+	for i, reaction := range sorted {
+		described[i] = fmt.Sprintf(":%s: %d", reaction.Name, reaction.Count)
+	}
+	return strings.Join(described, " · ")
+}
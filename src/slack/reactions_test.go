@@ -0,0 +1,53 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestReactionsCommand(t *testing.T) {
+	ctx := context.Background()
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{})
+	announcement := slackServer.AddMessage(fake.Message{Channel: "C0NEWS", User: "U1", Text: "The office moves to Main Street on Monday",
+		Reactions: map[string]int{"tada": 12, "thinking_face": 3, "+1": 5}})
+	slackServer.AddMessage(fake.Message{Channel: "C0NEWS", User: "U2", Text: "Is there parking?", ThreadTS: announcement.TS})
+	slackServer.AddMessage(fake.Message{Channel: "C0NEWS", User: "U3", Text: "Great news!", ThreadTS: announcement.TS})
+
+	link := "<https://fake.slack.com/archives/C0NEWS/p" + strings.ReplaceAll(announcement.TS, ".", "") + ">"
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U9", Text: "<@U0BOT> reactions " + link, Channel: "C0COMMS", TimeStamp: "1.000001"})
+	var posted []fake.Message
+	for _, m := range slackServer.Messages() {
+		if m.User == "" {
+			posted = append(posted, m)
+		}
+	}
+	require.Len(t, posted, 1)
+	assert.Equal(t, "C0COMMS", posted[0].Channel)
+	assert.Equal(t, "1.000001", posted[0].ThreadTS)
+	assert.Contains(t, posted[0].Text, "*Reactions:* :tada: 12 · :+1: 5 · :thinking_face: 3\n*Replies:* 2\n")
+	assert.Contains(t, posted[0].Text, "- Is there parking?\n- Great news!")
+
+	// asked in the announcement's thread, the command and the bot's answers are not replies
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U9", Text: "<@U0BOT> reactions", Channel: "C0NEWS",
+		TimeStamp:       slackServer.AddMessage(fake.Message{Channel: "C0NEWS", User: "U9", Text: "<@U0BOT> reactions", ThreadTS: announcement.TS}).TS,
+		ThreadTimeStamp: announcement.TS})
+	messages := slackServer.Messages()
+	last := messages[len(messages)-1]
+	assert.Equal(t, announcement.TS, last.ThreadTS)
+	assert.Contains(t, last.Text, "*Replies:* 2\n")
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U9", Text: "<@U0BOT> reactions", Channel: "C0COMMS", TimeStamp: "2.000001"})
+	messages = slackServer.Messages()
+	assert.Equal(t, "Usage: reactions <message link>, or reactions in the thread of the message", messages[len(messages)-1].Text)
+}
+
+func TestDescribeReactions(t *testing.T) {
+	assert.Equal(t, "none", describeReactions(nil))
+	assert.Equal(t, ":wave: 2 · :eyes: 1", describeReactions([]slack.ItemReaction{{Name: "eyes", Count: 1}, {Name: "wave", Count: 2}}))
+}
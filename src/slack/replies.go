@@ -0,0 +1,56 @@
+package slackhandler
+
+import (
+	"github.com/chikamif/slackgpt/src/cache"
+)
+
+// reply records the bot's answer to a question so later edits or deletion of the question can be applied to it
+type reply struct {
+	Channel string
+	// ThreadTS is the thread the answer was posted in, empty for top level answers
+	ThreadTS string
+	ReplyTS  string
+	// ConvoKey, Question and Answer locate the exchange in the conversation store
+	ConvoKey string
+	Question string
+	Answer   string
+}
+
+// replies indexes the bot's answers by the channel and timestamp of the question they answer
+type replies struct {
+	data *cache.LRU[reply]
+}
+
+// newReplies creates a reply index holding at most maxEntries answers, 0 disables the bound
+func newReplies(maxEntries int) *replies {
+	return &replies{data: cache.NewLRU[reply]("replies", maxEntries, 0, replySize)}
+}
+
+// replySize estimates the memory held by a reply
+func replySize(key string, r reply) int64 {
+	return int64(len(key) + len(r.Channel) + len(r.ThreadTS) + len(r.ReplyTS) + len(r.ConvoKey) + len(r.Question) + len(r.Answer))
+}
+
+func replyKey(channel, questionTS string) string {
+	return channel + "/" + questionTS
+}
+
+// Record stores the answer to the question posted at questionTS in channel
+func (r *replies) Record(questionTS string, rep reply) {
+	r.data.Set(replyKey(rep.Channel, questionTS), rep)
+}
+
+// Get returns the answer to the question posted at questionTS in channel
+func (r *replies) Get(channel, questionTS string) (reply, bool) {
+	return r.data.Get(replyKey(channel, questionTS))
+}
+
+// Delete forgets the answer to the question posted at questionTS in channel
+func (r *replies) Delete(channel, questionTS string) {
+	r.data.Delete(replyKey(channel, questionTS))
+}
+
+// Stats reports the size and effectiveness of the reply index
+func (r *replies) Stats() cache.Stats {
+	return r.data.Stats()
+}
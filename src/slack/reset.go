@@ -0,0 +1,134 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/cache"
+	"github.com/chikamif/slackgpt/src/command"
+	"github.com/slack-go/slack"
+	"regexp"
+	"strings"
+)
+
+// resetCommand forgets the conversation of the direct message or group DM it is sent in
+const resetCommand = "/gpt-reset"
+
+// resetSpec is the syntax of resetCommand
+var resetSpec = &command.Command{
+	Name:    resetCommand,
+	Summary: "Forget our conversation in this direct message or group DM, so your next question starts fresh.",
+}
+
+// resetCommandPattern matches the reset command of mentions and direct messages, only "reset" alone so that
+// questions about resetting are answered
+var resetCommandPattern = regexp.MustCompile(`(?is)^(?:<@[A-Z0-9]+>\s*)?reset\s*$`)
+
+// resets keeps when the conversations of threads were last reset by conversation key, as the timestamp of the
+// reply to the reset command. Threads are read from Slack, so their messages up to then are left out of the
+// conversation.
+type resets struct {
+	data *cache.LRU[string]
+}
+
+// newResets creates a reset store holding the resets of at most maxEntries threads, 0 disables the bound
+func newResets(maxEntries int) *resets {
+	return &resets{data: cache.NewLRU[string]("resets", maxEntries, 0, nil)}
+}
+
+// Since returns the timestamp the thread with conversation key was last reset at, empty when it never was
+func (r *resets) Since(key string) string {
+	ts, _ := r.data.Get(key)
+	return ts
+}
+
+// Reset records that the thread with conversation key was reset at ts
+func (r *resets) Reset(key, ts string) {
+	r.data.Set(key, ts)
+}
+
+// Stats reports the size and effectiveness of the reset store
+func (r *resets) Stats() cache.Stats {
+	return r.data.Stats()
+}
+
+// afterReset drops the messages of thread posted up to the last reset of the thread with conversation key
+func (b *bot) afterReset(key string, thread []slack.Message) []slack.Message {
+	since, ok := slackTime(b.resets.Since(key))
+	if !ok {
+		return thread
+	}
+	var kept []slack.Message
+	for _, m := range thread {
+		if posted, ok := slackTime(m.Timestamp); ok && posted.After(since) {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+// forget forgets the conversation in the thread threadTS of channel, that of the channel itself when empty, and
+// user's private conversation there, reset at ts. Pinned messages stay pinned.
+func (b *bot) forget(channel, threadTS, user, ts string) {
+	key := ConversationKey(channel, threadTS)
+	b.convo.ClearConversation(key)
+	b.convo.ClearConversation(privateKey(channel, threadTS, user))
+	if ts != "" {
+		b.resets.Reset(key, ts)
+	}
+	b.logger.Printf("%s reset the conversation of %v\n", user, key)
+}
+
+// resetCommand forgets the conversation of the thread, direct message or group DM the reset command of a
+// mention or direct message was sent in, reporting whether text was the command. A mention at the top level of
+// a channel starts a new thread, which has nothing to forget.
+func (b *bot) resetCommand(ctx context.Context, api *slack.Client, channel, threadTS, messageTS, user, text string) bool {
+	if !resetCommandPattern.MatchString(strings.TrimSpace(text)) {
+		return false
+	}
+	resetting := threadTS != messageTS
+	reply := "Every thread is its own conversation, so there is nothing to forget here. Mention me with `reset` in a thread to forget its conversation."
+	if resetting {
+		reply = "Done, I forgot our conversation so far. Your next question starts fresh."
+		if len(b.pins.Get(ConversationKey(channel, threadTS))) > 0 {
+			reply += " The pinned messages stay in mind, `unpin` forgets them."
+		}
+	}
+	options := []slack.MsgOption{slack.MsgOptionText(reply, false)}
+	if threadTS != "" {
+		options = append(options, slack.MsgOptionTS(threadTS))
+	}
+	_, replyTS, err := api.PostMessageContext(ctx, channel, options...)
+	if err != nil {
+		b.logger.Printf("failed answering reset command: %v\n", err)
+		replyTS = messageTS
+	}
+	// the thread is forgotten up to the reply, which is no part of the next conversation either
+	if resetting {
+		b.forget(channel, threadTS, user, replyTS)
+	}
+	return true
+}
+
+// answerResetCommand forgets the conversation of the direct message or group DM resetCommand was sent in. Slash
+// commands do not say which thread they were sent from, so in channels users are told to mention the bot with
+// reset in the thread instead.
+func (b *bot) answerResetCommand(ctx context.Context, api *slack.Client, cmd *slack.SlashCommand) {
+	if b.ignoredUsers[cmd.UserID] {
+		b.logger.Printf("Ignored slash command from ignored user %s\n", cmd.UserID)
+		return
+	}
+	inv, err := b.aliases.Parse(resetSpec, cmd.Text)
+	if err != nil {
+		b.respond(ctx, cmd, completion{note: err.Error() + "\n" + inv.UsageText()}, slack.ResponseTypeEphemeral)
+		return
+	}
+	if inv.Help {
+		b.respond(ctx, cmd, completion{note: resetSpec.Help()}, slack.ResponseTypeEphemeral)
+		return
+	}
+	if _, groupDM := b.groupDM(ctx, api, cmd.ChannelID); !groupDM && !strings.HasPrefix(cmd.ChannelID, "D") {
+		b.respond(ctx, cmd, completion{note: "Every thread in a channel is its own conversation. Mention me with `reset` in the thread to forget its conversation."}, slack.ResponseTypeEphemeral)
+		return
+	}
+	b.forget(cmd.ChannelID, "", cmd.UserID, "")
+	b.respond(ctx, cmd, completion{note: "Done, I forgot our conversation so far. Your next question starts fresh."}, slack.ResponseTypeEphemeral)
+}
@@ -0,0 +1,71 @@
+package slackhandler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResetCommand(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{})
+	ctx := context.Background()
+	slackServer.AddMessage(fake.Message{Channel: "C1", User: "U1", Text: "the build is red", TS: "1.000001"})
+	question := slackServer.AddMessage(fake.Message{Channel: "C1", User: "U1", Text: "<@U0BOT> any idea?", ThreadTS: "1.000001"})
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: question.Text, Channel: "C1", TimeStamp: question.TS, ThreadTimeStamp: "1.000001"})
+	_, ok := b.convo.Get(ConversationKey("C1", "1.000001"))
+	require.True(t, ok)
+
+	reset := slackServer.AddMessage(fake.Message{Channel: "C1", User: "U1", Text: "<@U0BOT> reset", ThreadTS: "1.000001"})
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: reset.Text, Channel: "C1", TimeStamp: reset.TS, ThreadTimeStamp: "1.000001"})
+	messages := slackServer.Messages()
+	assert.Contains(t, messages[len(messages)-1].Text, "I forgot our conversation")
+	_, ok = b.convo.Get(ConversationKey("C1", "1.000001"))
+	assert.False(t, ok)
+
+	followUp := slackServer.AddMessage(fake.Message{Channel: "C1", User: "U1", Text: "<@U0BOT> what is go?", ThreadTS: "1.000001"})
+	history, ok := b.threadHistory(ctx, api, "C1", "1.000001", followUp.TS)
+	require.True(t, ok)
+	require.Len(t, history, 1, "the thread up to the reset is left out")
+	assert.Equal(t, "what is go?", history[0].Content)
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> reset", Channel: "C1", TimeStamp: "2.000001"})
+	messages = slackServer.Messages()
+	assert.Contains(t, messages[len(messages)-1].Text, "nothing to forget here")
+
+	b.convo.Store(ConversationKey("D1", ""), []string{"what is go?", "a language"})
+	b.answerMessage(ctx, api, &slackevents.MessageEvent{User: "U1", Text: "reset", Channel: "D1", ChannelType: "im", TimeStamp: "3.000001"})
+	_, ok = b.convo.Get(ConversationKey("D1", ""))
+	assert.False(t, ok, "a direct message is reset too")
+}
+
+func TestResetSlashCommand(t *testing.T) {
+	b, api, _ := newFakeBot(t, EventHandlerArgs{})
+	var responses []slack.WebhookMessage
+	responseServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg slack.WebhookMessage
+		_ = json.NewDecoder(r.Body).Decode(&msg)
+		responses = append(responses, msg)
+	}))
+	defer responseServer.Close()
+	b.convo.Store(ConversationKey("D1", ""), []string{"what is go?", "a language"})
+	b.convo.Store(privateKey("D1", "", "U1"), []string{"what is go?", "a language"})
+
+	b.handleSlashCommand(context.Background(), api, &slack.SlashCommand{Command: resetCommand, UserID: "U1", ChannelID: "D1", ResponseURL: responseServer.URL})
+	require.Len(t, responses, 1)
+	assert.Contains(t, responses[0].Text, "I forgot our conversation")
+	_, ok := b.convo.Get(ConversationKey("D1", ""))
+	assert.False(t, ok)
+	_, ok = b.convo.Get(privateKey("D1", "", "U1"))
+	assert.False(t, ok)
+
+	b.handleSlashCommand(context.Background(), api, &slack.SlashCommand{Command: resetCommand, UserID: "U1", ChannelID: "C1", ResponseURL: responseServer.URL})
+	require.Len(t, responses, 2)
+	assert.Contains(t, responses[1].Text, "Mention me with `reset` in the thread")
+}
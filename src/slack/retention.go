@@ -0,0 +1,75 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"regexp"
+)
+
+// offRecordNote is posted above answers nothing is kept of
+const offRecordNote = "_Off the record: nothing of this exchange is kept._"
+
+// offRecordPattern matches the modifier asking for nothing of an exchange to be kept, "off the record:", after
+// the mentions and other modifiers starting a question
+var offRecordPattern = regexp.MustCompile(`(?i)^((?:\s*<@[^<>]*>)*)\s*off\s+the\s+record\s*:\s*`)
+
+// offRecordQuestion removes the off the record modifier from text, reporting whether it asked for nothing of the
+// exchange to be kept
+func offRecordQuestion(text string) (string, bool) {
+	if !offRecordPattern.MatchString(text) {
+		return text, false
+	}
+	return offRecordPattern.ReplaceAllString(text, "$1 "), true
+}
+
+// retains reports whether exchanges in channel are kept: stored in conversations, recorded for edits, titled and
+// logged. Exchanges in no retention channels and those asked off the record only count towards metrics and limits.
+func (b *bot) retains(channel string) bool {
+	return !b.noRetention[channel]
+}
+
+// answerOffRecord answers a question user asked in channel without keeping anything of the exchange. Follow-ups
+// in threads continue the thread as it reads in Slack, when it can be read, since there is no conversation
+// stored. The answer has no buttons, which act on stored conversations, and private answers only go to user.
+func (b *bot) answerOffRecord(ctx context.Context, api *slack.Client, channel, threadTS, questionTS, user, question string, private bool, opts []chatgpt.Option) {
+	if !b.withinRateLimit(ctx, api, channel, threadTS, user) {
+		return
+	}
+	history, ok := []openai.ChatCompletionMessage(nil), false
+	if threadTS != "" && threadTS != questionTS && !private {
+		history, ok = b.threadHistory(ctx, api, channel, threadTS, questionTS)
+	}
+	if !ok {
+		history = []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: question}}
+	}
+	resp, err := b.complete(ctx, api, channel, user, history, opts...)
+	if err != nil {
+		b.logger.Printf("Failed to get gpt3 response for off the record question: %v\n", err)
+		resp = completion{answer: troubleAnswer(err)}
+	}
+	note := offRecordNote
+	if private {
+		note = privateNote + "\n" + note
+	}
+	if resp.note != "" {
+		note += "\n" + resp.note
+	}
+	resp.note = note
+	for _, part := range resp.split(maxAnswerText) {
+		options := answerOptions(part)
+		if threadTS != "" {
+			options = append(options, slack.MsgOptionTS(threadTS))
+		}
+		if private {
+			_, err = api.PostEphemeralContext(ctx, channel, user, options...)
+		} else {
+			_, _, err = api.PostMessageContext(ctx, channel, options...)
+		}
+		if err != nil {
+			b.logger.Printf("failed posting off the record answer: %v\n", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestOffRecordQuestion(t *testing.T) {
+	tests := []struct {
+		text          string
+		want          string
+		wantOffRecord bool
+	}{
+		{"<@U0BOT> off the record: what is go", "<@U0BOT> what is go", true},
+		{"<@U0BOT> Off  The Record : what is go", "<@U0BOT> what is go", true},
+		{"off the record: what is go", " what is go", true},
+		{"<@U0BOT> what is go, off the record: please", "<@U0BOT> what is go, off the record: please", false},
+	}
+	for _, tt := range tests {
+		text, offRecord := offRecordQuestion(tt.text)
+		assert.Equal(t, tt.want, text, tt.text)
+		assert.Equal(t, tt.wantOffRecord, offRecord, tt.text)
+	}
+}
+
+func TestNoRetention(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{NoRetentionChannels: []string{"C0SECURITY"}, AnswerButtons: true})
+	ctx := context.Background()
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> is this cve bad", Channel: "C0SECURITY", TimeStamp: "1.000001"})
+	messages := slackServer.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, offRecordNote+"\n"+formatResponse("fake answer to: is this cve bad"), messages[0].Text)
+	assert.Empty(t, messages[0].Blocks, "there is no conversation for buttons to act on")
+	assert.Zero(t, b.convo.Len())
+	_, recorded := b.replies.Get("C0SECURITY", "1.000001")
+	assert.False(t, recorded)
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> privately: off the record: and this one", Channel: "C1", TimeStamp: "2.000001"})
+	ephemerals := slackServer.Ephemerals()
+	require.Len(t, ephemerals, 1)
+	assert.Equal(t, privateNote+"\n"+offRecordNote+"\n"+formatResponse("fake answer to: and this one"), ephemerals[0].Text)
+
+	b.handleMessage(ctx, api, &slackevents.MessageEvent{User: "U1", Text: "off the record: what is go", Channel: "D1", ChannelType: "im", TimeStamp: "3.000001"})
+	require.Len(t, slackServer.Messages(), 2)
+	assert.Zero(t, b.convo.Len(), "nothing of the exchanges asked off the record is kept")
+
+	b.handleSlashCommand(ctx, api, &slack.SlashCommand{Command: gptCommand, Text: "--off-record what is go", UserID: "U1", ChannelID: "C1"})
+	require.Len(t, slackServer.Messages(), 3)
+	assert.Zero(t, b.convo.Len())
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: "C1", TimeStamp: "4.000001"})
+	assert.Equal(t, 1, b.convo.Len(), "other exchanges are kept")
+}
@@ -0,0 +1,364 @@
+package slackhandler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/cache"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/slack-go/slack"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// scheduleConfirmActionID schedules the drafted post
+	scheduleConfirmActionID = "slackgpt_schedule_confirm"
+	// scheduleDiscardActionID throws the drafted post away
+	scheduleDiscardActionID = "slackgpt_schedule_discard"
+	// maxScheduleAhead is how far ahead Slack schedules messages
+	maxScheduleAhead = 120 * 24 * time.Hour
+	// scheduleUsage explains the schedule command
+	scheduleUsage = "Tell me what to post, in which #channel and when, e.g. `schedule post that v2 ships today to " +
+		"#announcements on Monday at 9am`. `schedule list` shows your scheduled posts, `schedule cancel <id>` " +
+		"cancels one."
+)
+
+// scheduleCommandPattern matches the schedule command, with what to post or list or cancel
+var scheduleCommandPattern = regexp.MustCompile(`(?is)^(?:<@[A-Z0-9]+>\s*)?schedule\b:?\s*(.*)$`)
+
+// scheduleActionPattern matches listing and cancelling scheduled posts
+var scheduleActionPattern = regexp.MustCompile(`(?i)^(list|cancel)\b\s*(.*)$`)
+
+// ScheduledPost is a message a user had the bot post later through chat.scheduleMessage
+type ScheduledPost struct {
+	ID      int
+	User    string
+	Channel string
+	Text    string
+	PostAt  time.Time
+}
+
+// ScheduleStore keeps the posts users scheduled through the bot, to list and cancel them. Slack keeps the
+// messages themselves. With a path the posts are kept in a JSON file so they survive restarts.
+type ScheduleStore struct {
+	mu    sync.Mutex
+	path  string
+	posts []ScheduledPost
+}
+
+// NewScheduleStore creates a schedule store backed by the JSON file at path, which is created on the first
+// scheduled post if it does not exist. An empty path keeps them in memory only.
+func NewScheduleStore(path string) (*ScheduleStore, error) {
+	s := &ScheduleStore{path: path}
+	if path == "" {
+		return s, nil
+	}
+	if err := loadJSON(path, &s.posts); err != nil {
+		return nil, fmt.Errorf("reading scheduled posts: %w", err)
+	}
+	return s, nil
+}
+
+// Add keeps post with the next ID and forgets the posts that were posted, returning it with its ID. The post
+// is kept in memory even when saving fails.
+func (s *ScheduleStore) Add(post ScheduledPost) (ScheduledPost, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	pending := s.posts[:0]
+	for _, p := range s.posts {
+		post.ID = max(post.ID, p.ID)
+		if p.PostAt.After(now) {
+			pending = append(pending, p)
+		}
+	}
+	post.ID++
+	s.posts = append(pending, post)
+	return post, s.save()
+}
+
+// List returns the posts user scheduled that are still to be posted, the next first
+func (s *ScheduleStore) List(user string) []ScheduledPost {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var posts []ScheduledPost
+	for _, p := range s.posts {
+		if p.User == user && p.PostAt.After(time.Now()) {
+			posts = append(posts, p)
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool { return posts[i].PostAt.Before(posts[j].PostAt) })
+	return posts
+}
+
+// Remove forgets the post with id, reporting whether there was one
+func (s *ScheduleStore) Remove(id int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, p := range s.posts {
+		if p.ID == id {
+			s.posts = append(s.posts[:i], s.posts[i+1:]...)
+			return true, s.save()
+		}
+	}
+	return false, nil
+}
+
+// save writes the posts to the store's file, when it has one. It must be called with the lock held.
+func (s *ScheduleStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	if err := saveJSON(s.path, s.posts); err != nil {
+		return fmt.Errorf("saving scheduled posts: %w", err)
+	}
+	return nil
+}
+
+// scheduling drafts posts with the model and schedules them once their author confirms
+type scheduling struct {
+	store *ScheduleStore
+	// drafts are the posts waiting for confirmation by the value of their buttons
+	drafts *cache.LRU[ScheduledPost]
+}
+
+// newScheduling creates scheduling keeping posts in store and at most maxEntries drafts, 0 disables the bound
+func newScheduling(store *ScheduleStore, maxEntries int) *scheduling {
+	return &scheduling{store: store, drafts: cache.NewLRU[ScheduledPost]("schedule_drafts", maxEntries, 0, nil)}
+}
+
+// Stats reports the size and effectiveness of the draft cache
+func (s *scheduling) Stats() cache.Stats {
+	return s.drafts.Stats()
+}
+
+// scheduleCommand drafts, lists or cancels posts scheduled through the bot for a mention or direct message,
+// reporting whether text was the schedule command. Replies only go to user.
+func (b *bot) scheduleCommand(ctx context.Context, api *slack.Client, channel, threadTS, user, text string) bool {
+	if b.scheduling == nil {
+		return false
+	}
+	match := scheduleCommandPattern.FindStringSubmatch(strings.TrimSpace(text))
+	if match == nil {
+		return false
+	}
+	request := strings.TrimSpace(match[1])
+	action := scheduleActionPattern.FindStringSubmatch(request)
+	switch {
+	case request == "":
+		b.tell(ctx, api, channel, threadTS, user, scheduleUsage)
+	case action != nil && strings.EqualFold(action[1], "list"):
+		b.tell(ctx, api, channel, threadTS, user, scheduledList(b.scheduling.store.List(user)))
+	case action != nil:
+		b.tell(ctx, api, channel, threadTS, user, b.cancelScheduled(ctx, api, user, strings.TrimSpace(action[2])))
+	case b.withinRateLimit(ctx, api, channel, threadTS, user):
+		b.draftScheduled(ctx, api, channel, threadTS, user, request)
+	}
+	return true
+}
+
+// draftScheduled has the model draft the post request asks for and shows it to user to confirm
+func (b *bot) draftScheduled(ctx context.Context, api *slack.Client, channel, threadTS, user, request string) {
+	loc := time.UTC
+	if info, err := api.GetUserInfoContext(ctx, user); err == nil && info.TZ != "" {
+		if l, err := time.LoadLocation(info.TZ); err == nil {
+			loc = l
+		}
+	}
+	now := time.Now().In(loc)
+	draft, err := chatgpt.GetScheduleDraft(b.gptClient, ctx, request, now)
+	if err != nil {
+		b.logger.Printf("failed drafting a scheduled post: %v\n", err)
+		b.tell(ctx, api, channel, threadTS, user, "I could not draft that post. "+scheduleUsage)
+		return
+	}
+	postAt, err := time.ParseInLocation(chatgpt.ScheduleTimeLayout, draft.Time, loc)
+	var problem string
+	switch {
+	// the channel has to be mentioned, so the model cannot pick one
+	case draft.Channel == "" || !strings.Contains(request, "<#"+draft.Channel):
+		problem = "Which channel should I post it in? Mention it as a #channel."
+	case err != nil:
+		problem = "When should I post it? Tell me the day and time."
+	case !postAt.After(now.Add(time.Minute)):
+		problem = "That time has passed. When should I post it?"
+	case postAt.After(now.Add(maxScheduleAhead)):
+		problem = "Slack schedules posts up to 120 days ahead. Please pick an earlier time."
+	case draft.Message == "":
+		problem = "What should I post?"
+	}
+	if problem != "" {
+		b.tell(ctx, api, channel, threadTS, user, problem+"\n"+scheduleUsage)
+		return
+	}
+	if member, err := b.memberOf(ctx, api, draft.Channel, user); err != nil || !member {
+		if err != nil {
+			b.logger.Printf("failed checking the members of %v: %v\n", draft.Channel, err)
+		}
+		b.tell(ctx, api, channel, threadTS, user, fmt.Sprintf("You are not in <#%s>. You can only schedule posts to channels you are in.", draft.Channel))
+		return
+	}
+	post := ScheduledPost{User: user, Channel: draft.Channel, Text: draft.Message, PostAt: postAt}
+	key := fmt.Sprintf("%s.%d", user, time.Now().UnixNano())
+	b.scheduling.drafts.Set(key, post)
+	prompt := fmt.Sprintf("Schedule this post to <#%s> for %s?", post.Channel, slackDate(post.PostAt))
+	confirm := slack.NewButtonBlockElement(scheduleConfirmActionID, key, slack.NewTextBlockObject(slack.PlainTextType, "Schedule", false, false))
+	confirm.Style = slack.StylePrimary
+	discard := slack.NewButtonBlockElement(scheduleDiscardActionID, key, slack.NewTextBlockObject(slack.PlainTextType, "Discard", false, false))
+	options := []slack.MsgOption{
+		slack.MsgOptionText(prompt+"\n"+post.Text, false),
+		slack.MsgOptionBlocks(
+			slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, "*"+prompt+"*", false, false), nil, nil),
+			slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, quote(post.Text), false, false), nil, nil),
+			slack.NewActionBlock("slackgpt_schedule_actions", confirm, discard),
+		),
+	}
+	if threadTS != "" {
+		options = append(options, slack.MsgOptionTS(threadTS))
+	}
+	if _, err := api.PostEphemeralContext(ctx, channel, user, options...); err != nil {
+		b.logger.Printf("failed showing the draft post to %v: %v\n", user, err)
+	}
+}
+
+// confirmScheduled schedules or discards the draft post whose button was clicked, in place of the draft
+func (b *bot) confirmScheduled(ctx context.Context, api *slack.Client, callback *slack.InteractionCallback, action *slack.BlockAction) {
+	if b.scheduling == nil {
+		return
+	}
+	post, ok := b.scheduling.drafts.Get(action.Value)
+	if !ok || post.User != callback.User.ID {
+		b.replaceDraft(ctx, callback, "This draft is no longer known. Please ask again.")
+		return
+	}
+	if action.ActionID == scheduleDiscardActionID {
+		b.scheduling.drafts.Delete(action.Value)
+		b.replaceDraft(ctx, callback, "Discarded the post.")
+		return
+	}
+	if !post.PostAt.After(time.Now()) {
+		b.replaceDraft(ctx, callback, "That time has passed. Please ask again with a new one.")
+		return
+	}
+	_, _, err := api.ScheduleMessageContext(ctx, post.Channel, strconv.FormatInt(post.PostAt.Unix(), 10),
+		slack.MsgOptionText(post.Text, false),
+		slack.MsgOptionBlocks(
+			slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, post.Text, false, false), nil, nil),
+			slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, "Scheduled by <@"+post.User+">", false, false)),
+		))
+	var slackErr slack.SlackErrorResponse
+	switch {
+	case errors.As(err, &slackErr) && slackErr.Err == "not_in_channel":
+		b.replaceDraft(ctx, callback, fmt.Sprintf("I am not in <#%s>. Please invite me and click Schedule again.", post.Channel))
+		return
+	case err != nil:
+		b.logger.Printf("failed scheduling a post for %v: %v\n", post.User, err)
+		b.replaceDraft(ctx, callback, "I could not schedule the post. Please try again.")
+		return
+	}
+	b.scheduling.drafts.Delete(action.Value)
+	post, err = b.scheduling.store.Add(post)
+	note := ""
+	if err != nil {
+		b.logger.Printf("failed saving a scheduled post: %v\n", err)
+		note = " It is posted either way, but cannot be listed or cancelled here after a restart."
+	}
+	b.replaceDraft(ctx, callback, fmt.Sprintf("Scheduled post %d to <#%s> for %s.%s", post.ID, post.Channel, slackDate(post.PostAt), note))
+}
+
+// replaceDraft replaces the draft post of a clicked button with text
+func (b *bot) replaceDraft(ctx context.Context, callback *slack.InteractionCallback, text string) {
+	if callback.ResponseURL == "" {
+		return
+	}
+	if err := slack.PostWebhookContext(ctx, callback.ResponseURL, &slack.WebhookMessage{Text: text, ReplaceOriginal: true}); err != nil {
+		b.logger.Printf("failed replacing the draft post: %v\n", err)
+	}
+}
+
+// cancelScheduled deletes the post with id user scheduled, returning what to tell them
+func (b *bot) cancelScheduled(ctx context.Context, api *slack.Client, user, id string) string {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return "Usage: `schedule cancel <id>`, the IDs are in `schedule list`."
+	}
+	var post *ScheduledPost
+	for _, p := range b.scheduling.store.List(user) {
+		if p.ID == n {
+			post = &p
+			break
+		}
+	}
+	if post == nil {
+		return fmt.Sprintf("You have no scheduled post %d.", n)
+	}
+	// slack-go does not return the ID Slack gives scheduled messages, so it is looked up
+	messages, _, err := api.GetScheduledMessagesContext(ctx, &slack.GetScheduledMessagesParameters{
+		Channel: post.Channel, Oldest: strconv.FormatInt(post.PostAt.Unix(), 10), Latest: strconv.FormatInt(post.PostAt.Unix(), 10),
+	})
+	if err != nil {
+		b.logger.Printf("failed listing scheduled messages: %v\n", err)
+		return "I could not cancel the post. Please try again."
+	}
+	for _, msg := range messages {
+		if int64(msg.PostAt) != post.PostAt.Unix() || msg.Text != post.Text {
+			continue
+		}
+		if _, err := api.DeleteScheduledMessageContext(ctx, &slack.DeleteScheduledMessageParameters{Channel: post.Channel, ScheduledMessageID: msg.ID}); err != nil {
+			b.logger.Printf("failed deleting scheduled message: %v\n", err)
+			return "I could not cancel the post. Please try again."
+		}
+		break
+	}
+	if _, err := b.scheduling.store.Remove(n); err != nil {
+		b.logger.Printf("failed saving scheduled posts: %v\n", err)
+	}
+	return fmt.Sprintf("Cancelled post %d to <#%s>.", n, post.Channel)
+}
+
+// scheduledList lists the posts a user scheduled
+func scheduledList(posts []ScheduledPost) string {
+	if len(posts) == 0 {
+		return "You have no scheduled posts."
+	}
+	var b strings.Builder
+	b.WriteString("Your scheduled posts:")
+	for _, post := range posts {
+		text := post.Text
+		if runes := []rune(text); len(runes) > 200 {
+			text = string(runes[:200]) + "…"
+		}
+		fmt.Fprintf(&b, "\n*%d.* <#%s>, %s\n%s", post.ID, post.Channel, slackDate(post.PostAt), quote(text))
+	}
+	return b.String()
+}
+
+// memberOf reports whether user is a member of channel
+func (b *bot) memberOf(ctx context.Context, api *slack.Client, channel, user string) (bool, error) {
+	params := &slack.GetUsersInConversationParameters{ChannelID: channel}
+	for {
+		members, cursor, err := api.GetUsersInConversationContext(ctx, params)
+		if err != nil {
+			return false, err
+		}
+		for _, member := range members {
+			if member == user {
+				return true, nil
+			}
+		}
+		if cursor == "" {
+			return false, nil
+		}
+		params.Cursor = cursor
+	}
+}
+
+// quote quotes text in mrkdwn
+func quote(text string) string {
+	return "> " + strings.ReplaceAll(text, "\n", "\n> ")
+}
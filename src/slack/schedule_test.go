@@ -0,0 +1,101 @@
+package slackhandler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestScheduleStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.json")
+	store, err := NewScheduleStore(path)
+	require.NoError(t, err)
+	later := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	first, err := store.Add(ScheduledPost{User: "U1", Channel: "C1", Text: "second", PostAt: later})
+	require.NoError(t, err)
+	second, err := store.Add(ScheduledPost{User: "U1", Channel: "C1", Text: "first", PostAt: later.Add(-time.Hour)})
+	require.NoError(t, err)
+	_, err = store.Add(ScheduledPost{User: "U2", Channel: "C1", Text: "other", PostAt: later})
+	require.NoError(t, err)
+	assert.Equal(t, 1, first.ID)
+	assert.Equal(t, 2, second.ID)
+
+	reloaded, err := NewScheduleStore(path)
+	require.NoError(t, err)
+	posts := reloaded.List("U1")
+	require.Len(t, posts, 2)
+	assert.Equal(t, "first", posts[0].Text, "the next post is listed first")
+	removed, err := reloaded.Remove(2)
+	require.NoError(t, err)
+	assert.True(t, removed)
+	assert.Len(t, reloaded.List("U1"), 1)
+	removed, _ = reloaded.Remove(2)
+	assert.False(t, removed)
+}
+
+// draftKeyPattern finds the key of a draft post in the blocks of its preview
+var draftKeyPattern = regexp.MustCompile(`"value":"(U1\.[0-9]+)"`)
+
+func TestScheduleCommand(t *testing.T) {
+	store, _ := NewScheduleStore("")
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{Schedules: store})
+	slackServer.AddMembers("C0ANN", "U1")
+	ctx := context.Background()
+	at := time.Now().UTC().Add(72 * time.Hour).Format(chatgpt.ScheduleTimeLayout)
+	draft := fmt.Sprintf(`{"channel":"C0ANN","time":"%s","message":"We ship!"}`, at)
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> schedule to <#C0ANN|announcements> " + draft, Channel: "C1", TimeStamp: "1.000001"})
+	assert.Empty(t, slackServer.Messages())
+	ephemerals := slackServer.Ephemerals()
+	require.Len(t, ephemerals, 1)
+	assert.Contains(t, ephemerals[0].Text, "Schedule this post to <#C0ANN>")
+	assert.Contains(t, ephemerals[0].Text, "We ship!")
+	key := draftKeyPattern.FindStringSubmatch(ephemerals[0].Blocks)
+	require.NotNil(t, key)
+
+	var replaced slack.WebhookMessage
+	responseServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&replaced)
+	}))
+	defer responseServer.Close()
+	callback := &slack.InteractionCallback{Type: slack.InteractionTypeBlockActions, User: slack.User{ID: "U2"}, ResponseURL: responseServer.URL}
+	callback.ActionCallback.BlockActions = []*slack.BlockAction{{ActionID: scheduleConfirmActionID, Value: key[1]}}
+	b.handleInteraction(ctx, api, callback)
+	assert.Empty(t, slackServer.Scheduled(), "only the drafter can schedule the post")
+
+	callback.User.ID = "U1"
+	b.handleInteraction(ctx, api, callback)
+	scheduled := slackServer.Scheduled()
+	require.Len(t, scheduled, 1)
+	assert.Equal(t, "C0ANN", scheduled[0].Channel)
+	assert.Equal(t, "We ship!", scheduled[0].Text)
+	assert.Contains(t, scheduled[0].Blocks, "Scheduled by \\u003c@U1\\u003e")
+	assert.True(t, replaced.ReplaceOriginal)
+	assert.Contains(t, replaced.Text, "Scheduled post 1 to <#C0ANN>")
+
+	b.answerMessage(ctx, api, &slackevents.MessageEvent{User: "U1", Text: "schedule list", Channel: "D1", TimeStamp: "2.000001"})
+	ephemerals = slackServer.Ephemerals()
+	require.Len(t, ephemerals, 2)
+	assert.Contains(t, ephemerals[1].Text, "*1.* <#C0ANN>")
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> schedule cancel 1", Channel: "C1", TimeStamp: "3.000001"})
+	assert.Contains(t, slackServer.Ephemerals()[2].Text, "Cancelled post 1")
+	assert.Empty(t, slackServer.Scheduled())
+	assert.Empty(t, store.List("U1"))
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U2", Text: "<@U0BOT> schedule to <#C0ANN|announcements> " + draft, Channel: "C1", TimeStamp: "4.000001"})
+	assert.Contains(t, slackServer.Ephemerals()[3].Text, "You are not in <#C0ANN>")
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> schedule to announcements " + draft, Channel: "C1", TimeStamp: "5.000001"})
+	assert.Contains(t, slackServer.Ephemerals()[4].Text, "Which channel", "the channel has to be mentioned")
+}
@@ -0,0 +1,75 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/cache"
+	"github.com/slack-go/slack"
+	"time"
+)
+
+// sharedChannelRefresh is how long whether a channel is shared is remembered, channels can be shared and
+// unshared at any time
+const sharedChannelRefresh = time.Hour
+
+// DefaultSharedChannelDisclosure is shown below answers in channels shared with other organizations
+const DefaultSharedChannelDisclosure = "This answer was written by an AI assistant. This channel is shared with people " +
+	"outside your organization, who can see it too."
+
+// SharedChannelPolicy is how questions are answered in Slack Connect channels, which people of other
+// organizations can read
+type SharedChannelPolicy struct {
+	// Tools lets the model look people and owners up in the workspace
+	Tools bool
+	// Grounding answers from the knowledge base, bookmarks and FAQs, the internal documents otherwise kept from
+	// people outside the organization
+	Grounding bool
+	// Disclosure is shown below every answer, nothing when empty
+	Disclosure string
+}
+
+// sharedState is whether a channel was shared when it was looked up
+type sharedState struct {
+	shared bool
+	at     time.Time
+}
+
+// sharedChannels applies the shared channel policy to the channels that are shared with other organizations
+type sharedChannels struct {
+	policy SharedChannelPolicy
+	data   *cache.LRU[sharedState]
+}
+
+// newSharedChannels creates the shared channel policy remembering at most maxEntries channels, 0 disables the
+// bound
+func newSharedChannels(policy SharedChannelPolicy, maxEntries int) *sharedChannels {
+	return &sharedChannels{policy: policy, data: cache.NewLRU[sharedState]("shared_channels", maxEntries, 0, nil)}
+}
+
+// Stats reports the size and effectiveness of the shared channel cache
+func (s *sharedChannels) Stats() cache.Stats {
+	return s.data.Stats()
+}
+
+// sharedPolicy returns the policy of channel when it is shared with another organization through Slack Connect,
+// nil otherwise. Needs the channels:read and groups:read scopes; a channel that cannot be looked up is taken
+// for a shared one, so a missing scope never shows internal documents outside the organization.
+func (b *bot) sharedPolicy(ctx context.Context, api *slack.Client, channel string) *SharedChannelPolicy {
+	if b.shared == nil || channel == "" {
+		return nil
+	}
+	state, ok := b.shared.data.Get(channel)
+	if !ok || time.Since(state.at) > sharedChannelRefresh {
+		state = sharedState{shared: true, at: time.Now()}
+		info, err := api.GetConversationInfoContext(ctx, &slack.GetConversationInfoInput{ChannelID: channel})
+		if err != nil {
+			b.logger.Printf("failed looking up channel %v, answering as in a shared channel: %v\n", channel, err)
+		} else {
+			state.shared = info.IsExtShared || info.IsPendingExtShared
+		}
+		b.shared.data.Set(channel, state)
+	}
+	if !state.shared {
+		return nil
+	}
+	return &b.shared.policy
+}
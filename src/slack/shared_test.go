@@ -0,0 +1,53 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestSharedPolicy(t *testing.T) {
+	policy := &SharedChannelPolicy{Disclosure: DefaultSharedChannelDisclosure}
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{SharedChannelPolicy: policy})
+	slackServer.ShareChannel("C0SHARED")
+	ctx := context.Background()
+
+	assert.Nil(t, b.sharedPolicy(ctx, api, "C1"))
+	assert.Equal(t, policy, b.sharedPolicy(ctx, api, "C0SHARED"))
+	unreachable := slack.New("xoxb-test", slack.OptionAPIURL("http://127.0.0.1:1/api/"))
+	assert.NotNil(t, b.sharedPolicy(ctx, unreachable, "C2"), "channels that cannot be looked up are taken for shared")
+	assert.Nil(t, b.sharedPolicy(ctx, unreachable, "C1"), "channels are remembered")
+
+	b, api, _ = newFakeBot(t, EventHandlerArgs{})
+	assert.Nil(t, b.sharedPolicy(ctx, api, "C0SHARED"), "without a policy shared channels are answered like any other")
+}
+
+func TestSharedChannelDisclosure(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{SharedChannelPolicy: &SharedChannelPolicy{Disclosure: "_Visible outside Acme._"}})
+	slackServer.ShareChannel("C0SHARED")
+	ctx := context.Background()
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: "C0SHARED", TimeStamp: "1.000001"})
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: "C1", TimeStamp: "2.000001"})
+	messages := slackServer.Messages()
+	require.Len(t, messages, 2)
+	assert.Contains(t, messages[0].Text, "_Visible outside Acme._")
+	assert.NotContains(t, messages[1].Text, "Visible outside")
+	history, _ := b.convo.Get(ConversationKey("C0SHARED", "1.000001"))
+	assert.Equal(t, []string{"what is go", "fake answer to: what is go"}, history, "the disclosure is not part of the conversation")
+}
+
+func TestCompletionFooter(t *testing.T) {
+	resp := completion{answer: "go is a language", note: "_caveat_", footer: "_disclosure_", blocks: true}
+	assert.Equal(t, "_caveat_\n"+formatResponse("go is a language")+"\n_disclosure_", resp.text())
+	parts := resp.split(30)
+	require.Greater(t, len(parts), 1)
+	assert.Empty(t, parts[0].footer)
+	assert.Equal(t, "_disclosure_", parts[len(parts)-1].footer, "the footer goes below the last part")
+	blocks := answerBlocks(resp)
+	require.NotEmpty(t, blocks)
+	assert.IsType(t, &slack.ContextBlock{}, blocks[len(blocks)-1])
+}
@@ -0,0 +1,222 @@
+package slackhandler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/chikamif/slackgpt/src/command"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/socketmode"
+	"net/http"
+	"time"
+)
+
+// gptCommand asks the bot a question without mentioning it
+const gptCommand = "/gpt"
+
+// gptSpec is the syntax of gptCommand
+var gptSpec = &command.Command{
+	Name:    gptCommand,
+	Args:    "<question>",
+	Summary: "Ask me a question without mentioning me, follow-ups go in the answer's thread.",
+	Flags: []command.Flag{
+		{Name: "private", Short: "p", Usage: "only you see the answer"},
+		{Name: "later", Short: "l", Usage: "answer it off-peak at a lower cost, when low priority questions are enabled"},
+		{Name: "off-record", Short: "o", Usage: "keep nothing of the question and answer"},
+	},
+}
+
+// gptUsage explains gptCommand to users who sent it without a question
+var gptUsage = gptSpec.Help()
+
+// troubleText answers questions the model could not be reached for
+const troubleText = "I'm having some trouble communicating with our servers (my brain). Please try again in a little bit and hopefully the fuzz clears up."
+
+// troubleAnswer answers a question that could not be answered because of err, saying when to try again when the
+// model was down for maintenance, or still rate limited or overloaded after the request's retries, or the bot
+// was too busy
+func troubleAnswer(err error) string {
+	if errors.Is(err, errBusy) {
+		return busyText
+	}
+	var maintenance *chatgpt.MaintenanceError
+	if errors.As(err, &maintenance) {
+		// answers are posted in a code block, where dates are not shown in the reader's time zone
+		return fmt.Sprintf("The model is down for planned maintenance until %s. Please ask again then.", maintenance.Until.UTC().Format(utcDate))
+	}
+	var retry *chatgpt.RetryError
+	if !errors.As(err, &retry) {
+		return troubleText
+	}
+	if !retry.RateLimited() {
+		return fmt.Sprintf("The model's servers are having trouble (%s) and I couldn't get an answer after %d tries. "+
+			"Please try again in a few minutes.", http.StatusText(retry.StatusCode), retry.Attempts)
+	}
+	if retry.RetryAfter <= 0 {
+		return fmt.Sprintf("The model is getting more questions than it can take and I couldn't get through after %d "+
+			"tries. Please try again in a minute or so.", retry.Attempts)
+	}
+	return fmt.Sprintf("The model is getting more questions than it can take and asked me to wait %v before trying "+
+		"again. Please ask again then.", retry.RetryAfter.Round(time.Second))
+}
+
+// handleSlashCommandEvent handles the slash commands registered for the app
+func (b *bot) handleSlashCommandEvent(ctx context.Context, api *slack.Client, evt *socketmode.Event) {
+	cmd, ok := evt.Data.(slack.SlashCommand)
+	if !ok {
+		b.logger.Printf("Ignored %+v\n", evt)
+		return
+	}
+	b.handleSlashCommand(ctx, api, &cmd)
+}
+
+// handleSlashCommand dispatches slash commands by name, unknown commands are ignored
+func (b *bot) handleSlashCommand(ctx context.Context, api *slack.Client, cmd *slack.SlashCommand) {
+	switch cmd.Command {
+	case gptCommand:
+		b.answerGPTCommand(ctx, api, cmd)
+	case imagineCommand:
+		b.answerImagineCommand(ctx, api, cmd)
+	case feedbackReportCommand:
+		b.answerFeedbackReportCommand(ctx, cmd)
+	case usageCommand:
+		b.answerUsageCommand(ctx, cmd)
+	case budgetCommand:
+		b.answerBudgetCommand(ctx, api, cmd)
+	case resetCommand:
+		b.answerResetCommand(ctx, api, cmd)
+	case systemCommand:
+		b.answerSystemCommand(ctx, api, cmd)
+	case modelCommand:
+		b.answerModelCommand(ctx, cmd)
+	case statusCommand:
+		b.answerStatusCommand(ctx, cmd)
+	default:
+		b.logger.Printf("Ignored slash command %v\n", cmd.Command)
+	}
+}
+
+// answerGPTCommand answers the question asked with gptCommand in the channel it was sent in, as a new
+// conversation that follow-ups can continue in the answer's thread, or only to the user when it is private
+func (b *bot) answerGPTCommand(ctx context.Context, api *slack.Client, cmd *slack.SlashCommand) {
+	if b.ignoredUsers[cmd.UserID] {
+		b.logger.Printf("Ignored slash command from ignored user %s\n", cmd.UserID)
+		return
+	}
+	if notice := b.accessNotice(ctx, api, cmd.ChannelID, cmd.UserID); notice != "" {
+		b.respond(ctx, cmd, completion{note: notice}, slack.ResponseTypeEphemeral)
+		return
+	}
+	inv, err := b.aliases.Parse(gptSpec, cmd.Text)
+	if err != nil {
+		b.respond(ctx, cmd, completion{note: err.Error() + "\n" + inv.UsageText()}, slack.ResponseTypeEphemeral)
+		return
+	}
+	settings := b.userSettings(cmd.UserID)
+	question, private := inv.Rest, inv.Has("private") || settings.Private
+	retain := b.retains(cmd.ChannelID) && !inv.Has("off-record") && !settings.OffRecord
+	if helpCommandPattern.MatchString(b.localize(question)) {
+		b.respondHelp(ctx, cmd)
+		return
+	}
+	if actionsCommandPattern.MatchString(b.localize(question)) {
+		b.respondActionItems(ctx, cmd)
+		return
+	}
+	if inv.Help || question == "" {
+		b.respond(ctx, cmd, completion{note: gptUsage}, slack.ResponseTypeEphemeral)
+		return
+	}
+	if !b.consented(ctx, api, cmd.ChannelID, "", cmd.UserID, "") ||
+		!b.policyAcknowledged(ctx, api, cmd.ChannelID, "", cmd.UserID, "") {
+		return
+	}
+	// the bot may not be in the channel, so the notice goes to the response URL
+	if notice := b.rateLimitNotice(ctx, api, cmd.UserID, cmd.ChannelID); notice != "" {
+		b.respond(ctx, cmd, completion{note: notice}, slack.ResponseTypeEphemeral)
+		return
+	}
+	prompt := b.prompt(ctx, api, question)
+	refusal, warning := b.moderationNotice(ctx, prompt)
+	if refusal != "" {
+		b.respond(ctx, cmd, completion{note: refusal}, slack.ResponseTypeEphemeral)
+		return
+	}
+	if warning != "" {
+		b.respond(ctx, cmd, completion{note: warning}, slack.ResponseTypeEphemeral)
+	}
+	_, maintenance := b.batching.maintenance(b.gptClient)
+	// the queue keeps questions until they are answered
+	if retain && b.batching != nil && (inv.Has("later") || b.batching.lowPriority(cmd.ChannelID) || maintenance) {
+		// private answers go to the user's direct messages with the bot
+		answerChannel := cmd.ChannelID
+		if private {
+			answerChannel = cmd.UserID
+		}
+		history := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: prompt}}
+		notice := b.queueQuestion(api, cmd.ChannelID, answerChannel, "", cmd.TriggerID, cmd.UserID, "", prompt, history, nil)
+		b.respond(ctx, cmd, completion{note: notice}, slack.ResponseTypeEphemeral)
+		return
+	}
+	resp, err := b.complete(ctx, api, cmd.ChannelID, cmd.UserID, []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: prompt}})
+	if err != nil {
+		b.logger.Printf("Failed to get gpt3 response for slash command: %v\n", err)
+		resp = completion{answer: troubleAnswer(err)}
+	}
+	// the command itself is not shown in the channel, so the answer quotes the question
+	asked := fmt.Sprintf("*<@%s> asked:* %s", cmd.UserID, slackEscaper.Replace(question))
+	if private {
+		asked = "*You asked:* " + slackEscaper.Replace(question)
+	}
+	if !retain {
+		asked += "\n" + offRecordNote
+	}
+	if resp.note != "" {
+		asked += "\n" + resp.note
+	}
+	resp.note = asked
+	parts := resp.split(maxAnswerText)
+	if private || err != nil {
+		for _, part := range parts {
+			b.respond(ctx, cmd, part, slack.ResponseTypeEphemeral)
+		}
+		return
+	}
+
+	_, ts, err := api.PostMessageContext(ctx, cmd.ChannelID, answerOptions(parts[0])...)
+	if err != nil {
+		// the bot can only post in channels it is a member of, the response URL works everywhere
+		b.logger.Printf("failed posting slash command answer, responding instead: %v\n", err)
+		for _, part := range parts {
+			b.respond(ctx, cmd, part, slack.ResponseTypeInChannel)
+		}
+		return
+	}
+	b.postRest(ctx, api, cmd.ChannelID, "", ts, parts[1:])
+	if !retain {
+		return
+	}
+	key := ts + cmd.ChannelID
+	b.convo.Store(key, []string{prompt, resp.stored()})
+	// buttons act on the conversation, which is keyed by the answer's timestamp
+	if options := b.replyOptions(parts[0], key, cmd.UserID); len(options) > 1 {
+		if _, _, _, err = api.UpdateMessageContext(ctx, cmd.ChannelID, ts, options...); err != nil {
+			b.logger.Printf("failed adding buttons to slash command answer: %v\n", err)
+		}
+	}
+}
+
+// respond answers cmd through its response URL, only to the user when responseType is slack.ResponseTypeEphemeral
+func (b *bot) respond(ctx context.Context, cmd *slack.SlashCommand, resp completion, responseType string) {
+	msg := &slack.WebhookMessage{Text: resp.text(), ResponseType: responseType}
+	if resp.blocks {
+		if blocks := answerBlocks(resp); len(blocks) > 0 {
+			msg.Blocks = &slack.Blocks{BlockSet: blocks}
+		}
+	}
+	if err := slack.PostWebhookContext(ctx, cmd.ResponseURL, msg); err != nil {
+		b.logger.Printf("failed responding to slash command: %v\n", err)
+	}
+}
@@ -0,0 +1,104 @@
+package slackhandler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/chikamif/slackgpt/src/command"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestParseGPTCommand(t *testing.T) {
+	tests := []struct {
+		text        string
+		wantText    string
+		wantPrivate bool
+	}{
+		{"what is go", "what is go", false},
+		{" --private what is go ", "what is go", true},
+		{"-p what is go", "what is go", true},
+		{"-pwhat is go", "-pwhat is go", false},
+		{"-p", "", true},
+		{"", "", false},
+		{"what's 2 -5?", "what's 2 -5?", false},
+	}
+	for _, tt := range tests {
+		inv, err := command.Parse(gptSpec, tt.text)
+		require.NoError(t, err, tt.text)
+		assert.Equal(t, tt.wantText, inv.Rest, tt.text)
+		assert.Equal(t, tt.wantPrivate, inv.Has("private"), tt.text)
+	}
+}
+
+func TestGPTCommand(t *testing.T) {
+	tests := []struct {
+		name         string
+		text         string
+		wantMessages int
+		wantResponse string
+	}{
+		{"public", "what is go", 1, ""},
+		{"private", "--private what is go", 0, "*You asked:* what is go\n```fake answer to: what is go```"},
+		{"usage", " ", 0, gptUsage},
+		{"help", "--help", 0, gptUsage},
+		{"unknown flag", "--loud what is go", 0, "unknown flag `--loud`\n" + gptUsage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, api, slackServer := newFakeBot(t, EventHandlerArgs{EscalationGroup: "S0ONCALL"})
+			var responses []slack.WebhookMessage
+			responseServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var msg slack.WebhookMessage
+				_ = json.NewDecoder(r.Body).Decode(&msg)
+				responses = append(responses, msg)
+			}))
+			defer responseServer.Close()
+
+			b.handleSlashCommand(context.Background(), api, &slack.SlashCommand{
+				Command: gptCommand, Text: tt.text, UserID: "U1", ChannelID: "C1", ResponseURL: responseServer.URL,
+			})
+			messages := slackServer.Messages()
+			require.Len(t, messages, tt.wantMessages)
+			if tt.wantMessages == 0 {
+				require.Len(t, responses, 1)
+				assert.Equal(t, slack.ResponseTypeEphemeral, responses[0].ResponseType)
+				assert.Equal(t, tt.wantResponse, responses[0].Text)
+				return
+			}
+			assert.Empty(t, responses)
+			assert.Equal(t, "*<@U1> asked:* what is go\n```fake answer to: what is go```", messages[0].Text)
+			assert.Contains(t, messages[0].Blocks, escalateActionID)
+			history, ok := b.convo.Get(messages[0].TS + "C1")
+			require.True(t, ok)
+			assert.Equal(t, []string{"what is go", "fake answer to: what is go"}, history)
+		})
+	}
+}
+
+func TestTroubleAnswer(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"unknown", errors.New("connection reset"), troubleText},
+		{"rate limited", &url.Error{Op: "Post", Err: &chatgpt.RetryError{StatusCode: http.StatusTooManyRequests, Attempts: 4}}, "couldn't get through after 4 tries"},
+		{"told when", fmt.Errorf("anthropic: %w", &chatgpt.RetryError{StatusCode: http.StatusTooManyRequests, Attempts: 1, RetryAfter: 90 * time.Second}), "wait 1m30s before trying again"},
+		{"overloaded", &chatgpt.RetryError{StatusCode: http.StatusServiceUnavailable, Attempts: 4}, "having trouble (Service Unavailable)"},
+		{"maintenance", &chatgpt.MaintenanceError{Until: time.Date(2024, 6, 2, 4, 0, 0, 0, time.FixedZone("CEST", 2*60*60))}, "maintenance until Jun 2 02:00 UTC"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Contains(t, troubleAnswer(tt.err), tt.want)
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package slackhandler
+
+import (
+	"fmt"
+	"github.com/slack-go/slack/socketmode"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ActiveRequest is an event that is currently being handled
+type ActiveRequest struct {
+	ID      string
+	Type    socketmode.EventType
+	Started time.Time
+}
+
+// HandlerStatus exposes the live state of a running event handler for diagnostics.
+// All methods are safe to call on a nil HandlerStatus.
+type HandlerStatus struct {
+	mu     sync.Mutex
+	active map[uint64]ActiveRequest
+	events chan socketmode.Event
+	nextID atomic.Uint64
+}
+
+// StatusSnapshot is a point in time copy of a HandlerStatus
+type StatusSnapshot struct {
+	// QueuedEvents is the number of events received from slack but not yet dispatched
+	QueuedEvents int
+	// ActiveRequests lists the events being handled, oldest first
+	ActiveRequests []ActiveRequest
+}
+
+// NewHandlerStatus creates a HandlerStatus to pass to EventHandler through EventHandlerArgs
+func NewHandlerStatus() *HandlerStatus {
+	return &HandlerStatus{active: make(map[uint64]ActiveRequest)}
+}
+
+// watchQueue records the channel events are queued on before dispatch
+func (s *HandlerStatus) watchQueue(events chan socketmode.Event) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = events
+}
+
+// start records that evt is being handled and returns a token to pass to done
+func (s *HandlerStatus) start(evt *socketmode.Event) uint64 {
+	if s == nil {
+		return 0
+	}
+	token := s.nextID.Add(1)
+	// events without a socketmode request (connecting, hello...) get a local ID
+	id := fmt.Sprintf("local-%d", token)
+	if evt.Request != nil && evt.Request.EnvelopeID != "" {
+		id = evt.Request.EnvelopeID
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active[token] = ActiveRequest{ID: id, Type: evt.Type, Started: time.Now()}
+	return token
+}
+
+// done records that the event identified by token has been handled
+func (s *HandlerStatus) done(token uint64) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.active, token)
+}
+
+// Snapshot returns the current queue depth and active requests
+func (s *HandlerStatus) Snapshot() StatusSnapshot {
+	var snapshot StatusSnapshot
+	if s == nil {
+		return snapshot
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.events != nil {
+		snapshot.QueuedEvents = len(s.events)
+	}
+	for _, req := range s.active {
+		snapshot.ActiveRequests = append(snapshot.ActiveRequests, req)
+	}
+	sort.Slice(snapshot.ActiveRequests, func(i, j int) bool {
+		return snapshot.ActiveRequests[i].Started.Before(snapshot.ActiveRequests[j].Started)
+	})
+	return snapshot
+}
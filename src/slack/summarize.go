@@ -0,0 +1,75 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+)
+
+const (
+	// summarizeCallbackID identifies the "Summarize this thread" message shortcut, as created in the app settings
+	summarizeCallbackID = "slackgpt_summarize_thread"
+	// maxSummarizedText is the most characters of a thread summarized, its first message and the latest ones
+	maxSummarizedText = 60000
+)
+
+// summarizeThread posts a summary of the thread of the message the summarize shortcut was used on as a reply in
+// it, with the action items of the summary when they are tracked. Problems are told to the user alone.
+func (b *bot) summarizeThread(ctx context.Context, api *slack.Client, callback *slack.InteractionCallback) {
+	channel, user := callback.Channel.ID, callback.User.ID
+	threadTS := callback.Message.ThreadTimestamp
+	if threadTS == "" {
+		threadTS = callback.Message.Timestamp
+	}
+	if b.ignoredUsers[user] {
+		b.logger.Printf("Ignored summarize shortcut from ignored user %s\n", user)
+		return
+	}
+	if notice := b.accessNotice(ctx, api, channel, user); notice != "" {
+		b.respondClick(ctx, callback, notice)
+		return
+	}
+	if notice := b.rateLimitNotice(ctx, api, user, channel); notice != "" {
+		b.respondClick(ctx, callback, notice)
+		return
+	}
+	thread, err := fetchThread(ctx, api, &slack.GetConversationRepliesParameters{ChannelID: channel, Timestamp: threadTS, Limit: 200})
+	if err != nil {
+		b.logger.Printf("failed reading thread %v in %v: %v\n", threadTS, channel, err)
+		b.respondClick(ctx, callback, "I could not read this thread. Please invite me to the channel and try again.")
+		return
+	}
+	chat := trimThread(b.threadChat(ctx, api, thread))
+	if len(chat) == 0 {
+		b.respondClick(ctx, callback, "There is nothing to summarize in this thread.")
+		return
+	}
+	b.logger.Printf("%s asked for a summary of thread %v in %v, %d messages\n", user, threadTS, channel, len(chat))
+	answer, err := chatgpt.GetThreadSummary(b.gptClient, ctx, chat)
+	if err != nil {
+		b.logger.Printf("failed summarizing thread %v in %v: %v\n", threadTS, channel, err)
+		b.reportIncident(ctx, api, channel, err)
+		b.respondClick(ctx, callback, troubleAnswer(err))
+		return
+	}
+	text := "*Summary of this thread, asked for by <@" + user + ">:*\n" + formatResponse(answer)
+	if _, _, err := api.PostMessageContext(ctx, channel, slack.MsgOptionText(text, false), slack.MsgOptionTS(threadTS)); err != nil {
+		b.logger.Printf("failed posting thread summary: %v\n", err)
+		b.respondClick(ctx, callback, "I could not post the summary. Please invite me to the channel and try again.")
+		return
+	}
+	b.trackActionItems(ctx, api, channel, threadTS, answer)
+}
+
+// trimThread keeps the first message of chat and as many of the latest ones as fit in maxSummarizedText
+// characters
+func trimThread(chat []openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	size := 0
+	for i := len(chat) - 1; i > 0; i-- {
+		if size += len(chat[i].Content); size > maxSummarizedText-len(chat[0].Content) {
+			return append(chat[:1:1], chat[i+1:]...)
+		}
+	}
+	return chat
+}
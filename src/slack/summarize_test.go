@@ -0,0 +1,54 @@
+package slackhandler
+
+import (
+	"context"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestSummarizeThread(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{})
+	model := &paramsModel{}
+	b.gptClient = model
+	ctx := context.Background()
+	parent := slackServer.AddMessage(fake.Message{Channel: "C1", User: "U1", Text: "Which database do we pick?"})
+	var last fake.Message
+	for i := 0; i < 250; i++ {
+		last = slackServer.AddMessage(fake.Message{Channel: "C1", User: "U2", Text: fmt.Sprintf("reply %d", i), ThreadTS: parent.TS})
+	}
+
+	callback := &slack.InteractionCallback{Type: slack.InteractionTypeMessageAction, CallbackID: summarizeCallbackID, User: slack.User{ID: "U3"}}
+	callback.Channel.ID = "C1"
+	callback.Message.Timestamp, callback.Message.ThreadTimestamp = last.TS, parent.TS
+	b.handleInteraction(ctx, api, callback)
+
+	req := model.last()
+	require.Len(t, req.Messages, 2)
+	assert.Contains(t, req.Messages[0].Content, "Summarize the following Slack thread")
+	transcript := req.Messages[1].Content
+	assert.Contains(t, transcript, "user U1: Which database do we pick?")
+	assert.Contains(t, transcript, "user U2: reply 249", "every page of the thread is read")
+	messages := slackServer.Messages()
+	summary := messages[len(messages)-1]
+	assert.Equal(t, parent.TS, summary.ThreadTS)
+	assert.Contains(t, summary.Text, "Summary of this thread, asked for by <@U3>")
+	assert.Contains(t, summary.Text, "go is a language")
+}
+
+func TestTrimThread(t *testing.T) {
+	message := func(content string) openai.ChatCompletionMessage {
+		return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: content}
+	}
+	long := message(strings.Repeat("x", maxSummarizedText/2))
+	chat := trimThread([]openai.ChatCompletionMessage{message("the question"), long, long, message("latest")})
+	require.Len(t, chat, 3)
+	assert.Equal(t, "the question", chat[0].Content)
+	assert.Equal(t, "latest", chat[2].Content)
+	assert.Len(t, trimThread([]openai.ChatCompletionMessage{message("a"), message("b")}), 2)
+}
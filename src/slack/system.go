@@ -0,0 +1,238 @@
+package slackhandler
+
+import (
+	"context"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/cache"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/chikamif/slackgpt/src/command"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"regexp"
+	"strings"
+)
+
+const (
+	// systemCommand sets the system prompt of the direct message it is sent in
+	systemCommand = "/gpt-system"
+	// systemDefault goes back to the channel's system prompt, with systemCommand or the system command
+	systemDefault = "default"
+	// systemKeyPrefix prefixes the conversation keys the system prompts of threads are kept under in the
+	// conversation store
+	systemKeyPrefix = "system/"
+	// maxThreadPrompt is the most characters of the system prompt of a thread
+	maxThreadPrompt = 4000
+)
+
+// systemSpec is the syntax of systemCommand
+var systemSpec = &command.Command{
+	Name:    systemCommand,
+	Args:    "[prompt|" + systemDefault + "]",
+	Summary: "Set the system prompt I answer with in this direct message, or show it; `" + systemDefault + "` goes back to the usual one.",
+}
+
+var (
+	// systemCommandPattern matches the system command of mentions and direct messages, with the prompt to set
+	systemCommandPattern = regexp.MustCompile(`(?is)^(?:<@[A-Z0-9]+>\s*)?system(?:\s*:\s*(.*))?$`)
+	// askedPattern matches the questions the bot posted for their asker, such as /gpt's, with the asker
+	askedPattern = regexp.MustCompile(`^\*<@([A-Z0-9]+)> asked:\*`)
+)
+
+// threadPrompt is the system prompt set for a thread and who set it
+type threadPrompt struct {
+	Prompt string
+	User   string
+}
+
+// threadPrompts keeps the system prompts set for threads by conversation key. With a conversation store they
+// are kept in it beside the thread's conversation, and loaded from it the first time the thread is answered.
+type threadPrompts struct {
+	store ConversationStore
+	// data caches the prompts of threads, empty for those known to have none
+	data *cache.LRU[threadPrompt]
+}
+
+// newThreadPrompts creates a store of the system prompts of threads caching those of at most maxEntries threads,
+// 0 disables the bound
+func newThreadPrompts(maxEntries int, store ConversationStore) *threadPrompts {
+	return &threadPrompts{store: store, data: cache.NewLRU[threadPrompt]("thread_prompts", maxEntries, 0, nil)}
+}
+
+// get returns the system prompt of the thread with conversation key, reporting false when it has none
+func (t *threadPrompts) get(key string) (threadPrompt, bool) {
+	if p, ok := t.data.Get(key); ok || t.store == nil {
+		return p, p.Prompt != ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), conversationStoreTimeout)
+	defer cancel()
+	stored, ok, err := t.store.Load(ctx, systemKeyPrefix+key)
+	if err != nil {
+		// tried again on the next question
+		return threadPrompt{}, false
+	}
+	var p threadPrompt
+	if ok && len(stored) == 2 {
+		p = threadPrompt{Prompt: stored[0], User: stored[1]}
+	}
+	t.data.Update(key, func(existing threadPrompt, exists bool) threadPrompt {
+		// a concurrent change was made to what is in the store already
+		if exists {
+			p = existing
+		}
+		return p
+	})
+	return p, p.Prompt != ""
+}
+
+// set sets the system prompt of the thread with conversation key, removing it when p.Prompt is empty. The
+// prompt is kept in memory even when saving it fails.
+func (t *threadPrompts) set(key string, p threadPrompt) error {
+	t.data.Set(key, p)
+	if t.store == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), conversationStoreTimeout)
+	defer cancel()
+	var err error
+	if p.Prompt == "" {
+		err = t.store.Delete(ctx, systemKeyPrefix+key)
+	} else {
+		err = t.store.Save(ctx, systemKeyPrefix+key, []string{p.Prompt, p.User})
+	}
+	if err != nil {
+		return fmt.Errorf("saving the system prompt of %v: %w", key, err)
+	}
+	return nil
+}
+
+// Stats reports the size and effectiveness of the cache of thread prompts
+func (t *threadPrompts) Stats() cache.Stats {
+	return t.data.Stats()
+}
+
+// personaIn returns the system prompt answering user in the conversation of key in channel: the thread's when
+// one was set, else personaFor's. Private conversations in a thread share the thread's.
+func (b *bot) personaIn(key, channel, user string) string {
+	thread, _, _ := strings.Cut(key, "/")
+	if p, ok := b.threadPrompts.get(thread); ok {
+		return answerIn(p.Prompt, b.userSettings(user).Language)
+	}
+	return b.personaFor(channel, user)
+}
+
+// completeIn is complete for the conversation of key, answered with its thread's system prompt when one was set
+func (b *bot) completeIn(ctx context.Context, api *slack.Client, key, channel, user string, history []openai.ChatCompletionMessage, opts ...chatgpt.Option) (completion, error) {
+	return b.completeAs(ctx, api, channel, user, b.personaIn(key, channel, user), history, opts...)
+}
+
+// firstParticipant returns who started the thread threadTS of channel: the author of its first message, or the
+// asker when the bot posted it for them. It is empty when the bot started the thread on its own.
+func (b *bot) firstParticipant(ctx context.Context, api *slack.Client, channel, threadTS string) (string, error) {
+	messages, _, _, err := api.GetConversationRepliesContext(ctx, &slack.GetConversationRepliesParameters{ChannelID: channel, Timestamp: threadTS, Limit: 1})
+	if err != nil {
+		return "", err
+	}
+	if len(messages) == 0 {
+		return "", nil
+	}
+	first := messages[0]
+	selfUser, selfBot, _ := b.self.get(ctx, api)
+	if first.User == selfUser && selfUser != "" || first.BotID == selfBot && selfBot != "" {
+		if asked := askedPattern.FindStringSubmatch(first.Text); asked != nil {
+			return asked[1], nil
+		}
+		return "", nil
+	}
+	return first.User, nil
+}
+
+// setThreadPrompt sets prompt as the system prompt of the conversation in the thread threadTS of channel, that of
+// the channel itself when empty, for user, and returns the reply telling them how it went. Only the first
+// participant of a thread may set its prompt; messageTS is that of the command. An empty prompt shows the
+// current one.
+func (b *bot) setThreadPrompt(ctx context.Context, api *slack.Client, channel, threadTS, messageTS, user, prompt string) string {
+	key := ConversationKey(channel, threadTS)
+	prompt = strings.TrimSpace(prompt)
+	if prompt == "" {
+		if p, ok := b.threadPrompts.get(key); ok {
+			return fmt.Sprintf("<@%s> set this system prompt here:\n>%s", p.User, strings.ReplaceAll(slackEscaper.Replace(p.Prompt), "\n", "\n>"))
+		}
+		return "No system prompt is set here, I answer as usual."
+	}
+	if !b.retains(channel) {
+		return "Nothing is kept in this channel, so I cannot set a system prompt here."
+	}
+	// direct messages have a single participant besides the bot, and the command may start a thread of its own
+	switch {
+	case strings.HasPrefix(channel, "D") || threadTS == messageTS:
+	case threadTS == "":
+		return "Everyone here shares the conversation, so set a system prompt in a thread instead."
+	default:
+		first, err := b.firstParticipant(ctx, api, channel, threadTS)
+		if err != nil {
+			b.logger.Printf("failed reading thread %v in %v: %v\n", threadTS, channel, err)
+			return "I could not read this thread to check who started it. Please invite me to the channel and try again."
+		}
+		if first != user {
+			return "Only who started this thread can set its system prompt."
+		}
+	}
+	if len(prompt) > maxThreadPrompt {
+		return fmt.Sprintf("The system prompt is too long, keep it under %d characters.", maxThreadPrompt)
+	}
+	p, reply := threadPrompt{Prompt: prompt, User: user}, "Done, I'll answer with this system prompt from now on here."
+	if strings.EqualFold(prompt, systemDefault) {
+		p, reply = threadPrompt{}, "Done, I'll answer as usual from now on here."
+	} else if refusal, _ := b.moderationNotice(ctx, prompt); refusal != "" {
+		return refusal
+	}
+	if err := b.threadPrompts.set(key, p); err != nil {
+		b.logger.Printf("failed keeping a system prompt: %v\n", err)
+	}
+	b.logger.Printf("%s set the system prompt of %v\n", user, key)
+	return reply
+}
+
+// systemCommand sets the system prompt of the thread, or direct message, the system command of a mention or
+// direct message was sent in, or shows it, reporting whether text was the command. The reply is posted for
+// everyone in the conversation.
+func (b *bot) systemCommand(ctx context.Context, api *slack.Client, channel, threadTS, messageTS, user, text string) bool {
+	match := systemCommandPattern.FindStringSubmatch(strings.TrimSpace(text))
+	if match == nil {
+		return false
+	}
+	reply := b.setThreadPrompt(ctx, api, channel, threadTS, messageTS, user, match[1])
+	options := []slack.MsgOption{slack.MsgOptionText(reply, false)}
+	if threadTS != "" {
+		options = append(options, slack.MsgOptionTS(threadTS))
+	}
+	if _, _, err := api.PostMessageContext(ctx, channel, options...); err != nil {
+		b.logger.Printf("failed answering system command: %v\n", err)
+	}
+	return true
+}
+
+// answerSystemCommand sets the system prompt of the direct message systemCommand was sent in, or shows it. Slash
+// commands do not say which thread they were sent from, so elsewhere users are told to mention the bot with
+// the system command in the thread instead.
+func (b *bot) answerSystemCommand(ctx context.Context, api *slack.Client, cmd *slack.SlashCommand) {
+	if b.ignoredUsers[cmd.UserID] {
+		b.logger.Printf("Ignored slash command from ignored user %s\n", cmd.UserID)
+		return
+	}
+	inv, err := b.aliases.Parse(systemSpec, cmd.Text)
+	if err != nil {
+		b.respond(ctx, cmd, completion{note: err.Error() + "\n" + inv.UsageText()}, slack.ResponseTypeEphemeral)
+		return
+	}
+	if inv.Help {
+		b.respond(ctx, cmd, completion{note: systemSpec.Help()}, slack.ResponseTypeEphemeral)
+		return
+	}
+	if !strings.HasPrefix(cmd.ChannelID, "D") {
+		b.respond(ctx, cmd, completion{note: "Every thread has its own system prompt. Mention me with `system: <prompt>` in a thread you started to set it."}, slack.ResponseTypeEphemeral)
+		return
+	}
+	reply := b.setThreadPrompt(ctx, api, cmd.ChannelID, "", "", cmd.UserID, inv.Rest)
+	b.respond(ctx, cmd, completion{note: reply}, slack.ResponseTypeEphemeral)
+}
@@ -0,0 +1,84 @@
+package slackhandler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSystemCommand(t *testing.T) {
+	store := &memoryStore{data: map[string][]string{}}
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{Conversations: store})
+	model := &paramsModel{}
+	b.gptClient = model
+	ctx := context.Background()
+	lastReply := func() string {
+		messages := slackServer.Messages()
+		return messages[len(messages)-1].Text
+	}
+	slackServer.AddMessage(fake.Message{Channel: "C1", User: "U1", Text: "review my diff", TS: "1.000001"})
+
+	set := slackServer.AddMessage(fake.Message{Channel: "C1", User: "U2", Text: "<@U0BOT> system: You are a pirate", ThreadTS: "1.000001"})
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U2", Text: set.Text, Channel: "C1", TimeStamp: set.TS, ThreadTimeStamp: "1.000001"})
+	assert.Equal(t, "Only who started this thread can set its system prompt.", lastReply())
+
+	set = slackServer.AddMessage(fake.Message{Channel: "C1", User: "U1", Text: "<@U0BOT> system: You are a strict code reviewer", ThreadTS: "1.000001"})
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: set.Text, Channel: "C1", TimeStamp: set.TS, ThreadTimeStamp: "1.000001"})
+	assert.Contains(t, lastReply(), "I'll answer with this system prompt")
+	assert.Equal(t, []string{"You are a strict code reviewer", "U1"}, store.data[systemKeyPrefix+ConversationKey("C1", "1.000001")])
+
+	// every later turn in the thread is answered with it, whoever asks
+	question := slackServer.AddMessage(fake.Message{Channel: "C1", User: "U2", Text: "<@U0BOT> is this fine?", ThreadTS: "1.000001"})
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U2", Text: question.Text, Channel: "C1", TimeStamp: question.TS, ThreadTimeStamp: "1.000001"})
+	assert.Equal(t, "You are a strict code reviewer", model.last().Messages[0].Content)
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U2", Text: "<@U0BOT> what is go?", Channel: "C1", TimeStamp: "2.000001"})
+	assert.NotEqual(t, "You are a strict code reviewer", model.last().Messages[0].Content, "other threads are answered as usual")
+
+	// the prompt survives a restart
+	restarted := newBot(EventHandlerArgs{Logger: logger, Conversations: store})
+	assert.Equal(t, "You are a strict code reviewer", restarted.personaIn(ConversationKey("C1", "1.000001"), "C1", "U2"))
+
+	show := slackServer.AddMessage(fake.Message{Channel: "C1", User: "U2", Text: "<@U0BOT> system", ThreadTS: "1.000001"})
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U2", Text: show.Text, Channel: "C1", TimeStamp: show.TS, ThreadTimeStamp: "1.000001"})
+	assert.Equal(t, "<@U1> set this system prompt here:\n>You are a strict code reviewer", lastReply())
+
+	reset := slackServer.AddMessage(fake.Message{Channel: "C1", User: "U1", Text: "<@U0BOT> system: default", ThreadTS: "1.000001"})
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: reset.Text, Channel: "C1", TimeStamp: reset.TS, ThreadTimeStamp: "1.000001"})
+	assert.Contains(t, lastReply(), "I'll answer as usual")
+	assert.NotContains(t, store.data, systemKeyPrefix+ConversationKey("C1", "1.000001"))
+
+	// a mention at the top level starts a thread of its own
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U2", Text: "<@U0BOT> system: You are a pirate", Channel: "C1", TimeStamp: "3.000001"})
+	p, ok := b.threadPrompts.get(ConversationKey("C1", "3.000001"))
+	require.True(t, ok)
+	assert.Equal(t, "U2", p.User)
+}
+
+func TestSystemSlashCommand(t *testing.T) {
+	b, api, _ := newFakeBot(t, EventHandlerArgs{})
+	var responses []slack.WebhookMessage
+	responseServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg slack.WebhookMessage
+		_ = json.NewDecoder(r.Body).Decode(&msg)
+		responses = append(responses, msg)
+	}))
+	defer responseServer.Close()
+	command := func(channel, text string) string {
+		b.handleSlashCommand(context.Background(), api, &slack.SlashCommand{Command: systemCommand, Text: text, UserID: "U1", ChannelID: channel, ResponseURL: responseServer.URL})
+		require.NotEmpty(t, responses)
+		return responses[len(responses)-1].Text
+	}
+
+	assert.Contains(t, command("D1", "You are a strict code reviewer"), "I'll answer with this system prompt")
+	assert.Contains(t, b.personaIn(ConversationKey("D1", ""), "D1", "U1"), "You are a strict code reviewer")
+	assert.Contains(t, command("D1", ""), ">You are a strict code reviewer")
+	assert.Contains(t, command("C1", "You are a pirate"), "Mention me with `system: <prompt>`")
+}
@@ -0,0 +1,225 @@
+package slackhandler
+
+import (
+	"context"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/command"
+	"github.com/slack-go/slack"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// budgetCommand shows the team budgets to admins and lets them override those used up
+const budgetCommand = "/gpt-budget"
+
+// budgetSpec is the syntax of budgetCommand
+var budgetSpec = &command.Command{
+	Name:    budgetCommand,
+	Summary: "Show what the teams with a budget spent this month and let a team go over its budget, admins only.",
+	Subcommands: []*command.Command{
+		{Name: "list", Summary: "Show every team's budget and what its members spent this month."},
+		{Name: "override", Args: "<user group>", Summary: "Answer the team's members again until the end of the month though its budget is used up."},
+		{Name: "restore", Args: "<user group>", Summary: "Hold the team to its budget again."},
+	},
+}
+
+// TeamBudget is what the members of a user group may spend together in a month. Its Leads are told in a DM once
+// the team used Warn of it, e.g. 0.8 for 80%, and again once it is used up and the members' questions are declined.
+type TeamBudget struct {
+	Budget
+	Warn  float64
+	Leads []string
+}
+
+// userGroups remembers the members of user groups for groupMembersRefresh
+type userGroups struct {
+	mu      sync.Mutex
+	members map[string]map[string]bool
+	fetched map[string]time.Time
+}
+
+// membersOf returns the members of group, looked up again after groupMembersRefresh. Those looked up last are
+// kept when that fails.
+func (g *userGroups) membersOf(ctx context.Context, api *slack.Client, group string) (map[string]bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.members[group] != nil && time.Since(g.fetched[group]) <= groupMembersRefresh {
+		return g.members[group], nil
+	}
+	members, err := api.GetUserGroupMembersContext(ctx, group)
+	if err != nil {
+		return g.members[group], err
+	}
+	if g.members == nil {
+		g.members, g.fetched = map[string]map[string]bool{}, map[string]time.Time{}
+	}
+	g.members[group] = make(map[string]bool, len(members))
+	for _, member := range members {
+		g.members[group][member] = true
+	}
+	g.fetched[group] = time.Now()
+	return g.members[group], nil
+}
+
+// teamSpend adds up what members spent, from the spend of every user in byUser
+func teamSpend(members map[string]bool, byUser map[string]*usageSum) usageSum {
+	var spent usageSum
+	for member := range members {
+		if s := byUser[member]; s != nil {
+			spent.answers += s.answers
+			spent.tokens += s.tokens
+			spent.cost += s.cost
+		}
+	}
+	return spent
+}
+
+// sortedTeams returns the user groups with a budget in order
+func (bs *budgets) sortedTeams() []string {
+	groups := make([]string, 0, len(bs.teams))
+	for group := range bs.teams {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// overridden reports whether an admin let group go over its budget in month
+func (bs *budgets) overridden(month, group string) bool {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	return bs.overrides[month+"/"+group]
+}
+
+// override lets group go over its budget in month, or holds it to it again
+func (bs *budgets) override(month, group string, over bool) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if bs.overrides == nil {
+		bs.overrides = map[string]bool{}
+	}
+	if over {
+		bs.overrides[month+"/"+group] = true
+	} else {
+		delete(bs.overrides, month+"/"+group)
+	}
+}
+
+// teamBudgetNotice returns the message telling user why their question is declined when a team they are in used
+// up its budget in month, empty when it may be answered. The leads of the teams close to their budget are warned.
+func (b *bot) teamBudgetNotice(ctx context.Context, api *slack.Client, month, when, user string, byUser map[string]*usageSum) string {
+	for _, group := range b.budgets.sortedTeams() {
+		budget := b.budgets.teams[group]
+		members, err := b.budgets.groups.membersOf(ctx, api, group)
+		if err != nil {
+			b.logger.Printf("failed looking up the members of %s: %v\n", group, err)
+		}
+		if !members[user] {
+			continue
+		}
+		spent := teamSpend(members, byUser)
+		share := budget.share(spent)
+		if share >= 1 && !b.budgets.overridden(month, group) {
+			text := fmt.Sprintf("The budget of <!subteam^%s> for this month, %v, is used up: %v. Questions of its members "+
+				"are declined until %s, unless an admin runs `%s override %s`.", group, budget.Budget, spent, when, budgetCommand, group)
+			b.alertBudget(ctx, api, month, "subteam^"+group, text)
+			b.tellLeads(ctx, api, month, "used up/"+group, budget.Leads, ":money_with_wings: "+text)
+			return fmt.Sprintf("Sorry, your team <!subteam^%s> has used up this month's budget for answers. I can answer "+
+				"you again on %s, or an admin can let the team go over it.", group, when)
+		}
+		if budget.Warn > 0 && share >= budget.Warn {
+			b.tellLeads(ctx, api, month, "warned/"+group, budget.Leads, fmt.Sprintf(":warning: <!subteam^%s> has used "+
+				"%.0f%% of its budget for this month, %v: %v.", group, share*100, budget.Budget, spent))
+		}
+	}
+	return ""
+}
+
+// tellLeads DMs text to the leads of a team, once per key in month
+func (b *bot) tellLeads(ctx context.Context, api *slack.Client, month, key string, leads []string, text string) {
+	if !b.budgets.firstAlert(month, key) {
+		return
+	}
+	b.logger.Printf("telling the leads of %v in %v\n", key, month)
+	for _, lead := range leads {
+		if _, _, err := api.PostMessageContext(ctx, lead, slack.MsgOptionText(text, false)); err != nil {
+			b.logger.Printf("failed telling %s about the team budget: %v\n", lead, err)
+		}
+	}
+}
+
+// subteamMention matches a user group as slack escapes it in slash commands, e.g. <!subteam^S0123ABCD|@support>
+var subteamMention = regexp.MustCompile(`^<!subteam\^([A-Z0-9]+)(?:\|[^>]*)?>$`)
+
+// answerBudgetCommand shows admins what the teams spent of their budgets this month, the default, and overrides
+// or restores the budget of a team
+func (b *bot) answerBudgetCommand(ctx context.Context, api *slack.Client, cmd *slack.SlashCommand) {
+	if b.budgets == nil || len(b.budgets.teams) == 0 || b.usage == nil || !b.admins[cmd.UserID] {
+		b.respond(ctx, cmd, completion{note: "Only admins can see the team budgets, when there are any."}, slack.ResponseTypeEphemeral)
+		return
+	}
+	inv, err := b.aliases.Parse(budgetSpec, cmd.Text)
+	group := ""
+	if err == nil && inv.Command != budgetSpec && inv.Command.Name != "list" && !inv.Help {
+		if len(inv.Args) == 1 {
+			group = inv.Args[0]
+			if m := subteamMention.FindStringSubmatch(group); m != nil {
+				group = m[1]
+			}
+		}
+		if _, ok := b.budgets.teams[group]; !ok {
+			err = fmt.Errorf("`%s` needs one of the user groups with a budget", strings.Join(inv.Path, " "))
+		}
+	}
+	if err != nil {
+		b.respond(ctx, cmd, completion{note: err.Error() + "\n" + inv.UsageText()}, slack.ResponseTypeEphemeral)
+		return
+	}
+	if inv.Help {
+		b.respond(ctx, cmd, completion{note: inv.UsageText()}, slack.ResponseTypeEphemeral)
+		return
+	}
+	month := time.Now().UTC().Format(usageMonth)
+	switch inv.Command.Name {
+	case "override":
+		b.budgets.override(month, group, true)
+		b.logger.Printf("%s let %s go over its budget in %s\n", cmd.UserID, group, month)
+		b.respond(ctx, cmd, completion{note: fmt.Sprintf("<!subteam^%s> can ask again until the end of the month.", group)}, slack.ResponseTypeEphemeral)
+	case "restore":
+		b.budgets.override(month, group, false)
+		b.logger.Printf("%s held %s to its budget in %s again\n", cmd.UserID, group, month)
+		b.respond(ctx, cmd, completion{note: fmt.Sprintf("<!subteam^%s> is held to its budget again.", group)}, slack.ResponseTypeEphemeral)
+	default:
+		b.respond(ctx, cmd, completion{note: b.teamBudgetReport(ctx, api, month)}, slack.ResponseTypeEphemeral)
+	}
+}
+
+// teamBudgetReport lists the budget of every team and what its members spent of it in month
+func (b *bot) teamBudgetReport(ctx context.Context, api *slack.Client, month string) string {
+	byUser := map[string]*usageSum{}
+	for _, t := range b.usage.store.Month(month) {
+		s := entry(byUser, t.User)
+		s.answers += t.Answers
+		s.tokens += t.PromptTokens + t.CompletionTokens
+		s.cost += t.Cost
+	}
+	at, _ := time.Parse(usageMonth, month)
+	lines := []string{"*Team budgets in " + at.Format("January 2006") + "*"}
+	for _, group := range b.budgets.sortedTeams() {
+		budget := b.budgets.teams[group]
+		members, err := b.budgets.groups.membersOf(ctx, api, group)
+		if err != nil {
+			b.logger.Printf("failed looking up the members of %s: %v\n", group, err)
+		}
+		spent := teamSpend(members, byUser)
+		line := fmt.Sprintf("• <!subteam^%s>: %v of %v (%.0f%%)", group, spent, budget.Budget, budget.share(spent)*100)
+		if b.budgets.overridden(month, group) {
+			line += ", _overridden_"
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
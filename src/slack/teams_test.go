@@ -0,0 +1,77 @@
+package slackhandler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTeamBudgets(t *testing.T) {
+	store, _ := NewUsageStore("")
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{
+		Usage:      store,
+		AdminUsers: []string{"U0ADMIN"},
+		TeamBudgets: map[string]TeamBudget{
+			"S0SUPPORT": {Budget: Budget{Tokens: 1000}, Warn: 0.5, Leads: []string{"U0LEAD"}},
+		},
+	})
+	slackServer.AddUserGroup("S0SUPPORT", "support", "Support", "U1", "U2")
+	ctx := context.Background()
+	month := time.Now().UTC().Format(usageMonth)
+	ask := func(ts string) {
+		b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: "C1", TimeStamp: ts})
+	}
+
+	require.NoError(t, store.Add(UsageTotal{Month: month, User: "U2", Channel: "C2", Model: "gpt-4o", Answers: 1, PromptTokens: 600}))
+	ask("1.000001")
+	messages := slackServer.Messages()
+	require.Len(t, messages, 2, "the lead is warned and the question answered")
+	assert.Equal(t, "U0LEAD", messages[0].Channel)
+	assert.Contains(t, messages[0].Text, "has used 60% of its budget")
+	assert.Contains(t, messages[1].Text, "fake answer to: what is go")
+
+	require.NoError(t, store.Add(UsageTotal{Month: month, User: "U1", Channel: "C1", Model: "gpt-4o", Answers: 1, PromptTokens: 400}))
+	ask("2.000001")
+	ask("3.000001")
+	messages = slackServer.Messages()
+	require.Len(t, messages, 3, "the lead is told once that the budget is used up")
+	assert.Equal(t, "U0LEAD", messages[2].Channel)
+	assert.Contains(t, messages[2].Text, "/gpt-budget override S0SUPPORT")
+	ephemerals := slackServer.Ephemerals()
+	require.Len(t, ephemerals, 2)
+	assert.Contains(t, ephemerals[0].Text, "your team <!subteam^S0SUPPORT> has used up this month's budget")
+
+	var responses []slack.WebhookMessage
+	responseServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg slack.WebhookMessage
+		_ = json.NewDecoder(r.Body).Decode(&msg)
+		responses = append(responses, msg)
+	}))
+	defer responseServer.Close()
+	budget := func(user, text string) string {
+		b.handleSlashCommand(ctx, api, &slack.SlashCommand{Command: budgetCommand, Text: text, UserID: user, ChannelID: "C1", ResponseURL: responseServer.URL})
+		require.NotEmpty(t, responses)
+		return responses[len(responses)-1].Text
+	}
+	assert.Contains(t, budget("U1", "list"), "Only admins")
+	assert.Contains(t, budget("U0ADMIN", "override S0OTHER"), "needs one of the user groups with a budget")
+	assert.Contains(t, budget("U0ADMIN", "override <!subteam^S0SUPPORT|@support>"), "can ask again")
+	ask("4.000001")
+	messages = slackServer.Messages()
+	require.Len(t, messages, 4, "overridden teams are answered")
+	assert.Contains(t, messages[3].Text, "fake answer to: what is go")
+
+	report := budget("U0ADMIN", "")
+	assert.Contains(t, report, "<!subteam^S0SUPPORT>")
+	assert.Contains(t, report, "_overridden_")
+	assert.Contains(t, budget("U0ADMIN", "restore S0SUPPORT"), "held to its budget again")
+	ask("5.000001")
+	assert.Len(t, slackServer.Ephemerals(), 3)
+}
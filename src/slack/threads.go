@@ -0,0 +1,88 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"strings"
+)
+
+const (
+	// maxThreadMessages is the most thread messages sent to chat-gpt, older ones are left out
+	maxThreadMessages = 40
+	// maxThreadFetch is the most thread messages read from slack, so huge threads cannot stall an answer
+	maxThreadFetch = 1000
+)
+
+// threadHistory reads the thread threadTS in channel up to and including the question at questionTS as chat
+// messages, the bot's own messages becoming assistant messages, leaving out those before the thread was last
+// reset. It reports false when the thread cannot be read, e.g. without the channels:history scope.
+func (b *bot) threadHistory(ctx context.Context, api *slack.Client, channel, threadTS, questionTS string) ([]openai.ChatCompletionMessage, bool) {
+	params := &slack.GetConversationRepliesParameters{
+		ChannelID: channel,
+		Timestamp: threadTS,
+		Latest:    questionTS,
+		Inclusive: true,
+		Limit:     200,
+	}
+	thread, err := fetchThread(ctx, api, params)
+	if err != nil {
+		b.logger.Printf("failed reading thread %v in %v: %v\n", threadTS, channel, err)
+		return nil, false
+	}
+
+	history := b.threadChat(ctx, api, b.afterReset(ConversationKey(channel, threadTS), thread))
+	if len(history) > maxThreadMessages {
+		history = history[len(history)-maxThreadMessages:]
+	}
+	return history, len(history) > 0
+}
+
+// threadChat turns the messages of thread into chat messages named by their author, the bot's own becoming
+// assistant messages
+func (b *bot) threadChat(ctx context.Context, api *slack.Client, thread []slack.Message) []openai.ChatCompletionMessage {
+	selfUser, selfBot, _ := b.self.get(ctx, api)
+	var chat []openai.ChatCompletionMessage
+	for _, m := range thread {
+		var message openai.ChatCompletionMessage
+		switch {
+		case m.User == selfUser && selfUser != "" || m.BotID == selfBot && selfBot != "":
+			message = openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: unformatResponse(m.Text)}
+		case m.BotID != "":
+			message = openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Name: m.BotID, Content: b.prompt(ctx, api, m.Text)}
+		default:
+			message = openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Name: m.User, Content: b.prompt(ctx, api, m.Text)}
+		}
+		if message.Content != "" {
+			chat = append(chat, message)
+		}
+	}
+	return chat
+}
+
+// fetchThread reads the messages of the thread params asks for, page by page up to maxThreadFetch of them
+func fetchThread(ctx context.Context, api *slack.Client, params *slack.GetConversationRepliesParameters) ([]slack.Message, error) {
+	var thread []slack.Message
+	for {
+		page, hasMore, cursor, err := api.GetConversationRepliesContext(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		thread = append(thread, page...)
+		if !hasMore || cursor == "" || len(thread) >= maxThreadFetch {
+			return thread, nil
+		}
+		params.Cursor = cursor
+	}
+}
+
+// unformatResponse recovers the chat-gpt answer from a reply posted by the bot, dropping any note above
+// the code block formatResponse wrapped it in
+func unformatResponse(text string) string {
+	start, end := strings.Index(text, "```"), strings.LastIndex(text, "```")
+	if start >= 0 && end > start {
+		text = text[start+3 : end]
+		text = strings.ReplaceAll(text, zeroWidthSpace, "")
+	}
+	return strings.TrimSpace(entityUnescaper.Replace(text))
+}
@@ -0,0 +1,69 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestTurns(t *testing.T) {
+	user, assistant := openai.ChatMessageRoleUser, openai.ChatMessageRoleAssistant
+	roles := func(messages []openai.ChatCompletionMessage) []string {
+		var r []string
+		for _, m := range messages {
+			r = append(r, m.Role)
+		}
+		return r
+	}
+	assert.Equal(t, []string{user, assistant, user}, roles(turns([]string{"q1", "a1", "q2"}, user)))
+	// the store dropped the first question to make room
+	assert.Equal(t, []string{assistant, user, assistant, user}, roles(turns([]string{"a1", "q2", "a2", "q3"}, user)))
+	assert.Equal(t, []string{user, assistant}, roles(turns([]string{"q1", "a1"}, assistant)))
+	assert.Empty(t, turns(nil, user))
+}
+
+func TestUnformatResponse(t *testing.T) {
+	assert.Equal(t, "a <b> & `c`", unformatResponse(formatResponse("a <b> & `c`")))
+	assert.Equal(t, "a```b", unformatResponse(formatResponse("a```b")))
+	assert.Equal(t, "go", unformatResponse("_not sure_\n"+formatResponse("go")))
+	assert.Equal(t, "Done. Conversation history cleared.", unformatResponse("Done. Conversation history cleared."))
+}
+
+func TestThreadHistory(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{MentionMode: MentionResolve})
+	ctx := context.Background()
+	// a thread the bot was not part of until it is mentioned
+	slackServer.AddMessage(fake.Message{Channel: "C1", User: "U1", Text: "the build is red", TS: "1.000001"})
+	slackServer.AddMessage(fake.Message{Channel: "C1", User: "U2", Text: "since the go upgrade", TS: "1.000002", ThreadTS: "1.000001"})
+	question := slackServer.AddMessage(fake.Message{Channel: "C1", User: "U1", Text: "<@U0BOT> any idea?", ThreadTS: "1.000001"})
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{
+		User: "U1", Text: question.Text, Channel: "C1", TimeStamp: question.TS, ThreadTimeStamp: "1.000001",
+	})
+	history, ok := b.threadHistory(ctx, api, "C1", "1.000001", question.TS)
+	require.True(t, ok)
+	assert.Equal(t, []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Name: "U1", Content: "the build is red"},
+		{Role: openai.ChatMessageRoleUser, Name: "U2", Content: "since the go upgrade"},
+		{Role: openai.ChatMessageRoleUser, Name: "U1", Content: "any idea?"},
+	}, history)
+
+	// the answer becomes part of the thread for the follow-up
+	followUp := slackServer.AddMessage(fake.Message{Channel: "C1", User: "U2", Text: "<@U0BOT> and now?", ThreadTS: "1.000001"})
+	history, ok = b.threadHistory(ctx, api, "C1", "1.000001", followUp.TS)
+	require.True(t, ok)
+	require.Len(t, history, 5)
+	assert.Equal(t, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "fake answer to: any idea?"}, history[3])
+	assert.Equal(t, "and now?", history[4].Content)
+}
+
+func TestThreadHistory_Unreadable(t *testing.T) {
+	b, api, _ := newFakeBot(t, EventHandlerArgs{})
+	// an empty or unreadable thread falls back to the stored conversation
+	_, ok := b.threadHistory(context.Background(), api, "C9", "1.000001", "1.000002")
+	assert.False(t, ok)
+}
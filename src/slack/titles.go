@@ -0,0 +1,100 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/cache"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/sashabaranov/go-openai"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxTitleLength is the most characters kept of a generated thread title
+const maxTitleLength = 100
+
+// ThreadTitle names a thread the bot answered in so the conversation can be found again
+type ThreadTitle struct {
+	Channel  string
+	ThreadTS string
+	// User asked the question the thread was titled after
+	User    string
+	Title   string
+	Created time.Time
+}
+
+// titles stores thread titles by conversation key
+type titles struct {
+	data *cache.LRU[ThreadTitle]
+}
+
+// newTitles creates a title store holding at most maxEntries titles, 0 disables the bound
+func newTitles(maxEntries int) *titles {
+	return &titles{data: cache.NewLRU[ThreadTitle]("thread_titles", maxEntries, 0, nil)}
+}
+
+// Get returns the title of the thread with conversation key
+func (t *titles) Get(key string) (ThreadTitle, bool) {
+	return t.data.Get(key)
+}
+
+// Set stores the title of the thread with conversation key
+func (t *titles) Set(key string, title ThreadTitle) {
+	t.data.Set(key, title)
+}
+
+// List returns the titles of the threads user asked in, newest first
+func (t *titles) List(user string) []ThreadTitle {
+	return t.Search(user, "")
+}
+
+// Search returns the titles of the threads user asked in that contain every word of query regardless of
+// case, newest first
+func (t *titles) Search(user, query string) []ThreadTitle {
+	words := strings.Fields(strings.ToLower(query))
+	var found []ThreadTitle
+	t.data.Range(func(_ string, title ThreadTitle) {
+		if title.User != user {
+			return
+		}
+		lower := strings.ToLower(title.Title)
+		for _, word := range words {
+			if !strings.Contains(lower, word) {
+				return
+			}
+		}
+		found = append(found, title)
+	})
+	sort.SliceStable(found, func(i, j int) bool { return found[i].Created.After(found[j].Created) })
+	return found
+}
+
+// Stats reports the size and effectiveness of the title store
+func (t *titles) Stats() cache.Stats {
+	return t.data.Stats()
+}
+
+// titleThread titles the thread with conversation key after its first exchange, history and answer.
+// Threads that already have a title keep it.
+func (b *bot) titleThread(ctx context.Context, key, channel, threadTS, user string, history []openai.ChatCompletionMessage, answer string) {
+	if b.titles == nil {
+		return
+	}
+	if _, ok := b.titles.Get(key); ok {
+		return
+	}
+	exchange := append(history[:len(history):len(history)], openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: answer})
+	title, err := chatgpt.GetTitle(b.gptClient, ctx, exchange)
+	if err != nil {
+		b.logger.Printf("failed titling thread %v in %v: %v\n", threadTS, channel, err)
+		return
+	}
+	if runes := []rune(title); len(runes) > maxTitleLength {
+		title = strings.TrimSpace(string(runes[:maxTitleLength-1])) + "…"
+	}
+	if title == "" {
+		return
+	}
+	b.titles.Set(key, ThreadTitle{Channel: channel, ThreadTS: threadTS, User: user, Title: title, Created: time.Now()})
+	b.logger.Printf("titled thread %v in %v: %q\n", threadTS, channel, title)
+}
@@ -0,0 +1,49 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestTitles_Search(t *testing.T) {
+	titles := newTitles(0)
+	now := time.Now()
+	titles.Set("1C1", ThreadTitle{Channel: "C1", ThreadTS: "1", User: "U1", Title: "Resetting the VPN client", Created: now.Add(-time.Hour)})
+	titles.Set("2C1", ThreadTitle{Channel: "C1", ThreadTS: "2", User: "U1", Title: "VPN drops on wifi", Created: now})
+	titles.Set("3C1", ThreadTitle{Channel: "C1", ThreadTS: "3", User: "U2", Title: "VPN access request", Created: now})
+
+	threads := func(found []ThreadTitle) []string {
+		var ts []string
+		for _, title := range found {
+			ts = append(ts, title.ThreadTS)
+		}
+		return ts
+	}
+	assert.Equal(t, []string{"2", "1"}, threads(titles.List("U1")))
+	assert.Equal(t, []string{"2", "1"}, threads(titles.Search("U1", "vpn")))
+	assert.Equal(t, []string{"1"}, threads(titles.Search("U1", "vpn RESET")))
+	assert.Empty(t, titles.Search("U1", "printer"))
+	assert.Equal(t, []string{"3"}, threads(titles.List("U2")))
+}
+
+func TestTitleThread(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{TitleThreads: true})
+	ctx := context.Background()
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "how do I reset my vpn", Channel: "C1", TimeStamp: "1.000001"})
+	title, ok := b.titles.Get("1.000001C1")
+	require.True(t, ok)
+	// the fake openai server echoes the transcript it was asked to title
+	assert.Contains(t, title.Title, "how do I reset my vpn")
+	assert.LessOrEqual(t, len([]rune(title.Title)), maxTitleLength)
+	assert.Equal(t, ThreadTitle{Channel: "C1", ThreadTS: "1.000001", User: "U1", Title: title.Title, Created: title.Created}, title)
+
+	// follow-ups keep the first title
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U2", Text: "and my printer?", Channel: "C1", TimeStamp: "1.000002", ThreadTimeStamp: "1.000001"})
+	again, _ := b.titles.Get("1.000001C1")
+	assert.Equal(t, title, again)
+	assert.Len(t, slackServer.Messages(), 2)
+}
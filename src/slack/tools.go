@@ -0,0 +1,103 @@
+package slackhandler
+
+import (
+	"context"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/slack-go/slack"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// slackUserTool is the name of the built-in tool looking slack users up, created for each workspace's client
+const slackUserTool = "slack_user"
+
+// userIDPattern matches a user ID, alone or as a mention
+var userIDPattern = regexp.MustCompile(`^<?@?([UW][A-Z0-9]+)(?:\|[^>]*)?>?$`)
+
+// tools are the tools the model may call while answering besides the directory's: the Go functions registered
+// in the toolbox, and whether slack users are looked up
+type tools struct {
+	toolbox    *chatgpt.Toolbox
+	slackUsers bool
+}
+
+// newTools registers the built-in tools named builtin, then custom. Tools that cannot be registered are logged
+// and left out.
+func newTools(builtin []string, custom []chatgpt.Tool, logger *log.Logger) *tools {
+	t := &tools{}
+	var registered []chatgpt.Tool
+	for _, name := range builtin {
+		switch name {
+		case "current_time":
+			registered = append(registered, chatgpt.TimeTool(time.Now))
+		case "calculate":
+			registered = append(registered, chatgpt.MathTool())
+		case slackUserTool:
+			t.slackUsers = true
+		default:
+			logger.Printf("unknown tool %q left out, the built-in tools are current_time, calculate and %s\n", name, slackUserTool)
+		}
+	}
+	t.toolbox, _ = chatgpt.NewToolbox()
+	for _, tool := range append(registered, custom...) {
+		if tool.Definition.Name == slackUserTool {
+			logger.Printf("tool %s left out: the name is taken by a built-in tool\n", slackUserTool)
+			continue
+		}
+		if err := t.toolbox.Register(tool); err != nil {
+			logger.Printf("tool left out: %v\n", err)
+		}
+	}
+	return t
+}
+
+// names returns the names of the tools the model may call
+func (t *tools) names() []string {
+	names := t.toolbox.Names()
+	if t.slackUsers {
+		names = append(names, slackUserTool)
+	}
+	return names
+}
+
+// forClient returns the tools the model may call, reading slack through api
+func (t *tools) forClient(api *slack.Client) []chatgpt.Tool {
+	tools := t.toolbox.Tools()
+	if t.slackUsers {
+		tools = append(tools, directoryTool(slackUserTool, "Looks up a Slack user by ID, such as U0123 or <@U0123> in a message: their name, title, time zone and local time.",
+			"user", "a user ID or mention, e.g. \"U0123\"",
+			func(ctx context.Context, user string) (string, error) { return lookUpUser(ctx, api, user) }))
+	}
+	return tools
+}
+
+// lookUpUser describes the slack user with the ID or mention user to the model
+func lookUpUser(ctx context.Context, api *slack.Client, user string) (string, error) {
+	match := userIDPattern.FindStringSubmatch(strings.TrimSpace(user))
+	if match == nil {
+		return "", fmt.Errorf("%q is no user ID, look people up by name with find_people when it is available", user)
+	}
+	info, err := api.GetUserInfoContext(ctx, match[1])
+	if err != nil {
+		return "", fmt.Errorf("looking up %s: %w", match[1], err)
+	}
+	lines := []string{describeUser(*info)}
+	if info.TZ != "" {
+		lines = append(lines, "Time zone: "+info.TZ)
+		if loc, err := time.LoadLocation(info.TZ); err == nil {
+			lines = append(lines, "Local time: "+time.Now().In(loc).Format("Mon 15:04"))
+		}
+	}
+	switch {
+	case info.Deleted:
+		lines = append(lines, "Deactivated")
+	case info.IsBot:
+		lines = append(lines, "A bot")
+	case info.IsAdmin || info.IsOwner:
+		lines = append(lines, "A workspace admin")
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,51 @@
+package slackhandler
+
+import (
+	"bytes"
+	"context"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log"
+	"testing"
+)
+
+func TestTools(t *testing.T) {
+	api, _ := newDirectorySlack(t)
+	var buf bytes.Buffer
+	echo := chatgpt.Func("echo", "echoes its text", map[string]any{"type": "object"},
+		func(_ context.Context, args struct{ Text string }) (string, error) { return args.Text, nil })
+	taken := chatgpt.Func(slackUserTool, "", nil, func(context.Context, struct{}) (string, error) { return "", nil })
+	tools := newTools([]string{"current_time", "calculate", slackUserTool, "weather"}, []chatgpt.Tool{echo, taken}, log.New(&buf, "", 0))
+	assert.Equal(t, []string{"current_time", "calculate", "echo", slackUserTool}, tools.names())
+	assert.Contains(t, buf.String(), `unknown tool "weather" left out`)
+	assert.Contains(t, buf.String(), "tool slack_user left out: the name is taken by a built-in tool")
+
+	calls := map[string]chatgpt.Tool{}
+	for _, tool := range tools.forClient(api) {
+		calls[tool.Definition.Name] = tool
+	}
+	require.Len(t, calls, 4)
+	user, err := calls[slackUserTool].Call(context.Background(), `{"user": "<@U2>"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "<@U2> Grace Hopper, Data Engineer", user)
+	_, err = calls[slackUserTool].Call(context.Background(), `{"user": "Grace"}`)
+	assert.ErrorContains(t, err, `"Grace" is no user ID`)
+	sum, err := calls["calculate"].Call(context.Background(), `{"expression": "2 + 2"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "4", sum)
+}
+
+func TestToolsOffered(t *testing.T) {
+	b, api, _ := newFakeBot(t, EventHandlerArgs{BuiltinTools: []string{"current_time", slackUserTool}})
+	model := &paramsModel{}
+	b.gptClient = model
+	b.answerMention(context.Background(), api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what time is it?", Channel: "C1", TimeStamp: "1.000001"})
+	var offered []string
+	for _, tool := range model.last().Tools {
+		offered = append(offered, tool.Function.Name)
+	}
+	assert.Equal(t, []string{"current_time", slackUserTool}, offered)
+	assert.Contains(t, b.helpTools("C1"), "• Tools I may call while answering: `current_time`, `slack_user`")
+}
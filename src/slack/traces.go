@@ -0,0 +1,25 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/tracing"
+	"github.com/slack-go/slack/socketmode"
+)
+
+// traceEvent starts the span of handling evt, the root of the trace the model's requests and the replies posted
+// are traced under
+func (b *bot) traceEvent(ctx context.Context, evt *socketmode.Event) (context.Context, *tracing.Span) {
+	kind := eventType(evt)
+	attrs := []tracing.Attribute{tracing.String("slack.event.type", kind)}
+	if evt.Request != nil && evt.Request.EnvelopeID != "" {
+		attrs = append(attrs, tracing.String("slack.envelope_id", evt.Request.EnvelopeID))
+	}
+	channel, user, _ := eventOrigin(evt)
+	if channel != "" {
+		attrs = append(attrs, tracing.String("slack.channel", channel))
+	}
+	if user != "" {
+		attrs = append(attrs, tracing.String("slack.user", user))
+	}
+	return b.tracer.Start(ctx, "slack "+kind, tracing.SpanKindServer, attrs...)
+}
@@ -0,0 +1,169 @@
+package slackhandler
+
+import (
+	"context"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/audio"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/chikamif/slackgpt/src/command"
+	"github.com/slack-go/slack"
+	"regexp"
+	"strings"
+)
+
+const (
+	// maxClips is the most clips of a message transcribed at once
+	maxClips = 3
+	// maxTranscriptText is the longest transcript posted as a message, longer ones are uploaded as a snippet
+	maxTranscriptText = 3000
+)
+
+// transcribeCommandPattern matches the transcribe command, with its flags and an optional message link
+var transcribeCommandPattern = regexp.MustCompile(`(?s)^(?:<@[A-Z0-9]+>\s*)?transcribe\b\s*(.*)$`)
+
+// transcribeSpec is the syntax of the transcribe command
+var transcribeSpec = &command.Command{
+	Name:    "transcribe",
+	Args:    "[message link]",
+	Summary: "Transcribe the voice message, video or recording of the message linked, of this message or of the message this thread is about.",
+	Flags:   []command.Flag{{Name: "summary", Short: "s", Usage: "add a summary of the transcript"}},
+}
+
+// transcription transcribes clips with transcriber and model, audio.DefaultModel when it is empty
+type transcription struct {
+	transcriber audio.Transcriber
+	model       string
+}
+
+// transcribeCommand transcribes the clips a mention or direct message asks for with the transcribe command,
+// reporting whether text was the command. The clips are those of the message linked in text, of files, the
+// files of the command's own message when known, of the command's message or of the parent of its thread.
+func (b *bot) transcribeCommand(ctx context.Context, api *slack.Client, channel, threadTS, messageTS, user, text string, files []slack.File) bool {
+	if b.transcription == nil {
+		return false
+	}
+	match := transcribeCommandPattern.FindStringSubmatch(strings.TrimSpace(text))
+	if match == nil {
+		return false
+	}
+	inv, err := b.aliases.Parse(transcribeSpec, match[1])
+	var reply string
+	switch {
+	case err != nil:
+		reply = err.Error() + "\n" + inv.UsageText()
+	case inv.Help:
+		reply = inv.UsageText()
+	default:
+		clips := b.clips(ctx, api, channel, threadTS, messageTS, inv.Rest, files)
+		if len(clips) == 0 {
+			reply = "I found no voice message, video or recording to transcribe.\n" + inv.UsageText()
+			break
+		}
+		if !b.withinRateLimit(ctx, api, channel, threadTS, user) {
+			return true
+		}
+		b.postTranscripts(ctx, api, channel, threadTS, clips, inv.Has("summary"))
+		return true
+	}
+	options := []slack.MsgOption{slack.MsgOptionText(reply, false)}
+	if threadTS != "" {
+		options = append(options, slack.MsgOptionTS(threadTS))
+	}
+	if _, _, err := api.PostMessageContext(ctx, channel, options...); err != nil {
+		b.logger.Printf("failed answering transcribe command: %v\n", err)
+	}
+	return true
+}
+
+// clips returns the clips the transcribe command asks for: those of the message linked in args, else of files
+// or the command's message messageTS, else of the parent of the thread threadTS
+func (b *bot) clips(ctx context.Context, api *slack.Client, channel, threadTS, messageTS, args string, files []slack.File) []slack.File {
+	if link := messageLinkPattern.FindStringSubmatch(args); link != nil {
+		ts := link[2] + "." + link[3]
+		return onlyClips(b.attachedFiles(ctx, api, link[1], ts, ts))
+	}
+	if files == nil {
+		files = b.attachedFiles(ctx, api, channel, threadTS, messageTS)
+	}
+	if clips := onlyClips(files); len(clips) > 0 || threadTS == "" || threadTS == messageTS {
+		return clips
+	}
+	return onlyClips(b.attachedFiles(ctx, api, channel, threadTS, threadTS))
+}
+
+// onlyClips returns the audio and video clips among files, at most maxClips of them
+func onlyClips(files []slack.File) []slack.File {
+	var clips []slack.File
+	for _, file := range files {
+		if audio.IsClip(file) && len(clips) < maxClips {
+			clips = append(clips, file)
+		}
+	}
+	return clips
+}
+
+// postTranscripts transcribes clips and posts the transcripts in channel, in the thread threadTS when it is
+// not empty, with a summary of them when summarize is set and the action items of the summary when they are tracked
+func (b *bot) postTranscripts(ctx context.Context, api *slack.Client, channel, threadTS string, clips []slack.File, summarize bool) {
+	var transcripts []string
+	var text strings.Builder
+	for _, clip := range clips {
+		name := clip.Title
+		if name == "" {
+			name = clip.Name
+		}
+		fmt.Fprintf(&text, "*Transcript of %s:*\n", slackEscaper.Replace(name))
+		data, err := audio.Download(ctx, api, clip)
+		if err == nil {
+			var transcript string
+			if transcript, err = audio.Transcribe(ctx, b.transcription.transcriber, b.transcription.model, clip.Name, data); err == nil {
+				transcripts = append(transcripts, transcript)
+				text.WriteString(slackEscaper.Replace(transcript) + "\n")
+				continue
+			}
+		}
+		b.logger.Printf("failed transcribing %v: %v\n", clip.ID, err)
+		b.reportIncident(ctx, api, channel, err)
+		text.WriteString("_I could not transcribe this one._\n")
+	}
+	var summary string
+	if summarize && len(transcripts) > 0 {
+		answer, err := chatgpt.GetTranscriptSummary(b.gptClient, ctx, strings.Join(transcripts, "\n\n"))
+		if err != nil {
+			b.logger.Printf("failed summarizing transcript: %v\n", err)
+			answer = troubleAnswer(err)
+		} else {
+			// the action items are posted after the summary they come from
+			defer b.trackActionItems(ctx, api, channel, threadTS, answer)
+		}
+		summary = "*Summary:*\n" + formatResponse(answer)
+	}
+
+	if text.Len() <= maxTranscriptText {
+		options := []slack.MsgOption{slack.MsgOptionText(strings.TrimSuffix(text.String()+summary, "\n"), false)}
+		if threadTS != "" {
+			options = append(options, slack.MsgOptionTS(threadTS))
+		}
+		if _, _, err := api.PostMessageContext(ctx, channel, options...); err != nil {
+			b.logger.Printf("failed posting transcript: %v\n", err)
+		}
+		return
+	}
+	// long transcripts are easier to read and search as a snippet
+	comment := "Here is the transcript."
+	if summary != "" {
+		comment = summary
+	}
+	_, err := api.UploadFileContext(ctx, slack.FileUploadParameters{
+		Content:         text.String(),
+		Filename:        "transcript.txt",
+		Filetype:        "text",
+		Title:           "Transcript",
+		InitialComment:  comment,
+		Channels:        []string{channel},
+		ThreadTimestamp: threadTS,
+	})
+	if err != nil {
+		b.logger.Printf("failed uploading transcript: %v\n", err)
+	}
+}
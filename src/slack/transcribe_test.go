@@ -0,0 +1,64 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestTranscribeCommand(t *testing.T) {
+	ctx := context.Background()
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{Transcribe: true})
+	// the fake transcribes a clip as its content
+	clip := slackServer.AddMessage(fake.Message{Channel: "C1", User: "U1", Files: []fake.File{
+		{Filename: "audio_message.webm", Mimetype: "audio/webm", Content: []byte("we ship on friday")},
+		{Filename: "notes.txt", Mimetype: "text/plain", Content: []byte("notes")},
+	}})
+	mention := func(text, threadTS string) []fake.Message {
+		before := len(slackServer.Messages())
+		ev := &slackevents.AppMentionEvent{User: "U1", Text: text, Channel: "C1", ThreadTimeStamp: threadTS}
+		ev.TimeStamp = slackServer.AddMessage(fake.Message{Channel: "C1", User: "U1", ThreadTS: threadTS, Text: text}).TS
+		b.answerMention(ctx, api, ev)
+		var replies []fake.Message
+		for _, m := range slackServer.Messages()[before+1:] {
+			if m.User == "" {
+				replies = append(replies, m)
+			}
+		}
+		return replies
+	}
+
+	replies := mention("<@U0BOT> transcribe --summary", clip.TS)
+	require.Len(t, replies, 1)
+	assert.Equal(t, clip.TS, replies[0].ThreadTS)
+	assert.True(t, strings.HasPrefix(replies[0].Text, "*Transcript of audio_message.webm:*\nwe ship on friday\n*Summary:*\n```fake answer to: "), replies[0].Text)
+
+	replies = mention("<@U0BOT> transcribe", "")
+	require.Len(t, replies, 1)
+	assert.Equal(t, "I found no voice message, video or recording to transcribe.\n"+transcribeSpec.Help(), replies[0].Text)
+
+	replies = mention("<@U0BOT> transcribe --loud", clip.TS)
+	require.Len(t, replies, 1)
+	assert.Equal(t, "unknown flag `--loud`\n"+transcribeSpec.Help(), replies[0].Text)
+
+	long := slackServer.AddMessage(fake.Message{Channel: "C1", User: "U1", Files: []fake.File{
+		{Filename: "huddle.mp4", Mimetype: "video/mp4", Content: []byte(strings.Repeat("and then ", maxTranscriptText/9+1))},
+	}})
+	replies = mention("<@U0BOT> transcribe https://acme.slack.com/archives/C1/p"+strings.ReplaceAll(long.TS, ".", ""), "")
+	assert.Empty(t, replies, "long transcripts are uploaded")
+	files := slackServer.Files()
+	require.Len(t, files, 1)
+	assert.Equal(t, "transcript.txt", files[0].Filename)
+	assert.Contains(t, string(files[0].Content), "*Transcript of huddle.mp4:*\nand then")
+
+	dm := slackServer.AddMessage(fake.Message{Channel: "D1", User: "U1", Text: "transcribe", Files: []fake.File{{Filename: "clip.m4a", Mimetype: "audio/mp4", Content: []byte("hello")}}})
+	url := strings.TrimSuffix(slackServer.APIURL(), "/api/") + "/files/" + dm.TS + "/0"
+	b.answerMessage(ctx, api, &slackevents.MessageEvent{User: "U1", Text: dm.Text, Channel: "D1", ChannelType: "im", TimeStamp: dm.TS, SubType: "file_share",
+		Files: []slackevents.File{{ID: "F1", Name: "clip.m4a", Mimetype: "audio/mp4", URLPrivateDownload: url}}})
+	messages := slackServer.Messages()
+	assert.Equal(t, "*Transcript of clip.m4a:*\nhello", messages[len(messages)-1].Text)
+}
@@ -0,0 +1,43 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/sashabaranov/go-openai"
+)
+
+// pipeline is what a question is answered with besides the conversation
+type pipeline struct {
+	// grounded questions are answered from the knowledge base and bookmarks of their channel
+	grounded bool
+	// tools lets the model call tools, such as looking people and owners up
+	tools bool
+}
+
+// fullPipeline answers questions that were not triaged with everything enabled
+var fullPipeline = pipeline{grounded: true, tools: true}
+
+// pipelines are the pipelines of the tasks questions are triaged as, cutting the tokens trivial questions cost
+var pipelines = map[chatgpt.Task]pipeline{
+	chatgpt.TaskSmalltalk: {},
+	chatgpt.TaskCode:      {},
+	chatgpt.TaskDocument:  {grounded: true},
+	chatgpt.TaskTools:     fullPipeline,
+	chatgpt.TaskChat:      fullPipeline,
+}
+
+// triage asks the triage model which task the last question of history is and returns it with its pipeline.
+// Questions are not triaged without a triage model, or when it fails, and get an empty task, classified by
+// the model routes themselves, and the full pipeline.
+func (b *bot) triage(ctx context.Context, channel string, history []openai.ChatCompletionMessage) (chatgpt.Task, pipeline) {
+	if b.triageModel == "" {
+		return "", fullPipeline
+	}
+	task, err := chatgpt.GetTask(b.gptClient, ctx, history, chatgpt.WithModel(b.triageModel))
+	if err != nil {
+		b.logger.Printf("failed triaging the question in %v: %v\n", channel, err)
+		return "", fullPipeline
+	}
+	b.logger.Printf("question in %v triaged as %v\n", channel, task)
+	return task, pipelines[task]
+}
@@ -0,0 +1,76 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// triagedModel triages questions greeting it as smalltalk and others as tools, recording the last answer request
+type triagedModel struct {
+	mu      sync.Mutex
+	triaged int
+	answer  openai.ChatCompletionRequest
+}
+
+func (m *triagedModel) CreateChatCompletion(_ context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	last := req.Messages[len(req.Messages)-1].Content
+	reply := "an answer"
+	if req.Model == "gpt-4o-mini" && req.MaxTokens == 5 {
+		m.triaged++
+		reply = "tools"
+		if strings.Contains(last, "hello") {
+			reply = "smalltalk"
+		}
+	} else {
+		m.answer = req
+	}
+	message := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: reply}
+	return openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{Message: message}}}, nil
+}
+
+func (m *triagedModel) last() (int, openai.ChatCompletionRequest) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.triaged, m.answer
+}
+
+func TestTriage(t *testing.T) {
+	ctx := context.Background()
+	slackServer := fake.NewSlack()
+	t.Cleanup(slackServer.Close)
+	api := slack.New("xoxb-test", slack.OptionAPIURL(slackServer.APIURL()))
+	model := &triagedModel{}
+	b := newBot(EventHandlerArgs{
+		Logger: logger, GPTClient: model, TriageModel: "gpt-4o-mini", Owners: map[string]string{"billing": "<@U2>"},
+		ModelRoutes: []chatgpt.Route{{Name: "smalltalk", Task: chatgpt.TaskSmalltalk, Model: "gpt-3.5-turbo"}},
+	})
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> hello there", Channel: "C1", TimeStamp: "1.000001"})
+	triaged, answer := model.last()
+	assert.Equal(t, 1, triaged)
+	assert.Equal(t, "gpt-3.5-turbo", answer.Model, "smalltalk is routed by its task")
+	assert.Empty(t, answer.Tools, "smalltalk is answered without tools")
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> who owns billing", Channel: "C1", TimeStamp: "2.000001"})
+	triaged, answer = model.last()
+	assert.Equal(t, 2, triaged)
+	assert.Equal(t, string(chatgpt.DefaultModel), answer.Model)
+	assert.NotEmpty(t, answer.Tools)
+
+	// without a triage model, questions are answered with everything
+	b = newBot(EventHandlerArgs{Logger: logger, GPTClient: model, Owners: map[string]string{"billing": "<@U2>"}})
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> hello there", Channel: "C1", TimeStamp: "3.000001"})
+	triaged, answer = model.last()
+	assert.Equal(t, 2, triaged)
+	assert.NotEmpty(t, answer.Tools)
+}
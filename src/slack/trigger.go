@@ -0,0 +1,62 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/slack-go/slack/socketmode"
+	"strings"
+)
+
+// handleReactionEvent answers the message the reaction of evt was added to, when it is the trigger reaction
+func (b *bot) handleReactionEvent(ctx context.Context, api *slack.Client, evt *socketmode.Event) {
+	eventsAPIEvent, ok := evt.Data.(slackevents.EventsAPIEvent)
+	if !ok {
+		b.logger.Printf("Ignored %+v\n", evt)
+		return
+	}
+	ev, ok := eventsAPIEvent.InnerEvent.Data.(*slackevents.ReactionAddedEvent)
+	if !ok {
+		b.logger.Printf("Ignored %+v\n", evt)
+		return
+	}
+	b.answerReaction(ctx, api, ev)
+}
+
+// answerReaction asks chat-gpt about the message the trigger reaction was added to, as if the user who reacted
+// had mentioned the bot with the message's text in its thread. Other reactions are ignored.
+func (b *bot) answerReaction(ctx context.Context, api *slack.Client, ev *slackevents.ReactionAddedEvent) {
+	// skin tones are part of the reaction's name, e.g. raised_hand::skin-tone-2
+	reaction, _, _ := strings.Cut(ev.Reaction, "::")
+	if b.triggerReaction == "" || reaction != b.triggerReaction || ev.Item.Type != "message" {
+		return
+	}
+	channel, ts := ev.Item.Channel, ev.Item.Timestamp
+	messages, _, _, err := api.GetConversationRepliesContext(ctx, &slack.GetConversationRepliesParameters{
+		ChannelID: channel, Timestamp: ts, Latest: ts, Inclusive: true, Limit: 1,
+	})
+	if err != nil {
+		b.logger.Printf("failed reading the message reacted to in %v: %v\n", channel, err)
+		return
+	}
+	var msg *slack.Message
+	for i := range messages {
+		if messages[i].Timestamp == ts {
+			msg = &messages[i]
+		}
+	}
+	selfUser, selfBot, _ := b.self.get(ctx, api)
+	switch {
+	case msg == nil || strings.TrimSpace(msg.Text) == "":
+		b.logger.Printf("Ignored :%s: on %s in %v, no text to ask about\n", reaction, ts, channel)
+		return
+	case selfUser != "" && msg.User == selfUser || selfBot != "" && msg.BotID == selfBot:
+		b.logger.Printf("Ignored :%s: on the bot's own message %s in %v\n", reaction, ts, channel)
+		return
+	}
+	b.logger.Printf("%s reacted :%s: to %s in %v, answering it\n", ev.User, reaction, ts, channel)
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{
+		Type: string(slackevents.AppMention), User: ev.User, Text: msg.Text, TimeStamp: ts,
+		ThreadTimeStamp: msg.ThreadTimestamp, Channel: channel,
+	})
+}
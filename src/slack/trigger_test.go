@@ -0,0 +1,41 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestAnswerReaction(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{TriggerReaction: ":robot_face:"})
+	ctx := context.Background()
+	question := slackServer.AddMessage(fake.Message{Channel: "C1", User: "U2", Text: "what is go"})
+	reply := slackServer.AddMessage(fake.Message{Channel: "C1", User: "U3", Text: "and rust?", ThreadTS: question.TS})
+	react := func(reaction, ts string) {
+		b.answerReaction(ctx, api, &slackevents.ReactionAddedEvent{
+			Type: "reaction_added", User: "U1", Reaction: reaction,
+			Item: slackevents.Item{Type: "message", Channel: "C1", Timestamp: ts},
+		})
+	}
+
+	react("thumbsup", question.TS)
+	require.Len(t, slackServer.Messages(), 2, "other reactions trigger nothing")
+
+	react("robot_face::skin-tone-2", question.TS)
+	messages := slackServer.Messages()
+	require.Len(t, messages, 3)
+	assert.Contains(t, messages[2].Text, "fake answer to: what is go")
+	assert.Equal(t, question.TS, messages[2].ThreadTS, "answered in the message's thread")
+
+	react("robot_face", reply.TS)
+	messages = slackServer.Messages()
+	require.Len(t, messages, 4)
+	assert.Contains(t, messages[3].Text, "and rust?")
+	assert.Equal(t, question.TS, messages[3].ThreadTS)
+
+	react("robot_face", messages[3].TS)
+	assert.Len(t, slackServer.Messages(), 4, "the bot's own answers are not asked about")
+}
@@ -0,0 +1,318 @@
+package slackhandler
+
+import (
+	"context"
+	"fmt"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/chikamif/slackgpt/src/command"
+	"github.com/slack-go/slack"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// usageCommand shows what answers cost this month
+	usageCommand = "/gpt-usage"
+	// usageMonth is the layout of the months spend is totalled by
+	usageMonth = "2006-01"
+	// maxUsageRows is how many users and channels the usage report lists, the most expensive first
+	maxUsageRows = 10
+	// batchDiscount is the share of the price batched answers cost
+	batchDiscount = 0.5
+)
+
+// usageSpec is the syntax of usageCommand
+var usageSpec = &command.Command{
+	Name:    usageCommand,
+	Summary: "Show this month's spend on answers by user and channel, only your own unless you are an admin.",
+	Flags: []command.Flag{
+		{Name: "month", Short: "m", Value: "YYYY-MM", Usage: "an earlier month"},
+	},
+}
+
+// ModelPrice is what a model costs in US dollars per million prompt and completion tokens
+type ModelPrice struct {
+	Prompt     float64
+	Completion float64
+}
+
+// DefaultModelPrices are the list prices of the models of the hosted providers. Models served with Ollama cost
+// nothing.
+var DefaultModelPrices = map[string]ModelPrice{
+	"gpt-4o":                   {Prompt: 2.50, Completion: 10},
+	"gpt-4o-mini":              {Prompt: 0.15, Completion: 0.60},
+	"gpt-4-turbo":              {Prompt: 10, Completion: 30},
+	"gpt-4":                    {Prompt: 30, Completion: 60},
+	"gpt-3.5-turbo":            {Prompt: 0.50, Completion: 1.50},
+	"claude-3-5-sonnet-latest": {Prompt: 3, Completion: 15},
+	"claude-3-5-haiku-latest":  {Prompt: 0.80, Completion: 4},
+	"claude-3-opus-latest":     {Prompt: 15, Completion: 75},
+}
+
+// UsageTotal is the tokens a user's answers in a channel took with a model in a month, and what they cost
+type UsageTotal struct {
+	// Month is in UTC, e.g. 2024-06
+	Month            string
+	User             string
+	Channel          string
+	Model            string
+	Answers          int
+	PromptTokens     int
+	CompletionTokens int
+	// Cost is in US dollars, 0 for models without a price
+	Cost float64
+}
+
+// UsageStore keeps the tokens answers took and their cost, totalled by month, user, channel and model. With a
+// path the totals are kept in a JSON file so they survive restarts.
+type UsageStore struct {
+	mu     sync.Mutex
+	path   string
+	totals []UsageTotal
+}
+
+// NewUsageStore creates a usage store backed by the JSON file at path, which is created on the first answer if
+// it does not exist. An empty path keeps usage in memory only.
+func NewUsageStore(path string) (*UsageStore, error) {
+	s := &UsageStore{path: path}
+	if path == "" {
+		return s, nil
+	}
+	if err := loadJSON(path, &s.totals); err != nil {
+		return nil, fmt.Errorf("reading usage: %w", err)
+	}
+	return s, nil
+}
+
+// Add adds an answer taking usage to the totals. The usage is kept in memory even when saving fails.
+func (s *UsageStore) Add(total UsageTotal) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := 0
+	for ; i < len(s.totals); i++ {
+		t := s.totals[i]
+		if t.Month == total.Month && t.User == total.User && t.Channel == total.Channel && t.Model == total.Model {
+			break
+		}
+	}
+	if i == len(s.totals) {
+		s.totals = append(s.totals, UsageTotal{Month: total.Month, User: total.User, Channel: total.Channel, Model: total.Model})
+	}
+	t := &s.totals[i]
+	t.Answers += total.Answers
+	t.PromptTokens += total.PromptTokens
+	t.CompletionTokens += total.CompletionTokens
+	t.Cost += total.Cost
+	if s.path == "" {
+		return nil
+	}
+	if err := saveJSON(s.path, s.totals); err != nil {
+		return fmt.Errorf("saving usage: %w", err)
+	}
+	return nil
+}
+
+// List returns all totals, oldest month first
+func (s *UsageStore) List() []UsageTotal {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	totals := append([]UsageTotal(nil), s.totals...)
+	sort.SliceStable(totals, func(i, j int) bool { return totals[i].Month < totals[j].Month })
+	return totals
+}
+
+// Month returns the totals of month, e.g. 2024-06
+func (s *UsageStore) Month(month string) []UsageTotal {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var totals []UsageTotal
+	for _, t := range s.totals {
+		if t.Month == month {
+			totals = append(totals, t)
+		}
+	}
+	return totals
+}
+
+// usageTracking records what answers cost
+type usageTracking struct {
+	store  *UsageStore
+	prices map[string]ModelPrice
+	logger *log.Logger
+}
+
+// price returns the price of model, that of the longest priced model it is a version of, such as
+// gpt-4o-2024-08-06 of gpt-4o, reporting false when it has none
+func (u *usageTracking) price(model string) (ModelPrice, bool) {
+	if price, ok := u.prices[model]; ok {
+		return price, true
+	}
+	best := ""
+	for priced := range u.prices {
+		if strings.HasPrefix(model, priced+"-") && len(priced) > len(best) {
+			best = priced
+		}
+	}
+	price, ok := u.prices[best]
+	return price, ok
+}
+
+// record adds the tokens of an answer to user in channel to their spend, at the batch price when batched. u may
+// be nil.
+func (u *usageTracking) record(user, channel string, usage chatgpt.Usage, batched bool) {
+	if u == nil || usage.TotalTokens == 0 {
+		return
+	}
+	total := UsageTotal{
+		Month: time.Now().UTC().Format(usageMonth), User: user, Channel: channel, Model: usage.Model,
+		Answers: 1, PromptTokens: usage.PromptTokens, CompletionTokens: usage.CompletionTokens,
+	}
+	if price, ok := u.price(usage.Model); ok {
+		total.Cost = (float64(usage.PromptTokens)*price.Prompt + float64(usage.CompletionTokens)*price.Completion) / 1e6
+		if batched {
+			total.Cost *= batchDiscount
+		}
+	}
+	if err := u.store.Add(total); err != nil {
+		u.logger.Printf("failed recording usage: %v\n", err)
+	}
+}
+
+// answerUsageCommand shows this month's spend, or that of the month asked for, to the user: by user and channel
+// to admins, their own by channel to everyone else
+func (b *bot) answerUsageCommand(ctx context.Context, cmd *slack.SlashCommand) {
+	if b.usage == nil {
+		b.respond(ctx, cmd, completion{note: "Usage is not tracked."}, slack.ResponseTypeEphemeral)
+		return
+	}
+	inv, err := b.aliases.Parse(usageSpec, cmd.Text)
+	month := time.Now().UTC().Format(usageMonth)
+	if err == nil && inv.Has("month") {
+		month = inv.Value("month")
+		if _, parseErr := time.Parse(usageMonth, month); parseErr != nil {
+			err = fmt.Errorf("--month must look like 2024-06, got %s", month)
+		}
+	}
+	if err != nil {
+		b.respond(ctx, cmd, completion{note: err.Error() + "\n" + inv.UsageText()}, slack.ResponseTypeEphemeral)
+		return
+	}
+	if inv.Help {
+		b.respond(ctx, cmd, completion{note: usageSpec.Help()}, slack.ResponseTypeEphemeral)
+		return
+	}
+	totals := b.usage.store.Month(month)
+	if !b.admins[cmd.UserID] {
+		own := totals[:0:0]
+		for _, t := range totals {
+			if t.User == cmd.UserID {
+				own = append(own, t)
+			}
+		}
+		b.respond(ctx, cmd, completion{note: usageReport(own, month, false, b.usage)}, slack.ResponseTypeEphemeral)
+		return
+	}
+	b.respond(ctx, cmd, completion{note: usageReport(totals, month, true, b.usage)}, slack.ResponseTypeEphemeral)
+}
+
+// usageSum adds up the answers, tokens and cost of some totals
+type usageSum struct {
+	answers, tokens int
+	cost            float64
+}
+
+func (s usageSum) String() string {
+	answers := "answers"
+	if s.answers == 1 {
+		answers = "answer"
+	}
+	return fmt.Sprintf("%s for %d tokens in %d %s", dollars(s.cost), s.tokens, s.answers, answers)
+}
+
+// dollars formats an amount of US dollars, showing amounts under a cent as such
+func dollars(amount float64) string {
+	if amount > 0 && amount < 0.01 {
+		return "<$0.01"
+	}
+	return fmt.Sprintf("$%.2f", amount)
+}
+
+// usageReport summarizes the totals of month, by user when byUser is set and by channel. Models without a
+// price are pointed out.
+func usageReport(totals []UsageTotal, month string, byUser bool, u *usageTracking) string {
+	at, _ := time.Parse(usageMonth, month)
+	title := "*Spend in " + at.Format("January 2006") + "*"
+	if !byUser {
+		title = "*Your spend in " + at.Format("January 2006") + "*"
+	}
+	if len(totals) == 0 {
+		return title + "\nNo answers yet."
+	}
+	var sum usageSum
+	users, channels := map[string]*usageSum{}, map[string]*usageSum{}
+	unpriced := map[string]bool{}
+	for _, t := range totals {
+		for _, s := range []*usageSum{&sum, entry(users, t.User), entry(channels, t.Channel)} {
+			s.answers += t.Answers
+			s.tokens += t.PromptTokens + t.CompletionTokens
+			s.cost += t.Cost
+		}
+		if _, ok := u.price(t.Model); !ok {
+			unpriced[t.Model] = true
+		}
+	}
+	lines := []string{fmt.Sprintf("%s: %v", title, sum)}
+	if byUser {
+		lines = append(lines, "*By user*")
+		lines = append(lines, usageRows(users, func(user string) string { return "<@" + user + ">" })...)
+	}
+	lines = append(lines, "*By channel*")
+	lines = append(lines, usageRows(channels, func(channel string) string { return "<#" + channel + ">" })...)
+	if len(unpriced) > 0 {
+		models := make([]string, 0, len(unpriced))
+		for model := range unpriced {
+			models = append(models, slackEscaper.Replace(model))
+		}
+		sort.Strings(models)
+		lines = append(lines, "_Models without a price count as $0: "+strings.Join(models, ", ")+"._")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// entry returns the sum of key in sums, adding it when there is none
+func entry(sums map[string]*usageSum, key string) *usageSum {
+	if sums[key] == nil {
+		sums[key] = &usageSum{}
+	}
+	return sums[key]
+}
+
+// usageRows lists the maxUsageRows most expensive of sums, the most tokens first among equals
+func usageRows(sums map[string]*usageSum, name func(string) string) []string {
+	keys := make([]string, 0, len(sums))
+	for key := range sums {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := sums[keys[i]], sums[keys[j]]
+		if a.cost != b.cost {
+			return a.cost > b.cost
+		}
+		if a.tokens != b.tokens {
+			return a.tokens > b.tokens
+		}
+		return keys[i] < keys[j]
+	})
+	var rows []string
+	for i, key := range keys {
+		if i == maxUsageRows {
+			rows = append(rows, fmt.Sprintf("• and %d more", len(keys)-maxUsageRows))
+			break
+		}
+		rows = append(rows, fmt.Sprintf("• %s: %v", name(key), *sums[key]))
+	}
+	return rows
+}
@@ -0,0 +1,112 @@
+package slackhandler
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUsageStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+	store, err := NewUsageStore(path)
+	require.NoError(t, err)
+	require.NoError(t, store.Add(UsageTotal{Month: "2024-06", User: "U1", Channel: "C1", Model: "gpt-4o", Answers: 1, PromptTokens: 100, CompletionTokens: 10, Cost: 0.5}))
+	require.NoError(t, store.Add(UsageTotal{Month: "2024-06", User: "U1", Channel: "C1", Model: "gpt-4o", Answers: 1, PromptTokens: 200, CompletionTokens: 20, Cost: 1}))
+	require.NoError(t, store.Add(UsageTotal{Month: "2024-06", User: "U1", Channel: "C2", Model: "gpt-4o", Answers: 1, PromptTokens: 1}))
+	require.NoError(t, store.Add(UsageTotal{Month: "2024-05", User: "U1", Channel: "C1", Model: "gpt-4o", Answers: 1, PromptTokens: 1}))
+
+	store, err = NewUsageStore(path)
+	require.NoError(t, err)
+	totals := store.Month("2024-06")
+	require.Len(t, totals, 2, "totals are by month, user, channel and model")
+	assert.Equal(t, UsageTotal{Month: "2024-06", User: "U1", Channel: "C1", Model: "gpt-4o", Answers: 2, PromptTokens: 300, CompletionTokens: 30, Cost: 1.5}, totals[0])
+	assert.Len(t, store.Month("2024-05"), 1)
+}
+
+func TestRecordUsage(t *testing.T) {
+	store, _ := NewUsageStore("")
+	u := &usageTracking{store: store, prices: DefaultModelPrices}
+	usage := func(model string, prompt, completion int) chatgpt.Usage {
+		return chatgpt.Usage{Model: model, Usage: openai.Usage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion}}
+	}
+	u.record("U1", "C1", usage("gpt-4o-2024-08-06", 1_000_000, 100_000), false)
+	u.record("U1", "C1", usage("gpt-4o-mini", 1_000_000, 0), true)
+	u.record("U1", "C1", usage("llama3", 1000, 1000), false)
+	u.record("U1", "C1", chatgpt.Usage{}, false)
+	(*usageTracking)(nil).record("U1", "C1", usage("gpt-4o", 1, 1), false)
+
+	totals := store.Month(time.Now().UTC().Format(usageMonth))
+	require.Len(t, totals, 3, "answers that took no tokens are not recorded")
+	assert.InDelta(t, 2.5+1, totals[0].Cost, 1e-9, "versions cost what their model does")
+	assert.Equal(t, "gpt-4o-2024-08-06", totals[0].Model)
+	assert.InDelta(t, 0.075, totals[1].Cost, 1e-9, "batched answers cost half")
+	assert.Zero(t, totals[2].Cost, "models without a price cost nothing")
+
+	price, ok := u.price("gpt-4-turbo-2024-04-09")
+	assert.True(t, ok)
+	assert.Equal(t, DefaultModelPrices["gpt-4-turbo"], price, "the longest model it is a version of prices it")
+	_, ok = u.price("gpt-4oo")
+	assert.False(t, ok)
+}
+
+func TestUsageReport(t *testing.T) {
+	u := &usageTracking{prices: DefaultModelPrices}
+	totals := []UsageTotal{
+		{User: "U1", Channel: "C1", Model: "gpt-4o", Answers: 2, PromptTokens: 900, CompletionTokens: 100, Cost: 1.25},
+		{User: "U2", Channel: "C1", Model: "gpt-4o", Answers: 1, PromptTokens: 50, CompletionTokens: 50, Cost: 0.001},
+		{User: "U2", Channel: "C2", Model: "llama<3>", Answers: 1, PromptTokens: 10, CompletionTokens: 10},
+	}
+	assert.Equal(t, "*Spend in June 2024*: $1.25 for 1120 tokens in 4 answers\n"+
+		"*By user*\n"+
+		"• <@U1>: $1.25 for 1000 tokens in 2 answers\n"+
+		"• <@U2>: <$0.01 for 120 tokens in 2 answers\n"+
+		"*By channel*\n"+
+		"• <#C1>: $1.25 for 1100 tokens in 3 answers\n"+
+		"• <#C2>: $0.00 for 20 tokens in 1 answer\n"+
+		"_Models without a price count as $0: llama&lt;3&gt;._",
+		usageReport(totals, "2024-06", true, u))
+	assert.Equal(t, "*Your spend in June 2024*\nNo answers yet.", usageReport(nil, "2024-06", false, u))
+}
+
+func TestUsageCommand(t *testing.T) {
+	store, _ := NewUsageStore("")
+	b, api, _ := newFakeBot(t, EventHandlerArgs{Usage: store, AdminUsers: []string{"U0ADMIN"}})
+	b.answerMention(context.Background(), api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> what is go", Channel: "C1", TimeStamp: "1.000001"})
+	require.NotEmpty(t, store.Month(time.Now().UTC().Format(usageMonth)), "answers are recorded")
+	require.NoError(t, store.Add(UsageTotal{Month: time.Now().UTC().Format(usageMonth), User: "U2", Channel: "C2", Model: "gpt-4o", Answers: 1, PromptTokens: 1}))
+
+	var responses []slack.WebhookMessage
+	responseServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg slack.WebhookMessage
+		_ = json.NewDecoder(r.Body).Decode(&msg)
+		responses = append(responses, msg)
+	}))
+	defer responseServer.Close()
+	report := func(user, text string) string {
+		b.handleSlashCommand(context.Background(), api, &slack.SlashCommand{
+			Command: usageCommand, Text: text, UserID: user, ChannelID: "C1", ResponseURL: responseServer.URL,
+		})
+		require.NotEmpty(t, responses)
+		assert.Equal(t, slack.ResponseTypeEphemeral, responses[len(responses)-1].ResponseType)
+		return responses[len(responses)-1].Text
+	}
+	own := report("U1", "")
+	assert.Contains(t, own, "Your spend")
+	assert.Contains(t, own, "<#C1>")
+	assert.NotContains(t, own, "<#C2>", "users only see their own spend")
+	all := report("U0ADMIN", "")
+	assert.Contains(t, all, "<@U1>")
+	assert.Contains(t, all, "<@U2>")
+	assert.Contains(t, report("U0ADMIN", "--month 2020-01"), "No answers yet.")
+	assert.Contains(t, report("U0ADMIN", "--month soon"), "--month must look like 2024-06")
+}
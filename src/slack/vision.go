@@ -0,0 +1,96 @@
+package slackhandler
+
+import (
+	"bytes"
+	"context"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+)
+
+const (
+	// maxImages is the most images attached to a question the model looks at
+	maxImages = 4
+	// maxImageBytes is the largest image vision models accept
+	maxImageBytes = 20 << 20
+)
+
+// visionTypes are the image types vision models accept
+var visionTypes = map[string]bool{"image/png": true, "image/jpeg": true, "image/gif": true, "image/webp": true}
+
+// vision looks at the images attached to questions with model
+type vision struct {
+	model string
+}
+
+// attachedFiles returns the files attached to the message ts in the thread threadTS of channel, which app
+// mention events leave out
+func (b *bot) attachedFiles(ctx context.Context, api *slack.Client, channel, threadTS, ts string) []slack.File {
+	// the thread's first message is returned along with the message when it is a reply, a message at the top
+	// level is the first of its own thread
+	if threadTS == "" {
+		threadTS = ts
+	}
+	messages, _, _, err := api.GetConversationRepliesContext(ctx, &slack.GetConversationRepliesParameters{
+		ChannelID: channel, Timestamp: threadTS, Oldest: ts, Latest: ts, Inclusive: true, Limit: 2,
+	})
+	if err != nil {
+		b.logger.Printf("failed reading the files of %v in %v: %v\n", ts, channel, err)
+		return nil
+	}
+	for _, message := range messages {
+		if message.Timestamp == ts {
+			return message.Files
+		}
+	}
+	return nil
+}
+
+// lookAtMessage is look at the files of the message ts in the thread threadTS of channel, which are only read
+// when images are looked at
+func (b *bot) lookAtMessage(ctx context.Context, api *slack.Client, channel, threadTS, ts string) []chatgpt.Option {
+	if b.vision == nil {
+		return nil
+	}
+	return b.look(ctx, api, b.attachedFiles(ctx, api, channel, threadTS, ts))
+}
+
+// look returns the options having the vision model look at the images among files, none when images are
+// not looked at or there are none. Files that are not images or too large are left out.
+func (b *bot) look(ctx context.Context, api *slack.Client, files []slack.File) []chatgpt.Option {
+	if b.vision == nil {
+		return nil
+	}
+	var images []chatgpt.Attachment
+	for _, file := range files {
+		if len(images) == maxImages {
+			break
+		}
+		if !visionTypes[file.Mimetype] || file.Size > maxImageBytes || file.URLPrivateDownload == "" {
+			continue
+		}
+		var data bytes.Buffer
+		if err := api.GetFileContext(ctx, file.URLPrivateDownload, &data); err != nil {
+			b.logger.Printf("failed downloading image %v: %v\n", file.ID, err)
+			continue
+		}
+		images = append(images, chatgpt.Attachment{MIMEType: file.Mimetype, Data: data.Bytes()})
+	}
+	if len(images) == 0 {
+		return nil
+	}
+	return []chatgpt.Option{chatgpt.WithModel(b.vision.model), chatgpt.WithImages(images...)}
+}
+
+// eventFiles returns the files of a message event as the web API knows them, with what is needed to download
+// and describe them
+func eventFiles(files []slackevents.File) []slack.File {
+	converted := make([]slack.File, len(files))
+	for i, file := range files {
+		converted[i] = slack.File{
+			ID: file.ID, Name: file.Name, Title: file.Title, Mimetype: file.Mimetype, Size: file.Size,
+			URLPrivate: file.URLPrivate, URLPrivateDownload: file.URLPrivateDownload,
+		}
+	}
+	return converted
+}
@@ -0,0 +1,67 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/chatgpt"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// seeingModel answers with the model it was asked and the images in the question
+type seeingModel struct {
+	mu   sync.Mutex
+	seen []string
+}
+
+func (m *seeingModel) CreateChatCompletion(_ context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	question := req.Messages[len(req.Messages)-1]
+	seen := []string{req.Model}
+	for _, part := range question.MultiContent {
+		if part.Type == openai.ChatMessagePartTypeImageURL {
+			seen = append(seen, part.ImageURL.URL)
+		}
+	}
+	m.mu.Lock()
+	m.seen = seen
+	m.mu.Unlock()
+	message := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "a cat"}
+	return openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{Message: message}}}, nil
+}
+
+func (m *seeingModel) lastSeen() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.seen
+}
+
+func TestVision(t *testing.T) {
+	ctx := context.Background()
+	slackServer := fake.NewSlack()
+	t.Cleanup(slackServer.Close)
+	api := slack.New("xoxb-test", slack.OptionAPIURL(slackServer.APIURL()))
+	model := &seeingModel{}
+	b := newBot(EventHandlerArgs{Logger: logger, GPTClient: model, Vision: true})
+
+	parent := slackServer.AddMessage(fake.Message{Channel: "C1", User: "U1", Text: "screenshots"})
+	question := slackServer.AddMessage(fake.Message{Channel: "C1", User: "U1", ThreadTS: parent.TS, Text: "<@U0BOT> what's in this screenshot?", Files: []fake.File{
+		{Filename: "cat.png", Mimetype: "image/png", Content: []byte("png")},
+		{Filename: "notes.txt", Mimetype: "text/plain", Content: []byte("notes")},
+	}})
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: question.Text, Channel: "C1", TimeStamp: question.TS, ThreadTimeStamp: parent.TS})
+	assert.Equal(t, []string{chatgpt.DefaultVisionModel, "data:image/png;base64,cG5n"}, model.lastSeen(), "only images are looked at")
+
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> and now?", Channel: "C1", TimeStamp: "9.000001"})
+	assert.Equal(t, []string{chatgpt.DefaultModel}, model.lastSeen(), "questions without images are answered by the default model")
+
+	dm := slackServer.AddMessage(fake.Message{Channel: "D1", User: "U1", Text: "what is this?", Files: []fake.File{{Filename: "cat.jpg", Mimetype: "image/jpeg", Content: []byte("jpg")}}})
+	url := strings.TrimSuffix(slackServer.APIURL(), "/api/") + "/files/" + dm.TS + "/0"
+	b.answerMessage(ctx, api, &slackevents.MessageEvent{User: "U1", Text: dm.Text, Channel: "D1", ChannelType: "im", TimeStamp: dm.TS, SubType: "file_share",
+		Files: []slackevents.File{{ID: "F1", Mimetype: "image/jpeg", Size: 3, URLPrivateDownload: url}}})
+	assert.Equal(t, []string{chatgpt.DefaultVisionModel, "data:image/jpeg;base64,anBn"}, model.lastSeen())
+}
@@ -0,0 +1,62 @@
+package slackhandler
+
+import (
+	"context"
+	"errors"
+)
+
+// busyText answers questions that came in while every worker was busy and the queue was full
+const busyText = "I'm busy, try again shortly."
+
+// errBusy is returned for the questions the worker pool has no room for
+var errBusy = errors.New("every worker is busy and the queue is full")
+
+// workerPool bounds how many questions are answered by the model at once, so that a burst of questions does not
+// go past the provider's concurrency limits. Questions beyond that wait in a bounded queue for a worker, those
+// beyond the queue are turned away.
+type workerPool struct {
+	workers chan struct{}
+	queue   chan struct{}
+}
+
+// newWorkerPool creates a pool of workers answering questions with queue more waiting, nil when workers is 0 so
+// that questions are not limited
+func newWorkerPool(workers, queue int) *workerPool {
+	if workers <= 0 {
+		return nil
+	}
+	return &workerPool{workers: make(chan struct{}, workers), queue: make(chan struct{}, max(queue, 0))}
+}
+
+// acquire waits for a worker, returning errBusy right away when the queue is full and ctx's error when it is
+// done first. Every nil return has to be followed by a release. p may be nil.
+func (p *workerPool) acquire(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	select {
+	case p.workers <- struct{}{}:
+		return nil
+	default:
+	}
+	select {
+	case p.queue <- struct{}{}:
+	default:
+		return errBusy
+	}
+	defer func() { <-p.queue }()
+	select {
+	case p.workers <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees the worker acquired
+func (p *workerPool) release() {
+	if p == nil {
+		return
+	}
+	<-p.workers
+}
@@ -0,0 +1,75 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestWorkerPool(t *testing.T) {
+	ctx := context.Background()
+	p := newWorkerPool(1, 1)
+	require.NoError(t, p.acquire(ctx))
+
+	queued := make(chan error)
+	go func() { queued <- p.acquire(ctx) }()
+	require.Eventually(t, func() bool { return len(p.queue) == 1 }, time.Second, time.Millisecond)
+	assert.ErrorIs(t, p.acquire(ctx), errBusy, "the queue is full")
+	p.release()
+	require.NoError(t, <-queued, "the queued question gets the worker released")
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.ErrorIs(t, p.acquire(cancelled), context.Canceled)
+	p.release()
+	assert.Empty(t, p.queue)
+	assert.Empty(t, p.workers)
+
+	var unbounded *workerPool
+	assert.Nil(t, newWorkerPool(0, 10))
+	assert.NoError(t, unbounded.acquire(ctx))
+	unbounded.release()
+}
+
+// slowModel answers once released
+type slowModel struct {
+	started, release chan struct{}
+}
+
+func (m slowModel) CreateChatCompletion(_ context.Context, _ openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	m.started <- struct{}{}
+	<-m.release
+	message := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "an answer"}
+	return openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{{Message: message}}}, nil
+}
+
+func TestBusy(t *testing.T) {
+	ctx := context.Background()
+	slackServer := fake.NewSlack()
+	t.Cleanup(slackServer.Close)
+	api := slack.New("xoxb-test", slack.OptionAPIURL(slackServer.APIURL()))
+	model := slowModel{started: make(chan struct{}), release: make(chan struct{})}
+	b := newBot(EventHandlerArgs{Logger: logger, GPTClient: model, MaxConcurrentRequests: 1})
+
+	answered := make(chan struct{})
+	go func() {
+		defer close(answered)
+		b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U1", Text: "<@U0BOT> first", Channel: "C1", TimeStamp: "1.000001"})
+	}()
+	<-model.started
+	b.answerMention(ctx, api, &slackevents.AppMentionEvent{User: "U2", Text: "<@U0BOT> second", Channel: "C1", TimeStamp: "2.000001"})
+	close(model.release)
+	<-answered
+
+	messages := slackServer.Messages()
+	require.Len(t, messages, 2)
+	assert.Contains(t, messages[0].Text, busyText)
+	assert.Equal(t, "2.000001", messages[0].ThreadTS)
+	assert.Contains(t, messages[1].Text, "an answer")
+}
@@ -0,0 +1,112 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/sashabaranov/go-openai"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/slack-go/slack/socketmode"
+	"strings"
+)
+
+const (
+	// workflowStepCallbackID identifies the "Ask ChatGPT" workflow step, as created in the app settings, and the
+	// submissions of its configuration modal
+	workflowStepCallbackID = "slackgpt_ask_step"
+	// workflowPromptBlockID is the prompt template input of the step's configuration modal, with a single element
+	// of the same ID
+	workflowPromptBlockID = "slackgpt_step_prompt"
+	// workflowPromptInput and workflowAnswerOutput are the names of the step's input and output
+	workflowPromptInput  = "prompt"
+	workflowAnswerOutput = "answer"
+)
+
+// openWorkflowStep opens the configuration modal of the "Ask ChatGPT" step someone edits in Workflow Builder,
+// with the prompt template it was saved with
+func (b *bot) openWorkflowStep(ctx context.Context, api *slack.Client, callback *slack.InteractionCallback) {
+	prompt := slack.NewPlainTextInputBlockElement(slack.NewTextBlockObject(slack.PlainTextType, "e.g. Summarize this request: {{the form's answer}}", false, false), workflowPromptBlockID)
+	prompt.Multiline = true
+	prompt.MaxLength = maxComposedPrompt
+	if inputs := callback.WorkflowStep.Inputs; inputs != nil {
+		prompt.InitialValue = (*inputs)[workflowPromptInput].Value
+	}
+	blocks := slack.Blocks{BlockSet: []slack.Block{
+		slack.NewInputBlock(workflowPromptBlockID, slack.NewTextBlockObject(slack.PlainTextType, "Prompt", false, false),
+			slack.NewTextBlockObject(slack.PlainTextType, "Insert variables to fill in the prompt with what earlier steps collected", false, false), prompt),
+	}}
+	modal := slack.NewConfigurationModalRequest(blocks, "", "")
+	modal.CallbackID = workflowStepCallbackID
+	if _, err := api.OpenViewContext(ctx, callback.TriggerID, modal.ModalViewRequest); err != nil {
+		b.logger.Printf("failed opening the configuration of a workflow step: %v\n", err)
+	}
+}
+
+// saveWorkflowStep saves the prompt template submitted through the step's configuration modal, and declares the
+// answer as the step's output for later steps
+func (b *bot) saveWorkflowStep(ctx context.Context, api *slack.Client, callback *slack.InteractionCallback) {
+	if callback.View.State == nil {
+		return
+	}
+	template := strings.TrimSpace(callback.View.State.Values[workflowPromptBlockID][workflowPromptBlockID].Value)
+	inputs := slack.WorkflowStepInputs{workflowPromptInput: {Value: template}}
+	outputs := []slack.WorkflowStepOutput{{Name: workflowAnswerOutput, Type: "text", Label: "ChatGPT's answer"}}
+	if err := api.SaveWorkflowStepConfigurationContext(ctx, callback.WorkflowStep.WorkflowStepEditID, &inputs, &outputs); err != nil {
+		b.logger.Printf("failed saving the configuration of workflow %v: %v\n", callback.WorkflowStep.WorkflowID, err)
+	}
+}
+
+// handleWorkflowStepEvent runs the "Ask ChatGPT" steps of workflows
+func (b *bot) handleWorkflowStepEvent(ctx context.Context, api *slack.Client, evt *socketmode.Event) {
+	eventsAPIEvent, ok := evt.Data.(slackevents.EventsAPIEvent)
+	if !ok {
+		b.logger.Printf("Ignored %+v\n", evt)
+		return
+	}
+	ev, ok := eventsAPIEvent.InnerEvent.Data.(*slackevents.WorkflowStepExecuteEvent)
+	if !ok {
+		b.logger.Printf("Ignored %+v\n", evt)
+		return
+	}
+	b.runWorkflowStep(ctx, api, ev)
+}
+
+// runWorkflowStep answers the prompt of a running "Ask ChatGPT" step, its variables filled in by Slack, and
+// completes the step with the answer as its output. The step fails with the problem when there is no answer.
+// Workflows run without a channel, so the default persona answers.
+func (b *bot) runWorkflowStep(ctx context.Context, api *slack.Client, ev *slackevents.WorkflowStepExecuteEvent) {
+	if ev.CallbackID != workflowStepCallbackID {
+		return
+	}
+	step := ev.WorkflowStep
+	var prompt string
+	if step.Inputs != nil {
+		prompt = strings.TrimSpace((*step.Inputs)[workflowPromptInput].Value)
+	}
+	if prompt == "" {
+		b.failWorkflowStep(api, step, "The step has no prompt, edit the workflow to write one.")
+		return
+	}
+	if refusal, _ := b.moderationNotice(ctx, prompt); refusal != "" {
+		b.failWorkflowStep(api, step, refusal)
+		return
+	}
+	b.logger.Printf("workflow %v asked a question\n", step.WorkflowID)
+	resp, err := b.complete(ctx, api, "", "", []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: prompt}})
+	if err != nil {
+		b.logger.Printf("failed answering the question of workflow %v: %v\n", step.WorkflowID, err)
+		b.failWorkflowStep(api, step, troubleAnswer(err))
+		return
+	}
+	// later steps post the answer as they please, escaped so it cannot ping @channel or users
+	outputs := map[string]string{workflowAnswerOutput: slackEscaper.Replace(resp.answer)}
+	if err := api.WorkflowStepCompleted(step.WorkflowStepExecuteID, slack.WorkflowStepCompletedRequestOptionOutput(outputs)); err != nil {
+		b.logger.Printf("failed completing a step of workflow %v: %v\n", step.WorkflowID, err)
+	}
+}
+
+// failWorkflowStep fails the running step with message, which Workflow Builder shows to the workflow's owner
+func (b *bot) failWorkflowStep(api *slack.Client, step slackevents.EventWorkflowStep, message string) {
+	if err := api.WorkflowStepFailed(step.WorkflowStepExecuteID, message); err != nil {
+		b.logger.Printf("failed failing a step of workflow %v: %v\n", step.WorkflowID, err)
+	}
+}
@@ -0,0 +1,60 @@
+package slackhandler
+
+import (
+	"context"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestWorkflowStepConfiguration(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{})
+	ctx := context.Background()
+
+	edit := &slack.InteractionCallback{Type: slack.InteractionTypeWorkflowStepEdit, CallbackID: workflowStepCallbackID, TriggerID: "T1"}
+	edit.WorkflowStep.Inputs = &slack.WorkflowStepInputs{workflowPromptInput: {Value: "Summarize {{answer}}"}}
+	b.handleInteraction(ctx, api, edit)
+	views := slackServer.Views()
+	require.Len(t, views, 1)
+	assert.Contains(t, views[0].View, `"type":"workflow_step"`)
+	assert.Contains(t, views[0].View, `"initial_value":"Summarize {{answer}}"`)
+
+	submission := &slack.InteractionCallback{Type: slack.InteractionTypeViewSubmission}
+	submission.View.CallbackID = workflowStepCallbackID
+	submission.WorkflowStep.WorkflowStepEditID = "E1"
+	submission.View.State = &slack.ViewState{Values: map[string]map[string]slack.BlockAction{
+		workflowPromptBlockID: {workflowPromptBlockID: {Value: " Translate {{message}} to French "}},
+	}}
+	b.handleInteraction(ctx, api, submission)
+	calls := slackServer.WorkflowCalls()
+	require.Len(t, calls, 1)
+	assert.Equal(t, "workflows.updateStep", calls[0].Method)
+	assert.Contains(t, calls[0].Body, `"workflow_step_edit_id":"E1"`)
+	assert.Contains(t, calls[0].Body, `"prompt":{"value":"Translate {{message}} to French"`)
+	assert.Contains(t, calls[0].Body, `"name":"answer"`)
+}
+
+func TestRunWorkflowStep(t *testing.T) {
+	b, api, slackServer := newFakeBot(t, EventHandlerArgs{})
+	model := &paramsModel{}
+	b.gptClient = model
+	run := func(id, prompt string) {
+		ev := &slackevents.WorkflowStepExecuteEvent{CallbackID: workflowStepCallbackID}
+		ev.WorkflowStep.WorkflowStepExecuteID = id
+		ev.WorkflowStep.Inputs = &slack.WorkflowStepInputs{workflowPromptInput: {Value: prompt}}
+		b.runWorkflowStep(context.Background(), api, ev)
+	}
+
+	run("X1", "what is go?")
+	assert.Equal(t, "what is go?", model.last().Messages[1].Content)
+	run("X2", " ")
+	calls := slackServer.WorkflowCalls()
+	require.Len(t, calls, 2)
+	assert.Equal(t, "workflows.stepCompleted", calls[0].Method)
+	assert.Contains(t, calls[0].Body, `"workflow_step_execute_id":"X1"`)
+	assert.Contains(t, calls[0].Body, `"answer":"go is a language"`)
+	assert.Equal(t, "workflows.stepFailed", calls[1].Method)
+	assert.Contains(t, calls[1].Body, "has no prompt")
+}
@@ -0,0 +1,209 @@
+// Package tracing records OpenTelemetry spans of what the bot does and exports them to an OTLP/HTTP collector. It
+// wraps the OpenTelemetry SDK so the rest of the bot traces unconditionally, with nil spans when tracing is off.
+package tracing
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultInterval is how often spans are exported unless the tracer is told otherwise
+	defaultInterval = 5 * time.Second
+	// maxBatch is how many spans are exported at once, more are exported without waiting for the interval
+	maxBatch = 512
+	// maxPending is how many spans are kept while the collector cannot be reached, the next are dropped
+	maxPending = 4 * maxBatch
+	// scopeName is the instrumentation scope of the spans
+	scopeName = "github.com/chikamif/slackgpt"
+)
+
+// propagator sends the trace along with the requests traced by Transport, as a W3C traceparent header
+var propagator = propagation.TraceContext{}
+
+// SpanKind is the role of a span in a trace
+type SpanKind = trace.SpanKind
+
+const (
+	SpanKindInternal = trace.SpanKindInternal
+	SpanKindServer   = trace.SpanKindServer
+	SpanKindClient   = trace.SpanKindClient
+)
+
+// Attribute is a key and its value describing a span
+type Attribute = attribute.KeyValue
+
+// String returns a string attribute
+func String(key, value string) Attribute {
+	return attribute.String(key, value)
+}
+
+// Int returns an int attribute
+func Int(key string, value int) Attribute {
+	return attribute.Int(key, value)
+}
+
+// Bool returns a bool attribute
+func Bool(key string, value bool) Attribute {
+	return attribute.Bool(key, value)
+}
+
+// Span is an operation of a trace. A nil Span records nothing, so code can trace unconditionally.
+type Span struct {
+	tracer *Tracer
+	span   trace.Span
+}
+
+// SetAttributes adds attrs to the span
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.span.SetAttributes(attrs...)
+}
+
+// RecordError marks the span as failed with err, when it is not nil
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.span.RecordError(err)
+	s.fail(err.Error())
+}
+
+// fail marks the span as failed with message
+func (s *Span) fail(message string) {
+	s.span.SetStatus(codes.Error, message)
+}
+
+// End ends the span, which is exported when its trace is sampled. Ending it again does nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.span.End()
+}
+
+// TraceID returns the hex ID of the trace
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return s.span.SpanContext().TraceID().String()
+}
+
+// spanKey is the context key of the current span
+type spanKey struct{}
+
+// FromContext returns the span of ctx, nil when there is none
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// TraceID returns the hex ID of the trace of ctx, empty when it has none
+func TraceID(ctx context.Context) string {
+	return FromContext(ctx).TraceID()
+}
+
+// Start starts a span under the span of ctx, with its tracer. Without one it returns ctx and a nil Span.
+func Start(ctx context.Context, name string, kind SpanKind, attrs ...Attribute) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name, kind, attrs...)
+}
+
+// Options configure a Tracer
+type Options struct {
+	// Endpoint is the base URL of the OTLP/HTTP collector, e.g. http://localhost:4318, spans are posted to its
+	// /v1/traces
+	Endpoint string
+	// Headers are sent with every export, e.g. the collector's API key
+	Headers map[string]string
+	// ServiceName names the bot in the traces
+	ServiceName string
+	// SampleRatio is the share of traces exported, between 0 and 1
+	SampleRatio float64
+	// Interval is how often spans are exported, defaultInterval when 0
+	Interval time.Duration
+	// Logger is told about failed exports, which are otherwise dropped silently
+	Logger *log.Logger
+}
+
+// Tracer starts the spans of traces and exports those sampled in batches. A nil Tracer starts no spans.
+type Tracer struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+}
+
+// New creates a tracer exporting as opts say until Shutdown
+func New(opts Options) (*Tracer, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultInterval
+	}
+	if opts.Logger == nil {
+		opts.Logger = log.New(io.Discard, "", 0)
+	}
+	exporter, err := otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpointURL(strings.TrimSuffix(opts.Endpoint, "/")+"/v1/traces"),
+		otlptracehttp.WithHeaders(opts.Headers),
+	)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(loggedExporter{SpanExporter: exporter, logger: opts.Logger},
+			sdktrace.WithBatchTimeout(opts.Interval),
+			sdktrace.WithMaxExportBatchSize(maxBatch),
+			sdktrace.WithMaxQueueSize(maxPending),
+		),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", opts.ServiceName))),
+		// spans are sampled the same as their trace
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+	return &Tracer{provider: provider, tracer: provider.Tracer(scopeName)}, nil
+}
+
+// Start starts a span under the span of ctx, or of a new trace when there is none, and returns ctx with it.
+// New traces are sampled as the tracer's SampleRatio says, spans under them the same as their trace.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind, attrs ...Attribute) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+	s := &Span{tracer: t, span: span}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Shutdown stops exporting periodically and exports the spans still queued
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	return t.provider.Shutdown(ctx)
+}
+
+// loggedExporter logs the exports that failed, whose spans are dropped
+type loggedExporter struct {
+	sdktrace.SpanExporter
+	logger *log.Logger
+}
+
+func (e loggedExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if err := e.SpanExporter.ExportSpans(ctx, spans); err != nil {
+		e.logger.Printf("failed exporting %d spans: %v\n", len(spans), err)
+	}
+	return nil
+}
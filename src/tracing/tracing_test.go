@@ -0,0 +1,117 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"github.com/chikamif/slackgpt/src/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrace(t *testing.T) {
+	c := fake.NewCollector()
+	defer c.Close()
+	var traceparent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer upstream.Close()
+	tracer, err := New(Options{Endpoint: c.URL(), Headers: map[string]string{"X-Api-Key": "secret"}, ServiceName: "slackgpt", SampleRatio: 1, Interval: time.Hour})
+	require.NoError(t, err)
+
+	ctx, event := tracer.Start(context.Background(), "slack app_mention", SpanKindServer, String("slack.channel", "C1"))
+	ctx, completion := Start(ctx, "chat gpt-4o", SpanKindClient)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, upstream.URL+"/v1/chat/completions?key=secret", nil)
+	require.NoError(t, err)
+	resp, err := (&http.Client{Transport: Transport(nil)}).Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	completion.RecordError(errors.New("model unavailable"))
+	completion.End()
+	event.SetAttributes(Int("slack.replies", 1), Bool("slack.answered", false))
+	event.End()
+	event.End()
+	require.NoError(t, tracer.Shutdown(context.Background()))
+
+	spans := c.Spans()
+	require.Len(t, spans, 3, "spans end once")
+	request, chat, root := spans[0], spans[1], spans[2]
+	assert.Equal(t, event.TraceID(), root.TraceID)
+	assert.Empty(t, root.ParentSpanID)
+	assert.Equal(t, root.SpanID, chat.ParentSpanID)
+	assert.Equal(t, chat.SpanID, request.ParentSpanID)
+	for _, span := range spans {
+		assert.Equal(t, root.TraceID, span.TraceID, "the spans are in one trace")
+		assert.Equal(t, "slackgpt", span.Service)
+	}
+	assert.Equal(t, "00-"+root.TraceID+"-"+request.SpanID+"-01", traceparent, "the trace is sent along")
+	assert.Equal(t, "POST /v1/chat/completions", request.Name)
+	assert.True(t, request.Failed)
+	assert.Equal(t, "503 Service Unavailable", request.Error)
+	assert.True(t, chat.Failed)
+	assert.Equal(t, "model unavailable", chat.Error)
+	assert.False(t, root.Failed)
+	assert.Equal(t, map[string]string{"slack.channel": "C1", "slack.replies": "1", "slack.answered": "false"}, root.Attributes)
+	assert.False(t, strings.Contains(request.Attributes["url.full"], "secret"), "the query is left out")
+	assert.Equal(t, "secret", c.Header().Get("X-Api-Key"))
+}
+
+func TestTraceUnsampled(t *testing.T) {
+	c := fake.NewCollector()
+	defer c.Close()
+	var traceparent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer upstream.Close()
+	tracer, err := New(Options{Endpoint: c.URL(), SampleRatio: 0})
+	require.NoError(t, err)
+	ctx, event := tracer.Start(context.Background(), "slack message", SpanKindServer)
+	ctx, child := Start(ctx, "chat gpt-4o", SpanKindClient)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, upstream.URL, nil)
+	require.NoError(t, err)
+	resp, err := (&http.Client{Transport: Transport(nil)}).Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	child.End()
+	event.End()
+	require.NoError(t, tracer.Shutdown(context.Background()))
+	assert.Empty(t, c.Spans())
+	assert.NotEmpty(t, TraceID(ctx), "unsampled traces are still propagated")
+	assert.True(t, strings.HasPrefix(traceparent, "00-"+TraceID(ctx)+"-") && strings.HasSuffix(traceparent, "-00"),
+		"the trace is sent along as unsampled")
+}
+
+func TestNilTracer(t *testing.T) {
+	var tracer *Tracer
+	ctx, span := tracer.Start(context.Background(), "slack message", SpanKindServer)
+	assert.Nil(t, span)
+	span.SetAttributes(String("slack.channel", "C1"))
+	span.RecordError(errors.New("ignored"))
+	span.End()
+	_, child := Start(ctx, "chat gpt-4o", SpanKindClient)
+	assert.Nil(t, child)
+	assert.Empty(t, TraceID(ctx))
+	assert.NoError(t, tracer.Shutdown(context.Background()))
+}
+
+func TestExportFailureLogged(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad key", http.StatusUnauthorized)
+	}))
+	defer collector.Close()
+	var logs strings.Builder
+	tracer, err := New(Options{Endpoint: collector.URL, SampleRatio: 1, Logger: log.New(&logs, "", 0)})
+	require.NoError(t, err)
+	_, span := tracer.Start(context.Background(), "slack message", SpanKindServer)
+	span.End()
+	require.NoError(t, tracer.Shutdown(context.Background()))
+	assert.Contains(t, logs.String(), "failed exporting 1 spans")
+}
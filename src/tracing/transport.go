@@ -0,0 +1,47 @@
+package tracing
+
+import (
+	"go.opentelemetry.io/otel/propagation"
+	"net/http"
+	"net/url"
+)
+
+// Transport returns an http.RoundTripper tracing the requests sent through next as spans under the span of their
+// context, which is sent along in the traceparent header. Requests whose context has no span are sent as they are.
+func Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return transport{next: next}
+}
+
+// transport traces the requests sent through next
+type transport struct {
+	next http.RoundTripper
+}
+
+func (t transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// the query could hold secrets
+	target := url.URL{Scheme: req.URL.Scheme, Host: req.URL.Host, Path: req.URL.Path}
+	ctx, span := Start(req.Context(), req.Method+" "+req.URL.Path, SpanKindClient,
+		String("http.request.method", req.Method),
+		String("server.address", req.URL.Hostname()),
+		String("url.full", target.String()),
+	)
+	if span == nil {
+		return t.next.RoundTrip(req)
+	}
+	defer span.End()
+	req = req.Clone(ctx)
+	propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	span.SetAttributes(Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.fail(resp.Status)
+	}
+	return resp, nil
+}
@@ -0,0 +1,299 @@
+// Package webhook delivers results to the callback URLs of the bot's integrations. Payloads are signed so their
+// receivers can check they come from the bot, failed deliveries are retried with exponential backoff and those
+// that cannot be delivered are appended to a dead-letter log.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	mathrand "math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The headers a delivery is sent with
+const (
+	// EventHeader is what the payload is about, e.g. embedding.completed
+	EventHeader = "X-Slackgpt-Event"
+	// DeliveryHeader identifies the delivery, it is the same in every attempt
+	DeliveryHeader = "X-Slackgpt-Delivery"
+	// TimestampHeader is when the attempt was sent, in unix seconds
+	TimestampHeader = "X-Slackgpt-Request-Timestamp"
+	// SignatureHeader is v1= followed by the hex HMAC-SHA256 of "v1:<timestamp>:<body>" keyed with the secret
+	SignatureHeader = "X-Slackgpt-Signature"
+)
+
+const (
+	// DefaultRetries is how many times a failed delivery is retried unless told otherwise
+	DefaultRetries = 5
+	// DefaultRetryDelay is how long the first retry waits unless told otherwise, each next one waits twice as long
+	DefaultRetryDelay = time.Second
+	// DefaultMaxRetryDelay bounds the wait between two attempts unless told otherwise
+	DefaultMaxRetryDelay = time.Minute
+	// attemptTimeout is how long an attempt may take
+	attemptTimeout = 10 * time.Second
+)
+
+// ErrInvalidSignature is returned by Verify for deliveries not signed with the secret
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Options configure a Sender
+type Options struct {
+	// Secret signs the payloads, they are sent unsigned when it is empty
+	Secret string
+	// Retries is how many times a failed delivery is retried, 0 sends it once. RetryDelay is the wait before the
+	// first retry, doubled before each next one up to MaxRetryDelay.
+	Retries       int
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+	// DeadLetterFile is the JSON lines file the deliveries that failed every attempt are appended to, they are
+	// only logged when it is empty
+	DeadLetterFile string
+	Logger         *log.Logger
+	// Client sends the deliveries, one with a 10s timeout when nil
+	Client *http.Client
+}
+
+// Sender delivers payloads to webhooks
+type Sender struct {
+	opts Options
+	// stopped is cancelled when Close gives up waiting for the deliveries, their retries are not waited for
+	stopped context.Context
+	stop    context.CancelFunc
+	pending sync.WaitGroup
+	// mu guards the dead-letter file
+	mu sync.Mutex
+}
+
+// New creates a Sender delivering with opts, the zero values of its retries and logger are replaced by defaults
+func New(opts Options) *Sender {
+	if opts.Retries < 0 {
+		opts.Retries = 0
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = DefaultRetryDelay
+	}
+	if opts.MaxRetryDelay <= 0 {
+		opts.MaxRetryDelay = DefaultMaxRetryDelay
+	}
+	if opts.Logger == nil {
+		opts.Logger = log.New(io.Discard, "", 0)
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: attemptTimeout}
+	}
+	stopped, stop := context.WithCancel(context.Background())
+	return &Sender{opts: opts, stopped: stopped, stop: stop}
+}
+
+// DeadLetter is an undeliverable payload, as a line of the dead-letter file
+type DeadLetter struct {
+	Time     time.Time       `json:"time"`
+	Delivery string          `json:"delivery"`
+	Event    string          `json:"event"`
+	URL      string          `json:"url"`
+	Attempts int             `json:"attempts"`
+	Error    string          `json:"error"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+// delivery is a payload being delivered
+type delivery struct {
+	id    string
+	event string
+	url   string
+	body  []byte
+}
+
+// Send delivers payload to url as event, retrying until it is accepted, the retries run out or ctx is done. The
+// payload of a failed delivery is dead-lettered and the last error returned.
+func (s *Sender) Send(ctx context.Context, url, event string, payload any) error {
+	d, err := newDelivery(url, event, payload)
+	if err != nil {
+		return err
+	}
+	return s.send(ctx, d)
+}
+
+// Deliver delivers payload to url as event in the background, see Send. Close waits for the deliveries.
+func (s *Sender) Deliver(url, event string, payload any) {
+	d, err := newDelivery(url, event, payload)
+	if err != nil {
+		s.opts.Logger.Printf("failed encoding the %s webhook to %s: %v\n", event, url, err)
+		return
+	}
+	s.pending.Add(1)
+	go func() {
+		defer s.pending.Done()
+		_ = s.send(s.stopped, d)
+	}()
+}
+
+// Close waits for the deliveries in the background until ctx is done, then stops retrying them and dead-letters
+// those still failing
+func (s *Sender) Close(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		s.stop()
+		return nil
+	case <-ctx.Done():
+		s.stop()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// newDelivery encodes payload to be delivered to url as event
+func newDelivery(url, event string, payload any) (delivery, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return delivery{}, err
+	}
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return delivery{id: hex.EncodeToString(id), event: event, url: url, body: body}, nil
+}
+
+// send attempts d until it is accepted, dead-lettering it when it is not
+func (s *Sender) send(ctx context.Context, d delivery) error {
+	var err error
+	attempts := 0
+	for attempts <= s.opts.Retries {
+		if attempts > 0 {
+			timer := time.NewTimer(s.backoff(attempts))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				err = fmt.Errorf("%w, last attempt: %w", ctx.Err(), err)
+				s.deadLetter(d, attempts, err)
+				return err
+			case <-timer.C:
+			}
+		}
+		attempts++
+		var retry bool
+		if retry, err = s.attempt(ctx, d); err == nil {
+			return nil
+		}
+		if !retry {
+			break
+		}
+	}
+	s.deadLetter(d, attempts, err)
+	return err
+}
+
+// backoff is how long to wait before the retry-th retry: the retry delay doubled each retry, up to the max retry
+// delay, with jitter so that the retries of deliveries failing together are spread out
+func (s *Sender) backoff(retry int) time.Duration {
+	delay := s.opts.MaxRetryDelay
+	if retry < 32 {
+		delay = min(s.opts.RetryDelay<<(retry-1), s.opts.MaxRetryDelay)
+	}
+	return delay/2 + time.Duration(mathrand.Int63n(int64(delay/2)+1))
+}
+
+// attempt sends d once and reports whether it is worth retrying when it fails: requests that timed out, were
+// rate limited or failed on the receiver's side are, the receiver rejecting them is not
+func (s *Sender) attempt(ctx context.Context, d delivery) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(d.body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, d.event)
+	req.Header.Set(DeliveryHeader, d.id)
+	req.Header.Set(TimestampHeader, timestamp)
+	if s.opts.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(s.opts.Secret, timestamp, d.body))
+	}
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode/100 == 2:
+		return false, nil
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("webhook answered %s", resp.Status)
+	default:
+		return false, fmt.Errorf("webhook answered %s", resp.Status)
+	}
+}
+
+// deadLetter logs d, which failed attempts times with err, and appends it to the dead-letter file
+func (s *Sender) deadLetter(d delivery, attempts int, err error) {
+	s.opts.Logger.Printf("failed delivering the %s webhook %s to %s after %d attempts: %v\n", d.event, d.id, d.url, attempts, err)
+	if s.opts.DeadLetterFile == "" {
+		return
+	}
+	line, jsonErr := json.Marshal(DeadLetter{
+		Time:     time.Now().UTC(),
+		Delivery: d.id,
+		Event:    d.event,
+		URL:      d.url,
+		Attempts: attempts,
+		Error:    err.Error(),
+		Payload:  d.body,
+	})
+	if jsonErr != nil {
+		s.opts.Logger.Printf("failed encoding the dead letter of webhook %s: %v\n", d.id, jsonErr)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, openErr := os.OpenFile(s.opts.DeadLetterFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if openErr != nil {
+		s.opts.Logger.Printf("failed opening the dead-letter file: %v\n", openErr)
+		return
+	}
+	defer f.Close()
+	if _, writeErr := f.Write(append(line, '\n')); writeErr != nil {
+		s.opts.Logger.Printf("failed writing the dead letter of webhook %s: %v\n", d.id, writeErr)
+	}
+}
+
+// Sign returns the signature header of body sent at timestamp, in unix seconds, signed with secret
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v1:" + timestamp + ":"))
+	mac.Write(body)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks that a delivery with header and body was signed with secret less than tolerance before now, so
+// receivers can reject forged and replayed deliveries
+func Verify(secret string, header http.Header, body []byte, now time.Time, tolerance time.Duration) error {
+	timestamp := header.Get(TimestampHeader)
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: bad timestamp %q", ErrInvalidSignature, timestamp)
+	}
+	if age := now.Sub(time.Unix(sent, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("%w: sent %s ago", ErrInvalidSignature, age.Round(time.Second))
+	}
+	if !hmac.Equal([]byte(header.Get(SignatureHeader)), []byte(Sign(secret, timestamp, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package webhook
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver is a webhook answering with statuses in turn, the last one from then on, and keeping what it received
+type receiver struct {
+	*httptest.Server
+	mu         sync.Mutex
+	statuses   []int
+	deliveries []string
+	bodies     []string
+	verified   []error
+}
+
+func newReceiver(secret string, statuses ...int) *receiver {
+	r := &receiver{statuses: statuses}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.deliveries = append(r.deliveries, req.Header.Get(DeliveryHeader))
+		r.bodies = append(r.bodies, string(body))
+		r.verified = append(r.verified, Verify(secret, req.Header, body, time.Now(), time.Minute))
+		status := r.statuses[min(len(r.deliveries), len(r.statuses))-1]
+		w.WriteHeader(status)
+	}))
+	return r
+}
+
+func (r *receiver) received() ([]string, []string, []error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.deliveries, r.bodies, r.verified
+}
+
+// deadLetters reads the dead-letter file
+func deadLetters(t *testing.T, path string) []DeadLetter {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	require.NoError(t, err)
+	defer f.Close()
+	var letters []DeadLetter
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var letter DeadLetter
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &letter))
+		letters = append(letters, letter)
+	}
+	return letters
+}
+
+func TestSend(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		retries  int
+		attempts int
+		failed   bool
+	}{
+		{name: "accepted", statuses: []int{http.StatusOK}, retries: 3, attempts: 1},
+		{name: "retried until accepted", statuses: []int{http.StatusBadGateway, http.StatusTooManyRequests, http.StatusNoContent}, retries: 3, attempts: 3},
+		{name: "retries run out", statuses: []int{http.StatusServiceUnavailable}, retries: 2, attempts: 3, failed: true},
+		{name: "rejected", statuses: []int{http.StatusBadRequest}, retries: 3, attempts: 1, failed: true},
+		{name: "no retries", statuses: []int{http.StatusInternalServerError}, attempts: 1, failed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newReceiver("s3cret", tt.statuses...)
+			defer r.Close()
+			deadLetterFile := filepath.Join(t.TempDir(), "dead-letters.jsonl")
+			sender := New(Options{Secret: "s3cret", Retries: tt.retries, RetryDelay: time.Millisecond, DeadLetterFile: deadLetterFile})
+
+			err := sender.Send(context.Background(), r.URL, "embedding.completed", map[string]string{"id": "1"})
+			deliveries, bodies, verified := r.received()
+			require.Len(t, deliveries, tt.attempts)
+			for i := range deliveries {
+				assert.Equal(t, deliveries[0], deliveries[i], "every attempt is the same delivery")
+				assert.JSONEq(t, `{"id": "1"}`, bodies[i])
+				assert.NoError(t, verified[i])
+			}
+			letters := deadLetters(t, deadLetterFile)
+			if !tt.failed {
+				assert.NoError(t, err)
+				assert.Empty(t, letters)
+				return
+			}
+			assert.Error(t, err)
+			require.Len(t, letters, 1)
+			assert.Equal(t, deliveries[0], letters[0].Delivery)
+			assert.Equal(t, "embedding.completed", letters[0].Event)
+			assert.Equal(t, r.URL, letters[0].URL)
+			assert.Equal(t, tt.attempts, letters[0].Attempts)
+			assert.JSONEq(t, `{"id": "1"}`, string(letters[0].Payload))
+		})
+	}
+}
+
+func TestDeliverClose(t *testing.T) {
+	r := newReceiver("", http.StatusServiceUnavailable)
+	defer r.Close()
+	deadLetterFile := filepath.Join(t.TempDir(), "dead-letters.jsonl")
+	sender := New(Options{Retries: 10, RetryDelay: time.Hour, DeadLetterFile: deadLetterFile})
+
+	sender.Deliver(r.URL, "form.filled", map[string]string{"form": "bug report"})
+	require.Eventually(t, func() bool {
+		deliveries, _, _ := r.received()
+		return len(deliveries) == 1
+	}, time.Second, time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, sender.Close(ctx), context.DeadlineExceeded)
+
+	letters := deadLetters(t, deadLetterFile)
+	require.Len(t, letters, 1, "the deliveries still failing are dead-lettered when the sender closes")
+	assert.Equal(t, 1, letters[0].Attempts)
+	assert.Contains(t, letters[0].Error, "503 Service Unavailable")
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"id": "1"}`)
+	signed := func(secret string, sent time.Time) http.Header {
+		timestamp := strconv.FormatInt(sent.Unix(), 10)
+		header := http.Header{}
+		header.Set(TimestampHeader, timestamp)
+		header.Set(SignatureHeader, Sign(secret, timestamp, body))
+		return header
+	}
+	assert.NoError(t, Verify("s3cret", signed("s3cret", now), body, now, time.Minute))
+	assert.ErrorIs(t, Verify("s3cret", signed("guess", now), body, now, time.Minute), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("s3cret", signed("s3cret", now.Add(-time.Hour)), body, now, time.Minute), ErrInvalidSignature, "replayed")
+	assert.ErrorIs(t, Verify("s3cret", signed("s3cret", now), []byte(`{"id": "2"}`), now, time.Minute), ErrInvalidSignature, "tampered")
+	assert.ErrorIs(t, Verify("s3cret", http.Header{}, body, now, time.Minute), ErrInvalidSignature)
+}